@@ -19,24 +19,37 @@
 package acsclient
 
 import (
+	"crypto/tls"
 	"errors"
+	"net/http"
 	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/cihub/seelog"
 )
 
+// acsShardHeader is the header of the websocket upgrade request selecting the
+// ACS shard to connect to, when an endpoint server name is configured
+const acsShardHeader = "X-ACS-Shard"
+
 // clientServer implements ClientServer for acs.
 type clientServer struct {
 	wsclient.ClientServerImpl
+	// ackBatcher batches the acks sent to ACS, nil if acks are not batched
+	ackBatcher *messageBatcher
+	// ackSendHook is called with every ack before it's sent, nil if not set
+	ackSendHook func(ack *ecsacs.AckRequest)
 }
 
 // New returns a client/server to bidirectionally communicate with ACS
 // The returned struct should have both 'Connect' and 'Serve' called upon it
-// before being used.
-func New(url string, cfg *config.Config, credentialProvider *credentials.Credentials, rwTimeout time.Duration) wsclient.ClientServer {
+// before being used. The certificate chain of ACS is verified against the
+// pinned intermediate CAs during the TLS handshake if verification is not nil.
+func New(url string, cfg *config.Config, credentialProvider *credentials.Credentials, rwTimeout time.Duration,
+	tlsSessionCache tls.ClientSessionCache, verification *SecureBootVerification) wsclient.ClientServer {
 	cs := &clientServer{}
 	cs.URL = url
 	cs.CredentialProvider = credentialProvider
@@ -44,10 +57,65 @@ func New(url string, cfg *config.Config, credentialProvider *credentials.Credent
 	cs.ServiceError = &acsError{}
 	cs.RequestHandlers = make(map[string]wsclient.RequestHandler)
 	cs.TypeDecoder = NewACSDecoder()
+	cs.MessagePriorities = acsMessagePriorities
+	cs.PriorityThreshold = wsclient.MessagePriority(cfg.ACSPriorityMessageThreshold)
+	cs.IPVersion = cfg.ACSIPVersion
+	if cfg.ACSEndpointSNI != "" {
+		cs.ServerName = cfg.ACSEndpointSNI
+		cs.RequestHeaders = http.Header{}
+		cs.RequestHeaders.Set(acsShardHeader, cfg.ACSEndpointSNI)
+	}
 	cs.RWTimeout = rwTimeout
+	cs.TLSSessionCache = tlsSessionCache
+	if verification != nil {
+		cs.VerifyPeerCertificate = verification.VerifyPeerCertificate
+	}
+	if cfg.ACSAckBatchWindow > 0 {
+		cs.ackBatcher = newMessageBatcher(cfg.ACSAckBatchWindow, cs.WriteMessage)
+	}
 	return cs
 }
 
+// Connect opens the websocket connection to ACS. Certificate pinning errors are
+// returned as is, so that they are not retried
+func (cs *clientServer) Connect() error {
+	err := cs.ClientServerImpl.Connect()
+	var pinErr *CertificatePinError
+	if errors.As(err, &pinErr) {
+		return pinErr
+	}
+	return err
+}
+
+// UseAckSendHook sets the callback invoked with every ack before it's sent to
+// ACS, which may set the fields of the ack. Like request handlers, it must be
+// set prior to connecting
+func (cs *clientServer) UseAckSendHook(hook func(ack *ecsacs.AckRequest)) {
+	cs.ackSendHook = hook
+}
+
+// MakeRequest makes a request using the given input. Acks are batched with the
+// other acks sent within the batch window, if enabled
+func (cs *clientServer) MakeRequest(input interface{}) error {
+	if ack, ok := input.(*ecsacs.AckRequest); ok && cs.ackSendHook != nil {
+		cs.ackSendHook(ack)
+	}
+	if cs.ackBatcher == nil || !isBatchedRequest(input) {
+		return cs.ClientServerImpl.MakeRequest(input)
+	}
+	send, err := cs.CreateRequestMessage(input)
+	if err != nil {
+		return err
+	}
+	if cs.MakeRequestHook != nil {
+		send, err = cs.MakeRequestHook(send)
+		if err != nil {
+			return err
+		}
+	}
+	return cs.ackBatcher.send(send)
+}
+
 // Serve begins serving requests using previously registered handlers (see
 // AddRequestHandler). All request handlers should be added prior to making this
 // call as unhandled requests will be discarded.
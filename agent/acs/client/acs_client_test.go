@@ -157,6 +157,37 @@ func TestWriteAckRequest(t *testing.T) {
 	assert.Equal(t, "AckRequest", msg.Type)
 }
 
+func TestAckSendHook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := mock_wsconn.NewMockWebsocketConn(ctrl)
+	conn.EXPECT().SetWriteDeadline(gomock.Any()).Return(nil).Times(3)
+	conn.EXPECT().Close()
+	cs := testCS(conn)
+	defer cs.Close()
+	cs.(*clientServer).UseAckSendHook(func(ack *ecsacs.AckRequest) {
+		ack.CorrelationId = aws.String("correlation-id")
+	})
+
+	var writes [][]byte
+	conn.EXPECT().WriteMessage(gomock.Any(), gomock.Any()).Do(func(_ int, data []byte) {
+		writes = append(writes, data)
+	}).Times(2)
+
+	assert.NoError(t, cs.MakeRequest(&ecsacs.AckRequest{MessageId: aws.String("message-id")}))
+	// Other requests aren't passed to the hook
+	assert.NoError(t, cs.MakeRequest(&ecsacs.HeartbeatAckRequest{MessageId: aws.String("message-id")}))
+
+	msg := &wsclient.RequestMessage{}
+	assert.NoError(t, json.Unmarshal(writes[0], msg))
+	ack := &ecsacs.AckRequest{}
+	assert.NoError(t, json.Unmarshal(msg.Message, ack))
+	assert.Equal(t, "correlation-id", aws.StringValue(ack.CorrelationId))
+	assert.Equal(t, "message-id", aws.StringValue(ack.MessageId))
+	assert.NotContains(t, string(writes[1]), "correlationId")
+}
+
 func TestPayloadHandlerCalled(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -261,7 +292,7 @@ func TestConnect(t *testing.T) {
 		t.Fatal(<-serverErr)
 	}()
 
-	cs := New(server.URL, testCfg, testCreds, rwTimeout)
+	cs := New(server.URL, testCfg, testCreds, rwTimeout, nil, nil)
 	// Wait for up to a second for the mock server to launch
 	for i := 0; i < 100; i++ {
 		err = cs.Connect()
@@ -325,6 +356,20 @@ func TestConnect(t *testing.T) {
 	close(serverChan)
 }
 
+func TestNewSetsEndpointSNI(t *testing.T) {
+	cfg := &config.Config{
+		AWSRegion:      "us-east-1",
+		ACSEndpointSNI: "shard-1.ecs.us-east-1.amazonaws.com",
+	}
+	cs := New("https://ecs.us-east-1.amazonaws.com", cfg, testCreds, rwTimeout, nil, nil).(*clientServer)
+	assert.Equal(t, "shard-1.ecs.us-east-1.amazonaws.com", cs.ServerName)
+	assert.Equal(t, "shard-1.ecs.us-east-1.amazonaws.com", cs.RequestHeaders.Get(acsShardHeader))
+
+	cs = New("https://ecs.us-east-1.amazonaws.com", testCfg, testCreds, rwTimeout, nil, nil).(*clientServer)
+	assert.Empty(t, cs.ServerName)
+	assert.Empty(t, cs.RequestHeaders)
+}
+
 func TestConnectClientError(t *testing.T) {
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(400)
@@ -332,7 +377,7 @@ func TestConnectClientError(t *testing.T) {
 	}))
 	defer testServer.Close()
 
-	cs := New(testServer.URL, testCfg, testCreds, rwTimeout)
+	cs := New(testServer.URL, testCfg, testCreds, rwTimeout, nil, nil)
 	err := cs.Connect()
 	_, ok := err.(*wsclient.WSError)
 	assert.True(t, ok, "Connect error expected to be a WSError type")
@@ -340,7 +385,7 @@ func TestConnectClientError(t *testing.T) {
 }
 
 func testCS(conn *mock_wsconn.MockWebsocketConn) wsclient.ClientServer {
-	foo := New("localhost:443", testCfg, testCreds, rwTimeout)
+	foo := New("localhost:443", testCfg, testCreds, rwTimeout, nil, nil)
 	cs := foo.(*clientServer)
 	cs.SetConnection(conn)
 	return cs
@@ -20,6 +20,28 @@ import (
 
 var acsRecognizedTypes []interface{}
 
+// Priorities with which messages received from ACS are dispatched to their
+// handlers. A delayed heartbeat ack can cause ACS to close the connection, so
+// heartbeats are handled first, and task payloads, which can take a while to
+// handle under load, last
+const (
+	payloadMessagePriority wsclient.MessagePriority = iota
+	attachENIMessagePriority
+	credentialsMessagePriority
+	heartbeatMessagePriority
+)
+
+// acsMessagePriorities maps the types of messages received from ACS to their
+// dispatch priority. Messages of other types are dispatched as soon as they
+// are read
+var acsMessagePriorities = map[string]wsclient.MessagePriority{
+	"HeartbeatMessage":                       heartbeatMessagePriority,
+	"IAMRoleCredentialsMessage":              credentialsMessagePriority,
+	"AttachTaskNetworkInterfacesMessage":     attachENIMessagePriority,
+	"AttachInstanceNetworkInterfacesMessage": attachENIMessagePriority,
+	"PayloadMessage":                         payloadMessagePriority,
+}
+
 func init() {
 	// This list is currently *manually updated* and assumes that the generated
 	// struct type-names within the package *exactly match* the type sent by ACS/TCS
@@ -45,12 +67,28 @@ func init() {
 		ecsacs.InvalidInstanceException{},
 		ecsacs.AccessDeniedException{},
 		ecsacs.InactiveInstanceException{},
+		ecsacs.ProtocolVersionUnsupportedException{},
 		ecsacs.ErrorMessage{},
 		ecsacs.AttachTaskNetworkInterfacesMessage{},
 		ecsacs.AttachInstanceNetworkInterfacesMessage{},
 		ecsacs.TaskManifestMessage{},
 		ecsacs.TaskStopVerificationAck{},
 		ecsacs.TaskStopVerificationMessage{},
+		ecsacs.TaskDrainMessage{},
+		ecsacs.DiagnosticBundleRequest{},
+		ecsacs.ManagedAgentUpdateMessage{},
+		ecsacs.ConfirmAttachmentMessage{},
+		ecsacs.ContainerInstanceStateReport{},
+		ecsacs.ContainerInstanceStatusMessage{},
+		ecsacs.UpdateAttributesMessage{},
+		ecsacs.TaskEngineEventMessage{},
+		ecsacs.GetInstanceStateRequestMessage{},
+		ecsacs.GetInstanceStateResponseMessage{},
+		ecsacs.AgentCrashReportMessage{},
+		ecsacs.ACSAuthChallengeMessage{},
+		ecsacs.ACSAuthChallengeResponseMessage{},
+		ecsacs.ACSOperatorAlertMessage{},
+		ecsacs.AckEchoMessage{},
 	}
 }
 
@@ -0,0 +1,388 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package acsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient/wsconn"
+	"github.com/cihub/seelog"
+)
+
+// sendQueueCapacity is the maximum number of requests of the components waiting
+// to be written, further requests wait for room in the queue
+const sendQueueCapacity = 64
+
+// errRouterStopped is returned for the requests of the components once the
+// router is stopped
+var errRouterStopped = errors.New("acs message router: router stopped")
+
+// ACSMessageRouter shares a single websocket connection to the backend among
+// several components, each one getting a virtual ClientServer from Register.
+// The messages received are routed to the component that registered the
+// longest prefix of their type. The requests of the components are written by
+// a single goroutine, highest component priority first, so that a component
+// sending a burst of requests doesn't delay the requests of the components
+// with a higher priority. The connection is closed once all the components
+// have closed their ClientServer
+type ACSMessageRouter struct {
+	conn      wsclient.ClientServer
+	ctx       context.Context
+	sendQueue *wsclient.MessagePriorityQueue
+	lock      sync.RWMutex
+	// components maps the names of the components to their ClientServer
+	components map[string]*routedClientServer
+	// prefixes maps the message type prefixes to the names of the components
+	prefixes map[string]string
+	// handledTypes are the message types whose request handler is registered
+	// on the connection
+	handledTypes map[string]struct{}
+	connLock     sync.Mutex
+	// connected is true once the shared connection is connected, until it's
+	// no longer served
+	connected bool
+	// serving is the serving of the shared connection, nil if not served
+	serving *routerServing
+}
+
+// routerServing is a serving of the shared connection, err being set before
+// done is closed
+type routerServing struct {
+	done chan struct{}
+	err  error
+}
+
+// routedRequest is a request of a component waiting to be written
+type routedRequest struct {
+	// input is the request to make, if raw is nil
+	input interface{}
+	raw   []byte
+	sent  chan error
+}
+
+// NewACSMessageRouter returns a new ACSMessageRouter sharing the connection.
+// The requests of the components are written until the context is canceled
+func NewACSMessageRouter(ctx context.Context, conn wsclient.ClientServer) *ACSMessageRouter {
+	router := &ACSMessageRouter{
+		conn:         conn,
+		ctx:          ctx,
+		sendQueue:    wsclient.NewMessagePriorityQueue(sendQueueCapacity),
+		components:   make(map[string]*routedClientServer),
+		prefixes:     make(map[string]string),
+		handledTypes: make(map[string]struct{}),
+	}
+	conn.SetAnyRequestHandler(router.routeAny)
+	go router.writeRequests()
+	return router
+}
+
+// Register returns the ClientServer of a component receiving the messages whose
+// type starts with one of the prefixes. The requests of the component are
+// written with the priority, ahead of the requests of lower priority
+func (router *ACSMessageRouter) Register(name string, priority wsclient.MessagePriority,
+	prefixes ...string) (wsclient.ClientServer, error) {
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("acs message router: no message type prefix for component %s", name)
+	}
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	if _, ok := router.components[name]; ok {
+		return nil, fmt.Errorf("acs message router: component %s already registered", name)
+	}
+	for _, prefix := range prefixes {
+		if owner, ok := router.prefixes[prefix]; ok {
+			return nil, fmt.Errorf("acs message router: message type prefix %q of component %s already registered by %s",
+				prefix, name, owner)
+		}
+	}
+	component := &routedClientServer{
+		router:   router,
+		name:     name,
+		priority: priority,
+		handlers: make(map[string]wsclient.RequestHandler),
+	}
+	for _, prefix := range prefixes {
+		router.prefixes[prefix] = name
+	}
+	router.components[name] = component
+	return component, nil
+}
+
+// componentOf returns the component receiving the messages of the type, nil if
+// no component registered a prefix of the type
+func (router *ACSMessageRouter) componentOf(typeStr string) *routedClientServer {
+	router.lock.RLock()
+	defer router.lock.RUnlock()
+	longest := -1
+	var component *routedClientServer
+	for prefix, name := range router.prefixes {
+		if strings.HasPrefix(typeStr, prefix) && len(prefix) > longest {
+			longest = len(prefix)
+			component = router.components[name]
+		}
+	}
+	return component
+}
+
+// handleType registers a request handler for the message type on the connection
+// dispatching the messages to the components, handlerType being the type of the
+// request handlers of the message type
+func (router *ACSMessageRouter) handleType(typeStr string, handlerType reflect.Type) {
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	if _, ok := router.handledTypes[typeStr]; ok {
+		return
+	}
+	router.handledTypes[typeStr] = struct{}{}
+	dispatch := reflect.MakeFunc(handlerType, func(args []reflect.Value) []reflect.Value {
+		router.dispatch(typeStr, args[0].Interface())
+		results := make([]reflect.Value, handlerType.NumOut())
+		for i := range results {
+			results[i] = reflect.Zero(handlerType.Out(i))
+		}
+		return results
+	})
+	router.conn.AddRequestHandler(dispatch.Interface())
+}
+
+// dispatch calls the request handler of the component receiving the message
+func (router *ACSMessageRouter) dispatch(typeStr string, message interface{}) {
+	component := router.componentOf(typeStr)
+	if component == nil {
+		seelog.Infof("ACS message router: no component for message type: %s", typeStr)
+		return
+	}
+	if handler := component.requestHandler(typeStr); handler != nil {
+		reflect.ValueOf(handler).Call([]reflect.Value{reflect.ValueOf(message)})
+	}
+}
+
+// routeAny calls the any request handler of the component receiving the message
+func (router *ACSMessageRouter) routeAny(message interface{}) {
+	messageType := reflect.TypeOf(message)
+	if messageType == nil || messageType.Kind() != reflect.Ptr {
+		return
+	}
+	component := router.componentOf(messageType.Elem().Name())
+	if component == nil {
+		return
+	}
+	if handler := component.anyRequestHandler(); handler != nil {
+		reflect.ValueOf(handler).Call([]reflect.Value{reflect.ValueOf(message)})
+	}
+}
+
+// send queues the request of the component and waits for it to be written
+func (router *ACSMessageRouter) send(component *routedClientServer, request *routedRequest) error {
+	if router.ctx.Err() != nil {
+		return errRouterStopped
+	}
+	request.sent = make(chan error, 1)
+	if err := router.sendQueue.Push(router.ctx, component.name, request, component.priority); err != nil {
+		return errRouterStopped
+	}
+	select {
+	case err := <-request.sent:
+		return err
+	case <-router.ctx.Done():
+		return errRouterStopped
+	}
+}
+
+// writeRequests writes the queued requests, highest priority first, until the
+// context is canceled
+func (router *ACSMessageRouter) writeRequests() {
+	for {
+		select {
+		case <-router.ctx.Done():
+			return
+		case <-router.sendQueue.Ready():
+		}
+		for router.ctx.Err() == nil {
+			_, queued, ok := router.sendQueue.Pop()
+			if !ok {
+				break
+			}
+			request := queued.(*routedRequest)
+			if request.raw != nil {
+				request.sent <- router.conn.WriteMessage(request.raw)
+			} else {
+				request.sent <- router.conn.MakeRequest(request.input)
+			}
+		}
+	}
+}
+
+// connect connects the shared connection, unless already connected
+func (router *ACSMessageRouter) connect() error {
+	router.connLock.Lock()
+	defer router.connLock.Unlock()
+	if router.connected {
+		return nil
+	}
+	if err := router.conn.Connect(); err != nil {
+		return err
+	}
+	router.connected = true
+	return nil
+}
+
+// isConnected returns true if the shared connection is connected
+func (router *ACSMessageRouter) isConnected() bool {
+	router.connLock.Lock()
+	defer router.connLock.Unlock()
+	return router.connected
+}
+
+// serve serves the messages of the shared connection until it's closed, the
+// components calling it concurrently wait for the same serving to end
+func (router *ACSMessageRouter) serve() error {
+	router.connLock.Lock()
+	serving := router.serving
+	if serving == nil {
+		serving = &routerServing{done: make(chan struct{})}
+		router.serving = serving
+		go func() {
+			err := router.conn.Serve()
+			router.connLock.Lock()
+			serving.err = err
+			router.connected = false
+			router.serving = nil
+			router.connLock.Unlock()
+			close(serving.done)
+		}()
+	}
+	router.connLock.Unlock()
+	<-serving.done
+	return serving.err
+}
+
+// unregister removes the component, and disconnects the shared connection once
+// no component is left
+func (router *ACSMessageRouter) unregister(component *routedClientServer) error {
+	router.lock.Lock()
+	if _, ok := router.components[component.name]; !ok {
+		router.lock.Unlock()
+		return nil
+	}
+	delete(router.components, component.name)
+	for prefix, name := range router.prefixes {
+		if name == component.name {
+			delete(router.prefixes, prefix)
+		}
+	}
+	remaining := len(router.components)
+	router.lock.Unlock()
+	if remaining > 0 {
+		return nil
+	}
+	return router.conn.Disconnect()
+}
+
+// routedClientServer is the virtual ClientServer of a component of the router
+type routedClientServer struct {
+	router     *ACSMessageRouter
+	name       string
+	priority   wsclient.MessagePriority
+	lock       sync.RWMutex
+	handlers   map[string]wsclient.RequestHandler
+	anyHandler wsclient.RequestHandler
+}
+
+// AddRequestHandler adds the request handler of a message type routed to the
+// component. It panics if the messages of the type are routed to another
+// component, like the ClientServer does for unrecognized types
+func (cs *routedClientServer) AddRequestHandler(f wsclient.RequestHandler) {
+	handlerType := reflect.TypeOf(f)
+	typeStr := handlerType.In(0).Elem().Name()
+	if cs.router.componentOf(typeStr) != cs {
+		panic(fmt.Sprintf("AddRequestHandler called with message type %s not routed to component %s", typeStr, cs.name))
+	}
+	cs.lock.Lock()
+	cs.handlers[typeStr] = f
+	cs.lock.Unlock()
+	cs.router.handleType(typeStr, handlerType)
+}
+
+func (cs *routedClientServer) requestHandler(typeStr string) wsclient.RequestHandler {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	return cs.handlers[typeStr]
+}
+
+// SetAnyRequestHandler sets the handler called with every message routed to the
+// component
+func (cs *routedClientServer) SetAnyRequestHandler(f wsclient.RequestHandler) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cs.anyHandler = f
+}
+
+func (cs *routedClientServer) anyRequestHandler() wsclient.RequestHandler {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	return cs.anyHandler
+}
+
+// MakeRequest makes the request on the shared connection
+func (cs *routedClientServer) MakeRequest(input interface{}) error {
+	return cs.router.send(cs, &routedRequest{input: input})
+}
+
+// WriteMessage writes the message on the shared connection
+func (cs *routedClientServer) WriteMessage(input []byte) error {
+	return cs.router.send(cs, &routedRequest{raw: input})
+}
+
+// Connect connects the shared connection, unless already connected
+func (cs *routedClientServer) Connect() error {
+	return cs.router.connect()
+}
+
+// IsConnected returns true if the shared connection is connected
+func (cs *routedClientServer) IsConnected() bool {
+	return cs.router.isConnected()
+}
+
+// SetConnection sets the websocket of the shared connection
+func (cs *routedClientServer) SetConnection(conn wsconn.WebsocketConn) {
+	cs.router.conn.SetConnection(conn)
+}
+
+// Disconnect removes the component from the router
+func (cs *routedClientServer) Disconnect(...interface{}) error {
+	return cs.router.unregister(cs)
+}
+
+// Serve serves the messages of the shared connection until it's closed
+func (cs *routedClientServer) Serve() error {
+	return cs.router.serve()
+}
+
+// SetReadDeadline sets the read deadline of the shared connection
+func (cs *routedClientServer) SetReadDeadline(t time.Time) error {
+	return cs.router.conn.SetReadDeadline(t)
+}
+
+// Close removes the component from the router
+func (cs *routedClientServer) Close() error {
+	return cs.Disconnect()
+}
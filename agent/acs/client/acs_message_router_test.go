@@ -0,0 +1,262 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package acsclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startRouterTestServer starts a websocket server writing the messages sent on
+// the returned channel, and returning the requests read on the other one
+func startRouterTestServer(t *testing.T) (*httptest.Server, chan<- string, <-chan string) {
+	serverChan := make(chan string, 10)
+	requestsChan := make(chan string, 10)
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("websocket upgrade failed: %v", err)
+			return
+		}
+		defer ws.Close()
+		go func() {
+			for {
+				_, msg, err := ws.ReadMessage()
+				if err != nil {
+					return
+				}
+				requestsChan <- string(msg)
+			}
+		}()
+		for str := range serverChan {
+			if err := ws.WriteMessage(websocket.TextMessage, []byte(str)); err != nil {
+				return
+			}
+		}
+	}))
+	return server, serverChan, requestsChan
+}
+
+// TestACSMessageRouterEndToEnd tests that the messages of a shared connection
+// are routed to the simulated components by type, and that the requests of all
+// the components are written on the connection
+func TestACSMessageRouterEndToEnd(t *testing.T) {
+	server, serverChan, requestsChan := startRouterTestServer(t)
+	defer server.Close()
+	defer close(serverChan)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router := NewACSMessageRouter(ctx, New(server.URL, testCfg, testCreds, 10*time.Second, nil, nil))
+
+	payloadComponent, err := router.Register("payload", wsclient.MessagePriority(1), "Payload")
+	require.NoError(t, err)
+	heartbeatComponent, err := router.Register("heartbeat", wsclient.MessagePriority(2), "Heartbeat")
+	require.NoError(t, err)
+
+	payloads := make(chan *ecsacs.PayloadMessage, 1)
+	payloadComponent.AddRequestHandler(func(message *ecsacs.PayloadMessage) {
+		payloads <- message
+	})
+	heartbeats := make(chan *ecsacs.HeartbeatMessage, 1)
+	heartbeatComponent.AddRequestHandler(func(message *ecsacs.HeartbeatMessage) {
+		heartbeats <- message
+	})
+	payloadAny := make(chan interface{}, 2)
+	payloadComponent.SetAnyRequestHandler(func(message interface{}) {
+		payloadAny <- message
+	})
+
+	require.NoError(t, payloadComponent.Connect())
+	// The shared connection is only connected once
+	require.NoError(t, heartbeatComponent.Connect())
+	served := make(chan error, 2)
+	go func() { served <- payloadComponent.Serve() }()
+	go func() { served <- heartbeatComponent.Serve() }()
+
+	serverChan <- `{"type":"PayloadMessage","message":{"messageId":"payload-1","tasks":[{"arn":"arn"}]}}`
+	serverChan <- `{"type":"HeartbeatMessage","message":{"messageId":"heartbeat-1","healthy":true}}`
+
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, "payload-1", aws.StringValue(payload.MessageId))
+	case <-time.After(5 * time.Second):
+		t.Fatal("payload message not routed to the payload component")
+	}
+	select {
+	case heartbeat := <-heartbeats:
+		assert.Equal(t, "heartbeat-1", aws.StringValue(heartbeat.MessageId))
+	case <-time.After(5 * time.Second):
+		t.Fatal("heartbeat message not routed to the heartbeat component")
+	}
+	// The any request handler of a component is only called with its messages
+	assert.IsType(t, &ecsacs.PayloadMessage{}, <-payloadAny)
+	assert.Len(t, payloadAny, 0)
+	assert.Len(t, payloads, 0)
+	assert.Len(t, heartbeats, 0)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, payloadComponent.MakeRequest(&ecsacs.AckRequest{MessageId: aws.String("payload-1")}))
+	}()
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, heartbeatComponent.MakeRequest(&ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat-1")}))
+	}()
+	wg.Wait()
+
+	var requests []string
+	for len(requests) < 2 {
+		select {
+		case request := <-requestsChan:
+			requests = append(requests, request)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("requests not written on the connection: %v", requests)
+		}
+	}
+	joined := strings.Join(requests, "\n")
+	assert.Contains(t, joined, `"type":"AckRequest"`)
+	assert.Contains(t, joined, `"type":"HeartbeatAckRequest"`)
+
+	// The connection is only closed once both components are closed
+	assert.NoError(t, payloadComponent.Close())
+	assert.True(t, heartbeatComponent.IsConnected())
+	assert.NoError(t, heartbeatComponent.Close())
+	for i := 0; i < 2; i++ {
+		select {
+		case <-served:
+		case <-time.After(5 * time.Second):
+			t.Fatal("components still served after the connection was closed")
+		}
+	}
+}
+
+func TestACSMessageRouterWritesHigherPriorityFirst(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := mock_wsclient.NewMockClientServer(ctrl)
+	conn.EXPECT().SetAnyRequestHandler(gomock.Any())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router := NewACSMessageRouter(ctx, conn)
+
+	low, err := router.Register("low", wsclient.MessagePriority(0), "Low")
+	require.NoError(t, err)
+	high, err := router.Register("high", wsclient.MessagePriority(1), "High")
+	require.NoError(t, err)
+
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	var lock sync.Mutex
+	var written []string
+	conn.EXPECT().WriteMessage(gomock.Any()).DoAndReturn(func(message []byte) error {
+		lock.Lock()
+		written = append(written, string(message))
+		first := len(written) == 1
+		lock.Unlock()
+		if first {
+			close(blocked)
+			<-release
+		}
+		return nil
+	}).Times(4)
+
+	var wg sync.WaitGroup
+	send := func(cs wsclient.ClientServer, message string) {
+		defer wg.Done()
+		assert.NoError(t, cs.WriteMessage([]byte(message)))
+	}
+	wg.Add(1)
+	go send(low, "low-1")
+	<-blocked
+	// The writes queued while the first one is blocked are written highest
+	// priority first
+	wg.Add(2)
+	go send(low, "low-2")
+	go send(high, "high-1")
+	for router.sendQueue.Len() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	wg.Add(1)
+	go send(high, "high-2")
+	for router.sendQueue.Len() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, "low-1", written[0])
+	assert.ElementsMatch(t, []string{"high-1", "high-2"}, written[1:3])
+	assert.Equal(t, "low-2", written[3])
+}
+
+func TestACSMessageRouterRegister(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := mock_wsclient.NewMockClientServer(ctrl)
+	conn.EXPECT().SetAnyRequestHandler(gomock.Any())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	router := NewACSMessageRouter(ctx, conn)
+
+	_, err := router.Register("none", wsclient.MessagePriority(0))
+	assert.Error(t, err)
+	tasks, err := router.Register("tasks", wsclient.MessagePriority(0), "Payload", "TaskManifest")
+	require.NoError(t, err)
+	_, err = router.Register("tasks", wsclient.MessagePriority(0), "Heartbeat")
+	assert.Error(t, err, "component registered twice")
+	_, err = router.Register("payload", wsclient.MessagePriority(0), "Payload")
+	assert.Error(t, err, "prefix registered twice")
+	// A longer prefix takes the messages of its types from the shorter one
+	refresh, err := router.Register("refresh", wsclient.MessagePriority(0), "PayloadCredentials")
+	require.NoError(t, err)
+	assert.Equal(t, tasks, router.componentOf("PayloadMessage"))
+	assert.Equal(t, refresh, router.componentOf("PayloadCredentialsMessage"))
+	assert.Nil(t, router.componentOf("HeartbeatMessage"))
+
+	// The handlers of the types routed to another component are refused
+	assert.Panics(t, func() {
+		tasks.AddRequestHandler(func(*ecsacs.HeartbeatMessage) {})
+	})
+	conn.EXPECT().AddRequestHandler(gomock.Any()).Times(1)
+	tasks.AddRequestHandler(func(*ecsacs.PayloadMessage) {})
+	// The handler is only registered once on the connection
+	tasks.AddRequestHandler(func(*ecsacs.PayloadMessage) {})
+
+	// The requests of the components fail once the router is stopped
+	cancel()
+	assert.Equal(t, errRouterStopped, tasks.MakeRequest(&ecsacs.AckRequest{}))
+}
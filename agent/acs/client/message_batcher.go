@@ -0,0 +1,98 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package acsclient
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+)
+
+// messageBatch is a set of messages written to the websocket connection in a
+// single frame
+type messageBatch struct {
+	messages [][]byte
+	// done is closed once the batch has been written
+	done chan struct{}
+	err  error
+}
+
+// messageBatcher accumulates the messages sent within a time window and writes
+// them to the websocket connection as a single frame holding a JSON array of the
+// messages, to save the overhead of a frame per message. A message sent alone
+// within its window is written as is, in the same format as without batching
+type messageBatcher struct {
+	window time.Duration
+	write  func([]byte) error
+	lock   sync.Mutex
+	batch  *messageBatch
+}
+
+// newMessageBatcher returns a new messageBatcher object
+func newMessageBatcher(window time.Duration, write func([]byte) error) *messageBatcher {
+	return &messageBatcher{
+		window: window,
+		write:  write,
+	}
+}
+
+// send adds the message to the current batch, starting a new one if needed. It
+// blocks until the batch has been written and returns the error of the write
+func (batcher *messageBatcher) send(message []byte) error {
+	batcher.lock.Lock()
+	if batcher.batch == nil {
+		batcher.batch = &messageBatch{done: make(chan struct{})}
+		time.AfterFunc(batcher.window, batcher.flush)
+	}
+	batch := batcher.batch
+	batch.messages = append(batch.messages, message)
+	batcher.lock.Unlock()
+
+	<-batch.done
+	return batch.err
+}
+
+// flush writes the current batch and wakes up the senders of its messages
+func (batcher *messageBatcher) flush() {
+	batcher.lock.Lock()
+	batch := batcher.batch
+	batcher.batch = nil
+	batcher.lock.Unlock()
+
+	batch.err = batcher.write(batchFrame(batch.messages))
+	close(batch.done)
+}
+
+// batchFrame returns the frame holding the messages
+func batchFrame(messages [][]byte) []byte {
+	if len(messages) == 1 {
+		return messages[0]
+	}
+	frame := make([]byte, 0, len(messages)*len(messages[0]))
+	frame = append(frame, '[')
+	frame = append(frame, bytes.Join(messages, []byte{','})...)
+	return append(frame, ']')
+}
+
+// isBatchedRequest returns true if the request is an ack, which are the messages
+// being batched
+func isBatchedRequest(input interface{}) bool {
+	switch input.(type) {
+	case *ecsacs.AckRequest, *ecsacs.HeartbeatAckRequest, *ecsacs.IAMRoleCredentialsAckRequest:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package acsclient
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	mock_wsconn "github.com/aws/amazon-ecs-agent/agent/wsclient/wsconn/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// frameRecorder records the frames written by a messageBatcher
+type frameRecorder struct {
+	lock   sync.Mutex
+	frames []string
+	err    error
+}
+
+func (recorder *frameRecorder) write(frame []byte) error {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.frames = append(recorder.frames, string(frame))
+	return recorder.err
+}
+
+func (recorder *frameRecorder) written() []string {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return append([]string(nil), recorder.frames...)
+}
+
+// sendConcurrently sends the messages from separate goroutines and waits for
+// all of them to be written
+func sendConcurrently(batcher *messageBatcher, messages ...string) []error {
+	errs := make([]error, len(messages))
+	var wg sync.WaitGroup
+	for i, message := range messages {
+		wg.Add(1)
+		go func(i int, message string) {
+			defer wg.Done()
+			errs[i] = batcher.send([]byte(message))
+		}(i, message)
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestMessageBatcherBatchesMessagesWithinWindow(t *testing.T) {
+	recorder := &frameRecorder{}
+	batcher := newMessageBatcher(100*time.Millisecond, recorder.write)
+
+	errs := sendConcurrently(batcher, `{"id":1}`, `{"id":2}`, `{"id":3}`)
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+
+	frames := recorder.written()
+	require.Len(t, frames, 1)
+	var messages []map[string]int
+	require.NoError(t, json.Unmarshal([]byte(frames[0]), &messages))
+	ids := make(map[int]bool)
+	for _, message := range messages {
+		ids[message["id"]] = true
+	}
+	assert.Equal(t, map[int]bool{1: true, 2: true, 3: true}, ids)
+}
+
+func TestMessageBatcherDoesNotBatchMessagesOutsideWindow(t *testing.T) {
+	recorder := &frameRecorder{}
+	batcher := newMessageBatcher(time.Millisecond, recorder.write)
+
+	// send blocks until the batch is written, the second message is sent in
+	// the next window
+	assert.NoError(t, batcher.send([]byte(`{"id":1}`)))
+	assert.NoError(t, batcher.send([]byte(`{"id":2}`)))
+
+	// Messages alone in their window are written as is
+	assert.Equal(t, []string{`{"id":1}`, `{"id":2}`}, recorder.written())
+}
+
+func TestMessageBatcherWriteError(t *testing.T) {
+	recorder := &frameRecorder{err: errors.New("connection closed")}
+	batcher := newMessageBatcher(50*time.Millisecond, recorder.write)
+
+	errs := sendConcurrently(batcher, `{"id":1}`, `{"id":2}`)
+	for _, err := range errs {
+		assert.Error(t, err)
+	}
+}
+
+func TestMakeRequestBatchesAcks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := mock_wsconn.NewMockWebsocketConn(ctrl)
+	conn.EXPECT().SetWriteDeadline(gomock.Any()).Return(nil).AnyTimes()
+	conn.EXPECT().Close()
+	var frames [][]byte
+	conn.EXPECT().WriteMessage(gomock.Any(), gomock.Any()).Do(func(_ int, data []byte) {
+		frames = append(frames, data)
+	})
+
+	cfg := *testCfg
+	cfg.ACSAckBatchWindow = 100 * time.Millisecond
+	cs := New("localhost:443", &cfg, testCreds, rwTimeout, nil, nil)
+	cs.SetConnection(conn)
+	defer cs.Close()
+
+	var wg sync.WaitGroup
+	for _, request := range []interface{}{
+		&ecsacs.AckRequest{MessageId: aws.String("payload")},
+		&ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat")},
+	} {
+		wg.Add(1)
+		go func(request interface{}) {
+			defer wg.Done()
+			assert.NoError(t, cs.MakeRequest(request))
+		}(request)
+	}
+	wg.Wait()
+
+	require.Len(t, frames, 1)
+	var messages []wsclient.RequestMessage
+	require.NoError(t, json.Unmarshal(frames[0], &messages))
+	types := make(map[string]bool)
+	for _, message := range messages {
+		types[message.Type] = true
+	}
+	assert.Equal(t, map[string]bool{"AckRequest": true, "HeartbeatAckRequest": true}, types)
+}
+
+func TestNewDisablesAckBatching(t *testing.T) {
+	cs := New("localhost:443", &config.Config{AWSRegion: "us-east-1"}, testCreds, rwTimeout, nil, nil).(*clientServer)
+	assert.Nil(t, cs.ackBatcher)
+}
@@ -0,0 +1,130 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package acsclient
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/pkg/errors"
+)
+
+// SecureBootVerification pins the certificate chain presented by ACS to a set
+// of intermediate CAs. Pinning the intermediates rather than the leaf
+// certificate lets ACS rotate its certificates without agent updates, while
+// still rejecting chains issued by any other CA trusted by the host.
+type SecureBootVerification struct {
+	intermediates []*x509.Certificate
+}
+
+// CertificatePinError is returned when the certificate chain of ACS doesn't
+// chain up to any of the pinned intermediate CAs. It's not retryable, ACS
+// presents the same chain when reconnecting.
+type CertificatePinError struct {
+	subject string
+	err     error
+}
+
+// Error implements error
+func (err *CertificatePinError) Error() string {
+	return fmt.Sprintf("certificate %s is not issued by any of the pinned intermediate CAs: %v", err.subject, err.err)
+}
+
+// Retry implements Retriable
+func (err *CertificatePinError) Retry() bool {
+	return false
+}
+
+// NewSecureBootVerification loads the intermediate CAs ACS certificates are
+// pinned to from ACSPinnedCAPath. It returns nil, disabling the verification,
+// when no path is configured or when ACSBypassCertPin is set.
+func NewSecureBootVerification(cfg *config.Config) (*SecureBootVerification, error) {
+	if cfg.ACSPinnedCAPath == "" || cfg.ACSBypassCertPin {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(cfg.ACSPinnedCAPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the pinned intermediate CAs")
+	}
+	return newSecureBootVerification(data)
+}
+
+// newSecureBootVerification returns a SecureBootVerification pinning the
+// intermediate CAs of the PEM encoded certificates
+func newSecureBootVerification(data []byte) (*SecureBootVerification, error) {
+	verification := &SecureBootVerification{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse pinned intermediate CA")
+		}
+		if !certificate.IsCA {
+			return nil, errors.Errorf("pinned certificate %s is not a CA", certificate.Subject)
+		}
+		verification.intermediates = append(verification.intermediates, certificate)
+	}
+	if len(verification.intermediates) == 0 {
+		return nil, errors.New("no pinned intermediate CA certificate found")
+	}
+	return verification, nil
+}
+
+// VerifyPeerCertificate is called during the TLS handshake with ACS. It
+// verifies that the certificate presented by ACS is issued by one of the pinned
+// intermediate CAs, directly or through the other intermediates presented by
+// ACS. The signatures of the chain are verified, so that it also holds when the
+// normal verification is skipped because insecure certificates are accepted.
+func (verification *SecureBootVerification) VerifyPeerCertificate(rawCerts [][]byte,
+	_ [][]*x509.Certificate) error {
+	if verification == nil {
+		return nil
+	}
+	if len(rawCerts) == 0 {
+		return errors.New("no certificate presented by ACS")
+	}
+	presented := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, rawCert := range rawCerts {
+		certificate, err := x509.ParseCertificate(rawCert)
+		if err != nil {
+			return errors.Wrap(err, "unable to parse certificate presented by ACS")
+		}
+		presented = append(presented, certificate)
+	}
+	options := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, intermediate := range verification.intermediates {
+		options.Roots.AddCert(intermediate)
+	}
+	for _, certificate := range presented[1:] {
+		options.Intermediates.AddCert(certificate)
+	}
+	if _, err := presented[0].Verify(options); err != nil {
+		return &CertificatePinError{subject: presented[0].Subject.String(), err: err}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package acsclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	apierrors "github.com/aws/amazon-ecs-agent/agent/api/errors"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCertificate is a certificate with its key, used to build the chains
+// presented by the test servers
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+}
+
+// newTestCertificate returns a certificate signed by the issuer, or a self
+// signed one if the issuer is nil
+func newTestCertificate(t *testing.T, commonName string, isCA bool, issuer *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		template.DNSNames = []string{commonName}
+	}
+	parent, parentKey := template, key
+	if issuer != nil {
+		parent, parentKey = issuer.certificate, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCertificate{certificate: certificate, key: key}
+}
+
+func (cert *testCertificate) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.certificate.Raw})
+}
+
+// testChains are the certificates of two intermediate CAs of the same root, and
+// a leaf certificate issued by each of them
+type testChains struct {
+	intermediate      *testCertificate
+	leaf              *testCertificate
+	otherIntermediate *testCertificate
+	otherLeaf         *testCertificate
+}
+
+func newTestChains(t *testing.T) *testChains {
+	root := newTestCertificate(t, "Test Root CA", true, nil)
+	chains := &testChains{
+		intermediate:      newTestCertificate(t, "Test Intermediate CA", true, root),
+		otherIntermediate: newTestCertificate(t, "Other Intermediate CA", true, root),
+	}
+	chains.leaf = newTestCertificate(t, "ecs.us-east-1.amazonaws.com", false, chains.intermediate)
+	chains.otherLeaf = newTestCertificate(t, "ecs.us-east-1.amazonaws.com", false, chains.otherIntermediate)
+	return chains
+}
+
+func rawCertificates(certificates ...*testCertificate) [][]byte {
+	var raw [][]byte
+	for _, cert := range certificates {
+		raw = append(raw, cert.certificate.Raw)
+	}
+	return raw
+}
+
+func TestNewSecureBootVerificationDisabled(t *testing.T) {
+	verification, err := NewSecureBootVerification(&config.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, verification)
+
+	verification, err = NewSecureBootVerification(&config.Config{
+		ACSPinnedCAPath:  "/nonexistent/acs-intermediates.pem",
+		ACSBypassCertPin: true,
+	})
+	assert.NoError(t, err)
+	assert.Nil(t, verification)
+
+	// A nil verification accepts any certificate
+	assert.NoError(t, verification.VerifyPeerCertificate(nil, nil))
+}
+
+func TestNewSecureBootVerificationInvalidPinnedCAs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure_boot_verification_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	chains := newTestChains(t)
+
+	_, err = NewSecureBootVerification(&config.Config{ACSPinnedCAPath: filepath.Join(dir, "nonexistent.pem")})
+	assert.Error(t, err, "missing file")
+
+	for name, data := range map[string][]byte{
+		"empty":  {},
+		"no pem": []byte("not a certificate"),
+		"leaf":   chains.leaf.pem(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "intermediates.pem")
+			require.NoError(t, ioutil.WriteFile(path, data, 0644))
+			_, err := NewSecureBootVerification(&config.Config{ACSPinnedCAPath: path})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSecureBootVerificationVerifyPeerCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure_boot_verification_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	chains := newTestChains(t)
+	path := filepath.Join(dir, "intermediates.pem")
+	require.NoError(t, ioutil.WriteFile(path, chains.intermediate.pem(), 0644))
+	verification, err := NewSecureBootVerification(&config.Config{ACSPinnedCAPath: path})
+	require.NoError(t, err)
+
+	assert.NoError(t, verification.VerifyPeerCertificate(rawCertificates(chains.leaf, chains.intermediate), nil))
+	// The chain is verified, presenting the pinned intermediate is not enough
+	for name, rawCerts := range map[string][][]byte{
+		"other intermediate":            rawCertificates(chains.otherLeaf, chains.otherIntermediate),
+		"pinned intermediate presented": rawCertificates(chains.otherLeaf, chains.intermediate),
+		"leaf only":                     rawCertificates(chains.otherLeaf),
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := verification.VerifyPeerCertificate(rawCerts, nil)
+			require.Error(t, err)
+			_, ok := err.(*CertificatePinError)
+			assert.True(t, ok, "expected a CertificatePinError")
+			assert.False(t, apierrors.IsRetryable(err))
+		})
+	}
+	assert.Error(t, verification.VerifyPeerCertificate(nil, nil))
+	assert.Error(t, verification.VerifyPeerCertificate([][]byte{[]byte("not a certificate")}, nil))
+}
+
+func TestConnectWithPinnedCertificates(t *testing.T) {
+	chains := newTestChains(t)
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upgrader.Upgrade(w, r, nil)
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: rawCertificates(chains.leaf, chains.intermediate),
+		PrivateKey:  chains.leaf.key,
+	}}}
+	server.StartTLS()
+	defer server.Close()
+
+	verification, err := newSecureBootVerification(chains.intermediate.pem())
+	require.NoError(t, err)
+	cs := New(server.URL, testCfg, testCreds, rwTimeout, nil, verification)
+	require.NoError(t, cs.Connect())
+	cs.Close()
+
+	verification, err = newSecureBootVerification(chains.otherIntermediate.pem())
+	require.NoError(t, err)
+	cs = New(server.URL, testCfg, testCreds, rwTimeout, nil, verification)
+	err = cs.Connect()
+	_, ok := err.(*CertificatePinError)
+	assert.True(t, ok, "expected a CertificatePinError, got %v", err)
+	assert.False(t, apierrors.IsRetryable(err))
+}
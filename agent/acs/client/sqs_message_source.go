@@ -0,0 +1,221 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package acsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient/wsconn"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// sqsWaitTimeSeconds is the duration for which a receive call waits for
+	// messages to arrive in the queue
+	sqsWaitTimeSeconds = 20
+	// sqsMaxNumberOfMessages is the maximum number of messages returned by a
+	// receive call
+	sqsMaxNumberOfMessages = 10
+	// sqsRoundtripTimeout is the timeout of the SQS requests. It has to be
+	// longer than the receive wait time
+	sqsRoundtripTimeout = 30 * time.Second
+	// snsNotificationType is the type of the envelope of the messages delivered
+	// by SNS subscriptions without raw message delivery
+	snsNotificationType = "Notification"
+)
+
+// sqsAPI is the subset of the SQS API used to receive messages from ACS
+type sqsAPI interface {
+	ReceiveMessageWithContext(aws.Context, *sqs.ReceiveMessageInput, ...request.Option) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageWithContext(aws.Context, *sqs.DeleteMessageInput, ...request.Option) (*sqs.DeleteMessageOutput, error)
+}
+
+// snsNotification is the envelope of the messages delivered to the queue by an
+// SNS subscription without raw message delivery
+type snsNotification struct {
+	Type    string
+	Message string
+}
+
+// sqsMessageSource implements ClientServer for ACS messages fanned out to an SQS
+// queue. It is used in environments where websocket connections to ACS are
+// blocked. The messages are read from the queue instead of the websocket
+// connection and dispatched to the same request handlers. There is no channel
+// to send requests back to ACS, they are dropped.
+type sqsMessageSource struct {
+	wsclient.ClientServerImpl
+	queueURL string
+	sqs      sqsAPI
+	lock     sync.Mutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// NewSQSMessageSource returns a client/server receiving the messages sent by ACS
+// from the SQS queue with the URL configured in ACSQueueURL. The returned struct
+// should have both 'Connect' and 'Serve' called upon it before being used.
+func NewSQSMessageSource(cfg *config.Config, credentialProvider *credentials.Credentials) wsclient.ClientServer {
+	awsConfig := aws.NewConfig().
+		WithHTTPClient(httpclient.New(sqsRoundtripTimeout, cfg.AcceptInsecureCert)).
+		WithRegion(cfg.AWSRegion).
+		WithCredentials(credentialProvider)
+	return newSQSMessageSource(cfg, sqs.New(session.Must(session.NewSession(awsConfig))))
+}
+
+func newSQSMessageSource(cfg *config.Config, sqsClient sqsAPI) *sqsMessageSource {
+	source := &sqsMessageSource{
+		queueURL: cfg.ACSQueueURL,
+		sqs:      sqsClient,
+	}
+	source.AgentConfig = cfg
+	source.ServiceError = &acsError{}
+	source.RequestHandlers = make(map[string]wsclient.RequestHandler)
+	source.TypeDecoder = NewACSDecoder()
+	return source
+}
+
+// Connect starts a new polling session. Messages are only received once 'Serve'
+// is called
+func (source *sqsMessageSource) Connect() error {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	if source.cancel != nil {
+		source.cancel()
+	}
+	source.ctx, source.cancel = context.WithCancel(context.Background())
+	seelog.Infof("Receiving ACS messages from SQS queue %s", source.queueURL)
+	return nil
+}
+
+// IsConnected returns true if the source is connected and hasn't been
+// disconnected since
+func (source *sqsMessageSource) IsConnected() bool {
+	ctx := source.context()
+	return ctx != nil && ctx.Err() == nil
+}
+
+// SetConnection is a no-op, there is no websocket connection
+func (source *sqsMessageSource) SetConnection(conn wsconn.WebsocketConn) {}
+
+// SetReadDeadline is a no-op, receive calls have their own timeout
+func (source *sqsMessageSource) SetReadDeadline(t time.Time) error {
+	return nil
+}
+
+// Disconnect stops polling the queue
+func (source *sqsMessageSource) Disconnect(...interface{}) error {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	if source.cancel == nil {
+		return errors.New("acs sqs message source: not connected")
+	}
+	source.cancel()
+	return nil
+}
+
+// Close stops polling the queue
+func (source *sqsMessageSource) Close() error {
+	return source.Disconnect()
+}
+
+// MakeRequest validates the request and drops it, there is no channel to send
+// it to ACS. ACS resends the messages that are not acked.
+func (source *sqsMessageSource) MakeRequest(input interface{}) error {
+	send, err := source.CreateRequestMessage(input)
+	if err != nil {
+		return err
+	}
+	return source.WriteMessage(send)
+}
+
+// WriteMessage drops the message, there is no channel to send it to ACS
+func (source *sqsMessageSource) WriteMessage(send []byte) error {
+	seelog.Debugf("Dropping request to ACS received from SQS: %s", string(send))
+	return nil
+}
+
+// Serve receives messages from the queue and dispatches them to the request
+// handlers until the source is disconnected, in which case io.EOF is returned,
+// or a receive call fails. Messages are deleted from the queue once dispatched.
+func (source *sqsMessageSource) Serve() error {
+	ctx := source.context()
+	if ctx == nil {
+		return errors.New("acs sqs message source: not connected")
+	}
+	for {
+		output, err := source.sqs.ReceiveMessageWithContext(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(source.queueURL),
+			MaxNumberOfMessages: aws.Int64(sqsMaxNumberOfMessages),
+			WaitTimeSeconds:     aws.Int64(sqsWaitTimeSeconds),
+		})
+		if ctx.Err() != nil {
+			seelog.Debug("ACS SQS message source disconnected")
+			return io.EOF
+		}
+		if err != nil {
+			seelog.Warnf("Error receiving messages from SQS queue %s: %v", source.queueURL, err)
+			return err
+		}
+		for _, message := range output.Messages {
+			source.handleMessage(ctx, message)
+		}
+	}
+}
+
+// handleMessage dispatches the message to its request handler and deletes it
+// from the queue. Messages that can't be decoded are deleted as well, they
+// would be received over and over again otherwise
+func (source *sqsMessageSource) handleMessage(ctx context.Context, message *sqs.Message) {
+	if err := source.DispatchMessage(sqsMessageBody(message)); err != nil {
+		seelog.Warnf("Unable to handle message %s from SQS queue: %v", aws.StringValue(message.MessageId), err)
+	}
+	_, err := source.sqs.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(source.queueURL),
+		ReceiptHandle: message.ReceiptHandle,
+	})
+	if err != nil {
+		seelog.Warnf("Unable to delete message %s from SQS queue, it will be received again: %v",
+			aws.StringValue(message.MessageId), err)
+	}
+}
+
+func (source *sqsMessageSource) context() context.Context {
+	source.lock.Lock()
+	defer source.lock.Unlock()
+	return source.ctx
+}
+
+// sqsMessageBody returns the ACS message in the body of the SQS message,
+// unwrapping it from its SNS envelope if needed
+func sqsMessageBody(message *sqs.Message) []byte {
+	body := aws.StringValue(message.Body)
+	var notification snsNotification
+	if err := json.Unmarshal([]byte(body), &notification); err == nil && notification.Type == snsNotificationType {
+		return []byte(notification.Message)
+	}
+	return []byte(body)
+}
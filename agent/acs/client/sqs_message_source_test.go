@@ -0,0 +1,231 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package acsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testQueueURL = "https://sqs.us-west-2.amazonaws.com/123456789012/acs"
+
+// fakeSQS returns the queued receive results in order, and then blocks until
+// the context of the receive call is canceled
+type fakeSQS struct {
+	lock      sync.Mutex
+	received  chan receiveResult
+	deleted   []string
+	deleteErr error
+}
+
+type receiveResult struct {
+	messages []*sqs.Message
+	err      error
+}
+
+func newFakeSQS(results ...receiveResult) *fakeSQS {
+	received := make(chan receiveResult, len(results))
+	for _, result := range results {
+		received <- result
+	}
+	return &fakeSQS{received: received}
+}
+
+func (fake *fakeSQS) ReceiveMessageWithContext(ctx aws.Context, input *sqs.ReceiveMessageInput,
+	opts ...request.Option) (*sqs.ReceiveMessageOutput, error) {
+	select {
+	case result := <-fake.received:
+		return &sqs.ReceiveMessageOutput{Messages: result.messages}, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (fake *fakeSQS) DeleteMessageWithContext(ctx aws.Context, input *sqs.DeleteMessageInput,
+	opts ...request.Option) (*sqs.DeleteMessageOutput, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fake.deleted = append(fake.deleted, aws.StringValue(input.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, fake.deleteErr
+}
+
+func (fake *fakeSQS) deletedReceiptHandles() []string {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	return append([]string{}, fake.deleted...)
+}
+
+func sqsMessage(receiptHandle string, body string) *sqs.Message {
+	return &sqs.Message{
+		MessageId:     aws.String(receiptHandle),
+		ReceiptHandle: aws.String(receiptHandle),
+		Body:          aws.String(body),
+	}
+}
+
+func snsEnvelope(t *testing.T, message string) string {
+	envelope, err := json.Marshal(map[string]string{
+		"Type":     "Notification",
+		"TopicArn": "arn:aws:sns:us-west-2:123456789012:acs",
+		"Message":  message,
+	})
+	require.NoError(t, err)
+	return string(envelope)
+}
+
+func testSQSConfig() *config.Config {
+	return &config.Config{AWSRegion: "us-west-2", ACSQueueURL: testQueueURL}
+}
+
+// serveInBackground starts serving messages and returns a channel receiving
+// the result of Serve
+func serveInBackground(source *sqsMessageSource) <-chan error {
+	served := make(chan error, 1)
+	go func() {
+		served <- source.Serve()
+	}()
+	return served
+}
+
+func TestSQSMessageSourceDispatchesAndDeletesMessages(t *testing.T) {
+	fake := newFakeSQS(receiveResult{
+		messages: []*sqs.Message{
+			sqsMessage("credentials", sampleCredentialsMessage),
+			sqsMessage("heartbeat", snsEnvelope(t, `{"type":"HeartbeatMessage","message":{"messageId":"hb"}}`)),
+		},
+	})
+	source := newSQSMessageSource(testSQSConfig(), fake)
+
+	credentialsMessages := make(chan *ecsacs.IAMRoleCredentialsMessage, 1)
+	source.AddRequestHandler(func(message *ecsacs.IAMRoleCredentialsMessage) {
+		credentialsMessages <- message
+	})
+	heartbeatMessages := make(chan *ecsacs.HeartbeatMessage, 1)
+	source.AddRequestHandler(func(message *ecsacs.HeartbeatMessage) {
+		heartbeatMessages <- message
+	})
+
+	require.NoError(t, source.Connect())
+	assert.True(t, source.IsConnected())
+	served := serveInBackground(source)
+
+	select {
+	case message := <-credentialsMessages:
+		assert.Equal(t, "123", aws.StringValue(message.MessageId))
+		assert.Equal(t, "t1", aws.StringValue(message.TaskArn))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the credentials message to be dispatched")
+	}
+	select {
+	case message := <-heartbeatMessages:
+		assert.Equal(t, "hb", aws.StringValue(message.MessageId))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the heartbeat message to be dispatched")
+	}
+
+	require.NoError(t, source.Close())
+	select {
+	case err := <-served:
+		assert.Equal(t, io.EOF, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for Serve to return")
+	}
+	assert.False(t, source.IsConnected())
+	assert.Equal(t, []string{"credentials", "heartbeat"}, fake.deletedReceiptHandles())
+}
+
+func TestSQSMessageSourceDeletesUndecodableMessages(t *testing.T) {
+	fake := newFakeSQS(
+		receiveResult{messages: []*sqs.Message{sqsMessage("garbage", "not json")}},
+		receiveResult{err: errors.New("stop")},
+	)
+	source := newSQSMessageSource(testSQSConfig(), fake)
+
+	require.NoError(t, source.Connect())
+	assert.Error(t, source.Serve())
+	assert.Equal(t, []string{"garbage"}, fake.deletedReceiptHandles())
+}
+
+func TestSQSMessageSourceContinuesWhenDeleteFails(t *testing.T) {
+	fake := newFakeSQS(
+		receiveResult{messages: []*sqs.Message{sqsMessage("first", sampleCredentialsMessage)}},
+		receiveResult{messages: []*sqs.Message{sqsMessage("second", sampleCredentialsMessage)}},
+		receiveResult{err: errors.New("stop")},
+	)
+	fake.deleteErr = errors.New("delete failed")
+	source := newSQSMessageSource(testSQSConfig(), fake)
+
+	dispatched := 0
+	source.AddRequestHandler(func(message *ecsacs.IAMRoleCredentialsMessage) {
+		dispatched++
+	})
+
+	require.NoError(t, source.Connect())
+	assert.Error(t, source.Serve())
+	assert.Equal(t, 2, dispatched)
+	assert.Equal(t, []string{"first", "second"}, fake.deletedReceiptHandles())
+}
+
+func TestSQSMessageSourceReturnsReceiveErrors(t *testing.T) {
+	receiveErr := errors.New("access denied")
+	source := newSQSMessageSource(testSQSConfig(), newFakeSQS(receiveResult{err: receiveErr}))
+
+	require.NoError(t, source.Connect())
+	assert.Equal(t, receiveErr, source.Serve())
+}
+
+func TestSQSMessageSourceServeWithoutConnect(t *testing.T) {
+	source := newSQSMessageSource(testSQSConfig(), newFakeSQS())
+
+	assert.False(t, source.IsConnected())
+	assert.Error(t, source.Serve())
+	assert.Error(t, source.Disconnect())
+}
+
+func TestSQSMessageSourceDropsRequests(t *testing.T) {
+	source := newSQSMessageSource(testSQSConfig(), newFakeSQS())
+
+	assert.NoError(t, source.MakeRequest(&ecsacs.AckRequest{MessageId: aws.String("123")}))
+	assert.Error(t, source.MakeRequest(&struct{}{}), "Unrecognized requests should be rejected")
+}
+
+func TestSQSMessageSourceReconnect(t *testing.T) {
+	source := newSQSMessageSource(testSQSConfig(), newFakeSQS())
+
+	require.NoError(t, source.Connect())
+	require.NoError(t, source.Disconnect())
+	assert.False(t, source.IsConnected())
+
+	require.NoError(t, source.Connect())
+	assert.True(t, source.IsConnected())
+	ctx := source.context()
+	require.NoError(t, source.Close())
+	assert.Equal(t, context.Canceled, ctx.Err())
+}
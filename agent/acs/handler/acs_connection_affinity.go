@@ -0,0 +1,220 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+)
+
+const (
+	acsAvailabilityZoneMismatchEvent = "ACSAvailabilityZoneMismatch"
+	// availabilityZoneDialTimeout is the timeout of the resolution of the ACS
+	// endpoint, and of the connections to each of its IPs when they aren't
+	// opened from the network namespace of the session
+	availabilityZoneDialTimeout = 30 * time.Second
+)
+
+// ACSConnectionAffinityByAvailabilityZone makes the session prefer the ACS
+// hosts in the availability zone of the instance, when configured with
+// ACSAvailabilityZoneAffinity. The endpoint returned by DiscoverPollEndpoint
+// resolves to hosts in several availability zones, and ACS only tells the zone
+// of a host in the X-ACS-AZ header of its response to the connection. The zone
+// of every IP connected to is therefore remembered: the IPs of the endpoint are
+// dialed in the zone of the instance first, then the ones whose zone is unknown
+// yet, and the session reconnects while an IP of unknown zone remains to be
+// tried. IPs that can't be dialed are tried last, like the IPs in other zones.
+// Once all the IPs were tried and none of them is in the zone of the instance,
+// the session stays connected to any host
+type ACSConnectionAffinityByAvailabilityZone struct {
+	lock sync.Mutex
+	// instanceAZ is the availability zone of the instance, empty if it couldn't
+	// be retrieved from the instance metadata service
+	instanceAZ string
+	// endpointAZs maps the IPs tried, to the availability zone of their host.
+	// The zone of the IPs that couldn't be dialed is empty
+	endpointAZs map[string]string
+	// candidates are the IPs of the endpoint dialable with the networks of the
+	// current connection
+	candidates map[string]struct{}
+}
+
+// newACSConnectionAffinityByAvailabilityZone returns a new
+// ACSConnectionAffinityByAvailabilityZone object, or nil if the affinity isn't
+// enabled
+func newACSConnectionAffinityByAvailabilityZone(enabled bool) *ACSConnectionAffinityByAvailabilityZone {
+	if !enabled {
+		return nil
+	}
+	return &ACSConnectionAffinityByAvailabilityZone{
+		endpointAZs: make(map[string]string),
+	}
+}
+
+// use makes the client dial the IPs of the endpoint in the availability zone of
+// the instance first, each of them with dial, or a plain dialer if dial is nil.
+// The client connects to any IP if the zone of the instance isn't known
+func (affinity *ACSConnectionAffinityByAvailabilityZone) use(client wsclient.ClientServer,
+	attributes *instanceAttributes, dial func(network, address string) (net.Conn, error), log logger.Logger) {
+	if affinity == nil {
+		return
+	}
+	instanceAZ := ""
+	if attributes != nil {
+		instanceAZ = attributes.AvailabilityZone
+	}
+	affinity.lock.Lock()
+	affinity.instanceAZ = instanceAZ
+	affinity.candidates = make(map[string]struct{})
+	affinity.lock.Unlock()
+	if instanceAZ == "" {
+		log.Warnf("The availability zone of the instance is unknown, connecting to any ACS host")
+		return
+	}
+
+	dialUser, ok := client.(netDialUser)
+	if !ok {
+		log.Warnf("The ACS client doesn't support custom dialers, connecting to any ACS host")
+		return
+	}
+	if dial == nil {
+		dialer := &net.Dialer{Timeout: availabilityZoneDialTimeout}
+		dial = dialer.Dial
+	}
+	dialUser.UseNetDial(func(network, address string) (net.Conn, error) {
+		return affinity.dial(network, address, dial)
+	})
+}
+
+// dial resolves the address and dials its IPs in order of preference, until a
+// connection is established
+func (affinity *ACSConnectionAffinityByAvailabilityZone) dial(network, address string,
+	dial func(network, address string) (net.Conn, error)) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), availabilityZoneDialTimeout)
+	defer cancel()
+	addresses, err := lookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialErr := fmt.Errorf("no %s address found for %s", network, host)
+	for _, ip := range affinity.order(network, addresses) {
+		var conn net.Conn
+		conn, dialErr = dial(network, net.JoinHostPort(ip, port))
+		if dialErr == nil {
+			return conn, nil
+		}
+		affinity.dialFailed(ip)
+	}
+	return nil, dialErr
+}
+
+// order records the IPs the endpoint resolved to, and returns the ones of the
+// network family: the IPs in the availability zone of the instance first, then
+// the IPs whose zone is unknown, then the IPs in other zones
+func (affinity *ACSConnectionAffinityByAvailabilityZone) order(network string, addresses []string) []string {
+	affinity.lock.Lock()
+	defer affinity.lock.Unlock()
+
+	// Forget the IPs the endpoint doesn't resolve to anymore
+	resolved := make(map[string]struct{}, len(addresses))
+	for _, ip := range addresses {
+		resolved[ip] = struct{}{}
+	}
+	for ip := range affinity.endpointAZs {
+		if _, ok := resolved[ip]; !ok {
+			delete(affinity.endpointAZs, ip)
+		}
+	}
+
+	var sameAZ, unknownAZ, otherAZ []string
+	for _, ip := range addresses {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || (network == "tcp4" && parsed.To4() == nil) || (network == "tcp6" && parsed.To4() != nil) {
+			continue
+		}
+		affinity.candidates[ip] = struct{}{}
+		az, known := affinity.endpointAZs[ip]
+		switch {
+		case !known:
+			unknownAZ = append(unknownAZ, ip)
+		case az == affinity.instanceAZ:
+			sameAZ = append(sameAZ, ip)
+		default:
+			otherAZ = append(otherAZ, ip)
+		}
+	}
+	return append(append(sameAZ, unknownAZ...), otherAZ...)
+}
+
+// dialFailed records that the IP couldn't be dialed, so that it's tried last
+// until the session connects to it
+func (affinity *ACSConnectionAffinityByAvailabilityZone) dialFailed(ip string) {
+	affinity.lock.Lock()
+	defer affinity.lock.Unlock()
+	if _, known := affinity.endpointAZs[ip]; !known {
+		affinity.endpointAZs[ip] = ""
+	}
+}
+
+// connected records the availability zone of the host the client connected to.
+// It returns true if the host isn't in the zone of the instance, and another IP
+// of the endpoint may be, in which case the session should reconnect
+func (affinity *ACSConnectionAffinityByAvailabilityZone) connected(client wsclient.ClientServer, log logger.Logger) bool {
+	if affinity == nil {
+		return false
+	}
+	provider, ok := client.(sessionStatsProvider)
+	if !ok {
+		return false
+	}
+	stats := provider.SessionStats()
+
+	affinity.lock.Lock()
+	defer affinity.lock.Unlock()
+	if affinity.instanceAZ == "" || stats.AvailabilityZone == "" {
+		return false
+	}
+	if stats.RemoteIP != "" {
+		affinity.endpointAZs[stats.RemoteIP] = stats.AvailabilityZone
+	}
+	if stats.AvailabilityZone == affinity.instanceAZ {
+		log.Infof("Connected to ACS host %s in the availability zone of the instance: %s",
+			stats.RemoteIP, stats.AvailabilityZone)
+		return false
+	}
+
+	metrics.MetricsEngineGlobal.RecordACSEvent(acsAvailabilityZoneMismatchEvent, 1)
+	for ip := range affinity.candidates {
+		if _, known := affinity.endpointAZs[ip]; !known {
+			log.Infof("Connected to ACS host %s in availability zone %s instead of %s, reconnecting to try host %s",
+				stats.RemoteIP, stats.AvailabilityZone, affinity.instanceAZ, ip)
+			return true
+		}
+	}
+	log.Infof("No ACS host found in availability zone %s, staying connected to host %s in availability zone %s",
+		affinity.instanceAZ, stats.RemoteIP, stats.AvailabilityZone)
+	return false
+}
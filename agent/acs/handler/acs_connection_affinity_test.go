@@ -0,0 +1,190 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testInstanceAZ = "us-west-2a"
+	testACSHost    = "ecs-a-1.us-west-2.amazonaws.com"
+)
+
+// setLookupHostIPs overrides the resolution of the host names to all the given IPs
+func setLookupHostIPs(ips ...string) func() {
+	original := lookupHost
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return ips, nil
+	}
+	return func() {
+		lookupHost = original
+	}
+}
+
+// recordingDial records the addresses dialed, and fails to dial the ones
+// that aren't reachable
+type recordingDial struct {
+	dialed      []string
+	unreachable map[string]bool
+}
+
+func (d *recordingDial) dial(network, address string) (net.Conn, error) {
+	d.dialed = append(d.dialed, address)
+	if d.unreachable[address] {
+		return nil, errors.New("connection refused")
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+// connectAffinity dials the ACS endpoint with the dialer of the affinity, as the
+// client would, and records the availability zone of the host connected to
+func connectAffinity(t *testing.T, affinity *ACSConnectionAffinityByAvailabilityZone, d *recordingDial,
+	hostAZs map[string]string, mockClient *mock_wsclient.MockClientServer) bool {
+	client := &wsclient.ClientServerImpl{}
+	affinity.use(client, &instanceAttributes{AvailabilityZone: testInstanceAZ}, d.dial, logger.NewNilSafeLogger(nil))
+	require.NotNil(t, client.NetDial)
+	conn, err := client.NetDial("tcp4", net.JoinHostPort(testACSHost, "443"))
+	require.NoError(t, err)
+	conn.Close()
+	remoteIP, _, _ := net.SplitHostPort(d.dialed[len(d.dialed)-1])
+	return affinity.connected(&sessionStatsClientServer{
+		MockClientServer: mockClient,
+		stats:            wsclient.SessionStats{RemoteIP: remoteIP, AvailabilityZone: hostAZs[remoteIP]},
+	}, logger.NewNilSafeLogger(nil))
+}
+
+func TestACSConnectionAffinityDisabled(t *testing.T) {
+	affinity := newACSConnectionAffinityByAvailabilityZone(false)
+	assert.Nil(t, affinity)
+	client := &wsclient.ClientServerImpl{}
+	affinity.use(client, &instanceAttributes{AvailabilityZone: testInstanceAZ}, nil, logger.NewNilSafeLogger(nil))
+	assert.Nil(t, client.NetDial)
+	assert.False(t, affinity.connected(client, logger.NewNilSafeLogger(nil)))
+}
+
+// TestACSConnectionAffinityPrefersSameAvailabilityZone tests if the session
+// probes the IPs of the endpoint until it finds the host in the availability
+// zone of the instance, and connects to it first afterwards
+func TestACSConnectionAffinityPrefersSameAvailabilityZone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	defer setLookupHostIPs("10.0.0.1", "10.0.0.2", "10.0.0.3")()
+	hostAZs := map[string]string{"10.0.0.1": "us-west-2b", "10.0.0.2": testInstanceAZ, "10.0.0.3": "us-west-2c"}
+	affinity := newACSConnectionAffinityByAvailabilityZone(true)
+	d := &recordingDial{}
+	mockClient := mock_wsclient.NewMockClientServer(ctrl)
+
+	assert.True(t, connectAffinity(t, affinity, d, hostAZs, mockClient),
+		"the session should reconnect to try the other hosts")
+	assert.False(t, connectAffinity(t, affinity, d, hostAZs, mockClient))
+	assert.Equal(t, []string{"10.0.0.1:443", "10.0.0.2:443"}, d.dialed)
+
+	d.dialed = nil
+	assert.False(t, connectAffinity(t, affinity, d, hostAZs, mockClient))
+	assert.Equal(t, []string{"10.0.0.2:443"}, d.dialed, "the host in the availability zone should be dialed first")
+
+	// The session falls back to the other hosts while the host in the
+	// availability zone is unreachable, once they were all tried
+	d = &recordingDial{unreachable: map[string]bool{"10.0.0.2:443": true}}
+	assert.False(t, connectAffinity(t, affinity, d, hostAZs, mockClient))
+	assert.Equal(t, []string{"10.0.0.2:443", "10.0.0.3:443"}, d.dialed)
+}
+
+func TestACSConnectionAffinityTriesUnreachableIPsLast(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	defer setLookupHostIPs("10.0.0.1", "10.0.0.2", "10.0.0.3")()
+	hostAZs := map[string]string{"10.0.0.1": "us-west-2b", "10.0.0.2": "us-west-2c", "10.0.0.3": testInstanceAZ}
+	affinity := newACSConnectionAffinityByAvailabilityZone(true)
+	d := &recordingDial{unreachable: map[string]bool{"10.0.0.1:443": true}}
+	mockClient := mock_wsclient.NewMockClientServer(ctrl)
+
+	assert.True(t, connectAffinity(t, affinity, d, hostAZs, mockClient))
+	assert.False(t, connectAffinity(t, affinity, d, hostAZs, mockClient))
+	assert.Equal(t, []string{"10.0.0.1:443", "10.0.0.2:443", "10.0.0.3:443"}, d.dialed)
+}
+
+// TestACSConnectionAffinityFallsBackToAnyAvailabilityZone tests if the session
+// stays connected to a host in another availability zone once it tried all the
+// IPs of the endpoint without finding one in the zone of the instance
+func TestACSConnectionAffinityFallsBackToAnyAvailabilityZone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	defer setLookupHostIPs("10.0.0.1", "10.0.0.2", "fd00::1")()
+	hostAZs := map[string]string{"10.0.0.1": "us-west-2b", "10.0.0.2": "us-west-2c"}
+	affinity := newACSConnectionAffinityByAvailabilityZone(true)
+	d := &recordingDial{}
+	mockClient := mock_wsclient.NewMockClientServer(ctrl)
+
+	assert.True(t, connectAffinity(t, affinity, d, hostAZs, mockClient))
+	assert.False(t, connectAffinity(t, affinity, d, hostAZs, mockClient),
+		"the IPv6 IP isn't dialed over IPv4, the session should stay connected")
+	assert.Equal(t, []string{"10.0.0.1:443", "10.0.0.2:443"}, d.dialed)
+	assert.False(t, connectAffinity(t, affinity, d, hostAZs, mockClient))
+}
+
+// TestACSConnectionAffinityWithoutInstanceAvailabilityZone tests if the session
+// connects to any host when the availability zone of the instance couldn't be
+// retrieved from the instance metadata service
+func TestACSConnectionAffinityWithoutInstanceAvailabilityZone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	affinity := newACSConnectionAffinityByAvailabilityZone(true)
+	mockClient := mock_wsclient.NewMockClientServer(ctrl)
+
+	for _, attributes := range []*instanceAttributes{nil, {InstanceType: "c5.xlarge"}} {
+		client := &wsclient.ClientServerImpl{}
+		affinity.use(client, attributes, nil, logger.NewNilSafeLogger(nil))
+		assert.Nil(t, client.NetDial, "the client should dial the endpoint as usual")
+		assert.False(t, affinity.connected(&sessionStatsClientServer{
+			MockClientServer: mockClient,
+			stats:            wsclient.SessionStats{RemoteIP: "10.0.0.1", AvailabilityZone: "us-west-2b"},
+		}, logger.NewNilSafeLogger(nil)))
+	}
+}
+
+func TestACSConnectionAffinityWithoutHostAvailabilityZone(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	defer setLookupHostIPs("10.0.0.1", "10.0.0.2")()
+	affinity := newACSConnectionAffinityByAvailabilityZone(true)
+	d := &recordingDial{}
+
+	assert.False(t, connectAffinity(t, affinity, d, map[string]string{}, mock_wsclient.NewMockClientServer(ctrl)),
+		"the session should stay connected to hosts that don't tell their availability zone")
+	assert.False(t, affinity.connected(mock_wsclient.NewMockClientServer(ctrl), logger.NewNilSafeLogger(nil)))
+}
+
+// TestReconnectWithBackoffOnAvailabilityZoneMismatch tests that reconnecting to
+// try another host doesn't reset the backoff, as the endpoint may have no host
+// in the availability zone of the instance
+func TestReconnectWithBackoffOnAvailabilityZoneMismatch(t *testing.T) {
+	assert.False(t, shouldReconnectWithoutBackoff(errAvailabilityZoneMismatch))
+}
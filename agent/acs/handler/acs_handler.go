@@ -17,8 +17,10 @@ package handler
 
 import (
 	"context"
+	"crypto/tls"
 	"io"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -26,21 +28,27 @@ import (
 	acsclient "github.com/aws/amazon-ecs-agent/agent/acs/client"
 	updater "github.com/aws/amazon-ecs-agent/agent/acs/update_handler"
 	"github.com/aws/amazon-ecs-agent/agent/api"
+	apierrors "github.com/aws/amazon-ecs-agent/agent/api/errors"
+	asmfactory "github.com/aws/amazon-ecs-agent/agent/asm/factory"
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/containermetadata"
 	rolecredentials "github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/data"
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
 	"github.com/aws/amazon-ecs-agent/agent/doctor"
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
 	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
 	"github.com/aws/amazon-ecs-agent/agent/utils/retry"
 	"github.com/aws/amazon-ecs-agent/agent/utils/ttime"
 	"github.com/aws/amazon-ecs-agent/agent/version"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/cihub/seelog"
+	"github.com/pborman/uuid"
+	"golang.org/x/time/rate"
 )
 
 const (
@@ -65,6 +73,9 @@ const (
 	// in the ACS URL that is used to indicate if ACS should send
 	// credentials for all tasks on establishing the connection
 	sendCredentialsURLParameterName = "sendCredentials"
+	// sessionIDURLParameterName is the name of the URL parameter in the ACS
+	// URL that identifies all the connections of the same session
+	sessionIDURLParameterName       = "sessionId"
 	inactiveInstanceExceptionPrefix = "InactiveInstanceException:"
 	// ACS protocol version spec:
 	// 1: default protocol version
@@ -77,14 +88,26 @@ type Session interface {
 	Start() error
 }
 
+// SessionRecoveryHook is notified when the session with ACS fails, so that the
+// agent supervisor can take action, such as restarting the agent
+type SessionRecoveryHook interface {
+	// OnSessionFailed is invoked every time the session ends with an error.
+	// consecutiveFailures is the number of sessions that failed since the
+	// agent was last connected to ACS
+	OnSessionFailed(reason string, consecutiveFailures int)
+	// OnSessionConnected is invoked every time the session connects to ACS
+	OnSessionConnected()
+}
+
 // session encapsulates all arguments needed by the handler to connect to ACS
 // and to handle messages received by ACS. The Session.Start() method can be used
 // to start processing messages from ACS.
 type session struct {
 	containerInstanceARN            string
+	sessionPersistentID             string
 	credentialsProvider             *credentials.Credentials
 	agentConfig                     *config.Config
-	deregisterInstanceEventStream   *eventstream.EventStream
+	deregisterInstanceEventStream   *eventstream.DeregisterInstanceEventStream
 	taskEngine                      engine.TaskEngine
 	dockerClient                    dockerapi.DockerClient
 	ecsClient                       api.ECSClient
@@ -98,9 +121,55 @@ type session struct {
 	resources                       sessionResources
 	latestSeqNumTaskManifest        *int64
 	doctor                          *doctor.Doctor
+	instanceResources               *instanceResources
+	instanceAttributesFetcher       *instanceAttributesFetcher
+	taskGroupThrottle               *taskGroupThrottle
+	drainState                      *taskDrainState
+	statePublisher                  *periodicStatePublisher
+	eventRelay                      *TaskEngineEventRelay
+	dockerHealth                    *dockerHealthProbe
+	tagsSynchronizer                *taskTagsSynchronizer
+	ebsWaiter                       *ebsVolumeAttachWaiter
+	hostMetrics                     *hostMetricsSampler
+	reconnectDetector               *circularReconnectDetector
+	attributeUpdateLimiter          *rate.Limiter
+	alertSink                       AlertSink
+	alertLimiter                    *operatorAlertLimiter
+	wasmRuntimeDetector             WasmRuntimeDetector
+	featureFlag                     FeatureFlag
+	requestID                       string
+	endpointRotation                *endpointRotation
+	taskMetadataCache               *containermetadata.TaskMetadataCache
+	recoveryHook                    SessionRecoveryHook
+	inFlightAcks                    *InFlightAckRegistry
+	tokenRefresher                  *sessionTokenRefresher
+	protocolMismatchRecovery        *ProtocolMismatchRecovery
+	namespaceIsolator               *ContainerNamespaceIsolator
+	azAffinity                      *ACSConnectionAffinityByAvailabilityZone
+	envInjector                     *TaskEnvironmentInjector
+	reconnectCap                    *ReconnectExponentialCap
+	boundaryChecker                 *PermissionsBoundaryChecker
+	telemetryUploader               SessionTelemetryUploader
+	crashReporter                   *AgentCrashReporter
+	messageTracer                   *ACSMessageTraceExporter
+	authChallenger                  AuthChallenger
+	splitTest                       *splitTestComparator
+	filesystemPreparator            *TaskFilesystemPreparator
+	secretsPrewarmer                *SecretsPrewarmer
+	dnsFlusher                      DNSCacheFlusher
+	deregistrationGrace             *deregistrationGracePeriod
+	storageVerifier                 *StorageAttachmentVerifier
+	pauseResume                     *ACSSessionPauseResume
+	manifestVerifier                *ManifestSignatureVerifier
+	imagePrePuller                  *ImagePrePuller
+	failover                        *ACSMultiRegionFailover
+	handlerGoroutines               *HandlerGoroutineLimiter
+	consecutiveFailures             int
+	connectionCount                 int
 	_heartbeatTimeout               time.Duration
 	_heartbeatJitter                time.Duration
 	_inactiveInstanceReconnectDelay time.Duration
+	_logger                         logger.Logger
 }
 
 // sessionResources defines the resource creator interface for starting
@@ -126,6 +195,12 @@ type acsSessionResources struct {
 	// It is set to 'true' for the very first successful connection on
 	// agent start. It is set to false for all successive connections
 	sendCredentials bool
+	// tlsSessionCache caches the TLS sessions of the connections to ACS across
+	// reconnects, nil if TLS sessions are not resumed
+	tlsSessionCache tls.ClientSessionCache
+	// certVerification verifies the certificate chain of ACS against the pinned
+	// intermediate CAs, nil if the certificates of ACS are not pinned
+	certVerification *acsclient.SecureBootVerification
 }
 
 // sessionState defines state recorder interface for the
@@ -140,49 +215,141 @@ type sessionState interface {
 	getSendCredentialsURLParameter() string
 }
 
+// SessionParams holds the dependencies of a session with ACS. Optional
+// dependencies can be left nil
+type SessionParams struct {
+	Config                        *config.Config
+	DeregisterInstanceEventStream *eventstream.DeregisterInstanceEventStream
+	ContainerInstanceARN          string
+	CredentialsProvider           *credentials.Credentials
+	DockerClient                  dockerapi.DockerClient
+	ECSClient                     api.ECSClient
+	TaskEngineState               dockerstate.TaskEngineState
+	DataClient                    data.Client
+	TaskEngine                    engine.TaskEngine
+	CredentialsManager            rolecredentials.Manager
+	TaskHandler                   *eventhandler.TaskHandler
+	LatestSeqNumTaskManifest      *int64
+	Doctor                        *doctor.Doctor
+	EC2MetadataClient             ec2.EC2MetadataClient
+	TaskMetadataCache             *containermetadata.TaskMetadataCache
+	RecoveryHook                  SessionRecoveryHook
+	InFlightAcks                  *InFlightAckRegistry
+	OnConnectStorm                OnConnectStormCallback
+	FeatureFlag                   FeatureFlag
+	TelemetryUploader             SessionTelemetryUploader
+	CrashReporter                 *AgentCrashReporter
+	CertVerification              *acsclient.SecureBootVerification
+	PrewarmedSecrets              *asmfactory.PrewarmedSecrets
+	PauseResume                   *ACSSessionPauseResume
+	BackupCredentials             ACSBackupCredentialsProvider
+	PrePulledImages               *dockerapi.PrePulledImages
+	// Logger is the logger of the session, the global seelog logger when nil
+	Logger logger.Logger
+}
+
 // NewSession creates a new Session object
-func NewSession(
-	ctx context.Context,
-	config *config.Config,
-	deregisterInstanceEventStream *eventstream.EventStream,
-	containerInstanceARN string,
-	credentialsProvider *credentials.Credentials,
-	dockerClient dockerapi.DockerClient,
-	ecsClient api.ECSClient,
-	taskEngineState dockerstate.TaskEngineState,
-	dataClient data.Client,
-	taskEngine engine.TaskEngine,
-	credentialsManager rolecredentials.Manager,
-	taskHandler *eventhandler.TaskHandler,
-	latestSeqNumTaskManifest *int64,
-	doctor *doctor.Doctor,
-) Session {
-	resources := newSessionResources(credentialsProvider)
-	backoff := retry.NewExponentialBackoff(connectionBackoffMin, connectionBackoffMax,
-		connectionBackoffJitter, connectionBackoffMultiplier)
+func NewSession(ctx context.Context, params SessionParams) Session {
+	cfg := params.Config
+	resources := newSessionResources(params.CredentialsProvider, cfg.ACSSessionCacheSize, params.CertVerification)
+	backoff := newACSReconnectStagger(newARNHashJitter(retry.NewExponentialBackoff(connectionBackoffMin, connectionBackoffMax,
+		connectionBackoffJitter, connectionBackoffMultiplier), params.ContainerInstanceARN),
+		cfg.ACSReconnectStaggerSlot, cfg.ACSReconnectStaggerInterval)
 	derivedContext, cancel := context.WithCancel(ctx)
+	sessionLogger := params.Logger
+	if sessionLogger == nil {
+		sessionLogger = logger.NewNilSafeLogger(nil)
+	}
+	var hostMetrics *hostMetricsSampler
+	if cfg.ACSHeartbeatHostMetrics &&
+		(params.FeatureFlag == nil || params.FeatureFlag.IsEnabled(HeartbeatHostMetricsFeatureFlag, params.ContainerInstanceARN)) {
+		hostMetrics = newHostMetricsSampler()
+	}
+	var wasmRuntimeDetector WasmRuntimeDetector
+	if cfg.ACSAdvertiseWasm {
+		wasmRuntimeDetector = newPathWasmRuntimeDetector()
+	}
+	var eventRelay *TaskEngineEventRelay
+	if cfg.ACSRelayTaskEngineEvents {
+		eventRelay = newTaskEngineEventRelay(cfg.Cluster, params.ContainerInstanceARN, cfg.ACSEventRelayMaxRate)
+	}
+	dockerHealth := newDockerHealthProbe(params.DockerClient, cfg.DockerHealthCheckInterval, cfg.DockerHealthFailureThreshold,
+		newMemoryPressureMonitor(cfg.ACSMemoryPressureMonitorEnabled.Enabled(), cfg.ACSMemoryPressureThreshold))
+	filesystemPreparator := newTaskFilesystemPreparator(cfg.ACSTaskTmpfsDir, newMountSyscalls())
+	secretsPrewarmer := newSecretsPrewarmer(params.PrewarmedSecrets, asmfactory.NewClientCreator(), params.CredentialsManager,
+		params.TaskEngine)
+	imagePrePuller := newImagePrePuller(derivedContext, params.PrePulledImages, params.DockerClient, params.TaskEngine,
+		cfg.ACSPrePullConcurrency, cfg.ImagePullTimeout)
+	drainState := loadTaskDrainState(params.DataClient)
+	attributesFetcher := newInstanceAttributesFetcher(params.EC2MetadataClient)
+	envInjector := newTaskEnvironmentInjector(cfg.ACSInjectInstanceEnvVars, cfg.Cluster, params.EC2MetadataClient,
+		attributesFetcher, cfg.ACSInstanceEnvVarDenyList)
+	deregistrationGrace := newDeregistrationGracePeriod(cfg.ACSDeregistrationGracePeriod, params.TaskEngine, drainState)
 
 	return &session{
-		agentConfig:                     config,
-		deregisterInstanceEventStream:   deregisterInstanceEventStream,
-		containerInstanceARN:            containerInstanceARN,
-		credentialsProvider:             credentialsProvider,
-		ecsClient:                       ecsClient,
-		dockerClient:                    dockerClient,
-		state:                           taskEngineState,
-		dataClient:                      dataClient,
-		taskEngine:                      taskEngine,
-		credentialsManager:              credentialsManager,
-		taskHandler:                     taskHandler,
+		agentConfig:                     cfg,
+		deregisterInstanceEventStream:   params.DeregisterInstanceEventStream,
+		containerInstanceARN:            params.ContainerInstanceARN,
+		sessionPersistentID:             uuid.New(),
+		credentialsProvider:             params.CredentialsProvider,
+		ecsClient:                       params.ECSClient,
+		dockerClient:                    params.DockerClient,
+		state:                           params.TaskEngineState,
+		dataClient:                      params.DataClient,
+		taskEngine:                      params.TaskEngine,
+		credentialsManager:              params.CredentialsManager,
+		taskHandler:                     params.TaskHandler,
 		ctx:                             derivedContext,
 		cancel:                          cancel,
 		backoff:                         backoff,
 		resources:                       resources,
-		latestSeqNumTaskManifest:        latestSeqNumTaskManifest,
-		doctor:                          doctor,
+		latestSeqNumTaskManifest:        params.LatestSeqNumTaskManifest,
+		doctor:                          params.Doctor,
+		instanceResources:               fetchInstanceResources(params.EC2MetadataClient, cfg.ReservedMemory),
+		instanceAttributesFetcher:       attributesFetcher,
+		envInjector:                     envInjector,
+		reconnectCap:                    newReconnectExponentialCap(cfg.ACSMaxReconnectInterval),
+		taskGroupThrottle:               newTaskGroupThrottle(derivedContext, params.TaskEngine, cfg.ACSTaskGroupMaxConcurrentStarts),
+		drainState:                      drainState,
+		statePublisher:                  newPeriodicStatePublisher(cfg.Cluster, params.ContainerInstanceARN, params.TaskEngineState, cfg.ACSStateSyncInterval),
+		eventRelay:                      eventRelay,
+		endpointRotation:                newEndpointRotation(cfg.ACSEndpointRotationThreshold),
+		dockerHealth:                    dockerHealth,
+		tagsSynchronizer:                newTaskTagsSynchronizer(cfg.ACSPropagateTaskTags, params.ECSClient, cfg.ACSTagCacheTTL),
+		ebsWaiter:                       newEBSVolumeAttachWaiter(derivedContext, params.DataClient, cfg.EBSVolumeAttachTimeout),
+		hostMetrics:                     hostMetrics,
+		reconnectDetector:               newCircularReconnectDetector(cfg.ACSMaxConnectsPerMinute, params.OnConnectStorm),
+		attributeUpdateLimiter:          newAttributeUpdateLimiter(),
+		alertSink:                       newOperatorAlertSink(cfg, params.CredentialsProvider),
+		alertLimiter:                    newOperatorAlertLimiter(),
+		wasmRuntimeDetector:             wasmRuntimeDetector,
+		featureFlag:                     params.FeatureFlag,
+		taskMetadataCache:               params.TaskMetadataCache,
+		recoveryHook:                    params.RecoveryHook,
+		inFlightAcks:                    params.InFlightAcks,
+		tokenRefresher:                  newSessionTokenRefresher(params.CredentialsProvider),
+		protocolMismatchRecovery:        newProtocolMismatchRecovery(params.DataClient),
+		namespaceIsolator:               newContainerNamespaceIsolator(cfg.ACSHandlerNetworkNamespace, newNamespaceSyscalls()),
+		azAffinity:                      newACSConnectionAffinityByAvailabilityZone(cfg.ACSAvailabilityZoneAffinity),
+		boundaryChecker:                 newPermissionsBoundaryChecker(cfg, params.CredentialsProvider, params.EC2MetadataClient),
+		telemetryUploader:               params.TelemetryUploader,
+		crashReporter:                   params.CrashReporter,
+		authChallenger:                  NewIMDSAuthChallenger(params.EC2MetadataClient),
+		splitTest:                       newSplitTestComparator(cfg),
+		filesystemPreparator:            filesystemPreparator,
+		secretsPrewarmer:                secretsPrewarmer,
+		dnsFlusher:                      newDNSCacheFlusher(cfg.ACSFlushDNSOnReconnect),
+		deregistrationGrace:             deregistrationGrace,
+		storageVerifier:                 newStorageAttachmentVerifier(derivedContext, params.DataClient, cfg.EBSMountRetries),
+		pauseResume:                     params.PauseResume,
+		manifestVerifier:                newManifestSignatureVerifier(cfg, params.CredentialsProvider),
+		imagePrePuller:                  imagePrePuller,
+		handlerGoroutines:               newHandlerGoroutineLimiter(cfg.ACSMaxHandlerGoroutines),
+		failover:                        newACSMultiRegionFailover(cfg, params.BackupCredentials, params.CertVerification, params.ECSClient, params.ContainerInstanceARN),
 		_heartbeatTimeout:               heartbeatTimeout,
 		_heartbeatJitter:                heartbeatJitter,
 		_inactiveInstanceReconnectDelay: inactiveInstanceReconnectDelay,
+		_logger:                         sessionLogger,
 	}
 }
 
@@ -193,17 +360,59 @@ func NewSession(
 // by the context.
 // If the instance is deregistered, Start() would emit an event to the
 // deregister-instance event stream and sets the connection backoff time to 1 hour.
+// If the session stopped with an error that is not retryable, Start() keeps
+// reconnecting with backoff, as the error may be fixed at runtime, but doesn't
+// notify the recovery hook of it since restarting the agent doesn't fix it.
+// Every time the session stops with an error, the recovery hook is notified.
+// If the session connects to ACS too many times in a minute, Start() stops
+// connecting for a while and notifies the connect storm callback.
+// If the system clock is further than the configured threshold from the time of
+// the NTP server, Start() warns that the connections to ACS may fail.
 func (acsSession *session) Start() error {
+	// Observe the task state changes for as long as the session runs
+	defer acsSession.observeTaskStateChanges()()
+	acsSession.warnOnClockSkew()
 	// connectToACS channel is used to indicate the intent to connect to ACS
 	// It's processed by the select loop to connect to ACS
 	connectToACS := make(chan struct{}, 1)
 	// This is required to trigger the first connection to ACS. Subsequent
 	// connections are triggered by the handleACSError() method
 	connectToACS <- struct{}{}
+	// Trace the messages exchanged with ACS over all the connections of the session
+	messageTracer, err := newACSMessageTraceExporter(acsSession.agentConfig)
+	if err != nil {
+		acsSession.logger().Warnf("Unable to open the ACS message trace file, messages won't be traced: %v", err)
+	}
+	acsSession.messageTracer = messageTracer
+	defer messageTracer.close()
+	// Retrieve the instance environment variables added to the containers once
+	// for all the connections of the session
+	acsSession.envInjector.load()
+	// Keep checking the docker daemon health and the memory pressure of the host
+	// for as long as the session runs
+	go acsSession.dockerHealth.run(acsSession.ctx)
+	// Compare the messages of endpoint A with those of endpoint B for as long as
+	// the session runs, if split testing
+	if acsSession.splitTest != nil {
+		go acsSession.runSplitTestSession(acsSession.ctx)
+	}
+	// The caches of the OS are only flushed before reconnecting
+	reconnecting := false
 	for {
 		select {
 		case <-connectToACS:
-			seelog.Debugf("Received connect to ACS message")
+			acsSession.logger().Debugf("Received connect to ACS message")
+			if cooldown := acsSession.reconnectDetector.recordConnect(); cooldown > 0 {
+				// Connecting and disconnecting in a loop, stop connecting for a while
+				if !acsSession.waitForDuration(cooldown) {
+					// agent is shutting down, exiting cleanly
+					return nil
+				}
+			}
+			if reconnecting {
+				acsSession.flushDNSCache()
+			}
+			reconnecting = true
 			// Start a session with ACS
 			acsError := acsSession.startSessionOnce()
 			select {
@@ -217,35 +426,44 @@ func (acsSession *session) Start() error {
 			if isInactiveInstance {
 				// If the instance was deregistered, send an event to the event stream
 				// for the same
-				seelog.Debug("Container instance is deregistered, notifying listeners")
-				err := acsSession.deregisterInstanceEventStream.WriteToEventStream(struct{}{})
-				if err != nil {
-					seelog.Debugf("Failed to write to deregister container instance event stream, err: %v", err)
-				}
+				acsSession.emitDeregistration()
+			}
+			reconnectWithoutBackoff := shouldReconnectWithoutBackoff(acsError)
+			// Restarting the agent doesn't fix a non-retryable error, the recovery
+			// hook isn't notified of it
+			isNonRetryable := !reconnectWithoutBackoff && !isInactiveInstance && !apierrors.IsRetryable(acsError)
+			if !reconnectWithoutBackoff && !isNonRetryable {
+				acsSession.sessionFailed(acsError)
 			}
-			if shouldReconnectWithoutBackoff(acsError) {
+			if reconnectWithoutBackoff {
 				// If ACS closed the connection, there's no need to backoff,
 				// reconnect immediately
-				seelog.Infof("ACS Websocket connection closed for a valid reason: %v", acsError)
+				acsSession.logger().Infof("ACS Websocket connection closed for a valid reason: %v", acsError)
 				acsSession.backoff.Reset()
 				sendEmptyMessageOnChannel(connectToACS)
 			} else {
 				// Disconnected unexpectedly from ACS, compute backoff duration to
 				// reconnect
 				reconnectDelay := acsSession.computeReconnectDelay(isInactiveInstance)
-				seelog.Infof("Reconnecting to ACS in: %s", reconnectDelay.String())
+				if isNonRetryable {
+					// The error may still be fixed at runtime, by creating the
+					// cluster or granting access to the instance role for instance.
+					// The backoff keeps growing as long as it isn't
+					acsSession.logger().Errorf("ACS session stopped with a non-retryable error: %v", acsError)
+				}
+				acsSession.logger().Infof("Reconnecting to ACS in: %s", reconnectDelay.String())
 				waitComplete := acsSession.waitForDuration(reconnectDelay)
 				if waitComplete {
 					// If the context was not cancelled and we've waited for the
 					// wait duration without any errors, send the message to the channel
 					// to reconnect to ACS
-					seelog.Info("Done waiting; reconnecting to ACS")
+					acsSession.logger().Info("Done waiting; reconnecting to ACS")
 					sendEmptyMessageOnChannel(connectToACS)
 				} else {
 					// Wait was interrupted. We expect the session to close as canceling
 					// the session context is the only way to end up here. Print a message
 					// to indicate the same
-					seelog.Info("Interrupted waiting for reconnect delay to elapse; Expect session to close")
+					acsSession.logger().Info("Interrupted waiting for reconnect delay to elapse; Expect session to close")
 				}
 			}
 		case <-acsSession.ctx.Done():
@@ -256,18 +474,132 @@ func (acsSession *session) Start() error {
 	}
 }
 
+// observeTaskStateChanges registers the observers of the session with the task
+// handler. The returned function unregisters them
+func (acsSession *session) observeTaskStateChanges() func() {
+	if acsSession.taskHandler == nil {
+		return func() {}
+	}
+	var unregisterFuncs []func()
+	// Relay the container state changes to ACS, if enabled
+	if acsSession.eventRelay != nil {
+		unregisterFuncs = append(unregisterFuncs, acsSession.taskHandler.Observe(acsSession.eventRelay.observe))
+	}
+	// Remove the tmpfs mounts of the tasks once they are stopped
+	if acsSession.filesystemPreparator != nil {
+		unregisterFuncs = append(unregisterFuncs, acsSession.taskHandler.Observe(acsSession.filesystemPreparator.observe))
+	}
+	// Emit the deregistration event as soon as the last running task stops
+	if acsSession.deregistrationGrace != nil {
+		unregisterFuncs = append(unregisterFuncs, acsSession.taskHandler.Observe(acsSession.deregistrationGrace.observe))
+	}
+	return func() {
+		for _, unregister := range unregisterFuncs {
+			unregister()
+		}
+	}
+}
+
+// sessionFailed counts the failed session and notifies the recovery hook
+func (acsSession *session) sessionFailed(acsError error) {
+	acsSession.consecutiveFailures++
+	if acsSession.recoveryHook != nil {
+		acsSession.recoveryHook.OnSessionFailed(acsError.Error(), acsSession.consecutiveFailures)
+	}
+}
+
 // startSessionOnce creates a session with ACS and handles requests using the passed
-// in arguments
+// in arguments. The session is created with the backup endpoint if it failed over
 func (acsSession *session) startSessionOnce() error {
-	acsEndpoint, err := acsSession.ecsClient.DiscoverPollEndpoint(acsSession.containerInstanceARN)
+	if acsSession.failover.shouldUseBackup() {
+		return acsSession.startSessionWithProtocolRecovery(acsSession.failover.backupEndpoint)
+	}
+	connectionCount := acsSession.connectionCount
+	err := acsSession.startPrimarySession()
+	acsSession.failover.primaryAttempted(acsSession.connectionCount > connectionCount)
+	return err
+}
+
+// startPrimarySession creates a session with the discovered ACS endpoint
+func (acsSession *session) startPrimarySession() error {
+	acsEndpoint, err := acsSession.pollEndpoint()
 	if err != nil {
-		seelog.Errorf("acs: unable to discover poll endpoint, err: %v", err)
 		return err
 	}
+	return acsSession.startSessionWithProtocolRecovery(acsEndpoint)
+}
 
-	url := acsWsURL(acsEndpoint, acsSession.agentConfig.Cluster, acsSession.containerInstanceARN, acsSession.taskEngine, acsSession.resources)
-	client := acsSession.resources.createACSClient(url, acsSession.agentConfig)
+// startSessionWithProtocolRecovery creates a session with the ACS endpoint, with
+// the previous versions of the ACS protocol if ACS doesn't support the current one
+func (acsSession *session) startSessionWithProtocolRecovery(acsEndpoint string) error {
+	for {
+		err := acsSession.startSessionWithEndpoint(acsEndpoint)
+		if !isProtocolVersionUnsupportedError(err) {
+			return err
+		}
+		// ACS doesn't support the version of the protocol, retry right away
+		// with the previous version
+		rejectedVersion := acsSession.protocolMismatchRecovery.protocolVersion()
+		if !acsSession.protocolMismatchRecovery.downgrade() {
+			acsSession.logger().Errorf("ACS doesn't support the lowest protocol version %d: %v", rejectedVersion, err)
+			return err
+		}
+		acsSession.logger().Warnf("ACS doesn't support protocol version %d, reconnecting with version %d",
+			rejectedVersion, acsSession.protocolMismatchRecovery.protocolVersion())
+	}
+}
+
+// pollEndpoint returns the ACS endpoint to connect to. It's endpoint A of split
+// test sessions, the discovered endpoint otherwise
+func (acsSession *session) pollEndpoint() (string, error) {
+	if acsSession.splitTest != nil {
+		return acsSession.agentConfig.ACSEndpointA, nil
+	}
+	acsEndpoint, err := acsSession.ecsClient.DiscoverPollEndpoint(acsSession.containerInstanceARN)
+	if err != nil {
+		acsSession.logger().Errorf("acs: unable to discover poll endpoint, err: %v", err)
+		return "", err
+	}
+	if acsSession.endpointRotation.shouldRotate(acsEndpoint) {
+		// The endpoint may be cached for a long time, discover a new one instead
+		// of retrying the one that keeps failing
+		acsSession.logger().Warnf("Failed to connect to ACS endpoint %s %d times in a row, discovering a new endpoint",
+			acsEndpoint, acsSession.endpointRotation.consecutiveFailures())
+		acsSession.endpointRotation.resetFailures()
+		acsEndpoint, err = acsSession.ecsClient.ForceDiscoverPollEndpoint(acsSession.containerInstanceARN)
+		if err != nil {
+			acsSession.logger().Errorf("acs: unable to discover poll endpoint, err: %v", err)
+			return "", err
+		}
+		acsSession.endpointRotation.shouldRotate(acsEndpoint)
+	}
+	return acsEndpoint, nil
+}
+
+// startSessionWithEndpoint creates a session with the ACS endpoint, using the
+// current version of the ACS protocol, and handles requests until the session ends
+func (acsSession *session) startSessionWithEndpoint(acsEndpoint string) error {
+	attributes := acsSession.instanceAttributesFetcher.fetch()
+	url := acsWsURL(acsEndpoint, acsSession.agentConfig.Cluster, acsSession.containerInstanceARN,
+		acsSession.sessionPersistentID, acsSession.protocolMismatchRecovery.protocolVersion(), acsSession.taskEngine, acsSession.activeResources(), acsSession.instanceResources, attributes,
+		detectWasmRuntime(acsSession.wasmRuntimeDetector))
+
+	// Connect from a dedicated network namespace if configured, the namespace
+	// is destroyed once the connection is closed
+	if err := acsSession.namespaceIsolator.create(); err != nil {
+		acsSession.logger().Errorf("acs: unable to create the network namespace of the connection: %v", err)
+		return err
+	}
+	defer func() {
+		if err := acsSession.namespaceIsolator.destroy(); err != nil {
+			acsSession.logger().Warnf("acs: unable to destroy the network namespace of the connection: %v", err)
+		}
+	}()
+	client := acsSession.activeResources().createACSClient(url, acsSession.acsClientConfig())
 	defer client.Close()
+	acsSession.namespaceIsolator.use(client, acsSession.logger())
+	// Prefer the ACS hosts in the availability zone of the instance, if configured
+	acsSession.azAffinity.use(client, attributes, acsSession.namespaceIsolator.dialer(), acsSession.logger())
 
 	return acsSession.startACSSession(client)
 }
@@ -275,14 +607,21 @@ func (acsSession *session) startSessionOnce() error {
 // startACSSession starts a session with ACS. It adds request handlers for various
 // kinds of messages expected from ACS. It returns on server disconnection or when
 // the context is cancelled
-func (acsSession *session) startACSSession(client wsclient.ClientServer) error {
+func (acsSession *session) startACSSession(client wsclient.ClientServer) (sessionErr error) {
 	cfg := acsSession.agentConfig
 
+	// Count the messages handled over the connection, including the ones whose
+	// handler panics
+	telemetry := newSessionTelemetryCollector()
+	telemetry.use(client)
+	acsSession.messageTracer.use(client)
+	// A panic in a handler fails the handling of the message instead of crashing the agent
+	useDefaultRequestHandlerMiddlewares(client, acsSession.logger())
+
 	refreshCredsHandler := newRefreshCredentialsHandler(acsSession.ctx, cfg.Cluster, acsSession.containerInstanceARN,
-		client, acsSession.credentialsManager, acsSession.taskEngine)
-	defer refreshCredsHandler.clearAcks()
+		client, acsSession.credentialsManager, acsSession.taskEngine, acsSession.handlerGoroutines)
 	refreshCredsHandler.start()
-	defer refreshCredsHandler.stop()
+	defer acsSession.stopHandler(&refreshCredsHandler)
 
 	client.AddRequestHandler(refreshCredsHandler.handlerFunc())
 
@@ -294,9 +633,10 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer) error {
 		client,
 		acsSession.state,
 		acsSession.dataClient,
+		acsSession.handlerGoroutines,
 	)
 	eniAttachHandler.start()
-	defer eniAttachHandler.stop()
+	defer acsSession.stopHandler(&eniAttachHandler)
 
 	client.AddRequestHandler(eniAttachHandler.handlerFunc())
 
@@ -308,65 +648,233 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer) error {
 		client,
 		acsSession.state,
 		acsSession.dataClient,
+		acsSession.handlerGoroutines,
 	)
 	instanceENIAttachHandler.start()
-	defer instanceENIAttachHandler.stop()
+	defer acsSession.stopHandler(&instanceENIAttachHandler)
 
 	client.AddRequestHandler(instanceENIAttachHandler.handlerFunc())
 
+	// Add handler to save and ack the resource attachments other than ENIs
+	attachmentHandler := newGenericAttachmentHandler(acsSession.ctx, client, acsSession.dataClient)
+	attachmentHandler.start()
+	defer acsSession.stopHandler(&attachmentHandler)
+
+	client.AddRequestHandler(attachmentHandler.handlerFunc())
+
 	// Add TaskManifestHandler
 	taskManifestHandler := newTaskManifestHandler(acsSession.ctx, cfg.Cluster, acsSession.containerInstanceARN,
-		client, acsSession.dataClient, acsSession.taskEngine, acsSession.latestSeqNumTaskManifest)
+		client, acsSession.dataClient, acsSession.taskEngine, acsSession.latestSeqNumTaskManifest,
+		cfg.ACSManifestHistoryDepth, acsSession.secretsPrewarmer, acsSession.manifestVerifier, acsSession.imagePrePuller,
+		acsSession.handlerGoroutines)
 
-	defer taskManifestHandler.clearAcks()
 	taskManifestHandler.start()
-	defer taskManifestHandler.stop()
+	defer acsSession.stopHandler(&taskManifestHandler)
 
 	client.AddRequestHandler(taskManifestHandler.handlerFuncTaskManifestMessage())
 	client.AddRequestHandler(taskManifestHandler.handlerFuncTaskStopVerificationMessage())
 
+	// Add handler to drain the container instance before it is deregistered
+	taskDrainHandler := newTaskDrainHandler(acsSession.ctx, cfg.Cluster, acsSession.containerInstanceARN,
+		client, acsSession.taskEngine, acsSession.drainState)
+	taskDrainHandler.start()
+	defer acsSession.stopHandler(&taskDrainHandler)
+
+	client.AddRequestHandler(taskDrainHandler.handlerFunc())
+
+	// Add handler for the changes of the status of the container instance
+	containerInstanceStatusHandler := newContainerInstanceStatusHandler(acsSession.ctx, cfg.Cluster,
+		acsSession.containerInstanceARN, client, acsSession.dataClient, acsSession.drainState,
+		acsSession.deregisterInstanceEventStream)
+	containerInstanceStatusHandler.start()
+	defer acsSession.stopHandler(&containerInstanceStatusHandler)
+
+	client.AddRequestHandler(containerInstanceStatusHandler.handlerFunc())
+
+	// Add handler for the updates of the container instance attributes
+	attributeUpdateHandler := newAttributeUpdateHandler(acsSession.ctx, cfg.Cluster, acsSession.containerInstanceARN,
+		client, acsSession.ecsClient, acsSession.dataClient, acsSession.attributeUpdateLimiter)
+	attributeUpdateHandler.start()
+	defer acsSession.stopHandler(&attributeUpdateHandler)
+
+	client.AddRequestHandler(attributeUpdateHandler.handlerFunc())
+
+	// Add handler to deliver the alerts pushed by ACS to the operators of the instance
+	operatorAlertHandler := newOperatorAlertHandler(acsSession.ctx, cfg.Cluster, acsSession.containerInstanceARN,
+		client, acsSession.alertSink, acsSession.alertLimiter)
+	operatorAlertHandler.start()
+	defer acsSession.stopHandler(&operatorAlertHandler)
+
+	client.AddRequestHandler(operatorAlertHandler.handlerFunc())
+
+	// Add handler to upload diagnostic bundles on request
+	diagnosticBundleHandler := newDiagnosticBundleHandler(acsSession.ctx, cfg.Cluster, acsSession.containerInstanceARN,
+		client, acsSession.taskEngine, acsSession.dockerClient, os.Getenv(logger.LOGFILE_ENV_VAR))
+	diagnosticBundleHandler.start()
+	defer acsSession.stopHandler(&diagnosticBundleHandler)
+
+	client.AddRequestHandler(diagnosticBundleHandler.handlerFunc())
+
+	// Add handler to answer the queries of the state of the container instance
+	getInstanceStateHandler := newGetInstanceStateHandler(acsSession.ctx, cfg.Cluster, acsSession.containerInstanceARN,
+		client, acsSession.state, cfg.ACSGetInstanceStateTimeout)
+	getInstanceStateHandler.start()
+	defer acsSession.stopHandler(&getInstanceStateHandler)
+
+	client.AddRequestHandler(getInstanceStateHandler.handlerFunc())
+
+	// Add handler to push configuration updates to the managed agents of tasks
+	managedAgentHandler := newManagedAgentHandler(acsSession.ctx, cfg.Cluster, acsSession.containerInstanceARN,
+		client, acsSession.taskEngine)
+	managedAgentHandler.start()
+	defer acsSession.stopHandler(&managedAgentHandler)
+
+	client.AddRequestHandler(managedAgentHandler.handlerFunc())
+
+	// Add handler to answer the authentication challenges of ACS. Task payloads are
+	// held back until the challenge of the connection is completed, if required
+	authGate := newAuthChallengeGate(cfg.ACSAuthChallengeRequired)
+	authChallengeHandler := newAuthChallengeHandler(acsSession.ctx, cfg.Cluster, acsSession.containerInstanceARN,
+		client, acsSession.authChallenger, authGate)
+	authChallengeHandler.start()
+	defer acsSession.stopHandler(&authChallengeHandler)
+
+	client.AddRequestHandler(authChallengeHandler.handlerFunc())
+
+	// Send the heartbeat acks along with the payload acks, if enabled. The heartbeat ack
+	// held when the session ends is sent on its own
+	var heartbeatAcks *heartbeatAckPiggyback
+	if cfg.PiggybackHeartbeat {
+		heartbeatAcks = newHeartbeatAckPiggyback(client, heartbeatAckPiggybackWindow)
+		defer heartbeatAcks.flush()
+	}
+
+	// Reconnect when the round-trip latency of the connection exceeds the budget. The
+	// acks are held for the batch window before being sent, if batched
+	latencyBudget := newConnectionLatencyBudget(cfg.ACSMaxRTT + cfg.ACSAckBatchWindow)
+	latencyBudget.use(client)
+
 	// Add request handler for handling payload messages from ACS
-	payloadHandler := newPayloadRequestHandler(
-		acsSession.ctx,
-		acsSession.taskEngine,
-		acsSession.ecsClient,
-		cfg.Cluster,
-		acsSession.containerInstanceARN,
-		client,
-		acsSession.dataClient,
-		refreshCredsHandler,
-		acsSession.credentialsManager,
-		acsSession.taskHandler, acsSession.latestSeqNumTaskManifest)
-	// Clear the acks channel on return because acks of messageids don't have any value across sessions
-	defer payloadHandler.clearAcks()
+	payloadHandler := newPayloadRequestHandler(acsSession.ctx, payloadRequestHandlerParams{
+		taskEngine:           acsSession.taskEngine,
+		ecsClient:            acsSession.ecsClient,
+		cluster:              cfg.Cluster,
+		containerInstanceArn: acsSession.containerInstanceARN,
+		acsClient:            client,
+		dataClient:           acsSession.dataClient,
+		refreshHandler:       refreshCredsHandler,
+		credentialsManager:   acsSession.credentialsManager,
+		taskHandler:          acsSession.taskHandler,
+		seqNumTaskManifest:   acsSession.latestSeqNumTaskManifest,
+		taskGroupThrottle:    acsSession.taskGroupThrottle,
+		drainState:           acsSession.drainState,
+		launchTracker: newLaunchSuccessRateTracker(cfg.ACSLaunchSuccessRateWindowSize, cfg.ACSMinLaunchSuccessRate,
+			cfg.ACSReconnectOnLowLaunchSuccessRate.Enabled()),
+		taskMetadataCache:   acsSession.taskMetadataCache,
+		cgroup:              newHandlerCgroup(cfg.ACSHandlerCgroupPath),
+		pinning:             newProcessorPinning(cfg.ACSProcessorAffinity),
+		authGate:            authGate,
+		filesystem:          acsSession.filesystemPreparator,
+		instanceResources:   acsSession.instanceResources,
+		dockerHealth:        acsSession.dockerHealth,
+		tagsSynchronizer:    acsSession.tagsSynchronizer,
+		ebsWaiter:           acsSession.ebsWaiter,
+		storageVerifier:     acsSession.storageVerifier,
+		boundaryChecker:     acsSession.boundaryChecker,
+		pauseResume:         acsSession.pauseResume,
+		envInjector:         acsSession.envInjector,
+		payloadBufferMin:    cfg.ACSPayloadBufferMin,
+		payloadBufferMax:    cfg.ACSPayloadBufferMax,
+		submitRatePerSecond: cfg.ACSBatchSubmitRatePerSecond,
+		maxMessageAge:       cfg.ACSMaxPayloadMessageAge,
+		strictDecodeMode:    cfg.StrictDecodeMode,
+		heartbeatAcks:       heartbeatAcks,
+		idempotencyTokenTTL: cfg.ACSIdempotencyTokenTTL,
+		goroutines:          acsSession.handlerGoroutines,
+	})
+	// Carry the acks that couldn't be sent over to the next session on return, so that
+	// ACS doesn't resend the messages
+	defer func() {
+		newSessionMigration(&payloadHandler, &refreshCredsHandler).save(acsSession.dataClient)
+	}()
 	payloadHandler.start()
-	defer payloadHandler.stop()
+	defer acsSession.stopHandler(&payloadHandler)
 
 	client.AddRequestHandler(payloadHandler.handlerFunc())
 
-	heartbeatHandler := newHeartbeatHandler(acsSession.ctx, client, acsSession.doctor)
-	defer heartbeatHandler.clearAcks()
+	heartbeatHandler := newHeartbeatHandler(acsSession.ctx, client, acsSession.doctor, acsSession.hostMetrics,
+		newContainerInstanceCapacityTracker(acsSession.instanceResources, acsSession.taskEngine), heartbeatAcks,
+		acsSession.handlerGoroutines)
 	heartbeatHandler.start()
-	defer heartbeatHandler.stop()
+	defer acsSession.stopHandler(&heartbeatHandler)
 
 	client.AddRequestHandler(heartbeatHandler.handlerFunc())
 
+	// Make the acks of this connection available to the introspection server
+	defer acsSession.inFlightAcks.register(&refreshCredsHandler, &eniAttachHandler, &instanceENIAttachHandler,
+		&attachmentHandler, &taskManifestHandler, &taskDrainHandler, &containerInstanceStatusHandler,
+		&attributeUpdateHandler, &operatorAlertHandler, &diagnosticBundleHandler, &getInstanceStateHandler,
+		&managedAgentHandler, &authChallengeHandler, &payloadHandler, &heartbeatHandler)()
+
 	updater.AddAgentUpdateHandlers(client, cfg, acsSession.state, acsSession.dataClient, acsSession.taskEngine)
 
 	err := client.Connect()
 	if err != nil {
-		seelog.Errorf("Error connecting to ACS: %v", err)
+		acsSession.logger().Errorf("Error connecting to ACS: %v", err)
+		if !acsSession.failover.isOnBackup() {
+			acsSession.endpointRotation.connectionFailed()
+		}
 		return err
 	}
 
-	seelog.Info("Connected to ACS endpoint")
+	acsSession.requestID = connectionRequestID(client)
+	acsSession.logger().Infof("Connected to ACS endpoint, request id: %s", acsSession.requestID)
+	if cfg.ACSConnectionFingerprintLogging {
+		checkCertificateFingerprint(connectionCertificateFingerprint(client), acsSession.dataClient, acsSession.logger())
+	}
+	acsSession.consecutiveFailures = 0
+	acsSession.endpointRotation.resetFailures()
+	acsSession.protocolMismatchRecovery.connected()
+	acsSession.connectionCount++
+	telemetry.connected()
+	// Upload the metrics of the connection once it's closed, whatever the reason
+	defer func() {
+		acsSession.uploadSessionTelemetry(telemetry, sessionErr)
+	}()
+	// Reconnect to try another ACS host if this one isn't in the availability
+	// zone of the instance, and another one may be
+	if acsSession.azAffinity.connected(client, acsSession.logger()) {
+		return errAvailabilityZoneMismatch
+	}
+	if acsSession.recoveryHook != nil {
+		acsSession.recoveryHook.OnSessionConnected()
+	}
 	// Start inactivity timer for closing the connection
-	timer := newDisconnectionTimer(client, acsSession.heartbeatTimeout(), acsSession.heartbeatJitter())
-	// Any message from the server resets the disconnect timeout
-	client.SetAnyRequestHandler(anyMessageHandler(timer, client))
+	timer := newDisconnectionTimer(client, acsSession.heartbeatTimeout(), acsSession.heartbeatJitter(), acsSession.logger())
+	// Any message from the server resets the disconnect timeout. The messages are
+	// compared with those of endpoint B if split testing
+	client.SetAnyRequestHandler(acsSession.splitTest.observe(splitTestEndpointA,
+		anyMessageHandler(timer, client, acsSession.logger())))
 	defer timer.Stop()
+	// Close the connection if ACS doesn't authenticate the instance in time, the
+	// tasks of the connection wouldn't be processed otherwise
+	if authGate != nil {
+		authTimer := time.AfterFunc(authChallengeTimeout, func() {
+			if !authGate.isCompleted() {
+				acsSession.logger().Errorf("ACS authentication challenge not completed within %s, closing the connection",
+					authChallengeTimeout.String())
+				client.Close()
+			}
+		})
+		defer authTimer.Stop()
+	}
+
+	acsSession.activeResources().connectedToACS()
+	// Let ACS know why the previous run of the agent crashed, if it did
+	acsSession.crashReporter.report(client, cfg.Cluster, acsSession.containerInstanceARN)
 
-	acsSession.resources.connectedToACS()
+	// Send the acks carried over from the previous session before serving new messages
+	restoreSessionMigration(acsSession.dataClient).replay(&payloadHandler, &refreshCredsHandler)
 
 	backoffResetTimer := time.AfterFunc(
 		retry.AddJitter(acsSession.heartbeatTimeout(), acsSession.heartbeatJitter()), func() {
@@ -378,6 +886,36 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer) error {
 		})
 	defer backoffResetTimer.Stop()
 
+	// Report the state of the tasks to ACS periodically while connected
+	publisherCtx, cancelPublisher := context.WithCancel(acsSession.ctx)
+	defer cancelPublisher()
+	go acsSession.statePublisher.run(publisherCtx, client)
+
+	// Relay the task engine events buffered while disconnected, and those
+	// happening while connected
+	relayCtx, cancelRelay := context.WithCancel(acsSession.ctx)
+	defer cancelRelay()
+	go acsSession.eventRelay.run(relayCtx, client)
+
+	// Record the bandwidth used by the connection periodically
+	usageCtx, cancelUsage := context.WithCancel(acsSession.ctx)
+	defer cancelUsage()
+	go newSessionUsageReporter(sessionUsageReportInterval).run(usageCtx, client)
+
+	// Refresh the credentials before they expire and reconnect with them
+	reauthenticate := make(chan struct{})
+	refresherCtx, cancelRefresher := context.WithCancel(acsSession.ctx)
+	defer cancelRefresher()
+	go acsSession.tokenRefresher.run(refresherCtx, reauthenticate)
+
+	// Revert to the primary endpoint as soon as it's reachable again, if failed over
+	primaryRecovered := make(chan struct{})
+	if acsSession.failover.isOnBackup() {
+		monitorCtx, cancelMonitor := context.WithCancel(acsSession.ctx)
+		defer cancelMonitor()
+		go acsSession.failover.monitorPrimary(monitorCtx, primaryRecovered)
+	}
+
 	serveErr := make(chan error, 1)
 	go func() {
 		serveErr <- client.Serve()
@@ -388,28 +926,59 @@ func (acsSession *session) startACSSession(client wsclient.ClientServer) error {
 		case <-acsSession.ctx.Done():
 			// Stop receiving and sending messages from and to ACS when
 			// the context received from the main function is canceled
-			seelog.Infof("ACS session exited cleanly.")
+			acsSession.logger().Infof("ACS session exited cleanly, request id: %s", acsSession.requestID)
 			return acsSession.ctx.Err()
+		case <-reauthenticate:
+			acsSession.logger().Infof("Reconnecting to ACS with the refreshed credentials, request id: %s", acsSession.requestID)
+			if err := client.Close(); err != nil {
+				acsSession.logger().Warnf("Error closing the connection to ACS: %v", err)
+			}
+			return errReauthenticate
+		case <-primaryRecovered:
+			acsSession.logger().Infof("Reconnecting to the primary ACS endpoint, request id: %s", acsSession.requestID)
+			if err := client.Close(); err != nil {
+				acsSession.logger().Warnf("Error closing the connection to ACS: %v", err)
+			}
+			return errPrimaryRecovered
+		case <-latencyBudget.budgetExceeded():
+			acsSession.logger().Infof("Reconnecting to ACS as the round-trip latency of the connection exceeds %s, request id: %s",
+				cfg.ACSMaxRTT.String(), acsSession.requestID)
+			if err := client.Close(); err != nil {
+				acsSession.logger().Warnf("Error closing the connection to ACS: %v", err)
+			}
+			return errLatencyBudgetExceeded
 		case err := <-serveErr:
 			// Stop receiving and sending messages from and to ACS when
 			// client.Serve returns an error. This can happen when the
 			// the connection is closed by ACS or the agent
 			if err == nil || err == io.EOF {
-				seelog.Info("ACS Websocket connection closed for a valid reason")
+				acsSession.logger().Infof("ACS Websocket connection closed for a valid reason, request id: %s", acsSession.requestID)
 			} else {
-				seelog.Errorf("Error: lost websocket connection with Agent Communication Service (ACS): %v", err)
+				acsSession.logger().Errorf("Error: lost websocket connection with Agent Communication Service (ACS), request id: %s: %v",
+					acsSession.requestID, err)
 			}
 			return err
 		}
 	}
 }
 
+// connectionRequestID returns the ID of the websocket upgrade request of the
+// client connection, if the client exposes it
+func connectionRequestID(client wsclient.ClientServer) string {
+	if provider, ok := client.(sessionStatsProvider); ok {
+		return provider.SessionStats().LastRequestID
+	}
+	return ""
+}
+
+// computeReconnectDelay returns the delay before reconnecting to ACS, capped by
+// the reconnect cap of the session
 func (acsSession *session) computeReconnectDelay(isInactiveInstance bool) time.Duration {
 	if isInactiveInstance {
-		return acsSession._inactiveInstanceReconnectDelay
+		return acsSession.reconnectCap.clamp(acsSession._inactiveInstanceReconnectDelay, true)
 	}
 
-	return acsSession.backoff.Duration()
+	return acsSession.reconnectCap.clamp(acsSession.backoff.Duration(), false)
 }
 
 // waitForDuration waits for the specified duration of time. If the wait is interrupted,
@@ -425,6 +994,63 @@ func (acsSession *session) waitForDuration(delay time.Duration) bool {
 	}
 }
 
+// emitDeregistration notifies the listeners of the deregister-instance event
+// stream that the container instance is deregistered. If a grace period is
+// configured, the event is held back until the tasks running on the instance
+// are stopped, for up to the grace period
+func (acsSession *session) emitDeregistration() {
+	emit := func() {
+		acsSession.logger().Debug("Container instance is deregistered, notifying listeners")
+		err := writeConnectionEvent(acsSession.deregisterInstanceEventStream,
+			eventstream.ConnectionEvent{Type: eventstream.InstanceDeregistered})
+		if err != nil {
+			acsSession.logger().Debugf("Failed to write to deregister container instance event stream, err: %v", err)
+		}
+	}
+	if acsSession.deregistrationGrace == nil {
+		emit()
+		return
+	}
+	if acsSession.deregistrationGrace.hold(acsSession.ctx, emit) {
+		acsSession.logger().Infof("Container instance is deregistered, not accepting new tasks and waiting up to %s for the running tasks to stop",
+			acsSession.deregistrationGrace.period.String())
+	}
+}
+
+// flushDNSCache flushes the caches of the OS, if enabled, so that reconnecting
+// resolves the current IPs of the ACS endpoint
+func (acsSession *session) flushDNSCache() {
+	if acsSession.dnsFlusher == nil {
+		return
+	}
+	if err := acsSession.dnsFlusher.Flush(); err != nil {
+		acsSession.logger().Warnf("Unable to flush the DNS cache before reconnecting to ACS: %v", err)
+	}
+}
+
+// checkClockSkew returns an error if the NTP sync check of the doctor finds the
+// system clock too far off for the TLS handshakes with ACS to succeed
+func (acsSession *session) checkClockSkew() error {
+	if acsSession.doctor == nil {
+		return nil
+	}
+	for _, healthcheck := range *acsSession.doctor.GetHealthchecks() {
+		if ntpSyncCheck, ok := healthcheck.(*doctor.NTPSyncCheck); ok {
+			return ntpSyncCheck.CheckSkew(acsSession.ctx)
+		}
+	}
+	return nil
+}
+
+// warnOnClockSkew logs a warning if the NTP sync check of the doctor finds the
+// system clock too far off the time of the NTP server. The session still connects
+// to ACS, the TLS handshakes are what fails if the clock is really skewed
+func (acsSession *session) warnOnClockSkew() {
+	if err := acsSession.checkClockSkew(); err != nil {
+		acsSession.logger().Warnf("The connections to ACS may fail until the system clock is corrected: %v", err)
+	}
+}
+
 func (acsSession *session) heartbeatTimeout() time.Duration {
 	return acsSession._heartbeatTimeout
 }
@@ -433,9 +1059,50 @@ func (acsSession *session) heartbeatJitter() time.Duration {
 	return acsSession._heartbeatJitter
 }
 
-// createACSClient creates the ACS Client using the specified URL
+// stopHandler stops the handler, waiting for it to drain for up to the handler
+// stop timeout
+func (acsSession *session) stopHandler(handler GracefulHandlerStop) {
+	timeout := acsSession.handlerStopTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := handler.StopWithTimeout(ctx); err != nil {
+		acsSession.logger().Warnf("ACS message handler %T didn't stop within %s, its pending acks were dropped: %v",
+			handler, timeout, err)
+	}
+}
+
+// handlerStopTimeout returns the time the handlers are given to stop when the
+// session ends
+func (acsSession *session) handlerStopTimeout() time.Duration {
+	if acsSession.agentConfig == nil || acsSession.agentConfig.ACSHandlerStopTimeout <= 0 {
+		return config.DefaultACSHandlerStopTimeout
+	}
+	return acsSession.agentConfig.ACSHandlerStopTimeout
+}
+
+// logger returns the logger of the session, the global seelog logger when none
+// was injected
+func (acsSession *session) logger() logger.Logger {
+	if acsSession._logger == nil {
+		return logger.NewNilSafeLogger(nil)
+	}
+	return acsSession._logger
+}
+
+// activeResources returns the resources of the connections to the endpoint the
+// session connects to, the backup endpoint if it failed over
+func (acsSession *session) activeResources() sessionResources {
+	return acsSession.failover.resources(acsSession.resources)
+}
+
+// createACSClient creates the ACS Client using the specified URL, or a client
+// receiving the ACS messages from SQS if a queue is configured
 func (acsResources *acsSessionResources) createACSClient(url string, cfg *config.Config) wsclient.ClientServer {
-	return acsclient.New(url, cfg, acsResources.credentialsProvider, wsRWTimeout)
+	if cfg.ACSQueueURL != "" {
+		return acsclient.NewSQSMessageSource(cfg, acsResources.credentialsProvider)
+	}
+	return acsclient.New(url, cfg, acsResources.credentialsProvider, wsRWTimeout, acsResources.tlsSessionCache,
+		acsResources.certVerification)
 }
 
 // connectedToACS records a successful connection to ACS
@@ -450,15 +1117,22 @@ func (acsResources *acsSessionResources) getSendCredentialsURLParameter() string
 	return strconv.FormatBool(acsResources.sendCredentials)
 }
 
-func newSessionResources(credentialsProvider *credentials.Credentials) sessionResources {
-	return &acsSessionResources{
+func newSessionResources(credentialsProvider *credentials.Credentials, tlsSessionCacheSize int,
+	certVerification *acsclient.SecureBootVerification) sessionResources {
+	resources := &acsSessionResources{
 		credentialsProvider: credentialsProvider,
 		sendCredentials:     true,
+		certVerification:    certVerification,
 	}
+	if tlsSessionCacheSize > 0 {
+		resources.tlsSessionCache = tls.NewLRUClientSessionCache(tlsSessionCacheSize)
+	}
+	return resources
 }
 
 // acsWsURL returns the websocket url for ACS given the endpoint
-func acsWsURL(endpoint, cluster, containerInstanceArn string, taskEngine engine.TaskEngine, acsSessionState sessionState) string {
+func acsWsURL(endpoint, cluster, containerInstanceArn, sessionID string, protocolVersion int, taskEngine engine.TaskEngine, acsSessionState sessionState,
+	instanceResources *instanceResources, instanceAttributes *instanceAttributes, wasmRuntime string) string {
 	acsURL := endpoint
 	if endpoint[len(endpoint)-1] != '/' {
 		acsURL += "/"
@@ -467,26 +1141,34 @@ func acsWsURL(endpoint, cluster, containerInstanceArn string, taskEngine engine.
 	query := url.Values{}
 	query.Set("clusterArn", cluster)
 	query.Set("containerInstanceArn", containerInstanceArn)
+	if sessionID != "" {
+		query.Set(sessionIDURLParameterName, sessionID)
+	}
 	query.Set("agentHash", version.GitHashString())
 	query.Set("agentVersion", version.Version)
 	query.Set("seqNum", "1")
-	query.Set("protocolVersion", strconv.Itoa(acsProtocolVersion))
+	query.Set("protocolVersion", strconv.Itoa(protocolVersion))
 	if dockerVersion, err := taskEngine.Version(); err == nil {
 		query.Set("dockerVersion", "DockerVersion: "+dockerVersion)
 	}
 	query.Set(sendCredentialsURLParameterName, acsSessionState.getSendCredentialsURLParameter())
+	instanceResources.setURLParameters(query)
+	instanceAttributes.setURLParameters(query)
+	setWasmRuntimeURLParameter(query, wasmRuntime)
+	setSchemaVersionURLParameter(query)
 	return acsURL + "?" + query.Encode()
 }
 
 // newDisconnectionTimer creates a new time object, with a callback to
 // disconnect from ACS on inactivity
-func newDisconnectionTimer(client wsclient.ClientServer, timeout time.Duration, jitter time.Duration) ttime.Timer {
+func newDisconnectionTimer(client wsclient.ClientServer, timeout time.Duration, jitter time.Duration,
+	log logger.Logger) ttime.Timer {
 	timer := time.AfterFunc(retry.AddJitter(timeout, jitter), func() {
-		seelog.Warn("ACS Connection hasn't had any activity for too long; closing connection")
+		log.Warn("ACS Connection hasn't had any activity for too long; closing connection")
 		if err := client.Close(); err != nil {
-			seelog.Warnf("Error disconnecting: %v", err)
+			log.Warnf("Error disconnecting: %v", err)
 		}
-		seelog.Info("Disconnected from ACS")
+		log.Info("Disconnected from ACS")
 	})
 
 	return timer
@@ -494,12 +1176,12 @@ func newDisconnectionTimer(client wsclient.ClientServer, timeout time.Duration,
 
 // anyMessageHandler handles any server message. Any server message means the
 // connection is active and thus the heartbeat disconnect should not occur
-func anyMessageHandler(timer ttime.Timer, client wsclient.ClientServer) func(interface{}) {
+func anyMessageHandler(timer ttime.Timer, client wsclient.ClientServer, log logger.Logger) func(interface{}) {
 	return func(interface{}) {
-		seelog.Debug("ACS activity occurred")
+		log.Debug("ACS activity occurred")
 		// Reset read deadline as there's activity on the channel
 		if err := client.SetReadDeadline(time.Now().Add(wsRWTimeout)); err != nil {
-			seelog.Warnf("Unable to extend read deadline for ACS connection: %v", err)
+			log.Warnf("Unable to extend read deadline for ACS connection: %v", err)
 		}
 
 		// Reset heartbeat timer
@@ -508,7 +1190,7 @@ func anyMessageHandler(timer ttime.Timer, client wsclient.ClientServer) func(int
 }
 
 func shouldReconnectWithoutBackoff(acsError error) bool {
-	return acsError == nil || acsError == io.EOF
+	return acsError == nil || acsError == io.EOF || acsError == errReauthenticate || acsError == errPrimaryRecovered
 }
 
 func isInactiveInstanceError(acsError error) bool {
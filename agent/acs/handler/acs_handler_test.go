@@ -16,8 +16,11 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -27,11 +30,14 @@ import (
 	"runtime/pprof"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"context"
 
+	acsclient "github.com/aws/amazon-ecs-agent/agent/acs/client"
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
 	mock_api "github.com/aws/amazon-ecs-agent/agent/api/mocks"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
@@ -45,6 +51,7 @@ import (
 	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
 	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
 
 	"github.com/aws/amazon-ecs-agent/agent/utils/retry"
 	mock_retry "github.com/aws/amazon-ecs-agent/agent/utils/retry/mock"
@@ -53,9 +60,11 @@ import (
 	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/cihub/seelog"
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/golang/mock/gomock"
 )
@@ -170,7 +179,7 @@ func TestACSWSURL(t *testing.T) {
 
 	taskEngine.EXPECT().Version().Return("Docker version result", nil)
 
-	wsurl := acsWsURL(acsURL, "myCluster", "myContainerInstance", taskEngine, &mockSessionResources{})
+	wsurl := acsWsURL(acsURL, "myCluster", "myContainerInstance", "", acsProtocolVersion, taskEngine, &mockSessionResources{}, nil, nil, "")
 
 	parsed, err := url.Parse(wsurl)
 	assert.NoError(t, err, "should be able to parse URL")
@@ -184,6 +193,94 @@ func TestACSWSURL(t *testing.T) {
 	assert.Equal(t, "1", parsed.Query().Get("seqNum"), "wrong seqNum")
 	protocolVersion, _ := strconv.Atoi(parsed.Query().Get("protocolVersion"))
 	assert.True(t, protocolVersion > 1, "ACS protocol version should be greater than 1")
+	assert.Equal(t, strconv.Itoa(agentSupportedSchemaVersion), parsed.Query().Get(schemaVersionURLParameterName), "wrong schema version")
+	assert.NotContains(t, parsed.Query(), instanceTypeURLParameterName, "instance type should not be set")
+	assert.NotContains(t, parsed.Query(), availableCPUURLParameterName, "available cpu should not be set")
+	assert.NotContains(t, parsed.Query(), availableMemoryMiBURLParameterName, "available memory should not be set")
+	assert.NotContains(t, parsed.Query(), instanceAttributesURLParameterName, "instance attributes should not be set")
+	assert.NotContains(t, parsed.Query(), sessionIDURLParameterName, "session id should not be set")
+}
+
+// TestACSWSURLWithSessionID tests if the session id is added to the URL
+func TestACSWSURLWithSessionID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker version result", nil)
+
+	wsurl := acsWsURL(acsURL, "myCluster", "myContainerInstance", "session-id", acsProtocolVersion, taskEngine, &mockSessionResources{}, nil, nil, "")
+
+	parsed, err := url.Parse(wsurl)
+	require.NoError(t, err, "should be able to parse URL")
+	assert.Equal(t, "session-id", parsed.Query().Get(sessionIDURLParameterName), "wrong session id")
+}
+
+// TestACSWSURLWithInstanceResources tests if the instance resources are added
+// to the URL when they are available
+func TestACSWSURLWithInstanceResources(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+
+	taskEngine.EXPECT().Version().Return("Docker version result", nil)
+
+	resources := &instanceResources{
+		instanceType:       "m5.large",
+		availableCPU:       2048,
+		availableMemoryMiB: 7680,
+	}
+	wsurl := acsWsURL(acsURL, "myCluster", "myContainerInstance", "", acsProtocolVersion, taskEngine, &mockSessionResources{}, resources, nil, "")
+
+	parsed, err := url.Parse(wsurl)
+	assert.NoError(t, err, "should be able to parse URL")
+	assert.Equal(t, "m5.large", parsed.Query().Get(instanceTypeURLParameterName), "wrong instance type")
+	assert.Equal(t, "2048", parsed.Query().Get(availableCPUURLParameterName), "wrong available cpu")
+	assert.Equal(t, "7680", parsed.Query().Get(availableMemoryMiBURLParameterName), "wrong available memory")
+}
+
+// TestACSWSURLWithInstanceAttributes tests if the instance attributes are added
+// to the URL when they are available
+func TestACSWSURLWithInstanceAttributes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+
+	taskEngine.EXPECT().Version().Return("Docker version result", nil)
+
+	attributes := &instanceAttributes{
+		AvailabilityZone: "us-west-2a",
+		InstanceType:     "m5.large",
+		AMIID:            "ami-12345678",
+		CapacityType:     "spot",
+	}
+	wsurl := acsWsURL(acsURL, "myCluster", "myContainerInstance", "", acsProtocolVersion, taskEngine, &mockSessionResources{}, nil, attributes, "")
+
+	parsed, err := url.Parse(wsurl)
+	assert.NoError(t, err, "should be able to parse URL")
+	assert.JSONEq(t,
+		`{"availabilityZone":"us-west-2a","instanceType":"m5.large","amiId":"ami-12345678","capacityType":"spot"}`,
+		parsed.Query().Get(instanceAttributesURLParameterName), "wrong instance attributes")
+}
+
+// TestACSWSURLWithWasmRuntime tests if the WebAssembly runtime is added to the
+// URL when one is detected
+func TestACSWSURLWithWasmRuntime(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+
+	taskEngine.EXPECT().Version().Return("Docker version result", nil).Times(2)
+
+	wsurl := acsWsURL(acsURL, "myCluster", "myContainerInstance", "", acsProtocolVersion, taskEngine, &mockSessionResources{}, nil, nil, "runwasi")
+	parsed, err := url.Parse(wsurl)
+	assert.NoError(t, err, "should be able to parse URL")
+	assert.Equal(t, "runwasi", parsed.Query().Get(wasmRuntimeURLParameterName), "wrong wasm runtime")
+
+	wsurl = acsWsURL(acsURL, "myCluster", "myContainerInstance", "", acsProtocolVersion, taskEngine, &mockSessionResources{}, nil, nil, "")
+	parsed, err = url.Parse(wsurl)
+	assert.NoError(t, err, "should be able to parse URL")
+	_, ok := parsed.Query()[wasmRuntimeURLParameterName]
+	assert.False(t, ok, "wasm runtime should not be advertised")
 }
 
 // TestHandlerReconnectsOnConnectErrors tests if handler reconnects retries
@@ -338,7 +435,7 @@ func TestHandlerReconnectsWithoutBackoffOnEOFError(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
 
-	deregisterInstanceEventStream := eventstream.NewEventStream("DeregisterContainerInstance", ctx)
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("DeregisterContainerInstance", ctx)
 	deregisterInstanceEventStream.StartListening()
 
 	mockBackoff := mock_retry.NewMockBackoff(ctrl)
@@ -401,7 +498,7 @@ func TestHandlerReconnectsWithBackoffOnNonEOFError(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
 
-	deregisterInstanceEventStream := eventstream.NewEventStream("DeregisterContainerInstance", ctx)
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("DeregisterContainerInstance", ctx)
 	deregisterInstanceEventStream.StartListening()
 
 	mockBackoff := mock_retry.NewMockBackoff(ctrl)
@@ -447,6 +544,184 @@ func TestHandlerReconnectsWithBackoffOnNonEOFError(t *testing.T) {
 	}
 }
 
+// urlRecordingSessionResources records the URLs of the ACS clients it creates
+type urlRecordingSessionResources struct {
+	mockSessionResources
+	lock sync.Mutex
+	urls []string
+}
+
+func (m *urlRecordingSessionResources) createACSClient(url string, cfg *config.Config) wsclient.ClientServer {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.urls = append(m.urls, url)
+	return m.client
+}
+
+func (m *urlRecordingSessionResources) sessionIDs() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	sessionIDs := []string{}
+	for _, rawURL := range m.urls {
+		parsed, _ := url.Parse(rawURL)
+		sessionIDs = append(sessionIDs, parsed.Query().Get(sessionIDURLParameterName))
+	}
+	return sessionIDs
+}
+
+func (m *urlRecordingSessionResources) hosts() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	hosts := []string{}
+	for _, rawURL := range m.urls {
+		parsed, _ := url.Parse(rawURL)
+		hosts = append(hosts, parsed.Hostname())
+	}
+	return hosts
+}
+
+// TestHandlerRotatesEndpointOnRepeatedConnectionFailures tests if the session handler
+// discovers a new endpoint, bypassing the cached one, after failing to connect to the
+// same endpoint IP too many times in a row
+// sessionStatsClientServer is a client exposing stats about its connection
+type sessionStatsClientServer struct {
+	*mock_wsclient.MockClientServer
+	stats wsclient.SessionStats
+}
+
+func (client *sessionStatsClientServer) SessionStats() wsclient.SessionStats {
+	return client.stats
+}
+
+func TestConnectionRequestID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+
+	assert.Empty(t, connectionRequestID(mockWsClient), "Clients without stats have no request id")
+	assert.Equal(t, "request-id", connectionRequestID(&sessionStatsClientServer{
+		MockClientServer: mockWsClient,
+		stats:            wsclient.SessionStats{LastRequestID: "request-id"},
+	}))
+}
+
+func TestHandlerRotatesEndpointOnRepeatedConnectionFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+
+	// The cached endpoint keeps failing, a healthy one is only returned when
+	// the cache is bypassed
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return("https://10.0.0.1", nil).AnyTimes()
+	ecsClient.EXPECT().ForceDiscoverPollEndpoint(gomock.Any()).Return("https://10.0.0.2", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
+
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("DeregisterContainerInstance", ctx)
+	deregisterInstanceEventStream.StartListening()
+
+	mockBackoff := mock_retry.NewMockBackoff(ctrl)
+	mockBackoff.EXPECT().Duration().Return(time.Millisecond).AnyTimes()
+	mockBackoff.EXPECT().Reset().AnyTimes()
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().Close().Return(nil).AnyTimes()
+	gomock.InOrder(
+		mockWsClient.EXPECT().Connect().Return(fmt.Errorf("connection refused")).Times(3),
+		mockWsClient.EXPECT().Connect().Do(func() {
+			cancel()
+		}).Return(io.EOF),
+	)
+	resources := &urlRecordingSessionResources{mockSessionResources: mockSessionResources{mockWsClient}}
+	acsSession := session{
+		containerInstanceARN:          "myArn",
+		credentialsProvider:           testCreds,
+		agentConfig:                   testConfig,
+		taskEngine:                    taskEngine,
+		ecsClient:                     ecsClient,
+		deregisterInstanceEventStream: deregisterInstanceEventStream,
+		dataClient:                    data.NewNoopClient(),
+		taskHandler:                   taskHandler,
+		backoff:                       mockBackoff,
+		ctx:                           ctx,
+		cancel:                        cancel,
+		resources:                     resources,
+		endpointRotation:              newEndpointRotation(3),
+		_heartbeatTimeout:             20 * time.Millisecond,
+		_heartbeatJitter:              10 * time.Millisecond,
+	}
+	acsSession.Start()
+
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.1", "10.0.0.1", "10.0.0.2"}, resources.hosts())
+}
+
+// TestHandlerReconnectsWithPersistentSessionID tests if the session handler uses
+// the same session id every time it reconnects to ACS
+func TestHandlerReconnectsWithPersistentSessionID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(acsURL, nil).AnyTimes()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("DeregisterContainerInstance", ctx)
+	deregisterInstanceEventStream.StartListening()
+
+	mockBackoff := mock_retry.NewMockBackoff(ctrl)
+	mockBackoff.EXPECT().Duration().Return(time.Millisecond).AnyTimes()
+	mockBackoff.EXPECT().Reset().AnyTimes()
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().Close().Return(nil).AnyTimes()
+	gomock.InOrder(
+		mockWsClient.EXPECT().Connect().Return(fmt.Errorf("connection refused")).Times(2),
+		mockWsClient.EXPECT().Connect().Do(func() {
+			cancel()
+		}).Return(io.EOF),
+	)
+	resources := &urlRecordingSessionResources{mockSessionResources: mockSessionResources{mockWsClient}}
+	acsSession := session{
+		containerInstanceARN:          "myArn",
+		sessionPersistentID:           "session-id",
+		credentialsProvider:           testCreds,
+		agentConfig:                   testConfig,
+		taskEngine:                    taskEngine,
+		ecsClient:                     ecsClient,
+		deregisterInstanceEventStream: deregisterInstanceEventStream,
+		dataClient:                    data.NewNoopClient(),
+		taskHandler:                   taskHandler,
+		backoff:                       mockBackoff,
+		ctx:                           ctx,
+		cancel:                        cancel,
+		resources:                     resources,
+		_heartbeatTimeout:             20 * time.Millisecond,
+		_heartbeatJitter:              10 * time.Millisecond,
+	}
+	acsSession.Start()
+
+	assert.Equal(t, []string{"session-id", "session-id", "session-id"}, resources.sessionIDs())
+}
+
+// TestNewSessionPersistentID tests if every new session gets its own session id
+func TestNewSessionPersistentID(t *testing.T) {
+	cfg := &config.Config{}
+	session1 := NewSession(context.Background(), SessionParams{Config: cfg, ContainerInstanceARN: "myArn"}).(*session)
+	session2 := NewSession(context.Background(), SessionParams{Config: cfg, ContainerInstanceARN: "myArn"}).(*session)
+	assert.NotEmpty(t, session1.sessionPersistentID)
+	assert.NotEmpty(t, session2.sessionPersistentID)
+	assert.NotEqual(t, session1.sessionPersistentID, session2.sessionPersistentID)
+}
+
 // TestHandlerGeneratesDeregisteredInstanceEvent tests if the session handler generates
 // an event into the deregister instance event stream when the acs connection is closed
 // with inactive instance error
@@ -462,16 +737,14 @@ func TestHandlerGeneratesDeregisteredInstanceEvent(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
 
-	deregisterInstanceEventStream := eventstream.NewEventStream("DeregisterContainerInstance", ctx)
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("DeregisterContainerInstance", ctx)
 
-	// receiverFunc cancels the context when invoked. Any event on the deregister
-	// instance even stream would trigger this.
-	receiverFunc := func(...interface{}) error {
+	// Any event on the deregister instance event stream cancels the context
+	events := subscribeTestConnectionEvents(t, deregisterInstanceEventStream)
+	go func() {
+		<-events
 		cancel()
-		return nil
-	}
-	err := deregisterInstanceEventStream.Subscribe("DeregisterContainerInstance", receiverFunc)
-	assert.NoError(t, err, "Error adding deregister instance event stream subscriber")
+	}()
 	deregisterInstanceEventStream.StartListening()
 	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
 	mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
@@ -521,7 +794,7 @@ func TestHandlerReconnectDelayForInactiveInstanceError(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
 
-	deregisterInstanceEventStream := eventstream.NewEventStream("DeregisterContainerInstance", ctx)
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("DeregisterContainerInstance", ctx)
 	deregisterInstanceEventStream.StartListening()
 
 	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
@@ -746,6 +1019,216 @@ func TestHandlerReconnectsOnDiscoverPollEndpointError(t *testing.T) {
 	}
 }
 
+// TestHandlerBacksOffOnNonRetryableErrors tests if the session handler keeps
+// reconnecting with backoff when the session ends with a non-retryable error,
+// as the error may be fixed at runtime, without notifying the recovery hook
+func TestHandlerBacksOffOnNonRetryableErrors(t *testing.T) {
+	accessDeniedErr := &wsclient.WSError{
+		ErrObj:              &ecsacs.AccessDeniedException{},
+		WSUnretriableErrors: &acsclient.ACSUnretriableErrors{},
+	}
+	testCases := []struct {
+		name       string
+		dpeErr     error
+		connectErr error
+	}{
+		{
+			name:   "DiscoverPollEndpoint error",
+			dpeErr: nonRetryableError{},
+		},
+		{
+			name:       "ACS error",
+			connectErr: accessDeniedErr,
+		},
+	}
+	const (
+		backoffDelay      = 100 * time.Millisecond
+		maxReconnectDelay = time.Minute
+	)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+			taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+
+			ecsClient := mock_api.NewMockECSClient(ctrl)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
+
+			mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+			mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
+			mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
+			mockWsClient.EXPECT().Close().Return(nil).AnyTimes()
+			mockBackoff := mock_retry.NewMockBackoff(ctrl)
+			mockBackoff.EXPECT().Duration().Return(backoffDelay).MinTimes(1)
+			mockBackoff.EXPECT().Reset().AnyTimes()
+
+			hook := &recordingRecoveryHook{onFailed: func() {}}
+
+			var firstAttempt time.Time
+			if tc.dpeErr != nil {
+				gomock.InOrder(
+					ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Do(func(string) {
+						firstAttempt = time.Now()
+					}).Return("", tc.dpeErr),
+					ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Do(func(string) {
+						cancel()
+					}).Return("", tc.dpeErr),
+				)
+			} else {
+				ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(acsURL, nil).Times(2)
+				gomock.InOrder(
+					mockWsClient.EXPECT().Connect().Do(func() {
+						firstAttempt = time.Now()
+					}).Return(tc.connectErr),
+					mockWsClient.EXPECT().Connect().Do(func() {
+						cancel()
+					}).Return(tc.connectErr),
+				)
+			}
+
+			acsSession := session{
+				containerInstanceARN: "myArn",
+				credentialsProvider:  testCreds,
+				agentConfig:          testConfig,
+				taskEngine:           taskEngine,
+				ecsClient:            ecsClient,
+				dataClient:           data.NewNoopClient(),
+				taskHandler:          taskHandler,
+				backoff:              mockBackoff,
+				reconnectCap:         newReconnectExponentialCap(maxReconnectDelay),
+				recoveryHook:         hook,
+				ctx:                  ctx,
+				cancel:               cancel,
+				resources:            &mockSessionResources{mockWsClient},
+				_heartbeatTimeout:    20 * time.Millisecond,
+				_heartbeatJitter:     10 * time.Millisecond,
+			}
+			err := acsSession.Start()
+			assert.NoError(t, err, "the session should only stop when its context is cancelled")
+			reconnectedAfter := time.Since(firstAttempt)
+			assert.True(t, reconnectedAfter >= backoffDelay && reconnectedAfter < maxReconnectDelay,
+				"the session should reconnect after the backoff delay, reconnected after %s", reconnectedAfter)
+			assert.Empty(t, hook.failures, "the recovery hook shouldn't be notified of non-retryable errors")
+		})
+	}
+}
+
+// recordingRecoveryHook records the consecutive failure counts it's notified with
+type recordingRecoveryHook struct {
+	failures []int
+	onFailed func()
+}
+
+func (hook *recordingRecoveryHook) OnSessionFailed(reason string, consecutiveFailures int) {
+	hook.failures = append(hook.failures, consecutiveFailures)
+	hook.onFailed()
+}
+
+func (hook *recordingRecoveryHook) OnSessionConnected() {}
+
+// TestHandlerNotifiesRecoveryHookOnSessionFailures tests that the recovery hook
+// is notified with an increasing failure count every time the session fails
+func TestHandlerNotifiesRecoveryHookOnSessionFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return("", errors.New("error")).Times(3)
+	hook := &recordingRecoveryHook{}
+	hook.onFailed = func() {
+		if len(hook.failures) == 3 {
+			cancel()
+		}
+	}
+
+	acsSession := session{
+		containerInstanceARN: "myArn",
+		credentialsProvider:  testCreds,
+		agentConfig:          testConfig,
+		taskEngine:           taskEngine,
+		ecsClient:            ecsClient,
+		dataClient:           data.NewNoopClient(),
+		backoff:              retry.NewExponentialBackoff(time.Millisecond, 2*time.Millisecond, 0, 1),
+		ctx:                  ctx,
+		cancel:               cancel,
+		recoveryHook:         hook,
+		_heartbeatTimeout:    20 * time.Millisecond,
+		_heartbeatJitter:     10 * time.Millisecond,
+	}
+	err := acsSession.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, hook.failures)
+}
+
+// TestHandlerStopsConnectingOnConnectStorm tests that the session stops
+// connecting to ACS and notifies the callback when it keeps being disconnected
+// right after connecting
+func TestHandlerStopsConnectingOnConnectStorm(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(acsURL, nil).AnyTimes()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
+
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().Close().Return(nil).AnyTimes()
+	// ACS closes every connection right away, the 4th connection attempt
+	// within a minute exceeds the limit and is held back
+	mockWsClient.EXPECT().Connect().Return(io.EOF).Times(3)
+
+	var stormConnects int
+	detector := newCircularReconnectDetector(3, func(connects int, window time.Duration) {
+		stormConnects = connects
+		// Stop the session while it waits for the cooldown to elapse
+		cancel()
+	})
+	detector.cooldown = time.Hour
+
+	acsSession := session{
+		containerInstanceARN:     "myArn",
+		credentialsProvider:      testCreds,
+		agentConfig:              testConfig,
+		taskEngine:               taskEngine,
+		ecsClient:                ecsClient,
+		dataClient:               data.NewNoopClient(),
+		taskHandler:              taskHandler,
+		backoff:                  retry.NewExponentialBackoff(time.Millisecond, 2*time.Millisecond, 0, 1),
+		ctx:                      ctx,
+		cancel:                   cancel,
+		resources:                &mockSessionResources{mockWsClient},
+		latestSeqNumTaskManifest: aws.Int64(10),
+		reconnectDetector:        detector,
+		_heartbeatTimeout:        20 * time.Millisecond,
+		_heartbeatJitter:         10 * time.Millisecond,
+	}
+	err := acsSession.Start()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, stormConnects)
+}
+
+// nonRetryableError is an error that reports it is not retryable
+type nonRetryableError struct{}
+
+func (nonRetryableError) Error() string {
+	return "NotFound"
+}
+
+func (nonRetryableError) Retry() bool {
+	return false
+}
+
 // TestConnectionIsClosedOnIdle tests if the connection to ACS is closed
 // when the channel is idle
 func TestConnectionIsClosedOnIdle(t *testing.T) {
@@ -855,7 +1338,7 @@ func TestHandlerDoesntLeakGoroutines(t *testing.T) {
 			ctx:                      ctx,
 			_heartbeatTimeout:        1 * time.Second,
 			backoff:                  retry.NewExponentialBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
-			resources:                newSessionResources(testCreds),
+			resources:                newSessionResources(testCreds, 0, nil),
 			credentialsManager:       rolecredentials.NewManager(),
 			latestSeqNumTaskManifest: aws.Int64(12),
 			doctor:                   emptyDoctor,
@@ -894,6 +1377,258 @@ func TestHandlerDoesntLeakGoroutines(t *testing.T) {
 
 }
 
+// simulatedNetworkSessionResources creates ACS clients connected through a
+// NetworkPartitionSimulator
+type simulatedNetworkSessionResources struct {
+	sessionResources
+	configure func(simulator *NetworkPartitionSimulator)
+}
+
+func (resources *simulatedNetworkSessionResources) createACSClient(url string, cfg *config.Config) wsclient.ClientServer {
+	simulator := NewNetworkPartitionSimulator(resources.sessionResources.createACSClient(url, cfg))
+	resources.configure(simulator)
+	return simulator
+}
+
+// startSimulatedNetworkSession starts a session connecting to the mock ACS server
+// through a simulated network. onConnect is invoked every time the session
+// connects, with the number of connections so far. It returns a channel closed
+// when the session ends
+func startSimulatedNetworkSession(ctx context.Context, cancel context.CancelFunc,
+	ctrl *gomock.Controller, serverURL string, heartbeatTimeout time.Duration,
+	configure func(*NetworkPartitionSimulator), onConnect func(int)) <-chan struct{} {
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	dockerClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	dockerClient.EXPECT().SystemPing(gomock.Any(), gomock.Any()).AnyTimes()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	connections := 0
+	ecsClient.EXPECT().DiscoverPollEndpoint("myArn").Return(serverURL, nil).AnyTimes().Do(func(_ interface{}) {
+		connections++
+		onConnect(connections)
+	})
+	emptyDoctor, _ := doctor.NewDoctor([]doctor.Healthcheck{}, "test-cluster", "this:is:an:instance:arn")
+
+	acsSession := session{
+		containerInstanceARN: "myArn",
+		credentialsProvider:  testCreds,
+		agentConfig:          testConfig,
+		taskEngine:           taskEngine,
+		dockerClient:         dockerClient,
+		ecsClient:            ecsClient,
+		dataClient:           data.NewNoopClient(),
+		taskHandler:          eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil),
+		ctx:                  ctx,
+		cancel:               cancel,
+		_heartbeatTimeout:    heartbeatTimeout,
+		_heartbeatJitter:     time.Millisecond,
+		backoff:              retry.NewExponentialBackoff(10*time.Millisecond, 20*time.Millisecond, 0, 1),
+		resources: &simulatedNetworkSessionResources{
+			sessionResources: newSessionResources(testCreds, 0, nil),
+			configure:        configure,
+		},
+		credentialsManager:       rolecredentials.NewManager(),
+		latestSeqNumTaskManifest: aws.Int64(12),
+		doctor:                   emptyDoctor,
+	}
+	ended := make(chan struct{})
+	go func() {
+		acsSession.Start()
+		close(ended)
+	}()
+	return ended
+}
+
+// sendHeartbeats sends heartbeats to the mock ACS server at the interval until
+// the context is canceled
+func sendHeartbeats(ctx context.Context, serverIn chan<- string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case serverIn <- `{"type":"HeartbeatMessage","message":{"healthy":true,"messageId":"123"}}`:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// TestHandlerReconnectsWhenMessagesAreLost tests that the session disconnects
+// after the heartbeat timeout and reconnects with a backoff when none of the
+// messages sent by ACS reach the agent
+func TestHandlerReconnectsWhenMessagesAreLost(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	closeWS := make(chan bool)
+	server, serverIn, requests, errs, err := startMockAcsServer(t, closeWS)
+	require.NoError(t, err)
+	go func() {
+		for {
+			select {
+			case <-requests:
+			case <-errs:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go sendHeartbeats(ctx, serverIn, 5*time.Millisecond)
+
+	heartbeatTimeout := 50 * time.Millisecond
+	var connectedAt []time.Time
+	ended := startSimulatedNetworkSession(ctx, cancel, ctrl, server.URL, heartbeatTimeout,
+		func(simulator *NetworkPartitionSimulator) {
+			simulator.ReceiveDropRate = 1
+		},
+		func(connections int) {
+			connectedAt = append(connectedAt, time.Now())
+			if connections == 3 {
+				cancel()
+			}
+		})
+
+	select {
+	case <-ended:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timed out waiting for the session to reconnect")
+	}
+	require.Len(t, connectedAt, 3)
+	for i := 1; i < len(connectedAt); i++ {
+		assert.True(t, connectedAt[i].Sub(connectedAt[i-1]) >= heartbeatTimeout,
+			"Session reconnected before the heartbeat timeout")
+	}
+}
+
+// TestHandlerStaysConnectedWithNetworkDelay tests that the session stays connected
+// when the messages sent by ACS are delayed by less than the heartbeat timeout,
+// and that the acks reach ACS despite the delays
+func TestHandlerStaysConnectedWithNetworkDelay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	closeWS := make(chan bool)
+	server, serverIn, requests, errs, err := startMockAcsServer(t, closeWS)
+	require.NoError(t, err)
+	go func() {
+		for {
+			select {
+			case <-errs:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go sendHeartbeats(ctx, serverIn, 20*time.Millisecond)
+
+	var lock sync.Mutex
+	connections := 0
+	ended := startSimulatedNetworkSession(ctx, cancel, ctrl, server.URL, 200*time.Millisecond,
+		func(simulator *NetworkPartitionSimulator) {
+			simulator.SendDelay = 20 * time.Millisecond
+			simulator.ReceiveDelay = 10 * time.Millisecond
+		},
+		func(n int) {
+			lock.Lock()
+			defer lock.Unlock()
+			connections = n
+		})
+
+	select {
+	case request := <-requests:
+		assert.Contains(t, request, "HeartbeatAckRequest")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the heartbeat ack")
+	}
+	// Heartbeats keep the connection alive for several heartbeat timeouts
+	time.Sleep(time.Second)
+	cancel()
+	<-ended
+
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 1, connections, "Session reconnected despite receiving heartbeats")
+}
+
+// TestHandlerGoroutinesTerminateOnSessionContextCancel tests that cancelling the
+// session context terminates the goroutines of all the handlers, including the
+// ones blocked on enqueueing messages and acks, within a second
+func TestHandlerGoroutinesTerminateOnSessionContextCancel(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	emptyDoctor, _ := doctor.NewDoctor([]doctor.Healthcheck{}, "test-cluster", "this:is:an:instance:arn")
+
+	beforeGoroutines := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	refreshCredsHandler := newRefreshCredentialsHandler(ctx, testConfig.Cluster, "myArn", mockWsClient,
+		rolecredentials.NewManager(), taskEngine, nil)
+	refreshCredsHandler.start()
+	taskManifestHandler := newTaskManifestHandler(ctx, testConfig.Cluster, "myArn", mockWsClient,
+		data.NewNoopClient(), taskEngine, aws.Int64(12), testConfig.ACSManifestHistoryDepth, nil, nil, nil, nil)
+	taskManifestHandler.start()
+	taskDrainHandler := newTaskDrainHandler(ctx, testConfig.Cluster, "myArn", mockWsClient, taskEngine,
+		&taskDrainState{})
+	taskDrainHandler.start()
+	payloadHandler := newPayloadRequestHandler(ctx, payloadRequestHandlerParams{
+		taskEngine:           taskEngine,
+		ecsClient:            ecsClient,
+		cluster:              testConfig.Cluster,
+		containerInstanceArn: "myArn",
+		acsClient:            mockWsClient,
+		dataClient:           data.NewNoopClient(),
+		refreshHandler:       refreshCredsHandler,
+		credentialsManager:   rolecredentials.NewManager(),
+		seqNumTaskManifest:   aws.Int64(12),
+	})
+	payloadHandler.start()
+	heartbeatHandler := newHeartbeatHandler(ctx, mockWsClient, emptyDoctor, nil, nil, nil, nil)
+	heartbeatHandler.start()
+
+	cancel()
+
+	// Enqueueing messages once the session context is cancelled must not block
+	enqueued := make(chan struct{})
+	go func() {
+		payloadHandler.handlerFunc()(&ecsacs.PayloadMessage{})
+		refreshCredsHandler.handlerFunc()(&ecsacs.IAMRoleCredentialsMessage{})
+		heartbeatHandler.handlerFunc()(&ecsacs.HeartbeatMessage{})
+		taskManifestHandler.handlerFuncTaskManifestMessage()(&ecsacs.TaskManifestMessage{})
+		close(enqueued)
+	}()
+
+	select {
+	case <-enqueued:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Enqueueing messages blocked after the session context was cancelled")
+	}
+
+	deadline := time.Now().Add(1 * time.Second)
+	for {
+		afterGoroutines := runtime.NumGoroutine()
+		if afterGoroutines <= beforeGoroutines {
+			break
+		}
+		if time.Now().After(deadline) {
+			pprof.Lookup("goroutine").WriteTo(os.Stdout, 1)
+			t.Fatalf("Handler goroutines did not terminate within a second: %d before, %d after",
+				beforeGoroutines, afterGoroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // TestStartSessionHandlesRefreshCredentialsMessages tests the agent restart
 // scenario where the payload to refresh credentials is processed immediately on
 // connection establishment with ACS
@@ -934,21 +1669,20 @@ func TestStartSessionHandlesRefreshCredentialsMessages(t *testing.T) {
 	latestSeqNumberTaskManifest := int64(10)
 	ended := make(chan bool, 1)
 	go func() {
-		acsSession := NewSession(ctx,
-			testConfig,
-			nil,
-			"myArn",
-			testCreds,
-			dockerClient,
-			ecsClient,
-			dockerstate.NewTaskEngineState(),
-			data.NewNoopClient(),
-			taskEngine,
-			credentialsManager,
-			taskHandler,
-			&latestSeqNumberTaskManifest,
-			emptyDoctor,
-		)
+		acsSession := NewSession(ctx, SessionParams{
+			Config:                   testConfig,
+			ContainerInstanceARN:     "myArn",
+			CredentialsProvider:      testCreds,
+			DockerClient:             dockerClient,
+			ECSClient:                ecsClient,
+			TaskEngineState:          dockerstate.NewTaskEngineState(),
+			DataClient:               data.NewNoopClient(),
+			TaskEngine:               taskEngine,
+			CredentialsManager:       credentialsManager,
+			TaskHandler:              taskHandler,
+			LatestSeqNumTaskManifest: &latestSeqNumberTaskManifest,
+			Doctor:                   emptyDoctor,
+		})
 		acsSession.Start()
 		// StartSession should never return unless the context is canceled
 		ended <- true
@@ -1007,7 +1741,7 @@ func TestStartSessionHandlesRefreshCredentialsMessages(t *testing.T) {
 // TestACSSessionResourcesCorrectlySetsSendCredentials tests if acsSessionResources
 // struct correctly sets 'sendCredentials'
 func TestACSSessionResourcesCorrectlySetsSendCredentials(t *testing.T) {
-	acsResources := newSessionResources(nil)
+	acsResources := newSessionResources(nil, 0, nil)
 	// Validate that 'sendCredentials' is set to true on create
 	sendCredentials := acsResources.getSendCredentialsURLParameter()
 	if sendCredentials != "true" {
@@ -1040,7 +1774,7 @@ func TestHandlerReconnectsCorrectlySetsSendCredentialsURLParameter(t *testing.T)
 	mockWsClient.EXPECT().Serve().Return(io.EOF).AnyTimes()
 
 	dockerClient := mock_dockerapi.NewMockDockerClient(ctrl)
-	resources := newSessionResources(testCreds)
+	resources := newSessionResources(testCreds, 0, nil)
 	gomock.InOrder(
 		// When the websocket client connects to ACS for the first
 		// time, 'sendCredentials' should be set to true
@@ -1173,3 +1907,185 @@ func validateSendCredentialsInSession(t *testing.T, state sessionState, expected
 		t.Errorf("Incorrect value set for sendCredentials, expected: %s, got: %s", expected, sendCredentials)
 	}
 }
+
+func TestStartSessionOnceLogsToInjectedLogger(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return("", fmt.Errorf("oops"))
+
+	buf := &bytes.Buffer{}
+	seeLogger, err := seelog.LoggerFromWriterWithMinLevelAndFormat(buf, seelog.TraceLvl, "%Msg")
+	require.NoError(t, err)
+	acsSession := session{
+		containerInstanceARN: "myArn",
+		ecsClient:            ecsClient,
+		_logger:              logger.NewNilSafeLogger(seeLogger),
+	}
+
+	assert.Error(t, acsSession.startSessionOnce())
+	seeLogger.Flush()
+	assert.Equal(t, "acs: unable to discover poll endpoint, err: oops", buf.String())
+}
+
+func TestNewSessionUsesInjectedLogger(t *testing.T) {
+	seeLogger, err := seelog.LoggerFromWriterWithMinLevelAndFormat(&bytes.Buffer{}, seelog.TraceLvl, "%Msg")
+	require.NoError(t, err)
+	sessionLogger := logger.NewNilSafeLogger(seeLogger)
+	acsSession := NewSession(context.Background(), SessionParams{
+		Config:               testConfig,
+		ContainerInstanceARN: "myArn",
+		Logger:               sessionLogger,
+	}).(*session)
+	assert.Equal(t, sessionLogger, acsSession.logger())
+
+	acsSession = NewSession(context.Background(), SessionParams{Config: testConfig, ContainerInstanceARN: "myArn"}).(*session)
+	assert.NotNil(t, acsSession.logger())
+}
+
+func TestSessionLoggerDefaultsToNilSafeLogger(t *testing.T) {
+	acsSession := session{}
+	assert.NotPanics(t, func() {
+		acsSession.logger().Debugf("no logger was injected")
+	})
+}
+
+// startSkewedNTPServer starts an NTP server whose clock is skewed from the system
+// clock by the duration returned by skew for each request, and returns its address
+func startSkewedNTPServer(t *testing.T, skew func() time.Duration) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		request := make([]byte, 48)
+		for {
+			_, addr, err := conn.ReadFrom(request)
+			if err != nil {
+				return
+			}
+			serverTime := time.Now().Add(skew())
+			timestamp := make([]byte, 8)
+			binary.BigEndian.PutUint32(timestamp[0:4], uint32(serverTime.Unix()+2208988800))
+			response := make([]byte, 48)
+			// No leap indicator, version 4, server mode, stratum 2
+			response[0] = 0x24
+			response[1] = 2
+			copy(response[24:32], request[40:48])
+			copy(response[32:40], timestamp)
+			copy(response[40:48], timestamp)
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// TestStartSessionWarnsOnClockSkew tests that the session warns when the system
+// clock is too far off the time of the NTP server, and still connects to ACS
+func TestStartSessionWarnsOnClockSkew(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ntpSyncCheck := doctor.NewNTPSyncCheck(startSkewedNTPServer(t, func() time.Duration {
+		return 10 * time.Minute
+	}), 2*time.Minute)
+	ntpDoctor, _ := doctor.NewDoctor([]doctor.Healthcheck{ntpSyncCheck}, "test-cluster", "this:is:an:instance:arn")
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Do(func(string) {
+		cancel()
+	}).Return("", errors.New("error"))
+
+	buf := &bytes.Buffer{}
+	seeLogger, err := seelog.LoggerFromWriterWithMinLevelAndFormat(buf, seelog.WarnLvl, "%Msg")
+	require.NoError(t, err)
+	acsSession := &session{
+		containerInstanceARN: "myArn",
+		agentConfig:          testConfig,
+		ecsClient:            ecsClient,
+		backoff:              retry.NewExponentialBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
+		ctx:                  ctx,
+		cancel:               cancel,
+		doctor:               ntpDoctor,
+		_logger:              logger.NewNilSafeLogger(seeLogger),
+	}
+	assert.NoError(t, acsSession.Start())
+	seeLogger.Flush()
+	assert.Equal(t, doctor.HealthcheckStatusImpaired, ntpSyncCheck.GetHealthcheckStatus())
+	assert.Contains(t, buf.String(), "The connections to ACS may fail until the system clock is corrected")
+}
+
+// fakeDNSCacheFlusher counts the flushes, failing them with err
+type fakeDNSCacheFlusher struct {
+	flushes int32
+	err     error
+}
+
+func (flusher *fakeDNSCacheFlusher) Flush() error {
+	atomic.AddInt32(&flusher.flushes, 1)
+	return flusher.err
+}
+
+// TestHandlerFlushesDNSCacheBeforeReconnecting tests that the caches of the OS
+// are flushed before every reconnection to ACS, but not before the first
+// connection, and that failing to flush them doesn't prevent reconnecting
+func TestHandlerFlushesDNSCacheBeforeReconnecting(t *testing.T) {
+	testCases := []struct {
+		name     string
+		flushErr error
+	}{
+		{
+			name: "flush succeeds",
+		},
+		{
+			name:     "flush fails",
+			flushErr: errors.New("permission denied"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+			taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+			ecsClient := mock_api.NewMockECSClient(ctrl)
+			ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(acsURL, nil).AnyTimes()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
+			flusher := &fakeDNSCacheFlusher{err: tc.flushErr}
+
+			mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+			mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
+			mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
+			mockWsClient.EXPECT().Serve().AnyTimes()
+			mockWsClient.EXPECT().Close().Return(nil).AnyTimes()
+			gomock.InOrder(
+				// Connect fails 3 times, each failure being followed by a flush
+				mockWsClient.EXPECT().Connect().Return(io.EOF).Times(3),
+				mockWsClient.EXPECT().Connect().Do(func() {
+					cancel()
+				}).Return(nil).MinTimes(1),
+			)
+			acsSession := session{
+				containerInstanceARN: "myArn",
+				credentialsProvider:  testCreds,
+				agentConfig:          testConfig,
+				taskEngine:           taskEngine,
+				ecsClient:            ecsClient,
+				dataClient:           data.NewNoopClient(),
+				taskHandler:          taskHandler,
+				backoff:              retry.NewExponentialBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
+				ctx:                  ctx,
+				cancel:               cancel,
+				resources:            &mockSessionResources{mockWsClient},
+				dnsFlusher:           flusher,
+				_heartbeatTimeout:    20 * time.Millisecond,
+				_heartbeatJitter:     10 * time.Millisecond,
+			}
+			assert.NoError(t, acsSession.Start())
+			assert.Equal(t, int32(3), atomic.LoadInt32(&flusher.flushes))
+		})
+	}
+}
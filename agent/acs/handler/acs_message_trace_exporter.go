@@ -0,0 +1,227 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/diagnostics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// rotatedTraceFileSuffix is the suffix of the previous trace file, kept
+	// when the trace file is rotated
+	rotatedTraceFileSuffix = ".1"
+	traceFileMode          = 0600
+	bytesPerMB             = 1024 * 1024
+)
+
+// messageTraceHookUser is implemented by websocket clients that can pass the raw
+// messages they exchange with the backend to a hook
+type messageTraceHookUser interface {
+	UseMessageTraceHook(hook wsclient.MessageTraceHookFunc)
+}
+
+// acsMessageTraceRecord is a line of the ACS message trace file
+type acsMessageTraceRecord struct {
+	Timestamp time.Time                 `json:"timestamp"`
+	Direction wsclient.MessageDirection `json:"direction"`
+	Type      string                    `json:"type"`
+	Body      json.RawMessage           `json:"body"`
+}
+
+// ACSMessageTraceExporter writes the raw messages exchanged with ACS to the
+// trace file configured in ACSMessageTraceFile, one JSON record per line, to
+// debug ACS issues in production. The credentials in the messages are redacted.
+// The file is rotated when it reaches ACSMessageTraceMaxSizeMB, and messages
+// stop being written while the free disk space is below
+// ACSMessageTraceMinFreeMB.
+type ACSMessageTraceExporter struct {
+	path    string
+	maxSize int64
+	minFree uint64
+	// freeDiskSpace returns the free disk space in bytes of the file system of
+	// the path
+	freeDiskSpace func(path string) (uint64, error)
+	lock          sync.Mutex
+	file          *os.File
+	size          int64
+	diskSpaceLow  bool
+}
+
+// newACSMessageTraceExporter opens the ACS message trace file. It returns nil
+// when no trace file is configured
+func newACSMessageTraceExporter(cfg *config.Config) (*ACSMessageTraceExporter, error) {
+	if cfg.ACSMessageTraceFile == "" {
+		return nil, nil
+	}
+	exporter := &ACSMessageTraceExporter{
+		path:          cfg.ACSMessageTraceFile,
+		maxSize:       int64(cfg.ACSMessageTraceMaxSizeMB) * bytesPerMB,
+		minFree:       uint64(cfg.ACSMessageTraceMinFreeMB) * bytesPerMB,
+		freeDiskSpace: freeDiskSpace,
+	}
+	if err := exporter.open(); err != nil {
+		return nil, err
+	}
+	return exporter, nil
+}
+
+// use passes the messages exchanged over the connection of the client to the
+// exporter, if the client supports tracing messages
+func (exporter *ACSMessageTraceExporter) use(client wsclient.ClientServer) {
+	if exporter == nil {
+		return
+	}
+	if hookUser, ok := client.(messageTraceHookUser); ok {
+		hookUser.UseMessageTraceHook(exporter.trace)
+	}
+}
+
+// trace writes the message to the trace file. The messages of a batch are
+// written as separate records
+func (exporter *ACSMessageTraceExporter) trace(direction wsclient.MessageDirection, message []byte) {
+	if exporter == nil {
+		return
+	}
+	records := traceRecords(time.Now(), direction, message)
+
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+	if exporter.file == nil {
+		// The exporter was closed
+		return
+	}
+	if !exporter.hasFreeDiskSpace() {
+		return
+	}
+	for _, record := range records {
+		if exporter.size > 0 && exporter.size+int64(len(record)) > exporter.maxSize {
+			if err := exporter.rotate(); err != nil {
+				seelog.Warnf("Unable to rotate the ACS message trace file %s: %v", exporter.path, err)
+				return
+			}
+		}
+		n, err := exporter.file.Write(record)
+		exporter.size += int64(n)
+		if err != nil {
+			seelog.Warnf("Unable to write to the ACS message trace file %s: %v", exporter.path, err)
+			return
+		}
+	}
+}
+
+// close closes the trace file, messages are no longer traced afterwards
+func (exporter *ACSMessageTraceExporter) close() {
+	if exporter == nil {
+		return
+	}
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+	if exporter.file != nil {
+		exporter.file.Close()
+		exporter.file = nil
+	}
+}
+
+// open opens the trace file, appending to it if it exists
+func (exporter *ACSMessageTraceExporter) open() error {
+	file, err := os.OpenFile(exporter.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, traceFileMode)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	exporter.file = file
+	exporter.size = info.Size()
+	return nil
+}
+
+// rotate replaces the previous trace file with the current one and starts a
+// new one
+func (exporter *ACSMessageTraceExporter) rotate() error {
+	exporter.file.Close()
+	exporter.file = nil
+	if err := os.Rename(exporter.path, exporter.path+rotatedTraceFileSuffix); err != nil {
+		return err
+	}
+	return exporter.open()
+}
+
+// hasFreeDiskSpace returns false if the free disk space is below the minimum.
+// Messages are traced when the free disk space can't be determined
+func (exporter *ACSMessageTraceExporter) hasFreeDiskSpace() bool {
+	free, err := exporter.freeDiskSpace(filepath.Dir(exporter.path))
+	if err != nil {
+		return true
+	}
+	low := free < exporter.minFree
+	if low != exporter.diskSpaceLow {
+		if low {
+			seelog.Warnf("Free disk space below %d bytes, pausing the tracing of ACS messages to %s",
+				exporter.minFree, exporter.path)
+		} else {
+			seelog.Infof("Free disk space back above %d bytes, resuming the tracing of ACS messages to %s",
+				exporter.minFree, exporter.path)
+		}
+		exporter.diskSpaceLow = low
+	}
+	return !low
+}
+
+// traceRecords returns the lines of the trace file recording the message, one
+// per message for the JSON arrays of batched messages
+func traceRecords(timestamp time.Time, direction wsclient.MessageDirection, message []byte) [][]byte {
+	messages := []json.RawMessage{message}
+	if trimmed := bytes.TrimSpace(message); len(trimmed) > 0 && trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if json.Unmarshal(trimmed, &batch) == nil {
+			messages = batch
+		}
+	}
+	var records [][]byte
+	for _, message := range messages {
+		body := diagnostics.Redact(message)
+		var typed struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(body, &typed) != nil {
+			// Keep the messages that aren't JSON as strings
+			body, _ = json.Marshal(string(body))
+		}
+		record, err := json.Marshal(acsMessageTraceRecord{
+			Timestamp: timestamp,
+			Direction: direction,
+			Type:      typed.Type,
+			Body:      body,
+		})
+		if err != nil {
+			seelog.Warnf("Unable to encode the trace of an ACS message: %v", err)
+			continue
+		}
+		records = append(records, append(record, '\n'))
+	}
+	return records
+}
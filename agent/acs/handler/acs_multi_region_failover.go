@@ -0,0 +1,263 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	acsclient "github.com/aws/amazon-ecs-agent/agent/acs/client"
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// primaryEndpointDialTimeout is the time allowed to open a TCP connection to
+	// the primary ACS endpoint when checking whether it's reachable again
+	primaryEndpointDialTimeout = 5 * time.Second
+	// acsFailedOverToBackupEvent is recorded every time the session fails over
+	// to the backup ACS endpoint
+	acsFailedOverToBackupEvent = "ACSFailedOverToBackupRegion"
+	// acsRevertedToPrimaryEvent is recorded every time the session reverts to
+	// the primary ACS endpoint
+	acsRevertedToPrimaryEvent = "ACSRevertedToPrimaryRegion"
+)
+
+// dialEndpoint is a variable so that it can be overridden in unit tests
+var dialEndpoint = func(address string) error {
+	conn, err := net.DialTimeout("tcp", address, primaryEndpointDialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// ACSBackupCredentialsProvider provides the credentials the connections to the
+// backup ACS endpoint are authenticated with
+type ACSBackupCredentialsProvider interface {
+	// BackupCredentials returns the credentials for the backup region
+	BackupCredentials(region string) *credentials.Credentials
+}
+
+// instanceBackupCredentialsProvider authenticates the connections to the backup
+// ACS endpoint with the instance credentials. IAM credentials aren't regional,
+// only the region the requests are signed for changes
+type instanceBackupCredentialsProvider struct {
+	credentialsProvider *credentials.Credentials
+}
+
+// NewACSBackupCredentialsProvider returns a new ACSBackupCredentialsProvider
+// providing the instance credentials for the backup region
+func NewACSBackupCredentialsProvider(credentialsProvider *credentials.Credentials) ACSBackupCredentialsProvider {
+	return &instanceBackupCredentialsProvider{credentialsProvider: credentialsProvider}
+}
+
+// BackupCredentials returns the instance credentials
+func (provider *instanceBackupCredentialsProvider) BackupCredentials(region string) *credentials.Credentials {
+	return provider.credentialsProvider
+}
+
+// ACSMultiRegionFailover fails the session over to the ACS endpoint of a backup
+// region once the connections to ACS in the region of the agent keep failing,
+// for clusters spanning regions for disaster recovery. Only the connection to
+// ACS fails over, the calls to the ECS API are still made in the region of the
+// agent. While on the backup endpoint, the primary endpoint is checked every
+// recovery interval and the session reverts to it as soon as it's reachable
+type ACSMultiRegionFailover struct {
+	backupEndpoint   string
+	backupRegion     string
+	threshold        int
+	recoveryInterval time.Duration
+	// backupResources are the resources of the connections to the backup endpoint,
+	// authenticated with the backup credentials
+	backupResources      sessionResources
+	ecsClient            api.ECSClient
+	containerInstanceARN string
+	lock                 sync.Mutex
+	// failures is the number of consecutive failures to connect to the primary endpoint
+	failures int
+	onBackup bool
+	// lastPrimaryCheck is the time the primary endpoint was last checked
+	lastPrimaryCheck time.Time
+}
+
+// newACSMultiRegionFailover returns a new ACSMultiRegionFailover object, or nil
+// if no backup endpoint is configured
+func newACSMultiRegionFailover(cfg *config.Config, backupCredentials ACSBackupCredentialsProvider,
+	certVerification *acsclient.SecureBootVerification, ecsClient api.ECSClient,
+	containerInstanceARN string) *ACSMultiRegionFailover {
+	if cfg.ACSBackupEndpoint == "" || backupCredentials == nil {
+		return nil
+	}
+	threshold := cfg.ACSPrimaryFailoverThreshold
+	if threshold <= 0 {
+		threshold = config.DefaultACSPrimaryFailoverThreshold
+	}
+	recoveryInterval := cfg.ACSPrimaryRecoveryInterval
+	if recoveryInterval <= 0 {
+		recoveryInterval = config.DefaultACSPrimaryRecoveryInterval
+	}
+	return &ACSMultiRegionFailover{
+		backupEndpoint:   cfg.ACSBackupEndpoint,
+		backupRegion:     cfg.ACSBackupRegion,
+		threshold:        threshold,
+		recoveryInterval: recoveryInterval,
+		backupResources: newSessionResources(backupCredentials.BackupCredentials(cfg.ACSBackupRegion),
+			cfg.ACSSessionCacheSize, certVerification),
+		ecsClient:            ecsClient,
+		containerInstanceARN: containerInstanceARN,
+	}
+}
+
+// shouldUseBackup returns true if the session should connect to the backup
+// endpoint. The primary endpoint is checked first if it wasn't for a recovery
+// interval, the session reverts to it if it's reachable
+func (failover *ACSMultiRegionFailover) shouldUseBackup() bool {
+	if failover == nil {
+		return false
+	}
+	failover.lock.Lock()
+	onBackup := failover.onBackup
+	checkDue := time.Since(failover.lastPrimaryCheck) >= failover.recoveryInterval
+	failover.lock.Unlock()
+	if !onBackup {
+		return false
+	}
+	return !checkDue || !failover.checkPrimary()
+}
+
+// isOnBackup returns true if the session is failed over to the backup endpoint
+func (failover *ACSMultiRegionFailover) isOnBackup() bool {
+	if failover == nil {
+		return false
+	}
+	failover.lock.Lock()
+	defer failover.lock.Unlock()
+	return failover.onBackup
+}
+
+// primaryAttempted records an attempt to connect to the primary endpoint. The
+// session fails over to the backup endpoint once the threshold of consecutive
+// failures is reached
+func (failover *ACSMultiRegionFailover) primaryAttempted(connected bool) {
+	if failover == nil {
+		return
+	}
+	failover.lock.Lock()
+	defer failover.lock.Unlock()
+	if connected {
+		failover.failures = 0
+		return
+	}
+	failover.failures++
+	if failover.failures < failover.threshold {
+		return
+	}
+	seelog.Warnf("Failed to connect to ACS %d times in a row, failing over to the backup endpoint %s in region %s",
+		failover.failures, failover.backupEndpoint, failover.backupRegion)
+	failover.failures = 0
+	failover.onBackup = true
+	failover.lastPrimaryCheck = time.Now()
+	metrics.MetricsEngineGlobal.RecordACSEvent(acsFailedOverToBackupEvent, 1)
+}
+
+// checkPrimary checks whether the primary endpoint is reachable, and reverts to
+// it if it is. It returns true if the session reverted to the primary endpoint
+func (failover *ACSMultiRegionFailover) checkPrimary() bool {
+	reachable := failover.primaryReachable()
+	failover.lock.Lock()
+	defer failover.lock.Unlock()
+	failover.lastPrimaryCheck = time.Now()
+	if !reachable || !failover.onBackup {
+		return false
+	}
+	seelog.Infof("The primary ACS endpoint is reachable again, reverting from the backup endpoint %s",
+		failover.backupEndpoint)
+	failover.onBackup = false
+	metrics.MetricsEngineGlobal.RecordACSEvent(acsRevertedToPrimaryEvent, 1)
+	return true
+}
+
+// primaryReachable returns true if the primary endpoint can be discovered and a
+// TCP connection can be opened to it
+func (failover *ACSMultiRegionFailover) primaryReachable() bool {
+	endpoint, err := failover.ecsClient.DiscoverPollEndpoint(failover.containerInstanceARN)
+	if err != nil {
+		seelog.Debugf("Primary ACS endpoint still unreachable, unable to discover it: %v", err)
+		return false
+	}
+	if err := dialEndpoint(endpointAddress(endpoint)); err != nil {
+		seelog.Debugf("Primary ACS endpoint %s still unreachable: %v", endpoint, err)
+		return false
+	}
+	return true
+}
+
+// monitorPrimary checks the primary endpoint every recovery interval while the
+// session is connected to the backup endpoint. It closes recovered once the
+// session reverted to the primary endpoint
+func (failover *ACSMultiRegionFailover) monitorPrimary(ctx context.Context, recovered chan<- struct{}) {
+	ticker := time.NewTicker(failover.recoveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if failover.checkPrimary() {
+				close(recovered)
+				return
+			}
+		}
+	}
+}
+
+// resources returns the resources of the connections to the backup endpoint if
+// the session is failed over, the primary resources otherwise
+func (failover *ACSMultiRegionFailover) resources(primary sessionResources) sessionResources {
+	if !failover.isOnBackup() {
+		return primary
+	}
+	return failover.backupResources
+}
+
+// clientConfig returns the config the ACS client is created with, the requests
+// are signed for the backup region if the session is failed over
+func (failover *ACSMultiRegionFailover) clientConfig(cfg *config.Config) *config.Config {
+	if !failover.isOnBackup() {
+		return cfg
+	}
+	backupCfg := *cfg
+	backupCfg.AWSRegion = failover.backupRegion
+	return &backupCfg
+}
+
+// endpointAddress returns the host:port address of the endpoint URL, on the
+// HTTPS port unless the URL has one
+func endpointAddress(endpoint string) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Hostname() == "" {
+		return net.JoinHostPort(endpoint, "443")
+	}
+	if port := parsed.Port(); port != "" {
+		return parsed.Host
+	}
+	return net.JoinHostPort(parsed.Hostname(), "443")
+}
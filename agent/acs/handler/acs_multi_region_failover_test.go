@@ -0,0 +1,241 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	mock_api "github.com/aws/amazon-ecs-agent/agent/api/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	mock_retry "github.com/aws/amazon-ecs-agent/agent/utils/retry/mock"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBackupEndpoint = "https://ecs-a-1.us-east-1.amazonaws.com"
+	testBackupRegion   = "us-east-1"
+)
+
+// regionRecordingSessionResources records the URLs of the ACS clients it
+// creates, and the regions their requests are signed for
+type regionRecordingSessionResources struct {
+	urlRecordingSessionResources
+	regions []string
+}
+
+func (m *regionRecordingSessionResources) createACSClient(url string, cfg *config.Config) wsclient.ClientServer {
+	m.lock.Lock()
+	m.regions = append(m.regions, cfg.AWSRegion)
+	m.lock.Unlock()
+	return m.urlRecordingSessionResources.createACSClient(url, cfg)
+}
+
+// setDialEndpoint overrides the dialing of the primary endpoint for the test
+func setDialEndpoint(dial func(address string) error) func() {
+	original := dialEndpoint
+	dialEndpoint = dial
+	return func() {
+		dialEndpoint = original
+	}
+}
+
+func newTestFailover(ecsClient *mock_api.MockECSClient, threshold int,
+	recoveryInterval time.Duration) *ACSMultiRegionFailover {
+	return newACSMultiRegionFailover(&config.Config{
+		ACSBackupEndpoint:           testBackupEndpoint,
+		ACSBackupRegion:             testBackupRegion,
+		ACSPrimaryFailoverThreshold: threshold,
+		ACSPrimaryRecoveryInterval:  recoveryInterval,
+	}, NewACSBackupCredentialsProvider(testCreds), nil, ecsClient, "myArn")
+}
+
+func TestNewACSMultiRegionFailoverDisabled(t *testing.T) {
+	assert.Nil(t, newACSMultiRegionFailover(&config.Config{}, NewACSBackupCredentialsProvider(testCreds),
+		nil, nil, "myArn"))
+
+	failover := newACSMultiRegionFailover(&config.Config{ACSBackupEndpoint: testBackupEndpoint},
+		NewACSBackupCredentialsProvider(testCreds), nil, nil, "myArn")
+	require.NotNil(t, failover)
+	assert.Equal(t, config.DefaultACSPrimaryFailoverThreshold, failover.threshold)
+	assert.Equal(t, config.DefaultACSPrimaryRecoveryInterval, failover.recoveryInterval)
+
+	var nilFailover *ACSMultiRegionFailover
+	assert.False(t, nilFailover.shouldUseBackup())
+	nilFailover.primaryAttempted(false)
+	assert.Equal(t, testConfig, nilFailover.clientConfig(testConfig))
+}
+
+func TestACSMultiRegionFailoverTrigger(t *testing.T) {
+	failover := newTestFailover(nil, 3, time.Minute)
+
+	failover.primaryAttempted(false)
+	failover.primaryAttempted(false)
+	failover.primaryAttempted(true)
+	failover.primaryAttempted(false)
+	failover.primaryAttempted(false)
+	assert.False(t, failover.shouldUseBackup(), "a connection should reset the consecutive failures")
+
+	failover.primaryAttempted(false)
+	assert.True(t, failover.shouldUseBackup())
+	assert.Equal(t, failover.backupResources, failover.resources(&mockSessionResources{}))
+	backupCfg := failover.clientConfig(&config.Config{AWSRegion: "us-west-2", Cluster: "someCluster"})
+	assert.Equal(t, testBackupRegion, backupCfg.AWSRegion)
+	assert.Equal(t, "someCluster", backupCfg.Cluster)
+}
+
+// TestHandlerFailsOverToBackupEndpoint tests if the session handler connects to
+// the backup endpoint, with requests signed for the backup region, after failing
+// to connect to the primary endpoint too many times in a row
+func TestHandlerFailsOverToBackupEndpoint(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return("https://ecs-a-1.us-west-2.amazonaws.com", nil).Times(2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("DeregisterContainerInstance", ctx)
+	deregisterInstanceEventStream.StartListening()
+
+	mockBackoff := mock_retry.NewMockBackoff(ctrl)
+	mockBackoff.EXPECT().Duration().Return(time.Millisecond).AnyTimes()
+	mockBackoff.EXPECT().Reset().AnyTimes()
+	primaryClient := mock_wsclient.NewMockClientServer(ctrl)
+	primaryClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
+	primaryClient.EXPECT().Close().Return(nil).AnyTimes()
+	primaryClient.EXPECT().Connect().Return(fmt.Errorf("connection refused")).Times(2)
+	backupClient := mock_wsclient.NewMockClientServer(ctrl)
+	backupClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
+	backupClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
+	backupClient.EXPECT().Close().Return(nil).AnyTimes()
+	backupClient.EXPECT().Connect().Do(func() {
+		cancel()
+	}).Return(io.EOF)
+
+	failover := newTestFailover(ecsClient, 2, time.Minute)
+	backupResources := &regionRecordingSessionResources{
+		urlRecordingSessionResources: urlRecordingSessionResources{mockSessionResources: mockSessionResources{backupClient}},
+	}
+	failover.backupResources = backupResources
+	primaryResources := &regionRecordingSessionResources{
+		urlRecordingSessionResources: urlRecordingSessionResources{mockSessionResources: mockSessionResources{primaryClient}},
+	}
+	acsSession := session{
+		containerInstanceARN:          "myArn",
+		credentialsProvider:           testCreds,
+		agentConfig:                   &config.Config{Cluster: "someCluster", AWSRegion: "us-west-2"},
+		taskEngine:                    taskEngine,
+		ecsClient:                     ecsClient,
+		deregisterInstanceEventStream: deregisterInstanceEventStream,
+		dataClient:                    data.NewNoopClient(),
+		taskHandler:                   taskHandler,
+		backoff:                       mockBackoff,
+		ctx:                           ctx,
+		cancel:                        cancel,
+		resources:                     primaryResources,
+		failover:                      failover,
+		_heartbeatTimeout:             20 * time.Millisecond,
+		_heartbeatJitter:              10 * time.Millisecond,
+	}
+	acsSession.Start()
+
+	assert.Equal(t, []string{"ecs-a-1.us-west-2.amazonaws.com", "ecs-a-1.us-west-2.amazonaws.com"}, primaryResources.hosts())
+	assert.Equal(t, []string{"us-west-2", "us-west-2"}, primaryResources.regions)
+	assert.Equal(t, []string{"ecs-a-1.us-east-1.amazonaws.com"}, backupResources.hosts())
+	assert.Equal(t, []string{testBackupRegion}, backupResources.regions)
+}
+
+func TestACSMultiRegionFailoverPrimaryRecovery(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ecsClient.EXPECT().DiscoverPollEndpoint("myArn").Return("https://ecs-a-1.us-west-2.amazonaws.com", nil).AnyTimes()
+	var dialed []string
+	reachable := false
+	defer setDialEndpoint(func(address string) error {
+		dialed = append(dialed, address)
+		if !reachable {
+			return errors.New("i/o timeout")
+		}
+		return nil
+	})()
+
+	failover := newTestFailover(ecsClient, 1, time.Minute)
+	failover.primaryAttempted(false)
+	assert.True(t, failover.shouldUseBackup())
+	assert.Empty(t, dialed, "the primary endpoint shouldn't be checked before the recovery interval")
+
+	failover.lastPrimaryCheck = time.Now().Add(-time.Minute)
+	assert.True(t, failover.shouldUseBackup(), "the session shouldn't revert while the primary endpoint is unreachable")
+	assert.Equal(t, []string{"ecs-a-1.us-west-2.amazonaws.com:443"}, dialed)
+
+	reachable = true
+	assert.True(t, failover.shouldUseBackup())
+	failover.lastPrimaryCheck = time.Now().Add(-time.Minute)
+	assert.False(t, failover.shouldUseBackup())
+	assert.False(t, failover.isOnBackup())
+	assert.Equal(t, testConfig, failover.clientConfig(testConfig))
+}
+
+func TestACSMultiRegionFailoverPrimaryRecoveryWhileConnected(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	gomock.InOrder(
+		ecsClient.EXPECT().DiscoverPollEndpoint("myArn").Return("", errors.New("unreachable")),
+		ecsClient.EXPECT().DiscoverPollEndpoint("myArn").Return("https://ecs-a-1.us-west-2.amazonaws.com", nil),
+	)
+	defer setDialEndpoint(func(address string) error {
+		return nil
+	})()
+
+	failover := newTestFailover(ecsClient, 1, 10*time.Millisecond)
+	failover.primaryAttempted(false)
+	recovered := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go failover.monitorPrimary(ctx, recovered)
+
+	select {
+	case <-recovered:
+	case <-ctx.Done():
+		t.Fatal("the session didn't revert to the reachable primary endpoint")
+	}
+	assert.False(t, failover.isOnBackup())
+}
+
+func TestEndpointAddress(t *testing.T) {
+	assert.Equal(t, "ecs-a-1.us-west-2.amazonaws.com:443", endpointAddress("https://ecs-a-1.us-west-2.amazonaws.com"))
+	assert.Equal(t, "ecs-a-1.us-west-2.amazonaws.com:8443", endpointAddress("https://ecs-a-1.us-west-2.amazonaws.com:8443/"))
+	assert.Equal(t, "10.0.0.1:443", endpointAddress("10.0.0.1"))
+}
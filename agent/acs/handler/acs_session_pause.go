@@ -0,0 +1,113 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// acsSessionPausedEvent is recorded every time the processing of the
+	// payload messages is paused
+	acsSessionPausedEvent = "ACSSessionPaused"
+	// acsSessionResumedEvent is recorded every time the processing of the
+	// payload messages is resumed
+	acsSessionResumedEvent = "ACSSessionResumed"
+)
+
+// ACSSessionPauseResume pauses and resumes the processing of the payload
+// messages received from ACS, so that operators can debug the agent live
+// without new tasks being started. While paused, the connection to ACS stays
+// open and the other messages, heartbeats included, are still handled. It
+// outlives the connections so that a pause holds across reconnects, and so that
+// it can be handed over to the introspection server when the agent starts
+type ACSSessionPauseResume struct {
+	lock   sync.Mutex
+	paused bool
+	// resumed is closed while the processing isn't paused
+	resumed chan struct{}
+}
+
+// NewACSSessionPauseResume returns a new ACSSessionPauseResume object, with the
+// processing of the payload messages not paused
+func NewACSSessionPauseResume() *ACSSessionPauseResume {
+	resumed := make(chan struct{})
+	close(resumed)
+	return &ACSSessionPauseResume{resumed: resumed}
+}
+
+// Pause pauses the processing of the payload messages. It does nothing if the
+// processing is already paused
+func (pauseResume *ACSSessionPauseResume) Pause() {
+	if pauseResume == nil {
+		return
+	}
+	pauseResume.lock.Lock()
+	defer pauseResume.lock.Unlock()
+	if pauseResume.paused {
+		return
+	}
+	pauseResume.paused = true
+	pauseResume.resumed = make(chan struct{})
+	seelog.Info("Pausing the processing of the ACS payload messages, no new task is started until resumed")
+	metrics.MetricsEngineGlobal.RecordACSEvent(acsSessionPausedEvent, 1)
+}
+
+// Resume resumes the processing of the payload messages. It does nothing if the
+// processing isn't paused
+func (pauseResume *ACSSessionPauseResume) Resume() {
+	if pauseResume == nil {
+		return
+	}
+	pauseResume.lock.Lock()
+	defer pauseResume.lock.Unlock()
+	if !pauseResume.paused {
+		return
+	}
+	pauseResume.paused = false
+	close(pauseResume.resumed)
+	seelog.Info("Resuming the processing of the ACS payload messages")
+	metrics.MetricsEngineGlobal.RecordACSEvent(acsSessionResumedEvent, 1)
+}
+
+// IsPaused returns true if the processing of the payload messages is paused
+func (pauseResume *ACSSessionPauseResume) IsPaused() bool {
+	if pauseResume == nil {
+		return false
+	}
+	pauseResume.lock.Lock()
+	defer pauseResume.lock.Unlock()
+	return pauseResume.paused
+}
+
+// wait waits for the processing of the payload messages to be resumed if it's
+// paused. It returns false if the context is done first
+func (pauseResume *ACSSessionPauseResume) wait(ctx context.Context) bool {
+	if pauseResume == nil {
+		return true
+	}
+	pauseResume.lock.Lock()
+	resumed := pauseResume.resumed
+	pauseResume.lock.Unlock()
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,120 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACSSessionPauseResume(t *testing.T) {
+	var notConfigured *ACSSessionPauseResume
+	notConfigured.Pause()
+	assert.False(t, notConfigured.IsPaused())
+	assert.True(t, notConfigured.wait(context.Background()))
+
+	pauseResume := NewACSSessionPauseResume()
+	assert.False(t, pauseResume.IsPaused())
+	assert.True(t, pauseResume.wait(context.Background()))
+
+	pauseResume.Pause()
+	pauseResume.Pause()
+	assert.True(t, pauseResume.IsPaused())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, pauseResume.wait(ctx), "wait should return when the context is done")
+
+	resumed := make(chan bool)
+	go func() {
+		resumed <- pauseResume.wait(context.Background())
+	}()
+	select {
+	case <-resumed:
+		t.Fatal("wait shouldn't return before the processing is resumed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	pauseResume.Resume()
+	pauseResume.Resume()
+	assert.True(t, <-resumed)
+	assert.False(t, pauseResume.IsPaused())
+}
+
+func TestPayloadHandlerHoldsMessagesWhilePaused(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	pauseResume := NewACSSessionPauseResume()
+	pauseResume.Pause()
+	tester.payloadHandler.pauseResume = pauseResume
+
+	taskAdded := make(chan struct{})
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(func(*apitask.Task) {
+		close(taskAdded)
+	})
+	tester.mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(interface{}) {
+		tester.cancel()
+	})
+
+	go tester.payloadHandler.start()
+	tester.payloadHandler.handlerFunc()(&ecsacs.PayloadMessage{
+		Tasks:     []*ecsacs.Task{{Arn: aws.String("t1")}},
+		MessageId: aws.String(payloadMessageId),
+	})
+	select {
+	case <-taskAdded:
+		t.Fatal("the task shouldn't be added while the processing is paused")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Len(t, tester.payloadHandler.ListInFlightAcks(), 1)
+
+	pauseResume.Resume()
+	<-taskAdded
+	<-tester.ctx.Done()
+}
+
+func TestPayloadHandlerDropsMessagesWhenPausedAndFull(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	pauseResume := NewACSSessionPauseResume()
+	pauseResume.Pause()
+	tester.payloadHandler.pauseResume = pauseResume
+	tester.payloadHandler.messageBuffer = newAdaptivePayloadBuffer(1, 1)
+
+	handled := make(chan struct{})
+	go func() {
+		tester.payloadHandler.handlerFunc()(&ecsacs.PayloadMessage{MessageId: aws.String("buffered")})
+		tester.payloadHandler.handlerFunc()(&ecsacs.PayloadMessage{MessageId: aws.String("dropped")})
+		close(handled)
+	}()
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("handling a message shouldn't block while the processing is paused")
+	}
+
+	assert.Equal(t, 1, tester.payloadHandler.messageBuffer.size())
+	acks := tester.payloadHandler.ListInFlightAcks()
+	if assert.Len(t, acks, 1) {
+		assert.Equal(t, "buffered", acks[0].MessageID)
+	}
+}
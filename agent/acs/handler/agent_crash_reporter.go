@@ -0,0 +1,213 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/sighandlers/exitcodes"
+	"github.com/aws/amazon-ecs-agent/agent/version"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+	"github.com/pborman/uuid"
+)
+
+const (
+	// crashMarkerFileName is the name of the file, in the data directory,
+	// describing the abnormal exit of the previous run of the agent
+	crashMarkerFileName = "agent_crash_marker.json"
+	// crashGoroutineDumpFileName is the name of the file, in the data directory,
+	// holding the stacks of the goroutines of the agent when it exited abnormally
+	crashGoroutineDumpFileName = "agent_crash_goroutines.txt"
+	// panicExitCode is the exit code of a go program that panics
+	panicExitCode = 2
+	// maxGoroutineDumpSize is the maximum size of the goroutine dump
+	maxGoroutineDumpSize = 8 * 1024 * 1024
+)
+
+// AgentCrashReport describes an abnormal exit of the agent
+type AgentCrashReport struct {
+	ExitCode          int       `json:"exitCode"`
+	LastError         string    `json:"lastError,omitempty"`
+	GoroutineDumpPath string    `json:"goroutineDumpPath,omitempty"`
+	CrashedAt         time.Time `json:"crashedAt"`
+	AgentVersion      string    `json:"agentVersion"`
+}
+
+// AgentCrashReporter lets ACS know why the previous run of the agent exited
+// abnormally. When the agent exits with an error or panics in its main
+// goroutine, a crash marker is written to the data directory, along with a dump
+// of the goroutines. On the next start, the crash is reported to ACS once
+// connected, and the marker is deleted. Panics in other goroutines terminate
+// the process without running the deferred functions, so they aren't reported
+type AgentCrashReporter struct {
+	dataDir string
+	lock    sync.Mutex
+	// previousCrash is the crash of the previous run not reported yet, nil if none
+	previousCrash *AgentCrashReport
+	lastError     error
+}
+
+// NewAgentCrashReporter returns a new AgentCrashReporter object, loading the
+// crash marker of the previous run from the data directory if there's any
+func NewAgentCrashReporter(dataDir string) *AgentCrashReporter {
+	reporter := &AgentCrashReporter{
+		dataDir: dataDir,
+	}
+	data, err := ioutil.ReadFile(reporter.markerPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			seelog.Warnf("Unable to read the agent crash marker: %v", err)
+		}
+		return reporter
+	}
+	crash := &AgentCrashReport{}
+	if err := json.Unmarshal(data, crash); err != nil {
+		seelog.Warnf("Discarding the invalid agent crash marker: %v", err)
+		reporter.deleteMarker()
+		return reporter
+	}
+	seelog.Warnf("The previous run of the agent exited abnormally at %s with exit code %d: %s",
+		crash.CrashedAt.String(), crash.ExitCode, crash.LastError)
+	reporter.previousCrash = crash
+	return reporter
+}
+
+// RecordError records the error making the agent exit, to be reported if the
+// agent exits abnormally
+func (reporter *AgentCrashReporter) RecordError(err error) {
+	if reporter == nil {
+		return
+	}
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+	reporter.lastError = err
+}
+
+// RecordExit writes the crash marker if the agent exits abnormally, i.e. with
+// an exit code other than success or update, or panics. It must be deferred by
+// the function returning the exit code of the agent, panics are propagated
+func (reporter *AgentCrashReporter) RecordExit(exitCode *int) {
+	recovered := recover()
+	if reporter == nil || (recovered == nil && !isAbnormalExit(*exitCode)) {
+		if recovered != nil {
+			panic(recovered)
+		}
+		return
+	}
+
+	reporter.lock.Lock()
+	crash := AgentCrashReport{
+		ExitCode:     *exitCode,
+		CrashedAt:    time.Now(),
+		AgentVersion: version.Version,
+	}
+	if reporter.lastError != nil {
+		crash.LastError = reporter.lastError.Error()
+	}
+	reporter.lock.Unlock()
+	if recovered != nil {
+		crash.ExitCode = panicExitCode
+		crash.LastError = fmt.Sprintf("panic: %v", recovered)
+	}
+	crash.GoroutineDumpPath = reporter.dumpGoroutines()
+	if err := reporter.writeMarker(crash); err != nil {
+		seelog.Errorf("Unable to write the agent crash marker: %v", err)
+	}
+	seelog.Flush()
+	if recovered != nil {
+		panic(recovered)
+	}
+}
+
+// report sends the crash report of the previous run to ACS, and deletes the
+// crash marker once it's sent. It's sent again on the next connection if it
+// can't be sent
+func (reporter *AgentCrashReporter) report(client wsclient.ClientServer, cluster, containerInstanceARN string) {
+	if reporter == nil {
+		return
+	}
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+	crash := reporter.previousCrash
+	if crash == nil {
+		return
+	}
+	err := client.MakeRequest(&ecsacs.AgentCrashReportMessage{
+		Cluster:           aws.String(cluster),
+		ContainerInstance: aws.String(containerInstanceARN),
+		MessageId:         aws.String(uuid.New()),
+		AgentVersion:      aws.String(crash.AgentVersion),
+		ExitCode:          aws.Int64(int64(crash.ExitCode)),
+		LastError:         aws.String(crash.LastError),
+		GoroutineDumpPath: aws.String(crash.GoroutineDumpPath),
+		CrashedAt:         aws.Int64(crash.CrashedAt.UnixNano() / int64(time.Millisecond)),
+	})
+	if err != nil {
+		seelog.Warnf("Unable to report the crash of the previous run of the agent to ACS: %v", err)
+		return
+	}
+	seelog.Info("Reported the crash of the previous run of the agent to ACS")
+	reporter.previousCrash = nil
+	reporter.deleteMarker()
+}
+
+// dumpGoroutines writes the stacks of all the goroutines to the dump file, and
+// returns its path, or an empty string if it can't be written
+func (reporter *AgentCrashReporter) dumpGoroutines() string {
+	buf := make([]byte, maxGoroutineDumpSize)
+	buf = buf[:runtime.Stack(buf, true)]
+	dumpPath := filepath.Join(reporter.dataDir, crashGoroutineDumpFileName)
+	if err := ioutil.WriteFile(dumpPath, buf, 0644); err != nil {
+		seelog.Errorf("Unable to write the goroutine dump of the agent crash: %v", err)
+		return ""
+	}
+	return dumpPath
+}
+
+// writeMarker writes the crash marker
+func (reporter *AgentCrashReporter) writeMarker(crash AgentCrashReport) error {
+	data, err := json.Marshal(crash)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(reporter.markerPath(), data, 0644)
+}
+
+// deleteMarker deletes the crash marker
+func (reporter *AgentCrashReporter) deleteMarker() {
+	if err := os.Remove(reporter.markerPath()); err != nil && !os.IsNotExist(err) {
+		seelog.Warnf("Unable to delete the agent crash marker: %v", err)
+	}
+}
+
+// markerPath returns the path of the crash marker
+func (reporter *AgentCrashReporter) markerPath() string {
+	return filepath.Join(reporter.dataDir, crashMarkerFileName)
+}
+
+// isAbnormalExit returns true if the exit code isn't a successful exit, or an
+// exit to be restarted with an updated agent
+func isAbnormalExit(exitCode int) bool {
+	return exitCode != exitcodes.ExitSuccess && exitCode != exitcodes.ExitUpdate
+}
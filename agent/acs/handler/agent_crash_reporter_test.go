@@ -0,0 +1,170 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/sighandlers/exitcodes"
+	"github.com/aws/amazon-ecs-agent/agent/version"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCrashReporterDataDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "agent_crash_reporter_test")
+	require.NoError(t, err)
+	return dir, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+// runAgent runs the agent function the way the agent's start does, returning
+// the value of its panic if it panics
+func runAgent(reporter *AgentCrashReporter, agent func() int) (recovered interface{}) {
+	defer func() {
+		recovered = recover()
+	}()
+	func() (exitCode int) {
+		defer reporter.RecordExit(&exitCode)
+		return agent()
+	}()
+	return nil
+}
+
+func TestAgentCrashReporterWithoutCrash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dataDir, cleanup := newCrashReporterDataDir(t)
+	defer cleanup()
+
+	for _, exitCode := range []int{exitcodes.ExitSuccess, exitcodes.ExitUpdate} {
+		runAgent(NewAgentCrashReporter(dataDir), func() int { return exitCode })
+	}
+	_, err := os.Stat(filepath.Join(dataDir, crashMarkerFileName))
+	assert.True(t, os.IsNotExist(err), "no crash marker should be written")
+
+	// No report is sent to ACS
+	reporter := NewAgentCrashReporter(dataDir)
+	assert.Nil(t, reporter.previousCrash)
+	reporter.report(mock_wsclient.NewMockClientServer(ctrl), "cluster", "myArn")
+}
+
+func TestAgentCrashReporterReportsAbnormalExit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dataDir, cleanup := newCrashReporterDataDir(t)
+	defer cleanup()
+
+	reporter := NewAgentCrashReporter(dataDir)
+	assert.Nil(t, runAgent(reporter, func() int {
+		reporter.RecordError(errors.New("unretriable ACS error"))
+		return exitcodes.ExitTerminal
+	}))
+
+	reporter = NewAgentCrashReporter(dataDir)
+	require.NotNil(t, reporter.previousCrash)
+	dumpPath := filepath.Join(dataDir, crashGoroutineDumpFileName)
+	dump, err := ioutil.ReadFile(dumpPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(dump), "TestAgentCrashReporterReportsAbnormalExit")
+
+	client := mock_wsclient.NewMockClientServer(ctrl)
+	client.EXPECT().MakeRequest(gomock.Any()).Do(func(message interface{}) {
+		report, ok := message.(*ecsacs.AgentCrashReportMessage)
+		require.True(t, ok, "Expected a crash report")
+		assert.Equal(t, "cluster", aws.StringValue(report.Cluster))
+		assert.Equal(t, "myArn", aws.StringValue(report.ContainerInstance))
+		assert.NotEmpty(t, aws.StringValue(report.MessageId))
+		assert.Equal(t, version.Version, aws.StringValue(report.AgentVersion))
+		assert.Equal(t, int64(exitcodes.ExitTerminal), aws.Int64Value(report.ExitCode))
+		assert.Equal(t, "unretriable ACS error", aws.StringValue(report.LastError))
+		assert.Equal(t, dumpPath, aws.StringValue(report.GoroutineDumpPath))
+		assert.NotZero(t, aws.Int64Value(report.CrashedAt))
+	}).Return(nil).Times(1)
+	reporter.report(client, "cluster", "myArn")
+	// The crash is only reported once
+	reporter.report(client, "cluster", "myArn")
+
+	_, err = os.Stat(filepath.Join(dataDir, crashMarkerFileName))
+	assert.True(t, os.IsNotExist(err), "the crash marker should be deleted once reported")
+	assert.Nil(t, NewAgentCrashReporter(dataDir).previousCrash)
+}
+
+func TestAgentCrashReporterRecordsPanic(t *testing.T) {
+	dataDir, cleanup := newCrashReporterDataDir(t)
+	defer cleanup()
+
+	recovered := runAgent(NewAgentCrashReporter(dataDir), func() int {
+		panic("boom")
+	})
+	assert.Equal(t, "boom", recovered, "the panic should be propagated")
+
+	crash := NewAgentCrashReporter(dataDir).previousCrash
+	require.NotNil(t, crash)
+	assert.Equal(t, panicExitCode, crash.ExitCode)
+	assert.Equal(t, "panic: boom", crash.LastError)
+}
+
+func TestAgentCrashReporterKeepsMarkerWhenReportFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dataDir, cleanup := newCrashReporterDataDir(t)
+	defer cleanup()
+
+	runAgent(NewAgentCrashReporter(dataDir), func() int { return exitcodes.ExitError })
+	reporter := NewAgentCrashReporter(dataDir)
+
+	client := mock_wsclient.NewMockClientServer(ctrl)
+	gomock.InOrder(
+		client.EXPECT().MakeRequest(gomock.Any()).Return(errors.New("connection closed")),
+		client.EXPECT().MakeRequest(gomock.Any()).Return(nil),
+	)
+	reporter.report(client, "cluster", "myArn")
+	assert.NotNil(t, NewAgentCrashReporter(dataDir).previousCrash, "the crash marker should be kept")
+
+	// It's reported on the next connection
+	reporter.report(client, "cluster", "myArn")
+	assert.Nil(t, NewAgentCrashReporter(dataDir).previousCrash)
+}
+
+func TestAgentCrashReporterDiscardsInvalidMarker(t *testing.T) {
+	dataDir, cleanup := newCrashReporterDataDir(t)
+	defer cleanup()
+	markerPath := filepath.Join(dataDir, crashMarkerFileName)
+	require.NoError(t, ioutil.WriteFile(markerPath, []byte("not json"), 0644))
+
+	assert.Nil(t, NewAgentCrashReporter(dataDir).previousCrash)
+	_, err := os.Stat(markerPath)
+	assert.True(t, os.IsNotExist(err), "the invalid crash marker should be deleted")
+}
+
+func TestNilAgentCrashReporter(t *testing.T) {
+	var reporter *AgentCrashReporter
+	reporter.RecordError(errors.New("error"))
+	reporter.report(nil, "cluster", "myArn")
+	assert.Nil(t, runAgent(reporter, func() int { return exitcodes.ExitError }))
+	assert.Equal(t, "boom", runAgent(reporter, func() int { panic("boom") }))
+}
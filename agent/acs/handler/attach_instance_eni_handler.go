@@ -39,6 +39,11 @@ type attachInstanceENIHandler struct {
 	acsClient         wsclient.ClientServer
 	state             dockerstate.TaskEngineState
 	dataClient        data.Client
+	*inFlightAckTracker
+	routines *handlerRoutines
+	// goroutines limits the goroutines started by the handler, nil if they
+	// aren't limited
+	goroutines *HandlerGoroutineLimiter
 }
 
 // newAttachInstanceENIHandler returns an instance of the attachInstanceENIHandler struct
@@ -47,31 +52,40 @@ func newAttachInstanceENIHandler(ctx context.Context,
 	containerInstanceArn string,
 	acsClient wsclient.ClientServer,
 	taskEngineState dockerstate.TaskEngineState,
-	dataClient data.Client) attachInstanceENIHandler {
+	dataClient data.Client,
+	goroutines *HandlerGoroutineLimiter) attachInstanceENIHandler {
 	// Create a cancelable context from the parent context
 	derivedContext, cancel := context.WithCancel(ctx)
 	return attachInstanceENIHandler{
-		messageBuffer:     make(chan *ecsacs.AttachInstanceNetworkInterfacesMessage),
-		ctx:               derivedContext,
-		cancel:            cancel,
-		cluster:           aws.String(cluster),
-		containerInstance: aws.String(containerInstanceArn),
-		acsClient:         acsClient,
-		state:             taskEngineState,
-		dataClient:        dataClient,
+		messageBuffer:      make(chan *ecsacs.AttachInstanceNetworkInterfacesMessage),
+		ctx:                derivedContext,
+		cancel:             cancel,
+		cluster:            aws.String(cluster),
+		containerInstance:  aws.String(containerInstanceArn),
+		acsClient:          acsClient,
+		state:              taskEngineState,
+		dataClient:         dataClient,
+		inFlightAckTracker: newInFlightAckTracker(),
+		routines:           &handlerRoutines{},
+		goroutines:         goroutines,
 	}
 }
 
 // handlerFunc returns a function to enqueue requests onto attachENIHandler buffer
 func (handler *attachInstanceENIHandler) handlerFunc() func(message *ecsacs.AttachInstanceNetworkInterfacesMessage) {
 	return func(message *ecsacs.AttachInstanceNetworkInterfacesMessage) {
-		handler.messageBuffer <- message
+		handler.trackReceived("AttachInstanceNetworkInterfacesMessage", aws.StringValue(message.MessageId))
+		select {
+		case handler.messageBuffer <- message:
+		case <-handler.ctx.Done():
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
 	}
 }
 
 // start invokes handleMessages to ack each enqueued request
 func (handler *attachInstanceENIHandler) start() {
-	go handler.handleMessages()
+	handler.routines.run(handler.handleMessages)
 }
 
 // stop is used to invoke a cancellation function
@@ -79,6 +93,11 @@ func (handler *attachInstanceENIHandler) stop() {
 	handler.cancel()
 }
 
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (handler *attachInstanceENIHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, handler.stop, handler.routines, nil)
+}
+
 // handleMessages handles each message one at a time
 func (handler *attachInstanceENIHandler) handleMessages() {
 	for {
@@ -89,6 +108,7 @@ func (handler *attachInstanceENIHandler) handleMessages() {
 			if err := handler.handleSingleMessage(message); err != nil {
 				seelog.Warnf("Unable to handle instance ENI Attachment message [%s]: %v", message.String(), err)
 			}
+			handler.trackAcked(aws.StringValue(message.MessageId))
 		}
 	}
 }
@@ -103,7 +123,9 @@ func (handler *attachInstanceENIHandler) handleSingleMessage(message *ecsacs.Att
 	}
 
 	// Send ACK
-	go sendAck(handler.acsClient, message.ClusterArn, message.ContainerInstanceArn, message.MessageId)
+	handler.goroutines.spawn(attachInstanceNetworkInterfacesMessageType, func() {
+		sendAck(handler.acsClient, message.ClusterArn, message.ContainerInstanceArn, message.MessageId)
+	})
 
 	// Handle the attachment
 	attachmentARN := aws.StringValue(message.ElasticNetworkInterfaces[0].AttachmentArn)
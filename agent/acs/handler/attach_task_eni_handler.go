@@ -39,6 +39,11 @@ type attachTaskENIHandler struct {
 	acsClient         wsclient.ClientServer
 	state             dockerstate.TaskEngineState
 	dataClient        data.Client
+	*inFlightAckTracker
+	routines *handlerRoutines
+	// goroutines limits the goroutines started by the handler, nil if they
+	// aren't limited
+	goroutines *HandlerGoroutineLimiter
 }
 
 // newAttachTaskENIHandler returns an instance of the attachENIHandler struct
@@ -47,32 +52,41 @@ func newAttachTaskENIHandler(ctx context.Context,
 	containerInstanceArn string,
 	acsClient wsclient.ClientServer,
 	taskEngineState dockerstate.TaskEngineState,
-	dataClient data.Client) attachTaskENIHandler {
+	dataClient data.Client,
+	goroutines *HandlerGoroutineLimiter) attachTaskENIHandler {
 
 	// Create a cancelable context from the parent context
 	derivedContext, cancel := context.WithCancel(ctx)
 	return attachTaskENIHandler{
-		messageBuffer:     make(chan *ecsacs.AttachTaskNetworkInterfacesMessage),
-		ctx:               derivedContext,
-		cancel:            cancel,
-		cluster:           aws.String(cluster),
-		containerInstance: aws.String(containerInstanceArn),
-		acsClient:         acsClient,
-		state:             taskEngineState,
-		dataClient:        dataClient,
+		messageBuffer:      make(chan *ecsacs.AttachTaskNetworkInterfacesMessage),
+		ctx:                derivedContext,
+		cancel:             cancel,
+		cluster:            aws.String(cluster),
+		containerInstance:  aws.String(containerInstanceArn),
+		acsClient:          acsClient,
+		state:              taskEngineState,
+		dataClient:         dataClient,
+		inFlightAckTracker: newInFlightAckTracker(),
+		routines:           &handlerRoutines{},
+		goroutines:         goroutines,
 	}
 }
 
 // handlerFunc returns a function to enqueue requests onto attachENIHandler buffer
 func (attachTaskENIHandler *attachTaskENIHandler) handlerFunc() func(message *ecsacs.AttachTaskNetworkInterfacesMessage) {
 	return func(message *ecsacs.AttachTaskNetworkInterfacesMessage) {
-		attachTaskENIHandler.messageBuffer <- message
+		attachTaskENIHandler.trackReceived("AttachTaskNetworkInterfacesMessage", aws.StringValue(message.MessageId))
+		select {
+		case attachTaskENIHandler.messageBuffer <- message:
+		case <-attachTaskENIHandler.ctx.Done():
+			attachTaskENIHandler.trackAcked(aws.StringValue(message.MessageId))
+		}
 	}
 }
 
 // start invokes handleMessages to ack each enqueued request
 func (attachTaskENIHandler *attachTaskENIHandler) start() {
-	go attachTaskENIHandler.handleMessages()
+	attachTaskENIHandler.routines.run(attachTaskENIHandler.handleMessages)
 }
 
 // stop is used to invoke a cancellation function
@@ -80,6 +94,11 @@ func (attachTaskENIHandler *attachTaskENIHandler) stop() {
 	attachTaskENIHandler.cancel()
 }
 
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (attachTaskENIHandler *attachTaskENIHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, attachTaskENIHandler.stop, attachTaskENIHandler.routines, nil)
+}
+
 // handleMessages handles each message one at a time
 func (attachTaskENIHandler *attachTaskENIHandler) handleMessages() {
 	for {
@@ -90,6 +109,7 @@ func (attachTaskENIHandler *attachTaskENIHandler) handleMessages() {
 			if err := attachTaskENIHandler.handleSingleMessage(message); err != nil {
 				seelog.Warnf("Unable to handle ENI Attachment message [%s]: %v", message.String(), err)
 			}
+			attachTaskENIHandler.trackAcked(aws.StringValue(message.MessageId))
 		}
 	}
 }
@@ -104,7 +124,9 @@ func (attachTaskENIHandler *attachTaskENIHandler) handleSingleMessage(message *e
 	}
 
 	// Send ACK
-	go sendAck(attachTaskENIHandler.acsClient, message.ClusterArn, message.ContainerInstanceArn, message.MessageId)
+	attachTaskENIHandler.goroutines.spawn(attachTaskNetworkInterfacesMessageType, func() {
+		sendAck(attachTaskENIHandler.acsClient, message.ClusterArn, message.ContainerInstanceArn, message.MessageId)
+	})
 
 	// Handle the attachment
 	attachmentARN := aws.StringValue(message.ElasticNetworkInterfaces[0].AttachmentArn)
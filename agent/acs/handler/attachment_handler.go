@@ -0,0 +1,182 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// attachmentMessageHandler handles the attachments of a given type confirmed by ACS
+type attachmentMessageHandler interface {
+	// handleAttachment handles the attachment of the message. The attachment is
+	// considered unsuccessful past expiresAt
+	handleAttachment(message *ecsacs.ConfirmAttachmentMessage, expiresAt time.Time) error
+}
+
+// genericAttachmentHandler handles the resource attachment messages sent by ACS
+// for attachments other than ENIs, which have their own messages. Each message is
+// routed to the handler of its attachment type
+type genericAttachmentHandler struct {
+	messageBuffer chan *ecsacs.ConfirmAttachmentMessage
+	ctx           context.Context
+	cancel        context.CancelFunc
+	acsClient     wsclient.ClientServer
+	handlers      map[string]attachmentMessageHandler
+	*inFlightAckTracker
+	routines *handlerRoutines
+}
+
+// newGenericAttachmentHandler returns an instance of the genericAttachmentHandler struct
+func newGenericAttachmentHandler(ctx context.Context, acsClient wsclient.ClientServer,
+	dataClient data.Client) genericAttachmentHandler {
+	// Create a cancelable context from the parent context
+	derivedContext, cancel := context.WithCancel(ctx)
+	return genericAttachmentHandler{
+		messageBuffer:      make(chan *ecsacs.ConfirmAttachmentMessage),
+		ctx:                derivedContext,
+		cancel:             cancel,
+		acsClient:          acsClient,
+		handlers:           newAttachmentMessageHandlers(dataClient),
+		inFlightAckTracker: newInFlightAckTracker(),
+		routines:           &handlerRoutines{},
+	}
+}
+
+// handlerFunc returns a function to enqueue requests onto the buffer
+func (handler *genericAttachmentHandler) handlerFunc() func(message *ecsacs.ConfirmAttachmentMessage) {
+	return func(message *ecsacs.ConfirmAttachmentMessage) {
+		handler.trackReceived("ConfirmAttachmentMessage", aws.StringValue(message.MessageId))
+		select {
+		case handler.messageBuffer <- message:
+		case <-handler.ctx.Done():
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// start invokes handleMessages to handle each enqueued request
+func (handler *genericAttachmentHandler) start() {
+	handler.routines.run(handler.handleMessages)
+}
+
+// stop is used to invoke a cancellation function
+func (handler *genericAttachmentHandler) stop() {
+	handler.cancel()
+}
+
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (handler *genericAttachmentHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, handler.stop, handler.routines, nil)
+}
+
+// handleMessages handles each message one at a time
+func (handler *genericAttachmentHandler) handleMessages() {
+	for {
+		select {
+		case <-handler.ctx.Done():
+			return
+		case message := <-handler.messageBuffer:
+			if err := handler.handleSingleMessage(message); err != nil {
+				seelog.Warnf("Unable to handle resource attachment message [%s]: %v", message.String(), err)
+			}
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// handleSingleMessage routes the attachment to the handler of its type and acks
+// the message once the attachment has been handled
+func (handler *genericAttachmentHandler) handleSingleMessage(message *ecsacs.ConfirmAttachmentMessage) error {
+	receivedAt := time.Now()
+	if err := validateConfirmAttachmentMessage(message); err != nil {
+		return errors.Wrap(err, "resource attachment message handler: error validating ConfirmAttachmentMessage")
+	}
+
+	attachmentType := aws.StringValue(message.Attachment.AttachmentType)
+	attachmentHandler, ok := handler.handlers[attachmentType]
+	if !ok {
+		return errors.Errorf("resource attachment message handler: unsupported attachment type: %s", attachmentType)
+	}
+	expiresAt := receivedAt.Add(time.Duration(aws.Int64Value(message.WaitTimeoutMs)) * time.Millisecond)
+	if err := attachmentHandler.handleAttachment(message, expiresAt); err != nil {
+		return errors.Wrapf(err, "resource attachment message handler: unable to handle %s attachment %s",
+			attachmentType, aws.StringValue(message.Attachment.AttachmentArn))
+	}
+
+	sendAck(handler.acsClient, message.ClusterArn, message.ContainerInstanceArn, message.MessageId)
+	return nil
+}
+
+// validateConfirmAttachmentMessage performs validation checks on the ConfirmAttachmentMessage
+func validateConfirmAttachmentMessage(message *ecsacs.ConfirmAttachmentMessage) error {
+	if message == nil {
+		return errors.Errorf("message is empty")
+	}
+
+	if aws.StringValue(message.MessageId) == "" {
+		return errors.Errorf("message id not set")
+	}
+
+	if aws.StringValue(message.ClusterArn) == "" {
+		return errors.Errorf("clusterArn not set")
+	}
+
+	if aws.StringValue(message.ContainerInstanceArn) == "" {
+		return errors.Errorf("containerInstanceArn not set")
+	}
+
+	if aws.StringValue(message.TaskArn) == "" {
+		return errors.Errorf("taskArn not set")
+	}
+
+	attachment := message.Attachment
+	if attachment == nil {
+		return errors.Errorf("attachment not set")
+	}
+
+	if aws.StringValue(attachment.AttachmentArn) == "" {
+		return errors.Errorf("attachmentArn not set")
+	}
+
+	if aws.StringValue(attachment.AttachmentType) == "" {
+		return errors.Errorf("attachmentType not set")
+	}
+
+	timeout := aws.Int64Value(message.WaitTimeoutMs)
+	if timeout <= 0 {
+		return errors.Errorf("invalid timeout specified: %d", timeout)
+	}
+	return nil
+}
+
+// attachmentProperties returns the properties of the attachment as a map
+func attachmentProperties(attachment *ecsacs.Attachment) map[string]string {
+	properties := make(map[string]string, len(attachment.AttachmentProperties))
+	for _, property := range attachment.AttachmentProperties {
+		if property == nil {
+			continue
+		}
+		properties[aws.StringValue(property.Name)] = aws.StringValue(property.Value)
+	}
+	return properties
+}
@@ -0,0 +1,159 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apiattachment "github.com/aws/amazon-ecs-agent/agent/api/attachment"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	attachmentTestTaskArn       = "arn:aws:ecs:us-west-2:123456789012:task/cluster/taskid"
+	attachmentTestAttachmentArn = "arn:aws:ecs:us-west-2:123456789012:attachment/attachmentid"
+)
+
+func newTestConfirmAttachmentMessage(attachmentType string, properties map[string]string) *ecsacs.ConfirmAttachmentMessage {
+	attachment := &ecsacs.Attachment{
+		AttachmentArn:  aws.String(attachmentTestAttachmentArn),
+		AttachmentType: aws.String(attachmentType),
+	}
+	for name, value := range properties {
+		attachment.AttachmentProperties = append(attachment.AttachmentProperties, &ecsacs.AttachmentProperty{
+			Name:  aws.String(name),
+			Value: aws.String(value),
+		})
+	}
+	return &ecsacs.ConfirmAttachmentMessage{
+		ClusterArn:           aws.String(clusterName),
+		ContainerInstanceArn: aws.String(containerInstanceArn),
+		TaskArn:              aws.String(attachmentTestTaskArn),
+		MessageId:            aws.String(messageId),
+		WaitTimeoutMs:        aws.Int64(1000),
+		Attachment:           attachment,
+	}
+}
+
+func TestGenericAttachmentHandlerEBSVolume(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	mockWSClient.EXPECT().MakeRequest(&ecsacs.AckRequest{
+		Cluster:           aws.String(clusterName),
+		ContainerInstance: aws.String(containerInstanceArn),
+		MessageId:         aws.String(messageId),
+	}).Return(nil)
+
+	handler := newGenericAttachmentHandler(context.TODO(), mockWSClient, dataClient)
+	message := newTestConfirmAttachmentMessage(apiattachment.EBSVolumeAttachmentType, map[string]string{
+		apiattachment.VolumeIDKey:   "vol-12345",
+		apiattachment.DeviceNameKey: "/dev/xvdf",
+	})
+	require.NoError(t, handler.handleSingleMessage(message))
+
+	attachments, err := dataClient.GetResourceAttachments()
+	require.NoError(t, err)
+	require.Len(t, attachments, 1)
+	assert.Equal(t, apiattachment.EBSVolumeAttachmentType, attachments[0].AttachmentType)
+	assert.Equal(t, attachmentTestTaskArn, attachments[0].TaskARN)
+	assert.Equal(t, attachmentTestAttachmentArn, attachments[0].AttachmentARN)
+	assert.Equal(t, "vol-12345", attachments[0].AttachmentProperties[apiattachment.VolumeIDKey])
+	assert.False(t, attachments[0].ExpiresAt.IsZero())
+}
+
+func TestGenericAttachmentHandlerEBSVolumeMissingProperties(t *testing.T) {
+	testCases := []struct {
+		name       string
+		properties map[string]string
+	}{
+		{
+			name:       "missing volume id",
+			properties: map[string]string{apiattachment.DeviceNameKey: "/dev/xvdf"},
+		},
+		{
+			name:       "missing device name",
+			properties: map[string]string{apiattachment.VolumeIDKey: "vol-12345"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			dataClient, cleanup := newTestDataClient(t)
+			defer cleanup()
+
+			// The message must not be acked
+			handler := newGenericAttachmentHandler(context.TODO(), mock_wsclient.NewMockClientServer(ctrl), dataClient)
+			message := newTestConfirmAttachmentMessage(apiattachment.EBSVolumeAttachmentType, tc.properties)
+			assert.Error(t, handler.handleSingleMessage(message))
+
+			attachments, err := dataClient.GetResourceAttachments()
+			require.NoError(t, err)
+			assert.Empty(t, attachments)
+		})
+	}
+}
+
+func TestGenericAttachmentHandlerUnsupportedAttachmentType(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	handler := newGenericAttachmentHandler(context.TODO(), mock_wsclient.NewMockClientServer(ctrl), dataClient)
+	message := newTestConfirmAttachmentMessage("unknown", nil)
+	assert.Error(t, handler.handleSingleMessage(message))
+}
+
+func TestValidateConfirmAttachmentMessage(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(message *ecsacs.ConfirmAttachmentMessage)
+	}{
+		{"missing message id", func(message *ecsacs.ConfirmAttachmentMessage) { message.MessageId = nil }},
+		{"missing cluster", func(message *ecsacs.ConfirmAttachmentMessage) { message.ClusterArn = nil }},
+		{"missing container instance", func(message *ecsacs.ConfirmAttachmentMessage) { message.ContainerInstanceArn = nil }},
+		{"missing task", func(message *ecsacs.ConfirmAttachmentMessage) { message.TaskArn = nil }},
+		{"missing attachment", func(message *ecsacs.ConfirmAttachmentMessage) { message.Attachment = nil }},
+		{"missing attachment arn", func(message *ecsacs.ConfirmAttachmentMessage) { message.Attachment.AttachmentArn = nil }},
+		{"missing attachment type", func(message *ecsacs.ConfirmAttachmentMessage) { message.Attachment.AttachmentType = nil }},
+		{"invalid timeout", func(message *ecsacs.ConfirmAttachmentMessage) { message.WaitTimeoutMs = aws.Int64(0) }},
+	}
+	assert.NoError(t, validateConfirmAttachmentMessage(
+		newTestConfirmAttachmentMessage(apiattachment.EBSVolumeAttachmentType, nil)))
+	assert.Error(t, validateConfirmAttachmentMessage(nil))
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			message := newTestConfirmAttachmentMessage(apiattachment.EBSVolumeAttachmentType, nil)
+			tc.modify(message)
+			assert.Error(t, validateConfirmAttachmentMessage(message))
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apiattachment "github.com/aws/amazon-ecs-agent/agent/api/attachment"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// newAttachmentMessageHandlers returns the handlers of the supported resource
+// attachment types, by attachment type
+func newAttachmentMessageHandlers(dataClient data.Client) map[string]attachmentMessageHandler {
+	return map[string]attachmentMessageHandler{
+		apiattachment.EBSVolumeAttachmentType: &ebsVolumeAttachmentHandler{dataClient: dataClient},
+	}
+}
+
+// ebsVolumeAttachmentHandler handles the attachment of EBS volumes to tasks
+type ebsVolumeAttachmentHandler struct {
+	dataClient data.Client
+}
+
+// handleAttachment persists the EBS volume attachment
+func (handler *ebsVolumeAttachmentHandler) handleAttachment(message *ecsacs.ConfirmAttachmentMessage,
+	expiresAt time.Time) error {
+	properties := attachmentProperties(message.Attachment)
+	for _, key := range []string{apiattachment.VolumeIDKey, apiattachment.DeviceNameKey} {
+		if properties[key] == "" {
+			return errors.Errorf("%s not set in the EBS volume attachment properties", key)
+		}
+	}
+
+	volumeAttachment := &apiattachment.ResourceAttachment{
+		AttachmentType:       apiattachment.EBSVolumeAttachmentType,
+		TaskARN:              aws.StringValue(message.TaskArn),
+		AttachmentARN:        aws.StringValue(message.Attachment.AttachmentArn),
+		AttachmentProperties: properties,
+		ExpiresAt:            expiresAt,
+	}
+	seelog.Infof("Handling EBS volume attachment: %s, volume: %s", volumeAttachment.String(),
+		properties[apiattachment.VolumeIDKey])
+	return handler.dataClient.SaveResourceAttachment(volumeAttachment)
+}
@@ -0,0 +1,220 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/ecs_client/model/ecs"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// attributeUpdateInterval is the minimum interval between two updates of
+	// the container instance attributes
+	attributeUpdateInterval = time.Minute
+)
+
+// newAttributeUpdateLimiter returns the rate limiter allowing one update of the
+// container instance attributes per attributeUpdateInterval. It is shared across
+// connections to ACS so that reconnecting doesn't reset the limit
+func newAttributeUpdateLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Every(attributeUpdateInterval), 1)
+}
+
+// attributeUpdateHandler handles the updates of the container instance attributes
+// pushed by ACS, e.g. when new software has been installed on the instance, so
+// that placement constraints can use them without registering the instance
+// again. The attributes are saved so that they are kept when the container
+// instance is registered again after a restart
+type attributeUpdateHandler struct {
+	messageBuffer        chan *ecsacs.UpdateAttributesMessage
+	ctx                  context.Context
+	cancel               context.CancelFunc
+	cluster              string
+	containerInstanceArn string
+	acsClient            wsclient.ClientServer
+	ecsClient            api.ECSClient
+	dataClient           data.Client
+	limiter              *rate.Limiter
+	*inFlightAckTracker
+	routines *handlerRoutines
+}
+
+// newAttributeUpdateHandler returns an instance of the attributeUpdateHandler struct
+func newAttributeUpdateHandler(ctx context.Context,
+	cluster string, containerInstanceArn string, acsClient wsclient.ClientServer,
+	ecsClient api.ECSClient, dataClient data.Client, limiter *rate.Limiter) attributeUpdateHandler {
+
+	// Create a cancelable context from the parent context
+	derivedContext, cancel := context.WithCancel(ctx)
+	return attributeUpdateHandler{
+		messageBuffer:        make(chan *ecsacs.UpdateAttributesMessage),
+		ctx:                  derivedContext,
+		cancel:               cancel,
+		cluster:              cluster,
+		containerInstanceArn: containerInstanceArn,
+		acsClient:            acsClient,
+		ecsClient:            ecsClient,
+		dataClient:           dataClient,
+		limiter:              limiter,
+		inFlightAckTracker:   newInFlightAckTracker(),
+		routines:             &handlerRoutines{},
+	}
+}
+
+// handlerFunc returns the request handler function for the UpdateAttributesMessage
+func (handler *attributeUpdateHandler) handlerFunc() func(message *ecsacs.UpdateAttributesMessage) {
+	return func(message *ecsacs.UpdateAttributesMessage) {
+		handler.trackReceived("UpdateAttributesMessage", aws.StringValue(message.MessageId))
+		select {
+		case handler.messageBuffer <- message:
+		case <-handler.ctx.Done():
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// start invokes go routines to handle attribute update messages
+func (handler *attributeUpdateHandler) start() {
+	handler.routines.run(handler.handleMessages)
+}
+
+// stop is used to invoke a cancellation function
+func (handler *attributeUpdateHandler) stop() {
+	handler.cancel()
+}
+
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (handler *attributeUpdateHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, handler.stop, handler.routines, nil)
+}
+
+// handleMessages processes the attribute update messages in-order
+func (handler *attributeUpdateHandler) handleMessages() {
+	for {
+		select {
+		case <-handler.ctx.Done():
+			return
+		case message := <-handler.messageBuffer:
+			if err := handler.handleSingleMessage(message); err != nil {
+				seelog.Warnf("Unable to handle attribute update message [%s]: %v", message.String(), err)
+			}
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// handleSingleMessage puts all the attributes of the message on the container
+// instance in a single call, waiting for the previous update to be at least
+// attributeUpdateInterval old, and acks the message once they are set. The
+// message is not acked if the attributes could not be set, so that ACS resends it
+func (handler *attributeUpdateHandler) handleSingleMessage(message *ecsacs.UpdateAttributesMessage) error {
+	if message.MessageId == nil {
+		return fmt.Errorf("attribute update handler: message id not set in message")
+	}
+	if len(message.Attributes) == 0 {
+		return fmt.Errorf("attribute update handler: no attribute set in message")
+	}
+	attributes := make([]*ecs.Attribute, 0, len(message.Attributes))
+	for _, attribute := range message.Attributes {
+		if aws.StringValue(attribute.Name) == "" {
+			return fmt.Errorf("attribute update handler: attribute name not set in message")
+		}
+		attributes = append(attributes, &ecs.Attribute{
+			Name:  attribute.Name,
+			Value: attribute.Value,
+		})
+	}
+
+	if err := handler.limiter.Wait(handler.ctx); err != nil {
+		return err
+	}
+	seelog.Infof("Updating %d container instance attributes, message id: %s",
+		len(attributes), aws.StringValue(message.MessageId))
+	if err := handler.ecsClient.UpdateContainerInstanceAttributes(handler.containerInstanceArn, attributes); err != nil {
+		return err
+	}
+	if err := saveContainerInstanceAttributes(handler.dataClient, attributes); err != nil {
+		// The attributes are set, they are only lost if the instance is registered again
+		seelog.Warnf("Unable to save the container instance attributes: %v", err)
+	}
+	return handler.acsClient.MakeRequest(&ecsacs.AckRequest{
+		Cluster:           aws.String(handler.cluster),
+		ContainerInstance: aws.String(handler.containerInstanceArn),
+		MessageId:         message.MessageId,
+	})
+}
+
+// saveContainerInstanceAttributes adds the attributes to the saved ones,
+// replacing the saved attributes with the same names
+func saveContainerInstanceAttributes(dataClient data.Client, attributes []*ecs.Attribute) error {
+	saved := loadAttributeValues(dataClient)
+	for _, attribute := range attributes {
+		saved[aws.StringValue(attribute.Name)] = aws.StringValue(attribute.Value)
+	}
+	encoded, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+	return dataClient.SaveMetadata(data.ContainerInstanceAttributesKey, string(encoded))
+}
+
+// loadAttributeValues returns the saved attribute values by attribute name
+func loadAttributeValues(dataClient data.Client) map[string]string {
+	values := make(map[string]string)
+	if dataClient == nil {
+		return values
+	}
+	encoded, err := dataClient.GetMetadata(data.ContainerInstanceAttributesKey)
+	if err != nil || encoded == "" {
+		// The attributes are only saved once ACS has pushed some
+		return values
+	}
+	if err := json.Unmarshal([]byte(encoded), &values); err != nil {
+		seelog.Warnf("Unable to decode the saved container instance attributes: %v", err)
+		return make(map[string]string)
+	}
+	return values
+}
+
+// LoadContainerInstanceAttributes returns the container instance attributes
+// pushed by ACS and saved in the data client, sorted by name
+func LoadContainerInstanceAttributes(dataClient data.Client) []*ecs.Attribute {
+	values := loadAttributeValues(dataClient)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	attributes := make([]*ecs.Attribute, 0, len(names))
+	for _, name := range names {
+		attribute := &ecs.Attribute{Name: aws.String(name)}
+		if value := values[name]; value != "" {
+			attribute.Value = aws.String(value)
+		}
+		attributes = append(attributes, attribute)
+	}
+	return attributes
+}
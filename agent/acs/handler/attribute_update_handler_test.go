@@ -0,0 +1,192 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	mock_api "github.com/aws/amazon-ecs-agent/agent/api/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/ecs_client/model/ecs"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+const (
+	attributeTestCluster              = "mock-cluster"
+	attributeTestContainerInstanceArn = "mock-container-instance"
+	attributeTestMessageId            = "mock-message-id"
+)
+
+func newTestAttributeUpdateHandler(ctx context.Context, ctrl *gomock.Controller, dataClient data.Client,
+	limiter *rate.Limiter) (attributeUpdateHandler, *mock_api.MockECSClient, *mock_wsclient.MockClientServer) {
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	handler := newAttributeUpdateHandler(ctx, attributeTestCluster, attributeTestContainerInstanceArn,
+		mockWSClient, ecsClient, dataClient, limiter)
+	return handler, ecsClient, mockWSClient
+}
+
+func updateAttributesMessage(attributes ...*ecsacs.Attribute) *ecsacs.UpdateAttributesMessage {
+	return &ecsacs.UpdateAttributesMessage{
+		ClusterArn:           aws.String(attributeTestCluster),
+		ContainerInstanceArn: aws.String(attributeTestContainerInstanceArn),
+		MessageId:            aws.String(attributeTestMessageId),
+		Attributes:           attributes,
+	}
+}
+
+func attributeTestAckRequest() *ecsacs.AckRequest {
+	return &ecsacs.AckRequest{
+		Cluster:           aws.String(attributeTestCluster),
+		ContainerInstance: aws.String(attributeTestContainerInstanceArn),
+		MessageId:         aws.String(attributeTestMessageId),
+	}
+}
+
+func TestUpdateAttributes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	handler, ecsClient, mockWSClient := newTestAttributeUpdateHandler(context.TODO(), ctrl, dataClient,
+		newAttributeUpdateLimiter())
+	gomock.InOrder(
+		ecsClient.EXPECT().UpdateContainerInstanceAttributes(attributeTestContainerInstanceArn, []*ecs.Attribute{
+			{Name: aws.String("software"), Value: aws.String("installed")},
+			{Name: aws.String("gpu")},
+		}).Return(nil),
+		mockWSClient.EXPECT().MakeRequest(attributeTestAckRequest()).Return(nil),
+	)
+
+	require.NoError(t, handler.handleSingleMessage(updateAttributesMessage(
+		&ecsacs.Attribute{Name: aws.String("software"), Value: aws.String("installed")},
+		&ecsacs.Attribute{Name: aws.String("gpu")},
+	)))
+
+	assert.Equal(t, []*ecs.Attribute{
+		{Name: aws.String("gpu")},
+		{Name: aws.String("software"), Value: aws.String("installed")},
+	}, LoadContainerInstanceAttributes(dataClient))
+}
+
+func TestUpdateAttributesMergesSavedAttributes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	require.NoError(t, saveContainerInstanceAttributes(dataClient, []*ecs.Attribute{
+		{Name: aws.String("software"), Value: aws.String("1.0")},
+		{Name: aws.String("gpu"), Value: aws.String("true")},
+	}))
+
+	handler, ecsClient, mockWSClient := newTestAttributeUpdateHandler(context.TODO(), ctrl, dataClient,
+		newAttributeUpdateLimiter())
+	ecsClient.EXPECT().UpdateContainerInstanceAttributes(gomock.Any(), gomock.Any()).Return(nil)
+	mockWSClient.EXPECT().MakeRequest(attributeTestAckRequest()).Return(nil)
+
+	require.NoError(t, handler.handleSingleMessage(updateAttributesMessage(
+		&ecsacs.Attribute{Name: aws.String("software"), Value: aws.String("2.0")},
+	)))
+
+	assert.Equal(t, []*ecs.Attribute{
+		{Name: aws.String("gpu"), Value: aws.String("true")},
+		{Name: aws.String("software"), Value: aws.String("2.0")},
+	}, LoadContainerInstanceAttributes(dataClient))
+}
+
+func TestUpdateAttributesErrorNotAcked(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	handler, ecsClient, _ := newTestAttributeUpdateHandler(context.TODO(), ctrl, dataClient,
+		newAttributeUpdateLimiter())
+	ecsClient.EXPECT().UpdateContainerInstanceAttributes(gomock.Any(), gomock.Any()).Return(errors.New("error"))
+
+	assert.Error(t, handler.handleSingleMessage(updateAttributesMessage(
+		&ecsacs.Attribute{Name: aws.String("software"), Value: aws.String("installed")},
+	)))
+	assert.Empty(t, LoadContainerInstanceAttributes(dataClient))
+}
+
+func TestUpdateAttributesInvalidMessages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler, _, _ := newTestAttributeUpdateHandler(context.TODO(), ctrl, data.NewNoopClient(),
+		newAttributeUpdateLimiter())
+
+	assert.Error(t, handler.handleSingleMessage(&ecsacs.UpdateAttributesMessage{
+		Attributes: []*ecsacs.Attribute{{Name: aws.String("software")}},
+	}))
+	assert.Error(t, handler.handleSingleMessage(updateAttributesMessage()))
+	assert.Error(t, handler.handleSingleMessage(updateAttributesMessage(
+		&ecsacs.Attribute{Value: aws.String("installed")},
+	)))
+}
+
+func TestUpdateAttributesRateLimited(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	interval := 100 * time.Millisecond
+	handler, ecsClient, mockWSClient := newTestAttributeUpdateHandler(context.TODO(), ctrl, data.NewNoopClient(),
+		rate.NewLimiter(rate.Every(interval), 1))
+	ecsClient.EXPECT().UpdateContainerInstanceAttributes(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+	mockWSClient.EXPECT().MakeRequest(attributeTestAckRequest()).Return(nil).Times(2)
+
+	message := updateAttributesMessage(&ecsacs.Attribute{Name: aws.String("software")})
+	start := time.Now()
+	require.NoError(t, handler.handleSingleMessage(message))
+	require.NoError(t, handler.handleSingleMessage(message))
+	assert.True(t, time.Since(start) >= interval/2, "second update was not rate limited")
+}
+
+func TestUpdateAttributesRateLimitedContextCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	limiter := newAttributeUpdateLimiter()
+	// Use up the update allowed for the current interval
+	require.True(t, limiter.Allow())
+	handler, _, _ := newTestAttributeUpdateHandler(ctx, ctrl, data.NewNoopClient(), limiter)
+	cancel()
+
+	assert.Error(t, handler.handleSingleMessage(updateAttributesMessage(
+		&ecsacs.Attribute{Name: aws.String("software")},
+	)))
+}
+
+func TestLoadContainerInstanceAttributesNotSaved(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	assert.Empty(t, LoadContainerInstanceAttributes(dataClient))
+	assert.Empty(t, LoadContainerInstanceAttributes(nil))
+}
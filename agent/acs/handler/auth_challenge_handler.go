@@ -0,0 +1,217 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// authChallengeFailedEvent is the ACS event recorded when the agent could
+	// not answer an authentication challenge of ACS
+	authChallengeFailedEvent = "AuthChallengeFailed"
+	// authChallengeTimeout is how long after connecting the agent waits for the
+	// authentication challenge of ACS to be completed, when challenges are
+	// required, before closing the connection
+	authChallengeTimeout = time.Minute
+)
+
+// AuthChallenger answers the authentication challenges ACS sends after the
+// websocket connection is established
+type AuthChallenger interface {
+	// Respond returns the response to the challenge
+	Respond(challenge []byte) ([]byte, error)
+}
+
+// authChallengeGate holds the processing of task messages back until the
+// authentication challenge of the connection has been completed
+type authChallengeGate struct {
+	completed chan struct{}
+	once      sync.Once
+}
+
+// newAuthChallengeGate returns a new authChallengeGate, or nil when challenges
+// are not required, in which case task messages are never held back
+func newAuthChallengeGate(required bool) *authChallengeGate {
+	if !required {
+		return nil
+	}
+	return &authChallengeGate{completed: make(chan struct{})}
+}
+
+// complete records that the challenge was completed, releasing the waiters
+func (gate *authChallengeGate) complete() {
+	if gate == nil {
+		return
+	}
+	gate.once.Do(func() {
+		close(gate.completed)
+	})
+}
+
+// isCompleted returns true if the challenge was completed
+func (gate *authChallengeGate) isCompleted() bool {
+	if gate == nil {
+		return true
+	}
+	select {
+	case <-gate.completed:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait waits for the challenge to be completed. It returns false if the
+// context is done first
+func (gate *authChallengeGate) wait(ctx context.Context) bool {
+	if gate == nil {
+		return true
+	}
+	select {
+	case <-gate.completed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// authChallengeHandler handles the authentication challenges sent by ACS after
+// connecting. The response is computed by the AuthChallenger and sent back to
+// ACS, which completes the challenge of the connection. Challenges that can't be
+// answered are left unanswered, the connection is closed once
+// authChallengeTimeout elapses if challenges are required
+type authChallengeHandler struct {
+	messageBuffer        chan *ecsacs.ACSAuthChallengeMessage
+	ctx                  context.Context
+	cancel               context.CancelFunc
+	cluster              string
+	containerInstanceArn string
+	acsClient            wsclient.ClientServer
+	challenger           AuthChallenger
+	gate                 *authChallengeGate
+	*inFlightAckTracker
+	routines *handlerRoutines
+}
+
+// newAuthChallengeHandler returns an instance of the authChallengeHandler struct
+func newAuthChallengeHandler(ctx context.Context,
+	cluster string, containerInstanceArn string, acsClient wsclient.ClientServer,
+	challenger AuthChallenger, gate *authChallengeGate) authChallengeHandler {
+
+	// Create a cancelable context from the parent context
+	derivedContext, cancel := context.WithCancel(ctx)
+	return authChallengeHandler{
+		messageBuffer:        make(chan *ecsacs.ACSAuthChallengeMessage),
+		ctx:                  derivedContext,
+		cancel:               cancel,
+		cluster:              cluster,
+		containerInstanceArn: containerInstanceArn,
+		acsClient:            acsClient,
+		challenger:           challenger,
+		gate:                 gate,
+		inFlightAckTracker:   newInFlightAckTracker(),
+		routines:             &handlerRoutines{},
+	}
+}
+
+// handlerFunc returns the request handler function for the ACSAuthChallengeMessage
+func (handler *authChallengeHandler) handlerFunc() func(message *ecsacs.ACSAuthChallengeMessage) {
+	return func(message *ecsacs.ACSAuthChallengeMessage) {
+		handler.trackReceived("ACSAuthChallengeMessage", aws.StringValue(message.MessageId))
+		select {
+		case handler.messageBuffer <- message:
+		case <-handler.ctx.Done():
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// start invokes go routines to handle authentication challenge messages
+func (handler *authChallengeHandler) start() {
+	handler.routines.run(handler.handleMessages)
+}
+
+// stop is used to invoke a cancellation function
+func (handler *authChallengeHandler) stop() {
+	handler.cancel()
+}
+
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (handler *authChallengeHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, handler.stop, handler.routines, nil)
+}
+
+// handleMessages processes the authentication challenge messages in-order
+func (handler *authChallengeHandler) handleMessages() {
+	for {
+		select {
+		case <-handler.ctx.Done():
+			return
+		case message := <-handler.messageBuffer:
+			if err := handler.handleSingleMessage(message); err != nil {
+				seelog.Errorf("Unable to answer the authentication challenge of ACS, message id: %s: %v",
+					aws.StringValue(message.MessageId), err)
+				metrics.MetricsEngineGlobal.RecordACSEvent(authChallengeFailedEvent, 1)
+			}
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// handleSingleMessage answers the challenge and completes the challenge of the
+// connection once the response is sent
+func (handler *authChallengeHandler) handleSingleMessage(message *ecsacs.ACSAuthChallengeMessage) error {
+	if message.MessageId == nil {
+		return fmt.Errorf("auth challenge handler: message id not set in message")
+	}
+	challenge, err := base64.StdEncoding.DecodeString(aws.StringValue(message.Challenge))
+	if err != nil {
+		return fmt.Errorf("auth challenge handler: invalid challenge: %v", err)
+	}
+	if len(challenge) == 0 {
+		return fmt.Errorf("auth challenge handler: challenge not set in message")
+	}
+
+	if handler.challenger == nil {
+		return fmt.Errorf("auth challenge handler: no challenger to answer the challenge")
+	}
+	seelog.Infof("Answering the %s authentication challenge of ACS, message id: %s",
+		aws.StringValue(message.ChallengeType), aws.StringValue(message.MessageId))
+	response, err := handler.challenger.Respond(challenge)
+	if err != nil {
+		return err
+	}
+	err = handler.acsClient.MakeRequest(&ecsacs.ACSAuthChallengeResponseMessage{
+		Cluster:           aws.String(handler.cluster),
+		ContainerInstance: aws.String(handler.containerInstanceArn),
+		MessageId:         message.MessageId,
+		Response:          aws.String(base64.StdEncoding.EncodeToString(response)),
+	})
+	if err != nil {
+		return err
+	}
+	handler.gate.complete()
+	return nil
+}
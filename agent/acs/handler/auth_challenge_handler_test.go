@@ -0,0 +1,218 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	mock_ec2 "github.com/aws/amazon-ecs-agent/agent/ec2/mocks"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuthChallenger answers challenges with the reversed challenge
+type fakeAuthChallenger struct {
+	err error
+}
+
+func (challenger fakeAuthChallenger) Respond(challenge []byte) ([]byte, error) {
+	if challenger.err != nil {
+		return nil, challenger.err
+	}
+	response := make([]byte, len(challenge))
+	for i, b := range challenge {
+		response[len(challenge)-1-i] = b
+	}
+	return response, nil
+}
+
+func newTestAuthChallengeMessage(challenge string) *ecsacs.ACSAuthChallengeMessage {
+	return &ecsacs.ACSAuthChallengeMessage{
+		MessageId:     aws.String("msg1"),
+		ChallengeType: aws.String("IMDS"),
+		Challenge:     aws.String(base64.StdEncoding.EncodeToString([]byte(challenge))),
+	}
+}
+
+func TestAuthChallengeHandlerAnswersChallenge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_wsclient.NewMockClientServer(ctrl)
+	gate := newAuthChallengeGate(true)
+	handler := newAuthChallengeHandler(context.Background(), "cluster", "myArn", client, fakeAuthChallenger{}, gate)
+
+	client.EXPECT().MakeRequest(&ecsacs.ACSAuthChallengeResponseMessage{
+		Cluster:           aws.String("cluster"),
+		ContainerInstance: aws.String("myArn"),
+		MessageId:         aws.String("msg1"),
+		Response:          aws.String(base64.StdEncoding.EncodeToString([]byte("cba"))),
+	}).Return(nil)
+	require.NoError(t, handler.handleSingleMessage(newTestAuthChallengeMessage("abc")))
+	assert.True(t, gate.isCompleted())
+}
+
+func TestAuthChallengeHandlerFailures(t *testing.T) {
+	testCases := []struct {
+		name       string
+		message    *ecsacs.ACSAuthChallengeMessage
+		challenger AuthChallenger
+		sendErr    error
+	}{
+		{
+			name:       "no message id",
+			message:    &ecsacs.ACSAuthChallengeMessage{Challenge: aws.String("YWJj")},
+			challenger: fakeAuthChallenger{},
+		},
+		{
+			name:       "invalid challenge",
+			message:    &ecsacs.ACSAuthChallengeMessage{MessageId: aws.String("msg1"), Challenge: aws.String("not base64!")},
+			challenger: fakeAuthChallenger{},
+		},
+		{
+			name:       "empty challenge",
+			message:    &ecsacs.ACSAuthChallengeMessage{MessageId: aws.String("msg1")},
+			challenger: fakeAuthChallenger{},
+		},
+		{
+			name:    "no challenger",
+			message: newTestAuthChallengeMessage("abc"),
+		},
+		{
+			name:       "challenger error",
+			message:    newTestAuthChallengeMessage("abc"),
+			challenger: fakeAuthChallenger{err: errors.New("imds unavailable")},
+		},
+		{
+			name:       "send error",
+			message:    newTestAuthChallengeMessage("abc"),
+			challenger: fakeAuthChallenger{},
+			sendErr:    errors.New("connection closed"),
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			client := mock_wsclient.NewMockClientServer(ctrl)
+			if tc.sendErr != nil {
+				client.EXPECT().MakeRequest(gomock.Any()).Return(tc.sendErr)
+			}
+			gate := newAuthChallengeGate(true)
+			handler := newAuthChallengeHandler(context.Background(), "cluster", "myArn", client, tc.challenger, gate)
+
+			assert.Error(t, handler.handleSingleMessage(tc.message))
+			assert.False(t, gate.isCompleted(), "the challenge shouldn't be completed")
+		})
+	}
+}
+
+func TestAuthChallengeGate(t *testing.T) {
+	var notRequired *authChallengeGate
+	assert.Nil(t, newAuthChallengeGate(false))
+	assert.True(t, notRequired.isCompleted())
+	assert.True(t, notRequired.wait(context.Background()))
+	notRequired.complete()
+
+	gate := newAuthChallengeGate(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, gate.wait(ctx), "wait should return when the context is done")
+
+	gate.complete()
+	gate.complete()
+	assert.True(t, gate.isCompleted())
+	assert.True(t, gate.wait(context.Background()))
+}
+
+func TestPayloadHandlerWaitsForAuthChallenge(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	gate := newAuthChallengeGate(true)
+	tester.payloadHandler.authGate = gate
+
+	taskAdded := make(chan struct{})
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(func(*apitask.Task) {
+		close(taskAdded)
+	})
+	tester.mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(interface{}) {
+		tester.cancel()
+	})
+
+	go tester.payloadHandler.start()
+	tester.payloadHandler.messageBuffer.push(context.TODO(), &ecsacs.PayloadMessage{
+		Tasks:     []*ecsacs.Task{{Arn: aws.String("t1")}},
+		MessageId: aws.String(payloadMessageId),
+	})
+	select {
+	case <-taskAdded:
+		t.Fatal("the task shouldn't be added before the challenge is completed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	gate.complete()
+	<-taskAdded
+	<-tester.ctx.Done()
+}
+
+func TestIMDSAuthChallengerRespond(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentResource).Return(`{"instanceId":"i-123"}`, nil)
+	ec2MetadataClient.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentSignatureResource).Return("signature", nil)
+
+	before := time.Now().UTC()
+	data, err := NewIMDSAuthChallenger(ec2MetadataClient).Respond([]byte("abc"))
+	require.NoError(t, err)
+
+	var response imdsAuthChallengeResponse
+	require.NoError(t, json.Unmarshal(data, &response))
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("abc")), response.Challenge)
+	assert.Equal(t, `{"instanceId":"i-123"}`, response.Document)
+	assert.Equal(t, "signature", response.Signature)
+	assert.False(t, response.Timestamp.Before(before.Truncate(time.Second)))
+}
+
+func TestIMDSAuthChallengerRespondErrors(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	gomock.InOrder(
+		ec2MetadataClient.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentResource).Return("", errors.New("timeout")),
+		ec2MetadataClient.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentResource).Return("{}", nil),
+		ec2MetadataClient.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentSignatureResource).Return("", errors.New("timeout")),
+	)
+	challenger := NewIMDSAuthChallenger(ec2MetadataClient)
+	_, err := challenger.Respond([]byte("abc"))
+	assert.Error(t, err)
+	_, err = challenger.Respond([]byte("abc"))
+	assert.Error(t, err)
+
+	_, err = NewIMDSAuthChallenger(nil).Respond([]byte("abc"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,53 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+)
+
+// connectionCertificateFingerprint returns the fingerprint of the certificate
+// presented by the backend on the client connection, if the client exposes it
+func connectionCertificateFingerprint(client wsclient.ClientServer) string {
+	if provider, ok := client.(sessionStatsProvider); ok {
+		return provider.SessionStats().CertificateFingerprint
+	}
+	return ""
+}
+
+// checkCertificateFingerprint logs the fingerprint of the certificate presented
+// by ACS and warns when it differs from the one seen on the previous connection,
+// which is persisted so that the comparison survives agent restarts
+func checkCertificateFingerprint(fingerprint string, dataClient data.Client, log logger.Logger) {
+	if fingerprint == "" {
+		return
+	}
+	log.Infof("ACS certificate fingerprint (SHA-256): %s", fingerprint)
+	if dataClient == nil {
+		return
+	}
+	previous, err := dataClient.GetMetadata(data.ACSCertificateFingerprintKey)
+	if err == nil && previous != "" && previous != fingerprint {
+		log.Warnf("ACS certificate fingerprint changed since the last connection, previous: %s, current: %s",
+			previous, fingerprint)
+	}
+	if previous == fingerprint {
+		return
+	}
+	if err := dataClient.SaveMetadata(data.ACSCertificateFingerprintKey, fingerprint); err != nil {
+		log.Warnf("Unable to save the ACS certificate fingerprint: %v", err)
+	}
+}
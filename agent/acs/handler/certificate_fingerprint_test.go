@@ -0,0 +1,135 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	acsclient "github.com/aws/amazon-ecs-agent/agent/acs/client"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/cihub/seelog"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSelfSignedCertificate returns a new certificate for a mock ACS server
+func newSelfSignedCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "ecs-a-1.us-west-2.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// startCertificateServer starts a mock ACS server presenting the certificate
+func startCertificateServer(cert tls.Certificate) *httptest.Server {
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			ws.Close()
+		}
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	return server
+}
+
+// connectAndCheckFingerprint connects to the server and checks the fingerprint
+// of its certificate, returning the logs
+func connectAndCheckFingerprint(t *testing.T, server *httptest.Server, dataClient data.Client) string {
+	client := acsclient.New(server.URL, testConfig, testCreds, wsRWTimeout, nil, nil)
+	defer client.Close()
+	require.NoError(t, client.Connect())
+
+	buf := &bytes.Buffer{}
+	seeLogger, err := seelog.LoggerFromWriterWithMinLevelAndFormat(buf, seelog.InfoLvl, "%Level %Msg\n")
+	require.NoError(t, err)
+	checkCertificateFingerprint(connectionCertificateFingerprint(client), dataClient,
+		logger.NewNilSafeLogger(seeLogger))
+	seeLogger.Flush()
+	return buf.String()
+}
+
+func TestCheckCertificateFingerprintSameCertificate(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	cert := newSelfSignedCertificate(t)
+
+	server := startCertificateServer(cert)
+	logs := connectAndCheckFingerprint(t, server, dataClient)
+	server.Close()
+	assert.Contains(t, logs, "Info ACS certificate fingerprint (SHA-256): ")
+	assert.NotContains(t, logs, "Warn")
+
+	// A new server presenting the same certificate doesn't trigger a warning
+	server = startCertificateServer(cert)
+	defer server.Close()
+	logs = connectAndCheckFingerprint(t, server, dataClient)
+	assert.Contains(t, logs, "Info ACS certificate fingerprint (SHA-256): ")
+	assert.NotContains(t, logs, "Warn")
+}
+
+func TestCheckCertificateFingerprintChangedCertificate(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	server := startCertificateServer(newSelfSignedCertificate(t))
+	connectAndCheckFingerprint(t, server, dataClient)
+	server.Close()
+	previous, err := dataClient.GetMetadata(data.ACSCertificateFingerprintKey)
+	require.NoError(t, err)
+
+	server = startCertificateServer(newSelfSignedCertificate(t))
+	defer server.Close()
+	logs := connectAndCheckFingerprint(t, server, dataClient)
+	assert.Contains(t, logs, "Warn ACS certificate fingerprint changed since the last connection, previous: "+previous)
+
+	current, err := dataClient.GetMetadata(data.ACSCertificateFingerprintKey)
+	require.NoError(t, err)
+	assert.NotEqual(t, previous, current, "the new fingerprint should be saved")
+	assert.Contains(t, logs, "current: "+current)
+}
+
+func TestCheckCertificateFingerprintWithoutFingerprint(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	checkCertificateFingerprint("", dataClient, logger.NewNilSafeLogger(nil))
+	_, err := dataClient.GetMetadata(data.ACSCertificateFingerprintKey)
+	assert.Error(t, err, "no fingerprint should be saved when the connection doesn't expose one")
+}
@@ -0,0 +1,101 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// connectStormWindow is the sliding window over which the connections to
+	// ACS are counted
+	connectStormWindow = time.Minute
+	// connectStormCooldown is the time during which the agent stops connecting
+	// to ACS once a connect storm has been detected
+	connectStormCooldown = 10 * time.Minute
+	// connectStormEvent is the ACS event recorded when a connect storm is detected
+	connectStormEvent = "ConnectStorm"
+)
+
+// OnConnectStormCallback is invoked when the agent is detected to be in a
+// connect-disconnect loop with ACS, e.g. to alert the operator of the instance.
+// connects is the number of connections made to ACS within window
+type OnConnectStormCallback func(connects int, window time.Duration)
+
+// circularReconnectDetector detects when the agent enters a connect-disconnect
+// loop with ACS. A bug or a misconfiguration can make the agent disconnect right
+// after connecting, and since ACS closing the connection doesn't trigger any
+// backoff the agent would then keep reconnecting, burning the ACS API quota
+type circularReconnectDetector struct {
+	maxConnects    int
+	window         time.Duration
+	cooldown       time.Duration
+	onConnectStorm OnConnectStormCallback
+	lock           sync.Mutex
+	// connects holds the times of the connections made within the window, oldest first
+	connects []time.Time
+	// now returns the current time, it is overridden in unit tests
+	now func() time.Time
+}
+
+// newCircularReconnectDetector returns a new circularReconnectDetector object
+func newCircularReconnectDetector(maxConnectsPerMinute int, onConnectStorm OnConnectStormCallback) *circularReconnectDetector {
+	if maxConnectsPerMinute <= 0 {
+		maxConnectsPerMinute = config.DefaultACSMaxConnectsPerMinute
+	}
+	return &circularReconnectDetector{
+		maxConnects:    maxConnectsPerMinute,
+		window:         connectStormWindow,
+		cooldown:       connectStormCooldown,
+		onConnectStorm: onConnectStorm,
+		now:            time.Now,
+	}
+}
+
+// recordConnect records a connection to ACS. It returns the time during which
+// the agent should stop connecting to ACS, which is zero unless more than
+// maxConnects connections were made within the window. The window is reset
+// once a storm has been detected so that the same connections aren't reported twice
+func (detector *circularReconnectDetector) recordConnect() time.Duration {
+	if detector == nil {
+		return 0
+	}
+	detector.lock.Lock()
+	now := detector.now()
+	expired := 0
+	for expired < len(detector.connects) && now.Sub(detector.connects[expired]) >= detector.window {
+		expired++
+	}
+	detector.connects = append(detector.connects[expired:], now)
+	connects := len(detector.connects)
+	if connects <= detector.maxConnects {
+		detector.lock.Unlock()
+		return 0
+	}
+	detector.connects = nil
+	detector.lock.Unlock()
+
+	seelog.Criticalf("Connected to ACS %d times in the last %s, the agent appears to be stuck in a connect-disconnect loop; not connecting for %s",
+		connects, detector.window.String(), detector.cooldown.String())
+	metrics.MetricsEngineGlobal.RecordACSEvent(connectStormEvent, 1)
+	if detector.onConnectStorm != nil {
+		detector.onConnectStorm(connects, detector.window)
+	}
+	return detector.cooldown
+}
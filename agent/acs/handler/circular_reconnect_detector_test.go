@@ -0,0 +1,90 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestCircularReconnectDetector returns a detector with a fake clock that
+// can be moved forward with the returned function
+func newTestCircularReconnectDetector(maxConnects int, onConnectStorm OnConnectStormCallback) (*circularReconnectDetector, func(time.Duration)) {
+	now := time.Now()
+	detector := newCircularReconnectDetector(maxConnects, onConnectStorm)
+	detector.now = func() time.Time {
+		return now
+	}
+	return detector, func(d time.Duration) {
+		now = now.Add(d)
+	}
+}
+
+func TestCircularReconnectDetectorDetectsConnectStorm(t *testing.T) {
+	var calls, stormConnects int
+	var stormWindow time.Duration
+	detector, advance := newTestCircularReconnectDetector(3, func(connects int, window time.Duration) {
+		calls++
+		stormConnects = connects
+		stormWindow = window
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, detector.recordConnect())
+		advance(time.Second)
+	}
+	assert.Equal(t, connectStormCooldown, detector.recordConnect())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, 4, stormConnects)
+	assert.Equal(t, connectStormWindow, stormWindow)
+
+	// The window is reset once the storm has been reported
+	assert.Zero(t, detector.recordConnect())
+	assert.Equal(t, 1, calls)
+}
+
+func TestCircularReconnectDetectorSlidingWindow(t *testing.T) {
+	calls := 0
+	detector, advance := newTestCircularReconnectDetector(3, func(int, time.Duration) {
+		calls++
+	})
+
+	// Connecting every 30 seconds never exceeds 3 connections in a minute
+	for i := 0; i < 20; i++ {
+		assert.Zero(t, detector.recordConnect())
+		advance(30 * time.Second)
+	}
+	assert.Zero(t, calls)
+}
+
+func TestCircularReconnectDetectorWithoutCallback(t *testing.T) {
+	detector, _ := newTestCircularReconnectDetector(1, nil)
+
+	assert.Zero(t, detector.recordConnect())
+	assert.Equal(t, connectStormCooldown, detector.recordConnect())
+}
+
+func TestCircularReconnectDetectorDefaults(t *testing.T) {
+	detector := newCircularReconnectDetector(0, nil)
+	assert.Equal(t, config.DefaultACSMaxConnectsPerMinute, detector.maxConnects)
+
+	var nilDetector *circularReconnectDetector
+	assert.Zero(t, nilDetector.recordConnect())
+}
@@ -0,0 +1,35 @@
+//go:build !typedeventstream
+// +build !typedeventstream
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import "github.com/aws/amazon-ecs-agent/agent/eventstream"
+
+// connectionEventPayload returns the legacy form of the event written to the
+// untyped deregister instance event stream: an empty struct when the container
+// instance is deregistered, and a ContainerInstanceStatusEvent when its status
+// changes
+func connectionEventPayload(event eventstream.ConnectionEvent) interface{} {
+	if event.Type == eventstream.InstanceStatusChanged {
+		return ContainerInstanceStatusEvent{Status: event.Status}
+	}
+	return struct{}{}
+}
+
+// writeConnectionEvent writes the event to the deregister instance event stream
+func writeConnectionEvent(eventStream *eventstream.DeregisterInstanceEventStream, event eventstream.ConnectionEvent) error {
+	return eventStream.WriteToEventStream(connectionEventPayload(event))
+}
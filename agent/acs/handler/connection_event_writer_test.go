@@ -0,0 +1,48 @@
+//go:build unit && !typedeventstream
+// +build unit,!typedeventstream
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subscribeTestConnectionEvents returns the channel the events written to the
+// deregister instance event stream are sent to
+func subscribeTestConnectionEvents(t *testing.T, eventStream *eventstream.DeregisterInstanceEventStream) <-chan interface{} {
+	events := make(chan interface{}, 1)
+	require.NoError(t, eventStream.Subscribe("test", func(event ...interface{}) error {
+		events <- event[0]
+		return nil
+	}))
+	return events
+}
+
+// TestConnectionEventPayload tests that the events are written to the untyped
+// event stream in the form its existing listeners expect
+func TestConnectionEventPayload(t *testing.T) {
+	assert.Equal(t, struct{}{}, connectionEventPayload(eventstream.ConnectionEvent{
+		Type: eventstream.InstanceDeregistered,
+	}))
+	assert.Equal(t, ContainerInstanceStatusEvent{Status: "DRAINING"}, connectionEventPayload(eventstream.ConnectionEvent{
+		Type:   eventstream.InstanceStatusChanged,
+		Status: "DRAINING",
+	}))
+}
@@ -0,0 +1,47 @@
+//go:build unit && typedeventstream && go1.21
+// +build unit,typedeventstream,go1.21
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+)
+
+// connectionEventPayload returns the event as received from the typed deregister
+// instance event stream, which is the event itself
+func connectionEventPayload(event eventstream.ConnectionEvent) interface{} {
+	return event
+}
+
+// subscribeTestConnectionEvents returns the channel the events written to the
+// deregister instance event stream are sent to
+func subscribeTestConnectionEvents(t *testing.T, eventStream *eventstream.DeregisterInstanceEventStream) <-chan interface{} {
+	typedEvents := eventStream.Subscribe()
+	events := make(chan interface{}, 1)
+	go func() {
+		for {
+			select {
+			case event := <-typedEvents:
+				events <- event
+			case <-eventStream.Context().Done():
+				return
+			}
+		}
+	}()
+	return events
+}
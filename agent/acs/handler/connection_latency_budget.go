@@ -0,0 +1,143 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// latencyBudgetConsecutiveAcks is the number of consecutive acks exceeding
+	// the round-trip latency budget after which the connection is closed
+	latencyBudgetConsecutiveAcks = 3
+	// ackEchoExpiry is how long an ack waits for its echo before it's forgotten
+	ackEchoExpiry = time.Minute
+)
+
+// ackSendHookUser is implemented by websocket clients that pass the acks to a
+// hook before sending them
+type ackSendHookUser interface {
+	UseAckSendHook(hook func(ack *ecsacs.AckRequest))
+}
+
+// ConnectionLatencyBudget closes the connection to ACS when its round-trip
+// latency degrades, so that the agent reconnects, possibly to a faster ACS host,
+// instead of launching tasks slowly. The acks sent to ACS carry a correlation
+// ID, which ACS echoes back in an AckEchoMessage when it receives the ack. The
+// budget is exceeded when latencyBudgetConsecutiveAcks consecutive acks are
+// echoed after more than the maximum round-trip time. Acks that are never
+// echoed, e.g. by ACS hosts not supporting echoes, are ignored
+type ConnectionLatencyBudget struct {
+	maxRTT time.Duration
+	lock   sync.Mutex
+	// lastCorrelationID is the correlation ID of the last ack sent
+	lastCorrelationID uint64
+	// sentAt holds the time the acks waiting for their echo were sent at, by
+	// correlation ID
+	sentAt map[string]time.Time
+	// slowAcks is the number of consecutive acks echoed after more than maxRTT
+	slowAcks  int
+	exceeded  bool
+	exceededC chan struct{}
+}
+
+// newConnectionLatencyBudget returns a new ConnectionLatencyBudget for a
+// connection to ACS
+func newConnectionLatencyBudget(maxRTT time.Duration) *ConnectionLatencyBudget {
+	return &ConnectionLatencyBudget{
+		maxRTT:    maxRTT,
+		sentAt:    make(map[string]time.Time),
+		exceededC: make(chan struct{}),
+	}
+}
+
+// use sets the correlation ID of the acks sent by the client and handles their
+// echoes, if the client supports passing the acks to a hook
+func (budget *ConnectionLatencyBudget) use(client wsclient.ClientServer) {
+	hookUser, ok := client.(ackSendHookUser)
+	if !ok {
+		return
+	}
+	hookUser.UseAckSendHook(budget.sent)
+	client.AddRequestHandler(budget.handlerFunc())
+}
+
+// budgetExceeded returns the channel closed when the budget is exceeded
+func (budget *ConnectionLatencyBudget) budgetExceeded() <-chan struct{} {
+	return budget.exceededC
+}
+
+// sent sets the correlation ID of the ack and records the time it's sent at.
+// The acks not echoed within ackEchoExpiry are forgotten
+func (budget *ConnectionLatencyBudget) sent(ack *ecsacs.AckRequest) {
+	now := time.Now()
+	budget.lock.Lock()
+	defer budget.lock.Unlock()
+
+	for correlationID, sentAt := range budget.sentAt {
+		if now.Sub(sentAt) > ackEchoExpiry {
+			delete(budget.sentAt, correlationID)
+		}
+	}
+	budget.lastCorrelationID++
+	correlationID := strconv.FormatUint(budget.lastCorrelationID, 10)
+	ack.CorrelationId = aws.String(correlationID)
+	budget.sentAt[correlationID] = now
+}
+
+// handlerFunc returns the request handler function for the AckEchoMessage
+func (budget *ConnectionLatencyBudget) handlerFunc() func(message *ecsacs.AckEchoMessage) {
+	return func(message *ecsacs.AckEchoMessage) {
+		budget.echoed(aws.StringValue(message.CorrelationId), time.Now())
+	}
+}
+
+// echoed records the round-trip time of the ack with the correlation ID, echoed
+// at receivedAt, and closes the budget exceeded channel once enough consecutive
+// acks exceeded the maximum round-trip time
+func (budget *ConnectionLatencyBudget) echoed(correlationID string, receivedAt time.Time) {
+	budget.lock.Lock()
+	defer budget.lock.Unlock()
+
+	sentAt, ok := budget.sentAt[correlationID]
+	if !ok {
+		seelog.Debugf("Ignoring the echo of unknown ack with correlation id %s", correlationID)
+		return
+	}
+	delete(budget.sentAt, correlationID)
+	rtt := receivedAt.Sub(sentAt)
+	if rtt <= budget.maxRTT {
+		budget.slowAcks = 0
+		return
+	}
+	budget.slowAcks++
+	seelog.Debugf("ACS echoed the ack with correlation id %s after %s, over the budget of %s",
+		correlationID, rtt.String(), budget.maxRTT.String())
+	if budget.slowAcks < latencyBudgetConsecutiveAcks || budget.exceeded {
+		return
+	}
+	seelog.Warnf("The last %d acks sent to ACS were echoed after more than %s, the connection is too slow",
+		budget.slowAcks, budget.maxRTT.String())
+	metrics.MetricsEngineGlobal.RecordACSLatencyBudgetExceeded()
+	budget.exceeded = true
+	close(budget.exceededC)
+}
@@ -0,0 +1,226 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	acsclient "github.com/aws/amazon-ecs-agent/agent/acs/client"
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startAckEchoServer starts a mock ACS server echoing the acks it receives. The
+// echo of the nth ack received, from 0, is sent after echoDelay(n)
+func startAckEchoServer(t *testing.T, echoDelay func(n int) time.Duration) *httptest.Server {
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Logf("Unable to upgrade the connection: %v", err)
+			return
+		}
+		defer ws.Close()
+		var writeLock sync.Mutex
+		decoder := wsclient.BuildTypeDecoder([]interface{}{ecsacs.AckRequest{}})
+		for n := 0; ; n++ {
+			_, message, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			decoded, _, err := wsclient.DecodeData(message, decoder)
+			if err != nil {
+				continue
+			}
+			ack := decoded.(*ecsacs.AckRequest)
+			echo := fmt.Sprintf(`{"type":"AckEchoMessage","message":{"messageId":"%s","correlationId":"%s"}}`,
+				aws.StringValue(ack.MessageId), aws.StringValue(ack.CorrelationId))
+			time.AfterFunc(echoDelay(n), func() {
+				writeLock.Lock()
+				defer writeLock.Unlock()
+				ws.WriteMessage(websocket.TextMessage, []byte(echo))
+			})
+		}
+	}))
+}
+
+// connectLatencyBudget connects a client to the server, with the latency budget
+// timing its acks, and serves the messages of the server
+func connectLatencyBudget(t *testing.T, serverURL string, budget *ConnectionLatencyBudget) wsclient.ClientServer {
+	client := acsclient.New(serverURL, testConfig, testCreds, wsRWTimeout, nil, nil)
+	budget.use(client)
+	var err error
+	// Wait for up to a second for the mock server to launch
+	for i := 0; i < 100; i++ {
+		err = client.Connect()
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, err)
+	go client.Serve()
+	return client
+}
+
+// sendAckAndWaitForEcho sends an ack to the server and waits for its echo
+func sendAckAndWaitForEcho(t *testing.T, client wsclient.ClientServer, budget *ConnectionLatencyBudget) {
+	require.NoError(t, client.MakeRequest(&ecsacs.AckRequest{
+		Cluster:           aws.String("cluster"),
+		ContainerInstance: aws.String("containerInstance"),
+		MessageId:         aws.String("messageId"),
+	}))
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		budget.lock.Lock()
+		pending := len(budget.sentAt)
+		budget.lock.Unlock()
+		if pending == 0 {
+			return
+		}
+	}
+	t.Fatal("the ack wasn't echoed by the mock server")
+}
+
+// isBudgetExceeded returns whether the budget exceeded channel is closed
+func isBudgetExceeded(budget *ConnectionLatencyBudget) bool {
+	select {
+	case <-budget.budgetExceeded():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestConnectionLatencyBudgetWithMockServer(t *testing.T) {
+	const slowEcho = 200 * time.Millisecond
+	for _, tc := range []struct {
+		name      string
+		echoDelay func(n int) time.Duration
+		acks      int
+		exceeded  bool
+	}{
+		{
+			name:      "fast server",
+			echoDelay: func(int) time.Duration { return 0 },
+			acks:      5,
+			exceeded:  false,
+		},
+		{
+			name:      "slow server",
+			echoDelay: func(int) time.Duration { return slowEcho },
+			acks:      latencyBudgetConsecutiveAcks,
+			exceeded:  true,
+		},
+		{
+			name:      "fewer slow acks than the threshold",
+			echoDelay: func(int) time.Duration { return slowEcho },
+			acks:      latencyBudgetConsecutiveAcks - 1,
+			exceeded:  false,
+		},
+		{
+			name: "slow acks not consecutive",
+			echoDelay: func(n int) time.Duration {
+				if n%latencyBudgetConsecutiveAcks == latencyBudgetConsecutiveAcks-1 {
+					return 0
+				}
+				return slowEcho
+			},
+			acks:     2 * latencyBudgetConsecutiveAcks,
+			exceeded: false,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := startAckEchoServer(t, tc.echoDelay)
+			defer server.Close()
+			budget := newConnectionLatencyBudget(slowEcho / 2)
+			client := connectLatencyBudget(t, server.URL, budget)
+			defer client.Close()
+
+			for i := 0; i < tc.acks; i++ {
+				sendAckAndWaitForEcho(t, client, budget)
+			}
+			assert.Equal(t, tc.exceeded, isBudgetExceeded(budget))
+		})
+	}
+}
+
+// TestConnectionLatencyBudgetExceededOnce tests that the slow acks echoed after
+// the budget is exceeded don't close the channel again
+func TestConnectionLatencyBudgetExceededOnce(t *testing.T) {
+	budget := newConnectionLatencyBudget(time.Second)
+	for i := 0; i < 2*latencyBudgetConsecutiveAcks; i++ {
+		ack := &ecsacs.AckRequest{}
+		budget.sent(ack)
+		budget.echoed(aws.StringValue(ack.CorrelationId), time.Now().Add(2*time.Second))
+	}
+	assert.True(t, isBudgetExceeded(budget))
+}
+
+func TestConnectionLatencyBudgetIgnoresUnknownEchoes(t *testing.T) {
+	budget := newConnectionLatencyBudget(time.Second)
+	ack := &ecsacs.AckRequest{}
+	budget.sent(ack)
+	budget.echoed(aws.StringValue(ack.CorrelationId), time.Now().Add(2*time.Second))
+	// Echoed twice, or never sent
+	budget.echoed(aws.StringValue(ack.CorrelationId), time.Now().Add(2*time.Second))
+	budget.echoed("unknown", time.Now().Add(2*time.Second))
+	assert.Equal(t, 1, budget.slowAcks)
+}
+
+// TestConnectionLatencyBudgetForgetsExpiredAcks tests that the acks ACS doesn't
+// echo are forgotten, so that they don't accumulate
+func TestConnectionLatencyBudgetForgetsExpiredAcks(t *testing.T) {
+	budget := newConnectionLatencyBudget(time.Second)
+	expired := &ecsacs.AckRequest{}
+	budget.sent(expired)
+	budget.sentAt[aws.StringValue(expired.CorrelationId)] = time.Now().Add(-2 * ackEchoExpiry)
+
+	ack := &ecsacs.AckRequest{}
+	budget.sent(ack)
+	assert.NotEqual(t, aws.StringValue(expired.CorrelationId), aws.StringValue(ack.CorrelationId))
+	assert.Len(t, budget.sentAt, 1)
+	assert.Contains(t, budget.sentAt, aws.StringValue(ack.CorrelationId))
+	assert.Equal(t, "2", aws.StringValue(ack.CorrelationId))
+}
+
+// TestConnectionLatencyBudgetUnsupportedClient tests that the budget doesn't
+// use the clients not passing their acks to a hook
+func TestConnectionLatencyBudgetUnsupportedClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	budget := newConnectionLatencyBudget(time.Second)
+	budget.use(mock_wsclient.NewMockClientServer(ctrl))
+	assert.False(t, isBudgetExceeded(budget))
+}
+
+// TestReconnectWithBackoffWhenLatencyBudgetExceeded tests that exceeding the
+// budget doesn't reset the backoff, as the latency is likely to still be high
+// on the next connection
+func TestReconnectWithBackoffWhenLatencyBudgetExceeded(t *testing.T) {
+	assert.False(t, shouldReconnectWithoutBackoff(errLatencyBudgetExceeded))
+}
@@ -0,0 +1,87 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+// instanceCapacity is the cpu and memory of the instance that isn't reserved by
+// tasks. availableMemoryMiB is zero if the memory of the instance is unknown
+type instanceCapacity struct {
+	availableCPU       int64
+	availableMemoryMiB int64
+}
+
+// ContainerInstanceCapacityTracker computes the capacity available for new tasks
+// on the container instance, by subtracting the resources reserved by the tasks
+// that aren't stopped yet from the resources of the instance. The capacity is
+// reported to ACS in the heartbeat acks so that it can make placement decisions
+// without waiting for its own model of the instance to be updated
+type ContainerInstanceCapacityTracker struct {
+	resources  *instanceResources
+	taskEngine engine.TaskEngine
+}
+
+// newContainerInstanceCapacityTracker returns a ContainerInstanceCapacityTracker
+// for the instance, nil if the resources of the instance are unknown
+func newContainerInstanceCapacityTracker(resources *instanceResources,
+	taskEngine engine.TaskEngine) *ContainerInstanceCapacityTracker {
+	if resources == nil {
+		return nil
+	}
+	return &ContainerInstanceCapacityTracker{
+		resources:  resources,
+		taskEngine: taskEngine,
+	}
+}
+
+// availableCapacity returns the capacity of the instance that isn't reserved by
+// tasks. The capacity never goes below zero, even if the instance is overcommitted
+func (tracker *ContainerInstanceCapacityTracker) availableCapacity() (instanceCapacity, error) {
+	tasks, err := tracker.taskEngine.ListTasks()
+	if err != nil {
+		return instanceCapacity{}, errors.Wrap(err, "unable to list the tasks")
+	}
+
+	capacity := instanceCapacity{
+		availableCPU:       tracker.resources.availableCPU,
+		availableMemoryMiB: tracker.resources.availableMemoryMiB,
+	}
+	for _, task := range tasks {
+		if task.GetKnownStatus() >= apitaskstatus.TaskStopped {
+			continue
+		}
+		cpu, memoryMiB, err := taskReservation(task)
+		if err != nil {
+			// The task was validated when it was received, this is unexpected
+			seelog.Warnf("Unable to compute the resources reserved by task %s, not accounting for them: %v",
+				task.Arn, err)
+			continue
+		}
+		capacity.availableCPU -= cpu
+		capacity.availableMemoryMiB -= memoryMiB
+	}
+
+	if capacity.availableCPU < 0 {
+		capacity.availableCPU = 0
+	}
+	if tracker.resources.availableMemoryMiB <= 0 || capacity.availableMemoryMiB < 0 {
+		capacity.availableMemoryMiB = 0
+	}
+	return capacity, nil
+}
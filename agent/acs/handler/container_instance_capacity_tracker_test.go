@@ -0,0 +1,190 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCapacityTask returns a task with the given known status, task level cpu
+// (in vCPUs) and memory, and containers
+func testCapacityTask(status apitaskstatus.TaskStatus, cpu float64, memoryMiB int64,
+	containers ...*apicontainer.Container) *apitask.Task {
+	task := &apitask.Task{
+		Arn:        "arn",
+		CPU:        cpu,
+		Memory:     memoryMiB,
+		Containers: containers,
+	}
+	task.SetKnownStatus(status)
+	return task
+}
+
+func TestNewContainerInstanceCapacityTrackerUnknownResources(t *testing.T) {
+	assert.Nil(t, newContainerInstanceCapacityTracker(nil, nil))
+}
+
+func TestContainerInstanceCapacityTrackerAvailableCapacity(t *testing.T) {
+	testCases := []struct {
+		name              string
+		resources         *instanceResources
+		tasks             []*apitask.Task
+		expectedCPU       int64
+		expectedMemoryMiB int64
+	}{
+		{
+			name:              "no tasks",
+			resources:         &instanceResources{availableCPU: 4096, availableMemoryMiB: 8000},
+			expectedCPU:       4096,
+			expectedMemoryMiB: 8000,
+		},
+		{
+			name:      "task level resources",
+			resources: &instanceResources{availableCPU: 4096, availableMemoryMiB: 8000},
+			tasks: []*apitask.Task{
+				testCapacityTask(apitaskstatus.TaskRunning, 1, 2048, testResourceContainer(256, 512, 0)),
+			},
+			expectedCPU:       3072,
+			expectedMemoryMiB: 5952,
+		},
+		{
+			name:      "container level resources",
+			resources: &instanceResources{availableCPU: 4096, availableMemoryMiB: 8000},
+			tasks: []*apitask.Task{
+				testCapacityTask(apitaskstatus.TaskRunning, 0, 0,
+					testResourceContainer(256, 512, 0), testResourceContainer(256, 0, 300)),
+			},
+			expectedCPU:       3584,
+			expectedMemoryMiB: 7188,
+		},
+		{
+			name:      "tasks not started yet reserve resources, stopped ones don't",
+			resources: &instanceResources{availableCPU: 4096, availableMemoryMiB: 8000},
+			tasks: []*apitask.Task{
+				testCapacityTask(apitaskstatus.TaskStatusNone, 1, 1000),
+				testCapacityTask(apitaskstatus.TaskCreated, 1, 1000),
+				testCapacityTask(apitaskstatus.TaskStopped, 1, 1000),
+			},
+			expectedCPU:       2048,
+			expectedMemoryMiB: 6000,
+		},
+		{
+			name:      "overcommitted instance",
+			resources: &instanceResources{availableCPU: 1024, availableMemoryMiB: 1000},
+			tasks: []*apitask.Task{
+				testCapacityTask(apitaskstatus.TaskRunning, 2, 2000),
+			},
+			expectedCPU:       0,
+			expectedMemoryMiB: 0,
+		},
+		{
+			name:      "unknown memory",
+			resources: &instanceResources{availableCPU: 4096},
+			tasks: []*apitask.Task{
+				testCapacityTask(apitaskstatus.TaskRunning, 1, 2048),
+			},
+			expectedCPU:       3072,
+			expectedMemoryMiB: 0,
+		},
+		{
+			name:      "task with an invalid host config",
+			resources: &instanceResources{availableCPU: 4096, availableMemoryMiB: 8000},
+			tasks: []*apitask.Task{
+				testCapacityTask(apitaskstatus.TaskRunning, 0, 0, &apicontainer.Container{
+					CPU:          256,
+					DockerConfig: apicontainer.DockerConfig{HostConfig: aws.String("{")},
+				}),
+				testCapacityTask(apitaskstatus.TaskRunning, 1, 1000),
+			},
+			expectedCPU:       3072,
+			expectedMemoryMiB: 7000,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+			taskEngine.EXPECT().ListTasks().Return(tc.tasks, nil)
+			tracker := newContainerInstanceCapacityTracker(tc.resources, taskEngine)
+
+			capacity, err := tracker.availableCapacity()
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCPU, capacity.availableCPU)
+			assert.Equal(t, tc.expectedMemoryMiB, capacity.availableMemoryMiB)
+		})
+	}
+}
+
+func TestContainerInstanceCapacityTrackerListTasksError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().ListTasks().Return(nil, errors.New("oops"))
+	tracker := newContainerInstanceCapacityTracker(&instanceResources{availableCPU: 4096}, taskEngine)
+
+	_, err := tracker.availableCapacity()
+	assert.Error(t, err)
+}
+
+func TestHeartbeatAckIncludesAvailableCapacity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().ListTasks().Return([]*apitask.Task{
+		testCapacityTask(apitaskstatus.TaskRunning, 1, 2048),
+	}, nil).Times(2)
+
+	handler := newHeartbeatHandler(context.Background(), nil, nil, nil, newContainerInstanceCapacityTracker(
+		&instanceResources{availableCPU: 4096, availableMemoryMiB: 8000}, taskEngine), nil, nil)
+	ack := &ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat")}
+	handler.addAvailableCapacity(ack)
+	assert.Equal(t, int64(3072), aws.Int64Value(ack.AvailableCpu))
+	assert.Equal(t, int64(5952), aws.Int64Value(ack.AvailableMemoryMiB))
+
+	// The memory isn't included when it's unknown
+	handler = newHeartbeatHandler(context.Background(), nil, nil, nil, newContainerInstanceCapacityTracker(
+		&instanceResources{availableCPU: 4096}, taskEngine), nil, nil)
+	ack = &ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat")}
+	handler.addAvailableCapacity(ack)
+	assert.Equal(t, int64(3072), aws.Int64Value(ack.AvailableCpu))
+	assert.Nil(t, ack.AvailableMemoryMiB)
+}
+
+func TestHeartbeatAckWithoutCapacityTracker(t *testing.T) {
+	handler := newHeartbeatHandler(context.Background(), nil, nil, nil, nil, nil, nil)
+	ack := &ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat")}
+	handler.addAvailableCapacity(ack)
+	assert.Nil(t, ack.AvailableCpu)
+	assert.Nil(t, ack.AvailableMemoryMiB)
+}
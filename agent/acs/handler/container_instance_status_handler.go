@@ -0,0 +1,166 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// containerInstanceStatusDraining is the status of a container instance that
+	// doesn't accept new tasks
+	containerInstanceStatusDraining = "DRAINING"
+	// containerInstanceStatusActive is the status of a container instance that
+	// accepts new tasks
+	containerInstanceStatusActive = "ACTIVE"
+)
+
+// ContainerInstanceStatusEvent is written to the untyped deregister instance
+// event stream when ACS puts the container instance into the DRAINING status
+type ContainerInstanceStatusEvent struct {
+	Status string
+}
+
+// containerInstanceStatusHandler handles the changes of the status of the
+// container instance pushed by ACS, e.g. when the container instance is put into
+// the DRAINING status from the console. A DRAINING container instance doesn't
+// accept new tasks but, unlike with a task drain message, its existing tasks
+// keep running. The status is persisted so that it is honored after a restart
+type containerInstanceStatusHandler struct {
+	messageBuffer                 chan *ecsacs.ContainerInstanceStatusMessage
+	ctx                           context.Context
+	cancel                        context.CancelFunc
+	cluster                       string
+	containerInstanceArn          string
+	acsClient                     wsclient.ClientServer
+	dataClient                    data.Client
+	drainState                    *taskDrainState
+	deregisterInstanceEventStream *eventstream.DeregisterInstanceEventStream
+	*inFlightAckTracker
+	routines *handlerRoutines
+}
+
+// newContainerInstanceStatusHandler returns an instance of the containerInstanceStatusHandler struct
+func newContainerInstanceStatusHandler(ctx context.Context,
+	cluster string, containerInstanceArn string, acsClient wsclient.ClientServer,
+	dataClient data.Client, drainState *taskDrainState,
+	deregisterInstanceEventStream *eventstream.DeregisterInstanceEventStream) containerInstanceStatusHandler {
+
+	// Create a cancelable context from the parent context
+	derivedContext, cancel := context.WithCancel(ctx)
+	return containerInstanceStatusHandler{
+		messageBuffer:                 make(chan *ecsacs.ContainerInstanceStatusMessage),
+		ctx:                           derivedContext,
+		cancel:                        cancel,
+		cluster:                       cluster,
+		containerInstanceArn:          containerInstanceArn,
+		acsClient:                     acsClient,
+		dataClient:                    dataClient,
+		drainState:                    drainState,
+		deregisterInstanceEventStream: deregisterInstanceEventStream,
+		inFlightAckTracker:            newInFlightAckTracker(),
+		routines:                      &handlerRoutines{},
+	}
+}
+
+// handlerFunc returns the request handler function for the ContainerInstanceStatusMessage
+func (handler *containerInstanceStatusHandler) handlerFunc() func(message *ecsacs.ContainerInstanceStatusMessage) {
+	return func(message *ecsacs.ContainerInstanceStatusMessage) {
+		handler.trackReceived("ContainerInstanceStatusMessage", aws.StringValue(message.MessageId))
+		select {
+		case handler.messageBuffer <- message:
+		case <-handler.ctx.Done():
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// start invokes go routines to handle container instance status messages
+func (handler *containerInstanceStatusHandler) start() {
+	handler.routines.run(handler.handleMessages)
+}
+
+// stop is used to invoke a cancellation function
+func (handler *containerInstanceStatusHandler) stop() {
+	handler.cancel()
+}
+
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (handler *containerInstanceStatusHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, handler.stop, handler.routines, nil)
+}
+
+// handleMessages processes the container instance status messages in-order
+func (handler *containerInstanceStatusHandler) handleMessages() {
+	for {
+		select {
+		case <-handler.ctx.Done():
+			return
+		case message := <-handler.messageBuffer:
+			if err := handler.handleSingleMessage(message); err != nil {
+				seelog.Warnf("Unable to handle container instance status message [%s]: %v", message.String(), err)
+			}
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// handleSingleMessage applies the status of the container instance, persists it
+// and acks the message. The message is not acked if the status could not be
+// persisted, so that ACS resends it
+func (handler *containerInstanceStatusHandler) handleSingleMessage(message *ecsacs.ContainerInstanceStatusMessage) error {
+	if message.MessageId == nil {
+		return fmt.Errorf("container instance status handler: message id not set in message")
+	}
+	status := aws.StringValue(message.Status)
+	switch status {
+	case containerInstanceStatusDraining:
+		// Stop accepting new tasks before notifying the listeners
+		handler.drainState.setDraining()
+		seelog.Infof("Container instance status set to DRAINING, not accepting new tasks, message id: %s",
+			aws.StringValue(message.MessageId))
+		if handler.deregisterInstanceEventStream != nil {
+			err := writeConnectionEvent(handler.deregisterInstanceEventStream, eventstream.ConnectionEvent{
+				Type:   eventstream.InstanceStatusChanged,
+				Status: status,
+			})
+			if err != nil {
+				seelog.Debugf("Failed to write to deregister container instance event stream, err: %v", err)
+			}
+		}
+	case containerInstanceStatusActive:
+		handler.drainState.setActive()
+		seelog.Infof("Container instance status set to ACTIVE, accepting new tasks, message id: %s",
+			aws.StringValue(message.MessageId))
+	default:
+		return fmt.Errorf("container instance status handler: unsupported status %q", status)
+	}
+
+	if err := handler.dataClient.SaveMetadata(data.ContainerInstanceStatusKey, status); err != nil {
+		return fmt.Errorf("container instance status handler: unable to save status: %v", err)
+	}
+	return handler.acsClient.MakeRequest(&ecsacs.AckRequest{
+		Cluster:           aws.String(handler.cluster),
+		ContainerInstance: aws.String(handler.containerInstanceArn),
+		MessageId:         message.MessageId,
+	})
+}
@@ -0,0 +1,139 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	statusTestCluster              = "mock-cluster"
+	statusTestContainerInstanceArn = "mock-container-instance"
+	statusTestMessageId            = "mock-message-id"
+)
+
+func newTestContainerInstanceStatusHandler(ctx context.Context, ctrl *gomock.Controller, dataClient data.Client,
+	eventStream *eventstream.DeregisterInstanceEventStream) (containerInstanceStatusHandler, *mock_wsclient.MockClientServer) {
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	handler := newContainerInstanceStatusHandler(ctx, statusTestCluster, statusTestContainerInstanceArn,
+		mockWSClient, dataClient, &taskDrainState{}, eventStream)
+	return handler, mockWSClient
+}
+
+func containerInstanceStatusMessage(status string) *ecsacs.ContainerInstanceStatusMessage {
+	return &ecsacs.ContainerInstanceStatusMessage{
+		ClusterArn:           aws.String(statusTestCluster),
+		ContainerInstanceArn: aws.String(statusTestContainerInstanceArn),
+		MessageId:            aws.String(statusTestMessageId),
+		Status:               aws.String(status),
+	}
+}
+
+func statusTestAckRequest() *ecsacs.AckRequest {
+	return &ecsacs.AckRequest{
+		Cluster:           aws.String(statusTestCluster),
+		ContainerInstance: aws.String(statusTestContainerInstanceArn),
+		MessageId:         aws.String(statusTestMessageId),
+	}
+}
+
+func TestContainerInstanceStatusDraining(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	eventStream := eventstream.NewDeregisterInstanceEventStream("DeregisterContainerInstance", ctx)
+	events := subscribeTestConnectionEvents(t, eventStream)
+	eventStream.StartListening()
+
+	handler, mockWSClient := newTestContainerInstanceStatusHandler(ctx, ctrl, dataClient, eventStream)
+	mockWSClient.EXPECT().MakeRequest(statusTestAckRequest()).Return(nil)
+
+	require.NoError(t, handler.handleSingleMessage(containerInstanceStatusMessage("DRAINING")))
+	assert.True(t, handler.drainState.isDraining())
+	select {
+	case event := <-events:
+		assert.Equal(t, connectionEventPayload(eventstream.ConnectionEvent{
+			Type:   eventstream.InstanceStatusChanged,
+			Status: "DRAINING",
+		}), event)
+	case <-time.After(time.Second):
+		t.Fatal("DRAINING event not written to the event stream")
+	}
+
+	// The DRAINING status is restored when the agent restarts
+	assert.True(t, loadTaskDrainState(dataClient).isDraining())
+}
+
+func TestContainerInstanceStatusActive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	handler, mockWSClient := newTestContainerInstanceStatusHandler(context.TODO(), ctrl, dataClient, nil)
+	mockWSClient.EXPECT().MakeRequest(statusTestAckRequest()).Return(nil).Times(2)
+
+	require.NoError(t, handler.handleSingleMessage(containerInstanceStatusMessage("DRAINING")))
+	require.NoError(t, handler.handleSingleMessage(containerInstanceStatusMessage("ACTIVE")))
+	assert.False(t, handler.drainState.isDraining())
+	assert.False(t, loadTaskDrainState(dataClient).isDraining())
+}
+
+func TestContainerInstanceStatusUnsupportedStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	handler, _ := newTestContainerInstanceStatusHandler(context.TODO(), ctrl, dataClient, nil)
+	assert.Error(t, handler.handleSingleMessage(containerInstanceStatusMessage("INACTIVE")))
+	assert.False(t, handler.drainState.isDraining())
+}
+
+func TestContainerInstanceStatusNoMessageId(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler, _ := newTestContainerInstanceStatusHandler(context.TODO(), ctrl, data.NewNoopClient(), nil)
+	assert.Error(t, handler.handleSingleMessage(&ecsacs.ContainerInstanceStatusMessage{
+		Status: aws.String("DRAINING"),
+	}))
+	assert.False(t, handler.drainState.isDraining())
+}
+
+func TestLoadTaskDrainStateWithoutSavedStatus(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	assert.False(t, loadTaskDrainState(dataClient).isDraining())
+	assert.False(t, loadTaskDrainState(nil).isDraining())
+}
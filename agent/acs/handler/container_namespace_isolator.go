@@ -0,0 +1,320 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// namespaceHostVethName is the name of the end of the veth pair in the host
+	// network namespace
+	namespaceHostVethName = "ecs-acs-host"
+	// namespacePeerVethName is the name of the end of the veth pair in the ACS
+	// network namespace
+	namespacePeerVethName = "ecs-acs-ns"
+	// namespaceLoopbackName is the name of the loopback interface of the ACS
+	// network namespace
+	namespaceLoopbackName = "lo"
+	// namespaceDialTimeout is the timeout of the connections opened from the
+	// ACS network namespace, including the resolution of the address
+	namespaceDialTimeout = 30 * time.Second
+)
+
+var (
+	// namespaceHostAddress is the address of the host end of the veth pair,
+	// used as the default gateway of the ACS network namespace. The link local
+	// range doesn't overlap the 169.254.172.0/22 range used by the task bridge
+	namespaceHostAddress = &net.IPNet{IP: net.IPv4(169, 254, 176, 1), Mask: net.CIDRMask(30, 32)}
+	// namespacePeerAddress is the address of the end of the veth pair in the
+	// ACS network namespace
+	namespacePeerAddress = &net.IPNet{IP: net.IPv4(169, 254, 176, 2), Mask: net.CIDRMask(30, 32)}
+)
+
+// netDialUser is implemented by websocket clients whose network connections can
+// be opened by a custom function
+type netDialUser interface {
+	UseNetDial(dial func(network, address string) (net.Conn, error))
+}
+
+// namespaceSyscalls wraps the system calls and netlink requests used to set up
+// the ACS network namespace. Namespace operations apply to the calling OS thread,
+// link operations apply to the network namespace of the calling OS thread
+type namespaceSyscalls interface {
+	// unshareNetNS moves the calling thread into a new network namespace
+	unshareNetNS() error
+	// openThreadNetNS returns a file descriptor referring to the network
+	// namespace of the calling thread
+	openThreadNetNS() (int, error)
+	// setNetNS moves the calling thread into the network namespace referred to
+	// by the file descriptor
+	setNetNS(fd int) error
+	// closeFd closes the file descriptor
+	closeFd(fd int) error
+	// createVethPair creates a veth pair with the given interface names
+	createVethPair(name, peerName string) error
+	// moveLinkToNetNS moves the interface into the network namespace referred
+	// to by the file descriptor
+	moveLinkToNetNS(name string, fd int) error
+	// setLinkUp brings the interface up
+	setLinkUp(name string) error
+	// addLinkAddress assigns the address to the interface
+	addLinkAddress(name string, address *net.IPNet) error
+	// addDefaultRoute adds a default route through the gateway, over the interface
+	addDefaultRoute(name string, gateway net.IP) error
+	// deleteLink deletes the interface, if it exists
+	deleteLink(name string) error
+}
+
+// ContainerNamespaceIsolator isolates the connections of the ACS session from
+// the host network namespace shared with the containers, when configured with
+// ACSHandlerNetworkNamespace. A new network namespace is created for every
+// connection to ACS, and connected to the host namespace through a veth pair.
+//
+// Network namespaces are a property of OS threads, not goroutines: the sockets
+// of the session are opened from an OS thread locked into the namespace, and
+// remain in the namespace once the thread moves back to the host namespace.
+// Addresses are resolved from the host namespace, which keeps its DNS setup
+type ContainerNamespaceIsolator struct {
+	syscalls  namespaceSyscalls
+	lock      sync.RWMutex
+	namespace int
+}
+
+// newContainerNamespaceIsolator returns a new ContainerNamespaceIsolator object,
+// or nil if the network namespace isn't enabled
+func newContainerNamespaceIsolator(enabled bool, syscalls namespaceSyscalls) *ContainerNamespaceIsolator {
+	if !enabled {
+		return nil
+	}
+	return &ContainerNamespaceIsolator{
+		syscalls:  syscalls,
+		namespace: -1,
+	}
+}
+
+// create creates the network namespace of a connection to ACS, the veth pair
+// linking it to the host namespace and the default route through the host
+func (isolator *ContainerNamespaceIsolator) create() error {
+	if isolator == nil {
+		return nil
+	}
+	isolator.lock.Lock()
+	defer isolator.lock.Unlock()
+
+	// Remove the links of a namespace that couldn't be destroyed, so that they
+	// don't conflict with the new ones
+	if err := isolator.syscalls.deleteLink(namespaceHostVethName); err != nil {
+		return errors.Wrapf(err, "unable to delete the stale %s interface", namespaceHostVethName)
+	}
+	var namespace int
+	err := isolator.onThread(func(hostNamespace int) error {
+		if err := isolator.syscalls.unshareNetNS(); err != nil {
+			return errors.Wrap(err, "unable to create the network namespace")
+		}
+		var err error
+		namespace, err = isolator.syscalls.openThreadNetNS()
+		if err != nil {
+			return errors.Wrap(err, "unable to open the network namespace")
+		}
+		if err = isolator.configure(hostNamespace, namespace); err != nil {
+			isolator.syscalls.closeFd(namespace)
+		}
+		return err
+	})
+	if err != nil {
+		isolator.syscalls.deleteLink(namespaceHostVethName)
+		return err
+	}
+	isolator.namespace = namespace
+	seelog.Infof("Created the network namespace of the connection to ACS, gateway: %s", namespaceHostAddress.IP)
+	return nil
+}
+
+// configure links the network namespace to the host namespace. It's invoked
+// from the namespace and leaves the thread in the namespace
+func (isolator *ContainerNamespaceIsolator) configure(hostNamespace, namespace int) error {
+	if err := isolator.syscalls.setNetNS(hostNamespace); err != nil {
+		return errors.Wrap(err, "unable to switch to the host network namespace")
+	}
+	if err := isolator.syscalls.createVethPair(namespaceHostVethName, namespacePeerVethName); err != nil {
+		return errors.Wrap(err, "unable to create the veth pair")
+	}
+	if err := isolator.syscalls.addLinkAddress(namespaceHostVethName, namespaceHostAddress); err != nil {
+		return errors.Wrapf(err, "unable to assign the address of the %s interface", namespaceHostVethName)
+	}
+	if err := isolator.syscalls.setLinkUp(namespaceHostVethName); err != nil {
+		return errors.Wrapf(err, "unable to bring the %s interface up", namespaceHostVethName)
+	}
+	if err := isolator.syscalls.moveLinkToNetNS(namespacePeerVethName, namespace); err != nil {
+		return errors.Wrapf(err, "unable to move the %s interface to the network namespace", namespacePeerVethName)
+	}
+
+	if err := isolator.syscalls.setNetNS(namespace); err != nil {
+		return errors.Wrap(err, "unable to switch to the network namespace")
+	}
+	if err := isolator.syscalls.setLinkUp(namespaceLoopbackName); err != nil {
+		return errors.Wrap(err, "unable to bring the loopback interface up")
+	}
+	if err := isolator.syscalls.addLinkAddress(namespacePeerVethName, namespacePeerAddress); err != nil {
+		return errors.Wrapf(err, "unable to assign the address of the %s interface", namespacePeerVethName)
+	}
+	if err := isolator.syscalls.setLinkUp(namespacePeerVethName); err != nil {
+		return errors.Wrapf(err, "unable to bring the %s interface up", namespacePeerVethName)
+	}
+	if err := isolator.syscalls.addDefaultRoute(namespacePeerVethName, namespaceHostAddress.IP); err != nil {
+		return errors.Wrap(err, "unable to add the default route of the network namespace")
+	}
+	return nil
+}
+
+// destroy deletes the veth pair of the network namespace and releases the
+// namespace. The kernel frees the namespace once the sockets opened in it are
+// closed as well
+func (isolator *ContainerNamespaceIsolator) destroy() error {
+	if isolator == nil {
+		return nil
+	}
+	isolator.lock.Lock()
+	defer isolator.lock.Unlock()
+
+	if isolator.namespace < 0 {
+		return nil
+	}
+	// Deleting one end of the veth pair deletes the other one
+	err := isolator.syscalls.deleteLink(namespaceHostVethName)
+	if closeErr := isolator.syscalls.closeFd(isolator.namespace); err == nil {
+		err = closeErr
+	}
+	isolator.namespace = -1
+	return err
+}
+
+// use makes the client open its connections from the network namespace
+func (isolator *ContainerNamespaceIsolator) use(client wsclient.ClientServer, log logger.Logger) {
+	if isolator == nil {
+		return
+	}
+	if dialUser, ok := client.(netDialUser); ok {
+		dialUser.UseNetDial(isolator.dial)
+		return
+	}
+	log.Warnf("The ACS client doesn't support custom dialers, it will connect from the host network namespace")
+}
+
+// dialer returns the function opening the connections from the network
+// namespace, or nil if the network namespace isn't enabled
+func (isolator *ContainerNamespaceIsolator) dialer() func(network, address string) (net.Conn, error) {
+	if isolator == nil {
+		return nil
+	}
+	return isolator.dial
+}
+
+// do invokes fn from an OS thread in the network namespace. Goroutines started
+// by fn run in the host namespace
+func (isolator *ContainerNamespaceIsolator) do(fn func() error) error {
+	if isolator == nil {
+		return fn()
+	}
+	isolator.lock.RLock()
+	defer isolator.lock.RUnlock()
+
+	if isolator.namespace < 0 {
+		return errors.New("the network namespace of the connection to ACS doesn't exist")
+	}
+	return isolator.onThread(func(int) error {
+		if err := isolator.syscalls.setNetNS(isolator.namespace); err != nil {
+			return errors.Wrap(err, "unable to switch to the network namespace")
+		}
+		return fn()
+	})
+}
+
+// dial opens a connection to the address from the network namespace. The
+// address is resolved from the host namespace, and each of its IP addresses is
+// dialed in turn until a connection is established
+func (isolator *ContainerNamespaceIsolator) dial(network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), namespaceDialTimeout)
+	defer cancel()
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	err = isolator.do(func() error {
+		dialErr := fmt.Errorf("no %s address found for %s", network, host)
+		for _, ipAddress := range addresses {
+			if (network == "tcp4" && ipAddress.IP.To4() == nil) || (network == "tcp6" && ipAddress.IP.To4() != nil) {
+				continue
+			}
+			// Dialing a single IP address opens the socket from the calling
+			// goroutine, and therefore from the namespace
+			var dialer net.Dialer
+			conn, dialErr = dialer.DialContext(ctx, network, net.JoinHostPort(ipAddress.IP.String(), port))
+			if dialErr == nil {
+				return nil
+			}
+		}
+		return dialErr
+	})
+	return conn, err
+}
+
+// onThread invokes fn from a dedicated OS thread, passing it a file descriptor
+// referring to the host network namespace. The thread is moved back to the host
+// namespace once fn returns, and terminated by the runtime if that fails, so
+// that other goroutines never run in the namespace
+func (isolator *ContainerNamespaceIsolator) onThread(fn func(hostNamespace int) error) error {
+	result := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		hostNamespace, err := isolator.syscalls.openThreadNetNS()
+		if err != nil {
+			runtime.UnlockOSThread()
+			result <- errors.Wrap(err, "unable to open the host network namespace")
+			return
+		}
+		defer isolator.syscalls.closeFd(hostNamespace)
+
+		err = fn(hostNamespace)
+		if restoreErr := isolator.syscalls.setNetNS(hostNamespace); restoreErr != nil {
+			// The thread stays locked, the runtime terminates it when the
+			// goroutine exits
+			seelog.Errorf("Unable to switch back to the host network namespace, terminating the thread: %v", restoreErr)
+			if err == nil {
+				err = restoreErr
+			}
+		} else {
+			runtime.UnlockOSThread()
+		}
+		result <- err
+	}()
+	return <-result
+}
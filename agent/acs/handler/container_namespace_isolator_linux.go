@@ -0,0 +1,99 @@
+//go:build linux
+// +build linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// linuxNamespaceSyscalls implements namespaceSyscalls with the syscall and
+// netlink packages
+type linuxNamespaceSyscalls struct{}
+
+// newNamespaceSyscalls returns the namespaceSyscalls of the platform
+func newNamespaceSyscalls() namespaceSyscalls {
+	return linuxNamespaceSyscalls{}
+}
+
+func (linuxNamespaceSyscalls) unshareNetNS() error {
+	return syscall.Unshare(syscall.CLONE_NEWNET)
+}
+
+func (linuxNamespaceSyscalls) openThreadNetNS() (int, error) {
+	return unix.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+}
+
+func (linuxNamespaceSyscalls) setNetNS(fd int) error {
+	return unix.Setns(fd, unix.CLONE_NEWNET)
+}
+
+func (linuxNamespaceSyscalls) closeFd(fd int) error {
+	return unix.Close(fd)
+}
+
+func (linuxNamespaceSyscalls) createVethPair(name, peerName string) error {
+	return netlink.LinkAdd(&netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: name},
+		PeerName:  peerName,
+	})
+}
+
+func (linuxNamespaceSyscalls) moveLinkToNetNS(name string, fd int) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	return netlink.LinkSetNsFd(link, fd)
+}
+
+func (linuxNamespaceSyscalls) setLinkUp(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	return netlink.LinkSetUp(link)
+}
+
+func (linuxNamespaceSyscalls) addLinkAddress(name string, address *net.IPNet) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	return netlink.AddrAdd(link, &netlink.Addr{IPNet: address})
+}
+
+func (linuxNamespaceSyscalls) addDefaultRoute(name string, gateway net.IP) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return err
+	}
+	return netlink.RouteAdd(&netlink.Route{LinkIndex: link.Attrs().Index, Gw: gateway})
+}
+
+func (linuxNamespaceSyscalls) deleteLink(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		// The link doesn't exist
+		return nil
+	}
+	return netlink.LinkDel(link)
+}
@@ -0,0 +1,322 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fakeHostNamespace = "host"
+
+// fakeLink is an interface of the fake network namespaces
+type fakeLink struct {
+	namespace string
+	addresses []string
+	up        bool
+}
+
+// fakeNamespaceSyscalls mocks the system calls used to set up the network
+// namespace. It tracks the namespace of the calling thread, the file descriptors
+// referring to namespaces and the interfaces of each namespace
+type fakeNamespaceSyscalls struct {
+	lock       sync.Mutex
+	current    string
+	namespaces int
+	nextFd     int
+	fds        map[int]string
+	links      map[string]*fakeLink
+	routes     map[string]string
+	switches   []string
+	failOn     string
+}
+
+func newFakeNamespaceSyscalls() *fakeNamespaceSyscalls {
+	return &fakeNamespaceSyscalls{
+		current: fakeHostNamespace,
+		nextFd:  3,
+		fds:     make(map[int]string),
+		links:   map[string]*fakeLink{namespaceLoopbackName: {namespace: fakeHostNamespace, up: true}},
+		routes:  make(map[string]string),
+	}
+}
+
+func (fake *fakeNamespaceSyscalls) fail(call string) error {
+	if fake.failOn == call {
+		return fmt.Errorf("%s failed", call)
+	}
+	return nil
+}
+
+func (fake *fakeNamespaceSyscalls) unshareNetNS() error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if err := fake.fail("unshareNetNS"); err != nil {
+		return err
+	}
+	fake.namespaces++
+	fake.current = fmt.Sprintf("acs-%d", fake.namespaces)
+	fake.links[fake.current+"/"+namespaceLoopbackName] = &fakeLink{namespace: fake.current}
+	return nil
+}
+
+func (fake *fakeNamespaceSyscalls) openThreadNetNS() (int, error) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fd := fake.nextFd
+	fake.nextFd++
+	fake.fds[fd] = fake.current
+	return fd, nil
+}
+
+func (fake *fakeNamespaceSyscalls) setNetNS(fd int) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	namespace, ok := fake.fds[fd]
+	if !ok {
+		return fmt.Errorf("bad file descriptor %d", fd)
+	}
+	fake.current = namespace
+	fake.switches = append(fake.switches, namespace)
+	return nil
+}
+
+func (fake *fakeNamespaceSyscalls) closeFd(fd int) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	delete(fake.fds, fd)
+	return nil
+}
+
+// link returns the interface with the name in the namespace of the thread
+func (fake *fakeNamespaceSyscalls) link(name string) (*fakeLink, error) {
+	key := name
+	if fake.current != fakeHostNamespace && name == namespaceLoopbackName {
+		key = fake.current + "/" + name
+	}
+	link, ok := fake.links[key]
+	if !ok || link.namespace != fake.current {
+		return nil, fmt.Errorf("link %s not found in namespace %s", name, fake.current)
+	}
+	return link, nil
+}
+
+func (fake *fakeNamespaceSyscalls) createVethPair(name, peerName string) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if err := fake.fail("createVethPair"); err != nil {
+		return err
+	}
+	fake.links[name] = &fakeLink{namespace: fake.current}
+	fake.links[peerName] = &fakeLink{namespace: fake.current}
+	return nil
+}
+
+func (fake *fakeNamespaceSyscalls) moveLinkToNetNS(name string, fd int) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	link, err := fake.link(name)
+	if err != nil {
+		return err
+	}
+	link.namespace = fake.fds[fd]
+	return nil
+}
+
+func (fake *fakeNamespaceSyscalls) setLinkUp(name string) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	link, err := fake.link(name)
+	if err != nil {
+		return err
+	}
+	link.up = true
+	return nil
+}
+
+func (fake *fakeNamespaceSyscalls) addLinkAddress(name string, address *net.IPNet) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	link, err := fake.link(name)
+	if err != nil {
+		return err
+	}
+	link.addresses = append(link.addresses, address.String())
+	return nil
+}
+
+func (fake *fakeNamespaceSyscalls) addDefaultRoute(name string, gateway net.IP) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if err := fake.fail("addDefaultRoute"); err != nil {
+		return err
+	}
+	if _, err := fake.link(name); err != nil {
+		return err
+	}
+	fake.routes[fake.current] = name + " via " + gateway.String()
+	return nil
+}
+
+func (fake *fakeNamespaceSyscalls) deleteLink(name string) error {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if _, ok := fake.links[name]; ok {
+		// Deleting one end of the veth pair deletes the other one
+		delete(fake.links, namespaceHostVethName)
+		delete(fake.links, namespacePeerVethName)
+	}
+	return nil
+}
+
+func TestNewContainerNamespaceIsolatorDisabled(t *testing.T) {
+	isolator := newContainerNamespaceIsolator(false, newFakeNamespaceSyscalls())
+	assert.Nil(t, isolator)
+
+	// A nil isolator runs everything in the host namespace
+	assert.NoError(t, isolator.create())
+	ran := false
+	assert.NoError(t, isolator.do(func() error {
+		ran = true
+		return nil
+	}))
+	assert.True(t, ran)
+	assert.NoError(t, isolator.destroy())
+}
+
+func TestContainerNamespaceIsolatorCreate(t *testing.T) {
+	syscalls := newFakeNamespaceSyscalls()
+	isolator := newContainerNamespaceIsolator(true, syscalls)
+	require.NoError(t, isolator.create())
+
+	// The host end of the veth pair stays in the host namespace, the other end
+	// is moved to the new namespace, whose default route goes through the host
+	hostVeth := syscalls.links[namespaceHostVethName]
+	require.NotNil(t, hostVeth)
+	assert.Equal(t, fakeHostNamespace, hostVeth.namespace)
+	assert.Equal(t, []string{"169.254.176.1/30"}, hostVeth.addresses)
+	assert.True(t, hostVeth.up)
+	peerVeth := syscalls.links[namespacePeerVethName]
+	require.NotNil(t, peerVeth)
+	assert.Equal(t, "acs-1", peerVeth.namespace)
+	assert.Equal(t, []string{"169.254.176.2/30"}, peerVeth.addresses)
+	assert.True(t, peerVeth.up)
+	assert.True(t, syscalls.links["acs-1/"+namespaceLoopbackName].up)
+	assert.Equal(t, map[string]string{"acs-1": namespacePeerVethName + " via 169.254.176.1"}, syscalls.routes)
+
+	// The thread is moved back to the host namespace, only the file descriptor
+	// of the new namespace remains open
+	assert.Equal(t, fakeHostNamespace, syscalls.current)
+	assert.Equal(t, map[int]string{isolator.namespace: "acs-1"}, syscalls.fds)
+}
+
+func TestContainerNamespaceIsolatorDo(t *testing.T) {
+	syscalls := newFakeNamespaceSyscalls()
+	isolator := newContainerNamespaceIsolator(true, syscalls)
+	require.NoError(t, isolator.create())
+
+	var namespace string
+	require.NoError(t, isolator.do(func() error {
+		namespace = syscalls.current
+		return nil
+	}))
+	assert.Equal(t, "acs-1", namespace, "fn should run in the namespace of the connection")
+	assert.Equal(t, fakeHostNamespace, syscalls.current, "the thread should be moved back to the host namespace")
+
+	fnErr := errors.New("fn error")
+	assert.Equal(t, fnErr, isolator.do(func() error { return fnErr }))
+	assert.Equal(t, fakeHostNamespace, syscalls.current)
+}
+
+func TestContainerNamespaceIsolatorDestroy(t *testing.T) {
+	syscalls := newFakeNamespaceSyscalls()
+	isolator := newContainerNamespaceIsolator(true, syscalls)
+	require.NoError(t, isolator.create())
+	require.NoError(t, isolator.destroy())
+
+	assert.NotContains(t, syscalls.links, namespaceHostVethName)
+	assert.NotContains(t, syscalls.links, namespacePeerVethName)
+	assert.Empty(t, syscalls.fds)
+	assert.NoError(t, isolator.destroy(), "destroying twice should be a no-op")
+	assert.Error(t, isolator.do(func() error { return nil }), "the destroyed namespace should not be used")
+
+	// Every connection gets a new namespace
+	require.NoError(t, isolator.create())
+	assert.Equal(t, "acs-2", syscalls.links[namespacePeerVethName].namespace)
+}
+
+func TestContainerNamespaceIsolatorCreateFailure(t *testing.T) {
+	for _, call := range []string{"unshareNetNS", "createVethPair", "addDefaultRoute"} {
+		t.Run(call, func(t *testing.T) {
+			syscalls := newFakeNamespaceSyscalls()
+			syscalls.failOn = call
+			isolator := newContainerNamespaceIsolator(true, syscalls)
+
+			assert.Error(t, isolator.create())
+			assert.Equal(t, fakeHostNamespace, syscalls.current)
+			assert.Empty(t, syscalls.fds, "the namespace should be released")
+			assert.NotContains(t, syscalls.links, namespaceHostVethName)
+			assert.Error(t, isolator.do(func() error { return nil }))
+		})
+	}
+}
+
+func TestContainerNamespaceIsolatorDial(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	syscalls := newFakeNamespaceSyscalls()
+	isolator := newContainerNamespaceIsolator(true, syscalls)
+	require.NoError(t, isolator.create())
+	syscalls.switches = nil
+
+	conn, err := isolator.dial("tcp4", listener.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+	assert.Equal(t, []string{"acs-1", fakeHostNamespace}, syscalls.switches,
+		"the connection should be opened from the namespace")
+
+	_, err = isolator.dial("tcp6", listener.Addr().String())
+	assert.Error(t, err, "no IPv6 address should be found")
+}
+
+func TestContainerNamespaceIsolatorUse(t *testing.T) {
+	isolator := newContainerNamespaceIsolator(true, newFakeNamespaceSyscalls())
+	client := &wsclient.ClientServerImpl{}
+	isolator.use(client, logger.NewNilSafeLogger(nil))
+	assert.NotNil(t, client.NetDial)
+
+	var disabled *ContainerNamespaceIsolator
+	client = &wsclient.ClientServerImpl{}
+	disabled.use(client, logger.NewNilSafeLogger(nil))
+	assert.Nil(t, client.NetDial)
+}
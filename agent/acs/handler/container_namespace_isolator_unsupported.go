@@ -0,0 +1,73 @@
+//go:build !linux
+// +build !linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"net"
+)
+
+var errNetworkNamespacesUnsupported = errors.New("network namespaces are only supported on linux")
+
+// unsupportedNamespaceSyscalls implements namespaceSyscalls on platforms
+// without network namespaces
+type unsupportedNamespaceSyscalls struct{}
+
+// newNamespaceSyscalls returns the namespaceSyscalls of the platform
+func newNamespaceSyscalls() namespaceSyscalls {
+	return unsupportedNamespaceSyscalls{}
+}
+
+func (unsupportedNamespaceSyscalls) unshareNetNS() error {
+	return errNetworkNamespacesUnsupported
+}
+
+func (unsupportedNamespaceSyscalls) openThreadNetNS() (int, error) {
+	return -1, errNetworkNamespacesUnsupported
+}
+
+func (unsupportedNamespaceSyscalls) setNetNS(fd int) error {
+	return errNetworkNamespacesUnsupported
+}
+
+func (unsupportedNamespaceSyscalls) closeFd(fd int) error {
+	return errNetworkNamespacesUnsupported
+}
+
+func (unsupportedNamespaceSyscalls) createVethPair(name, peerName string) error {
+	return errNetworkNamespacesUnsupported
+}
+
+func (unsupportedNamespaceSyscalls) moveLinkToNetNS(name string, fd int) error {
+	return errNetworkNamespacesUnsupported
+}
+
+func (unsupportedNamespaceSyscalls) setLinkUp(name string) error {
+	return errNetworkNamespacesUnsupported
+}
+
+func (unsupportedNamespaceSyscalls) addLinkAddress(name string, address *net.IPNet) error {
+	return errNetworkNamespacesUnsupported
+}
+
+func (unsupportedNamespaceSyscalls) addDefaultRoute(name string, gateway net.IP) error {
+	return errNetworkNamespacesUnsupported
+}
+
+func (unsupportedNamespaceSyscalls) deleteLink(name string) error {
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/statechange"
+	"github.com/cihub/seelog"
+)
+
+// deregistrationGracePeriod holds back the deregistration event of the
+// container instance, once ACS reports it inactive, until the tasks still
+// running on the instance are stopped, so that they aren't orphaned. New tasks
+// aren't accepted meanwhile. The event is emitted anyway once the grace period
+// is over
+type deregistrationGracePeriod struct {
+	period     time.Duration
+	taskEngine engine.TaskEngine
+	drainState *taskDrainState
+	// taskStopped is signaled whenever a task is stopped, so that the running
+	// tasks are counted again
+	taskStopped chan struct{}
+	lock        sync.Mutex
+	// waiting is true while the deregistration event is held back
+	waiting bool
+}
+
+// newDeregistrationGracePeriod returns a new deregistrationGracePeriod, nil if
+// the deregistration event isn't held back
+func newDeregistrationGracePeriod(period time.Duration, taskEngine engine.TaskEngine,
+	drainState *taskDrainState) *deregistrationGracePeriod {
+	if period <= 0 || taskEngine == nil {
+		return nil
+	}
+	return &deregistrationGracePeriod{
+		period:      period,
+		taskEngine:  taskEngine,
+		drainState:  drainState,
+		taskStopped: make(chan struct{}, 1),
+	}
+}
+
+// observe signals the stopped tasks, it's registered as an observer of the
+// state changes of the tasks sent by the task engine
+func (grace *deregistrationGracePeriod) observe(event statechange.Event) {
+	change, ok := event.(api.TaskStateChange)
+	if !ok || change.Status != apitaskstatus.TaskStopped {
+		return
+	}
+	// Observers mustn't block the task handler
+	select {
+	case grace.taskStopped <- struct{}{}:
+	default:
+	}
+}
+
+// hold stops the instance from accepting new tasks and calls emit once the
+// running tasks are stopped or the grace period is over, unless the context is
+// cancelled first. The event is only held back once at a time, it returns
+// false if it's already held back
+func (grace *deregistrationGracePeriod) hold(ctx context.Context, emit func()) bool {
+	grace.lock.Lock()
+	defer grace.lock.Unlock()
+	if grace.waiting {
+		return false
+	}
+	grace.waiting = true
+	if grace.drainState != nil {
+		grace.drainState.setDraining()
+	}
+	go grace.wait(ctx, emit)
+	return true
+}
+
+// wait calls emit once the running tasks are stopped or the grace period is over
+func (grace *deregistrationGracePeriod) wait(ctx context.Context, emit func()) {
+	defer func() {
+		grace.lock.Lock()
+		grace.waiting = false
+		grace.lock.Unlock()
+	}()
+	deadline := time.NewTimer(grace.period)
+	defer deadline.Stop()
+	for {
+		running := grace.runningTasks()
+		if running == 0 {
+			seelog.Info("No task running on the deregistered container instance, emitting the deregistration event")
+			emit()
+			return
+		}
+		seelog.Infof("Waiting for %d tasks to stop before emitting the deregistration event", running)
+		select {
+		case <-grace.taskStopped:
+		case <-deadline.C:
+			seelog.Warnf("Deregistration grace period of %s is over with %d tasks still running, emitting the deregistration event",
+				grace.period.String(), grace.runningTasks())
+			emit()
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runningTasks returns the number of tasks of the task engine not yet stopped
+func (grace *deregistrationGracePeriod) runningTasks() int {
+	tasks, err := grace.taskEngine.ListTasks()
+	if err != nil {
+		seelog.Warnf("Unable to list the tasks of the deregistered container instance: %v", err)
+		return 0
+	}
+	running := 0
+	for _, task := range tasks {
+		if task.GetKnownStatus() < apitaskstatus.TaskStopped {
+			running++
+		}
+	}
+	return running
+}
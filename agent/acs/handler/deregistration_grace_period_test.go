@@ -0,0 +1,193 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testGraceTask returns a task whose known status is the status
+func testGraceTask(arn string, status apitaskstatus.TaskStatus) *apitask.Task {
+	task := &apitask.Task{Arn: arn}
+	task.SetKnownStatus(status)
+	return task
+}
+
+// waitForEmit waits for the deregistration event to be emitted, it returns
+// false if it isn't emitted within the timeout
+func waitForEmit(emitted <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-emitted:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func TestNewDeregistrationGracePeriodDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	assert.Nil(t, newDeregistrationGracePeriod(0, mock_engine.NewMockTaskEngine(ctrl), &taskDrainState{}))
+	assert.Nil(t, newDeregistrationGracePeriod(time.Minute, nil, &taskDrainState{}))
+}
+
+func TestDeregistrationGracePeriodNoRunningTask(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().ListTasks().Return([]*apitask.Task{
+		testGraceTask(testTaskARN, apitaskstatus.TaskStopped),
+	}, nil)
+	drainState := &taskDrainState{}
+	grace := newDeregistrationGracePeriod(time.Minute, taskEngine, drainState)
+
+	emitted := make(chan struct{}, 1)
+	require.True(t, grace.hold(context.Background(), func() { emitted <- struct{}{} }))
+	assert.True(t, waitForEmit(emitted, 5*time.Second), "deregistration event not emitted")
+	// New tasks aren't accepted once the instance is deregistered
+	assert.True(t, drainState.isDraining())
+}
+
+// TestDeregistrationGracePeriodTasksStopWithinGracePeriod tests that the
+// deregistration event is emitted as soon as the running tasks are stopped
+func TestDeregistrationGracePeriodTasksStopWithinGracePeriod(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var lock sync.Mutex
+	taskStatus := apitaskstatus.TaskRunning
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().ListTasks().DoAndReturn(func() ([]*apitask.Task, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		return []*apitask.Task{testGraceTask(testTaskARN, taskStatus)}, nil
+	}).MinTimes(2)
+	drainState := &taskDrainState{}
+	grace := newDeregistrationGracePeriod(time.Hour, taskEngine, drainState)
+
+	emitted := make(chan struct{}, 1)
+	require.True(t, grace.hold(context.Background(), func() { emitted <- struct{}{} }))
+	assert.True(t, drainState.isDraining())
+	assert.False(t, waitForEmit(emitted, 100*time.Millisecond), "deregistration event emitted with a task running")
+	// The event is only held back once at a time
+	assert.False(t, grace.hold(context.Background(), func() { emitted <- struct{}{} }))
+
+	// Other state changes don't emit the event
+	grace.observe(api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning})
+	lock.Lock()
+	taskStatus = apitaskstatus.TaskStopped
+	lock.Unlock()
+	grace.observe(api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskStopped})
+	assert.True(t, waitForEmit(emitted, 5*time.Second), "deregistration event not emitted once the task stopped")
+	assert.False(t, waitForEmit(emitted, 50*time.Millisecond), "deregistration event emitted twice")
+}
+
+// TestDeregistrationGracePeriodTasksStillRunningAfterGracePeriod tests that the
+// deregistration event is emitted once the grace period is over, even though
+// tasks are still running
+func TestDeregistrationGracePeriodTasksStillRunningAfterGracePeriod(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().ListTasks().Return([]*apitask.Task{
+		testGraceTask(testTaskARN, apitaskstatus.TaskRunning),
+		testGraceTask(testTaskARN+"-2", apitaskstatus.TaskStopped),
+	}, nil).MinTimes(1)
+	grace := newDeregistrationGracePeriod(100*time.Millisecond, taskEngine, &taskDrainState{})
+
+	emitted := make(chan struct{}, 1)
+	start := time.Now()
+	require.True(t, grace.hold(context.Background(), func() { emitted <- struct{}{} }))
+	require.True(t, waitForEmit(emitted, 5*time.Second), "deregistration event not emitted after the grace period")
+	assert.True(t, time.Since(start) >= 100*time.Millisecond, "deregistration event emitted before the grace period")
+
+	// The event is held back again if the instance is reported inactive again
+	require.True(t, grace.hold(context.Background(), func() { emitted <- struct{}{} }))
+	assert.True(t, waitForEmit(emitted, 5*time.Second), "deregistration event not emitted after the grace period")
+}
+
+func TestDeregistrationGracePeriodCancelled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().ListTasks().Return([]*apitask.Task{
+		testGraceTask(testTaskARN, apitaskstatus.TaskRunning),
+	}, nil).MinTimes(1)
+	grace := newDeregistrationGracePeriod(time.Hour, taskEngine, &taskDrainState{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	emitted := make(chan struct{}, 1)
+	require.True(t, grace.hold(ctx, func() { emitted <- struct{}{} }))
+	cancel()
+	assert.False(t, waitForEmit(emitted, 100*time.Millisecond), "deregistration event emitted once the session was cancelled")
+}
+
+// TestSessionEmitsDeregistrationRightAwayWithZeroGracePeriod tests that setting
+// ECS_ACS_DEREGISTRATION_GRACE_PERIOD to 0 notifies the deregistration of the
+// container instance right away, without waiting for the running tasks
+func TestSessionEmitsDeregistrationRightAwayWithZeroGracePeriod(t *testing.T) {
+	os.Setenv("AWS_DEFAULT_REGION", "us-west-2")
+	defer os.Unsetenv("AWS_DEFAULT_REGION")
+	os.Setenv("ECS_ACS_DEREGISTRATION_GRACE_PERIOD", "0")
+	defer os.Unsetenv("ECS_ACS_DEREGISTRATION_GRACE_PERIOD")
+	cfg, err := config.NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The running tasks aren't listed
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("DeregisterContainerInstance", ctx)
+	events := subscribeTestConnectionEvents(t, deregisterInstanceEventStream)
+	deregisterInstanceEventStream.StartListening()
+	acsSession := NewSession(ctx, SessionParams{
+		Config:                        cfg,
+		ContainerInstanceARN:          "myArn",
+		TaskEngine:                    taskEngine,
+		DeregisterInstanceEventStream: deregisterInstanceEventStream,
+	}).(*session)
+	require.Nil(t, acsSession.deregistrationGrace)
+
+	acsSession.emitDeregistration()
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Deregistration event not emitted")
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/diagnostics"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// diagnosticBundleUploadFailedEvent is the ACS event recorded when a
+	// diagnostic bundle could not be collected or uploaded
+	diagnosticBundleUploadFailedEvent = "DiagnosticBundleUploadFailed"
+)
+
+// bundleUploader uploads diagnostic bundles
+type bundleUploader interface {
+	Upload(url string, data []byte) error
+}
+
+// sessionStatsProvider is implemented by websocket clients that expose stats
+// about their connection
+type sessionStatsProvider interface {
+	SessionStats() wsclient.SessionStats
+}
+
+// diagnosticBundleHandler handles the diagnostic bundle requests sent by ACS.
+// The state of the agent is collected into a bundle which is uploaded to the
+// pre-signed S3 URL provided in the request
+type diagnosticBundleHandler struct {
+	messageBuffer        chan *ecsacs.DiagnosticBundleRequest
+	ctx                  context.Context
+	cancel               context.CancelFunc
+	cluster              string
+	containerInstanceArn string
+	acsClient            wsclient.ClientServer
+	taskEngine           engine.TaskEngine
+	dockerClient         dockerapi.DockerClient
+	uploader             bundleUploader
+	logFile              string
+	*inFlightAckTracker
+	routines *handlerRoutines
+}
+
+// newDiagnosticBundleHandler returns an instance of the diagnosticBundleHandler struct
+func newDiagnosticBundleHandler(ctx context.Context,
+	cluster string, containerInstanceArn string, acsClient wsclient.ClientServer,
+	taskEngine engine.TaskEngine, dockerClient dockerapi.DockerClient, logFile string) diagnosticBundleHandler {
+
+	// Create a cancelable context from the parent context
+	derivedContext, cancel := context.WithCancel(ctx)
+	return diagnosticBundleHandler{
+		messageBuffer:        make(chan *ecsacs.DiagnosticBundleRequest),
+		ctx:                  derivedContext,
+		cancel:               cancel,
+		cluster:              cluster,
+		containerInstanceArn: containerInstanceArn,
+		acsClient:            acsClient,
+		taskEngine:           taskEngine,
+		dockerClient:         dockerClient,
+		uploader:             diagnostics.NewS3Uploader(),
+		logFile:              logFile,
+		inFlightAckTracker:   newInFlightAckTracker(),
+		routines:             &handlerRoutines{},
+	}
+}
+
+// handlerFunc returns the request handler function for the DiagnosticBundleRequest.
+// Requests received while a bundle is being uploaded are dropped, ACS resends
+// the request if it is not acked
+func (handler *diagnosticBundleHandler) handlerFunc() func(message *ecsacs.DiagnosticBundleRequest) {
+	return func(message *ecsacs.DiagnosticBundleRequest) {
+		handler.trackReceived("DiagnosticBundleRequest", aws.StringValue(message.MessageId))
+		select {
+		case handler.messageBuffer <- message:
+		default:
+			handler.trackAcked(aws.StringValue(message.MessageId))
+			seelog.Infof("Diagnostic bundle upload already in progress, ignoring request: %s",
+				aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// start invokes go routines to handle diagnostic bundle requests
+func (handler *diagnosticBundleHandler) start() {
+	handler.routines.run(handler.handleMessages)
+}
+
+// stop is used to invoke a cancellation function
+func (handler *diagnosticBundleHandler) stop() {
+	handler.cancel()
+}
+
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (handler *diagnosticBundleHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, handler.stop, handler.routines, nil)
+}
+
+func (handler *diagnosticBundleHandler) handleMessages() {
+	for {
+		select {
+		case <-handler.ctx.Done():
+			return
+		case message := <-handler.messageBuffer:
+			if err := handler.handleSingleMessage(message); err != nil {
+				seelog.Warnf("Unable to handle diagnostic bundle request [%s]: %v", message.String(), err)
+				metrics.MetricsEngineGlobal.RecordACSEvent(diagnosticBundleUploadFailedEvent, 1)
+			}
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// handleSingleMessage collects the diagnostic bundle, uploads it and acks the
+// request once the upload has succeeded
+func (handler *diagnosticBundleHandler) handleSingleMessage(message *ecsacs.DiagnosticBundleRequest) error {
+	if message.MessageId == nil {
+		return fmt.Errorf("diagnostic bundle handler: message id not set in message")
+	}
+	if aws.StringValue(message.UploadUrl) == "" {
+		return fmt.Errorf("diagnostic bundle handler: upload url not set in message")
+	}
+	messageID := aws.StringValue(message.MessageId)
+	seelog.Infof("Collecting diagnostic bundle, message id: %s", messageID)
+
+	collector := diagnostics.NewDiagnosticCollector(handler.taskEngine, handler.dockerClient,
+		handler.sessionStats(), handler.logFile)
+	bundle, err := collector.Collect()
+	if err != nil {
+		return err
+	}
+	if err := handler.uploader.Upload(aws.StringValue(message.UploadUrl), bundle); err != nil {
+		return err
+	}
+
+	seelog.Infof("Uploaded diagnostic bundle of %d bytes, message id: %s", len(bundle), messageID)
+	return handler.acsClient.MakeRequest(&ecsacs.AckRequest{
+		Cluster:           aws.String(handler.cluster),
+		ContainerInstance: aws.String(handler.containerInstanceArn),
+		MessageId:         message.MessageId,
+	})
+}
+
+// sessionStats returns the stats of the current ACS session
+func (handler *diagnosticBundleHandler) sessionStats() diagnostics.SessionStats {
+	stats := diagnostics.SessionStats{
+		Cluster:              handler.cluster,
+		ContainerInstanceARN: handler.containerInstanceArn,
+	}
+	if provider, ok := handler.acsClient.(sessionStatsProvider); ok {
+		stats.IPVersion = provider.SessionStats().IPVersion
+		stats.RequestID = provider.SessionStats().LastRequestID
+	}
+	return stats
+}
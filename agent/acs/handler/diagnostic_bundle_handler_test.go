@@ -0,0 +1,138 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	mock_dockerapi "github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi/mocks"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/docker/docker/api/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const testUploadURL = "https://bucket.s3.amazonaws.com/bundle?X-Amz-Signature=signature"
+
+type fakeBundleUploader struct {
+	url    string
+	bundle []byte
+	err    error
+}
+
+func (uploader *fakeBundleUploader) Upload(url string, data []byte) error {
+	uploader.url = url
+	uploader.bundle = data
+	return uploader.err
+}
+
+func newTestDiagnosticBundleHandler(ctrl *gomock.Controller, uploader bundleUploader) (diagnosticBundleHandler,
+	*mock_engine.MockTaskEngine, *mock_dockerapi.MockDockerClient, *mock_wsclient.MockClientServer) {
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	dockerClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	handler := newDiagnosticBundleHandler(context.TODO(), clusterName, containerInstanceArn,
+		mockWSClient, taskEngine, dockerClient, "")
+	handler.uploader = uploader
+	return handler, taskEngine, dockerClient, mockWSClient
+}
+
+func newTestDiagnosticBundleRequest() *ecsacs.DiagnosticBundleRequest {
+	return &ecsacs.DiagnosticBundleRequest{
+		ClusterArn:           aws.String(clusterName),
+		ContainerInstanceArn: aws.String(containerInstanceArn),
+		MessageId:            aws.String(messageId),
+		UploadUrl:            aws.String(testUploadURL),
+	}
+}
+
+func TestDiagnosticBundleHandlerUploadsAndAcks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uploader := &fakeBundleUploader{}
+	handler, taskEngine, dockerClient, mockWSClient := newTestDiagnosticBundleHandler(ctrl, uploader)
+	taskEngine.EXPECT().ListTasks().Return([]*apitask.Task{}, nil)
+	dockerClient.EXPECT().Info(gomock.Any(), gomock.Any()).Return(types.Info{}, nil)
+	mockWSClient.EXPECT().MakeRequest(&ecsacs.AckRequest{
+		Cluster:           aws.String(clusterName),
+		ContainerInstance: aws.String(containerInstanceArn),
+		MessageId:         aws.String(messageId),
+	}).Return(nil)
+
+	assert.NoError(t, handler.handleSingleMessage(newTestDiagnosticBundleRequest()))
+	assert.Equal(t, testUploadURL, uploader.url)
+	assert.NotEmpty(t, uploader.bundle)
+}
+
+func TestDiagnosticBundleHandlerDoesNotAckFailedUpload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler, taskEngine, dockerClient, _ := newTestDiagnosticBundleHandler(ctrl,
+		&fakeBundleUploader{err: errors.New("upload failed")})
+	taskEngine.EXPECT().ListTasks().Return([]*apitask.Task{}, nil)
+	dockerClient.EXPECT().Info(gomock.Any(), gomock.Any()).Return(types.Info{}, nil)
+
+	assert.Error(t, handler.handleSingleMessage(newTestDiagnosticBundleRequest()))
+}
+
+func TestDiagnosticBundleHandlerInvalidMessages(t *testing.T) {
+	testCases := []struct {
+		name    string
+		message *ecsacs.DiagnosticBundleRequest
+	}{
+		{
+			name: "missing message id",
+			message: &ecsacs.DiagnosticBundleRequest{
+				UploadUrl: aws.String(testUploadURL),
+			},
+		},
+		{
+			name: "missing upload url",
+			message: &ecsacs.DiagnosticBundleRequest{
+				MessageId: aws.String(messageId),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			uploader := &fakeBundleUploader{}
+			handler, _, _, _ := newTestDiagnosticBundleHandler(ctrl, uploader)
+			assert.Error(t, handler.handleSingleMessage(tc.message))
+			assert.Nil(t, uploader.bundle)
+		})
+	}
+}
+
+func TestDiagnosticBundleHandlerDropsRequestsWhileBusy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler, _, _, _ := newTestDiagnosticBundleHandler(ctrl, &fakeBundleUploader{})
+	// Nothing is reading from the message buffer, the request must not block
+	handler.handlerFunc()(newTestDiagnosticBundleRequest())
+}
@@ -0,0 +1,38 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+// DNSCacheFlusher flushes the caches of the OS resolving the ACS endpoint, so
+// that reconnecting to ACS uses the current IPs of the endpoint instead of
+// cached ones after ACS rotated them
+type DNSCacheFlusher interface {
+	Flush() error
+}
+
+// noopDNSCacheFlusher implements DNSCacheFlusher on platforms whose caches
+// aren't flushed
+type noopDNSCacheFlusher struct{}
+
+func (noopDNSCacheFlusher) Flush() error {
+	return nil
+}
+
+// newDNSCacheFlusher returns the DNSCacheFlusher of the platform if flushing
+// before reconnecting to ACS is enabled, nil otherwise
+func newDNSCacheFlusher(enabled bool) DNSCacheFlusher {
+	if !enabled {
+		return nil
+	}
+	return newPlatformDNSCacheFlusher()
+}
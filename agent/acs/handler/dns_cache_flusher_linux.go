@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import "os"
+
+// routeFlushPath is the sysctl flushing the routing cache of the kernel when
+// written to, whatever the value written
+const routeFlushPath = "/proc/sys/net/ipv4/route/flush"
+
+// procDNSCacheFlusher implements DNSCacheFlusher by flushing the routing cache
+// of the kernel through procfs
+type procDNSCacheFlusher struct {
+	path string
+}
+
+// newPlatformDNSCacheFlusher returns the DNSCacheFlusher of the platform
+func newPlatformDNSCacheFlusher() DNSCacheFlusher {
+	return &procDNSCacheFlusher{path: routeFlushPath}
+}
+
+// Flush writes an empty line to the sysctl, as a write of zero bytes may not
+// reach the kernel
+func (flusher *procDNSCacheFlusher) Flush() error {
+	file, err := os.OpenFile(flusher.path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write([]byte("\n"))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
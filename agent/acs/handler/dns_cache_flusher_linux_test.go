@@ -0,0 +1,58 @@
+//go:build linux && unit
+// +build linux,unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcDNSCacheFlusherFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-cache-flusher")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "flush")
+	require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+
+	flusher := &procDNSCacheFlusher{path: path}
+	require.NoError(t, flusher.Flush())
+	written, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "\n", string(written))
+}
+
+func TestProcDNSCacheFlusherFlushMissingSysctl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dns-cache-flusher")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The sysctl isn't created if it doesn't exist
+	flusher := &procDNSCacheFlusher{path: filepath.Join(dir, "flush")}
+	assert.Error(t, flusher.Flush())
+	_, err = os.Stat(flusher.path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestNewDNSCacheFlusher(t *testing.T) {
+	assert.Nil(t, newDNSCacheFlusher(false))
+	assert.Equal(t, &procDNSCacheFlusher{path: routeFlushPath}, newDNSCacheFlusher(true))
+}
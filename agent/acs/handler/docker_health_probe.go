@@ -0,0 +1,167 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/cihub/seelog"
+)
+
+// dockerHealthProbe periodically checks that the docker daemon responds. Once
+// enough consecutive checks have failed, docker is flagged as unhealthy and the
+// tasks received from ACS are queued instead of being added to the task engine,
+// where they would fail to start. The queued tasks are added, in the order they
+// were received, as soon as docker responds again.
+// Combined with the memory pressure monitor, the probe tells whether the host
+// is healthy enough for tasks to be started.
+type dockerHealthProbe struct {
+	dockerClient     dockerapi.DockerClient
+	interval         time.Duration
+	failureThreshold int
+	// unhealthy is set to 1 while docker is unhealthy, it is accessed atomically
+	unhealthy int32
+	lock      sync.Mutex
+	// consecutiveFailures is the number of checks that failed in a row
+	consecutiveFailures int
+	// pending are the functions adding the queued tasks to the task engine
+	pending []func()
+	// memoryPressure holds back the tasks to be started while the host is
+	// under memory pressure
+	memoryPressure *memoryPressureMonitor
+}
+
+// newDockerHealthProbe returns a new dockerHealthProbe object
+func newDockerHealthProbe(dockerClient dockerapi.DockerClient, interval time.Duration,
+	failureThreshold int, memoryPressure *memoryPressureMonitor) *dockerHealthProbe {
+	if interval <= 0 {
+		interval = config.DefaultDockerHealthCheckInterval
+	}
+	if failureThreshold <= 0 {
+		failureThreshold = config.DefaultDockerHealthFailureThreshold
+	}
+	return &dockerHealthProbe{
+		dockerClient:     dockerClient,
+		interval:         interval,
+		failureThreshold: failureThreshold,
+		memoryPressure:   memoryPressure,
+	}
+}
+
+// run checks the docker daemon health, and the memory pressure of the host,
+// every interval until the context is cancelled
+func (probe *dockerHealthProbe) run(ctx context.Context) {
+	if probe == nil {
+		return
+	}
+	go probe.memoryPressure.run(ctx)
+	if probe.dockerClient == nil {
+		return
+	}
+	ticker := time.NewTicker(probe.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			probe.check(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check calls the docker version API and updates the health of docker with the
+// outcome
+func (probe *dockerHealthProbe) check(ctx context.Context) {
+	_, err := probe.dockerClient.Version(ctx, dockerclient.VersionTimeout)
+	if ctx.Err() != nil {
+		return
+	}
+
+	probe.lock.Lock()
+	defer probe.lock.Unlock()
+	if err != nil {
+		probe.consecutiveFailures++
+		seelog.Warnf("Docker health check failed (%d consecutive failures): %v", probe.consecutiveFailures, err)
+		if probe.consecutiveFailures >= probe.failureThreshold && atomic.CompareAndSwapInt32(&probe.unhealthy, 0, 1) {
+			seelog.Errorf("Docker is unhealthy, tasks received from ACS will be queued until it responds again")
+		}
+		return
+	}
+
+	probe.consecutiveFailures = 0
+	if !atomic.CompareAndSwapInt32(&probe.unhealthy, 1, 0) {
+		return
+	}
+	seelog.Infof("Docker is healthy again, adding %d queued tasks to the task engine", len(probe.pending))
+	// The queued tasks are added while holding the lock, so that the tasks
+	// received in the meantime are added after them
+	for _, add := range probe.pending {
+		add()
+	}
+	probe.pending = nil
+}
+
+// isUnhealthy returns true if docker is currently flagged as unhealthy
+func (probe *dockerHealthProbe) isUnhealthy() bool {
+	if probe == nil {
+		return false
+	}
+	return atomic.LoadInt32(&probe.unhealthy) == 1
+}
+
+// submit invokes add right away if docker is healthy. Otherwise, add is queued
+// until docker is healthy again
+func (probe *dockerHealthProbe) submit(taskARN string, add func()) {
+	if probe == nil {
+		add()
+		return
+	}
+	probe.lock.Lock()
+	if !probe.isUnhealthy() {
+		probe.lock.Unlock()
+		add()
+		return
+	}
+	probe.pending = append(probe.pending, add)
+	queued := len(probe.pending)
+	probe.lock.Unlock()
+	seelog.Warnf("Docker is unhealthy, queuing task %s (%d queued)", taskARN, queued)
+}
+
+// submitTaskStart invokes add right away if the host is healthy. Otherwise,
+// add is queued until docker is healthy and the host isn't under memory
+// pressure anymore
+func (probe *dockerHealthProbe) submitTaskStart(taskARN string, add func()) {
+	if probe == nil {
+		add()
+		return
+	}
+	probe.submit(taskARN, func() {
+		probe.memoryPressure.submit(taskARN, add)
+	})
+}
+
+// pendingCount returns the number of tasks waiting for docker to be healthy
+func (probe *dockerHealthProbe) pendingCount() int {
+	probe.lock.Lock()
+	defer probe.lock.Unlock()
+	return len(probe.pending)
+}
@@ -0,0 +1,193 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	mock_dockerapi "github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi/mocks"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDockerHealthProbeDefaults(t *testing.T) {
+	probe := newDockerHealthProbe(nil, 0, -1, nil)
+	assert.Equal(t, config.DefaultDockerHealthCheckInterval, probe.interval)
+	assert.Equal(t, config.DefaultDockerHealthFailureThreshold, probe.failureThreshold)
+}
+
+func TestDockerHealthProbeFlagsUnhealthyAfterThreshold(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dockerClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	probe := newDockerHealthProbe(dockerClient, time.Second, 3, nil)
+	ctx := context.Background()
+
+	gomock.InOrder(
+		dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).Return("", errors.New("timeout")).Times(2),
+		dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).Return("19.03", nil),
+		dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).Return("", errors.New("timeout")).Times(3),
+	)
+
+	probe.check(ctx)
+	probe.check(ctx)
+	assert.False(t, probe.isUnhealthy(), "Docker shouldn't be unhealthy below the failure threshold")
+
+	// A successful check resets the consecutive failures
+	probe.check(ctx)
+	probe.check(ctx)
+	probe.check(ctx)
+	assert.False(t, probe.isUnhealthy())
+	probe.check(ctx)
+	assert.True(t, probe.isUnhealthy())
+}
+
+func TestDockerHealthProbeQueuesTasksWhileUnhealthy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dockerClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	probe := newDockerHealthProbe(dockerClient, time.Second, 1, nil)
+	ctx := context.Background()
+
+	var added []string
+	addFunc := func(arn string) func() {
+		return func() {
+			added = append(added, arn)
+		}
+	}
+
+	probe.submit("healthy", addFunc("healthy"))
+	assert.Equal(t, []string{"healthy"}, added)
+
+	dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).Return("", errors.New("timeout"))
+	probe.check(ctx)
+	require.True(t, probe.isUnhealthy())
+
+	probe.submit("first", addFunc("first"))
+	probe.submit("second", addFunc("second"))
+	assert.Equal(t, []string{"healthy"}, added, "Tasks shouldn't be added while docker is unhealthy")
+	assert.Equal(t, 2, probe.pendingCount())
+
+	dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).Return("19.03", nil)
+	probe.check(ctx)
+	assert.False(t, probe.isUnhealthy())
+	assert.Equal(t, []string{"healthy", "first", "second"}, added)
+	assert.Equal(t, 0, probe.pendingCount())
+}
+
+func TestDockerHealthProbeIgnoresChecksInterruptedByCancellation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dockerClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	probe := newDockerHealthProbe(dockerClient, time.Second, 1, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).Return("", context.Canceled)
+	probe.check(ctx)
+	assert.False(t, probe.isUnhealthy())
+}
+
+func TestDockerHealthProbeRunChecksPeriodically(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dockerClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	probe := newDockerHealthProbe(dockerClient, 10*time.Millisecond, 2, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).Return("", errors.New("timeout")).MinTimes(2)
+	done := make(chan struct{})
+	go func() {
+		probe.run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !probe.isUnhealthy() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for docker to be flagged as unhealthy")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the probe to stop")
+	}
+}
+
+func TestNilDockerHealthProbe(t *testing.T) {
+	var probe *dockerHealthProbe
+	added := false
+	probe.submit("arn", func() { added = true })
+	assert.True(t, added)
+	assert.False(t, probe.isUnhealthy())
+	probe.run(context.Background())
+}
+
+func TestHandlePayloadMessageQueuesTasksWhileDockerIsUnhealthy(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+
+	dockerClient := mock_dockerapi.NewMockDockerClient(tester.ctrl)
+	tester.payloadHandler.dockerHealth = newDockerHealthProbe(dockerClient, time.Second, 1, nil)
+	dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).Return("", errors.New("timeout"))
+	tester.payloadHandler.dockerHealth.check(tester.ctx)
+	require.True(t, tester.payloadHandler.dockerHealth.isUnhealthy())
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String(testTaskARN),
+				DesiredStatus: aws.String("RUNNING"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+	// The task isn't added while docker is unhealthy, but the message is still acked
+	err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+	assert.NoError(t, err, "Error handling payload message")
+	select {
+	case mid := <-tester.payloadHandler.ackRequest:
+		assert.Equal(t, payloadMessageId, mid)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for payload message to be acked")
+	}
+
+	var addedTask *apitask.Task
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		addedTask = task
+	})
+	dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).Return("19.03", nil)
+	tester.payloadHandler.dockerHealth.check(tester.ctx)
+
+	require.NotNil(t, addedTask)
+	assert.Equal(t, testTaskARN, addedTask.Arn)
+	assert.Equal(t, apitaskstatus.TaskRunning, addedTask.GetDesiredStatus())
+}
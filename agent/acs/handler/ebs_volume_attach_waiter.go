@@ -0,0 +1,183 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	apiattachment "github.com/aws/amazon-ecs-agent/agent/api/attachment"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// ebsVolumeAttachPollInterval is the interval at which the block devices of
+	// the host are listed while waiting for EBS volumes to be visible
+	ebsVolumeAttachPollInterval = 2 * time.Second
+)
+
+// procPartitionsPath is a variable so that it can be overridden in unit tests
+var procPartitionsPath = "/proc/partitions"
+
+// ebsVolumeAttachWaiter delays starting the tasks with EBS volume attachments
+// until the devices of their volumes are visible on the host. ACS confirms the
+// attachment of the volumes before sending the task, but the device can take
+// a while to show up and the containers fail to start if it is missing
+type ebsVolumeAttachWaiter struct {
+	ctx          context.Context
+	dataClient   data.Client
+	timeout      time.Duration
+	pollInterval time.Duration
+}
+
+// newEBSVolumeAttachWaiter returns a new ebsVolumeAttachWaiter object
+func newEBSVolumeAttachWaiter(ctx context.Context, dataClient data.Client,
+	timeout time.Duration) *ebsVolumeAttachWaiter {
+	if timeout <= 0 {
+		timeout = config.DefaultEBSVolumeAttachTimeout
+	}
+	return &ebsVolumeAttachWaiter{
+		ctx:          ctx,
+		dataClient:   dataClient,
+		timeout:      timeout,
+		pollInterval: ebsVolumeAttachPollInterval,
+	}
+}
+
+// submit invokes add right away if the task has no EBS volume attachment.
+// Otherwise, add is invoked in the background once the devices of all the
+// volumes of the task are visible, or once the timeout has elapsed
+func (waiter *ebsVolumeAttachWaiter) submit(task *apitask.Task, add func()) {
+	if waiter == nil {
+		add()
+		return
+	}
+	devices := ebsTaskDevices(waiter.dataClient, task.Arn)
+	if len(devices) == 0 {
+		add()
+		return
+	}
+	seelog.Infof("Waiting for the EBS volume devices %v of task %s to be visible on the host", devices, task.Arn)
+	go waiter.waitForDevices(task.Arn, devices, add)
+}
+
+// ebsTaskDevices returns the names of the devices of the EBS volumes attached to the task
+func ebsTaskDevices(dataClient data.Client, taskARN string) []string {
+	attachments, err := dataClient.GetResourceAttachments()
+	if err != nil {
+		seelog.Warnf("Unable to get the resource attachments of task %s, its EBS volumes are ignored: %v",
+			taskARN, err)
+		return nil
+	}
+	var devices []string
+	for _, attachment := range attachments {
+		if attachment.TaskARN != taskARN || attachment.AttachmentType != apiattachment.EBSVolumeAttachmentType {
+			continue
+		}
+		if device := attachment.AttachmentProperties[apiattachment.DeviceNameKey]; device != "" {
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// waitForDevices polls the block devices of the host until all the devices are
+// visible before invoking add. add is invoked anyway once the timeout has
+// elapsed or the waiter is stopped, so that the task isn't lost
+func (waiter *ebsVolumeAttachWaiter) waitForDevices(taskARN string, devices []string, add func()) {
+	startedAt := time.Now()
+	timeout := time.NewTimer(waiter.timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(waiter.pollInterval)
+	defer ticker.Stop()
+	for {
+		missing, err := missingBlockDevices(devices)
+		if err != nil {
+			seelog.Warnf("Unable to list the block devices of the host, not waiting for the EBS volumes of task %s: %v",
+				taskARN, err)
+			add()
+			return
+		}
+		if len(missing) == 0 {
+			metrics.MetricsEngineGlobal.RecordEBSWaitDuration(time.Since(startedAt), false)
+			seelog.Infof("EBS volume devices of task %s are visible on the host, starting the task", taskARN)
+			add()
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-timeout.C:
+			metrics.MetricsEngineGlobal.RecordEBSWaitDuration(time.Since(startedAt), true)
+			seelog.Warnf("EBS volume devices %v of task %s are still not visible on the host after %s, starting the task anyway",
+				missing, taskARN, waiter.timeout.String())
+			add()
+			return
+		case <-waiter.ctx.Done():
+			add()
+			return
+		}
+	}
+}
+
+// missingBlockDevices returns the devices that are not listed in /proc/partitions
+func missingBlockDevices(devices []string) ([]string, error) {
+	file, err := os.Open(procPartitionsPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	visible := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Each line holds the major and minor numbers, the number of blocks and
+		// the name of a block device, after a header line
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 4 {
+			visible[fields[3]] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return missingDevices(visible, devices), nil
+}
+
+// missingDevices returns the devices whose name isn't one of the visible block
+// devices
+func missingDevices(visible map[string]struct{}, devices []string) []string {
+	var missing []string
+	for _, device := range devices {
+		name := filepath.Base(device)
+		if _, ok := visible[name]; ok {
+			continue
+		}
+		// Xen instances expose the sd devices as xvd devices
+		if strings.HasPrefix(name, "sd") {
+			if _, ok := visible["xv"+strings.TrimPrefix(name, "s")]; ok {
+				continue
+			}
+		}
+		missing = append(missing, device)
+	}
+	return missing
+}
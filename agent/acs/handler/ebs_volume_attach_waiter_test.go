@@ -0,0 +1,169 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	apiattachment "github.com/aws/amazon-ecs-agent/agent/api/attachment"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	ebsTaskARN           = "arn:aws:ecs:us-west-2:123456789012:task/default/ebs"
+	partitionsWithoutEBS = `major minor  #blocks  name
+
+ 202        0    8388608 xvda
+ 202        1    8387567 xvda1
+`
+	partitionsWithEBS = partitionsWithoutEBS + ` 202       80   10485760 xvdf
+`
+)
+
+// setupProcPartitions points the waiter to a temporary partitions file with
+// the given content and returns a function to update it
+func setupProcPartitions(t *testing.T, content string) (func(string), func()) {
+	dir, err := ioutil.TempDir("", "ebs_volume_attach_waiter_test")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "partitions")
+	write := func(content string) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	write(content)
+	original := procPartitionsPath
+	procPartitionsPath = path
+	return write, func() {
+		procPartitionsPath = original
+		os.RemoveAll(dir)
+	}
+}
+
+func saveEBSAttachment(t *testing.T, dataClient data.Client, taskARN, deviceName string) {
+	require.NoError(t, dataClient.SaveResourceAttachment(&apiattachment.ResourceAttachment{
+		AttachmentType: apiattachment.EBSVolumeAttachmentType,
+		TaskARN:        taskARN,
+		AttachmentARN:  "arn:aws:ecs:us-west-2:123456789012:attachment/" + deviceName,
+		AttachmentProperties: map[string]string{
+			apiattachment.VolumeIDKey:   "vol-1234",
+			apiattachment.DeviceNameKey: deviceName,
+		},
+		ExpiresAt: time.Now().Add(time.Hour),
+	}))
+}
+
+func newTestEBSVolumeAttachWaiter(ctx context.Context, dataClient data.Client,
+	timeout time.Duration) *ebsVolumeAttachWaiter {
+	waiter := newEBSVolumeAttachWaiter(ctx, dataClient, timeout)
+	waiter.pollInterval = 10 * time.Millisecond
+	return waiter
+}
+
+func TestEBSVolumeAttachWaiterNoAttachment(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	waiter := newTestEBSVolumeAttachWaiter(context.Background(), dataClient, time.Minute)
+
+	added := false
+	waiter.submit(&apitask.Task{Arn: ebsTaskARN}, func() { added = true })
+	assert.True(t, added)
+}
+
+func TestEBSVolumeAttachWaiterWaitsForDevice(t *testing.T) {
+	writePartitions, cleanupPartitions := setupProcPartitions(t, partitionsWithoutEBS)
+	defer cleanupPartitions()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	saveEBSAttachment(t, dataClient, ebsTaskARN, "/dev/xvdf")
+	// The attachments of other tasks are ignored
+	saveEBSAttachment(t, dataClient, "arn:aws:ecs:us-west-2:123456789012:task/default/other", "/dev/xvdg")
+	waiter := newTestEBSVolumeAttachWaiter(context.Background(), dataClient, time.Minute)
+
+	added := make(chan struct{})
+	waiter.submit(&apitask.Task{Arn: ebsTaskARN}, func() { close(added) })
+	select {
+	case <-added:
+		t.Fatal("Task added before its EBS volume is visible")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	writePartitions(partitionsWithEBS)
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Task not added once its EBS volume is visible")
+	}
+}
+
+func TestEBSVolumeAttachWaiterTimeout(t *testing.T) {
+	_, cleanupPartitions := setupProcPartitions(t, partitionsWithoutEBS)
+	defer cleanupPartitions()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	saveEBSAttachment(t, dataClient, ebsTaskARN, "/dev/xvdf")
+	waiter := newTestEBSVolumeAttachWaiter(context.Background(), dataClient, 50*time.Millisecond)
+
+	added := make(chan struct{})
+	waiter.submit(&apitask.Task{Arn: ebsTaskARN}, func() { close(added) })
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Task not added once the timeout has elapsed")
+	}
+}
+
+func TestEBSVolumeAttachWaiterStopped(t *testing.T) {
+	_, cleanupPartitions := setupProcPartitions(t, partitionsWithoutEBS)
+	defer cleanupPartitions()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	saveEBSAttachment(t, dataClient, ebsTaskARN, "/dev/xvdf")
+	ctx, cancel := context.WithCancel(context.Background())
+	waiter := newTestEBSVolumeAttachWaiter(ctx, dataClient, time.Minute)
+
+	added := make(chan struct{})
+	waiter.submit(&apitask.Task{Arn: ebsTaskARN}, func() { close(added) })
+	cancel()
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Task not added once the waiter is stopped")
+	}
+}
+
+func TestMissingBlockDevices(t *testing.T) {
+	_, cleanupPartitions := setupProcPartitions(t, partitionsWithEBS)
+	defer cleanupPartitions()
+
+	missing, err := missingBlockDevices([]string{"/dev/xvdf", "/dev/sdf", "xvda1", "/dev/xvdg", "/dev/sdh"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/dev/xvdg", "/dev/sdh"}, missing)
+}
+
+func TestEBSVolumeAttachWaiterNil(t *testing.T) {
+	var waiter *ebsVolumeAttachWaiter
+	added := false
+	waiter.submit(&apitask.Task{Arn: ebsTaskARN}, func() { added = true })
+	assert.True(t, added)
+}
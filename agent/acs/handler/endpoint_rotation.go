@@ -0,0 +1,113 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// endpointResolveTimeout is the time allowed to resolve the IP of the ACS endpoint
+	endpointResolveTimeout = 5 * time.Second
+)
+
+// lookupHost is a variable so that it can be overridden in unit tests
+var lookupHost = net.DefaultResolver.LookupHost
+
+// endpointRotation tracks the consecutive failures to connect to the ACS
+// endpoints, to determine when the endpoint returned by DiscoverPollEndpoint
+// should be discarded. The endpoint is cached for hours and its host name
+// can keep resolving to the same unreachable IP in the meantime, so failures
+// are tracked per endpoint IP rather than per host name
+type endpointRotation struct {
+	threshold int
+	// endpointIP is the IP of the endpoint of the current connection attempt
+	endpointIP string
+	// failures maps an endpoint IP to the number of consecutive failures to connect to it
+	failures map[string]int
+}
+
+// newEndpointRotation returns a new endpointRotation object
+func newEndpointRotation(threshold int) *endpointRotation {
+	if threshold <= 0 {
+		threshold = config.DefaultACSEndpointRotationThreshold
+	}
+	return &endpointRotation{
+		threshold: threshold,
+		failures:  make(map[string]int),
+	}
+}
+
+// shouldRotate records the endpoint of the current connection attempt. It returns
+// true if the connection to its IP has failed too many times in a row, in which
+// case a new endpoint should be discovered
+func (rotation *endpointRotation) shouldRotate(endpoint string) bool {
+	if rotation == nil {
+		return false
+	}
+	rotation.endpointIP = resolveEndpointIP(endpoint)
+	return rotation.failures[rotation.endpointIP] >= rotation.threshold
+}
+
+// connectionFailed records a failure to connect to the current endpoint IP
+func (rotation *endpointRotation) connectionFailed() {
+	if rotation == nil {
+		return
+	}
+	rotation.failures[rotation.endpointIP]++
+}
+
+// resetFailures resets the failures of the current endpoint IP, either after
+// connecting to it or after discovering a new endpoint
+func (rotation *endpointRotation) resetFailures() {
+	if rotation == nil {
+		return
+	}
+	delete(rotation.failures, rotation.endpointIP)
+}
+
+// consecutiveFailures returns the number of consecutive failures to connect to
+// the current endpoint IP
+func (rotation *endpointRotation) consecutiveFailures() int {
+	if rotation == nil {
+		return 0
+	}
+	return rotation.failures[rotation.endpointIP]
+}
+
+// resolveEndpointIP returns the IP the host name of the endpoint resolves to.
+// The host name is returned if it can't be resolved
+func resolveEndpointIP(endpoint string) string {
+	host := endpoint
+	if parsed, err := url.Parse(endpoint); err == nil && parsed.Hostname() != "" {
+		host = parsed.Hostname()
+	}
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), endpointResolveTimeout)
+	defer cancel()
+	addrs, err := lookupHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		seelog.Debugf("Unable to resolve ACS endpoint %s, tracking connection failures by host name: %v", host, err)
+		return host
+	}
+	return addrs[0]
+}
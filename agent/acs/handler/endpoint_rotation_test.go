@@ -0,0 +1,104 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// setLookupHost overrides the resolution of the host names to the given IPs
+// and returns a function restoring the original resolver
+func setLookupHost(ips map[string]string) func() {
+	original := lookupHost
+	lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		ip, ok := ips[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		return []string{ip}, nil
+	}
+	return func() {
+		lookupHost = original
+	}
+}
+
+func TestEndpointRotationAfterThreshold(t *testing.T) {
+	defer setLookupHost(map[string]string{"ecs-a-1.amazonaws.com": "10.0.0.1"})()
+	rotation := newEndpointRotation(3)
+
+	for i := 0; i < 3; i++ {
+		assert.False(t, rotation.shouldRotate("https://ecs-a-1.amazonaws.com/"))
+		rotation.connectionFailed()
+	}
+	assert.True(t, rotation.shouldRotate("https://ecs-a-1.amazonaws.com/"))
+	assert.Equal(t, 3, rotation.consecutiveFailures())
+
+	// Once rotated, the failures are counted from scratch
+	rotation.resetFailures()
+	assert.False(t, rotation.shouldRotate("https://ecs-a-1.amazonaws.com/"))
+}
+
+func TestEndpointRotationResetOnConnection(t *testing.T) {
+	defer setLookupHost(map[string]string{"ecs-a-1.amazonaws.com": "10.0.0.1"})()
+	rotation := newEndpointRotation(2)
+
+	rotation.shouldRotate("https://ecs-a-1.amazonaws.com/")
+	rotation.connectionFailed()
+	rotation.resetFailures()
+	rotation.shouldRotate("https://ecs-a-1.amazonaws.com/")
+	rotation.connectionFailed()
+	assert.False(t, rotation.shouldRotate("https://ecs-a-1.amazonaws.com/"))
+}
+
+func TestEndpointRotationTracksFailuresPerIP(t *testing.T) {
+	ips := map[string]string{
+		"ecs-a-1.amazonaws.com": "10.0.0.1",
+		"ecs-a-2.amazonaws.com": "10.0.0.1",
+	}
+	defer setLookupHost(ips)()
+	rotation := newEndpointRotation(2)
+
+	// Failures to host names resolving to the same IP add up
+	rotation.shouldRotate("https://ecs-a-1.amazonaws.com/")
+	rotation.connectionFailed()
+	rotation.shouldRotate("https://ecs-a-2.amazonaws.com/")
+	rotation.connectionFailed()
+	assert.True(t, rotation.shouldRotate("https://ecs-a-1.amazonaws.com/"))
+
+	// The same host name resolving to a different IP starts from scratch
+	ips["ecs-a-1.amazonaws.com"] = "10.0.0.2"
+	assert.False(t, rotation.shouldRotate("https://ecs-a-1.amazonaws.com/"))
+}
+
+func TestResolveEndpointIP(t *testing.T) {
+	defer setLookupHost(map[string]string{"ecs-a-1.amazonaws.com": "10.0.0.1"})()
+
+	assert.Equal(t, "10.0.0.1", resolveEndpointIP("https://ecs-a-1.amazonaws.com/"))
+	assert.Equal(t, "10.0.0.3", resolveEndpointIP("https://10.0.0.3:443"))
+	// Host names that can't be resolved are tracked as is
+	assert.Equal(t, "unknown.amazonaws.com", resolveEndpointIP("https://unknown.amazonaws.com"))
+}
+
+func TestNewEndpointRotationDefaultsThreshold(t *testing.T) {
+	rotation := newEndpointRotation(0)
+	assert.Equal(t, config.DefaultACSEndpointRotationThreshold, rotation.threshold)
+}
@@ -13,6 +13,13 @@
 
 package handler
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// UnrecognizedTaskError indicates that a task received from ACS could not be loaded
 type UnrecognizedTaskError struct {
 	err error
 }
@@ -20,3 +27,128 @@ type UnrecognizedTaskError struct {
 func (err UnrecognizedTaskError) Error() string {
 	return "UnrecogniedTaskError: Error loading task - " + err.err.Error()
 }
+
+// Retry implements Retriable. Receiving the same task again won't
+// make it loadable
+func (err UnrecognizedTaskError) Retry() bool {
+	return false
+}
+
+// InvalidTaskResourcesError indicates that a task received from ACS requests
+// resources that are inconsistent or can't be satisfied by the instance
+type InvalidTaskResourcesError struct {
+	err error
+}
+
+func (err InvalidTaskResourcesError) Error() string {
+	return "InvalidTaskResourcesError: " + err.err.Error()
+}
+
+// Retry implements Retriable. Receiving the same task again won't
+// change its resource configuration
+func (err InvalidTaskResourcesError) Retry() bool {
+	return false
+}
+
+// ContainerInstanceDrainingError indicates that a task to be started was
+// received from ACS while the container instance is being drained
+type ContainerInstanceDrainingError struct{}
+
+func (err ContainerInstanceDrainingError) Error() string {
+	return "ContainerInstanceDrainingError: the container instance is being drained and doesn't start new tasks"
+}
+
+// Retry implements Retriable. The instance doesn't start any task
+// until it is deregistered
+func (err ContainerInstanceDrainingError) Retry() bool {
+	return false
+}
+
+// UnknownTaskFieldsError indicates that a task received from ACS has fields
+// that the agent doesn't know about
+type UnknownTaskFieldsError struct {
+	err error
+}
+
+func (err UnknownTaskFieldsError) Error() string {
+	return "UnknownTaskFieldsError: " + err.err.Error()
+}
+
+// Retry implements Retriable. The fields remain unknown until the
+// agent is updated
+func (err UnknownTaskFieldsError) Retry() bool {
+	return false
+}
+
+// errReauthenticate is returned when the connection to ACS is closed by the
+// agent to reconnect with refreshed credentials
+var errReauthenticate = errors.New("reconnecting to authenticate with refreshed credentials")
+
+// errPrimaryRecovered is returned when the connection to the backup ACS endpoint
+// is closed by the agent to reconnect to the primary endpoint
+var errPrimaryRecovered = errors.New("reconnecting to the primary ACS endpoint")
+
+// errAvailabilityZoneMismatch is returned when the connection to an ACS host in
+// another availability zone than the instance is closed by the agent to try
+// another host of the endpoint
+var errAvailabilityZoneMismatch = errors.New("reconnecting to an ACS host in the availability zone of the instance")
+
+// errLatencyBudgetExceeded is returned when the connection to ACS is closed by
+// the agent because its round-trip latency exceeded the budget
+var errLatencyBudgetExceeded = errors.New("reconnecting as the round-trip latency of the connection exceeded the budget")
+
+// CircularDependencyError indicates that the dependencies between the
+// containers of a task received from ACS can never be resolved, such as when
+// they depend on each other in a cycle
+type CircularDependencyError struct {
+	taskARN string
+}
+
+func (err CircularDependencyError) Error() string {
+	return fmt.Sprintf("CircularDependencyError: dependencies between the containers of task %s can never be resolved",
+		err.taskARN)
+}
+
+// Retry implements Retriable. The task definition has to be fixed
+// for the task to be startable
+func (err CircularDependencyError) Retry() bool {
+	return false
+}
+
+// PermissionsBoundaryError indicates that the IAM role of a task received
+// from ACS allows actions outside of the permissions boundary of the instance role
+type PermissionsBoundaryError struct {
+	roleARN string
+	actions []string
+}
+
+func (err PermissionsBoundaryError) Error() string {
+	return fmt.Sprintf("PermissionsBoundaryError: IAM role %s allows actions outside of the permissions boundary of the instance role: %s",
+		err.roleARN, strings.Join(err.actions, ", "))
+}
+
+// Retry implements Retriable. The task or instance role has to be
+// changed for the task to be startable
+func (err PermissionsBoundaryError) Retry() bool {
+	return false
+}
+
+// SchemaVersionUnsupportedError indicates that a message received from ACS
+// uses a schema with breaking changes the agent doesn't support
+type SchemaVersionUnsupportedError struct {
+	schemaVersion     int64
+	compatibleVersion int64
+	supportedVersion  int64
+}
+
+func (err SchemaVersionUnsupportedError) Error() string {
+	return fmt.Sprintf("SchemaVersionUnsupportedError: message schema version %d (compatible with version %d) "+
+		"is not supported by the agent, which supports up to version %d",
+		err.schemaVersion, err.compatibleVersion, err.supportedVersion)
+}
+
+// Retry implements Retriable. The schema remains unsupported until
+// the agent is updated
+func (err SchemaVersionUnsupportedError) Retry() bool {
+	return false
+}
@@ -0,0 +1,103 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"hash/fnv"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+)
+
+const (
+	// AckBatchingFeatureFlag gates batching the acks sent to ACS
+	AckBatchingFeatureFlag = "AckBatching"
+	// HeartbeatHostMetricsFeatureFlag gates including the host metrics in the
+	// heartbeat acks
+	HeartbeatHostMetricsFeatureFlag = "HeartbeatHostMetrics"
+)
+
+// FeatureFlag resolves whether a feature of the ACS handlers is enabled on a
+// container instance, so that new behaviours can be rolled out gradually
+type FeatureFlag interface {
+	// IsEnabled returns true if the flag is enabled on the container instance
+	IsEnabled(flag string, instanceARN string) bool
+}
+
+// PercentageBasedFeatureFlag enables each flag on a percentage of the container
+// instances. Whether a flag is enabled on an instance is decided by hashing the
+// flag and the instance ARN, so that it's stable across restarts of the agent,
+// and so that different flags are enabled on different sets of instances
+type PercentageBasedFeatureFlag struct {
+	// percentages maps the flags to the percentage, from 0 to 100, of instances
+	// they are enabled on
+	percentages map[string]int
+}
+
+// NewPercentageBasedFeatureFlag returns a PercentageBasedFeatureFlag enabling
+// the flags on the given percentages of instances. Flags that are not listed
+// are enabled on every instance
+func NewPercentageBasedFeatureFlag(percentages map[string]int) *PercentageBasedFeatureFlag {
+	return &PercentageBasedFeatureFlag{
+		percentages: percentages,
+	}
+}
+
+// IsEnabled returns true if the bucket of the instance for the flag is below the
+// percentage of instances the flag is enabled on
+func (featureFlag *PercentageBasedFeatureFlag) IsEnabled(flag string, instanceARN string) bool {
+	percentage, ok := featureFlag.percentages[flag]
+	if !ok {
+		return true
+	}
+	return featureFlagBucket(flag, instanceARN) < uint32(clampPercentage(percentage))
+}
+
+// featureFlagBucket hashes the flag and the instance ARN to a bucket in [0, 100)
+func featureFlagBucket(flag string, instanceARN string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(flag + "/" + instanceARN))
+	return hash.Sum32() % 100
+}
+
+func clampPercentage(percentage int) int {
+	if percentage < 0 {
+		return 0
+	}
+	if percentage > 100 {
+		return 100
+	}
+	return percentage
+}
+
+// isFeatureEnabled returns true if the flag is enabled on the instance, every
+// flag is enabled when there's no feature flag resolver
+func (acsSession *session) isFeatureEnabled(flag string) bool {
+	if acsSession.featureFlag == nil {
+		return true
+	}
+	return acsSession.featureFlag.IsEnabled(flag, acsSession.containerInstanceARN)
+}
+
+// acsClientConfig returns the config the ACS client is created with, acks are
+// sent as soon as they're ready when ack batching is disabled on the instance.
+// The requests are signed for the backup region if the session failed over
+func (acsSession *session) acsClientConfig() *config.Config {
+	agentConfig := acsSession.failover.clientConfig(acsSession.agentConfig)
+	if agentConfig.ACSAckBatchWindow <= 0 || acsSession.isFeatureEnabled(AckBatchingFeatureFlag) {
+		return agentConfig
+	}
+	cfg := *agentConfig
+	cfg.ACSAckBatchWindow = 0
+	return &cfg
+}
@@ -0,0 +1,144 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const featureFlagTestInstances = 10000
+
+// enabledInstances returns the number of test instances the flag is enabled on
+func enabledInstances(featureFlag FeatureFlag, flag string) int {
+	enabled := 0
+	for i := 0; i < featureFlagTestInstances; i++ {
+		arn := fmt.Sprintf("arn:aws:ecs:us-west-2:123456789012:container-instance/cluster/%032x", i)
+		if featureFlag.IsEnabled(flag, arn) {
+			enabled++
+		}
+	}
+	return enabled
+}
+
+func TestPercentageBasedFeatureFlagDistribution(t *testing.T) {
+	for _, percentage := range []int{1, 10, 25, 50, 75, 90} {
+		t.Run(fmt.Sprintf("%d%%", percentage), func(t *testing.T) {
+			featureFlag := NewPercentageBasedFeatureFlag(map[string]int{AckBatchingFeatureFlag: percentage})
+			expected := featureFlagTestInstances * percentage / 100
+			assert.InDelta(t, expected, enabledInstances(featureFlag, AckBatchingFeatureFlag),
+				featureFlagTestInstances*0.02)
+		})
+	}
+}
+
+func TestPercentageBasedFeatureFlagBounds(t *testing.T) {
+	featureFlag := NewPercentageBasedFeatureFlag(map[string]int{
+		AckBatchingFeatureFlag:          0,
+		HeartbeatHostMetricsFeatureFlag: 100,
+	})
+	assert.Equal(t, 0, enabledInstances(featureFlag, AckBatchingFeatureFlag))
+	assert.Equal(t, featureFlagTestInstances, enabledInstances(featureFlag, HeartbeatHostMetricsFeatureFlag))
+}
+
+func TestPercentageBasedFeatureFlagOutOfBoundsPercentages(t *testing.T) {
+	featureFlag := NewPercentageBasedFeatureFlag(map[string]int{
+		AckBatchingFeatureFlag:          -10,
+		HeartbeatHostMetricsFeatureFlag: 200,
+	})
+	assert.Equal(t, 0, enabledInstances(featureFlag, AckBatchingFeatureFlag))
+	assert.Equal(t, featureFlagTestInstances, enabledInstances(featureFlag, HeartbeatHostMetricsFeatureFlag))
+}
+
+func TestPercentageBasedFeatureFlagUnlistedFlagIsEnabled(t *testing.T) {
+	featureFlag := NewPercentageBasedFeatureFlag(nil)
+	assert.Equal(t, featureFlagTestInstances, enabledInstances(featureFlag, AckBatchingFeatureFlag))
+}
+
+func TestPercentageBasedFeatureFlagIsDeterministic(t *testing.T) {
+	featureFlag := NewPercentageBasedFeatureFlag(map[string]int{AckBatchingFeatureFlag: 50})
+	for i := 0; i < 100; i++ {
+		arn := fmt.Sprintf("arn:aws:ecs:us-west-2:123456789012:container-instance/%d", i)
+		enabled := featureFlag.IsEnabled(AckBatchingFeatureFlag, arn)
+		for j := 0; j < 10; j++ {
+			assert.Equal(t, enabled, featureFlag.IsEnabled(AckBatchingFeatureFlag, arn))
+		}
+	}
+}
+
+func TestPercentageBasedFeatureFlagIsIndependentAcrossFlags(t *testing.T) {
+	featureFlag := NewPercentageBasedFeatureFlag(map[string]int{
+		AckBatchingFeatureFlag:          50,
+		HeartbeatHostMetricsFeatureFlag: 50,
+	})
+	both := 0
+	for i := 0; i < featureFlagTestInstances; i++ {
+		arn := fmt.Sprintf("arn:aws:ecs:us-west-2:123456789012:container-instance/cluster/%032x", i)
+		if featureFlag.IsEnabled(AckBatchingFeatureFlag, arn) &&
+			featureFlag.IsEnabled(HeartbeatHostMetricsFeatureFlag, arn) {
+			both++
+		}
+	}
+	// Each flag is enabled on a different half of the instances, so both are
+	// enabled on about a quarter of them
+	assert.InDelta(t, featureFlagTestInstances/4, both, featureFlagTestInstances*0.02)
+}
+
+// staticFeatureFlag enables the listed flags on every instance
+type staticFeatureFlag map[string]bool
+
+func (featureFlag staticFeatureFlag) IsEnabled(flag string, instanceARN string) bool {
+	return featureFlag[flag]
+}
+
+func TestACSClientConfigAckBatching(t *testing.T) {
+	cfg := &config.Config{ACSAckBatchWindow: time.Second}
+
+	acsSession := &session{agentConfig: cfg}
+	assert.Equal(t, time.Second, acsSession.acsClientConfig().ACSAckBatchWindow,
+		"ack batching should be enabled without a feature flag resolver")
+
+	acsSession.featureFlag = staticFeatureFlag{AckBatchingFeatureFlag: true}
+	assert.Equal(t, time.Second, acsSession.acsClientConfig().ACSAckBatchWindow)
+
+	acsSession.featureFlag = staticFeatureFlag{}
+	assert.Zero(t, acsSession.acsClientConfig().ACSAckBatchWindow)
+	assert.Equal(t, time.Second, cfg.ACSAckBatchWindow, "the agent config should not be modified")
+}
+
+func TestNewSessionHeartbeatHostMetricsFeatureFlag(t *testing.T) {
+	cfg := &config.Config{ACSHeartbeatHostMetrics: true}
+
+	acsSession := NewSession(context.Background(), SessionParams{
+		Config:               cfg,
+		ContainerInstanceARN: "myArn",
+		FeatureFlag:          staticFeatureFlag{},
+	}).(*session)
+	assert.Nil(t, acsSession.hostMetrics)
+
+	acsSession = NewSession(context.Background(), SessionParams{
+		Config:               cfg,
+		ContainerInstanceARN: "myArn",
+		FeatureFlag:          staticFeatureFlag{HeartbeatHostMetricsFeatureFlag: true},
+	}).(*session)
+	assert.NotNil(t, acsSession.hostMetrics)
+}
@@ -0,0 +1,195 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// getInstanceStateTimedOutEvent is the ACS event recorded when the snapshot
+	// of the state queried by ACS could not be taken in time
+	getInstanceStateTimedOutEvent = "GetInstanceStateTimedOut"
+)
+
+// instanceStateSnapshot is the state of the container instance sent to ACS in
+// response to a GetInstanceStateRequestMessage
+type instanceStateSnapshot struct {
+	tasks          []*ecsacs.TaskStateReport
+	eniAttachments []*ecsacs.ENIAttachmentStateReport
+}
+
+// getInstanceStateHandler handles the queries of the state of the container
+// instance sent by ACS, e.g. during incident response. A snapshot of the tasks,
+// containers and ENI attachments managed by the agent is sent back in a
+// GetInstanceStateResponseMessage, which also acks the query. No response is
+// sent if the snapshot can't be taken within the timeout
+type getInstanceStateHandler struct {
+	messageBuffer        chan *ecsacs.GetInstanceStateRequestMessage
+	ctx                  context.Context
+	cancel               context.CancelFunc
+	cluster              string
+	containerInstanceArn string
+	acsClient            wsclient.ClientServer
+	state                dockerstate.TaskEngineState
+	timeout              time.Duration
+	*inFlightAckTracker
+	routines *handlerRoutines
+}
+
+// newGetInstanceStateHandler returns an instance of the getInstanceStateHandler struct
+func newGetInstanceStateHandler(ctx context.Context,
+	cluster string, containerInstanceArn string, acsClient wsclient.ClientServer,
+	state dockerstate.TaskEngineState, timeout time.Duration) getInstanceStateHandler {
+	if timeout <= 0 {
+		timeout = config.DefaultACSGetInstanceStateTimeout
+	}
+
+	// Create a cancelable context from the parent context
+	derivedContext, cancel := context.WithCancel(ctx)
+	return getInstanceStateHandler{
+		messageBuffer:        make(chan *ecsacs.GetInstanceStateRequestMessage),
+		ctx:                  derivedContext,
+		cancel:               cancel,
+		cluster:              cluster,
+		containerInstanceArn: containerInstanceArn,
+		acsClient:            acsClient,
+		state:                state,
+		timeout:              timeout,
+		inFlightAckTracker:   newInFlightAckTracker(),
+		routines:             &handlerRoutines{},
+	}
+}
+
+// handlerFunc returns the request handler function for the GetInstanceStateRequestMessage
+func (handler *getInstanceStateHandler) handlerFunc() func(message *ecsacs.GetInstanceStateRequestMessage) {
+	return func(message *ecsacs.GetInstanceStateRequestMessage) {
+		handler.trackReceived("GetInstanceStateRequestMessage", aws.StringValue(message.MessageId))
+		select {
+		case handler.messageBuffer <- message:
+		case <-handler.ctx.Done():
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// start invokes go routines to handle get instance state requests
+func (handler *getInstanceStateHandler) start() {
+	handler.routines.run(handler.handleMessages)
+}
+
+// stop is used to invoke a cancellation function
+func (handler *getInstanceStateHandler) stop() {
+	handler.cancel()
+}
+
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (handler *getInstanceStateHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, handler.stop, handler.routines, nil)
+}
+
+// handleMessages processes the get instance state requests in-order
+func (handler *getInstanceStateHandler) handleMessages() {
+	for {
+		select {
+		case <-handler.ctx.Done():
+			return
+		case message := <-handler.messageBuffer:
+			if err := handler.handleSingleMessage(message); err != nil {
+				seelog.Warnf("Unable to handle get instance state request [%s]: %v", message.String(), err)
+			}
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// handleSingleMessage takes a snapshot of the state and sends it back to ACS
+func (handler *getInstanceStateHandler) handleSingleMessage(message *ecsacs.GetInstanceStateRequestMessage) error {
+	if message.MessageId == nil {
+		return fmt.Errorf("get instance state handler: message id not set in message")
+	}
+	if handler.state == nil {
+		return fmt.Errorf("get instance state handler: task engine state not available")
+	}
+	snapshot, err := handler.snapshot()
+	if err != nil {
+		return err
+	}
+
+	seelog.Infof("Sending state of %d tasks and %d ENI attachments to ACS, message id: %s",
+		len(snapshot.tasks), len(snapshot.eniAttachments), aws.StringValue(message.MessageId))
+	return handler.acsClient.MakeRequest(&ecsacs.GetInstanceStateResponseMessage{
+		ClusterArn:           aws.String(handler.cluster),
+		ContainerInstanceArn: aws.String(handler.containerInstanceArn),
+		MessageId:            message.MessageId,
+		GeneratedAt:          aws.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
+		Tasks:                snapshot.tasks,
+		EniAttachments:       snapshot.eniAttachments,
+	})
+}
+
+// snapshot returns the current state of the container instance. It returns an
+// error if the snapshot takes longer than the timeout of the handler, in which
+// case the snapshot is abandoned
+func (handler *getInstanceStateHandler) snapshot() (*instanceStateSnapshot, error) {
+	result := make(chan *instanceStateSnapshot, 1)
+	go func() {
+		result <- &instanceStateSnapshot{
+			tasks:          taskStateReports(handler.state),
+			eniAttachments: eniAttachmentStateReports(handler.state),
+		}
+	}()
+
+	timer := time.NewTimer(handler.timeout)
+	defer timer.Stop()
+	select {
+	case snapshot := <-result:
+		return snapshot, nil
+	case <-timer.C:
+		metrics.MetricsEngineGlobal.RecordACSEvent(getInstanceStateTimedOutEvent, 1)
+		return nil, fmt.Errorf("get instance state handler: timed out after %s taking a snapshot of the state",
+			handler.timeout)
+	case <-handler.ctx.Done():
+		return nil, handler.ctx.Err()
+	}
+}
+
+// eniAttachmentStateReports returns the current state of the ENI attachments in the state
+func eniAttachmentStateReports(state dockerstate.TaskEngineState) []*ecsacs.ENIAttachmentStateReport {
+	attachments := []*ecsacs.ENIAttachmentStateReport{}
+	for _, attachment := range state.AllENIAttachments() {
+		report := &ecsacs.ENIAttachmentStateReport{
+			AttachmentArn:  aws.String(attachment.AttachmentARN),
+			AttachmentType: aws.String(attachment.AttachmentType),
+			MacAddress:     aws.String(attachment.MACAddress),
+			Status:         aws.String(attachment.Status.String()),
+			AttachSent:     aws.Bool(attachment.IsSent()),
+		}
+		if attachment.TaskARN != "" {
+			report.TaskArn = aws.String(attachment.TaskARN)
+		}
+		attachments = append(attachments, report)
+	}
+	return attachments
+}
@@ -0,0 +1,143 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apieni "github.com/aws/amazon-ecs-agent/agent/api/eni"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	mock_dockerstate "github.com/aws/amazon-ecs-agent/agent/engine/dockerstate/mocks"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const getInstanceStateTestMessageID = "get-instance-state-message-id"
+
+func getInstanceStateRequest() *ecsacs.GetInstanceStateRequestMessage {
+	return &ecsacs.GetInstanceStateRequestMessage{
+		ClusterArn:           aws.String(clusterName),
+		ContainerInstanceArn: aws.String(containerInstanceArn),
+		MessageId:            aws.String(getInstanceStateTestMessageID),
+	}
+}
+
+func TestGetInstanceStateRequestResponse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	container := &apicontainer.Container{Name: "container"}
+	container.SetKnownStatus(apicontainerstatus.ContainerRunning)
+	container.SetDesiredStatus(apicontainerstatus.ContainerRunning)
+	task := &apitask.Task{
+		Arn:        testTaskARN,
+		Containers: []*apicontainer.Container{container},
+	}
+	task.SetKnownStatus(apitaskstatus.TaskRunning)
+	task.SetDesiredStatus(apitaskstatus.TaskRunning)
+	state := dockerstate.NewTaskEngineState()
+	state.AddTask(task)
+	state.AddENIAttachment(&apieni.ENIAttachment{
+		AttachmentType: apieni.ENIAttachmentTypeTaskENI,
+		TaskARN:        testTaskARN,
+		AttachmentARN:  "attachment-arn",
+		MACAddress:     "mac",
+		Status:         apieni.ENIAttached,
+	})
+
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	handler := newGetInstanceStateHandler(ctx, clusterName, containerInstanceArn, mockWSClient, state, time.Second)
+	responses := make(chan *ecsacs.GetInstanceStateResponseMessage, 1)
+	mockWSClient.EXPECT().MakeRequest(gomock.Any()).Do(func(message interface{}) {
+		responses <- message.(*ecsacs.GetInstanceStateResponseMessage)
+	}).Return(nil)
+
+	handler.start()
+	defer handler.stop()
+	handler.handlerFunc()(getInstanceStateRequest())
+
+	var response *ecsacs.GetInstanceStateResponseMessage
+	select {
+	case response = <-responses:
+	case <-time.After(time.Second):
+		t.Fatal("No response sent to the get instance state request")
+	}
+	assert.Equal(t, clusterName, aws.StringValue(response.ClusterArn))
+	assert.Equal(t, containerInstanceArn, aws.StringValue(response.ContainerInstanceArn))
+	assert.Equal(t, getInstanceStateTestMessageID, aws.StringValue(response.MessageId))
+	assert.NotZero(t, aws.Int64Value(response.GeneratedAt))
+	require.Len(t, response.Tasks, 1)
+	assert.Equal(t, testTaskARN, aws.StringValue(response.Tasks[0].TaskArn))
+	assert.Equal(t, "RUNNING", aws.StringValue(response.Tasks[0].KnownStatus))
+	require.Len(t, response.Tasks[0].Containers, 1)
+	assert.Equal(t, "container", aws.StringValue(response.Tasks[0].Containers[0].Name))
+	assert.Equal(t, "RUNNING", aws.StringValue(response.Tasks[0].Containers[0].KnownStatus))
+	assert.Equal(t, []*ecsacs.ENIAttachmentStateReport{{
+		AttachmentArn:  aws.String("attachment-arn"),
+		AttachmentType: aws.String(apieni.ENIAttachmentTypeTaskENI),
+		TaskArn:        aws.String(testTaskARN),
+		MacAddress:     aws.String("mac"),
+		Status:         aws.String("ATTACHED"),
+		AttachSent:     aws.Bool(false),
+	}}, response.EniAttachments)
+}
+
+func TestGetInstanceStateTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The snapshot of the state blocks until the test ends
+	unblock := make(chan struct{})
+	defer close(unblock)
+	state := mock_dockerstate.NewMockTaskEngineState(ctrl)
+	state.EXPECT().AllTasks().Do(func() {
+		<-unblock
+	}).Return(nil)
+	state.EXPECT().AllENIAttachments().Return(nil).AnyTimes()
+
+	// No response is sent when the snapshot times out
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	handler := newGetInstanceStateHandler(ctx, clusterName, containerInstanceArn, mockWSClient, state,
+		10*time.Millisecond)
+	start := time.Now()
+	assert.Error(t, handler.handleSingleMessage(getInstanceStateRequest()))
+	assert.True(t, time.Since(start) < time.Second, "The snapshot of the state should have timed out")
+}
+
+func TestGetInstanceStateMissingMessageID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	handler := newGetInstanceStateHandler(context.TODO(), clusterName, containerInstanceArn, mockWSClient,
+		dockerstate.NewTaskEngineState(), time.Second)
+	assert.Error(t, handler.handleSingleMessage(&ecsacs.GetInstanceStateRequestMessage{}))
+}
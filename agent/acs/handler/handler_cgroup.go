@@ -0,0 +1,60 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"runtime"
+
+	"github.com/cihub/seelog"
+)
+
+// handlerCgroup runs ACS handler goroutines inside the cgroup configured with
+// ACSHandlerCgroupPath, so that the cpu and memory used to process ACS messages
+// can be isolated from the task containers.
+//
+// Goroutines don't have ids that the kernel knows of, so each goroutine is locked
+// to its OS thread and the id of that thread is moved into the cgroup. The cgroup
+// must be a threaded cgroup v2 cgroup, threads are moved through its cgroup.threads
+// file: writing to cgroup.procs would move the whole agent process instead.
+type handlerCgroup struct {
+	path string
+}
+
+// newHandlerCgroup returns a new handlerCgroup object, or nil if no cgroup is
+// configured
+func newHandlerCgroup(path string) *handlerCgroup {
+	if path == "" {
+		return nil
+	}
+	return &handlerCgroup{path: path}
+}
+
+// run invokes fn in the cgroup. It is meant to be called as the body of a
+// long running handler goroutine: the OS thread is not unlocked when fn returns,
+// which makes the runtime terminate the thread, removing it from the cgroup,
+// instead of handing a thread of the cgroup over to other goroutines
+func (cgroup *handlerCgroup) run(name string, fn func()) {
+	if cgroup == nil {
+		fn()
+		return
+	}
+
+	runtime.LockOSThread()
+	if err := cgroup.join(); err != nil {
+		seelog.Warnf("Unable to move the %s to cgroup %s, it will run in the agent cgroup: %v",
+			name, cgroup.path, err)
+		runtime.UnlockOSThread()
+	}
+	fn()
+}
@@ -0,0 +1,84 @@
+//go:build linux && unit
+// +build linux,unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// newTestCgroup returns a directory mocking a cgroup filesystem, with an empty
+// cgroup.threads file
+func newTestCgroup(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "acs-handler-cgroup")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, cgroupThreadsFile), nil, 0644))
+	return dir
+}
+
+// runInGoroutine runs the cgroup in a new goroutine, as handlers do, and returns
+// the id of the thread fn ran on
+func runInGoroutine(cgroup *handlerCgroup) int {
+	tid := make(chan int, 1)
+	go cgroup.run("test handler", func() {
+		tid <- unix.Gettid()
+	})
+	return <-tid
+}
+
+func TestNewHandlerCgroupNotConfigured(t *testing.T) {
+	assert.Nil(t, newHandlerCgroup(""))
+}
+
+func TestHandlerCgroupRunMovesThreadToCgroup(t *testing.T) {
+	dir := newTestCgroup(t)
+	defer os.RemoveAll(dir)
+
+	tid := runInGoroutine(newHandlerCgroup(dir))
+
+	threads, err := ioutil.ReadFile(filepath.Join(dir, cgroupThreadsFile))
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(tid), string(threads))
+}
+
+func TestHandlerCgroupRunWithoutCgroupFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acs-handler-cgroup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	runInGoroutine(newHandlerCgroup(dir))
+
+	// The thread isn't moved and the cgroup file isn't created
+	_, err = os.Stat(filepath.Join(dir, cgroupThreadsFile))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHandlerCgroupRunNotConfigured(t *testing.T) {
+	var cgroup *handlerCgroup
+	ran := false
+	cgroup.run("test handler", func() {
+		ran = true
+	})
+	assert.True(t, ran)
+}
@@ -0,0 +1,117 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+)
+
+// The types of the messages whose handlers start goroutines, counted in the
+// metrics when the goroutines are queued
+const (
+	payloadMessageType                         = "PayloadMessage"
+	taskManifestMessageType                    = "TaskManifestMessage"
+	iamRoleCredentialsMessageType              = "IAMRoleCredentialsMessage"
+	heartbeatMessageType                       = "HeartbeatMessage"
+	attachInstanceNetworkInterfacesMessageType = "AttachInstanceNetworkInterfacesMessage"
+	attachTaskNetworkInterfacesMessageType     = "AttachTaskNetworkInterfacesMessage"
+)
+
+// HandlerGoroutineLimiter caps the number of goroutines run concurrently by the
+// handlers of ACS messages. Every message handled may start goroutines, to send
+// its ack for example, which pile up if ACS sends messages faster than they
+// complete. The functions started beyond the limit are queued, and run in turn
+// by the goroutines already running once they return, so that the number of
+// goroutines stays bounded whatever the rate of the messages
+type HandlerGoroutineLimiter struct {
+	lock    sync.Mutex
+	limit   int
+	running int
+	queue   []func()
+}
+
+// newHandlerGoroutineLimiter returns a new HandlerGoroutineLimiter running up to
+// limit goroutines concurrently
+func newHandlerGoroutineLimiter(limit int) *HandlerGoroutineLimiter {
+	limiter := &HandlerGoroutineLimiter{}
+	limiter.setLimit(limit)
+	return limiter
+}
+
+// setLimit sets the maximum number of goroutines run concurrently, the default
+// one if limit isn't positive. The functions queued are started if the limit
+// increased
+func (limiter *HandlerGoroutineLimiter) setLimit(limit int) {
+	if limit <= 0 {
+		limit = config.DefaultACSMaxHandlerGoroutines
+	}
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	limiter.limit = limit
+	for limiter.running < limiter.limit && len(limiter.queue) > 0 {
+		fn := limiter.queue[0]
+		limiter.queue = limiter.queue[1:]
+		limiter.running++
+		go limiter.run(fn)
+	}
+}
+
+// spawn runs fn in a new goroutine if a slot is free, or queues it until one of
+// the running goroutines is done otherwise. The message type of the handler is
+// used to count the functions queued. fn is run in a new goroutine right away
+// if the limiter is nil
+func (limiter *HandlerGoroutineLimiter) spawn(messageType string, fn func()) {
+	if limiter == nil {
+		go fn()
+		return
+	}
+	limiter.lock.Lock()
+	if limiter.running >= limiter.limit {
+		limiter.queue = append(limiter.queue, fn)
+		limiter.lock.Unlock()
+		metrics.MetricsEngineGlobal.RecordACSHandlerGoroutineBlocked(messageType)
+		return
+	}
+	limiter.running++
+	limiter.lock.Unlock()
+	go limiter.run(fn)
+}
+
+// run runs fn, then the functions queued meanwhile, until the queue is empty or
+// the limit decreased below the number of running goroutines
+func (limiter *HandlerGoroutineLimiter) run(fn func()) {
+	for fn != nil {
+		fn()
+		limiter.lock.Lock()
+		fn = nil
+		if len(limiter.queue) > 0 && limiter.running <= limiter.limit {
+			fn = limiter.queue[0]
+			limiter.queue[0] = nil
+			limiter.queue = limiter.queue[1:]
+		} else {
+			limiter.running--
+		}
+		limiter.lock.Unlock()
+	}
+}
+
+// stats returns the number of goroutines running and of functions queued
+func (limiter *HandlerGoroutineLimiter) stats() (running int, queued int) {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+	return limiter.running, len(limiter.queue)
+}
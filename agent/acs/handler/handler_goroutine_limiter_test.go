@@ -0,0 +1,171 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	benchmarkBurstSize       = 5000
+	benchmarkHandlerDuration = time.Millisecond
+)
+
+// spawnBlocked spawns count functions waiting for release, and returns the
+// group done once they all returned
+func spawnBlocked(limiter *HandlerGoroutineLimiter, count int, release chan struct{}) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		limiter.spawn(heartbeatMessageType, func() {
+			defer wg.Done()
+			<-release
+		})
+	}
+	return &wg
+}
+
+func TestHandlerGoroutineLimiterQueuesBeyondLimit(t *testing.T) {
+	goroutinesBefore := runtime.NumGoroutine()
+	limiter := newHandlerGoroutineLimiter(10)
+	release := make(chan struct{})
+	wg := spawnBlocked(limiter, 1000, release)
+
+	running, queued := limiter.stats()
+	assert.Equal(t, 10, running)
+	assert.Equal(t, 990, queued)
+	// Leave some room for the goroutines of other tests still exiting
+	assert.True(t, runtime.NumGoroutine()-goroutinesBefore < 100,
+		"the queued functions shouldn't start goroutines")
+
+	close(release)
+	wg.Wait()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if running, _ = limiter.stats(); running == 0 {
+			break
+		}
+	}
+	running, queued = limiter.stats()
+	assert.Zero(t, running)
+	assert.Zero(t, queued)
+}
+
+func TestHandlerGoroutineLimiterSetLimit(t *testing.T) {
+	limiter := newHandlerGoroutineLimiter(0)
+	assert.Equal(t, config.DefaultACSMaxHandlerGoroutines, limiter.limit)
+
+	limiter.setLimit(1)
+	release := make(chan struct{})
+	wg := spawnBlocked(limiter, 3, release)
+	running, queued := limiter.stats()
+	assert.Equal(t, 1, running)
+	assert.Equal(t, 2, queued)
+
+	limiter.setLimit(3)
+	running, queued = limiter.stats()
+	assert.Equal(t, 3, running, "the queued functions should start once the limit increases")
+	assert.Zero(t, queued)
+	close(release)
+	wg.Wait()
+}
+
+func TestHandlerGoroutineLimiterNil(t *testing.T) {
+	var limiter *HandlerGoroutineLimiter
+	done := make(chan struct{})
+	limiter.spawn(heartbeatMessageType, func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("the function should run in a new goroutine")
+	}
+}
+
+func TestNewSessionHandlerGoroutineLimiter(t *testing.T) {
+	cfg := *testConfig
+	cfg.ACSMaxHandlerGoroutines = 5
+	session1 := NewSession(context.Background(), SessionParams{Config: &cfg, ContainerInstanceARN: "myArn"}).(*session)
+	session2 := NewSession(context.Background(), SessionParams{Config: testConfig, ContainerInstanceARN: "myArn"}).(*session)
+	assert.Equal(t, 5, session1.handlerGoroutines.limit)
+	assert.Equal(t, config.DefaultACSMaxHandlerGoroutines, session2.handlerGoroutines.limit,
+		"creating a session shouldn't change the limit of the other sessions")
+}
+
+// spawnBenchmarkBurst spawns a burst of handler functions, each taking a while,
+// and returns the peak number of functions running concurrently
+func spawnBenchmarkBurst(spawn func(fn func())) int32 {
+	var current, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < benchmarkBurstSize; i++ {
+		wg.Add(1)
+		spawn(func() {
+			defer wg.Done()
+			running := atomic.AddInt32(&current, 1)
+			for {
+				observed := atomic.LoadInt32(&peak)
+				if running <= observed || atomic.CompareAndSwapInt32(&peak, observed, running) {
+					break
+				}
+			}
+			time.Sleep(benchmarkHandlerDuration)
+			atomic.AddInt32(&current, -1)
+		})
+	}
+	wg.Wait()
+	return peak
+}
+
+// BenchmarkLimitedHandlerGoroutines and BenchmarkUnlimitedHandlerGoroutines
+// report the peak number of concurrent handler goroutines when handling a burst
+// of messages with and without the limiter
+func BenchmarkLimitedHandlerGoroutines(b *testing.B) {
+	limiter := newHandlerGoroutineLimiter(config.DefaultACSMaxHandlerGoroutines)
+	var peak int32
+	for i := 0; i < b.N; i++ {
+		batchPeak := spawnBenchmarkBurst(func(fn func()) {
+			limiter.spawn(heartbeatMessageType, fn)
+		})
+		if batchPeak > peak {
+			peak = batchPeak
+		}
+	}
+	if peak > config.DefaultACSMaxHandlerGoroutines {
+		b.Fatalf("%d handler goroutines ran concurrently, more than the limit of %d",
+			peak, config.DefaultACSMaxHandlerGoroutines)
+	}
+	b.ReportMetric(float64(peak), "peak-concurrent-goroutines")
+}
+
+func BenchmarkUnlimitedHandlerGoroutines(b *testing.B) {
+	var peak int32
+	for i := 0; i < b.N; i++ {
+		batchPeak := spawnBenchmarkBurst(func(fn func()) {
+			go fn()
+		})
+		if batchPeak > peak {
+			peak = batchPeak
+		}
+	}
+	b.ReportMetric(float64(peak), "peak-concurrent-goroutines")
+}
@@ -0,0 +1,79 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+)
+
+// GracefulHandlerStop is implemented by the ACS message handlers that can be
+// stopped within a deadline when the ACS session ends
+type GracefulHandlerStop interface {
+	// StopWithTimeout stops the handler and waits for its goroutines to exit
+	// until ctx is done. The acks waiting to be sent are dropped in any case, an
+	// error is returned if the goroutines didn't exit in time
+	StopWithTimeout(ctx context.Context) error
+}
+
+// handlerRoutines tracks the goroutines started by a handler, so that stopping
+// the handler can wait for them to exit. The goroutines started through a nil
+// handlerRoutines are not tracked
+type handlerRoutines struct {
+	wg sync.WaitGroup
+}
+
+// run runs f in a new goroutine tracked by routines
+func (routines *handlerRoutines) run(f func()) {
+	if routines == nil {
+		go f()
+		return
+	}
+	routines.wg.Add(1)
+	go func() {
+		defer routines.wg.Done()
+		f()
+	}()
+}
+
+// wait waits for the tracked goroutines to exit, returning the context error if
+// it's done first
+func (routines *handlerRoutines) wait(ctx context.Context) error {
+	if routines == nil {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		routines.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stopWithTimeout cancels the goroutines of a handler with stop and waits for
+// them to exit until ctx is done, before draining the acks of the handler with
+// clearAcks if set
+func stopWithTimeout(ctx context.Context, stop func(), routines *handlerRoutines, clearAcks func()) error {
+	stop()
+	err := routines.wait(ctx)
+	if clearAcks != nil {
+		clearAcks()
+	}
+	return err
+}
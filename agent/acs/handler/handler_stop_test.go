@@ -0,0 +1,95 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopWithTimeoutWaitsForGoroutines(t *testing.T) {
+	handler := newRefreshCredentialsHandler(context.Background(), clusterName, containerInstanceArn, nil,
+		credentials.NewManager(), nil, nil)
+	exited := make(chan struct{})
+	handler.routines.run(func() {
+		<-handler.ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		close(exited)
+	})
+	handler.ackRequest <- &ecsacs.IAMRoleCredentialsAckRequest{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, handler.StopWithTimeout(ctx))
+	select {
+	case <-exited:
+	default:
+		t.Fatal("StopWithTimeout returned before the goroutines of the handler exited")
+	}
+	assert.Len(t, handler.ackRequest, 0, "the pending acks should be drained")
+}
+
+func TestStopWithTimeoutForcesStopAfterDeadline(t *testing.T) {
+	handler := newRefreshCredentialsHandler(context.Background(), clusterName, containerInstanceArn, nil,
+		credentials.NewManager(), nil, nil)
+	// A goroutine blocked regardless of the context of the handler
+	blocked := make(chan struct{})
+	defer close(blocked)
+	handler.routines.run(func() {
+		<-blocked
+	})
+	handler.ackRequest <- &ecsacs.IAMRoleCredentialsAckRequest{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, handler.StopWithTimeout(ctx))
+	assert.Error(t, handler.ctx.Err(), "the handler should be canceled")
+	assert.Len(t, handler.ackRequest, 0, "the pending acks should be drained after the deadline")
+}
+
+func TestStopWithTimeoutStartedHandler(t *testing.T) {
+	handler := newHeartbeatHandler(context.Background(), nil, nil, nil, nil, nil, nil)
+	handler.start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, handler.StopWithTimeout(ctx))
+}
+
+func TestStopWithTimeoutUntrackedRoutines(t *testing.T) {
+	// Handlers created without their constructor don't track their goroutines
+	handler := taskDrainHandler{}
+	handler.ctx, handler.cancel = context.WithCancel(context.Background())
+	handler.routines.run(func() {
+		<-handler.ctx.Done()
+	})
+	assert.NoError(t, handler.StopWithTimeout(context.Background()))
+}
+
+func TestSessionHandlerStopTimeout(t *testing.T) {
+	acsSession := session{}
+	assert.Equal(t, config.DefaultACSHandlerStopTimeout, acsSession.handlerStopTimeout())
+	acsSession.agentConfig = &config.Config{ACSHandlerStopTimeout: time.Second}
+	assert.Equal(t, time.Second, acsSession.handlerStopTimeout())
+}
@@ -0,0 +1,115 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+// heartbeatAckPiggybackWindow is how long a heartbeat ack waits for a payload ack
+// to be sent along with before it's sent on its own
+const heartbeatAckPiggybackWindow = time.Second
+
+// heartbeatAckPiggyback holds the heartbeat acks for a short while, so that they
+// are sent along with the next payload ack instead of in their own message. A
+// heartbeat ack that isn't taken by a payload ack within the window is sent on
+// its own
+type heartbeatAckPiggyback struct {
+	acsClient wsclient.ClientServer
+	window    time.Duration
+	lock      sync.Mutex
+	// pending is the heartbeat ack held, nil if there's none
+	pending *ecsacs.HeartbeatAckRequest
+	timer   *time.Timer
+}
+
+// newHeartbeatAckPiggyback returns a heartbeatAckPiggyback holding the heartbeat
+// acks for the given window
+func newHeartbeatAckPiggyback(acsClient wsclient.ClientServer, window time.Duration) *heartbeatAckPiggyback {
+	return &heartbeatAckPiggyback{
+		acsClient: acsClient,
+		window:    window,
+	}
+}
+
+// hold holds the heartbeat ack until it's taken by a payload ack or the window
+// elapses. The heartbeat ack previously held, if any, is sent right away
+func (piggyback *heartbeatAckPiggyback) hold(ack *ecsacs.HeartbeatAckRequest) {
+	piggyback.lock.Lock()
+	previous := piggyback.pending
+	if piggyback.timer != nil {
+		piggyback.timer.Stop()
+	}
+	piggyback.pending = ack
+	piggyback.timer = time.AfterFunc(piggyback.window, piggyback.flush)
+	piggyback.lock.Unlock()
+
+	if previous != nil {
+		piggyback.send(previous)
+	}
+}
+
+// attach attaches the heartbeat ack held, if any, to the payload ack. The returned
+// function must be called with the result of sending the payload ack, so that the
+// heartbeat ack is sent on its own if the payload ack couldn't be sent
+func (piggyback *heartbeatAckPiggyback) attach(ack *ecsacs.AckRequest) func(error) {
+	if piggyback == nil {
+		return func(error) {}
+	}
+	heartbeatAck := piggyback.take()
+	if heartbeatAck == nil {
+		return func(error) {}
+	}
+	ack.HeartbeatAck = heartbeatAck
+	seelog.Debugf("Piggybacking heartbeat ack %s on payload ack %s", aws.StringValue(heartbeatAck.MessageId),
+		aws.StringValue(ack.MessageId))
+	return func(err error) {
+		if err != nil {
+			piggyback.send(heartbeatAck)
+		}
+	}
+}
+
+// take returns the heartbeat ack held, nil if there's none, and stops holding it
+func (piggyback *heartbeatAckPiggyback) take() *ecsacs.HeartbeatAckRequest {
+	piggyback.lock.Lock()
+	defer piggyback.lock.Unlock()
+	if piggyback.timer != nil {
+		piggyback.timer.Stop()
+		piggyback.timer = nil
+	}
+	ack := piggyback.pending
+	piggyback.pending = nil
+	return ack
+}
+
+// flush sends the heartbeat ack held, if any, on its own
+func (piggyback *heartbeatAckPiggyback) flush() {
+	if ack := piggyback.take(); ack != nil {
+		piggyback.send(ack)
+	}
+}
+
+func (piggyback *heartbeatAckPiggyback) send(ack *ecsacs.HeartbeatAckRequest) {
+	if err := piggyback.acsClient.MakeRequest(ack); err != nil {
+		seelog.Warnf("Error acknowledging server heartbeat, message id: %s, error: %s",
+			aws.StringValue(ack.MessageId), err)
+	}
+}
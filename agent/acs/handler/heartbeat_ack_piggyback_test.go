@@ -0,0 +1,198 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	acsclient "github.com/aws/amazon-ecs-agent/agent/acs/client"
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeatAckPiggybackAttachesHeldAck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The heartbeat ack is taken by the payload ack, it's never sent on its own
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	piggyback := newHeartbeatAckPiggyback(mockWsClient, time.Hour)
+
+	heartbeatAck := &ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat")}
+	piggyback.hold(heartbeatAck)
+	ack := &ecsacs.AckRequest{MessageId: aws.String("payload")}
+	piggyback.attach(ack)(nil)
+
+	assert.Equal(t, heartbeatAck, ack.HeartbeatAck)
+	assert.Nil(t, piggyback.take(), "the heartbeat ack should only be attached once")
+}
+
+func TestHeartbeatAckPiggybackSendsAckAfterWindow(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	piggyback := newHeartbeatAckPiggyback(mockWsClient, 10*time.Millisecond)
+
+	heartbeatAck := &ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat")}
+	sent := make(chan struct{})
+	mockWsClient.EXPECT().MakeRequest(heartbeatAck).Do(func(interface{}) {
+		close(sent)
+	}).Return(nil)
+	piggyback.hold(heartbeatAck)
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("the heartbeat ack wasn't sent after the window")
+	}
+	ack := &ecsacs.AckRequest{MessageId: aws.String("payload")}
+	piggyback.attach(ack)(nil)
+	assert.Nil(t, ack.HeartbeatAck)
+}
+
+func TestHeartbeatAckPiggybackSendsPreviousAck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	piggyback := newHeartbeatAckPiggyback(mockWsClient, time.Hour)
+
+	previous := &ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat1")}
+	latest := &ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat2")}
+	mockWsClient.EXPECT().MakeRequest(previous).Return(nil)
+	piggyback.hold(previous)
+	piggyback.hold(latest)
+
+	assert.Equal(t, latest, piggyback.take())
+}
+
+func TestHeartbeatAckPiggybackSendsAckWhenPayloadAckFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	piggyback := newHeartbeatAckPiggyback(mockWsClient, time.Hour)
+
+	heartbeatAck := &ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat")}
+	mockWsClient.EXPECT().MakeRequest(heartbeatAck).Return(nil)
+	piggyback.hold(heartbeatAck)
+	piggyback.attach(&ecsacs.AckRequest{MessageId: aws.String("payload")})(errors.New("write failed"))
+}
+
+func TestHeartbeatAckPiggybackFlush(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	piggyback := newHeartbeatAckPiggyback(mockWsClient, time.Hour)
+
+	heartbeatAck := &ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat")}
+	mockWsClient.EXPECT().MakeRequest(heartbeatAck).Return(nil)
+	piggyback.hold(heartbeatAck)
+	piggyback.flush()
+	// Nothing is held anymore
+	piggyback.flush()
+}
+
+func TestNilHeartbeatAckPiggybackAttachesNothing(t *testing.T) {
+	var piggyback *heartbeatAckPiggyback
+	ack := &ecsacs.AckRequest{MessageId: aws.String("payload")}
+	piggyback.attach(ack)(nil)
+	assert.Nil(t, ack.HeartbeatAck)
+}
+
+func TestHeartbeatHandlerHoldsAckForPiggyback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	piggyback := newHeartbeatAckPiggyback(mockWsClient, time.Hour)
+	handler := newHeartbeatHandler(context.Background(), mockWsClient, nil, nil, nil, piggyback, nil)
+
+	handler.trackReceived("HeartbeatMessage", "heartbeat")
+	handler.sendSingleHeartbeatAck(&ecsacs.HeartbeatAckRequest{MessageId: aws.String("heartbeat")})
+
+	assert.Empty(t, handler.ListInFlightAcks())
+	heartbeatAck := piggyback.take()
+	require.NotNil(t, heartbeatAck)
+	assert.Equal(t, "heartbeat", aws.StringValue(heartbeatAck.MessageId))
+}
+
+// TestPiggybackedHeartbeatAckIsParsedByServer tests that the heartbeat ack
+// piggybacked on a payload ack reaches ACS in a single message it can decode
+func TestPiggybackedHeartbeatAckIsParsedByServer(t *testing.T) {
+	closeWS := make(chan bool)
+	server, _, requests, serverErr, err := startMockAcsServer(t, closeWS)
+	require.NoError(t, err)
+	defer server.Close()
+	defer close(closeWS)
+
+	client := acsclient.New(server.URL, testConfig, testCreds, wsRWTimeout, nil, nil)
+	defer client.Close()
+	// Wait for up to a second for the mock server to launch
+	for i := 0; i < 100; i++ {
+		err = client.Connect()
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, err)
+
+	piggyback := newHeartbeatAckPiggyback(client, time.Hour)
+	piggyback.hold(&ecsacs.HeartbeatAckRequest{
+		MessageId:      aws.String("heartbeat"),
+		HostCpuPercent: aws.Float64(12.5),
+	})
+	ack := &ecsacs.AckRequest{
+		Cluster:           aws.String("cluster"),
+		ContainerInstance: aws.String("containerInstance"),
+		MessageId:         aws.String("payload"),
+	}
+	heartbeatAckSent := piggyback.attach(ack)
+	err = client.MakeRequest(ack)
+	heartbeatAckSent(err)
+	require.NoError(t, err)
+
+	var request string
+	select {
+	case request = <-requests:
+	case err := <-serverErr:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the mock server didn't receive the ack")
+	}
+	decoded, messageType, err := wsclient.DecodeData([]byte(request),
+		wsclient.BuildTypeDecoder([]interface{}{ecsacs.AckRequest{}}))
+	require.NoError(t, err)
+	assert.Equal(t, "AckRequest", messageType)
+	received, ok := decoded.(*ecsacs.AckRequest)
+	require.True(t, ok)
+	assert.Equal(t, "payload", aws.StringValue(received.MessageId))
+	require.NotNil(t, received.HeartbeatAck)
+	assert.Equal(t, "heartbeat", aws.StringValue(received.HeartbeatAck.MessageId))
+	assert.Equal(t, 12.5, aws.Float64Value(received.HeartbeatAck.HostCpuPercent))
+}
@@ -15,6 +15,7 @@ package handler
 
 import (
 	"context"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
 	"github.com/aws/amazon-ecs-agent/agent/doctor"
@@ -23,6 +24,10 @@ import (
 	"github.com/cihub/seelog"
 )
 
+// healthchecksBudget is the time the instance healthchecks triggered by a
+// heartbeat are given to complete, so that slow checks don't pile up
+const healthchecksBudget = time.Second
+
 // heartbeatHandler handles heartbeat messages from ACS
 type heartbeatHandler struct {
 	heartbeatMessageBuffer    chan *ecsacs.HeartbeatMessage
@@ -31,10 +36,26 @@ type heartbeatHandler struct {
 	cancel                    context.CancelFunc
 	acsClient                 wsclient.ClientServer
 	doctor                    *doctor.Doctor
+	// hostMetrics samples the host metrics included in the acks, nil if the
+	// acks don't include them
+	hostMetrics *hostMetricsSampler
+	// capacity computes the capacity of the instance available for tasks included
+	// in the acks, nil if it's unknown
+	capacity *ContainerInstanceCapacityTracker
+	// piggyback holds the acks until they're sent along with a payload ack, nil
+	// if the acks are sent on their own
+	piggyback *heartbeatAckPiggyback
+	*inFlightAckTracker
+	routines *handlerRoutines
+	// goroutines limits the goroutines started by the handler, nil if they
+	// aren't limited
+	goroutines *HandlerGoroutineLimiter
 }
 
 // newHeartbeatHandler returns an instance of the heartbeatHandler struct
-func newHeartbeatHandler(ctx context.Context, acsClient wsclient.ClientServer, heartbeatDoctor *doctor.Doctor) heartbeatHandler {
+func newHeartbeatHandler(ctx context.Context, acsClient wsclient.ClientServer, heartbeatDoctor *doctor.Doctor,
+	hostMetrics *hostMetricsSampler, capacity *ContainerInstanceCapacityTracker,
+	piggyback *heartbeatAckPiggyback, goroutines *HandlerGoroutineLimiter) heartbeatHandler {
 	// Create a cancelable context from the parent context
 	derivedContext, cancel := context.WithCancel(ctx)
 	return heartbeatHandler{
@@ -44,20 +65,31 @@ func newHeartbeatHandler(ctx context.Context, acsClient wsclient.ClientServer, h
 		cancel:                    cancel,
 		acsClient:                 acsClient,
 		doctor:                    heartbeatDoctor,
+		hostMetrics:               hostMetrics,
+		capacity:                  capacity,
+		piggyback:                 piggyback,
+		inFlightAckTracker:        newInFlightAckTracker(),
+		routines:                  &handlerRoutines{},
+		goroutines:                goroutines,
 	}
 }
 
 // handlerFunc returns a function to enqueue requests onto the buffer
 func (heartbeatHandler *heartbeatHandler) handlerFunc() func(message *ecsacs.HeartbeatMessage) {
 	return func(message *ecsacs.HeartbeatMessage) {
-		heartbeatHandler.heartbeatMessageBuffer <- message
+		heartbeatHandler.trackReceived("HeartbeatMessage", aws.StringValue(message.MessageId))
+		select {
+		case heartbeatHandler.heartbeatMessageBuffer <- message:
+		case <-heartbeatHandler.ctx.Done():
+			heartbeatHandler.trackAcked(aws.StringValue(message.MessageId))
+		}
 	}
 }
 
 // start() invokes go routines to handle receive and respond to heartbeats
 func (heartbeatHandler *heartbeatHandler) start() {
-	go heartbeatHandler.handleHeartbeatMessage()
-	go heartbeatHandler.sendHeartbeatAck()
+	heartbeatHandler.routines.run(heartbeatHandler.handleHeartbeatMessage)
+	heartbeatHandler.routines.run(heartbeatHandler.sendHeartbeatAck)
 }
 
 func (heartbeatHandler *heartbeatHandler) handleHeartbeatMessage() {
@@ -74,24 +106,60 @@ func (heartbeatHandler *heartbeatHandler) handleHeartbeatMessage() {
 }
 
 func (heartbeatHandler *heartbeatHandler) handleSingleHeartbeatMessage(message *ecsacs.HeartbeatMessage) error {
-	// TestHandlerDoesntLeakGoroutines unit test is failing because of this section
-
 	// Agent will run healthchecks triggered by ACS heartbeat
 	// healthcheck results will be sent on to TACS, but for now just to debug logs.
-	go func() {
-		heartbeatHandler.doctor.RunHealthchecks()
-	}()
+	heartbeatHandler.goroutines.spawn(heartbeatMessageType, func() {
+		heartbeatHandler.doctor.BudgetedRunChecks(healthchecksBudget)
+	})
 
 	// Agent will send simple ack to the heartbeatAckMessageBuffer
-	go func() {
+	heartbeatHandler.trackAckQueued(aws.StringValue(message.MessageId))
+	heartbeatHandler.goroutines.spawn(heartbeatMessageType, func() {
 		response := &ecsacs.HeartbeatAckRequest{
 			MessageId: message.MessageId,
 		}
-		heartbeatHandler.heartbeatAckMessageBuffer <- response
-	}()
+		heartbeatHandler.addHostMetrics(response)
+		heartbeatHandler.addAvailableCapacity(response)
+		select {
+		case heartbeatHandler.heartbeatAckMessageBuffer <- response:
+		case <-heartbeatHandler.ctx.Done():
+		}
+	})
 	return nil
 }
 
+// addHostMetrics adds the cpu and memory usage of the host to the ack, if enabled.
+// The ack is sent without them if they can't be sampled
+func (heartbeatHandler *heartbeatHandler) addHostMetrics(ack *ecsacs.HeartbeatAckRequest) {
+	if heartbeatHandler.hostMetrics == nil {
+		return
+	}
+	metrics, err := heartbeatHandler.hostMetrics.sample()
+	if err != nil {
+		seelog.Warnf("Unable to sample the host metrics, not including them in the heartbeat ack: %v", err)
+		return
+	}
+	ack.HostCpuPercent = aws.Float64(metrics.cpuPercent)
+	ack.HostMemoryUsedMiB = aws.Int64(metrics.memoryUsedMiB)
+}
+
+// addAvailableCapacity adds the capacity of the instance available for tasks to
+// the ack, if known. The ack is sent without it if it can't be computed
+func (heartbeatHandler *heartbeatHandler) addAvailableCapacity(ack *ecsacs.HeartbeatAckRequest) {
+	if heartbeatHandler.capacity == nil {
+		return
+	}
+	capacity, err := heartbeatHandler.capacity.availableCapacity()
+	if err != nil {
+		seelog.Warnf("Unable to compute the available capacity, not including it in the heartbeat ack: %v", err)
+		return
+	}
+	ack.AvailableCpu = aws.Int64(capacity.availableCPU)
+	if heartbeatHandler.capacity.resources.availableMemoryMiB > 0 {
+		ack.AvailableMemoryMiB = aws.Int64(capacity.availableMemoryMiB)
+	}
+}
+
 func (heartbeatHandler *heartbeatHandler) sendHeartbeatAck() {
 	for {
 		select {
@@ -104,10 +172,17 @@ func (heartbeatHandler *heartbeatHandler) sendHeartbeatAck() {
 }
 
 func (heartbeatHandler *heartbeatHandler) sendSingleHeartbeatAck(ack *ecsacs.HeartbeatAckRequest) {
+	if heartbeatHandler.piggyback != nil {
+		// The ack is considered sent once it's held, it's sent within the window
+		heartbeatHandler.piggyback.hold(ack)
+		heartbeatHandler.trackAcked(aws.StringValue(ack.MessageId))
+		return
+	}
 	err := heartbeatHandler.acsClient.MakeRequest(ack)
 	if err != nil {
 		seelog.Warnf("Error acknowledging server heartbeat, message id: %s, error: %s", aws.StringValue(ack.MessageId), err)
 	}
+	heartbeatHandler.trackAcked(aws.StringValue(ack.MessageId))
 }
 
 // stop() cancels the context being used by this handler, which stops the go routines started by 'start()'
@@ -115,6 +190,11 @@ func (heartbeatHandler *heartbeatHandler) stop() {
 	heartbeatHandler.cancel()
 }
 
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (heartbeatHandler *heartbeatHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, heartbeatHandler.stop, heartbeatHandler.routines, heartbeatHandler.clearAcks)
+}
+
 // clearAcks drains the ack request channel
 func (heartbeatHandler *heartbeatHandler) clearAcks() {
 	for {
@@ -101,7 +101,7 @@ func validateHeartbeatAck(t *testing.T, heartbeatReceived *ecsacs.HeartbeatMessa
 	emptyHealthchecksList := []doctor.Healthcheck{}
 	emptyDoctor, _ := doctor.NewDoctor(emptyHealthchecksList, "testCluster", "this:is:an:instance:arn")
 
-	handler := newHeartbeatHandler(ctx, mockWsClient, emptyDoctor)
+	handler := newHeartbeatHandler(ctx, mockWsClient, emptyDoctor, nil, nil, nil, nil)
 
 	go handler.sendHeartbeatAck()
 
@@ -112,3 +112,28 @@ func validateHeartbeatAck(t *testing.T, heartbeatReceived *ecsacs.HeartbeatMessa
 
 	require.Equal(t, heartbeatAckExpected, heartbeatAckSent)
 }
+
+func TestAckHeartbeatMessageWithHostMetrics(t *testing.T) {
+	_, cleanup := setupProcFiles(t, testProcStat, testProcMeminfo)
+	defer cleanup()
+	handler := newHeartbeatHandler(context.Background(), nil, nil, newHostMetricsSampler(), nil, nil, nil)
+
+	ack := &ecsacs.HeartbeatAckRequest{MessageId: aws.String(heartbeatMessageId)}
+	handler.addHostMetrics(ack)
+
+	require.NotNil(t, ack.HostCpuPercent)
+	require.InDelta(t, 30.0, aws.Float64Value(ack.HostCpuPercent), 0.01)
+	require.Equal(t, int64(2000), aws.Int64Value(ack.HostMemoryUsedMiB))
+}
+
+func TestAckHeartbeatMessageHostMetricsUnavailable(t *testing.T) {
+	_, cleanup := setupProcFiles(t, "", testProcMeminfo)
+	defer cleanup()
+	handler := newHeartbeatHandler(context.Background(), nil, nil, newHostMetricsSampler(), nil, nil, nil)
+
+	ack := &ecsacs.HeartbeatAckRequest{MessageId: aws.String(heartbeatMessageId)}
+	handler.addHostMetrics(ack)
+
+	require.Nil(t, ack.HostCpuPercent)
+	require.Nil(t, ack.HostMemoryUsedMiB)
+}
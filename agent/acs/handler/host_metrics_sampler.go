@@ -0,0 +1,160 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// These are variables so that they can be overridden in unit tests
+var (
+	procStatPath    = "/proc/stat"
+	procMeminfoPath = "/proc/meminfo"
+)
+
+// cpuTimes are the cumulative times spent by the cpus of the host, in clock ticks
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// hostMetrics are the cpu and memory usage of the host
+type hostMetrics struct {
+	cpuPercent    float64
+	memoryUsedMiB int64
+}
+
+// hostMetricsSampler samples the cpu and memory usage of the host. The cpu usage
+// is computed over the time elapsed since the previous sample, or since boot for
+// the first sample
+type hostMetricsSampler struct {
+	lock     sync.Mutex
+	previous cpuTimes
+}
+
+// newHostMetricsSampler returns a new hostMetricsSampler object
+func newHostMetricsSampler() *hostMetricsSampler {
+	return &hostMetricsSampler{}
+}
+
+// sample returns the current cpu and memory usage of the host
+func (sampler *hostMetricsSampler) sample() (hostMetrics, error) {
+	current, err := readCPUTimes()
+	if err != nil {
+		return hostMetrics{}, errors.Wrap(err, "unable to read cpu usage")
+	}
+	memoryUsedMiB, err := readMemoryUsedMiB()
+	if err != nil {
+		return hostMetrics{}, errors.Wrap(err, "unable to read memory usage")
+	}
+
+	sampler.lock.Lock()
+	previous := sampler.previous
+	sampler.previous = current
+	sampler.lock.Unlock()
+
+	cpuPercent := 0.0
+	if total := current.total - previous.total; current.total > previous.total {
+		idle := current.idle - previous.idle
+		cpuPercent = 100 * float64(total-idle) / float64(total)
+	}
+	return hostMetrics{
+		cpuPercent:    cpuPercent,
+		memoryUsedMiB: memoryUsedMiB,
+	}, nil
+}
+
+// readCPUTimes reads the aggregated times of the cpus from /proc/stat
+func readCPUTimes() (cpuTimes, error) {
+	file, err := os.Open(procStatPath)
+	if err != nil {
+		return cpuTimes{}, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// The line holds the user, nice, system, idle, iowait, irq, softirq
+		// and steal times, followed by the guest times already included in
+		// the user and nice times
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 9 || fields[0] != "cpu" {
+			continue
+		}
+		var times [8]uint64
+		for i := range times {
+			times[i], err = strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				return cpuTimes{}, err
+			}
+		}
+		result := cpuTimes{idle: times[3] + times[4]}
+		for _, time := range times {
+			result.total += time
+		}
+		return result, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return cpuTimes{}, err
+	}
+	return cpuTimes{}, errors.Errorf("no cpu line in %s", procStatPath)
+}
+
+// readMemoryUsedMiB reads the memory used from /proc/meminfo, which is the
+// memory that isn't available for starting new applications
+func readMemoryUsedMiB() (int64, error) {
+	file, err := os.Open(procMeminfoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Each line holds a name, a value and usually its unit, which is kB
+		// for the values read
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		name := strings.TrimSuffix(fields[0], ":")
+		if name != "MemTotal" && name != "MemAvailable" {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		values[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	total, ok := values["MemTotal"]
+	if !ok {
+		return 0, errors.Errorf("no MemTotal in %s", procMeminfoPath)
+	}
+	available, ok := values["MemAvailable"]
+	if !ok {
+		return 0, errors.Errorf("no MemAvailable in %s", procMeminfoPath)
+	}
+	return (total - available) / 1024, nil
+}
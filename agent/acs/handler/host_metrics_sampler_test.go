@@ -0,0 +1,104 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testProcStat = `cpu  400 0 200 1300 100 0 0 0 0 0
+cpu0 200 0 100 650 50 0 0 0 0 0
+intr 12345
+`
+	testProcStatLater = `cpu  700 0 300 1800 200 0 0 0 0 0
+cpu0 350 0 150 900 100 0 0 0 0 0
+intr 23456
+`
+	testProcMeminfo = `MemTotal:        8192000 kB
+MemFree:         1024000 kB
+MemAvailable:    6144000 kB
+Buffers:          102400 kB
+`
+)
+
+// setupProcFiles points the sampler to temporary proc files with the given
+// content and returns a function to update the stat file
+func setupProcFiles(t *testing.T, stat, meminfo string) (func(string), func()) {
+	dir, err := ioutil.TempDir("", "host_metrics_sampler_test")
+	require.NoError(t, err)
+	statPath := filepath.Join(dir, "stat")
+	meminfoPath := filepath.Join(dir, "meminfo")
+	writeStat := func(content string) {
+		require.NoError(t, ioutil.WriteFile(statPath, []byte(content), 0644))
+	}
+	writeStat(stat)
+	require.NoError(t, ioutil.WriteFile(meminfoPath, []byte(meminfo), 0644))
+
+	originalStat, originalMeminfo := procStatPath, procMeminfoPath
+	procStatPath, procMeminfoPath = statPath, meminfoPath
+	return writeStat, func() {
+		procStatPath, procMeminfoPath = originalStat, originalMeminfo
+		os.RemoveAll(dir)
+	}
+}
+
+func TestHostMetricsSampler(t *testing.T) {
+	writeStat, cleanup := setupProcFiles(t, testProcStat, testProcMeminfo)
+	defer cleanup()
+	sampler := newHostMetricsSampler()
+
+	// The first sample covers the time since boot: 2000 ticks, 1400 of them idle
+	metrics, err := sampler.sample()
+	require.NoError(t, err)
+	assert.InDelta(t, 30.0, metrics.cpuPercent, 0.01)
+	assert.Equal(t, int64(2000), metrics.memoryUsedMiB)
+
+	// The next ones cover the time since the previous sample: 1000 ticks, 600
+	// of them idle
+	writeStat(testProcStatLater)
+	metrics, err = sampler.sample()
+	require.NoError(t, err)
+	assert.InDelta(t, 40.0, metrics.cpuPercent, 0.01)
+
+	// No tick elapsed
+	metrics, err = sampler.sample()
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, metrics.cpuPercent)
+}
+
+func TestHostMetricsSamplerMissingMemAvailable(t *testing.T) {
+	_, cleanup := setupProcFiles(t, testProcStat, "MemTotal:        8192000 kB\n")
+	defer cleanup()
+
+	_, err := newHostMetricsSampler().sample()
+	assert.Error(t, err)
+}
+
+func TestHostMetricsSamplerInvalidStat(t *testing.T) {
+	_, cleanup := setupProcFiles(t, "intr 12345\n", testProcMeminfo)
+	defer cleanup()
+
+	_, err := newHostMetricsSampler().sample()
+	assert.Error(t, err)
+}
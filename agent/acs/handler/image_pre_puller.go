@@ -0,0 +1,134 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// PrePulledImageTTL is how long the images pulled ahead of the tasks using
+	// them are considered fresh, the tasks received later pull them again
+	PrePulledImageTTL = 5 * time.Minute
+)
+
+// ImagePrePuller pulls the container images of the tasks listed in the task
+// manifests that haven't been received yet, so that the images are already on
+// the instance when ACS sends the tasks. The images are pulled in the background
+// without registry credentials, the images that can't be pulled that way are
+// pulled when the tasks are started, as before. The pulls in progress are
+// tracked in the pre-pulled images shared with the task engine, so that the
+// tasks received meanwhile wait for them instead of pulling the images again
+type ImagePrePuller struct {
+	ctx          context.Context
+	images       *dockerapi.PrePulledImages
+	dockerClient dockerapi.DockerClient
+	taskEngine   engine.TaskEngine
+	pullTimeout  time.Duration
+	// slots limits the number of concurrent pulls
+	slots chan struct{}
+}
+
+// newImagePrePuller returns a new ImagePrePuller tracking its pulls in images,
+// or nil if images is nil. The pulls are stopped once ctx is done
+func newImagePrePuller(ctx context.Context, images *dockerapi.PrePulledImages, dockerClient dockerapi.DockerClient,
+	taskEngine engine.TaskEngine, concurrency int, pullTimeout time.Duration) *ImagePrePuller {
+	if images == nil {
+		return nil
+	}
+	if concurrency <= 0 {
+		concurrency = config.DefaultACSPrePullConcurrency
+	}
+	return &ImagePrePuller{
+		ctx:          ctx,
+		images:       images,
+		dockerClient: dockerClient,
+		taskEngine:   taskEngine,
+		pullTimeout:  pullTimeout,
+		slots:        make(chan struct{}, concurrency),
+	}
+}
+
+// prePull starts pulling the unique images of the tasks to run that the task
+// engine doesn't know yet, and that aren't being pulled already. It returns the
+// number of pulls started, which wait for a free slot in the background
+func (puller *ImagePrePuller) prePull(tasks []*ecsacs.TaskIdentifier) int {
+	if puller == nil {
+		return 0
+	}
+	started := 0
+	for _, image := range puller.unknownTaskImages(tasks) {
+		finish, ok := puller.images.Start(image)
+		if !ok {
+			continue
+		}
+		started++
+		go puller.pull(image, finish)
+	}
+	if started > 0 {
+		seelog.Infof("Pre-pulling %d images of the tasks of the task manifest", started)
+	}
+	return started
+}
+
+// unknownTaskImages returns the unique images of the tasks to run that the task
+// engine doesn't know yet, in the order of the manifest
+func (puller *ImagePrePuller) unknownTaskImages(tasks []*ecsacs.TaskIdentifier) []string {
+	seen := make(map[string]struct{})
+	var images []string
+	for _, task := range tasks {
+		if aws.StringValue(task.DesiredStatus) != apitaskstatus.TaskRunningString || len(task.Images) == 0 {
+			continue
+		}
+		if _, ok := puller.taskEngine.GetTaskByArn(aws.StringValue(task.TaskArn)); ok {
+			continue
+		}
+		for _, image := range aws.StringValueSlice(task.Images) {
+			if _, ok := seen[image]; ok || image == "" {
+				continue
+			}
+			seen[image] = struct{}{}
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// pull pulls the image once a slot is free, and records the end of the pull
+func (puller *ImagePrePuller) pull(image string, finish func(dockerapi.DockerContainerMetadata)) {
+	select {
+	case puller.slots <- struct{}{}:
+	case <-puller.ctx.Done():
+		finish(dockerapi.DockerContainerMetadata{Error: dockerapi.CannotPullContainerError{FromError: puller.ctx.Err()}})
+		return
+	}
+	defer func() {
+		<-puller.slots
+	}()
+	metadata := puller.dockerClient.PullImage(puller.ctx, image, nil, puller.pullTimeout)
+	if metadata.Error != nil {
+		// The image is pulled again when the task is started, which reports the error
+		seelog.Debugf("Unable to pre-pull image %s: %v", image, metadata.Error)
+	}
+	finish(metadata)
+}
@@ -0,0 +1,181 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingPullClient holds the image pulls until they are released, and keeps
+// track of the pulls and of their maximum concurrency
+type blockingPullClient struct {
+	dockerapi.DockerClient
+	release       chan struct{}
+	lock          sync.Mutex
+	pulled        []string
+	inFlight      int
+	maxConcurrent int
+}
+
+func newBlockingPullClient() *blockingPullClient {
+	return &blockingPullClient{release: make(chan struct{})}
+}
+
+func (client *blockingPullClient) PullImage(ctx context.Context, image string,
+	authData *apicontainer.RegistryAuthenticationData, timeout time.Duration) dockerapi.DockerContainerMetadata {
+	client.lock.Lock()
+	client.pulled = append(client.pulled, image)
+	client.inFlight++
+	if client.inFlight > client.maxConcurrent {
+		client.maxConcurrent = client.inFlight
+	}
+	client.lock.Unlock()
+	<-client.release
+	client.lock.Lock()
+	client.inFlight--
+	client.lock.Unlock()
+	return dockerapi.DockerContainerMetadata{}
+}
+
+func (client *blockingPullClient) pulls() []string {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	return append([]string{}, client.pulled...)
+}
+
+func prePullTestTask(arn string, desiredStatus string, images ...string) *ecsacs.TaskIdentifier {
+	return &ecsacs.TaskIdentifier{
+		TaskArn:       aws.String(arn),
+		DesiredStatus: aws.String(desiredStatus),
+		Images:        aws.StringSlice(images),
+	}
+}
+
+func TestNewImagePrePullerDisabled(t *testing.T) {
+	puller := newImagePrePuller(context.TODO(), nil, nil, nil, 2, time.Minute)
+	assert.Nil(t, puller)
+	assert.Zero(t, puller.prePull([]*ecsacs.TaskIdentifier{prePullTestTask("arn", "RUNNING", "busybox")}))
+}
+
+func TestImagePrePullerRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().GetTaskByArn(gomock.Any()).Return(nil, false).AnyTimes()
+	client := newBlockingPullClient()
+	images := dockerapi.NewPrePulledImages(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	puller := newImagePrePuller(ctx, images, client, taskEngine, 2, time.Minute)
+
+	assert.Equal(t, 4, puller.prePull([]*ecsacs.TaskIdentifier{
+		prePullTestTask("arn1", apitaskstatus.TaskRunningString, "image1", "image2"),
+		prePullTestTask("arn2", apitaskstatus.TaskRunningString, "image3", "image4"),
+	}))
+	for deadline := time.Now().Add(time.Second); len(client.pulls()) < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	// The other pulls wait for a free slot
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(t, client.pulls(), 2)
+
+	close(client.release)
+	for _, image := range []string{"image1", "image2", "image3", "image4"} {
+		_, ok := images.Wait(ctx, image)
+		assert.True(t, ok)
+	}
+	assert.Len(t, client.pulls(), 4)
+	assert.Equal(t, 2, client.maxConcurrent)
+}
+
+func TestImagePrePullerDeduplication(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().GetTaskByArn("known").Return(&apitask.Task{}, true).AnyTimes()
+	taskEngine.EXPECT().GetTaskByArn(gomock.Any()).Return(nil, false).AnyTimes()
+	client := newBlockingPullClient()
+	images := dockerapi.NewPrePulledImages(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	puller := newImagePrePuller(ctx, images, client, taskEngine, 2, time.Minute)
+
+	assert.Equal(t, 2, puller.prePull([]*ecsacs.TaskIdentifier{
+		prePullTestTask("arn1", apitaskstatus.TaskRunningString, "shared", "image1"),
+		prePullTestTask("arn2", apitaskstatus.TaskRunningString, "shared"),
+		prePullTestTask("stopped", apitaskstatus.TaskStoppedString, "image2"),
+		prePullTestTask("known", apitaskstatus.TaskRunningString, "image3"),
+	}))
+	// The images being pre-pulled aren't pulled again for the next manifest
+	assert.Zero(t, puller.prePull([]*ecsacs.TaskIdentifier{
+		prePullTestTask("arn1", apitaskstatus.TaskRunningString, "shared", "image1"),
+	}))
+
+	// Nor when the task arrives while they are being pre-pulled
+	engineClient := dockerapi.NewPrePullAwareDockerClient(client, images)
+	pulled := make(chan dockerapi.DockerContainerMetadata)
+	go func() {
+		pulled <- engineClient.PullImage(ctx, "shared", nil, time.Minute)
+	}()
+	close(client.release)
+	assert.NoError(t, (<-pulled).Error)
+	_, ok := images.Wait(ctx, "image1")
+	require.True(t, ok)
+	assert.ElementsMatch(t, []string{"shared", "image1"}, client.pulls())
+}
+
+func TestTaskManifestHandlerPrePullsImages(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().ListTasks().Return(nil, nil)
+	taskEngine.EXPECT().GetTaskByArn(gomock.Any()).Return(nil, false).AnyTimes()
+	client := newBlockingPullClient()
+	close(client.release)
+	images := dockerapi.NewPrePulledImages(time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := newTaskManifestHandler(ctx, "cluster", "containerInstance", nil, data.NewNoopClient(), taskEngine,
+		aws.Int64(testSeqNum-1), testManifestHistoryDepth, nil, nil,
+		newImagePrePuller(ctx, images, client, taskEngine, 2, time.Minute), nil)
+
+	require.NoError(t, handler.handleTaskManifestSingleMessage(&ecsacs.TaskManifestMessage{
+		MessageId:  aws.String("manifest-message-id"),
+		ClusterArn: aws.String("cluster"),
+		Tasks:      []*ecsacs.TaskIdentifier{prePullTestTask("arn1", apitaskstatus.TaskRunningString, "busybox")},
+		Timeline:   aws.Int64(testSeqNum),
+	}))
+	metadata, ok := images.Wait(ctx, "busybox")
+	assert.True(t, ok)
+	assert.NoError(t, metadata.Error)
+	assert.Equal(t, []string{"busybox"}, client.pulls())
+}
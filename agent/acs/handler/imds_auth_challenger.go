@@ -0,0 +1,70 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	"github.com/pkg/errors"
+)
+
+// imdsAuthChallengeResponse is the response of the IMDSAuthChallenger
+type imdsAuthChallengeResponse struct {
+	// Challenge is the base64 encoded challenge being answered
+	Challenge string `json:"challenge"`
+	// Timestamp is the time the response was computed at
+	Timestamp time.Time `json:"timestamp"`
+	// Document is the instance identity document of the instance
+	Document string `json:"document"`
+	// Signature is the signature of the document by AWS
+	Signature string `json:"signature"`
+}
+
+// IMDSAuthChallenger answers the authentication challenges of ACS with a time
+// stamped token built from the instance identity document and its signature
+// fetched from the instance metadata service. ACS verifies the signature to
+// authenticate the instance, and the echoed challenge and the timestamp to
+// check that the token is fresh.
+type IMDSAuthChallenger struct {
+	ec2MetadataClient ec2.EC2MetadataClient
+}
+
+// NewIMDSAuthChallenger returns a new IMDSAuthChallenger
+func NewIMDSAuthChallenger(ec2MetadataClient ec2.EC2MetadataClient) *IMDSAuthChallenger {
+	return &IMDSAuthChallenger{ec2MetadataClient: ec2MetadataClient}
+}
+
+// Respond implements AuthChallenger
+func (challenger *IMDSAuthChallenger) Respond(challenge []byte) ([]byte, error) {
+	if challenger.ec2MetadataClient == nil {
+		return nil, errors.New("instance metadata service unavailable")
+	}
+	document, err := challenger.ec2MetadataClient.GetDynamicData(ec2.InstanceIdentityDocumentResource)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get the instance identity document")
+	}
+	signature, err := challenger.ec2MetadataClient.GetDynamicData(ec2.InstanceIdentityDocumentSignatureResource)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get the signature of the instance identity document")
+	}
+	return json.Marshal(imdsAuthChallengeResponse{
+		Challenge: base64.StdEncoding.EncodeToString(challenge),
+		Timestamp: time.Now().UTC(),
+		Document:  document,
+		Signature: signature,
+	})
+}
@@ -0,0 +1,140 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/agent/handlers/utils"
+)
+
+// inFlightAckTracker keeps track of the messages received by a handler until
+// they are acked, so that the acks that take a long time to be sent can be
+// inspected through the introspection API
+type inFlightAckTracker struct {
+	lock sync.Mutex
+	acks map[string]*handlersutils.InFlightAck
+}
+
+// newInFlightAckTracker returns a new inFlightAckTracker object
+func newInFlightAckTracker() *inFlightAckTracker {
+	return &inFlightAckTracker{
+		acks: make(map[string]*handlersutils.InFlightAck),
+	}
+}
+
+// trackReceived records that a message was received from ACS
+func (tracker *inFlightAckTracker) trackReceived(messageType string, messageID string) {
+	if tracker == nil || messageID == "" {
+		return
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	tracker.acks[messageID] = &handlersutils.InFlightAck{
+		MessageID:   messageID,
+		MessageType: messageType,
+		ReceivedAt:  time.Now(),
+	}
+}
+
+// trackAckQueued records that a message was handled and that its ack is
+// waiting to be sent
+func (tracker *inFlightAckTracker) trackAckQueued(messageID string) {
+	if tracker == nil {
+		return
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	if ack, ok := tracker.acks[messageID]; ok {
+		ack.WaitingSince = time.Now()
+	}
+}
+
+// trackAcked records that a message was acked, or that it won't be
+func (tracker *inFlightAckTracker) trackAcked(messageID string) {
+	if tracker == nil {
+		return
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	delete(tracker.acks, messageID)
+}
+
+// ListInFlightAcks returns the messages that haven't been acked yet, oldest first
+func (tracker *inFlightAckTracker) ListInFlightAcks() []handlersutils.InFlightAck {
+	acks := []handlersutils.InFlightAck{}
+	if tracker == nil {
+		return acks
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	for _, ack := range tracker.acks {
+		acks = append(acks, *ack)
+	}
+	sortInFlightAcks(acks)
+	return acks
+}
+
+// InFlightAckRegistry aggregates the in-flight acks of the handlers of the
+// current ACS connection. It outlives the connections so that it can be handed
+// over to the introspection server when the agent starts
+type InFlightAckRegistry struct {
+	lock    sync.RWMutex
+	listers []handlersutils.InFlightAckLister
+}
+
+// NewInFlightAckRegistry returns a new InFlightAckRegistry object
+func NewInFlightAckRegistry() *InFlightAckRegistry {
+	return &InFlightAckRegistry{}
+}
+
+// register replaces the handlers whose in-flight acks are listed. It returns a
+// function unregistering them
+func (registry *InFlightAckRegistry) register(listers ...handlersutils.InFlightAckLister) func() {
+	if registry == nil {
+		return func() {}
+	}
+	registry.lock.Lock()
+	defer registry.lock.Unlock()
+	registry.listers = listers
+	return func() {
+		registry.lock.Lock()
+		defer registry.lock.Unlock()
+		registry.listers = nil
+	}
+}
+
+// ListInFlightAcks returns the in-flight acks of all the registered handlers,
+// oldest first
+func (registry *InFlightAckRegistry) ListInFlightAcks() []handlersutils.InFlightAck {
+	acks := []handlersutils.InFlightAck{}
+	if registry == nil {
+		return acks
+	}
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+	for _, lister := range registry.listers {
+		acks = append(acks, lister.ListInFlightAcks()...)
+	}
+	sortInFlightAcks(acks)
+	return acks
+}
+
+func sortInFlightAcks(acks []handlersutils.InFlightAck) {
+	sort.Slice(acks, func(i, j int) bool {
+		return acks[i].ReceivedAt.Before(acks[j].ReceivedAt)
+	})
+}
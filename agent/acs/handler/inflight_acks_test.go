@@ -0,0 +1,120 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	handlersutils "github.com/aws/amazon-ecs-agent/agent/handlers/utils"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlightAckTrackerLifecycle(t *testing.T) {
+	tracker := newInFlightAckTracker()
+
+	tracker.trackReceived("PayloadMessage", "first")
+	tracker.trackReceived("PayloadMessage", "second")
+	acks := tracker.ListInFlightAcks()
+	require.Len(t, acks, 2)
+	assert.Equal(t, "first", acks[0].MessageID)
+	assert.Equal(t, "PayloadMessage", acks[0].MessageType)
+	assert.True(t, acks[0].WaitingSince.IsZero())
+
+	tracker.trackAckQueued("first")
+	acks = tracker.ListInFlightAcks()
+	require.Len(t, acks, 2)
+	assert.False(t, acks[0].WaitingSince.IsZero())
+
+	tracker.trackAcked("first")
+	acks = tracker.ListInFlightAcks()
+	require.Len(t, acks, 1)
+	assert.Equal(t, "second", acks[0].MessageID)
+
+	tracker.trackAcked("second")
+	assert.Empty(t, tracker.ListInFlightAcks())
+}
+
+func TestInFlightAckTrackerIgnoresUnknownMessages(t *testing.T) {
+	tracker := newInFlightAckTracker()
+
+	tracker.trackReceived("HeartbeatMessage", "")
+	tracker.trackAckQueued("unknown")
+	tracker.trackAcked("unknown")
+
+	assert.Empty(t, tracker.ListInFlightAcks())
+}
+
+func TestNilInFlightAckTracker(t *testing.T) {
+	var tracker *inFlightAckTracker
+
+	tracker.trackReceived("PayloadMessage", "id")
+	tracker.trackAckQueued("id")
+	tracker.trackAcked("id")
+
+	assert.NotNil(t, tracker.ListInFlightAcks())
+	assert.Empty(t, tracker.ListInFlightAcks())
+}
+
+type fakeInFlightAckLister []handlersutils.InFlightAck
+
+func (lister fakeInFlightAckLister) ListInFlightAcks() []handlersutils.InFlightAck {
+	return lister
+}
+
+func TestInFlightAckRegistryAggregatesHandlers(t *testing.T) {
+	now := time.Now()
+	registry := NewInFlightAckRegistry()
+	unregister := registry.register(
+		fakeInFlightAckLister{{MessageID: "newest", ReceivedAt: now}},
+		fakeInFlightAckLister{{MessageID: "oldest", ReceivedAt: now.Add(-time.Minute)}},
+	)
+
+	acks := registry.ListInFlightAcks()
+	require.Len(t, acks, 2)
+	assert.Equal(t, "oldest", acks[0].MessageID)
+	assert.Equal(t, "newest", acks[1].MessageID)
+
+	unregister()
+	assert.Empty(t, registry.ListInFlightAcks())
+}
+
+func TestInFlightAckRegistryListsPayloadHandlerAcks(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+
+	registry := NewInFlightAckRegistry()
+	defer registry.register(&tester.payloadHandler)()
+
+	tester.payloadHandler.trackReceived("PayloadMessage", payloadMessageId)
+	acks := registry.ListInFlightAcks()
+	require.Len(t, acks, 1)
+	assert.Equal(t, payloadMessageId, acks[0].MessageID)
+
+	tester.mockWsClient.EXPECT().MakeRequest(gomock.Any()).Return(nil)
+	tester.payloadHandler.ackMessageId(payloadMessageId)
+	assert.Empty(t, registry.ListInFlightAcks())
+}
+
+func TestNilInFlightAckRegistry(t *testing.T) {
+	var registry *InFlightAckRegistry
+
+	registry.register(fakeInFlightAckLister{{MessageID: "id"}})()
+	assert.Empty(t, registry.ListInFlightAcks())
+}
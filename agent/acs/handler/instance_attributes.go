@@ -0,0 +1,117 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"net/url"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	"github.com/cihub/seelog"
+)
+
+const (
+	instanceAttributesURLParameterName = "instanceAttributes"
+
+	availabilityZoneResource  = "placement/availability-zone"
+	amiIDResource             = "ami-id"
+	instanceLifeCycleResource = "instance-life-cycle"
+)
+
+// instanceAttributes describes the placement attributes of the instance. They
+// are advertised to ACS in the connection URL so that ACS can route task
+// manifests to the right agents
+type instanceAttributes struct {
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+	InstanceType     string `json:"instanceType,omitempty"`
+	AMIID            string `json:"amiId,omitempty"`
+	// CapacityType is the life cycle of the instance: "on-demand", "spot" or "scheduled"
+	CapacityType string `json:"capacityType,omitempty"`
+}
+
+// instanceAttributesFetcher gets the instance attributes from the EC2 instance
+// metadata service. The attributes don't change during the lifetime of the
+// instance, so they are fetched once and cached
+type instanceAttributesFetcher struct {
+	ec2MetadataClient ec2.EC2MetadataClient
+	lock              sync.Mutex
+	attributes        *instanceAttributes
+}
+
+// newInstanceAttributesFetcher returns a new instanceAttributesFetcher object,
+// or nil if there's no EC2 metadata client, in which case no attributes are
+// advertised to ACS
+func newInstanceAttributesFetcher(ec2MetadataClient ec2.EC2MetadataClient) *instanceAttributesFetcher {
+	if ec2MetadataClient == nil {
+		return nil
+	}
+	return &instanceAttributesFetcher{
+		ec2MetadataClient: ec2MetadataClient,
+	}
+}
+
+// fetch returns the instance attributes, getting them from the EC2 instance
+// metadata service the first time. Attributes that can't be retrieved are left
+// empty. It returns nil if none of them could be retrieved, in which case they
+// are fetched again on the next call
+func (fetcher *instanceAttributesFetcher) fetch() *instanceAttributes {
+	if fetcher == nil {
+		return nil
+	}
+	fetcher.lock.Lock()
+	defer fetcher.lock.Unlock()
+	if fetcher.attributes != nil {
+		return fetcher.attributes
+	}
+
+	attributes := &instanceAttributes{
+		AvailabilityZone: fetcher.getMetadata(availabilityZoneResource),
+		AMIID:            fetcher.getMetadata(amiIDResource),
+		CapacityType:     fetcher.getMetadata(instanceLifeCycleResource),
+	}
+	instanceType, err := fetcher.ec2MetadataClient.InstanceType()
+	if err != nil {
+		seelog.Warnf("Unable to get instance type from EC2 metadata service, it will not be advertised to ACS: %v", err)
+	}
+	attributes.InstanceType = instanceType
+	if *attributes == (instanceAttributes{}) {
+		return nil
+	}
+	fetcher.attributes = attributes
+	return attributes
+}
+
+func (fetcher *instanceAttributesFetcher) getMetadata(resource string) string {
+	value, err := fetcher.ec2MetadataClient.GetMetadata(resource)
+	if err != nil {
+		seelog.Warnf("Unable to get %s from EC2 metadata service, it will not be advertised to ACS: %v", resource, err)
+		return ""
+	}
+	return value
+}
+
+// setURLParameters sets the instance attributes URL parameter in the query, as
+// a JSON object
+func (attributes *instanceAttributes) setURLParameters(query url.Values) {
+	if attributes == nil {
+		return
+	}
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		seelog.Warnf("Unable to encode instance attributes, they will not be advertised to ACS: %v", err)
+		return
+	}
+	query.Set(instanceAttributesURLParameterName, string(encoded))
+}
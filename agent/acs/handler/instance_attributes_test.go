@@ -0,0 +1,100 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	mock_ec2 "github.com/aws/amazon-ecs-agent/agent/ec2/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchInstanceAttributes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().GetMetadata(availabilityZoneResource).Return("us-west-2a", nil)
+	ec2MetadataClient.EXPECT().GetMetadata(amiIDResource).Return("ami-12345678", nil)
+	ec2MetadataClient.EXPECT().GetMetadata(instanceLifeCycleResource).Return("on-demand", nil)
+	ec2MetadataClient.EXPECT().InstanceType().Return("m5.large", nil)
+
+	fetcher := newInstanceAttributesFetcher(ec2MetadataClient)
+	attributes := fetcher.fetch()
+	require.NotNil(t, attributes)
+	assert.Equal(t, instanceAttributes{
+		AvailabilityZone: "us-west-2a",
+		InstanceType:     "m5.large",
+		AMIID:            "ami-12345678",
+		CapacityType:     "on-demand",
+	}, *attributes)
+
+	// The attributes are cached, the metadata service isn't queried again
+	assert.Equal(t, attributes, fetcher.fetch())
+}
+
+func TestFetchInstanceAttributesPartiallyAvailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().GetMetadata(availabilityZoneResource).Return("us-west-2a", nil)
+	ec2MetadataClient.EXPECT().GetMetadata(amiIDResource).Return("", errors.New("not found"))
+	ec2MetadataClient.EXPECT().GetMetadata(instanceLifeCycleResource).Return("", errors.New("not found"))
+	ec2MetadataClient.EXPECT().InstanceType().Return("", errors.New("not found"))
+
+	attributes := newInstanceAttributesFetcher(ec2MetadataClient).fetch()
+	require.NotNil(t, attributes)
+	assert.Equal(t, instanceAttributes{AvailabilityZone: "us-west-2a"}, *attributes)
+}
+
+func TestFetchInstanceAttributesMetadataUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().GetMetadata(gomock.Any()).Return("", errors.New("imds unavailable")).Times(6)
+	ec2MetadataClient.EXPECT().InstanceType().Return("", errors.New("imds unavailable")).Times(2)
+
+	// Nothing is cached when the metadata service is unavailable, the attributes
+	// are fetched again on the next connection
+	fetcher := newInstanceAttributesFetcher(ec2MetadataClient)
+	assert.Nil(t, fetcher.fetch())
+	assert.Nil(t, fetcher.fetch())
+}
+
+func TestFetchInstanceAttributesNoMetadataClient(t *testing.T) {
+	assert.Nil(t, newInstanceAttributesFetcher(nil).fetch())
+}
+
+func TestInstanceAttributesSetURLParameters(t *testing.T) {
+	query := url.Values{}
+	attributes := &instanceAttributes{
+		AvailabilityZone: "us-west-2a",
+		CapacityType:     "spot",
+	}
+	attributes.setURLParameters(query)
+	assert.Equal(t, `{"availabilityZone":"us-west-2a","capacityType":"spot"}`, query.Get(instanceAttributesURLParameterName))
+
+	query = url.Values{}
+	(*instanceAttributes)(nil).setURLParameters(query)
+	assert.Empty(t, query)
+}
@@ -0,0 +1,86 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"net/url"
+	"runtime"
+	"strconv"
+
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	"github.com/cihub/seelog"
+	"github.com/docker/docker/pkg/system"
+)
+
+const (
+	instanceTypeURLParameterName       = "instanceType"
+	availableCPUURLParameterName       = "availableCPU"
+	availableMemoryMiBURLParameterName = "availableMemoryMiB"
+)
+
+// These are variables so that they can be overridden in unit tests
+var (
+	readMemInfo = system.ReadMemInfo
+	numCPU      = runtime.NumCPU
+)
+
+// instanceResources describes the instance type and the resources available
+// for tasks on this instance. It is advertised to ACS in the connection URL
+// so that ACS can take it into account when making placement decisions
+type instanceResources struct {
+	instanceType       string
+	availableCPU       int64
+	availableMemoryMiB int64
+}
+
+// fetchInstanceResources gets the instance type from the EC2 instance metadata
+// service and computes the cpu and memory available for tasks the same way they
+// are computed during instance registration. It returns nil if the instance type
+// could not be retrieved, in which case nothing is advertised to ACS
+func fetchInstanceResources(ec2MetadataClient ec2.EC2MetadataClient, reservedMemory uint16) *instanceResources {
+	if ec2MetadataClient == nil {
+		return nil
+	}
+	instanceType, err := ec2MetadataClient.InstanceType()
+	if err != nil {
+		seelog.Warnf("Unable to get instance type from EC2 metadata service, instance resources will not be advertised to ACS: %v", err)
+		return nil
+	}
+
+	memory := int64(0)
+	memInfo, err := readMemInfo()
+	if err != nil {
+		seelog.Warnf("Unable to get memory info, available memory will not be advertised to ACS: %v", err)
+	} else {
+		memory = memInfo.MemTotal/1024/1024 - int64(reservedMemory)
+	}
+
+	return &instanceResources{
+		instanceType:       instanceType,
+		availableCPU:       int64(numCPU() * 1024),
+		availableMemoryMiB: memory,
+	}
+}
+
+// setURLParameters sets the instance resource URL parameters in the query
+func (resources *instanceResources) setURLParameters(query url.Values) {
+	if resources == nil {
+		return
+	}
+	query.Set(instanceTypeURLParameterName, resources.instanceType)
+	query.Set(availableCPUURLParameterName, strconv.FormatInt(resources.availableCPU, 10))
+	if resources.availableMemoryMiB > 0 {
+		query.Set(availableMemoryMiBURLParameterName, strconv.FormatInt(resources.availableMemoryMiB, 10))
+	}
+}
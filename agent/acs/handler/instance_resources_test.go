@@ -0,0 +1,86 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	mock_ec2 "github.com/aws/amazon-ecs-agent/agent/ec2/mocks"
+	"github.com/docker/docker/pkg/system"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setInstanceResourcesHostStubs(t *testing.T, memInfo *system.MemInfo, memErr error, cpus int) {
+	readMemInfo = func() (*system.MemInfo, error) {
+		return memInfo, memErr
+	}
+	numCPU = func() int {
+		return cpus
+	}
+	t.Cleanup(func() {
+		readMemInfo = system.ReadMemInfo
+		numCPU = runtime.NumCPU
+	})
+}
+
+func TestFetchInstanceResources(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	setInstanceResourcesHostStubs(t, &system.MemInfo{MemTotal: 8 * 1024 * 1024 * 1024}, nil, 2)
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().InstanceType().Return("m5.large", nil)
+
+	resources := fetchInstanceResources(ec2MetadataClient, 512)
+	require.NotNil(t, resources)
+	assert.Equal(t, "m5.large", resources.instanceType)
+	assert.Equal(t, int64(2048), resources.availableCPU)
+	assert.Equal(t, int64(7680), resources.availableMemoryMiB)
+}
+
+func TestFetchInstanceResourcesMetadataUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().InstanceType().Return("", errors.New("imds unavailable"))
+
+	assert.Nil(t, fetchInstanceResources(ec2MetadataClient, 0))
+}
+
+func TestFetchInstanceResourcesMemInfoUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	setInstanceResourcesHostStubs(t, nil, errors.New("no meminfo"), 4)
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().InstanceType().Return("c5.xlarge", nil)
+
+	resources := fetchInstanceResources(ec2MetadataClient, 0)
+	require.NotNil(t, resources)
+	assert.Equal(t, "c5.xlarge", resources.instanceType)
+	assert.Equal(t, int64(4096), resources.availableCPU)
+	assert.Equal(t, int64(0), resources.availableMemoryMiB)
+}
+
+func TestFetchInstanceResourcesNoMetadataClient(t *testing.T) {
+	assert.Nil(t, fetchInstanceResources(nil, 0))
+}
@@ -0,0 +1,153 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+)
+
+const (
+	// taskLaunchPollInterval is the interval at which the status of a task being
+	// launched is checked to determine the outcome of the launch
+	taskLaunchPollInterval = time.Second
+	// lowTaskLaunchSuccessRateEvent is the ACS event recorded when the task launch
+	// success rate drops below the minimum success rate
+	lowTaskLaunchSuccessRateEvent = "LowTaskLaunchSuccessRate"
+)
+
+// launchSuccessRateTracker tracks the outcome of the most recent launches of
+// tasks received from ACS in a rolling window, to detect when the agent keeps
+// failing to start tasks (e.g. because images cannot be pulled)
+type launchSuccessRateTracker struct {
+	windowSize     int
+	minSuccessRate float64
+	// reconnect specifies whether the connection to ACS should be reset when
+	// the success rate drops below minSuccessRate
+	reconnect    bool
+	pollInterval time.Duration
+	lock         sync.Mutex
+	// outcomes is a ring buffer holding the outcomes of the launches in the window
+	outcomes  []bool
+	next      int
+	count     int
+	successes int
+}
+
+// newLaunchSuccessRateTracker returns a new launchSuccessRateTracker object
+func newLaunchSuccessRateTracker(windowSize int, minSuccessRate float64, reconnect bool) *launchSuccessRateTracker {
+	if windowSize <= 0 {
+		windowSize = config.DefaultACSLaunchSuccessRateWindowSize
+	}
+	return &launchSuccessRateTracker{
+		windowSize:     windowSize,
+		minSuccessRate: minSuccessRate,
+		reconnect:      reconnect,
+		pollInterval:   taskLaunchPollInterval,
+		outcomes:       make([]bool, windowSize),
+	}
+}
+
+// record records the outcome of a task launch. It returns the success rate over
+// the window and whether it has dropped below the minimum success rate. The rate
+// is only evaluated once the window is full, and the window is reset when the
+// rate drops below the minimum so that the same launches aren't reported twice
+func (tracker *launchSuccessRateTracker) record(success bool) (float64, bool) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	if tracker.count == tracker.windowSize {
+		// Evict the oldest outcome from the window
+		if tracker.outcomes[tracker.next] {
+			tracker.successes--
+		}
+	} else {
+		tracker.count++
+	}
+	tracker.outcomes[tracker.next] = success
+	if success {
+		tracker.successes++
+	}
+	tracker.next = (tracker.next + 1) % tracker.windowSize
+
+	rate := tracker.successRateUnsafe()
+	if tracker.count < tracker.windowSize || rate >= tracker.minSuccessRate {
+		return rate, false
+	}
+	tracker.next, tracker.count, tracker.successes = 0, 0, 0
+	return rate, true
+}
+
+// successRate returns the success rate of the launches in the window
+func (tracker *launchSuccessRateTracker) successRate() float64 {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	return tracker.successRateUnsafe()
+}
+
+func (tracker *launchSuccessRateTracker) successRateUnsafe() float64 {
+	if tracker.count == 0 {
+		return 1
+	}
+	return float64(tracker.successes) / float64(tracker.count)
+}
+
+// monitor waits for the launch of the task to either succeed or fail and records
+// its outcome. onLowSuccessRate is invoked with the success rate if it drops
+// below the minimum success rate
+func (tracker *launchSuccessRateTracker) monitor(ctx context.Context, task *apitask.Task,
+	onLowSuccessRate func(rate float64)) {
+	if tracker == nil {
+		return
+	}
+	ticker := time.NewTicker(tracker.pollInterval)
+	defer ticker.Stop()
+	for {
+		if success, done := taskLaunchOutcome(task); done {
+			if rate, low := tracker.record(success); low {
+				onLowSuccessRate(rate)
+			}
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// taskLaunchOutcome returns whether the launch of the task succeeded, and whether
+// its outcome is known yet. A launch has succeeded if the task reached RUNNING,
+// or if any of its containers ran before the task stopped
+func taskLaunchOutcome(task *apitask.Task) (bool, bool) {
+	knownStatus := task.GetKnownStatus()
+	if knownStatus < apitaskstatus.TaskRunning {
+		return false, false
+	}
+	if knownStatus == apitaskstatus.TaskRunning {
+		return true, true
+	}
+	for _, container := range task.Containers {
+		if container.GetKnownExitCode() != nil {
+			return true, true
+		}
+	}
+	return false, true
+}
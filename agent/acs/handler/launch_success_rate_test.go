@@ -0,0 +1,134 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLaunchSuccessRateTrackerRate(t *testing.T) {
+	tracker := newLaunchSuccessRateTracker(4, 0.25, false)
+	assert.Equal(t, 1.0, tracker.successRate())
+
+	rate, low := tracker.record(true)
+	assert.Equal(t, 1.0, rate)
+	assert.False(t, low)
+	rate, low = tracker.record(false)
+	assert.Equal(t, 0.5, rate)
+	assert.False(t, low)
+	tracker.record(false)
+	rate, low = tracker.record(true)
+	assert.Equal(t, 0.5, rate)
+	assert.False(t, low)
+
+	// The oldest success is evicted from the window
+	rate, low = tracker.record(false)
+	assert.Equal(t, 0.25, rate)
+	assert.False(t, low)
+}
+
+func TestLaunchSuccessRateTrackerLowRateOnlyWhenWindowFull(t *testing.T) {
+	tracker := newLaunchSuccessRateTracker(3, 0.5, false)
+
+	_, low := tracker.record(false)
+	assert.False(t, low, "Rate should not be evaluated before the window is full")
+	_, low = tracker.record(false)
+	assert.False(t, low, "Rate should not be evaluated before the window is full")
+	rate, low := tracker.record(true)
+	assert.True(t, low)
+	assert.InDelta(t, 1.0/3, rate, 0.001)
+
+	// The window is reset after the rate drops below the minimum
+	assert.Equal(t, 1.0, tracker.successRate())
+	_, low = tracker.record(false)
+	assert.False(t, low)
+}
+
+func TestNewLaunchSuccessRateTrackerDefaultsInvalidWindowSize(t *testing.T) {
+	tracker := newLaunchSuccessRateTracker(0, 0.5, false)
+	assert.Equal(t, config.DefaultACSLaunchSuccessRateWindowSize, tracker.windowSize)
+}
+
+func TestTaskLaunchOutcome(t *testing.T) {
+	exitCode := 0
+	testCases := []struct {
+		name          string
+		knownStatus   apitaskstatus.TaskStatus
+		exitCode      *int
+		expectSuccess bool
+		expectDone    bool
+	}{
+		{"pending", apitaskstatus.TaskCreated, nil, false, false},
+		{"running", apitaskstatus.TaskRunning, nil, true, true},
+		{"stopped after running", apitaskstatus.TaskStopped, &exitCode, true, true},
+		{"stopped without running", apitaskstatus.TaskStopped, nil, false, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			container := &apicontainer.Container{}
+			container.SetKnownExitCode(tc.exitCode)
+			task := &apitask.Task{
+				KnownStatusUnsafe: tc.knownStatus,
+				Containers:        []*apicontainer.Container{container},
+			}
+			success, done := taskLaunchOutcome(task)
+			assert.Equal(t, tc.expectSuccess, success)
+			assert.Equal(t, tc.expectDone, done)
+		})
+	}
+}
+
+func TestLaunchSuccessRateTrackerMonitorTriggersOnLowRate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	tracker := newLaunchSuccessRateTracker(2, 0.5, true)
+	tracker.pollInterval = 10 * time.Millisecond
+
+	lowRates := make(chan float64, 1)
+	onLowSuccessRate := func(rate float64) {
+		lowRates <- rate
+	}
+
+	failedTask := &apitask.Task{KnownStatusUnsafe: apitaskstatus.TaskStopped}
+	tracker.monitor(ctx, failedTask, onLowSuccessRate)
+
+	pendingTask := &apitask.Task{KnownStatusUnsafe: apitaskstatus.TaskCreated}
+	go tracker.monitor(ctx, pendingTask, onLowSuccessRate)
+	pendingTask.SetKnownStatus(apitaskstatus.TaskStopped)
+
+	select {
+	case rate := <-lowRates:
+		assert.Equal(t, 0.0, rate)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the low success rate to be reported")
+	}
+}
+
+func TestNilLaunchSuccessRateTrackerMonitor(t *testing.T) {
+	var tracker *launchSuccessRateTracker
+	tracker.monitor(context.TODO(), &apitask.Task{}, func(float64) {
+		t.Fatal("Unexpected call to onLowSuccessRate")
+	})
+}
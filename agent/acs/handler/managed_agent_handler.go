@@ -0,0 +1,139 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// managedAgentUpdateFailedEvent is the ACS event recorded when a managed
+	// agent did not acknowledge a configuration update
+	managedAgentUpdateFailedEvent = "ManagedAgentUpdateFailed"
+)
+
+// managedAgentHandler handles the configuration updates pushed by ACS to the
+// managed sidecar agents of tasks, such as the Service Connect agent. Updates
+// are handed over to the task engine and the message is acked once the managed
+// agent has acknowledged the update. Updates that are not acknowledged are not
+// acked either, so that ACS resends them
+type managedAgentHandler struct {
+	messageBuffer        chan *ecsacs.ManagedAgentUpdateMessage
+	ctx                  context.Context
+	cancel               context.CancelFunc
+	cluster              string
+	containerInstanceArn string
+	acsClient            wsclient.ClientServer
+	taskEngine           engine.TaskEngine
+	*inFlightAckTracker
+	routines *handlerRoutines
+}
+
+// newManagedAgentHandler returns an instance of the managedAgentHandler struct
+func newManagedAgentHandler(ctx context.Context,
+	cluster string, containerInstanceArn string, acsClient wsclient.ClientServer,
+	taskEngine engine.TaskEngine) managedAgentHandler {
+
+	// Create a cancelable context from the parent context
+	derivedContext, cancel := context.WithCancel(ctx)
+	return managedAgentHandler{
+		messageBuffer:        make(chan *ecsacs.ManagedAgentUpdateMessage),
+		ctx:                  derivedContext,
+		cancel:               cancel,
+		cluster:              cluster,
+		containerInstanceArn: containerInstanceArn,
+		acsClient:            acsClient,
+		taskEngine:           taskEngine,
+		inFlightAckTracker:   newInFlightAckTracker(),
+		routines:             &handlerRoutines{},
+	}
+}
+
+// handlerFunc returns the request handler function for the ManagedAgentUpdateMessage
+func (handler *managedAgentHandler) handlerFunc() func(message *ecsacs.ManagedAgentUpdateMessage) {
+	return func(message *ecsacs.ManagedAgentUpdateMessage) {
+		handler.trackReceived("ManagedAgentUpdateMessage", aws.StringValue(message.MessageId))
+		select {
+		case handler.messageBuffer <- message:
+		case <-handler.ctx.Done():
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// start invokes go routines to handle managed agent update messages
+func (handler *managedAgentHandler) start() {
+	handler.routines.run(handler.handleMessages)
+}
+
+// stop is used to invoke a cancellation function
+func (handler *managedAgentHandler) stop() {
+	handler.cancel()
+}
+
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (handler *managedAgentHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, handler.stop, handler.routines, nil)
+}
+
+// handleMessages processes the managed agent update messages in-order
+func (handler *managedAgentHandler) handleMessages() {
+	for {
+		select {
+		case <-handler.ctx.Done():
+			return
+		case message := <-handler.messageBuffer:
+			if err := handler.handleSingleMessage(message); err != nil {
+				seelog.Warnf("Unable to handle managed agent update message [%s]: %v", message.String(), err)
+				metrics.MetricsEngineGlobal.RecordACSEvent(managedAgentUpdateFailedEvent, 1)
+			}
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// handleSingleMessage pushes the configuration update to the managed agent and
+// acks the message once the managed agent has acknowledged it
+func (handler *managedAgentHandler) handleSingleMessage(message *ecsacs.ManagedAgentUpdateMessage) error {
+	if message.MessageId == nil {
+		return fmt.Errorf("managed agent handler: message id not set in message")
+	}
+	taskARN := aws.StringValue(message.TaskArn)
+	if taskARN == "" {
+		return fmt.Errorf("managed agent handler: task arn not set in message")
+	}
+	agentType := aws.StringValue(message.ManagedAgentType)
+	if agentType == "" {
+		return fmt.Errorf("managed agent handler: managed agent type not set in message")
+	}
+
+	seelog.Infof("Updating the configuration of the %s agent of task %s, message id: %s",
+		agentType, taskARN, aws.StringValue(message.MessageId))
+	if err := handler.taskEngine.UpdateManagedAgent(taskARN, agentType, aws.StringValue(message.ConfigBlob)); err != nil {
+		return err
+	}
+	return handler.acsClient.MakeRequest(&ecsacs.AckRequest{
+		Cluster:           aws.String(handler.cluster),
+		ContainerInstance: aws.String(handler.containerInstanceArn),
+		MessageId:         message.MessageId,
+	})
+}
@@ -0,0 +1,130 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testManagedAgentType   = "ServiceConnect"
+	testManagedAgentConfig = `{"xdsEndpoint":"unix:///var/run/ecs/relay.sock","meshName":"mesh"}`
+)
+
+func newTestManagedAgentHandler(ctrl *gomock.Controller) (managedAgentHandler,
+	*mock_engine.MockTaskEngine, *mock_wsclient.MockClientServer) {
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	handler := newManagedAgentHandler(context.TODO(), clusterName, containerInstanceArn, mockWSClient, taskEngine)
+	return handler, taskEngine, mockWSClient
+}
+
+func newTestManagedAgentUpdateMessage() *ecsacs.ManagedAgentUpdateMessage {
+	return &ecsacs.ManagedAgentUpdateMessage{
+		ClusterArn:           aws.String(clusterName),
+		ContainerInstanceArn: aws.String(containerInstanceArn),
+		MessageId:            aws.String(messageId),
+		TaskArn:              aws.String(taskArn),
+		ManagedAgentType:     aws.String(testManagedAgentType),
+		ConfigBlob:           aws.String(testManagedAgentConfig),
+	}
+}
+
+func TestManagedAgentHandlerUpdatesAndAcks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	handler, taskEngine, mockWSClient := newTestManagedAgentHandler(ctrl)
+	gomock.InOrder(
+		taskEngine.EXPECT().UpdateManagedAgent(taskArn, testManagedAgentType, testManagedAgentConfig).Return(nil),
+		mockWSClient.EXPECT().MakeRequest(&ecsacs.AckRequest{
+			Cluster:           aws.String(clusterName),
+			ContainerInstance: aws.String(containerInstanceArn),
+			MessageId:         aws.String(messageId),
+		}).Return(nil),
+	)
+
+	assert.NoError(t, handler.handleSingleMessage(newTestManagedAgentUpdateMessage()))
+}
+
+// TestManagedAgentHandlerDoesNotAckUnacknowledgedUpdate verifies that the message
+// isn't acked when the managed agent doesn't acknowledge the update in time or
+// rejects it, in which case the task engine rolls the update back
+func TestManagedAgentHandlerDoesNotAckUnacknowledgedUpdate(t *testing.T) {
+	for _, updateErr := range []error{
+		errors.New("i/o timeout"),
+		errors.New("update rejected with status NACK"),
+	} {
+		t.Run(updateErr.Error(), func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			handler, taskEngine, _ := newTestManagedAgentHandler(ctrl)
+			taskEngine.EXPECT().UpdateManagedAgent(taskArn, testManagedAgentType, testManagedAgentConfig).
+				Return(updateErr)
+
+			assert.Error(t, handler.handleSingleMessage(newTestManagedAgentUpdateMessage()))
+		})
+	}
+}
+
+func TestManagedAgentHandlerInvalidMessages(t *testing.T) {
+	testCases := []struct {
+		name    string
+		message *ecsacs.ManagedAgentUpdateMessage
+	}{
+		{
+			name: "missing message id",
+			message: &ecsacs.ManagedAgentUpdateMessage{
+				TaskArn:          aws.String(taskArn),
+				ManagedAgentType: aws.String(testManagedAgentType),
+			},
+		},
+		{
+			name: "missing task arn",
+			message: &ecsacs.ManagedAgentUpdateMessage{
+				MessageId:        aws.String(messageId),
+				ManagedAgentType: aws.String(testManagedAgentType),
+			},
+		},
+		{
+			name: "missing managed agent type",
+			message: &ecsacs.ManagedAgentUpdateMessage{
+				MessageId: aws.String(messageId),
+				TaskArn:   aws.String(taskArn),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			handler, _, _ := newTestManagedAgentHandler(ctrl)
+			assert.Error(t, handler.handleSingleMessage(tc.message))
+		})
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// manifestSigningKeyRefreshInterval is the interval at which the signing
+	// keys are fetched again from Secrets Manager, so that rotated keys are
+	// picked up
+	manifestSigningKeyRefreshInterval = 5 * time.Minute
+	// manifestSigningKeyMinRefreshInterval is the minimum interval between two
+	// fetches of the signing keys. The keys are fetched again before the refresh
+	// interval when a signature doesn't match, in case the key was just rotated
+	manifestSigningKeyMinRefreshInterval = 30 * time.Second
+	// manifestSigningKeyCurrentStage and manifestSigningKeyPreviousStage are the
+	// versions of the signing key secret accepted while the key is rotated
+	manifestSigningKeyCurrentStage  = "AWSCURRENT"
+	manifestSigningKeyPreviousStage = "AWSPREVIOUS"
+	// secretsManagerRoundtripTimeout is the timeout of the calls to Secrets Manager
+	secretsManagerRoundtripTimeout = 5 * time.Second
+	// taskManifestSignatureInvalidEvent is recorded every time a task manifest is
+	// rejected because its signature is missing or doesn't match
+	taskManifestSignatureInvalidEvent = "TaskManifestSignatureInvalid"
+)
+
+// ManifestSignatureVerifier verifies the HMAC-SHA256 signature of the task
+// manifests, so that manifests injected on the path from ACS can't stop the
+// tasks of the instance. The signing key is delivered out-of-band in a Secrets
+// Manager secret. Both its current and previous versions are accepted, so that
+// manifests signed just before the key is rotated are still accepted
+type ManifestSignatureVerifier struct {
+	client   secretsmanageriface.SecretsManagerAPI
+	secretID string
+	lock     sync.Mutex
+	keys     [][]byte
+	// fetchedAt is the time the keys were last fetched, successfully or not
+	fetchedAt time.Time
+}
+
+// newManifestSignatureVerifier returns a new ManifestSignatureVerifier fetching
+// the signing key with the instance credentials, or nil if the signature of the
+// task manifests isn't verified
+func newManifestSignatureVerifier(cfg *config.Config, credentialsProvider *credentials.Credentials) *ManifestSignatureVerifier {
+	if !cfg.ACSVerifyManifestSignature {
+		return nil
+	}
+	var asmConfig aws.Config
+	asmConfig.Credentials = credentialsProvider
+	asmConfig.Region = aws.String(cfg.AWSRegion)
+	asmConfig.HTTPClient = httpclient.New(secretsManagerRoundtripTimeout, cfg.AcceptInsecureCert)
+	return newManifestSignatureVerifierWithClient(secretsmanager.New(awssession.New(&asmConfig)),
+		cfg.ACSManifestSigningKeySecretID)
+}
+
+// newManifestSignatureVerifierWithClient returns a new ManifestSignatureVerifier
+// fetching the signing key from the secret with the Secrets Manager client
+func newManifestSignatureVerifierWithClient(client secretsmanageriface.SecretsManagerAPI,
+	secretID string) *ManifestSignatureVerifier {
+	return &ManifestSignatureVerifier{
+		client:   client,
+		secretID: secretID,
+	}
+}
+
+// Verify returns true if sig is the HMAC-SHA256 of the manifest with one of the
+// signing keys
+func (verifier *ManifestSignatureVerifier) Verify(manifest, sig []byte) bool {
+	keys, refreshable := verifier.signingKeys(false)
+	if verifySignature(keys, manifest, sig) {
+		return true
+	}
+	if !refreshable {
+		return false
+	}
+	keys, _ = verifier.signingKeys(true)
+	return verifySignature(keys, manifest, sig)
+}
+
+// verifyMessage verifies the signature of the task manifest message
+func (verifier *ManifestSignatureVerifier) verifyMessage(message *ecsacs.TaskManifestMessage) error {
+	if message.ManifestSignature == nil {
+		return fmt.Errorf("task manifest is not signed")
+	}
+	sig, err := base64.StdEncoding.DecodeString(aws.StringValue(message.ManifestSignature))
+	if err != nil {
+		return fmt.Errorf("task manifest signature is not base64 encoded: %v", err)
+	}
+	manifest, err := signedTaskManifest(message)
+	if err != nil {
+		return err
+	}
+	if !verifier.Verify(manifest, sig) {
+		return fmt.Errorf("task manifest signature doesn't match the signing key")
+	}
+	return nil
+}
+
+// signingKeys returns the signing keys, fetching them again if they are older
+// than the refresh interval, or if refresh is set and they are older than the
+// minimum refresh interval. It also returns whether the keys can be refreshed
+// now. The keys fetched last are kept if they can't be fetched again
+func (verifier *ManifestSignatureVerifier) signingKeys(refresh bool) ([][]byte, bool) {
+	verifier.lock.Lock()
+	defer verifier.lock.Unlock()
+	age := time.Since(verifier.fetchedAt)
+	if age >= manifestSigningKeyRefreshInterval || (refresh && age >= manifestSigningKeyMinRefreshInterval) {
+		verifier.fetchedAt = time.Now()
+		keys, err := verifier.fetchKeys()
+		if err != nil {
+			seelog.Warnf("Unable to fetch the task manifest signing key from secret %s: %v", verifier.secretID, err)
+		} else {
+			verifier.keys = keys
+		}
+		return verifier.keys, false
+	}
+	return verifier.keys, age >= manifestSigningKeyMinRefreshInterval
+}
+
+// fetchKeys fetches the current and previous versions of the signing key. There
+// is no previous version before the key is first rotated
+func (verifier *ManifestSignatureVerifier) fetchKeys() ([][]byte, error) {
+	current, err := verifier.fetchKey(manifestSigningKeyCurrentStage)
+	if err != nil {
+		return nil, err
+	}
+	keys := [][]byte{current}
+	previous, err := verifier.fetchKey(manifestSigningKeyPreviousStage)
+	if err != nil {
+		seelog.Debugf("No previous version of the task manifest signing key in secret %s: %v", verifier.secretID, err)
+		return keys, nil
+	}
+	return append(keys, previous), nil
+}
+
+// fetchKey fetches the version of the signing key in the stage
+func (verifier *ManifestSignatureVerifier) fetchKey(stage string) ([]byte, error) {
+	out, err := verifier.client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(verifier.secretID),
+		VersionStage: aws.String(stage),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.SecretBinary) > 0 {
+		return out.SecretBinary, nil
+	}
+	if out.SecretString == nil || len(*out.SecretString) == 0 {
+		return nil, fmt.Errorf("version %s of the secret is empty", stage)
+	}
+	return []byte(aws.StringValue(out.SecretString)), nil
+}
+
+// verifySignature returns true if sig is the HMAC-SHA256 of the manifest with
+// one of the keys
+func verifySignature(keys [][]byte, manifest, sig []byte) bool {
+	for _, key := range keys {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(manifest)
+		if hmac.Equal(mac.Sum(nil), sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// signedTaskManifest returns the body of the task manifest message the signature
+// is computed over: the JSON encoding of the message in the ACS protocol, without
+// the signature, with the fields in the order of the ACS model
+func signedTaskManifest(message *ecsacs.TaskManifestMessage) ([]byte, error) {
+	unsigned := *message
+	unsigned.ManifestSignature = nil
+	return jsonutil.BuildJSON(&unsigned)
+}
@@ -0,0 +1,190 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSigningKeySecretID = "ecs/manifest-signing-key"
+
+// fakeSigningKeySecret returns the versions of the signing key secret by stage
+// and counts the calls
+type fakeSigningKeySecret struct {
+	secretsmanageriface.SecretsManagerAPI
+	versions map[string]string
+	calls    int
+}
+
+func (client *fakeSigningKeySecret) GetSecretValue(
+	input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	client.calls++
+	value, ok := client.versions[aws.StringValue(input.VersionStage)]
+	if !ok {
+		return nil, errors.New("version not found")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(value)}, nil
+}
+
+func signManifest(t *testing.T, key string, message *ecsacs.TaskManifestMessage) {
+	manifest, err := signedTaskManifest(message)
+	require.NoError(t, err)
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(manifest)
+	message.ManifestSignature = aws.String(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+func newTestSignedManifest() *ecsacs.TaskManifestMessage {
+	return &ecsacs.TaskManifestMessage{
+		MessageId:            aws.String("manifest-message-id"),
+		ClusterArn:           aws.String("cluster"),
+		ContainerInstanceArn: aws.String("containerInstance"),
+		Tasks: []*ecsacs.TaskIdentifier{
+			{DesiredStatus: aws.String("RUNNING"), TaskArn: aws.String("arn1"), TaskClusterArn: aws.String("cluster")},
+		},
+		Timeline: aws.Int64(testSeqNum),
+	}
+}
+
+func TestNewManifestSignatureVerifierDisabled(t *testing.T) {
+	assert.Nil(t, newManifestSignatureVerifier(&config.Config{}, nil))
+	assert.NotNil(t, newManifestSignatureVerifier(&config.Config{
+		ACSVerifyManifestSignature:    true,
+		ACSManifestSigningKeySecretID: testSigningKeySecretID,
+		AWSRegion:                     "us-west-2",
+	}, nil))
+}
+
+func TestManifestSignatureVerifierVerifyMessage(t *testing.T) {
+	secret := &fakeSigningKeySecret{versions: map[string]string{
+		manifestSigningKeyCurrentStage:  "current-key",
+		manifestSigningKeyPreviousStage: "previous-key",
+	}}
+	verifier := newManifestSignatureVerifierWithClient(secret, testSigningKeySecretID)
+
+	signedWithCurrent := newTestSignedManifest()
+	signManifest(t, "current-key", signedWithCurrent)
+	assert.NoError(t, verifier.verifyMessage(signedWithCurrent))
+
+	signedWithPrevious := newTestSignedManifest()
+	signManifest(t, "previous-key", signedWithPrevious)
+	assert.NoError(t, verifier.verifyMessage(signedWithPrevious))
+
+	signedWithOther := newTestSignedManifest()
+	signManifest(t, "other-key", signedWithOther)
+	assert.Error(t, verifier.verifyMessage(signedWithOther))
+
+	tampered := newTestSignedManifest()
+	signManifest(t, "current-key", tampered)
+	tampered.Tasks[0].DesiredStatus = aws.String("STOPPED")
+	assert.Error(t, verifier.verifyMessage(tampered))
+
+	assert.Error(t, verifier.verifyMessage(newTestSignedManifest()), "unsigned manifests should be rejected")
+
+	notBase64 := newTestSignedManifest()
+	notBase64.ManifestSignature = aws.String("not base64!")
+	assert.Error(t, verifier.verifyMessage(notBase64))
+
+	// The keys are fetched once and cached
+	assert.Equal(t, 2, secret.calls)
+}
+
+func TestManifestSignatureVerifierPicksUpRotatedKey(t *testing.T) {
+	secret := &fakeSigningKeySecret{versions: map[string]string{
+		manifestSigningKeyCurrentStage: "old-key",
+	}}
+	verifier := newManifestSignatureVerifierWithClient(secret, testSigningKeySecretID)
+	signedWithOld := newTestSignedManifest()
+	signManifest(t, "old-key", signedWithOld)
+	require.NoError(t, verifier.verifyMessage(signedWithOld))
+
+	secret.versions = map[string]string{
+		manifestSigningKeyCurrentStage:  "new-key",
+		manifestSigningKeyPreviousStage: "old-key",
+	}
+	signedWithNew := newTestSignedManifest()
+	signManifest(t, "new-key", signedWithNew)
+	assert.Error(t, verifier.verifyMessage(signedWithNew),
+		"the keys shouldn't be fetched again before the minimum refresh interval")
+
+	// Age the keys past the minimum refresh interval
+	verifier.fetchedAt = time.Now().Add(-manifestSigningKeyMinRefreshInterval)
+	assert.NoError(t, verifier.verifyMessage(signedWithNew))
+	assert.NoError(t, verifier.verifyMessage(signedWithOld))
+}
+
+func TestManifestSignatureVerifierKeepsKeysWhenFetchFails(t *testing.T) {
+	secret := &fakeSigningKeySecret{versions: map[string]string{
+		manifestSigningKeyCurrentStage: "current-key",
+	}}
+	verifier := newManifestSignatureVerifierWithClient(secret, testSigningKeySecretID)
+	message := newTestSignedManifest()
+	signManifest(t, "current-key", message)
+	require.NoError(t, verifier.verifyMessage(message))
+
+	secret.versions = nil
+	verifier.fetchedAt = time.Now().Add(-manifestSigningKeyRefreshInterval)
+	assert.NoError(t, verifier.verifyMessage(message))
+}
+
+func TestManifestSignatureVerifierRejectsAllWithoutKey(t *testing.T) {
+	verifier := newManifestSignatureVerifierWithClient(&fakeSigningKeySecret{}, "")
+	message := newTestSignedManifest()
+	signManifest(t, "", message)
+	assert.Error(t, verifier.verifyMessage(message))
+}
+
+func TestTaskManifestHandlerRejectsUnsignedManifest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	secret := &fakeSigningKeySecret{versions: map[string]string{
+		manifestSigningKeyCurrentStage: "current-key",
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handler := newTaskManifestHandler(ctx, "cluster", "containerInstance", nil, data.NewNoopClient(), taskEngine,
+		aws.Int64(testSeqNum-1), testManifestHistoryDepth, nil,
+		newManifestSignatureVerifierWithClient(secret, testSigningKeySecretID), nil, nil)
+
+	// The manifest isn't applied, the tasks of the instance aren't even listed
+	assert.Error(t, handler.handleTaskManifestSingleMessage(newTestSignedManifest()))
+	assert.Equal(t, int64(testSeqNum-1), *handler.latestSeqNumberTaskManifest)
+
+	message := newTestSignedManifest()
+	signManifest(t, "current-key", message)
+	taskEngine.EXPECT().ListTasks().Return(nil, nil)
+	assert.NoError(t, handler.handleTaskManifestSingleMessage(message))
+	assert.Equal(t, int64(testSeqNum), *handler.latestSeqNumberTaskManifest)
+}
@@ -0,0 +1,174 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cihub/seelog"
+)
+
+const (
+	// memoryPressureCheckInterval is the interval at which the available
+	// memory of the host is checked
+	memoryPressureCheckInterval = 10 * time.Second
+	bytesPerKB                  = 1024
+)
+
+// memoryPressureMonitor periodically checks the memory available on the host,
+// as reported by /proc/meminfo. While it is below the threshold, the host is
+// under memory pressure and the tasks to be started are queued instead of
+// being added to the task engine, so that the kernel doesn't kill running
+// containers to make room for them. The queued tasks are added, in the order
+// they were received, as soon as enough memory is available again.
+type memoryPressureMonitor struct {
+	thresholdBytes uint64
+	interval       time.Duration
+	// availableMemory returns the memory available on the host in bytes
+	availableMemory func() (uint64, error)
+	// underPressure is set to 1 while the host is under memory pressure, it
+	// is accessed atomically
+	underPressure int32
+	lock          sync.Mutex
+	// pending are the functions adding the queued tasks to the task engine
+	pending []func()
+}
+
+// newMemoryPressureMonitor returns a new memoryPressureMonitor, or nil if the
+// monitor is disabled or the platform doesn't support monitoring the memory
+func newMemoryPressureMonitor(enabled bool, thresholdMB int) *memoryPressureMonitor {
+	if !enabled || thresholdMB <= 0 || !memoryPressureSupported {
+		return nil
+	}
+	return &memoryPressureMonitor{
+		thresholdBytes:  uint64(thresholdMB) * bytesPerMB,
+		interval:        memoryPressureCheckInterval,
+		availableMemory: readAvailableMemory,
+	}
+}
+
+// run checks the available memory every interval until the context is
+// cancelled
+func (monitor *memoryPressureMonitor) run(ctx context.Context) {
+	if monitor == nil {
+		return
+	}
+	ticker := time.NewTicker(monitor.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			monitor.check()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check reads the available memory and updates the memory pressure of the
+// host. A failed read leaves it unchanged
+func (monitor *memoryPressureMonitor) check() {
+	available, err := monitor.availableMemory()
+	if err != nil {
+		seelog.Warnf("Unable to read the available memory of the host: %v", err)
+		return
+	}
+
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	if available < monitor.thresholdBytes {
+		if atomic.CompareAndSwapInt32(&monitor.underPressure, 0, 1) {
+			seelog.Warnf("Host is under memory pressure (%d MB available, threshold %d MB), tasks received from ACS will be queued until memory is available",
+				available/bytesPerMB, monitor.thresholdBytes/bytesPerMB)
+		}
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&monitor.underPressure, 1, 0) {
+		return
+	}
+	seelog.Infof("Host memory pressure cleared (%d MB available), adding %d queued tasks to the task engine",
+		available/bytesPerMB, len(monitor.pending))
+	// The queued tasks are added while holding the lock, so that the tasks
+	// received in the meantime are added after them
+	for _, add := range monitor.pending {
+		add()
+	}
+	monitor.pending = nil
+}
+
+// isUnderPressure returns true if the host is currently under memory pressure
+func (monitor *memoryPressureMonitor) isUnderPressure() bool {
+	if monitor == nil {
+		return false
+	}
+	return atomic.LoadInt32(&monitor.underPressure) == 1
+}
+
+// submit invokes add right away unless the host is under memory pressure, in
+// which case add is queued until the pressure clears
+func (monitor *memoryPressureMonitor) submit(taskARN string, add func()) {
+	if monitor == nil {
+		add()
+		return
+	}
+	monitor.lock.Lock()
+	if !monitor.isUnderPressure() {
+		monitor.lock.Unlock()
+		add()
+		return
+	}
+	monitor.pending = append(monitor.pending, add)
+	queued := len(monitor.pending)
+	monitor.lock.Unlock()
+	seelog.Warnf("Host is under memory pressure, queuing task %s (%d queued)", taskARN, queued)
+}
+
+// pendingCount returns the number of tasks waiting for the memory pressure to
+// clear
+func (monitor *memoryPressureMonitor) pendingCount() int {
+	monitor.lock.Lock()
+	defer monitor.lock.Unlock()
+	return len(monitor.pending)
+}
+
+// parseMemAvailable returns the MemAvailable field of /proc/meminfo in bytes
+func parseMemAvailable(memInfo io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(memInfo)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemAvailable:" {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MemAvailable value %q: %w", fields[1], err)
+		}
+		if len(fields) > 2 && fields[2] == "kB" {
+			value *= bytesPerKB
+		}
+		return value, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("MemAvailable not found")
+}
@@ -0,0 +1,36 @@
+//go:build linux
+// +build linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import "os"
+
+const (
+	// memoryPressureSupported is true on the platforms where the available
+	// memory of the host can be monitored
+	memoryPressureSupported = true
+	memInfoPath             = "/proc/meminfo"
+)
+
+// readAvailableMemory returns the memory available on the host in bytes
+func readAvailableMemory() (uint64, error) {
+	memInfo, err := os.Open(memInfoPath)
+	if err != nil {
+		return 0, err
+	}
+	defer memInfo.Close()
+	return parseMemAvailable(memInfo)
+}
@@ -0,0 +1,45 @@
+//go:build linux && unit
+// +build linux,unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAvailableMemory(t *testing.T) {
+	available, err := readAvailableMemory()
+	require.NoError(t, err)
+	assert.NotZero(t, available)
+	assert.NotNil(t, newMemoryPressureMonitor(true, 256))
+}
+
+func TestNewSessionMemoryPressureMonitorDisabled(t *testing.T) {
+	cfg := *testConfig
+	cfg.ACSMemoryPressureThreshold = config.DefaultACSMemoryPressureThreshold
+	cfg.ACSMemoryPressureMonitorEnabled = config.BooleanDefaultTrue{Value: config.NotSet}
+	acsSession := NewSession(context.Background(), SessionParams{Config: &cfg, ContainerInstanceARN: "myArn"}).(*session)
+	assert.NotNil(t, acsSession.dockerHealth.memoryPressure)
+
+	cfg.ACSMemoryPressureMonitorEnabled = config.BooleanDefaultTrue{Value: config.ExplicitlyDisabled}
+	acsSession = NewSession(context.Background(), SessionParams{Config: &cfg, ContainerInstanceARN: "myArn"}).(*session)
+	assert.Nil(t, acsSession.dockerHealth.memoryPressure)
+}
@@ -0,0 +1,157 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMemInfo = `MemTotal:       16303412 kB
+MemFree:          415208 kB
+MemAvailable:    8265444 kB
+Buffers:          602056 kB
+`
+
+// newTestMemoryPressureMonitor returns a monitor with a 256MB threshold whose
+// available memory is set by the tests
+func newTestMemoryPressureMonitor() (*memoryPressureMonitor, *uint64, *error) {
+	var available uint64
+	var readErr error
+	monitor := &memoryPressureMonitor{
+		thresholdBytes: 256 * bytesPerMB,
+		interval:       memoryPressureCheckInterval,
+		availableMemory: func() (uint64, error) {
+			return available, readErr
+		},
+	}
+	return monitor, &available, &readErr
+}
+
+func TestParseMemAvailable(t *testing.T) {
+	available, err := parseMemAvailable(strings.NewReader(testMemInfo))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(8265444*1024), available)
+
+	_, err = parseMemAvailable(strings.NewReader("MemTotal:       16303412 kB\n"))
+	assert.Error(t, err, "MemAvailable is missing")
+	_, err = parseMemAvailable(strings.NewReader("MemAvailable:    lots kB\n"))
+	assert.Error(t, err, "MemAvailable is invalid")
+}
+
+func TestMemoryPressureMonitorQueuesTasksUnderPressure(t *testing.T) {
+	monitor, available, _ := newTestMemoryPressureMonitor()
+	var added []string
+	addFunc := func(name string) func() {
+		return func() { added = append(added, name) }
+	}
+
+	*available = 512 * bytesPerMB
+	monitor.check()
+	monitor.submit("before", addFunc("before"))
+	assert.Equal(t, []string{"before"}, added)
+
+	*available = 128 * bytesPerMB
+	monitor.check()
+	require.True(t, monitor.isUnderPressure())
+	monitor.submit("first", addFunc("first"))
+	monitor.submit("second", addFunc("second"))
+	assert.Equal(t, []string{"before"}, added)
+	assert.Equal(t, 2, monitor.pendingCount())
+
+	*available = 256 * bytesPerMB
+	monitor.check()
+	assert.False(t, monitor.isUnderPressure())
+	assert.Equal(t, []string{"before", "first", "second"}, added)
+	assert.Equal(t, 0, monitor.pendingCount())
+}
+
+func TestMemoryPressureMonitorIgnoresFailedReads(t *testing.T) {
+	monitor, available, readErr := newTestMemoryPressureMonitor()
+	*available = 128 * bytesPerMB
+	monitor.check()
+	require.True(t, monitor.isUnderPressure())
+
+	*readErr = errors.New("no meminfo")
+	monitor.check()
+	assert.True(t, monitor.isUnderPressure())
+}
+
+func TestNilMemoryPressureMonitor(t *testing.T) {
+	monitor := newMemoryPressureMonitor(false, 256)
+	assert.Nil(t, monitor)
+	added := false
+	monitor.submit("arn", func() { added = true })
+	assert.True(t, added)
+	assert.False(t, monitor.isUnderPressure())
+}
+
+func TestHandlePayloadMessageQueuesTasksToStartUnderMemoryPressure(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+
+	monitor, available, _ := newTestMemoryPressureMonitor()
+	tester.payloadHandler.dockerHealth = newDockerHealthProbe(nil, time.Second, 1, monitor)
+	*available = 128 * bytesPerMB
+	monitor.check()
+	require.True(t, monitor.isUnderPressure())
+
+	// The task to be stopped is added right away, the task to be started once
+	// the pressure clears
+	var addedTasks []*apitask.Task
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		addedTasks = append(addedTasks, task)
+	}).Times(2)
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("start"),
+				DesiredStatus: aws.String("RUNNING"),
+			},
+			{
+				Arn:           aws.String("stop"),
+				DesiredStatus: aws.String("STOPPED"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+	err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+	assert.NoError(t, err, "Error handling payload message")
+	select {
+	case mid := <-tester.payloadHandler.ackRequest:
+		assert.Equal(t, payloadMessageId, mid)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for payload message to be acked")
+	}
+	require.Len(t, addedTasks, 1)
+	assert.Equal(t, "stop", addedTasks[0].Arn)
+
+	*available = 512 * bytesPerMB
+	monitor.check()
+	require.Len(t, addedTasks, 2)
+	assert.Equal(t, "start", addedTasks[1].Arn)
+}
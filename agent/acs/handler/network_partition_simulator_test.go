@@ -0,0 +1,248 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// NetworkPartitionSimulator is a wsclient.ClientServer that wraps a client and
+// simulates a degraded network between the agent and the backend. Requests sent
+// and messages received are delayed and randomly dropped according to the
+// configured delays and drop rates. A drop rate of 0 never drops anything and a
+// drop rate of 1 drops everything
+type NetworkPartitionSimulator struct {
+	wsclient.ClientServer
+	// SendDelay is the delay added to every request sent to the backend
+	SendDelay time.Duration
+	// ReceiveDelay is the delay added to every message received from the backend
+	ReceiveDelay time.Duration
+	// SendDropRate is the fraction of requests sent to the backend that are lost
+	SendDropRate float64
+	// ReceiveDropRate is the fraction of messages received from the backend that are lost
+	ReceiveDropRate float64
+
+	lock sync.Mutex
+	rand *rand.Rand
+	// received maps the messages seen by the any request handler to whether
+	// they were dropped, so that the typed request handlers drop them as well
+	received map[interface{}]bool
+}
+
+// NewNetworkPartitionSimulator returns a NetworkPartitionSimulator wrapping the
+// client, which doesn't delay or drop anything until configured to
+func NewNetworkPartitionSimulator(client wsclient.ClientServer) *NetworkPartitionSimulator {
+	return &NetworkPartitionSimulator{
+		ClientServer: client,
+		rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
+		received:     make(map[interface{}]bool),
+	}
+}
+
+// MakeRequest delays the request and either drops it or sends it through the
+// wrapped client. Dropped requests are not reported as errors, as the request
+// is lost on the network after being written successfully
+func (simulator *NetworkPartitionSimulator) MakeRequest(input interface{}) error {
+	if !simulator.send() {
+		return nil
+	}
+	return simulator.ClientServer.MakeRequest(input)
+}
+
+// WriteMessage delays the message and either drops it or writes it through
+// the wrapped client
+func (simulator *NetworkPartitionSimulator) WriteMessage(input []byte) error {
+	if !simulator.send() {
+		return nil
+	}
+	return simulator.ClientServer.WriteMessage(input)
+}
+
+// AddRequestHandler adds the handler to the wrapped client so that it's only
+// invoked for the messages that are not dropped
+func (simulator *NetworkPartitionSimulator) AddRequestHandler(handler wsclient.RequestHandler) {
+	simulator.ClientServer.AddRequestHandler(simulator.wrap(handler, false))
+}
+
+// SetAnyRequestHandler sets the handler on the wrapped client so that it's only
+// invoked, after the receive delay, for the messages that are not dropped
+func (simulator *NetworkPartitionSimulator) SetAnyRequestHandler(handler wsclient.RequestHandler) {
+	simulator.ClientServer.SetAnyRequestHandler(simulator.wrap(handler, true))
+}
+
+// send waits for the send delay and returns false if the request must be dropped
+func (simulator *NetworkPartitionSimulator) send() bool {
+	time.Sleep(simulator.SendDelay)
+	return !simulator.drop(simulator.SendDropRate)
+}
+
+// receive returns false if the message must be dropped. The decision is made
+// once per message: the any request handler, which is invoked first, records
+// it for the typed request handler
+func (simulator *NetworkPartitionSimulator) receive(message interface{}, anyHandler bool) bool {
+	if anyHandler {
+		time.Sleep(simulator.ReceiveDelay)
+		dropped := simulator.drop(simulator.ReceiveDropRate)
+		simulator.lock.Lock()
+		simulator.received[message] = dropped
+		simulator.lock.Unlock()
+		return !dropped
+	}
+	simulator.lock.Lock()
+	dropped, ok := simulator.received[message]
+	delete(simulator.received, message)
+	simulator.lock.Unlock()
+	if !ok {
+		time.Sleep(simulator.ReceiveDelay)
+		dropped = simulator.drop(simulator.ReceiveDropRate)
+	}
+	return !dropped
+}
+
+func (simulator *NetworkPartitionSimulator) drop(rate float64) bool {
+	simulator.lock.Lock()
+	defer simulator.lock.Unlock()
+	return simulator.rand.Float64() < rate
+}
+
+// wrap returns a function of the same type as the handler, which the wrapped
+// client inspects to dispatch messages, invoking the handler for the messages
+// that are received
+func (simulator *NetworkPartitionSimulator) wrap(handler wsclient.RequestHandler, anyHandler bool) wsclient.RequestHandler {
+	handlerValue := reflect.ValueOf(handler)
+	return reflect.MakeFunc(handlerValue.Type(), func(args []reflect.Value) []reflect.Value {
+		if simulator.receive(args[0].Interface(), anyHandler) {
+			return handlerValue.Call(args)
+		}
+		return nil
+	}).Interface()
+}
+
+func TestNetworkPartitionSimulatorSendDrop(t *testing.T) {
+	testCases := []struct {
+		name          string
+		dropRate      float64
+		expectedSends int
+	}{
+		{
+			name:          "nothing dropped",
+			dropRate:      0,
+			expectedSends: 10,
+		},
+		{
+			name:          "everything dropped",
+			dropRate:      1,
+			expectedSends: 0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+			mockWsClient.EXPECT().MakeRequest(gomock.Any()).Return(nil).Times(tc.expectedSends)
+			mockWsClient.EXPECT().WriteMessage(gomock.Any()).Return(nil).Times(tc.expectedSends)
+
+			simulator := NewNetworkPartitionSimulator(mockWsClient)
+			simulator.SendDropRate = tc.dropRate
+			for i := 0; i < 10; i++ {
+				assert.NoError(t, simulator.MakeRequest(&ecsacs.AckRequest{}))
+				assert.NoError(t, simulator.WriteMessage([]byte("message")))
+			}
+		})
+	}
+}
+
+func TestNetworkPartitionSimulatorSendDelay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	mockWsClient.EXPECT().MakeRequest(gomock.Any()).Return(nil)
+
+	simulator := NewNetworkPartitionSimulator(mockWsClient)
+	simulator.SendDelay = 50 * time.Millisecond
+	start := time.Now()
+	assert.NoError(t, simulator.MakeRequest(&ecsacs.AckRequest{}))
+	assert.True(t, time.Since(start) >= simulator.SendDelay, "Request sent before the send delay")
+}
+
+func TestNetworkPartitionSimulatorReceive(t *testing.T) {
+	testCases := []struct {
+		name             string
+		dropRate         float64
+		expectedReceives int
+	}{
+		{
+			name:             "nothing dropped",
+			dropRate:         0,
+			expectedReceives: 10,
+		},
+		{
+			name:             "everything dropped",
+			dropRate:         1,
+			expectedReceives: 0,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+			var anyHandler, heartbeatHandler wsclient.RequestHandler
+			mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).Do(func(handler wsclient.RequestHandler) {
+				anyHandler = handler
+			})
+			mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).Do(func(handler wsclient.RequestHandler) {
+				heartbeatHandler = handler
+			})
+
+			anyReceived, heartbeatsReceived := 0, 0
+			simulator := NewNetworkPartitionSimulator(mockWsClient)
+			simulator.ReceiveDropRate = tc.dropRate
+			simulator.ReceiveDelay = time.Millisecond
+			simulator.SetAnyRequestHandler(func(interface{}) {
+				anyReceived++
+			})
+			simulator.AddRequestHandler(func(*ecsacs.HeartbeatMessage) {
+				heartbeatsReceived++
+			})
+
+			// The wrapped handlers must keep the type of the original ones, which the
+			// client relies on to dispatch messages
+			assert.IsType(t, func(*ecsacs.HeartbeatMessage) {}, heartbeatHandler)
+			for i := 0; i < 10; i++ {
+				message := &ecsacs.HeartbeatMessage{MessageId: aws.String("id")}
+				anyHandler.(func(interface{}))(message)
+				heartbeatHandler.(func(*ecsacs.HeartbeatMessage))(message)
+			}
+			assert.Equal(t, tc.expectedReceives, anyReceived)
+			assert.Equal(t, tc.expectedReceives, heartbeatsReceived)
+			assert.Empty(t, simulator.received)
+		})
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/cihub/seelog"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// OperatorAlertSeverityInfo is the severity of the alerts that are purely
+	// informational
+	OperatorAlertSeverityInfo = "INFO"
+	// OperatorAlertSeverityWarning is the severity of the alerts requiring the
+	// operators to act eventually, e.g. before the AMI reaches its end of life
+	OperatorAlertSeverityWarning = "WARNING"
+	// OperatorAlertSeverityCritical is the severity of the alerts requiring the
+	// operators to act right away
+	OperatorAlertSeverityCritical = "CRITICAL"
+	// operatorAlertsPerHour is the number of alerts of each severity delivered
+	// per hour, the alerts exceeding it are dropped
+	operatorAlertsPerHour = 10
+	// operatorAlertDroppedEvent is the ACS event recorded when an alert is
+	// dropped because of the rate limit
+	operatorAlertDroppedEvent = "OperatorAlertDropped"
+	// snsRoundtripTimeout is the timeout of the requests to SNS
+	snsRoundtripTimeout = 5 * time.Second
+	// snsMaxSubjectLength is the maximum length of the subject of SNS messages
+	snsMaxSubjectLength = 100
+)
+
+// OperatorAlert is an advisory message pushed by ACS for the operators of the
+// instance, e.g. to let them know the AMI of the instance reaches its end of
+// life in 30 days
+type OperatorAlert struct {
+	Severity string
+	Title    string
+	Body     string
+}
+
+// AlertSink delivers the operator alerts to the notification channel of the
+// operators of the instance
+type AlertSink interface {
+	// Send delivers the alert
+	Send(alert OperatorAlert) error
+}
+
+// SeelogAlertSink delivers the operator alerts to the agent log, at the log
+// level matching their severity
+type SeelogAlertSink struct{}
+
+// Send logs the alert
+func (SeelogAlertSink) Send(alert OperatorAlert) error {
+	switch alert.Severity {
+	case OperatorAlertSeverityCritical:
+		seelog.Errorf("Operator alert from ACS [%s] %s: %s", alert.Severity, alert.Title, alert.Body)
+	case OperatorAlertSeverityWarning:
+		seelog.Warnf("Operator alert from ACS [%s] %s: %s", alert.Severity, alert.Title, alert.Body)
+	default:
+		seelog.Infof("Operator alert from ACS [%s] %s: %s", alert.Severity, alert.Title, alert.Body)
+	}
+	return nil
+}
+
+// snsSDK is the subset of the SNS API used to publish the operator alerts
+type snsSDK interface {
+	Publish(*sns.PublishInput) (*sns.PublishOutput, error)
+}
+
+// SNSAlertSink publishes the operator alerts to an SNS topic, with the severity
+// and title of the alerts as subject and their body as message
+type SNSAlertSink struct {
+	client   snsSDK
+	topicARN string
+}
+
+// NewSNSAlertSink returns a new SNSAlertSink publishing the alerts to the topic
+func NewSNSAlertSink(cfg *config.Config, credentialsProvider *credentials.Credentials, topicARN string) *SNSAlertSink {
+	var snsConfig aws.Config
+	snsConfig.Credentials = credentialsProvider
+	snsConfig.Region = aws.String(cfg.AWSRegion)
+	snsConfig.HTTPClient = httpclient.New(snsRoundtripTimeout, cfg.AcceptInsecureCert)
+	return newSNSAlertSinkWithClient(sns.New(awssession.New(&snsConfig)), topicARN)
+}
+
+// newSNSAlertSinkWithClient returns a new SNSAlertSink using the SNS client
+func newSNSAlertSinkWithClient(client snsSDK, topicARN string) *SNSAlertSink {
+	return &SNSAlertSink{
+		client:   client,
+		topicARN: topicARN,
+	}
+}
+
+// Send publishes the alert to the topic
+func (sink *SNSAlertSink) Send(alert OperatorAlert) error {
+	subject := fmt.Sprintf("[%s] %s", alert.Severity, alert.Title)
+	if len(subject) > snsMaxSubjectLength {
+		subject = subject[:snsMaxSubjectLength]
+	}
+	message := alert.Body
+	if message == "" {
+		// SNS doesn't publish empty messages
+		message = alert.Title
+	}
+	_, err := sink.client.Publish(&sns.PublishInput{
+		TopicArn: aws.String(sink.topicARN),
+		Subject:  aws.String(subject),
+		Message:  aws.String(message),
+	})
+	return err
+}
+
+// newOperatorAlertSink returns the sink of the operator alerts, publishing them
+// to the configured SNS topic if any and logging them otherwise
+func newOperatorAlertSink(cfg *config.Config, credentialsProvider *credentials.Credentials) AlertSink {
+	if cfg.ACSOperatorAlertsSNSTopicARN == "" {
+		return SeelogAlertSink{}
+	}
+	return NewSNSAlertSink(cfg, credentialsProvider, cfg.ACSOperatorAlertsSNSTopicARN)
+}
+
+// operatorAlertLimiter limits the operator alerts delivered to
+// operatorAlertsPerHour per severity, so that a misbehaving ACS can't flood the
+// notification channel of the operators. It is shared across connections to
+// ACS so that reconnecting doesn't reset the limit
+type operatorAlertLimiter struct {
+	limiters map[string]*rate.Limiter
+}
+
+// newOperatorAlertLimiter returns a new operatorAlertLimiter
+func newOperatorAlertLimiter() *operatorAlertLimiter {
+	limiters := make(map[string]*rate.Limiter)
+	for _, severity := range []string{
+		OperatorAlertSeverityInfo,
+		OperatorAlertSeverityWarning,
+		OperatorAlertSeverityCritical,
+	} {
+		limiters[severity] = rate.NewLimiter(rate.Every(time.Hour/operatorAlertsPerHour), operatorAlertsPerHour)
+	}
+	return &operatorAlertLimiter{limiters: limiters}
+}
+
+// isKnownSeverity returns true if the severity is one of the alert severities
+func (limiter *operatorAlertLimiter) isKnownSeverity(severity string) bool {
+	_, ok := limiter.limiters[severity]
+	return ok
+}
+
+// allow returns true if an alert of the severity can be delivered now
+func (limiter *operatorAlertLimiter) allow(severity string) bool {
+	severityLimiter, ok := limiter.limiters[severity]
+	return ok && severityLimiter.Allow()
+}
+
+// operatorAlertHandler handles the operator alerts pushed by ACS, routing them
+// to the AlertSink. Alerts exceeding the rate limit are dropped, alerts the sink
+// fails to deliver are logged instead, and the messages are acked either way so
+// that ACS doesn't resend them
+type operatorAlertHandler struct {
+	messageBuffer        chan *ecsacs.ACSOperatorAlertMessage
+	ctx                  context.Context
+	cancel               context.CancelFunc
+	cluster              string
+	containerInstanceArn string
+	acsClient            wsclient.ClientServer
+	sink                 AlertSink
+	limiter              *operatorAlertLimiter
+	*inFlightAckTracker
+	routines *handlerRoutines
+}
+
+// newOperatorAlertHandler returns an instance of the operatorAlertHandler struct
+func newOperatorAlertHandler(ctx context.Context,
+	cluster string, containerInstanceArn string, acsClient wsclient.ClientServer,
+	sink AlertSink, limiter *operatorAlertLimiter) operatorAlertHandler {
+
+	// Create a cancelable context from the parent context
+	derivedContext, cancel := context.WithCancel(ctx)
+	return operatorAlertHandler{
+		messageBuffer:        make(chan *ecsacs.ACSOperatorAlertMessage),
+		ctx:                  derivedContext,
+		cancel:               cancel,
+		cluster:              cluster,
+		containerInstanceArn: containerInstanceArn,
+		acsClient:            acsClient,
+		sink:                 sink,
+		limiter:              limiter,
+		inFlightAckTracker:   newInFlightAckTracker(),
+		routines:             &handlerRoutines{},
+	}
+}
+
+// handlerFunc returns the request handler function for the ACSOperatorAlertMessage
+func (handler *operatorAlertHandler) handlerFunc() func(message *ecsacs.ACSOperatorAlertMessage) {
+	return func(message *ecsacs.ACSOperatorAlertMessage) {
+		handler.trackReceived("ACSOperatorAlertMessage", aws.StringValue(message.MessageId))
+		select {
+		case handler.messageBuffer <- message:
+		case <-handler.ctx.Done():
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// start invokes go routines to handle operator alert messages
+func (handler *operatorAlertHandler) start() {
+	handler.routines.run(handler.handleMessages)
+}
+
+// stop is used to invoke a cancellation function
+func (handler *operatorAlertHandler) stop() {
+	handler.cancel()
+}
+
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (handler *operatorAlertHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, handler.stop, handler.routines, nil)
+}
+
+// handleMessages processes the operator alert messages in-order
+func (handler *operatorAlertHandler) handleMessages() {
+	for {
+		select {
+		case <-handler.ctx.Done():
+			return
+		case message := <-handler.messageBuffer:
+			if err := handler.handleSingleMessage(message); err != nil {
+				seelog.Warnf("Unable to handle operator alert message [%s]: %v", message.String(), err)
+			}
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// handleSingleMessage delivers the alert of the message to the sink, unless
+// the rate limit of its severity is exceeded, and acks the message
+func (handler *operatorAlertHandler) handleSingleMessage(message *ecsacs.ACSOperatorAlertMessage) error {
+	if message.MessageId == nil {
+		return fmt.Errorf("operator alert handler: message id not set in message")
+	}
+	alert := OperatorAlert{
+		Severity: strings.ToUpper(aws.StringValue(message.Severity)),
+		Title:    aws.StringValue(message.Title),
+		Body:     aws.StringValue(message.Body),
+	}
+	if !handler.limiter.isKnownSeverity(alert.Severity) {
+		return fmt.Errorf("operator alert handler: unknown severity %q in message", alert.Severity)
+	}
+	if alert.Title == "" {
+		return fmt.Errorf("operator alert handler: title not set in message")
+	}
+
+	if handler.limiter.allow(alert.Severity) {
+		if err := handler.sink.Send(alert); err != nil {
+			seelog.Warnf("Unable to deliver the operator alert, message id: %s: %v",
+				aws.StringValue(message.MessageId), err)
+			SeelogAlertSink{}.Send(alert)
+		}
+	} else {
+		seelog.Warnf("Dropping the %s operator alert %q, more than %d alerts of this severity in the last hour, message id: %s",
+			alert.Severity, alert.Title, operatorAlertsPerHour, aws.StringValue(message.MessageId))
+		metrics.MetricsEngineGlobal.RecordACSEvent(operatorAlertDroppedEvent, 1)
+	}
+	return handler.acsClient.MakeRequest(&ecsacs.AckRequest{
+		Cluster:           aws.String(handler.cluster),
+		ContainerInstance: aws.String(handler.containerInstanceArn),
+		MessageId:         message.MessageId,
+	})
+}
@@ -0,0 +1,232 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	alertTestCluster              = "mock-cluster"
+	alertTestContainerInstanceArn = "mock-container-instance"
+	alertTestMessageId            = "mock-message-id"
+	alertTestTopicARN             = "arn:aws:sns:us-west-2:123456789012:ecs-alerts"
+)
+
+// fakeAlertSink records the alerts sent to it
+type fakeAlertSink struct {
+	alerts []OperatorAlert
+	err    error
+}
+
+func (sink *fakeAlertSink) Send(alert OperatorAlert) error {
+	sink.alerts = append(sink.alerts, alert)
+	return sink.err
+}
+
+// fakeSNSClient records the messages published to it
+type fakeSNSClient struct {
+	inputs []*sns.PublishInput
+	err    error
+}
+
+func (client *fakeSNSClient) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	client.inputs = append(client.inputs, input)
+	if client.err != nil {
+		return nil, client.err
+	}
+	return &sns.PublishOutput{MessageId: aws.String("sns-message-id")}, nil
+}
+
+func newTestOperatorAlertHandler(ctrl *gomock.Controller, sink AlertSink) (operatorAlertHandler,
+	*mock_wsclient.MockClientServer) {
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	handler := newOperatorAlertHandler(context.TODO(), alertTestCluster, alertTestContainerInstanceArn,
+		mockWSClient, sink, newOperatorAlertLimiter())
+	return handler, mockWSClient
+}
+
+func operatorAlertMessage(severity, title, body string) *ecsacs.ACSOperatorAlertMessage {
+	return &ecsacs.ACSOperatorAlertMessage{
+		Cluster:           aws.String(alertTestCluster),
+		ContainerInstance: aws.String(alertTestContainerInstanceArn),
+		MessageId:         aws.String(alertTestMessageId),
+		Severity:          aws.String(severity),
+		Title:             aws.String(title),
+		Body:              aws.String(body),
+	}
+}
+
+func alertTestAckRequest() *ecsacs.AckRequest {
+	return &ecsacs.AckRequest{
+		Cluster:           aws.String(alertTestCluster),
+		ContainerInstance: aws.String(alertTestContainerInstanceArn),
+		MessageId:         aws.String(alertTestMessageId),
+	}
+}
+
+func TestOperatorAlertIsSentToSink(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sink := &fakeAlertSink{}
+	handler, mockWSClient := newTestOperatorAlertHandler(ctrl, sink)
+	mockWSClient.EXPECT().MakeRequest(alertTestAckRequest()).Return(nil)
+
+	require.NoError(t, handler.handleSingleMessage(operatorAlertMessage("warning", "AMI end of life",
+		"Your AMI version is EOL in 30 days")))
+
+	assert.Equal(t, []OperatorAlert{{
+		Severity: OperatorAlertSeverityWarning,
+		Title:    "AMI end of life",
+		Body:     "Your AMI version is EOL in 30 days",
+	}}, sink.alerts)
+}
+
+func TestOperatorAlertIsAckedWhenSinkFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sink := &fakeAlertSink{err: errors.New("sink failed")}
+	handler, mockWSClient := newTestOperatorAlertHandler(ctrl, sink)
+	mockWSClient.EXPECT().MakeRequest(alertTestAckRequest()).Return(nil)
+
+	require.NoError(t, handler.handleSingleMessage(operatorAlertMessage(OperatorAlertSeverityCritical, "title", "body")))
+	assert.Len(t, sink.alerts, 1)
+}
+
+func TestInvalidOperatorAlertIsNotAcked(t *testing.T) {
+	testCases := []struct {
+		name    string
+		message *ecsacs.ACSOperatorAlertMessage
+	}{
+		{"no message id", &ecsacs.ACSOperatorAlertMessage{Severity: aws.String("INFO"), Title: aws.String("title")}},
+		{"unknown severity", operatorAlertMessage("DEBUG", "title", "body")},
+		{"no title", operatorAlertMessage("INFO", "", "body")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			sink := &fakeAlertSink{}
+			handler, _ := newTestOperatorAlertHandler(ctrl, sink)
+
+			assert.Error(t, handler.handleSingleMessage(tc.message))
+			assert.Empty(t, sink.alerts)
+		})
+	}
+}
+
+func TestOperatorAlertsAreRateLimitedPerSeverity(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	sink := &fakeAlertSink{}
+	handler, mockWSClient := newTestOperatorAlertHandler(ctrl, sink)
+	// Dropped alerts are acked too
+	mockWSClient.EXPECT().MakeRequest(alertTestAckRequest()).Return(nil).Times(operatorAlertsPerHour + 2)
+
+	for i := 0; i < operatorAlertsPerHour+1; i++ {
+		require.NoError(t, handler.handleSingleMessage(operatorAlertMessage(OperatorAlertSeverityInfo, "title", "body")))
+	}
+	assert.Len(t, sink.alerts, operatorAlertsPerHour)
+
+	// The other severities have their own limit
+	require.NoError(t, handler.handleSingleMessage(operatorAlertMessage(OperatorAlertSeverityCritical, "title", "body")))
+	assert.Len(t, sink.alerts, operatorAlertsPerHour+1)
+}
+
+func TestOperatorAlertLimiter(t *testing.T) {
+	limiter := newOperatorAlertLimiter()
+	for _, severity := range []string{OperatorAlertSeverityInfo, OperatorAlertSeverityWarning,
+		OperatorAlertSeverityCritical} {
+		assert.True(t, limiter.isKnownSeverity(severity))
+		for i := 0; i < operatorAlertsPerHour; i++ {
+			assert.True(t, limiter.allow(severity))
+		}
+		assert.False(t, limiter.allow(severity))
+	}
+	assert.False(t, limiter.isKnownSeverity("DEBUG"))
+	assert.False(t, limiter.allow("DEBUG"))
+}
+
+func TestSeelogAlertSink(t *testing.T) {
+	for _, severity := range []string{OperatorAlertSeverityInfo, OperatorAlertSeverityWarning,
+		OperatorAlertSeverityCritical} {
+		assert.NoError(t, SeelogAlertSink{}.Send(OperatorAlert{Severity: severity, Title: "title", Body: "body"}))
+	}
+}
+
+func TestSNSAlertSink(t *testing.T) {
+	client := &fakeSNSClient{}
+	sink := newSNSAlertSinkWithClient(client, alertTestTopicARN)
+
+	require.NoError(t, sink.Send(OperatorAlert{
+		Severity: OperatorAlertSeverityWarning,
+		Title:    "AMI end of life",
+		Body:     "Your AMI version is EOL in 30 days",
+	}))
+
+	require.Len(t, client.inputs, 1)
+	assert.Equal(t, alertTestTopicARN, aws.StringValue(client.inputs[0].TopicArn))
+	assert.Equal(t, "[WARNING] AMI end of life", aws.StringValue(client.inputs[0].Subject))
+	assert.Equal(t, "Your AMI version is EOL in 30 days", aws.StringValue(client.inputs[0].Message))
+}
+
+func TestSNSAlertSinkLimitsSubjectAndFillsMessage(t *testing.T) {
+	client := &fakeSNSClient{}
+	sink := newSNSAlertSinkWithClient(client, alertTestTopicARN)
+
+	require.NoError(t, sink.Send(OperatorAlert{
+		Severity: OperatorAlertSeverityInfo,
+		Title:    strings.Repeat("t", 2*snsMaxSubjectLength),
+	}))
+
+	require.Len(t, client.inputs, 1)
+	assert.Len(t, aws.StringValue(client.inputs[0].Subject), snsMaxSubjectLength)
+	assert.Equal(t, strings.Repeat("t", 2*snsMaxSubjectLength), aws.StringValue(client.inputs[0].Message))
+}
+
+func TestSNSAlertSinkError(t *testing.T) {
+	client := &fakeSNSClient{err: errors.New("publish failed")}
+	sink := newSNSAlertSinkWithClient(client, alertTestTopicARN)
+
+	assert.Error(t, sink.Send(OperatorAlert{Severity: OperatorAlertSeverityInfo, Title: "title"}))
+}
+
+func TestNewOperatorAlertSink(t *testing.T) {
+	cfg := &config.Config{AWSRegion: "us-west-2"}
+	assert.Equal(t, SeelogAlertSink{}, newOperatorAlertSink(cfg, nil))
+
+	cfg.ACSOperatorAlertsSNSTopicARN = alertTestTopicARN
+	sink, ok := newOperatorAlertSink(cfg, nil).(*SNSAlertSink)
+	require.True(t, ok)
+	assert.Equal(t, alertTestTopicARN, sink.topicARN)
+}
@@ -0,0 +1,223 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// payloadBufferResizeWindow is the window over which the occupancy of the
+	// payload buffer is observed before it's resized
+	payloadBufferResizeWindow = 10 * time.Second
+	// payloadBufferResizeStep is the number of messages by which the payload
+	// buffer grows or shrinks
+	payloadBufferResizeStep = 5
+	// payloadBufferHighOccupancy is the occupancy above which the payload buffer
+	// is considered full
+	payloadBufferHighOccupancy = 0.8
+	// payloadBufferLowOccupancy is the occupancy below which the payload buffer
+	// is considered empty
+	payloadBufferLowOccupancy = 0.2
+)
+
+// adaptivePayloadBuffer is a FIFO queue of the payload messages waiting to be
+// processed. Unlike a channel, its capacity adapts to the rate at which messages
+// are received: it grows when it's consistently almost full over a window, so
+// that a slow task engine doesn't stall the ACS connection, and shrinks back when
+// it's consistently almost empty. The capacity is bounded by min and max
+type adaptivePayloadBuffer struct {
+	lock     sync.Mutex
+	messages []*ecsacs.PayloadMessage
+	capacity int
+	min      int
+	max      int
+	// pushed and popped signal waiting consumers and producers respectively.
+	// They are buffered so that a signal is never lost, waking up a goroutine
+	// that finds nothing to do is harmless
+	pushed chan struct{}
+	popped chan struct{}
+	// windowStart, samples, highSamples and lowSamples track the occupancy of
+	// the buffer in the current resize window
+	windowStart time.Time
+	samples     int
+	highSamples int
+	lowSamples  int
+	// resizeWindow is a field so that it can be overridden in tests
+	resizeWindow time.Duration
+}
+
+// newAdaptivePayloadBuffer returns a new adaptivePayloadBuffer object. The default
+// bounds are used if min is not set, max is raised to min if it's lower
+func newAdaptivePayloadBuffer(min, max int) *adaptivePayloadBuffer {
+	if min <= 0 {
+		min = config.DefaultACSPayloadBufferMin
+	}
+	if max < min {
+		max = min
+	}
+	return &adaptivePayloadBuffer{
+		capacity:     min,
+		min:          min,
+		max:          max,
+		pushed:       make(chan struct{}, 1),
+		popped:       make(chan struct{}, 1),
+		windowStart:  time.Now(),
+		resizeWindow: payloadBufferResizeWindow,
+	}
+}
+
+// push appends the message to the buffer, blocking while the buffer is full. It
+// returns false if the context is canceled before the message could be buffered
+func (buffer *adaptivePayloadBuffer) push(ctx context.Context, message *ecsacs.PayloadMessage) bool {
+	for {
+		if buffer.tryPush(message) {
+			return true
+		}
+
+		select {
+		case <-buffer.popped:
+		case <-time.After(buffer.resizeWindow):
+			// Sample the buffer again even if the consumer is stalled, so
+			// that the buffer can grow
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// tryPush appends the message to the buffer without blocking. It returns false
+// if the buffer is full
+func (buffer *adaptivePayloadBuffer) tryPush(message *ecsacs.PayloadMessage) bool {
+	buffer.lock.Lock()
+	buffer.sample()
+	if len(buffer.messages) >= buffer.capacity {
+		buffer.lock.Unlock()
+		return false
+	}
+	buffer.messages = append(buffer.messages, message)
+	hasRoom := len(buffer.messages) < buffer.capacity
+	buffer.lock.Unlock()
+	signal(buffer.pushed)
+	if hasRoom {
+		// Pass the signal on to other waiting producers
+		signal(buffer.popped)
+	}
+	return true
+}
+
+// pop removes the oldest message from the buffer, blocking while the buffer is
+// empty. It returns false if the context is canceled before a message is available
+func (buffer *adaptivePayloadBuffer) pop(ctx context.Context) (*ecsacs.PayloadMessage, bool) {
+	for {
+		buffer.lock.Lock()
+		if len(buffer.messages) > 0 {
+			message := buffer.messages[0]
+			buffer.messages[0] = nil
+			buffer.messages = buffer.messages[1:]
+			hasMore := len(buffer.messages) > 0
+			buffer.lock.Unlock()
+			signal(buffer.popped)
+			if hasMore {
+				// Pass the signal on to other waiting consumers
+				signal(buffer.pushed)
+			}
+			return message, true
+		}
+		buffer.lock.Unlock()
+
+		select {
+		case <-buffer.pushed:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+// size returns the number of buffered messages
+func (buffer *adaptivePayloadBuffer) size() int {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	return len(buffer.messages)
+}
+
+// currentCapacity returns the current capacity of the buffer
+func (buffer *adaptivePayloadBuffer) currentCapacity() int {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	return buffer.capacity
+}
+
+// sample records the occupancy of the buffer and resizes it at the end of each
+// window in which the buffer was consistently almost full or almost empty. It
+// must be called with the lock held
+func (buffer *adaptivePayloadBuffer) sample() {
+	now := time.Now()
+	if now.Sub(buffer.windowStart) >= buffer.resizeWindow {
+		buffer.resize()
+		buffer.windowStart = now
+		buffer.samples, buffer.highSamples, buffer.lowSamples = 0, 0, 0
+	}
+
+	occupancy := float64(len(buffer.messages)) / float64(buffer.capacity)
+	buffer.samples++
+	if occupancy > payloadBufferHighOccupancy {
+		buffer.highSamples++
+	} else if occupancy < payloadBufferLowOccupancy {
+		buffer.lowSamples++
+	}
+}
+
+// resize grows or shrinks the buffer based on the samples of the window that
+// just ended. It must be called with the lock held
+func (buffer *adaptivePayloadBuffer) resize() {
+	if buffer.samples == 0 {
+		return
+	}
+	capacity := buffer.capacity
+	switch {
+	case buffer.highSamples == buffer.samples && capacity < buffer.max:
+		capacity += payloadBufferResizeStep
+		if capacity > buffer.max {
+			capacity = buffer.max
+		}
+	case buffer.lowSamples == buffer.samples && capacity > buffer.min:
+		capacity -= payloadBufferResizeStep
+		if capacity < buffer.min {
+			capacity = buffer.min
+		}
+	default:
+		return
+	}
+	seelog.Infof("Resizing the payload message buffer from %d to %d messages", buffer.capacity, capacity)
+	if capacity > buffer.capacity {
+		// Wake up a producer waiting for room
+		signal(buffer.popped)
+	}
+	buffer.capacity = capacity
+}
+
+// signal notifies a goroutine waiting on the channel, if any
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,171 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBufferTestMessage(i int) *ecsacs.PayloadMessage {
+	return &ecsacs.PayloadMessage{MessageId: aws.String(strconv.Itoa(i))}
+}
+
+func TestAdaptivePayloadBufferDefaultBounds(t *testing.T) {
+	buffer := newAdaptivePayloadBuffer(0, 0)
+	assert.Equal(t, config.DefaultACSPayloadBufferMin, buffer.min)
+	assert.Equal(t, config.DefaultACSPayloadBufferMin, buffer.max)
+	assert.Equal(t, config.DefaultACSPayloadBufferMin, buffer.currentCapacity())
+}
+
+func TestAdaptivePayloadBufferFIFO(t *testing.T) {
+	buffer := newAdaptivePayloadBuffer(10, 20)
+	for i := 0; i < 10; i++ {
+		require.True(t, buffer.push(context.TODO(), newBufferTestMessage(i)))
+	}
+	assert.Equal(t, 10, buffer.size())
+	for i := 0; i < 10; i++ {
+		message, ok := buffer.pop(context.TODO())
+		require.True(t, ok)
+		assert.Equal(t, strconv.Itoa(i), aws.StringValue(message.MessageId))
+	}
+	assert.Equal(t, 0, buffer.size())
+}
+
+func TestAdaptivePayloadBufferPushBlocksWhenFull(t *testing.T) {
+	buffer := newAdaptivePayloadBuffer(1, 1)
+	require.True(t, buffer.push(context.TODO(), newBufferTestMessage(0)))
+
+	pushed := make(chan bool)
+	go func() {
+		pushed <- buffer.push(context.TODO(), newBufferTestMessage(1))
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push should block while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	_, ok := buffer.pop(context.TODO())
+	require.True(t, ok)
+	assert.True(t, <-pushed)
+	assert.Equal(t, 1, buffer.size())
+}
+
+func TestAdaptivePayloadBufferCanceled(t *testing.T) {
+	buffer := newAdaptivePayloadBuffer(1, 1)
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+
+	_, ok := buffer.pop(ctx)
+	assert.False(t, ok, "pop should return when the context is canceled")
+
+	require.True(t, buffer.push(context.TODO(), newBufferTestMessage(0)))
+	assert.False(t, buffer.push(ctx, newBufferTestMessage(1)), "push should return when the context is canceled")
+}
+
+func TestAdaptivePayloadBufferGrowsWhenConsistentlyFull(t *testing.T) {
+	buffer := newAdaptivePayloadBuffer(10, 12)
+	buffer.resizeWindow = 20 * time.Millisecond
+	for i := 0; i < 10; i++ {
+		require.True(t, buffer.push(context.TODO(), newBufferTestMessage(i)))
+	}
+	// Start a window in which the buffer is full
+	buffer.lock.Lock()
+	buffer.windowStart = time.Now()
+	buffer.samples, buffer.highSamples, buffer.lowSamples = 0, 0, 0
+	buffer.lock.Unlock()
+
+	// The consumer is stalled, the buffer grows at the end of the window
+	require.True(t, buffer.push(context.TODO(), newBufferTestMessage(10)))
+	assert.Equal(t, 12, buffer.currentCapacity(), "buffer should grow up to its maximum")
+	assert.Equal(t, 11, buffer.size())
+}
+
+func TestAdaptivePayloadBufferShrinksWhenConsistentlyEmpty(t *testing.T) {
+	buffer := newAdaptivePayloadBuffer(10, 30)
+	buffer.lock.Lock()
+	buffer.capacity = 20
+	buffer.lock.Unlock()
+
+	require.True(t, buffer.push(context.TODO(), newBufferTestMessage(0)))
+	_, ok := buffer.pop(context.TODO())
+	require.True(t, ok)
+
+	// End the window in which the buffer was empty
+	buffer.lock.Lock()
+	buffer.windowStart = time.Now().Add(-buffer.resizeWindow)
+	buffer.lock.Unlock()
+	require.True(t, buffer.push(context.TODO(), newBufferTestMessage(1)))
+	assert.Equal(t, 15, buffer.currentCapacity())
+}
+
+func TestAdaptivePayloadBufferKeepsSizeWhenOccupancyVaries(t *testing.T) {
+	buffer := newAdaptivePayloadBuffer(10, 30)
+	for i := 0; i < 9; i++ {
+		require.True(t, buffer.push(context.TODO(), newBufferTestMessage(i)))
+	}
+
+	// The window had both low and high occupancy samples
+	buffer.lock.Lock()
+	buffer.windowStart = time.Now().Add(-buffer.resizeWindow)
+	buffer.lock.Unlock()
+	require.True(t, buffer.push(context.TODO(), newBufferTestMessage(9)))
+	assert.Equal(t, 10, buffer.currentCapacity())
+}
+
+// BenchmarkAdaptivePayloadBuffer and BenchmarkStaticPayloadBuffer compare the
+// adaptive buffer with the channel it replaces, with a producer and a consumer
+func BenchmarkAdaptivePayloadBuffer(b *testing.B) {
+	buffer := newAdaptivePayloadBuffer(payloadMessageBufferSize, payloadMessageBufferSize*10)
+	message := newBufferTestMessage(0)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < b.N; i++ {
+			buffer.pop(context.TODO())
+		}
+		close(done)
+	}()
+	for i := 0; i < b.N; i++ {
+		buffer.push(context.TODO(), message)
+	}
+	<-done
+}
+
+func BenchmarkStaticPayloadBuffer(b *testing.B) {
+	buffer := make(chan *ecsacs.PayloadMessage, payloadMessageBufferSize)
+	message := newBufferTestMessage(0)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < b.N; i++ {
+			<-buffer
+		}
+		close(done)
+	}()
+	for i := 0; i < b.N; i++ {
+		buffer <- message
+	}
+	<-done
+}
@@ -15,6 +15,7 @@ package handler
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/logger"
 	"github.com/aws/amazon-ecs-agent/agent/logger/field"
@@ -25,10 +26,13 @@ import (
 	apieni "github.com/aws/amazon-ecs-agent/agent/api/eni"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/containermetadata"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/data"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dependencygraph"
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -38,10 +42,13 @@ import (
 // payloadRequestHandler represents the payload operation for the ACS client
 type payloadRequestHandler struct {
 	// messageBuffer is used to process PayloadMessages received from the server
-	messageBuffer chan *ecsacs.PayloadMessage
+	messageBuffer *adaptivePayloadBuffer
 	// ackRequest is used to send acks to the backend
-	ackRequest  chan string
-	ctx         context.Context
+	ackRequest chan string
+	ctx        context.Context
+	// sessionCtx is the context of the ACS session, the task starts queued by
+	// the session outlive the connection the tasks were received on
+	sessionCtx  context.Context
 	taskEngine  engine.TaskEngine
 	ecsClient   api.ECSClient
 	dataClient  data.Client
@@ -54,37 +61,155 @@ type payloadRequestHandler struct {
 	refreshHandler              refreshCredentialsHandler
 	credentialsManager          credentials.Manager
 	latestSeqNumberTaskManifest *int64
+	taskGroupThrottle           *taskGroupThrottle
+	drainState                  *taskDrainState
+	launchTracker               *launchSuccessRateTracker
+	taskMetadataCache           *containermetadata.TaskMetadataCache
+	cgroup                      *handlerCgroup
+	pinning                     *ProcessorPinning
+	authGate                    *authChallengeGate
+	filesystem                  *TaskFilesystemPreparator
+	resourceValidator           taskResourceValidator
+	dockerHealth                *dockerHealthProbe
+	tagsSynchronizer            *taskTagsSynchronizer
+	ebsWaiter                   *ebsVolumeAttachWaiter
+	storageVerifier             *StorageAttachmentVerifier
+	boundaryChecker             *PermissionsBoundaryChecker
+	pauseResume                 *ACSSessionPauseResume
+	envInjector                 *TaskEnvironmentInjector
+	schemaShim                  *SchemaCompatibilityShim
+	*inFlightAckTracker
+	// instanceResources are the resources available for tasks on the instance,
+	// nil if unknown
+	instanceResources *instanceResources
+	// maxMessageAge is the age after which messages are acked without being
+	// processed. Zero means messages are always processed
+	maxMessageAge time.Duration
+	// strictDecodeMode is true if messages with tasks having fields unknown to
+	// the agent are nacked instead of being processed
+	strictDecodeMode bool
+	// heartbeatAcks holds the heartbeat acks sent along with the payload acks, nil
+	// if the heartbeat acks are sent on their own
+	heartbeatAcks *heartbeatAckPiggyback
+	// submitRatePerSecond is the maximum number of tasks of a payload message
+	// to be started that are submitted to the task engine per second. Zero
+	// means submissions are not rate limited
+	submitRatePerSecond int
+	// submissions makes the submission of the tasks idempotent across agent
+	// restarts, nil if it isn't
+	submissions *RetryableTaskSubmission
+	routines    *handlerRoutines
+	// goroutines limits the goroutines started by the handler, nil if they
+	// aren't limited
+	goroutines *HandlerGoroutineLimiter
+}
+
+const (
+	// stalePayloadMessageDiscardedEvent is recorded every time a payload message
+	// is discarded because it was sent too long ago
+	stalePayloadMessageDiscardedEvent = "StalePayloadMessageDiscarded"
+	// payloadUnknownFieldsEvent is recorded every time a payload message with
+	// tasks having fields unknown to the agent is received
+	payloadUnknownFieldsEvent = "PayloadUnknownFields"
+	// circularDependencyDetectedEvent is recorded every time a task whose
+	// container dependencies can never be resolved is rejected
+	circularDependencyDetectedEvent = "CircularDependencyDetected"
+	// taskRoleOutOfBoundsEvent is recorded every time a payload message with a
+	// task whose IAM role exceeds the permissions boundary of the instance role
+	// is received
+	taskRoleOutOfBoundsEvent = "TaskRoleOutOfBounds"
+	// schemaVersionUnsupportedEvent is recorded every time a payload message
+	// using a schema with breaking changes the agent doesn't support is received
+	schemaVersionUnsupportedEvent = "SchemaVersionUnsupported"
+)
+
+// checkUnknownACSTaskFields is a variable so that it can be overridden in unit tests
+var checkUnknownACSTaskFields = apitask.CheckUnknownACSTaskFields
+
+// payloadRequestHandlerParams holds the dependencies of the payload request
+// handler. Optional dependencies can be left nil
+type payloadRequestHandlerParams struct {
+	taskEngine           engine.TaskEngine
+	ecsClient            api.ECSClient
+	cluster              string
+	containerInstanceArn string
+	acsClient            wsclient.ClientServer
+	dataClient           data.Client
+	refreshHandler       refreshCredentialsHandler
+	credentialsManager   credentials.Manager
+	taskHandler          *eventhandler.TaskHandler
+	seqNumTaskManifest   *int64
+	taskGroupThrottle    *taskGroupThrottle
+	drainState           *taskDrainState
+	launchTracker        *launchSuccessRateTracker
+	taskMetadataCache    *containermetadata.TaskMetadataCache
+	cgroup               *handlerCgroup
+	pinning              *ProcessorPinning
+	authGate             *authChallengeGate
+	filesystem           *TaskFilesystemPreparator
+	instanceResources    *instanceResources
+	dockerHealth         *dockerHealthProbe
+	tagsSynchronizer     *taskTagsSynchronizer
+	ebsWaiter            *ebsVolumeAttachWaiter
+	storageVerifier      *StorageAttachmentVerifier
+	boundaryChecker      *PermissionsBoundaryChecker
+	pauseResume          *ACSSessionPauseResume
+	envInjector          *TaskEnvironmentInjector
+	payloadBufferMin     int
+	payloadBufferMax     int
+	submitRatePerSecond  int
+	maxMessageAge        time.Duration
+	strictDecodeMode     bool
+	heartbeatAcks        *heartbeatAckPiggyback
+	idempotencyTokenTTL  time.Duration
+	goroutines           *HandlerGoroutineLimiter
 }
 
 // newPayloadRequestHandler returns a new payloadRequestHandler object
-func newPayloadRequestHandler(
-	ctx context.Context,
-	taskEngine engine.TaskEngine,
-	ecsClient api.ECSClient,
-	cluster string,
-	containerInstanceArn string,
-	acsClient wsclient.ClientServer,
-	dataClient data.Client,
-	refreshHandler refreshCredentialsHandler,
-	credentialsManager credentials.Manager,
-	taskHandler *eventhandler.TaskHandler, seqNumTaskManifest *int64) payloadRequestHandler {
+func newPayloadRequestHandler(ctx context.Context, params payloadRequestHandlerParams) payloadRequestHandler {
 	// Create a cancelable context from the parent context
 	derivedContext, cancel := context.WithCancel(ctx)
 	return payloadRequestHandler{
-		messageBuffer:               make(chan *ecsacs.PayloadMessage, payloadMessageBufferSize),
+		messageBuffer:               newAdaptivePayloadBuffer(params.payloadBufferMin, params.payloadBufferMax),
 		ackRequest:                  make(chan string, payloadMessageBufferSize),
-		taskEngine:                  taskEngine,
-		ecsClient:                   ecsClient,
-		dataClient:                  dataClient,
-		taskHandler:                 taskHandler,
+		taskEngine:                  params.taskEngine,
+		ecsClient:                   params.ecsClient,
+		dataClient:                  params.dataClient,
+		taskHandler:                 params.taskHandler,
 		ctx:                         derivedContext,
+		sessionCtx:                  ctx,
 		cancel:                      cancel,
-		cluster:                     cluster,
-		containerInstanceArn:        containerInstanceArn,
-		acsClient:                   acsClient,
-		refreshHandler:              refreshHandler,
-		credentialsManager:          credentialsManager,
-		latestSeqNumberTaskManifest: seqNumTaskManifest,
+		cluster:                     params.cluster,
+		containerInstanceArn:        params.containerInstanceArn,
+		acsClient:                   params.acsClient,
+		refreshHandler:              params.refreshHandler,
+		credentialsManager:          params.credentialsManager,
+		latestSeqNumberTaskManifest: params.seqNumTaskManifest,
+		taskGroupThrottle:           params.taskGroupThrottle,
+		drainState:                  params.drainState,
+		launchTracker:               params.launchTracker,
+		taskMetadataCache:           params.taskMetadataCache,
+		cgroup:                      params.cgroup,
+		pinning:                     params.pinning,
+		authGate:                    params.authGate,
+		filesystem:                  params.filesystem,
+		instanceResources:           params.instanceResources,
+		dockerHealth:                params.dockerHealth,
+		tagsSynchronizer:            params.tagsSynchronizer,
+		ebsWaiter:                   params.ebsWaiter,
+		storageVerifier:             params.storageVerifier,
+		boundaryChecker:             params.boundaryChecker,
+		pauseResume:                 params.pauseResume,
+		envInjector:                 params.envInjector,
+		schemaShim:                  newSchemaCompatibilityShim(agentSupportedSchemaVersion),
+		maxMessageAge:               params.maxMessageAge,
+		strictDecodeMode:            params.strictDecodeMode,
+		heartbeatAcks:               params.heartbeatAcks,
+		submitRatePerSecond:         params.submitRatePerSecond,
+		submissions:                 newRetryableTaskSubmission(params.dataClient, params.idempotencyTokenTTL),
+		inFlightAckTracker:          newInFlightAckTracker(),
+		routines:                    &handlerRoutines{},
+		goroutines:                  params.goroutines,
 	}
 }
 
@@ -92,16 +217,35 @@ func newPayloadRequestHandler(
 func (payloadHandler *payloadRequestHandler) handlerFunc() func(payload *ecsacs.PayloadMessage) {
 	// return a function that just enqueues PayloadMessages into the message buffer
 	return func(payload *ecsacs.PayloadMessage) {
-		payloadHandler.messageBuffer <- payload
+		payloadHandler.trackReceived("PayloadMessage", aws.StringValue(payload.MessageId))
+		if !payloadHandler.pauseResume.IsPaused() {
+			payloadHandler.messageBuffer.push(payloadHandler.ctx, payload)
+			return
+		}
+		// The buffer isn't drained while the processing is paused. Blocking until
+		// there is room would block the connection, heartbeats included, so the
+		// messages that don't fit are dropped. ACS resends them as they are not acked
+		if !payloadHandler.messageBuffer.tryPush(payload) {
+			payloadHandler.trackAcked(aws.StringValue(payload.MessageId))
+			seelog.Warnf("Payload processing is paused and the payload buffer is full, dropping payload message: %s",
+				aws.StringValue(payload.MessageId))
+		}
 	}
 }
 
 // start invokes go routines to:
-// 1. handle messages in the payload message buffer
+// 1. handle messages in the payload message buffer, in the ACS handler cgroup and
+// pinned to the ACS processor affinity if configured
 // 2. handle ack requests to be sent to ACS
+// 3. purge the expired task submission tokens
 func (payloadHandler *payloadRequestHandler) start() {
-	go payloadHandler.handleMessages()
-	go payloadHandler.sendAcks()
+	payloadHandler.routines.run(func() {
+		payloadHandler.cgroup.run("payload handler", func() {
+			payloadHandler.pinning.run("payload handler", payloadHandler.handleMessages)
+		})
+	})
+	payloadHandler.routines.run(payloadHandler.sendAcks)
+	payloadHandler.routines.run(payloadHandler.submissions.purgeExpiredTokens)
 }
 
 // stop cancels the context being used by the payload handler. This is used
@@ -110,6 +254,11 @@ func (payloadHandler *payloadRequestHandler) stop() {
 	payloadHandler.cancel()
 }
 
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (payloadHandler *payloadRequestHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, payloadHandler.stop, payloadHandler.routines, nil)
+}
+
 // sendAcks sends ack requests to ACS
 func (payloadHandler *payloadRequestHandler) sendAcks() {
 	for {
@@ -125,28 +274,40 @@ func (payloadHandler *payloadRequestHandler) sendAcks() {
 // ackMessageId sends an AckRequest for a message id
 func (payloadHandler *payloadRequestHandler) ackMessageId(messageID string) {
 	seelog.Debugf("Acking payload message id: %s", messageID)
-	err := payloadHandler.acsClient.MakeRequest(&ecsacs.AckRequest{
+	ack := &ecsacs.AckRequest{
 		Cluster:           aws.String(payloadHandler.cluster),
 		ContainerInstance: aws.String(payloadHandler.containerInstanceArn),
 		MessageId:         aws.String(messageID),
-	})
+	}
+	heartbeatAckSent := payloadHandler.heartbeatAcks.attach(ack)
+	err := payloadHandler.acsClient.MakeRequest(ack)
+	heartbeatAckSent(err)
 	if err != nil {
 		logger.Warn("Error ack'ing request", logger.Fields{
 			"messageID": messageID,
 			field.Error: err,
 		})
 	}
+	payloadHandler.trackAcked(messageID)
 }
 
 // handleMessages processes payload messages in the payload message buffer in-order
 func (payloadHandler *payloadRequestHandler) handleMessages() {
+	// Tasks are not processed before ACS has authenticated the instance, the
+	// payloads are held in the buffer until then
+	if !payloadHandler.authGate.wait(payloadHandler.ctx) {
+		return
+	}
 	for {
-		select {
-		case payload := <-payloadHandler.messageBuffer:
-			payloadHandler.handleSingleMessage(payload)
-		case <-payloadHandler.ctx.Done():
+		payload, ok := payloadHandler.messageBuffer.pop(payloadHandler.ctx)
+		if !ok {
 			return
 		}
+		// Hold the message back while the processing is paused
+		if !payloadHandler.pauseResume.wait(payloadHandler.ctx) {
+			return
+		}
+		payloadHandler.handleSingleMessage(payload)
 	}
 }
 
@@ -159,6 +320,48 @@ func (payloadHandler *payloadRequestHandler) handleSingleMessage(payload *ecsacs
 		return fmt.Errorf("received a payload with no message id")
 	}
 	seelog.Debugf("Received payload message, message id: %s", aws.StringValue(payload.MessageId))
+	if payloadHandler.isStale(payload) {
+		// The tasks in the message are likely outdated, ack it so that ACS doesn't
+		// resend it. The current state is sent again by ACS in later messages
+		seelog.Warnf("Discarding payload message %s sent at %s, older than %s",
+			aws.StringValue(payload.MessageId), sentAt(payload).String(), payloadHandler.maxMessageAge.String())
+		metrics.MetricsEngineGlobal.RecordACSEvent(stalePayloadMessageDiscardedEvent, 1)
+		payloadHandler.trackAckQueued(*payload.MessageId)
+		payloadHandler.goroutines.spawn(payloadMessageType, func() {
+			select {
+			case payloadHandler.ackRequest <- *payload.MessageId:
+			case <-payloadHandler.ctx.Done():
+			}
+		})
+		return nil
+	}
+	stripUnknownFields, err := payloadHandler.schemaShim.adapt(payload)
+	if err != nil {
+		// The message has breaking changes the agent doesn't know how to handle
+		metrics.MetricsEngineGlobal.RecordACSEvent(schemaVersionUnsupportedEvent, 1)
+		payloadHandler.nackMessage(payload, err)
+		return err
+	}
+	if err := payloadHandler.checkUnknownTaskFields(payload, stripUnknownFields); err != nil {
+		// Starting the tasks without the fields could make them behave incorrectly,
+		// let ACS know that the message can't be handled by this agent
+		payloadHandler.nackMessage(payload, err)
+		return err
+	}
+	if err := payloadHandler.checkTaskRoles(payload); err != nil {
+		// The task would fail at runtime when using its role, reject the message
+		// before any of its tasks is submitted
+		metrics.MetricsEngineGlobal.RecordACSEvent(taskRoleOutOfBoundsEvent, 1)
+		payloadHandler.nackMessage(payload, err)
+		return err
+	}
+	if err := payloadHandler.storageVerifier.verify(payload); err != nil {
+		// The containers would start without their EBS volumes, let ACS place
+		// the tasks elsewhere
+		metrics.MetricsEngineGlobal.RecordACSEvent(ebsVolumeNotFoundEvent, 1)
+		payloadHandler.nackMessage(payload, err)
+		return err
+	}
 	credentialsAcks, allTasksHandled := payloadHandler.addPayloadTasks(payload)
 
 	// Update latestSeqNumberTaskManifest for it to get updated in state file
@@ -169,20 +372,102 @@ func (payloadHandler *payloadRequestHandler) handleSingleMessage(payload *ecsacs
 	}
 
 	if !allTasksHandled {
+		// The message isn't acked so that ACS resends it
+		payloadHandler.trackAcked(*payload.MessageId)
 		return fmt.Errorf("did not handle all tasks")
 	}
 
-	go func() {
+	payloadHandler.trackAckQueued(*payload.MessageId)
+	payloadHandler.goroutines.spawn(payloadMessageType, func() {
 		// Throw the ack in async; it doesn't really matter all that much and this is blocking handling more tasks.
 		for _, credentialsAck := range credentialsAcks {
 			payloadHandler.refreshHandler.ackMessage(credentialsAck)
 		}
-		payloadHandler.ackRequest <- *payload.MessageId
-	}()
+		select {
+		case payloadHandler.ackRequest <- *payload.MessageId:
+		case <-payloadHandler.ctx.Done():
+		}
+	})
 
 	return nil
 }
 
+// checkUnknownTaskFields looks for fields unknown to the agent in the tasks of the
+// payload message. An error is returned for the first task having such fields in
+// strict decode mode, unless they're stripped, a warning is logged for each of
+// them otherwise
+func (payloadHandler *payloadRequestHandler) checkUnknownTaskFields(payload *ecsacs.PayloadMessage,
+	stripUnknownFields bool) error {
+	for _, task := range payload.Tasks {
+		if task == nil {
+			continue
+		}
+		err := checkUnknownACSTaskFields(task)
+		if err == nil {
+			continue
+		}
+		metrics.MetricsEngineGlobal.RecordACSEvent(payloadUnknownFieldsEvent, 1)
+		if payloadHandler.strictDecodeMode && !stripUnknownFields {
+			return UnknownTaskFieldsError{err}
+		}
+		seelog.Warnf("Task %s in payload message %s has fields unknown to the agent, they will be ignored: %v",
+			aws.StringValue(task.Arn), aws.StringValue(payload.MessageId), err)
+	}
+	return nil
+}
+
+// checkTaskRoles returns an error if the IAM role of any task in the payload
+// exceeds the permissions boundary of the instance role
+func (payloadHandler *payloadRequestHandler) checkTaskRoles(payload *ecsacs.PayloadMessage) error {
+	if payloadHandler.boundaryChecker == nil {
+		return nil
+	}
+	for _, task := range payload.Tasks {
+		if task == nil || task.RoleCredentials == nil {
+			continue
+		}
+		if err := payloadHandler.boundaryChecker.check(aws.StringValue(task.RoleCredentials.RoleArn)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nackMessage sends a NackRequest for the payload message
+func (payloadHandler *payloadRequestHandler) nackMessage(payload *ecsacs.PayloadMessage, reason error) {
+	messageID := aws.StringValue(payload.MessageId)
+	seelog.Warnf("Nacking payload message id: %s, reason: %v", messageID, reason)
+	err := payloadHandler.acsClient.MakeRequest(&ecsacs.NackRequest{
+		Cluster:           aws.String(payloadHandler.cluster),
+		ContainerInstance: aws.String(payloadHandler.containerInstanceArn),
+		MessageId:         aws.String(messageID),
+		Reason:            aws.String(reason.Error()),
+	})
+	if err != nil {
+		logger.Warn("Error nack'ing request", logger.Fields{
+			"messageID": messageID,
+			field.Error: err,
+		})
+	}
+	payloadHandler.trackAcked(messageID)
+}
+
+// isStale returns true if the payload message was sent by ACS longer than the
+// maximum message age ago. Messages without a sent timestamp are never stale
+func (payloadHandler *payloadRequestHandler) isStale(payload *ecsacs.PayloadMessage) bool {
+	if payloadHandler.maxMessageAge <= 0 || payload.SentAt == nil {
+		return false
+	}
+	return time.Since(sentAt(payload)) > payloadHandler.maxMessageAge
+}
+
+// sentAt returns the time at which the payload message was sent by ACS. The
+// timestamp is in milliseconds since the epoch
+func sentAt(payload *ecsacs.PayloadMessage) time.Time {
+	millis := aws.Int64Value(payload.SentAt)
+	return time.Unix(0, millis*int64(time.Millisecond))
+}
+
 // addPayloadTasks does validation on each task and, for all valid ones, adds
 // it to the task engine. It returns a bool indicating if it could add every
 // task to the taskEngine and a slice of credential ack requests
@@ -191,6 +476,8 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 	allTasksOK := true
 
 	validTasks := make([]*apitask.Task, 0, len(payload.Tasks))
+	// taskGroups maps the arn of each valid task to the task group it belongs to
+	taskGroups := make(map[string]string)
 	for _, task := range payload.Tasks {
 		if task == nil {
 			seelog.Criticalf("Received nil task for messageId: %s", aws.StringValue(payload.MessageId))
@@ -210,6 +497,36 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 			field.DesiredStatus: apiTask.GetDesiredStatus(),
 		})
 
+		if apiTask.GetDesiredStatus() == apitaskstatus.TaskRunning && payloadHandler.drainState.isDraining() {
+			// The task is stopped and the message is still acked, ECS would keep
+			// the task pending otherwise
+			seelog.Warnf("Container instance is being drained, rejecting task: %s", apiTask.Arn)
+			payloadHandler.stopRejectedTask(task, ContainerInstanceDrainingError{}, payload)
+			continue
+		}
+
+		if apiTask.GetDesiredStatus() == apitaskstatus.TaskRunning {
+			if err := payloadHandler.resourceValidator.validate(apiTask, payloadHandler.instanceResources); err != nil {
+				// The task is stopped and the message is still acked, ACS would
+				// keep sending the same invalid task otherwise
+				payloadHandler.handleInvalidTaskResources(task, err, payload)
+				continue
+			}
+			// The dependencies are checked against the desired status of the
+			// containers, which the task engine would otherwise only set once
+			// the task is added
+			for _, container := range apiTask.Containers {
+				container.SetDesiredStatus(apitaskstatus.MapTaskToContainerStatus(
+					apitaskstatus.TaskRunning, container.GetSteadyStateStatus()))
+			}
+			if !dependencygraph.ValidDependencies(apiTask, nil) {
+				// The task engine would never be able to start the task, it's
+				// stopped without holding back the other tasks of the message
+				payloadHandler.handleCircularDependencies(task, payload)
+				continue
+			}
+		}
+
 		if task.RoleCredentials != nil {
 			// The payload from ACS for the task has credentials for the
 			// task. Add those to the credentials manager and set the
@@ -268,15 +585,27 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 			apiTask.SetExecutionRoleCredentialsID(taskExecutionIAMRoleCredentials.CredentialsID)
 		}
 
+		if apiTask.GetDesiredStatus() == apitaskstatus.TaskRunning {
+			payloadHandler.tagsSynchronizer.propagate(task, apiTask)
+			payloadHandler.envInjector.inject(apiTask)
+		}
+
+		// Make the task as received from ACS visible to the task metadata
+		// endpoint right away, without waiting for the engine to process it
+		payloadHandler.taskMetadataCache.Update(apiTask)
 		validTasks = append(validTasks, apiTask)
+		taskGroups[apiTask.Arn] = aws.StringValue(task.Group)
 	}
 
 	// Add 'stop' transitions first to allow seqnum ordering to work out
 	// Because a 'start' sequence number should only be proceeded if all 'stop's
 	// of the same sequence number have completed, the 'start' events need to be
 	// added after the 'stop' events are there to block them.
-	stoppedTasksCredentialsAcks, stoppedTasksAddedOK := payloadHandler.addTasks(payload, validTasks, isTaskStatusNotStopped)
-	newTasksCredentialsAcks, newTasksAddedOK := payloadHandler.addTasks(payload, validTasks, isTaskStatusStopped)
+	submitLimiter := newTaskSubmitRateLimiter(payloadHandler.submitRatePerSecond)
+	stoppedTasksCredentialsAcks, stoppedTasksAddedOK := payloadHandler.addTasks(payload, validTasks, taskGroups,
+		submitLimiter, isTaskStatusNotStopped)
+	newTasksCredentialsAcks, newTasksAddedOK := payloadHandler.addTasks(payload, validTasks, taskGroups,
+		submitLimiter, isTaskStatusStopped)
 	if !stoppedTasksAddedOK || !newTasksAddedOK {
 		allTasksOK = false
 	}
@@ -287,23 +616,79 @@ func (payloadHandler *payloadRequestHandler) addPayloadTasks(payload *ecsacs.Pay
 }
 
 // addTasks adds the tasks to the task engine based on the skipAddTask condition
-// This is used to add non-stopped tasks before adding stopped tasks
-func (payloadHandler *payloadRequestHandler) addTasks(payload *ecsacs.PayloadMessage, tasks []*apitask.Task, skipAddTask skipAddTaskComparatorFunc) ([]*ecsacs.IAMRoleCredentialsAckRequest, bool) {
+// This is used to add non-stopped tasks before adding stopped tasks. Tasks are
+// queued while docker is unhealthy and tasks to be started go through the task
+// group throttle, both of which may delay adding them to the task engine. The
+// submission of tasks to be started is paced by the submit rate limiter, so
+// that this returns only once all of them have been submitted. The pacing
+// happens on the payload handler goroutine: the following messages, including
+// the tasks they stop, are only handled once all the tasks have been submitted.
+// Tasks with EBS volume attachments are only started once their volumes are
+// visible on the host. The message is acked once the tasks are submitted, not
+// started: tasks to be started may still be queued after the ack. They are
+// saved before being queued, so that they're restored on restart, and the queues
+// belong to the session, so that they're started even if this connection ends
+func (payloadHandler *payloadRequestHandler) addTasks(payload *ecsacs.PayloadMessage, tasks []*apitask.Task,
+	taskGroups map[string]string, submitLimiter *taskSubmitRateLimiter,
+	skipAddTask skipAddTaskComparatorFunc) ([]*ecsacs.IAMRoleCredentialsAckRequest, bool) {
 	allTasksOK := true
 	var credentialsAcks []*ecsacs.IAMRoleCredentialsAckRequest
+	messageID := aws.StringValue(payload.MessageId)
 	for _, task := range tasks {
 		if skipAddTask(task.GetDesiredStatus()) {
 			continue
 		}
-		payloadHandler.taskEngine.AddTask(task)
-		// Only need to save task to DB when its desired status is RUNNING (i.e. this is a new task that we are going
-		// to manage). When its desired status is STOPPED, the task is already in the DB and the desired status change
-		// will be saved by task manager.
-		if task.GetDesiredStatus() == apitaskstatus.TaskRunning {
-			err := payloadHandler.dataClient.SaveTask(task)
-			if err != nil {
-				seelog.Errorf("Failed to save data for task %s: %v", task.Arn, err)
-				allTasksOK = false
+		if payloadHandler.submissions.submitted(messageID, task.Arn) {
+			// The agent restarted before the message was acked, only the ack is sent again
+			seelog.Infof("Task %s of payload message %s was already submitted to the task engine, not submitting it again",
+				task.Arn, messageID)
+		} else {
+			// Stopping a task doesn't pull any image, only the tasks to be started
+			// are rate limited
+			if task.GetDesiredStatus() == apitaskstatus.TaskRunning {
+				if err := submitLimiter.wait(payloadHandler.ctx); err != nil {
+					seelog.Warnf("Unable to submit task %s to the task engine: %v", task.Arn, err)
+					allTasksOK = false
+					break
+				}
+			}
+			// Only need to save task to DB when its desired status is RUNNING (i.e. this is a new task that we are going
+			// to manage). When its desired status is STOPPED, the task is already in the DB and the desired status change
+			// will be saved by task manager. The task is saved before being submitted, the submission may be queued
+			// and its token is only recorded once the task is both saved and added to the task engine
+			saved := true
+			if task.GetDesiredStatus() == apitaskstatus.TaskRunning {
+				err := payloadHandler.dataClient.SaveTask(task)
+				if err != nil {
+					seelog.Errorf("Failed to save data for task %s: %v", task.Arn, err)
+					allTasksOK = false
+					saved = false
+					// The message isn't acked, the task is saved again when ACS resends it
+					payloadHandler.submissions.forget(messageID, task.Arn)
+				}
+			}
+			taskToAdd := task
+			addTask := func() {
+				payloadHandler.taskEngine.AddTask(taskToAdd)
+				if saved {
+					payloadHandler.submissions.record(messageID, taskToAdd.Arn)
+				}
+			}
+			if taskToAdd.GetDesiredStatus() == apitaskstatus.TaskRunning {
+				// Stopping tasks relieves memory pressure, only the tasks to be
+				// started are held back while the host is under pressure
+				payloadHandler.dockerHealth.submitTaskStart(task.Arn, func() {
+					payloadHandler.ebsWaiter.submit(taskToAdd, func() {
+						payloadHandler.taskGroupThrottle.submit(taskGroups[taskToAdd.Arn], taskToAdd, func() {
+							payloadHandler.filesystem.prepare(taskToAdd)
+							addTask()
+							go payloadHandler.launchTracker.monitor(payloadHandler.sessionCtx, taskToAdd,
+								payloadHandler.handleLowLaunchSuccessRate)
+						})
+					})
+				})
+			} else {
+				payloadHandler.dockerHealth.submit(task.Arn, addTask)
 			}
 		}
 
@@ -359,12 +744,50 @@ func isTaskStatusNotStopped(status apitaskstatus.TaskStatus) bool {
 	return status != apitaskstatus.TaskStopped
 }
 
+// handleLowLaunchSuccessRate reports that the agent keeps failing to start tasks
+// and, if configured to, closes the connection to ACS so that the agent reconnects
+func (payloadHandler *payloadRequestHandler) handleLowLaunchSuccessRate(rate float64) {
+	seelog.Criticalf("Task launch success rate dropped to %.2f over the last %d task launches, below the minimum of %.2f",
+		rate, payloadHandler.launchTracker.windowSize, payloadHandler.launchTracker.minSuccessRate)
+	metrics.MetricsEngineGlobal.RecordACSEvent(lowTaskLaunchSuccessRateEvent, 1)
+	if !payloadHandler.launchTracker.reconnect {
+		return
+	}
+	seelog.Warn("Closing the connection to ACS to signal the low task launch success rate")
+	if err := payloadHandler.acsClient.Close(); err != nil {
+		seelog.Warnf("Error closing the connection to ACS: %v", err)
+	}
+}
+
 // handleUnrecognizedTask handles unrecognized tasks by sending 'stopped' with
 // a suitable reason to the backend
 func (payloadHandler *payloadRequestHandler) handleUnrecognizedTask(task *ecsacs.Task, err error, payload *ecsacs.PayloadMessage) {
 	seelog.Warnf("Received unexpected acs message, messageID: %s, task: %v, err: %v",
 		aws.StringValue(payload.MessageId), aws.StringValue(task.Arn), err)
+	payloadHandler.stopRejectedTask(task, UnrecognizedTaskError{err}, payload)
+}
 
+// handleInvalidTaskResources handles tasks with an invalid resource configuration
+// by sending 'stopped' with a suitable reason to the backend
+func (payloadHandler *payloadRequestHandler) handleInvalidTaskResources(task *ecsacs.Task, err error, payload *ecsacs.PayloadMessage) {
+	seelog.Warnf("Rejecting task with invalid resource configuration, messageID: %s, task: %v, err: %v",
+		aws.StringValue(payload.MessageId), aws.StringValue(task.Arn), err)
+	metrics.MetricsEngineGlobal.RecordACSEvent(taskValidationFailureEvent, 1)
+	payloadHandler.stopRejectedTask(task, InvalidTaskResourcesError{err}, payload)
+}
+
+// handleCircularDependencies handles tasks whose container dependencies can
+// never be resolved by sending 'stopped' with a suitable reason to the backend
+func (payloadHandler *payloadRequestHandler) handleCircularDependencies(task *ecsacs.Task, payload *ecsacs.PayloadMessage) {
+	seelog.Warnf("Rejecting task with unresolvable container dependencies, messageID: %s, task: %v",
+		aws.StringValue(payload.MessageId), aws.StringValue(task.Arn))
+	metrics.MetricsEngineGlobal.RecordACSEvent(circularDependencyDetectedEvent, 1)
+	payloadHandler.stopRejectedTask(task, CircularDependencyError{taskARN: aws.StringValue(task.Arn)}, payload)
+}
+
+// stopRejectedTask sends 'stopped' to the backend for a task that won't be
+// handed over to the task engine
+func (payloadHandler *payloadRequestHandler) stopRejectedTask(task *ecsacs.Task, reason error, payload *ecsacs.PayloadMessage) {
 	if aws.StringValue(task.Arn) == "" {
 		seelog.Criticalf("Received task with no arn, messageId: %s", aws.StringValue(payload.MessageId))
 		return
@@ -374,7 +797,7 @@ func (payloadHandler *payloadRequestHandler) handleUnrecognizedTask(task *ecsacs
 	taskEvent := api.TaskStateChange{
 		TaskARN: *task.Arn,
 		Status:  apitaskstatus.TaskStopped,
-		Reason:  UnrecognizedTaskError{err}.Error(),
+		Reason:  reason.Error(),
 		// The real task cannot be extracted from payload message, so we send an empty task.
 		// This is necessary because the task handler will not send an event whose
 		// Task is nil.
@@ -383,14 +806,3 @@ func (payloadHandler *payloadRequestHandler) handleUnrecognizedTask(task *ecsacs
 
 	payloadHandler.taskHandler.AddStateChangeEvent(taskEvent, payloadHandler.ecsClient)
 }
-
-// clearAcks drains the ack request channel
-func (payloadHandler *payloadRequestHandler) clearAcks() {
-	for {
-		select {
-		case <-payloadHandler.ackRequest:
-		default:
-			return
-		}
-	}
-}
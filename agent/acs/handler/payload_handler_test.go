@@ -24,6 +24,7 @@ import (
 	"reflect"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
 	"github.com/aws/amazon-ecs-agent/agent/api"
@@ -31,8 +32,11 @@ import (
 	mock_api "github.com/aws/amazon-ecs-agent/agent/api/mocks"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/containermetadata"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
+	mock_dockerapi "github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
@@ -75,17 +79,18 @@ func setup(t *testing.T) *testHelper {
 	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
 	latestSeqNumberTaskManifest := int64(10)
 
-	handler := newPayloadRequestHandler(
-		ctx,
-		taskEngine,
-		ecsClient,
-		clusterName,
-		containerInstanceArn,
-		mockWsClient,
-		data.NewNoopClient(),
-		refreshCredentialsHandler{},
-		credentialsManager,
-		taskHandler, &latestSeqNumberTaskManifest)
+	handler := newPayloadRequestHandler(ctx, payloadRequestHandlerParams{
+		taskEngine:           taskEngine,
+		ecsClient:            ecsClient,
+		cluster:              clusterName,
+		containerInstanceArn: containerInstanceArn,
+		acsClient:            mockWsClient,
+		dataClient:           data.NewNoopClient(),
+		refreshHandler:       refreshCredentialsHandler{},
+		credentialsManager:   credentialsManager,
+		taskHandler:          taskHandler,
+		seqNumTaskManifest:   &latestSeqNumberTaskManifest,
+	})
 
 	return &testHelper{
 		ctrl:               ctrl,
@@ -282,6 +287,274 @@ func TestHandlePayloadMessageAckedWhenTaskAdded(t *testing.T) {
 	assert.Equal(t, addedTask, expectedTask, "received task is not expected")
 }
 
+// TestHandlePayloadMessageDiscardsStaleMessages tests that payload messages sent longer
+// than the maximum message age ago are acked without adding their tasks
+func TestHandlePayloadMessageDiscardsStaleMessages(t *testing.T) {
+	maxMessageAge := 24 * time.Hour
+	testCases := []struct {
+		name          string
+		sentAt        *int64
+		expectDiscard bool
+	}{
+		{
+			name:          "no sent timestamp",
+			expectDiscard: false,
+		},
+		{
+			name:          "recent message",
+			sentAt:        millisAgo(time.Minute),
+			expectDiscard: false,
+		},
+		{
+			name:          "just under the maximum age",
+			sentAt:        millisAgo(maxMessageAge - time.Minute),
+			expectDiscard: false,
+		},
+		{
+			name:          "just over the maximum age",
+			sentAt:        millisAgo(maxMessageAge + time.Second),
+			expectDiscard: true,
+		},
+		{
+			name:          "well over the maximum age",
+			sentAt:        millisAgo(30 * maxMessageAge),
+			expectDiscard: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tester := setup(t)
+			defer tester.ctrl.Finish()
+			defer tester.cancel()
+			tester.payloadHandler.maxMessageAge = maxMessageAge
+
+			if tc.expectDiscard {
+				tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(0)
+			} else {
+				tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(1)
+			}
+
+			payloadMessage := &ecsacs.PayloadMessage{
+				Tasks: []*ecsacs.Task{
+					{
+						Arn: aws.String("t1"),
+					},
+				},
+				MessageId: aws.String(payloadMessageId),
+				SentAt:    tc.sentAt,
+			}
+			err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+			assert.NoError(t, err, "Error handling payload message")
+
+			// The message is acked whether or not it was discarded
+			select {
+			case mid := <-tester.payloadHandler.ackRequest:
+				assert.Equal(t, payloadMessageId, mid)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for payload message to be acked")
+			}
+		})
+	}
+}
+
+func newDependentACSContainer(name string, dependencies ...string) *ecsacs.Container {
+	container := &ecsacs.Container{Name: aws.String(name)}
+	for _, dependency := range dependencies {
+		container.DependsOn = append(container.DependsOn, &ecsacs.ContainerDependency{
+			ContainerName: aws.String(dependency),
+			Condition:     aws.String("START"),
+		})
+	}
+	return container
+}
+
+// TestHandlePayloadMessageWithCircularDependencies tests if the handler stops the tasks
+// whose container dependencies can never be resolved, and still adds the other tasks of
+// the message and acks it
+func TestHandlePayloadMessageWithCircularDependencies(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+
+	mockECSACSClient := mock_api.NewMockECSClient(tester.ctrl)
+	taskHandler := eventhandler.NewTaskHandler(tester.ctx, data.NewNoopClient(), dockerstate.NewTaskEngineState(), mockECSACSClient)
+	tester.payloadHandler.taskHandler = taskHandler
+
+	stopped := make(chan api.TaskStateChange, 1)
+	mockECSACSClient.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(change api.TaskStateChange) {
+		stopped <- change
+	})
+	var addedTask *apitask.Task
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		addedTask = task
+	})
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("valid"),
+				DesiredStatus: aws.String("RUNNING"),
+				Containers: []*ecsacs.Container{
+					newDependentACSContainer("app", "sidecar"),
+					newDependentACSContainer("sidecar"),
+				},
+			},
+			{
+				Arn:           aws.String("cycle"),
+				DesiredStatus: aws.String("RUNNING"),
+				Containers: []*ecsacs.Container{
+					newDependentACSContainer("app", "sidecar"),
+					newDependentACSContainer("sidecar", "app"),
+				},
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+	err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+	assert.NoError(t, err, "Error handling payload message")
+
+	select {
+	case mid := <-tester.payloadHandler.ackRequest:
+		assert.Equal(t, payloadMessageId, mid)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for payload message to be acked")
+	}
+	select {
+	case change := <-stopped:
+		assert.Equal(t, "cycle", change.TaskARN)
+		assert.Equal(t, apitaskstatus.TaskStopped, change.Status)
+		assert.Contains(t, change.Reason, "CircularDependencyError")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the task with circular dependencies to be stopped")
+	}
+	require.NotNil(t, addedTask)
+	assert.Equal(t, "valid", addedTask.Arn)
+}
+
+func TestHandlePayloadMessageWithTaskRoleOutOfBoundary(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+	tester.payloadHandler.boundaryChecker = newTestPermissionsBoundaryChecker(t, newFakeIAM("s3:PutObject"), time.Minute)
+
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(0)
+	tester.mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(message interface{}) {
+		nack, ok := message.(*ecsacs.NackRequest)
+		require.True(t, ok, "Expected a nack request")
+		assert.Equal(t, payloadMessageId, aws.StringValue(nack.MessageId))
+		assert.Contains(t, aws.StringValue(nack.Reason), "s3:PutObject")
+	}).Return(nil)
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:             aws.String("t1"),
+				DesiredStatus:   aws.String("RUNNING"),
+				RoleCredentials: &ecsacs.IAMRoleCredentials{RoleArn: aws.String(testTaskRoleARN)},
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+	err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+	assert.IsType(t, PermissionsBoundaryError{}, err)
+	assert.Empty(t, tester.payloadHandler.ListInFlightAcks())
+}
+
+func TestHandlePayloadMessageWithEBSVolumeNotFound(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+	_, cleanupSysBlock := setupSysBlock(t, "xvda")
+	defer cleanupSysBlock()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	saveEBSAttachment(t, dataClient, ebsTaskARN, "/dev/xvdf")
+	tester.payloadHandler.storageVerifier = newTestStorageAttachmentVerifier(tester.ctx, dataClient, 2)
+
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(0)
+	tester.mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(message interface{}) {
+		nack, ok := message.(*ecsacs.NackRequest)
+		require.True(t, ok, "Expected a nack request")
+		assert.Equal(t, payloadMessageId, aws.StringValue(nack.MessageId))
+		assert.Contains(t, aws.StringValue(nack.Reason), resourceNotFoundReason)
+	}).Return(nil)
+
+	err := tester.payloadHandler.handleSingleMessage(ebsPayload("RUNNING"))
+	assert.Error(t, err)
+	assert.Empty(t, tester.payloadHandler.ListInFlightAcks())
+}
+
+func TestHandlePayloadMessageWithUnknownTaskFields(t *testing.T) {
+	testCases := []struct {
+		name             string
+		strictDecodeMode bool
+	}{
+		{
+			name:             "strict decode mode",
+			strictDecodeMode: true,
+		},
+		{
+			name:             "non-strict decode mode",
+			strictDecodeMode: false,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tester := setup(t)
+			defer tester.ctrl.Finish()
+			defer tester.cancel()
+			tester.payloadHandler.strictDecodeMode = tc.strictDecodeMode
+
+			defer func() {
+				checkUnknownACSTaskFields = apitask.CheckUnknownACSTaskFields
+			}()
+			checkUnknownACSTaskFields = func(task *ecsacs.Task) error {
+				return errors.New(`json: unknown field "newField"`)
+			}
+
+			if tc.strictDecodeMode {
+				tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(0)
+				tester.mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(message interface{}) {
+					nack, ok := message.(*ecsacs.NackRequest)
+					require.True(t, ok, "Expected a nack request")
+					assert.Equal(t, payloadMessageId, aws.StringValue(nack.MessageId))
+					assert.Contains(t, aws.StringValue(nack.Reason), "newField")
+				}).Return(nil)
+			} else {
+				tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(1)
+			}
+
+			payloadMessage := &ecsacs.PayloadMessage{
+				Tasks: []*ecsacs.Task{
+					{
+						Arn: aws.String("t1"),
+					},
+				},
+				MessageId: aws.String(payloadMessageId),
+			}
+			err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+
+			if tc.strictDecodeMode {
+				assert.IsType(t, UnknownTaskFieldsError{}, err)
+				assert.Empty(t, tester.payloadHandler.ListInFlightAcks())
+				return
+			}
+			assert.NoError(t, err, "Error handling payload message")
+			select {
+			case mid := <-tester.payloadHandler.ackRequest:
+				assert.Equal(t, payloadMessageId, mid)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for payload message to be acked")
+			}
+		})
+	}
+}
+
+// millisAgo returns the time the duration ago in milliseconds since the epoch
+func millisAgo(duration time.Duration) *int64 {
+	return aws.Int64(time.Now().Add(-duration).UnixNano() / int64(time.Millisecond))
+}
+
 // TestHandlePayloadMessageCredentialsAckedWhenTaskAdded tests if the handler generates
 // an ack after processing a payload message when the payload message contains a task
 // with an IAM Role. It also tests if the credentials ack is generated
@@ -310,7 +583,7 @@ func TestHandlePayloadMessageCredentialsAckedWhenTaskAdded(t *testing.T) {
 		}),
 	)
 
-	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, clusterName, containerInstanceArn, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine)
+	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, clusterName, containerInstanceArn, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine, nil)
 	defer refreshCredsHandler.clearAcks()
 	refreshCredsHandler.start()
 	tester.payloadHandler.refreshHandler = refreshCredsHandler
@@ -415,6 +688,205 @@ func TestAddPayloadTaskAddsNonStoppedTasksAfterStoppedTasks(t *testing.T) {
 	assert.Equal(t, secondTaskAdded.GetDesiredStatus(), apitaskstatus.TaskRunning)
 }
 
+// TestAddPayloadTaskThrottlesTasksInSameGroup tests that tasks of the same task group
+// beyond the concurrency limit are not added to the task engine right away
+func TestAddPayloadTaskThrottlesTasksInSameGroup(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+	tester.payloadHandler.taskGroupThrottle = newTaskGroupThrottle(tester.ctx, nil, 1)
+
+	var tasksAddedToEngine []*apitask.Task
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		tasksAddedToEngine = append(tasksAddedToEngine, task)
+	}).Times(2)
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("groupedTask1"),
+				DesiredStatus: aws.String("RUNNING"),
+				Group:         aws.String("service:test"),
+			},
+			{
+				Arn:           aws.String("groupedTask2"),
+				DesiredStatus: aws.String("RUNNING"),
+				Group:         aws.String("service:test"),
+			},
+			{
+				Arn:           aws.String("ungroupedTask"),
+				DesiredStatus: aws.String("RUNNING"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+
+	_, ok := tester.payloadHandler.addPayloadTasks(payloadMessage)
+	assert.True(t, ok)
+	require.Len(t, tasksAddedToEngine, 2)
+	assert.Equal(t, "groupedTask1", tasksAddedToEngine[0].Arn)
+	assert.Equal(t, "ungroupedTask", tasksAddedToEngine[1].Arn)
+	assert.Equal(t, 1, tester.payloadHandler.taskGroupThrottle.pendingCount("service:test"))
+}
+
+// TestAddPayloadTaskQueuedStartOutlivesConnection tests that a task queued by the task
+// group throttle is still added to the task engine once the handler of the connection
+// it was received on is stopped
+func TestAddPayloadTaskQueuedStartOutlivesConnection(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+	throttle := newTaskGroupThrottle(tester.ctx, nil, 1)
+	throttle.pollInterval = testThrottlePollInterval
+	tester.payloadHandler.taskGroupThrottle = throttle
+
+	tasksAddedToEngine := make(chan *apitask.Task, 2)
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		tasksAddedToEngine <- task
+	}).Times(2)
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("groupedTask1"),
+				DesiredStatus: aws.String("RUNNING"),
+				Group:         aws.String("service:test"),
+			},
+			{
+				Arn:           aws.String("groupedTask2"),
+				DesiredStatus: aws.String("RUNNING"),
+				Group:         aws.String("service:test"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+	_, ok := tester.payloadHandler.addPayloadTasks(payloadMessage)
+	assert.True(t, ok)
+	firstTask := <-tasksAddedToEngine
+	assert.Equal(t, "groupedTask1", firstTask.Arn)
+
+	// The connection ends while the second task is queued
+	tester.payloadHandler.cancel()
+	firstTask.SetKnownStatus(apitaskstatus.TaskRunning)
+	select {
+	case task := <-tasksAddedToEngine:
+		assert.Equal(t, "groupedTask2", task.Arn)
+	case <-time.After(testThrottleWaitTimeout):
+		t.Fatal("Timed out waiting for the queued task to be added to the task engine")
+	}
+}
+
+// TestAddPayloadTaskRejectsNewTasksWhenDraining tests that tasks to be started
+// are not added to the task engine while the container instance is being
+// drained, and that they are reported as stopped
+func TestAddPayloadTaskRejectsNewTasksWhenDraining(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+	drainState := &taskDrainState{}
+	drainState.setDraining()
+	tester.payloadHandler.drainState = drainState
+
+	mockECSACSClient := mock_api.NewMockECSClient(tester.ctrl)
+	tester.payloadHandler.taskHandler = eventhandler.NewTaskHandler(tester.ctx, data.NewNoopClient(),
+		dockerstate.NewTaskEngineState(), mockECSACSClient)
+	stopped := make(chan api.TaskStateChange, 1)
+	mockECSACSClient.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(change api.TaskStateChange) {
+		stopped <- change
+	})
+
+	var tasksAddedToEngine []*apitask.Task
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		tasksAddedToEngine = append(tasksAddedToEngine, task)
+	})
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("runningTask"),
+				DesiredStatus: aws.String("RUNNING"),
+			},
+			{
+				Arn:           aws.String("stoppedTask"),
+				DesiredStatus: aws.String("STOPPED"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+
+	_, ok := tester.payloadHandler.addPayloadTasks(payloadMessage)
+	assert.True(t, ok)
+	require.Len(t, tasksAddedToEngine, 1)
+	assert.Equal(t, "stoppedTask", tasksAddedToEngine[0].Arn)
+
+	select {
+	case change := <-stopped:
+		assert.Equal(t, "runningTask", change.TaskARN)
+		assert.Equal(t, apitaskstatus.TaskStopped, change.Status)
+		assert.Contains(t, change.Reason, "ContainerInstanceDrainingError")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the state change of the rejected task")
+	}
+}
+
+func TestAddPayloadTaskUpdatesTaskMetadataCache(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	tester.payloadHandler.taskMetadataCache = containermetadata.NewTaskMetadataCache()
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any())
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("t1"),
+				Family:        aws.String("sleep"),
+				Version:       aws.String("2"),
+				DesiredStatus: aws.String("STOPPED"),
+				Containers: []*ecsacs.Container{
+					{
+						Name:  aws.String("sleepy"),
+						Image: aws.String("busybox"),
+					},
+				},
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+
+	_, ok := tester.payloadHandler.addPayloadTasks(payloadMessage)
+	assert.True(t, ok)
+	cached, ok := tester.payloadHandler.taskMetadataCache.Task("t1")
+	require.True(t, ok, "Task should be in the task metadata cache")
+	assert.Equal(t, "sleep", cached.Family)
+	assert.Equal(t, "2", cached.Version)
+	assert.Equal(t, "STOPPED", cached.DesiredStatus)
+	container, ok := tester.payloadHandler.taskMetadataCache.Container("t1", "sleepy")
+	require.True(t, ok, "Container should be in the task metadata cache")
+	assert.Equal(t, "busybox", container.Image)
+}
+
+// TestHandleLowLaunchSuccessRateReconnects tests that the connection to ACS is
+// closed when the launch success rate is low and reconnecting is enabled
+func TestHandleLowLaunchSuccessRateReconnects(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	tester.payloadHandler.launchTracker = newLaunchSuccessRateTracker(10, 0.5, true)
+
+	tester.mockWsClient.EXPECT().Close().Return(nil)
+	tester.payloadHandler.handleLowLaunchSuccessRate(0.1)
+}
+
+// TestHandleLowLaunchSuccessRateNoReconnect tests that the connection to ACS is
+// left open when the launch success rate is low and reconnecting is disabled
+func TestHandleLowLaunchSuccessRateNoReconnect(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	tester.payloadHandler.launchTracker = newLaunchSuccessRateTracker(10, 0.5, false)
+
+	tester.mockWsClient.EXPECT().Close().Times(0)
+	tester.payloadHandler.handleLowLaunchSuccessRate(0.1)
+}
+
 // TestPayloadBufferHandler tests if the async payloadBufferHandler routine
 // acks messages after adding tasks
 func TestPayloadBufferHandler(t *testing.T) {
@@ -435,14 +907,14 @@ func TestPayloadBufferHandler(t *testing.T) {
 	go tester.payloadHandler.start()
 	// Send a payload message to the payloadBufferChannel
 	taskArn := "t1"
-	tester.payloadHandler.messageBuffer <- &ecsacs.PayloadMessage{
+	tester.payloadHandler.messageBuffer.push(context.TODO(), &ecsacs.PayloadMessage{
 		Tasks: []*ecsacs.Task{
 			{
 				Arn: aws.String(taskArn),
 			},
 		},
 		MessageId: aws.String(payloadMessageId),
-	}
+	})
 
 	// Wait till we get an ack
 	select {
@@ -498,7 +970,7 @@ func TestPayloadBufferHandlerWithCredentials(t *testing.T) {
 		}),
 	)
 
-	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, clusterName, containerInstanceArn, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine)
+	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, clusterName, containerInstanceArn, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine, nil)
 	defer refreshCredsHandler.clearAcks()
 	refreshCredsHandler.start()
 	tester.payloadHandler.refreshHandler = refreshCredsHandler
@@ -522,7 +994,7 @@ func TestPayloadBufferHandlerWithCredentials(t *testing.T) {
 	secondTaskCredentialsId := "credsid2"
 
 	// Send a payload message to the payloadBufferChannel
-	tester.payloadHandler.messageBuffer <- &ecsacs.PayloadMessage{
+	tester.payloadHandler.messageBuffer.push(context.TODO(), &ecsacs.PayloadMessage{
 		Tasks: []*ecsacs.Task{
 			{
 				Arn: aws.String(firstTaskArn),
@@ -550,7 +1022,7 @@ func TestPayloadBufferHandlerWithCredentials(t *testing.T) {
 		MessageId:            aws.String(payloadMessageId),
 		ClusterArn:           aws.String(cluster),
 		ContainerInstanceArn: aws.String(containerInstance),
-	}
+	})
 
 	// Wait till we get an ack
 	select {
@@ -620,7 +1092,7 @@ func TestAddPayloadTaskAddsExecutionRoles(t *testing.T) {
 			tester.cancel()
 		}),
 	)
-	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, clusterName, containerInstanceArn, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine)
+	refreshCredsHandler := newRefreshCredentialsHandler(tester.ctx, clusterName, containerInstanceArn, tester.mockWsClient, tester.credentialsManager, tester.mockTaskEngine, nil)
 	defer refreshCredsHandler.clearAcks()
 	refreshCredsHandler.start()
 
@@ -634,7 +1106,7 @@ func TestAddPayloadTaskAddsExecutionRoles(t *testing.T) {
 	credentialsSessionToken := "token"
 	credentialsID := "credsid"
 
-	tester.payloadHandler.messageBuffer <- &ecsacs.PayloadMessage{
+	tester.payloadHandler.messageBuffer.push(context.TODO(), &ecsacs.PayloadMessage{
 		Tasks: []*ecsacs.Task{
 			{
 				Arn: aws.String(taskArn),
@@ -649,7 +1121,7 @@ func TestAddPayloadTaskAddsExecutionRoles(t *testing.T) {
 			},
 		},
 		MessageId: aws.String(payloadMessageId),
-	}
+	})
 
 	// Wait till we get an ack
 	select {
@@ -919,6 +1391,49 @@ func TestPayloadHandlerAddedECRAuthData(t *testing.T) {
 	assert.Equal(t, aws.StringValue(expected.EcrAuthData.RegistryId), actual.ECRAuthData.RegistryID)
 }
 
+// TestPayloadHandlerPropagatesTaskTags tests that the tags of the tasks to be
+// started are added to the docker labels of their containers
+func TestPayloadHandlerPropagatesTaskTags(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	tester.payloadHandler.tagsSynchronizer = newTaskTagsSynchronizer(true, tester.ecsClient, time.Minute)
+
+	var addedTask *apitask.Task
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(
+		func(task *apitask.Task) {
+			addedTask = task
+		})
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("arn"),
+				DesiredStatus: aws.String("RUNNING"),
+				Tags:          map[string]*string{"team": aws.String("blue")},
+				Containers: []*ecsacs.Container{
+					{
+						DockerConfig: &ecsacs.DockerConfig{
+							Config: aws.String(`{"Labels":{"app":"web"}}`),
+						},
+					},
+				},
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+
+	err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+	assert.NoError(t, err)
+
+	require.NotNil(t, addedTask)
+	dockerConfig, err := addedTask.DockerConfig(addedTask.Containers[0], dockerclient.Version_1_18)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"app":                        "web",
+		"com.amazonaws.ecs.tag.team": "blue",
+	}, dockerConfig.Labels)
+}
+
 func TestPayloadHandlerAddedASMAuthData(t *testing.T) {
 	tester := setup(t)
 	defer tester.ctrl.Finish()
@@ -991,6 +1506,64 @@ func TestHandleUnrecognizedTask(t *testing.T) {
 	wait.Wait()
 }
 
+// TestHandlePayloadMessageRejectsInvalidTaskResources tests if the handler stops the tasks
+// with an invalid resource configuration instead of adding them to the task engine, and
+// still acks the message so that ACS doesn't resend it
+func TestHandlePayloadMessageRejectsInvalidTaskResources(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+
+	mockECSACSClient := mock_api.NewMockECSClient(tester.ctrl)
+	taskHandler := eventhandler.NewTaskHandler(tester.ctx, data.NewNoopClient(), dockerstate.NewTaskEngineState(), mockECSACSClient)
+	tester.payloadHandler.taskHandler = taskHandler
+	tester.payloadHandler.instanceResources = &instanceResources{availableCPU: 1024, availableMemoryMiB: 2048}
+
+	stopped := make(chan api.TaskStateChange, 1)
+	mockECSACSClient.EXPECT().SubmitTaskStateChange(gomock.Any()).Do(func(change api.TaskStateChange) {
+		stopped <- change
+	})
+	var addedTask *apitask.Task
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		addedTask = task
+	})
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("valid"),
+				DesiredStatus: aws.String("RUNNING"),
+				Containers:    []*ecsacs.Container{{Name: aws.String("c"), Cpu: aws.Int64(512), Memory: aws.Int64(512)}},
+			},
+			{
+				Arn:           aws.String("invalid"),
+				DesiredStatus: aws.String("RUNNING"),
+				Containers:    []*ecsacs.Container{{Name: aws.String("c"), Cpu: aws.Int64(4096), Memory: aws.Int64(512)}},
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+	err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+	assert.NoError(t, err, "Error handling payload message")
+
+	select {
+	case mid := <-tester.payloadHandler.ackRequest:
+		assert.Equal(t, payloadMessageId, mid)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for payload message to be acked")
+	}
+	select {
+	case change := <-stopped:
+		assert.Equal(t, "invalid", change.TaskARN)
+		assert.Equal(t, apitaskstatus.TaskStopped, change.Status)
+		assert.Contains(t, change.Reason, "InvalidTaskResourcesError")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the invalid task to be stopped")
+	}
+	require.NotNil(t, addedTask)
+	assert.Equal(t, "valid", addedTask.Arn)
+}
+
 func TestPayloadHandlerAddedFirelensData(t *testing.T) {
 	tester := setup(t)
 	defer tester.ctrl.Finish()
@@ -1031,3 +1604,198 @@ func TestPayloadHandlerAddedFirelensData(t *testing.T) {
 	assert.NotNil(t, actual.Options)
 	assert.Equal(t, aws.StringValue(expected.Options["enable-ecs-log-metadata"]), actual.Options["enable-ecs-log-metadata"])
 }
+
+// TestHandlePayloadMessageNotResubmittedAfterRestart tests that the tasks of a
+// payload message resent by ACS after an agent restart aren't submitted again
+// if they were submitted before the restart, and that the message is acked
+func TestHandlePayloadMessageNotResubmittedAfterRestart(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String(testTaskARN),
+				DesiredStatus: aws.String("RUNNING"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+
+	// The agent crashes after submitting the task, before acking the message
+	tester := setup(t)
+	tester.payloadHandler.dataClient = dataClient
+	tester.payloadHandler.submissions = newRetryableTaskSubmission(dataClient, time.Hour)
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(1)
+	_, allTasksHandled := tester.payloadHandler.addPayloadTasks(payloadMessage)
+	assert.True(t, allTasksHandled)
+	tester.ctrl.Finish()
+
+	// ACS resends the message to the restarted agent
+	tester = setup(t)
+	defer tester.ctrl.Finish()
+	tester.payloadHandler.dataClient = dataClient
+	tester.payloadHandler.submissions = newRetryableTaskSubmission(dataClient, time.Hour)
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(0)
+	var ackRequested *ecsacs.AckRequest
+	tester.mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(ackRequest *ecsacs.AckRequest) {
+		ackRequested = ackRequest
+		tester.cancel()
+	}).Times(1)
+
+	go tester.payloadHandler.start()
+	require.NoError(t, tester.payloadHandler.handleSingleMessage(payloadMessage))
+	<-tester.ctx.Done()
+	assert.Equal(t, payloadMessageId, aws.StringValue(ackRequested.MessageId))
+}
+
+// TestHandlePayloadMessageQueuedTaskResubmittedAfterRestart tests that a task
+// still queued when the agent crashes is submitted again when ACS resends the
+// message, as it was never added to the task engine
+func TestHandlePayloadMessageQueuedTaskResubmittedAfterRestart(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String(testTaskARN),
+				DesiredStatus: aws.String("RUNNING"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+
+	// The task is queued while docker is unhealthy when the agent crashes
+	tester := setup(t)
+	tester.payloadHandler.dataClient = dataClient
+	tester.payloadHandler.submissions = newRetryableTaskSubmission(dataClient, time.Hour)
+	dockerClient := mock_dockerapi.NewMockDockerClient(tester.ctrl)
+	tester.payloadHandler.dockerHealth = newDockerHealthProbe(dockerClient, time.Second, 1, nil)
+	dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).Return("", errors.New("timeout"))
+	tester.payloadHandler.dockerHealth.check(tester.ctx)
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(0)
+	_, allTasksHandled := tester.payloadHandler.addPayloadTasks(payloadMessage)
+	assert.True(t, allTasksHandled)
+	tester.ctrl.Finish()
+	_, err := dataClient.GetTaskSubmission(payloadMessageId, testTaskARN)
+	assert.Error(t, err, "no token should be recorded for a queued task")
+
+	// ACS resends the message to the restarted agent
+	tester = setup(t)
+	defer tester.ctrl.Finish()
+	tester.payloadHandler.dataClient = dataClient
+	tester.payloadHandler.submissions = newRetryableTaskSubmission(dataClient, time.Hour)
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(1)
+	_, allTasksHandled = tester.payloadHandler.addPayloadTasks(payloadMessage)
+	assert.True(t, allTasksHandled)
+	_, err = dataClient.GetTaskSubmission(payloadMessageId, testTaskARN)
+	assert.NoError(t, err)
+}
+
+// failingSaveTaskDataClient is a data client failing to save tasks
+type failingSaveTaskDataClient struct {
+	data.Client
+}
+
+func (failingSaveTaskDataClient) SaveTask(*apitask.Task) error {
+	return errors.New("disk full")
+}
+
+// TestHandlePayloadMessageTaskSaveFailureDropsToken tests that the task is
+// saved and submitted again when ACS resends a message whose task couldn't be
+// saved, even if an expired token of its submission is left
+func TestHandlePayloadMessageTaskSaveFailureDropsToken(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	require.NoError(t, dataClient.SaveTaskSubmission(&data.TaskSubmission{
+		MessageID:   payloadMessageId,
+		TaskARN:     testTaskARN,
+		SubmittedAt: time.Now().Add(-2 * time.Hour),
+	}))
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String(testTaskARN),
+				DesiredStatus: aws.String("RUNNING"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	tester.payloadHandler.dataClient = failingSaveTaskDataClient{dataClient}
+	tester.payloadHandler.submissions = newRetryableTaskSubmission(dataClient, time.Hour)
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(2)
+	_, allTasksHandled := tester.payloadHandler.addPayloadTasks(payloadMessage)
+	assert.False(t, allTasksHandled, "the message shouldn't be acked")
+	_, err := dataClient.GetTaskSubmission(payloadMessageId, testTaskARN)
+	assert.Error(t, err, "the token should be dropped")
+
+	// The task is saved when ACS resends the message
+	tester.payloadHandler.dataClient = dataClient
+	_, allTasksHandled = tester.payloadHandler.addPayloadTasks(payloadMessage)
+	assert.True(t, allTasksHandled)
+	tasks, err := dataClient.GetTasks()
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+}
+
+// TestHandlePayloadMessageResubmittedAfterTokenExpiry tests that the tasks of a
+// payload message are submitted again once their submission token has expired
+func TestHandlePayloadMessageResubmittedAfterTokenExpiry(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	require.NoError(t, dataClient.SaveTaskSubmission(&data.TaskSubmission{
+		MessageID:   payloadMessageId,
+		TaskARN:     testTaskARN,
+		SubmittedAt: time.Now().Add(-2 * time.Hour),
+	}))
+
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	tester.payloadHandler.dataClient = dataClient
+	tester.payloadHandler.submissions = newRetryableTaskSubmission(dataClient, time.Hour)
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(1)
+	_, allTasksHandled := tester.payloadHandler.addPayloadTasks(&ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String(testTaskARN),
+				DesiredStatus: aws.String("RUNNING"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	})
+	assert.True(t, allTasksHandled)
+
+	token, err := dataClient.GetTaskSubmission(payloadMessageId, testTaskARN)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), token.SubmittedAt, time.Minute, "the token should be renewed")
+}
+
+// TestHandlePayloadMessageSubmissionTokensPerMessage tests that a task of a new
+// payload message is submitted even if it was submitted for another message
+func TestHandlePayloadMessageSubmissionTokensPerMessage(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	require.NoError(t, dataClient.SaveTaskSubmission(&data.TaskSubmission{
+		MessageID:   "previous-message",
+		TaskARN:     testTaskARN,
+		SubmittedAt: time.Now(),
+	}))
+
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	tester.payloadHandler.dataClient = dataClient
+	tester.payloadHandler.submissions = newRetryableTaskSubmission(dataClient, time.Hour)
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(1)
+	_, allTasksHandled := tester.payloadHandler.addPayloadTasks(&ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String(testTaskARN),
+				DesiredStatus: aws.String("STOPPED"),
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	})
+	assert.True(t, allTasksHandled)
+}
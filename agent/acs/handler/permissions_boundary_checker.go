@@ -0,0 +1,374 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/async"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// iamRoundtripTimeout is the timeout of the requests to IAM
+	iamRoundtripTimeout = 5 * time.Second
+	// policyDocumentVersion is the version of the policy language of the
+	// permissions boundary built from the policies of the instance role
+	policyDocumentVersion = "2012-10-17"
+)
+
+// iamSDK is the subset of the IAM API used to check the task IAM roles
+type iamSDK interface {
+	ListRolePolicies(*iam.ListRolePoliciesInput) (*iam.ListRolePoliciesOutput, error)
+	GetRolePolicy(*iam.GetRolePolicyInput) (*iam.GetRolePolicyOutput, error)
+	ListAttachedRolePolicies(*iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error)
+	GetPolicy(*iam.GetPolicyInput) (*iam.GetPolicyOutput, error)
+	GetPolicyVersion(*iam.GetPolicyVersionInput) (*iam.GetPolicyVersionOutput, error)
+	SimulateCustomPolicy(*iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error)
+}
+
+// PermissionsBoundaryChecker checks that the IAM roles of the tasks received
+// from ACS are within the permissions boundary of the instance role, so that
+// tasks whose roles exceed it are rejected before they're started instead of
+// failing at runtime. The actions allowed by the policies of a task role are
+// simulated with the policies of the instance role as permissions boundary.
+// The results are cached per role ARN
+type PermissionsBoundaryChecker struct {
+	iamClient         iamSDK
+	ec2MetadataClient ec2.EC2MetadataClient
+	// results maps the role ARNs to their permissionsBoundaryCheckResult
+	results async.TTLCache
+	// boundaries maps the instance role name to its permissions boundary
+	boundaries async.TTLCache
+}
+
+// permissionsBoundaryCheckResult is the cached result of the check of a role
+type permissionsBoundaryCheckResult struct {
+	err error
+}
+
+// newPermissionsBoundaryChecker returns a new PermissionsBoundaryChecker
+// object, or nil if the task IAM roles aren't checked
+func newPermissionsBoundaryChecker(cfg *config.Config, credentialsProvider *credentials.Credentials,
+	ec2MetadataClient ec2.EC2MetadataClient) *PermissionsBoundaryChecker {
+	if !cfg.ACSIAMPrecheck || ec2MetadataClient == nil {
+		return nil
+	}
+	var iamConfig aws.Config
+	iamConfig.Credentials = credentialsProvider
+	iamConfig.Region = aws.String(cfg.AWSRegion)
+	iamConfig.HTTPClient = httpclient.New(iamRoundtripTimeout, cfg.AcceptInsecureCert)
+	return newPermissionsBoundaryCheckerWithClient(iam.New(awssession.New(&iamConfig)), ec2MetadataClient,
+		cfg.IAMCheckCacheTTL)
+}
+
+// newPermissionsBoundaryCheckerWithClient returns a new PermissionsBoundaryChecker
+// object using the IAM client
+func newPermissionsBoundaryCheckerWithClient(iamClient iamSDK, ec2MetadataClient ec2.EC2MetadataClient,
+	cacheTTL time.Duration) *PermissionsBoundaryChecker {
+	return &PermissionsBoundaryChecker{
+		iamClient:         iamClient,
+		ec2MetadataClient: ec2MetadataClient,
+		results:           async.NewTTLCache(cacheTTL),
+		boundaries:        async.NewTTLCache(cacheTTL),
+	}
+}
+
+// check returns a PermissionsBoundaryError if the role allows actions outside
+// of the permissions boundary of the instance role. Roles that can't be
+// checked, e.g. because the instance role isn't allowed to read them, are
+// assumed to be within the boundary so that tasks aren't rejected because of
+// a failure of IAM
+func (checker *PermissionsBoundaryChecker) check(roleARN string) error {
+	if checker == nil || roleARN == "" {
+		return nil
+	}
+	if value, expired, ok := checker.results.Get(roleARN); ok && !expired {
+		return value.(permissionsBoundaryCheckResult).err
+	}
+	err := checker.simulate(roleARN)
+	var boundaryErr PermissionsBoundaryError
+	if err != nil && !errors.As(err, &boundaryErr) {
+		seelog.Warnf("Unable to check IAM role %s against the permissions boundary of the instance role: %v",
+			roleARN, err)
+		return nil
+	}
+	checker.results.Set(roleARN, permissionsBoundaryCheckResult{err: err})
+	return err
+}
+
+// simulate simulates the actions allowed by the policies of the role with the
+// permissions boundary of the instance role
+func (checker *PermissionsBoundaryChecker) simulate(roleARN string) error {
+	boundary, err := checker.instanceRoleBoundary()
+	if err != nil {
+		return err
+	}
+	policies, err := checker.rolePolicies(roleNameFromARN(roleARN))
+	if err != nil {
+		return err
+	}
+	actions, err := allowedActions(policies)
+	if err != nil || len(actions) == 0 {
+		return err
+	}
+
+	input := &iam.SimulateCustomPolicyInput{
+		PolicyInputList:                    aws.StringSlice(policies),
+		PermissionsBoundaryPolicyInputList: aws.StringSlice([]string{boundary}),
+		ActionNames:                        aws.StringSlice(actions),
+	}
+	deniedActions := map[string]struct{}{}
+	for {
+		output, err := checker.iamClient.SimulateCustomPolicy(input)
+		if err != nil {
+			return err
+		}
+		for _, result := range output.EvaluationResults {
+			detail := result.PermissionsBoundaryDecisionDetail
+			if detail != nil && !aws.BoolValue(detail.AllowedByPermissionsBoundary) {
+				deniedActions[aws.StringValue(result.EvalActionName)] = struct{}{}
+			}
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			break
+		}
+		input.Marker = output.Marker
+	}
+	if len(deniedActions) == 0 {
+		return nil
+	}
+	return PermissionsBoundaryError{roleARN: roleARN, actions: sortedKeys(deniedActions)}
+}
+
+// instanceRoleBoundary returns the permissions boundary of the instance role,
+// a policy document merging the statements of all of its policies
+func (checker *PermissionsBoundaryChecker) instanceRoleBoundary() (string, error) {
+	roles, err := checker.ec2MetadataClient.GetMetadata(ec2.SecurityCrednetialsResource)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the instance role: %v", err)
+	}
+	roleName := strings.TrimSpace(strings.Split(strings.TrimSpace(roles), "\n")[0])
+	if roleName == "" {
+		return "", errors.New("the instance has no IAM role")
+	}
+	if value, expired, ok := checker.boundaries.Get(roleName); ok && !expired {
+		return value.(string), nil
+	}
+	policies, err := checker.rolePolicies(roleName)
+	if err != nil {
+		return "", err
+	}
+	boundary, err := mergePolicies(policies)
+	if err != nil {
+		return "", err
+	}
+	checker.boundaries.Set(roleName, boundary)
+	return boundary, nil
+}
+
+// rolePolicies returns the documents of the inline and managed policies of the role
+func (checker *PermissionsBoundaryChecker) rolePolicies(roleName string) ([]string, error) {
+	var policies []string
+	listInput := &iam.ListRolePoliciesInput{RoleName: aws.String(roleName)}
+	for {
+		output, err := checker.iamClient.ListRolePolicies(listInput)
+		if err != nil {
+			return nil, err
+		}
+		for _, policyName := range output.PolicyNames {
+			policy, err := checker.iamClient.GetRolePolicy(&iam.GetRolePolicyInput{
+				RoleName:   aws.String(roleName),
+				PolicyName: policyName,
+			})
+			if err != nil {
+				return nil, err
+			}
+			document, err := url.QueryUnescape(aws.StringValue(policy.PolicyDocument))
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, document)
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			break
+		}
+		listInput.Marker = output.Marker
+	}
+
+	listAttachedInput := &iam.ListAttachedRolePoliciesInput{RoleName: aws.String(roleName)}
+	for {
+		output, err := checker.iamClient.ListAttachedRolePolicies(listAttachedInput)
+		if err != nil {
+			return nil, err
+		}
+		for _, attachedPolicy := range output.AttachedPolicies {
+			document, err := checker.managedPolicy(aws.StringValue(attachedPolicy.PolicyArn))
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, document)
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			break
+		}
+		listAttachedInput.Marker = output.Marker
+	}
+	return policies, nil
+}
+
+// managedPolicy returns the document of the default version of the managed policy
+func (checker *PermissionsBoundaryChecker) managedPolicy(policyARN string) (string, error) {
+	policy, err := checker.iamClient.GetPolicy(&iam.GetPolicyInput{PolicyArn: aws.String(policyARN)})
+	if err != nil {
+		return "", err
+	}
+	if policy.Policy == nil {
+		return "", fmt.Errorf("no policy returned for %s", policyARN)
+	}
+	version, err := checker.iamClient.GetPolicyVersion(&iam.GetPolicyVersionInput{
+		PolicyArn: aws.String(policyARN),
+		VersionId: policy.Policy.DefaultVersionId,
+	})
+	if err != nil {
+		return "", err
+	}
+	if version.PolicyVersion == nil {
+		return "", fmt.Errorf("no default version returned for %s", policyARN)
+	}
+	return url.QueryUnescape(aws.StringValue(version.PolicyVersion.Document))
+}
+
+// roleNameFromARN returns the name of the role from its ARN, e.g. "role" for
+// arn:aws:iam::123456789012:role/path/role
+func roleNameFromARN(roleARN string) string {
+	return roleARN[strings.LastIndex(roleARN, "/")+1:]
+}
+
+// policyDocument is an IAM policy document, its statement is either a single
+// statement or a list of them
+type policyDocument struct {
+	Version   string          `json:"Version,omitempty"`
+	Statement json.RawMessage `json:"Statement"`
+}
+
+// policyStatement holds the fields of a statement used to find the allowed actions
+type policyStatement struct {
+	Effect string          `json:"Effect"`
+	Action json.RawMessage `json:"Action,omitempty"`
+}
+
+// statements returns the statements of the policy document
+func statements(document string) ([]json.RawMessage, error) {
+	var policy policyDocument
+	if err := json.Unmarshal([]byte(document), &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy document: %v", err)
+	}
+	return rawList(policy.Statement)
+}
+
+// rawList returns the elements of a JSON value that is either a single element
+// or a list of them
+func rawList(value json.RawMessage) ([]json.RawMessage, error) {
+	trimmed := strings.TrimSpace(string(value))
+	if trimmed == "" || trimmed == "null" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(trimmed, "[") {
+		return []json.RawMessage{value}, nil
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(value, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// allowedActions returns the sorted actions allowed by the statements of the
+// policy documents
+func allowedActions(documents []string) ([]string, error) {
+	actions := map[string]struct{}{}
+	for _, document := range documents {
+		policyStatements, err := statements(document)
+		if err != nil {
+			return nil, err
+		}
+		for _, rawStatement := range policyStatements {
+			var statement policyStatement
+			if err := json.Unmarshal(rawStatement, &statement); err != nil {
+				return nil, fmt.Errorf("invalid policy statement: %v", err)
+			}
+			if statement.Effect != "Allow" {
+				continue
+			}
+			rawActions, err := rawList(statement.Action)
+			if err != nil {
+				return nil, fmt.Errorf("invalid policy statement action: %v", err)
+			}
+			for _, rawAction := range rawActions {
+				var action string
+				if err := json.Unmarshal(rawAction, &action); err != nil {
+					return nil, fmt.Errorf("invalid policy statement action: %v", err)
+				}
+				actions[action] = struct{}{}
+			}
+		}
+	}
+	return sortedKeys(actions), nil
+}
+
+// mergePolicies returns a policy document with the statements of all of the
+// policy documents
+func mergePolicies(documents []string) (string, error) {
+	merged := []json.RawMessage{}
+	for _, document := range documents {
+		policyStatements, err := statements(document)
+		if err != nil {
+			return "", err
+		}
+		merged = append(merged, policyStatements...)
+	}
+	mergedStatements, err := json.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	document, err := json.Marshal(policyDocument{Version: policyDocumentVersion, Statement: mergedStatements})
+	if err != nil {
+		return "", err
+	}
+	return string(document), nil
+}
+
+// sortedKeys returns the keys of the set in order
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
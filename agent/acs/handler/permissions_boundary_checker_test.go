@@ -0,0 +1,219 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	mock_ec2 "github.com/aws/amazon-ecs-agent/agent/ec2/mocks"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testInstanceRoleName = "ecsInstanceRole"
+	testTaskRoleARN      = "arn:aws:iam::123456789012:role/path/taskRole"
+	testManagedPolicyARN = "arn:aws:iam::123456789012:policy/taskPolicy"
+)
+
+// fakeIAM serves the policies of the roles, and simulates the permissions
+// boundary by allowing the actions that its statements mention
+type fakeIAM struct {
+	inlinePolicies  map[string]map[string]string
+	managedPolicies map[string]map[string]string
+	simulations     []*iam.SimulateCustomPolicyInput
+	err             error
+}
+
+func (client *fakeIAM) ListRolePolicies(input *iam.ListRolePoliciesInput) (*iam.ListRolePoliciesOutput, error) {
+	if client.err != nil {
+		return nil, client.err
+	}
+	output := &iam.ListRolePoliciesOutput{}
+	for name := range client.inlinePolicies[aws.StringValue(input.RoleName)] {
+		output.PolicyNames = append(output.PolicyNames, aws.String(name))
+	}
+	return output, nil
+}
+
+func (client *fakeIAM) GetRolePolicy(input *iam.GetRolePolicyInput) (*iam.GetRolePolicyOutput, error) {
+	document := client.inlinePolicies[aws.StringValue(input.RoleName)][aws.StringValue(input.PolicyName)]
+	return &iam.GetRolePolicyOutput{PolicyDocument: aws.String(url.QueryEscape(document))}, nil
+}
+
+func (client *fakeIAM) ListAttachedRolePolicies(input *iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error) {
+	output := &iam.ListAttachedRolePoliciesOutput{}
+	for policyARN := range client.managedPolicies[aws.StringValue(input.RoleName)] {
+		output.AttachedPolicies = append(output.AttachedPolicies, &iam.AttachedPolicy{PolicyArn: aws.String(policyARN)})
+	}
+	return output, nil
+}
+
+func (client *fakeIAM) GetPolicy(input *iam.GetPolicyInput) (*iam.GetPolicyOutput, error) {
+	return &iam.GetPolicyOutput{Policy: &iam.Policy{Arn: input.PolicyArn, DefaultVersionId: aws.String("v2")}}, nil
+}
+
+func (client *fakeIAM) GetPolicyVersion(input *iam.GetPolicyVersionInput) (*iam.GetPolicyVersionOutput, error) {
+	if aws.StringValue(input.VersionId) != "v2" {
+		return nil, errors.New("NoSuchEntity: not the default version")
+	}
+	for _, policies := range client.managedPolicies {
+		if document, ok := policies[aws.StringValue(input.PolicyArn)]; ok {
+			return &iam.GetPolicyVersionOutput{PolicyVersion: &iam.PolicyVersion{
+				Document: aws.String(url.QueryEscape(document)),
+			}}, nil
+		}
+	}
+	return nil, errors.New("NoSuchEntity: no such policy")
+}
+
+func (client *fakeIAM) SimulateCustomPolicy(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	client.simulations = append(client.simulations, input)
+	boundary := aws.StringValue(input.PermissionsBoundaryPolicyInputList[0])
+	output := &iam.SimulatePolicyResponse{}
+	for _, action := range input.ActionNames {
+		output.EvaluationResults = append(output.EvaluationResults, &iam.EvaluationResult{
+			EvalActionName: action,
+			PermissionsBoundaryDecisionDetail: &iam.PermissionsBoundaryDecisionDetail{
+				AllowedByPermissionsBoundary: aws.Bool(strings.Contains(boundary, `"`+aws.StringValue(action)+`"`)),
+			},
+		})
+	}
+	return output, nil
+}
+
+// newFakeIAM returns a fakeIAM where the instance role allows reading from S3
+// and SQS, and the task role allows the actions
+func newFakeIAM(taskRoleActions ...string) *fakeIAM {
+	actions := `"` + strings.Join(taskRoleActions, `","`) + `"`
+	return &fakeIAM{
+		inlinePolicies: map[string]map[string]string{
+			testInstanceRoleName: {
+				"s3": `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"}}`,
+			},
+			"taskRole": {
+				"inline": `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":[` + actions + `],"Resource":"*"},` +
+					`{"Effect":"Deny","Action":"iam:PassRole","Resource":"*"}]}`,
+			},
+		},
+		managedPolicies: map[string]map[string]string{
+			testInstanceRoleName: {
+				"arn:aws:iam::123456789012:policy/sqs": `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["sqs:ReceiveMessage"],"Resource":"*"}]}`,
+			},
+			"taskRole": {
+				testManagedPolicyARN: `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sqs:ReceiveMessage","Resource":"*"}]}`,
+			},
+		},
+	}
+}
+
+func newTestPermissionsBoundaryChecker(t *testing.T, iamClient iamSDK, cacheTTL time.Duration) *PermissionsBoundaryChecker {
+	ctrl := gomock.NewController(t)
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().GetMetadata(ec2.SecurityCrednetialsResource).Return(testInstanceRoleName+"\n", nil).AnyTimes()
+	return newPermissionsBoundaryCheckerWithClient(iamClient, ec2MetadataClient, cacheTTL)
+}
+
+func TestPermissionsBoundaryCheckerWithinBoundary(t *testing.T) {
+	iamClient := newFakeIAM("s3:GetObject")
+	checker := newTestPermissionsBoundaryChecker(t, iamClient, time.Minute)
+
+	assert.NoError(t, checker.check(testTaskRoleARN))
+	require.Len(t, iamClient.simulations, 1)
+	simulation := iamClient.simulations[0]
+	assert.Equal(t, []string{"s3:GetObject", "sqs:ReceiveMessage"}, aws.StringValueSlice(simulation.ActionNames))
+	assert.Len(t, simulation.PolicyInputList, 2)
+	boundary := aws.StringValue(simulation.PermissionsBoundaryPolicyInputList[0])
+	assert.Equal(t, `{"Version":"2012-10-17","Statement":[`+
+		`{"Effect":"Allow","Action":"s3:GetObject","Resource":"*"},`+
+		`{"Effect":"Allow","Action":["sqs:ReceiveMessage"],"Resource":"*"}]}`, boundary)
+}
+
+func TestPermissionsBoundaryCheckerOutOfBoundary(t *testing.T) {
+	iamClient := newFakeIAM("s3:GetObject", "s3:PutObject", "dynamodb:GetItem")
+	checker := newTestPermissionsBoundaryChecker(t, iamClient, time.Minute)
+
+	err := checker.check(testTaskRoleARN)
+	require.IsType(t, PermissionsBoundaryError{}, err)
+	assert.Equal(t, []string{"dynamodb:GetItem", "s3:PutObject"}, err.(PermissionsBoundaryError).actions)
+	assert.Contains(t, err.Error(), testTaskRoleARN)
+	assert.False(t, err.(PermissionsBoundaryError).Retry())
+}
+
+func TestPermissionsBoundaryCheckerCachesResults(t *testing.T) {
+	iamClient := newFakeIAM("s3:PutObject")
+	checker := newTestPermissionsBoundaryChecker(t, iamClient, 50*time.Millisecond)
+
+	assert.Error(t, checker.check(testTaskRoleARN))
+	assert.Error(t, checker.check(testTaskRoleARN))
+	assert.Len(t, iamClient.simulations, 1, "the result should be cached")
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Error(t, checker.check(testTaskRoleARN))
+	assert.Len(t, iamClient.simulations, 2, "the result should be checked again once expired")
+}
+
+func TestPermissionsBoundaryCheckerIAMError(t *testing.T) {
+	iamClient := newFakeIAM("s3:PutObject")
+	iamClient.err = errors.New("AccessDenied: not authorized to perform iam:ListRolePolicies")
+	checker := newTestPermissionsBoundaryChecker(t, iamClient, time.Minute)
+
+	assert.NoError(t, checker.check(testTaskRoleARN), "the role should be assumed within the boundary")
+
+	// The failure isn't cached
+	iamClient.err = nil
+	assert.Error(t, checker.check(testTaskRoleARN))
+}
+
+func TestPermissionsBoundaryCheckerDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+
+	checker := newPermissionsBoundaryChecker(&config.Config{ACSIAMPrecheck: false}, nil, ec2MetadataClient)
+	assert.Nil(t, checker)
+	assert.NoError(t, checker.check(testTaskRoleARN))
+	assert.NotNil(t, newPermissionsBoundaryChecker(&config.Config{ACSIAMPrecheck: true, AWSRegion: "us-west-2"},
+		nil, ec2MetadataClient))
+}
+
+func TestAllowedActions(t *testing.T) {
+	actions, err := allowedActions([]string{
+		`{"Statement":{"Effect":"Allow","Action":"ecr:GetAuthorizationToken"}}`,
+		`{"Statement":[{"Effect":"Allow","Action":["s3:GetObject","ecr:GetAuthorizationToken"]},{"Effect":"Deny","Action":"s3:DeleteObject"}]}`,
+		`{"Statement":[{"Effect":"Allow","NotAction":"iam:*"}]}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ecr:GetAuthorizationToken", "s3:GetObject"}, actions)
+
+	_, err = allowedActions([]string{`not a policy`})
+	assert.Error(t, err)
+}
+
+func TestRoleNameFromARN(t *testing.T) {
+	assert.Equal(t, "taskRole", roleNameFromARN(testTaskRoleARN))
+	assert.Equal(t, "taskRole", roleNameFromARN("arn:aws:iam::123456789012:role/taskRole"))
+}
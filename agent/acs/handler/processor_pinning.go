@@ -0,0 +1,125 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/cihub/seelog"
+)
+
+// maxAffinityCPUs is the number of CPUs an affinity mask can hold, the size of
+// the kernel cpu_set_t
+const maxAffinityCPUs = 1024
+
+// affinitySyscalls wraps the system calls pinning threads to CPUs
+type affinitySyscalls interface {
+	// setThreadAffinity pins the calling OS thread to the CPUs of the mask
+	setThreadAffinity(mask []uint64) error
+}
+
+// ProcessorPinning pins ACS handler goroutines to the CPUs configured with
+// ACSProcessorAffinity, so that on large NUMA hosts they are not scheduled across
+// NUMA nodes, which increases their memory access latency.
+//
+// Like with handlerCgroup, the goroutine is locked to its OS thread and the
+// affinity of that thread is set, the affinity of the other threads of the agent
+// is left untouched.
+type ProcessorPinning struct {
+	cpuList  string
+	mask     []uint64
+	syscalls affinitySyscalls
+}
+
+// newProcessorPinning returns a new ProcessorPinning object, or nil if no CPUs
+// are configured or the CPU list is invalid
+func newProcessorPinning(cpuList string) *ProcessorPinning {
+	if cpuList == "" {
+		return nil
+	}
+	mask, err := AffinityMask(cpuList)
+	if err != nil {
+		seelog.Warnf("Invalid ACS processor affinity %q, ACS handlers won't be pinned: %v", cpuList, err)
+		return nil
+	}
+	return &ProcessorPinning{
+		cpuList:  cpuList,
+		mask:     mask,
+		syscalls: newAffinitySyscalls(),
+	}
+}
+
+// run invokes fn pinned to the CPUs. It is meant to be called as the body of a
+// long running handler goroutine: the OS thread is not unlocked when fn returns,
+// which makes the runtime terminate the thread instead of handing a pinned
+// thread over to other goroutines
+func (pinning *ProcessorPinning) run(name string, fn func()) {
+	if pinning == nil {
+		fn()
+		return
+	}
+
+	runtime.LockOSThread()
+	if err := pinning.syscalls.setThreadAffinity(pinning.mask); err != nil {
+		seelog.Warnf("Unable to pin the %s to CPUs %s, it will run on any CPU: %v", name, pinning.cpuList, err)
+		runtime.UnlockOSThread()
+	}
+	fn()
+}
+
+// AffinityMask converts a list of CPUs in the cpuset list syntax, such as 0-3,8,
+// to a bitmask of 64 bit words, CPU n being bit n%64 of word n/64 as in the
+// kernel cpu_set_t
+func AffinityMask(cpuList string) ([]uint64, error) {
+	var mask []uint64
+	for _, item := range strings.Split(cpuList, ",") {
+		item = strings.TrimSpace(item)
+		bounds := strings.SplitN(item, "-", 2)
+		first, err := parseCPU(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseCPU(bounds[1]); err != nil {
+				return nil, err
+			}
+			if last < first {
+				return nil, fmt.Errorf("invalid CPU range %q", item)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			for len(mask) <= cpu/64 {
+				mask = append(mask, 0)
+			}
+			mask[cpu/64] |= 1 << uint(cpu%64)
+		}
+	}
+	return mask, nil
+}
+
+// parseCPU parses the number of a CPU of a CPU list
+func parseCPU(cpu string) (int, error) {
+	number, err := strconv.Atoi(strings.TrimSpace(cpu))
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid CPU %q", cpu)
+	}
+	if number >= maxAffinityCPUs {
+		return 0, fmt.Errorf("CPU %d is above the maximum of %d CPUs", number, maxAffinityCPUs)
+	}
+	return number, nil
+}
@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import "golang.org/x/sys/unix"
+
+// linuxAffinitySyscalls implements affinitySyscalls with sched_setaffinity
+type linuxAffinitySyscalls struct{}
+
+// newAffinitySyscalls returns the affinitySyscalls of the platform
+func newAffinitySyscalls() affinitySyscalls {
+	return linuxAffinitySyscalls{}
+}
+
+func (linuxAffinitySyscalls) setThreadAffinity(mask []uint64) error {
+	var set unix.CPUSet
+	set.Zero()
+	for word, bits := range mask {
+		for bit := 0; bit < 64; bit++ {
+			if bits&(1<<uint(bit)) != 0 {
+				set.Set(word*64 + bit)
+			}
+		}
+	}
+	// A pid of 0 is the calling thread
+	return unix.SchedSetaffinity(0, &set)
+}
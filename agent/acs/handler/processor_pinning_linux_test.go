@@ -0,0 +1,54 @@
+//go:build linux && unit
+// +build linux,unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestProcessorPinningRunPinsThread(t *testing.T) {
+	var allowed unix.CPUSet
+	require.NoError(t, unix.SchedGetaffinity(0, &allowed))
+	cpu := -1
+	for i := 0; i < maxAffinityCPUs; i++ {
+		if allowed.IsSet(i) {
+			cpu = i
+			break
+		}
+	}
+	require.NotEqual(t, -1, cpu)
+
+	pinned := make(chan unix.CPUSet, 1)
+	go newProcessorPinning(strconv.Itoa(cpu)).run("test handler", func() {
+		var set unix.CPUSet
+		assert.NoError(t, unix.SchedGetaffinity(0, &set))
+		pinned <- set
+	})
+	set := <-pinned
+	assert.Equal(t, 1, set.Count())
+	assert.True(t, set.IsSet(cpu))
+
+	// The other threads are not pinned
+	var current unix.CPUSet
+	require.NoError(t, unix.SchedGetaffinity(0, &current))
+	assert.Equal(t, allowed.Count(), current.Count())
+}
@@ -0,0 +1,109 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAffinitySyscalls records the masks the threads are pinned to
+type fakeAffinitySyscalls struct {
+	masks [][]uint64
+	err   error
+}
+
+func (syscalls *fakeAffinitySyscalls) setThreadAffinity(mask []uint64) error {
+	syscalls.masks = append(syscalls.masks, mask)
+	return syscalls.err
+}
+
+func TestAffinityMask(t *testing.T) {
+	testCases := []struct {
+		cpuList  string
+		expected []uint64
+	}{
+		{"0", []uint64{0x1}},
+		{"0-3,8", []uint64{0x10f}},
+		{" 2 , 4-5 ", []uint64{0x34}},
+		{"3-3", []uint64{0x8}},
+		{"63-64", []uint64{1 << 63, 0x1}},
+		{"130", []uint64{0, 0, 0x4}},
+		{"1023", append(make([]uint64, 15), 1<<63)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.cpuList, func(t *testing.T) {
+			mask, err := AffinityMask(tc.cpuList)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, mask)
+		})
+	}
+}
+
+func TestAffinityMaskInvalid(t *testing.T) {
+	for _, cpuList := range []string{"", "a", "0-", "-1", "3-1", "0,,1", "1-2-3", "1024", "0-1024"} {
+		t.Run(cpuList, func(t *testing.T) {
+			_, err := AffinityMask(cpuList)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewProcessorPinning(t *testing.T) {
+	assert.Nil(t, newProcessorPinning(""), "pinning shouldn't be enabled without CPUs")
+	assert.Nil(t, newProcessorPinning("0-a"), "pinning shouldn't be enabled with an invalid CPU list")
+
+	pinning := newProcessorPinning("0-3,8")
+	require.NotNil(t, pinning)
+	assert.Equal(t, []uint64{0x10f}, pinning.mask)
+}
+
+func TestProcessorPinningRun(t *testing.T) {
+	syscalls := &fakeAffinitySyscalls{}
+	pinning := &ProcessorPinning{cpuList: "0-3,8", mask: []uint64{0x10f}, syscalls: syscalls}
+
+	ran := make(chan struct{})
+	go pinning.run("test handler", func() {
+		close(ran)
+	})
+	<-ran
+	assert.Equal(t, [][]uint64{{0x10f}}, syscalls.masks)
+}
+
+func TestProcessorPinningRunAffinityError(t *testing.T) {
+	syscalls := &fakeAffinitySyscalls{err: errors.New("invalid argument")}
+	pinning := &ProcessorPinning{cpuList: "64", mask: []uint64{0, 0x1}, syscalls: syscalls}
+
+	ran := make(chan struct{})
+	go pinning.run("test handler", func() {
+		close(ran)
+	})
+	<-ran
+	assert.Len(t, syscalls.masks, 1, "the handler should run unpinned")
+}
+
+func TestProcessorPinningRunNotConfigured(t *testing.T) {
+	var pinning *ProcessorPinning
+	ran := false
+	pinning.run("test handler", func() {
+		ran = true
+	})
+	assert.True(t, ran)
+}
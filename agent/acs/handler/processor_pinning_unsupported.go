@@ -0,0 +1,32 @@
+//go:build !linux
+// +build !linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import "errors"
+
+// unsupportedAffinitySyscalls implements affinitySyscalls on platforms where
+// threads can't be pinned to CPUs
+type unsupportedAffinitySyscalls struct{}
+
+// newAffinitySyscalls returns the affinitySyscalls of the platform
+func newAffinitySyscalls() affinitySyscalls {
+	return unsupportedAffinitySyscalls{}
+}
+
+func (unsupportedAffinitySyscalls) setThreadAffinity(mask []uint64) error {
+	return errors.New("processor pinning is only supported on linux")
+}
@@ -0,0 +1,122 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// minACSProtocolVersion is the lowest version of the ACS protocol the
+	// agent downgrades to
+	minACSProtocolVersion = 1
+	// protocolVersionUnsupportedExceptionPrefix is the prefix of the error
+	// returned when ACS rejects the version of the protocol of the connection
+	protocolVersionUnsupportedExceptionPrefix = "ProtocolVersionUnsupportedException:"
+)
+
+// ProtocolMismatchRecovery negotiates the version of the ACS protocol with ACS.
+// The agent connects with the latest version it supports, and ACS rejects the
+// connection with a ProtocolVersionUnsupportedException if it doesn't support
+// it, e.g. in a region where ACS isn't upgraded yet. The version is then
+// downgraded one step at a time until ACS accepts it. The version of the last
+// successful connection is persisted, so that neither reconnects nor agent
+// restarts negotiate it again
+type ProtocolMismatchRecovery struct {
+	lock       sync.RWMutex
+	dataClient data.Client
+	version    int
+	// savedVersion is the version persisted in the data client, 0 if none
+	savedVersion int
+}
+
+// newProtocolMismatchRecovery returns a new ProtocolMismatchRecovery object,
+// starting with the version of the last successful connection if it's
+// persisted, or with the latest version otherwise
+func newProtocolMismatchRecovery(dataClient data.Client) *ProtocolMismatchRecovery {
+	recovery := &ProtocolMismatchRecovery{
+		dataClient: dataClient,
+		version:    acsProtocolVersion,
+	}
+	if dataClient == nil {
+		return recovery
+	}
+	value, err := dataClient.GetMetadata(data.ACSProtocolVersionKey)
+	if err != nil || value == "" {
+		return recovery
+	}
+	version, err := strconv.Atoi(value)
+	// A version saved by a newer agent is not supported by this one
+	if err != nil || version < minACSProtocolVersion || version > acsProtocolVersion {
+		seelog.Warnf("Ignoring the invalid saved ACS protocol version: %s", value)
+		return recovery
+	}
+	recovery.version = version
+	recovery.savedVersion = version
+	return recovery
+}
+
+// protocolVersion returns the version of the ACS protocol to connect with
+func (recovery *ProtocolMismatchRecovery) protocolVersion() int {
+	if recovery == nil {
+		return acsProtocolVersion
+	}
+	recovery.lock.RLock()
+	defer recovery.lock.RUnlock()
+	return recovery.version
+}
+
+// downgrade lowers the version of the ACS protocol after ACS rejected the
+// current one. It returns false if the version is already the lowest one
+func (recovery *ProtocolMismatchRecovery) downgrade() bool {
+	if recovery == nil {
+		return false
+	}
+	recovery.lock.Lock()
+	defer recovery.lock.Unlock()
+	if recovery.version <= minACSProtocolVersion {
+		return false
+	}
+	recovery.version--
+	return true
+}
+
+// connected persists the version of the ACS protocol once a connection with
+// it succeeded, if it differs from the persisted one
+func (recovery *ProtocolMismatchRecovery) connected() {
+	if recovery == nil || recovery.dataClient == nil {
+		return
+	}
+	recovery.lock.Lock()
+	defer recovery.lock.Unlock()
+	if recovery.version == recovery.savedVersion {
+		return
+	}
+	if err := recovery.dataClient.SaveMetadata(data.ACSProtocolVersionKey, strconv.Itoa(recovery.version)); err != nil {
+		seelog.Warnf("Unable to save the ACS protocol version: %v", err)
+		return
+	}
+	recovery.savedVersion = recovery.version
+}
+
+// isProtocolVersionUnsupportedError returns true if ACS rejected the connection
+// because it doesn't support the version of the protocol
+func isProtocolVersionUnsupportedError(acsError error) bool {
+	return acsError != nil && strings.HasPrefix(acsError.Error(), protocolVersionUnsupportedExceptionPrefix)
+}
@@ -0,0 +1,175 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	mock_api "github.com/aws/amazon-ecs-agent/agent/api/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	mock_retry "github.com/aws/amazon-ecs-agent/agent/utils/retry/mock"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errProtocolVersionUnsupported = errors.New("ProtocolVersionUnsupportedException: protocol version not supported")
+
+func TestProtocolMismatchRecoveryDefaultVersion(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	assert.Equal(t, acsProtocolVersion, newProtocolMismatchRecovery(dataClient).protocolVersion())
+	assert.Equal(t, acsProtocolVersion, newProtocolMismatchRecovery(nil).protocolVersion())
+}
+
+func TestProtocolMismatchRecoveryLoadsSavedVersion(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	require.NoError(t, dataClient.SaveMetadata(data.ACSProtocolVersionKey, "1"))
+	assert.Equal(t, 1, newProtocolMismatchRecovery(dataClient).protocolVersion())
+}
+
+func TestProtocolMismatchRecoveryIgnoresInvalidSavedVersion(t *testing.T) {
+	for _, saved := range []string{"invalid", "0", strconv.Itoa(acsProtocolVersion + 1)} {
+		t.Run(saved, func(t *testing.T) {
+			dataClient, cleanup := newTestDataClient(t)
+			defer cleanup()
+
+			require.NoError(t, dataClient.SaveMetadata(data.ACSProtocolVersionKey, saved))
+			assert.Equal(t, acsProtocolVersion, newProtocolMismatchRecovery(dataClient).protocolVersion())
+		})
+	}
+}
+
+func TestProtocolMismatchRecoveryDowngradeStopsAtMinimum(t *testing.T) {
+	recovery := newProtocolMismatchRecovery(nil)
+	for version := acsProtocolVersion - 1; version >= minACSProtocolVersion; version-- {
+		assert.True(t, recovery.downgrade())
+		assert.Equal(t, version, recovery.protocolVersion())
+	}
+	assert.False(t, recovery.downgrade())
+	assert.Equal(t, minACSProtocolVersion, recovery.protocolVersion())
+}
+
+func TestProtocolMismatchRecoveryConnectedSavesVersion(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	recovery := newProtocolMismatchRecovery(dataClient)
+	recovery.connected()
+	saved, err := dataClient.GetMetadata(data.ACSProtocolVersionKey)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(acsProtocolVersion), saved)
+
+	require.True(t, recovery.downgrade())
+	recovery.connected()
+	saved, err = dataClient.GetMetadata(data.ACSProtocolVersionKey)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(acsProtocolVersion-1), saved)
+	assert.Equal(t, acsProtocolVersion-1, newProtocolMismatchRecovery(dataClient).protocolVersion())
+}
+
+func TestNilProtocolMismatchRecovery(t *testing.T) {
+	var recovery *ProtocolMismatchRecovery
+	assert.Equal(t, acsProtocolVersion, recovery.protocolVersion())
+	assert.False(t, recovery.downgrade())
+	recovery.connected()
+}
+
+func TestIsProtocolVersionUnsupportedError(t *testing.T) {
+	assert.True(t, isProtocolVersionUnsupportedError(errProtocolVersionUnsupported))
+	assert.False(t, isProtocolVersionUnsupportedError(errors.New("InactiveInstanceException: inactive")))
+	assert.False(t, isProtocolVersionUnsupportedError(nil))
+}
+
+// TestHandlerDowngradesProtocolVersion tests if the session handler reconnects
+// right away with the previous version of the protocol when ACS rejects the
+// current one, and persists the version accepted by ACS
+func TestHandlerDowngradesProtocolVersion(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ecsClient.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(acsURL, nil).Times(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("DeregisterContainerInstance", ctx)
+	deregisterInstanceEventStream.StartListening()
+
+	// The retry with the previous version doesn't wait for the backoff
+	mockBackoff := mock_retry.NewMockBackoff(ctrl)
+	mockBackoff.EXPECT().Reset().AnyTimes()
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().Close().Return(nil).AnyTimes()
+	gomock.InOrder(
+		mockWsClient.EXPECT().Connect().Return(errProtocolVersionUnsupported),
+		mockWsClient.EXPECT().Connect().Return(nil),
+		mockWsClient.EXPECT().Serve().Do(func() {
+			cancel()
+		}).Return(io.EOF),
+	)
+	resources := &urlRecordingSessionResources{mockSessionResources: mockSessionResources{mockWsClient}}
+	acsSession := session{
+		containerInstanceARN:          "myArn",
+		credentialsProvider:           testCreds,
+		agentConfig:                   testConfig,
+		taskEngine:                    taskEngine,
+		ecsClient:                     ecsClient,
+		deregisterInstanceEventStream: deregisterInstanceEventStream,
+		dataClient:                    dataClient,
+		taskHandler:                   taskHandler,
+		backoff:                       mockBackoff,
+		ctx:                           ctx,
+		cancel:                        cancel,
+		resources:                     resources,
+		protocolMismatchRecovery:      newProtocolMismatchRecovery(dataClient),
+		_heartbeatTimeout:             20 * time.Millisecond,
+		_heartbeatJitter:              10 * time.Millisecond,
+	}
+	acsSession.Start()
+
+	versions := []string{}
+	for _, rawURL := range resources.urls {
+		parsed, err := url.Parse(rawURL)
+		require.NoError(t, err)
+		versions = append(versions, parsed.Query().Get("protocolVersion"))
+	}
+	assert.Equal(t, []string{strconv.Itoa(acsProtocolVersion), strconv.Itoa(acsProtocolVersion - 1)}, versions)
+	saved, err := dataClient.GetMetadata(data.ACSProtocolVersionKey)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(acsProtocolVersion-1), saved)
+}
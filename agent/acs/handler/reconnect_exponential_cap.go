@@ -0,0 +1,70 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils/retry"
+)
+
+// ReconnectExponentialCap bounds the delays before reconnecting to ACS. The
+// exponential backoff caps its own delays, but the jitter it adds, the ARN hash
+// jitter and the reconnect stagger are applied on top of them, and the delay
+// of inactive instances bypasses the backoff entirely. The cap is applied to
+// the final delay instead. Delays above the cap are spread over the last
+// connectionBackoffJitter of the range below it, so that the agents that hit
+// the cap don't all reconnect at the same time
+type ReconnectExponentialCap struct {
+	// active is the maximum delay after unexpected disconnections
+	active time.Duration
+	// inactive is the maximum delay when the container instance is inactive
+	inactive time.Duration
+}
+
+// newReconnectExponentialCap returns a new ReconnectExponentialCap capping all
+// the delays at maxInterval, or at the default maximums if maxInterval isn't
+// positive
+func newReconnectExponentialCap(maxInterval time.Duration) *ReconnectExponentialCap {
+	if maxInterval <= 0 {
+		return &ReconnectExponentialCap{
+			active:   connectionBackoffMax,
+			inactive: inactiveInstanceReconnectDelay,
+		}
+	}
+	return &ReconnectExponentialCap{
+		active:   maxInterval,
+		inactive: maxInterval,
+	}
+}
+
+// clamp returns the delay within 0 and the maximum delay. The default maximums
+// are applied if the cap is nil
+func (reconnectCap *ReconnectExponentialCap) clamp(delay time.Duration, isInactiveInstance bool) time.Duration {
+	if reconnectCap == nil {
+		reconnectCap = newReconnectExponentialCap(0)
+	}
+	maxDelay := reconnectCap.active
+	if isInactiveInstance {
+		maxDelay = reconnectCap.inactive
+	}
+	if delay < 0 {
+		return 0
+	}
+	if delay <= maxDelay {
+		return delay
+	}
+	jitter := time.Duration(float64(maxDelay) * connectionBackoffJitter)
+	return retry.AddJitter(maxDelay-jitter, jitter)
+}
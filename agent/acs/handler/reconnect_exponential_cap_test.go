@@ -0,0 +1,121 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils/retry"
+	mock_retry "github.com/aws/amazon-ecs-agent/agent/utils/retry/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconnectExponentialCapDefaults(t *testing.T) {
+	reconnectCap := newReconnectExponentialCap(0)
+	assert.Equal(t, time.Second, reconnectCap.clamp(time.Second, false))
+	assert.Zero(t, reconnectCap.clamp(-time.Second, false))
+
+	delay := reconnectCap.clamp(10*connectionBackoffMax, false)
+	assert.True(t, delay <= connectionBackoffMax, "the delay %s should be capped at %s", delay, connectionBackoffMax)
+	assert.True(t, delay >= connectionBackoffMax-time.Duration(float64(connectionBackoffMax)*connectionBackoffJitter))
+
+	assert.Equal(t, inactiveInstanceReconnectDelay, reconnectCap.clamp(inactiveInstanceReconnectDelay, true))
+	assert.True(t, reconnectCap.clamp(2*inactiveInstanceReconnectDelay, true) <= inactiveInstanceReconnectDelay)
+
+	var nilCap *ReconnectExponentialCap
+	assert.True(t, nilCap.clamp(10*connectionBackoffMax, false) <= connectionBackoffMax,
+		"the default cap should be applied if the session has none")
+}
+
+func TestReconnectExponentialCapMaxInterval(t *testing.T) {
+	reconnectCap := newReconnectExponentialCap(30 * time.Second)
+	assert.True(t, reconnectCap.clamp(connectionBackoffMax, false) <= 30*time.Second)
+	assert.True(t, reconnectCap.clamp(inactiveInstanceReconnectDelay, true) <= 30*time.Second)
+}
+
+// TestComputeReconnectDelayCapsInactiveInstanceDelay tests if the delay of an
+// inactive instance is capped by the configured maximum
+func TestComputeReconnectDelayCapsInactiveInstanceDelay(t *testing.T) {
+	acsSession := session{
+		_inactiveInstanceReconnectDelay: inactiveInstanceReconnectDelay,
+		reconnectCap:                    newReconnectExponentialCap(10 * time.Minute),
+	}
+	assert.True(t, acsSession.computeReconnectDelay(true) <= 10*time.Minute)
+}
+
+func TestComputeReconnectDelayCapsBackoff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockBackoff := mock_retry.NewMockBackoff(ctrl)
+	mockBackoff.EXPECT().Duration().Return(3 * connectionBackoffMax)
+
+	acsSession := session{backoff: mockBackoff, reconnectCap: newReconnectExponentialCap(0)}
+	assert.True(t, acsSession.computeReconnectDelay(false) <= connectionBackoffMax)
+}
+
+// reconnectErrors are the errors a session may end with, picked by the fuzzed
+// input of FuzzComputeReconnectDelay
+var reconnectErrors = []error{
+	io.EOF,
+	errReauthenticate,
+	fmt.Errorf("InactiveInstanceException: "),
+	errors.New("connection reset by peer"),
+	errors.New("i/o timeout"),
+}
+
+// FuzzComputeReconnectDelay drives arbitrary sequences of session errors through
+// the reconnect delay computation of a session set up like NewSession does, and
+// checks that the delays stay within the bounds of the cap
+func FuzzComputeReconnectDelay(f *testing.F) {
+	f.Add([]byte{3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3}, int64(0), 0)
+	f.Add([]byte{2, 3, 2, 4, 0, 4, 4, 4, 1, 2}, int64(time.Minute), 5)
+	f.Add([]byte{4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4}, int64(time.Second), 1000)
+	f.Fuzz(func(t *testing.T, sequence []byte, maxInterval int64, slot int) {
+		if slot < 0 || slot > 1000 {
+			t.Skip()
+		}
+		reconnectCap := newReconnectExponentialCap(time.Duration(maxInterval))
+		acsSession := session{
+			backoff: newACSReconnectStagger(newARNHashJitter(retry.NewExponentialBackoff(connectionBackoffMin,
+				connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier), "myArn"),
+				slot, 500*time.Millisecond),
+			reconnectCap:                    reconnectCap,
+			_inactiveInstanceReconnectDelay: inactiveInstanceReconnectDelay,
+		}
+		for _, b := range sequence {
+			acsError := reconnectErrors[int(b)%len(reconnectErrors)]
+			if shouldReconnectWithoutBackoff(acsError) {
+				acsSession.backoff.Reset()
+				continue
+			}
+			isInactiveInstance := isInactiveInstanceError(acsError)
+			maxDelay := reconnectCap.active
+			if isInactiveInstance {
+				maxDelay = reconnectCap.inactive
+			}
+			delay := acsSession.computeReconnectDelay(isInactiveInstance)
+			if delay < 0 || delay > maxDelay {
+				t.Fatalf("reconnect delay %s after %v out of the [0, %s] bounds", delay, acsError, maxDelay)
+			}
+		}
+	})
+}
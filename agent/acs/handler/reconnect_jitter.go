@@ -0,0 +1,78 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"hash/fnv"
+	"math"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils/retry"
+)
+
+const (
+	// arnHashJitterBytes is the number of trailing bytes of the container
+	// instance ARN that are hashed to compute the jitter of the instance
+	arnHashJitterBytes = 8
+	// arnHashJitterMultiple is the maximum jitter added to the reconnect
+	// delay, as a fraction of the delay
+	arnHashJitterMultiple = 0.5
+)
+
+// arnHashJitter is a backoff adding a jitter specific to the container instance
+// to the reconnect delays of an underlying backoff. When a whole fleet loses its
+// connection to ACS at the same time, e.g. during an ACS deployment, the random
+// jitter of the backoff alone is not enough to keep the instances from
+// reconnecting at about the same time. The jitter is derived from a hash of the
+// container instance ARN, spreading the reconnects of the fleet evenly without
+// any coordination between the instances
+type arnHashJitter struct {
+	backoff retry.Backoff
+	// fraction is the fraction, between 0.0 and 1.0, of the maximum jitter
+	// added to the reconnect delays of the instance
+	fraction float64
+}
+
+// newARNHashJitter returns a new arnHashJitter object wrapping the backoff
+func newARNHashJitter(backoff retry.Backoff, containerInstanceARN string) *arnHashJitter {
+	return &arnHashJitter{
+		backoff:  backoff,
+		fraction: arnHashFraction(containerInstanceARN),
+	}
+}
+
+// arnHashFraction hashes the trailing bytes of the container instance ARN,
+// which are part of the unique ID of the container instance, into a fraction
+// between 0.0 and 1.0
+func arnHashFraction(containerInstanceARN string) float64 {
+	suffix := containerInstanceARN
+	if len(suffix) > arnHashJitterBytes {
+		suffix = suffix[len(suffix)-arnHashJitterBytes:]
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(suffix))
+	return float64(hash.Sum64()) / float64(math.MaxUint64)
+}
+
+// Duration returns the next delay of the underlying backoff, with the jitter of
+// the instance added to it
+func (jitter *arnHashJitter) Duration() time.Duration {
+	delay := jitter.backoff.Duration()
+	return delay + time.Duration(float64(delay)*arnHashJitterMultiple*jitter.fraction)
+}
+
+// Reset resets the underlying backoff
+func (jitter *arnHashJitter) Reset() {
+	jitter.backoff.Reset()
+}
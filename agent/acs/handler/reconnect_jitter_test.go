@@ -0,0 +1,68 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testJitterInstanceARN1 = "arn:aws:ecs:us-west-2:123456789012:container-instance/default/0b3f5c7e4a1d4c8f9e2b6a0d1c3e5f70"
+	testJitterInstanceARN2 = "arn:aws:ecs:us-west-2:123456789012:container-instance/default/9d8e7f6a5b4c4d3e8f1a2b3c4d5e6f71"
+)
+
+func newTestARNHashJitter(containerInstanceARN string) *arnHashJitter {
+	// No random jitter so that the delays are deterministic
+	return newARNHashJitter(retry.NewExponentialBackoff(time.Second, time.Minute, 0, 2), containerInstanceARN)
+}
+
+func TestARNHashFractionRange(t *testing.T) {
+	for _, arn := range []string{"", "short", testJitterInstanceARN1, testJitterInstanceARN2} {
+		fraction := arnHashFraction(arn)
+		assert.True(t, fraction >= 0 && fraction <= 1, "fraction out of range for %s: %f", arn, fraction)
+	}
+}
+
+func TestARNHashFractionIsStable(t *testing.T) {
+	assert.Equal(t, arnHashFraction(testJitterInstanceARN1), arnHashFraction(testJitterInstanceARN1))
+}
+
+func TestARNHashJitterDiffersBetweenInstances(t *testing.T) {
+	jitter1 := newTestARNHashJitter(testJitterInstanceARN1)
+	jitter2 := newTestARNHashJitter(testJitterInstanceARN2)
+
+	delay1 := jitter1.Duration()
+	delay2 := jitter2.Duration()
+	assert.NotEqual(t, delay1, delay2)
+	for _, delay := range []time.Duration{delay1, delay2} {
+		assert.True(t, delay >= time.Second && delay <= time.Duration(float64(time.Second)*(1+arnHashJitterMultiple)),
+			"unexpected delay: %s", delay)
+	}
+}
+
+func TestARNHashJitterReset(t *testing.T) {
+	jitter := newTestARNHashJitter(testJitterInstanceARN1)
+	first := jitter.Duration()
+	assert.True(t, jitter.Duration() > first)
+
+	jitter.Reset()
+	assert.Equal(t, first, jitter.Duration())
+}
@@ -0,0 +1,64 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/utils/retry"
+)
+
+// ACSReconnectStagger is a backoff staggering the reconnects to ACS of the agents
+// running on the same host, e.g. multiple agents running in containers. After a
+// network blip, all the agents of the host lose their connection at the same
+// time and would reconnect at about the same time. Each agent is configured with
+// its own slot, and the first reconnect delay after a disconnection is offset by
+// (slot+1) * interval, which spreads the reconnects of N agents evenly over a
+// window of N * interval. Further delays are those of the underlying backoff
+type ACSReconnectStagger struct {
+	backoff retry.Backoff
+	offset  time.Duration
+	// initial is true until the first delay following a reset is returned
+	initial bool
+}
+
+// newACSReconnectStagger returns a new ACSReconnectStagger object wrapping the
+// backoff, for the agent in the given stagger slot
+func newACSReconnectStagger(backoff retry.Backoff, slot int, interval time.Duration) *ACSReconnectStagger {
+	if slot < 0 {
+		slot = 0
+	}
+	return &ACSReconnectStagger{
+		backoff: backoff,
+		offset:  time.Duration(slot+1) * interval,
+		initial: true,
+	}
+}
+
+// Duration returns the next delay of the underlying backoff, offset by the
+// stagger of the slot if it's the first delay since the backoff was reset
+func (stagger *ACSReconnectStagger) Duration() time.Duration {
+	delay := stagger.backoff.Duration()
+	if stagger.initial {
+		stagger.initial = false
+		return delay + stagger.offset
+	}
+	return delay
+}
+
+// Reset resets the underlying backoff, the next delay is staggered again
+func (stagger *ACSReconnectStagger) Reset() {
+	stagger.backoff.Reset()
+	stagger.initial = true
+}
@@ -0,0 +1,70 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/utils/retry"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestACSReconnectStagger(slot int) *ACSReconnectStagger {
+	// No random jitter so that the delays are deterministic
+	return newACSReconnectStagger(retry.NewExponentialBackoff(time.Second, time.Minute, 0, 2), slot, 500*time.Millisecond)
+}
+
+func TestACSReconnectStaggerDelaysPerSlot(t *testing.T) {
+	for slot, expected := range []time.Duration{
+		1500 * time.Millisecond,
+		2 * time.Second,
+		2500 * time.Millisecond,
+		3 * time.Second,
+	} {
+		assert.Equal(t, expected, newTestACSReconnectStagger(slot).Duration(), "wrong initial delay for slot %d", slot)
+	}
+}
+
+func TestACSReconnectStaggerOnlyInitialDelay(t *testing.T) {
+	stagger := newTestACSReconnectStagger(2)
+	assert.Equal(t, 2500*time.Millisecond, stagger.Duration())
+	// The following delays are the ones of the backoff
+	assert.Equal(t, 2*time.Second, stagger.Duration())
+	assert.Equal(t, 4*time.Second, stagger.Duration())
+
+	// The first delay after a reset, i.e. after the agent was connected for a
+	// while, is staggered again
+	stagger.Reset()
+	assert.Equal(t, 2500*time.Millisecond, stagger.Duration())
+}
+
+func TestACSReconnectStaggerInvalidSlot(t *testing.T) {
+	assert.Equal(t, 1500*time.Millisecond, newTestACSReconnectStagger(-1).Duration())
+}
+
+func TestNewSessionStaggersReconnects(t *testing.T) {
+	cfg := &config.Config{ACSReconnectStaggerSlot: 3, ACSReconnectStaggerInterval: time.Second}
+	acsSession := NewSession(context.Background(), SessionParams{Config: cfg, ContainerInstanceARN: "myArn"}).(*session)
+
+	// The initial delay of the backoff is connectionBackoffMin with some jitter,
+	// offset by the stagger of the fourth slot
+	delay := acsSession.computeReconnectDelay(false)
+	assert.True(t, delay >= 4*time.Second && delay < 5*time.Second, "unexpected initial delay: %s", delay)
+}
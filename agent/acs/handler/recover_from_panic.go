@@ -0,0 +1,55 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+)
+
+// requestHandlerMiddlewareUser is implemented by websocket clients that wrap the
+// invocations of their request handlers with middlewares
+type requestHandlerMiddlewareUser interface {
+	UseRequestHandlerMiddleware(middlewares ...wsclient.RequestHandlerMiddleware)
+}
+
+// RecoverFromPanic returns a request handler middleware converting the panics of
+// the handlers of ACS messages to errors, so that a handler failing on an
+// unexpected message doesn't crash the agent. The stack trace of the panic is
+// logged and the panic is counted in the metrics
+func RecoverFromPanic(log logger.Logger) wsclient.RequestHandlerMiddleware {
+	return func(messageType string, handle func() error) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Errorf("Recovered from a panic in the handler of %s messages: %v\n%s",
+					messageType, r, debug.Stack())
+				metrics.MetricsEngineGlobal.RecordACSHandlerPanic(messageType)
+				err = fmt.Errorf("panic in the handler of %s messages: %v", messageType, r)
+			}
+		}()
+		return handle()
+	}
+}
+
+// useDefaultRequestHandlerMiddlewares wraps the request handlers of the client
+// with the middlewares used by all ACS sessions, if the client supports them
+func useDefaultRequestHandlerMiddlewares(client wsclient.ClientServer, log logger.Logger) {
+	if middlewareUser, ok := client.(requestHandlerMiddlewareUser); ok {
+		middlewareUser.UseRequestHandlerMiddleware(RecoverFromPanic(log))
+	}
+}
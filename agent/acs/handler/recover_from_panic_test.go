@@ -0,0 +1,94 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	acsclient "github.com/aws/amazon-ecs-agent/agent/acs/client"
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverFromPanicConvertsPanicToError(t *testing.T) {
+	recoverFromPanic := RecoverFromPanic(logger.NewNilSafeLogger(nil))
+	err := recoverFromPanic("PayloadMessage", func() error {
+		var message *ecsacs.PayloadMessage
+		_ = *message.MessageId
+		return nil
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "panic in the handler of PayloadMessage messages")
+}
+
+func TestRecoverFromPanicReturnsHandlerError(t *testing.T) {
+	recoverFromPanic := RecoverFromPanic(logger.NewNilSafeLogger(nil))
+	assert.NoError(t, recoverFromPanic("PayloadMessage", func() error { return nil }))
+	handlerErr := errors.New("handler error")
+	assert.Equal(t, handlerErr, recoverFromPanic("PayloadMessage", func() error { return handlerErr }))
+}
+
+// TestSessionSurvivesHandlerPanic tests that the connection to ACS is still
+// served after a handler panics on a message
+func TestSessionSurvivesHandlerPanic(t *testing.T) {
+	closeWS := make(chan bool)
+	server, serverIn, _, _, err := startMockAcsServer(t, closeWS)
+	require.NoError(t, err)
+	defer server.Close()
+	defer close(closeWS)
+
+	client := acsclient.New(server.URL, testConfig, testCreds, wsRWTimeout, nil, nil)
+	defer client.Close()
+	useDefaultRequestHandlerMiddlewares(client, logger.NewNilSafeLogger(nil))
+	handled := make(chan string, 1)
+	client.AddRequestHandler(func(message *ecsacs.HeartbeatMessage) {
+		if !aws.BoolValue(message.Healthy) {
+			panic("unhealthy")
+		}
+		handled <- aws.StringValue(message.MessageId)
+	})
+	// Wait for up to a second for the mock server to launch
+	for i := 0; i < 100; i++ {
+		err = client.Connect()
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, err)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- client.Serve()
+	}()
+	serverIn <- `{"type":"HeartbeatMessage","message":{"healthy":false,"messageId":"panics"}}`
+	serverIn <- `{"type":"HeartbeatMessage","message":{"healthy":true,"messageId":"handled"}}`
+
+	select {
+	case messageID := <-handled:
+		assert.Equal(t, "handled", messageID)
+	case err := <-serveErr:
+		t.Fatalf("the connection shouldn't be closed after a handler panic: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message following the panic to be handled")
+	}
+}
@@ -39,15 +39,21 @@ type refreshCredentialsHandler struct {
 	acsClient          wsclient.ClientServer
 	credentialsManager credentials.Manager
 	taskEngine         engine.TaskEngine
+	*inFlightAckTracker
+	routines *handlerRoutines
+	// goroutines limits the goroutines started by the handler, nil if they
+	// aren't limited
+	goroutines *HandlerGoroutineLimiter
 }
 
 // newRefreshCredentialsHandler returns a new refreshCredentialsHandler object
-func newRefreshCredentialsHandler(ctx context.Context, cluster string, containerInstanceArn string, acsClient wsclient.ClientServer, credentialsManager credentials.Manager, taskEngine engine.TaskEngine) refreshCredentialsHandler {
+func newRefreshCredentialsHandler(ctx context.Context, cluster string, containerInstanceArn string, acsClient wsclient.ClientServer, credentialsManager credentials.Manager, taskEngine engine.TaskEngine,
+	goroutines *HandlerGoroutineLimiter) refreshCredentialsHandler {
 	// Create a cancelable context from the parent context
 	derivedContext, cancel := context.WithCancel(ctx)
 	return refreshCredentialsHandler{
 		messageBuffer:      make(chan *ecsacs.IAMRoleCredentialsMessage),
-		ackRequest:         make(chan *ecsacs.IAMRoleCredentialsAckRequest),
+		ackRequest:         make(chan *ecsacs.IAMRoleCredentialsAckRequest, payloadMessageBufferSize),
 		ctx:                derivedContext,
 		cancel:             cancel,
 		cluster:            aws.String(cluster),
@@ -55,6 +61,9 @@ func newRefreshCredentialsHandler(ctx context.Context, cluster string, container
 		acsClient:          acsClient,
 		credentialsManager: credentialsManager,
 		taskEngine:         taskEngine,
+		inFlightAckTracker: newInFlightAckTracker(),
+		routines:           &handlerRoutines{},
+		goroutines:         goroutines,
 	}
 }
 
@@ -62,7 +71,12 @@ func newRefreshCredentialsHandler(ctx context.Context, cluster string, container
 func (refreshHandler *refreshCredentialsHandler) handlerFunc() func(message *ecsacs.IAMRoleCredentialsMessage) {
 	// return a function that just enqueues IAMRoleCredentials messages into the message buffer
 	return func(message *ecsacs.IAMRoleCredentialsMessage) {
-		refreshHandler.messageBuffer <- message
+		refreshHandler.trackReceived("IAMRoleCredentialsMessage", aws.StringValue(message.MessageId))
+		select {
+		case refreshHandler.messageBuffer <- message:
+		case <-refreshHandler.ctx.Done():
+			refreshHandler.trackAcked(aws.StringValue(message.MessageId))
+		}
 	}
 }
 
@@ -70,8 +84,8 @@ func (refreshHandler *refreshCredentialsHandler) handlerFunc() func(message *ecs
 // 1. handle messages in the refresh credentials message buffer
 // 2. handle ack requests to be sent to ACS
 func (refreshHandler *refreshCredentialsHandler) start() {
-	go refreshHandler.handleMessages()
-	go refreshHandler.sendAcks()
+	refreshHandler.routines.run(refreshHandler.handleMessages)
+	refreshHandler.routines.run(refreshHandler.sendAcks)
 }
 
 // stop cancels the context being used by the refresh credentials handler. This is used
@@ -80,6 +94,11 @@ func (refreshHandler *refreshCredentialsHandler) stop() {
 	refreshHandler.cancel()
 }
 
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (refreshHandler *refreshCredentialsHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, refreshHandler.stop, refreshHandler.routines, refreshHandler.clearAcks)
+}
+
 // sendAcks sends ack requests to ACS
 func (refreshHandler *refreshCredentialsHandler) sendAcks() {
 	for {
@@ -99,6 +118,7 @@ func (refreshHandler *refreshCredentialsHandler) ackMessage(ack *ecsacs.IAMRoleC
 		seelog.Warnf("Error 'ack'ing request with messageID: %s, error: %v", aws.StringValue(ack.MessageId), err)
 	}
 	seelog.Debugf("Acking credentials message: %s", ack.String())
+	refreshHandler.trackAcked(aws.StringValue(ack.MessageId))
 }
 
 // handleMessages processes refresh credentials messages in the buffer in-order
@@ -106,7 +126,10 @@ func (refreshHandler *refreshCredentialsHandler) handleMessages() {
 	for {
 		select {
 		case message := <-refreshHandler.messageBuffer:
-			refreshHandler.handleSingleMessage(message)
+			if err := refreshHandler.handleSingleMessage(message); err != nil {
+				// The message won't be acked
+				refreshHandler.trackAcked(aws.StringValue(message.MessageId))
+			}
 		case <-refreshHandler.ctx.Done():
 			return
 		}
@@ -151,14 +174,18 @@ func (refreshHandler *refreshCredentialsHandler) handleSingleMessage(message *ec
 		}
 	}
 
-	go func() {
+	refreshHandler.trackAckQueued(messageId)
+	refreshHandler.goroutines.spawn(iamRoleCredentialsMessageType, func() {
 		response := &ecsacs.IAMRoleCredentialsAckRequest{
 			Expiration:    message.RoleCredentials.Expiration,
 			MessageId:     message.MessageId,
 			CredentialsId: message.RoleCredentials.CredentialsId,
 		}
-		refreshHandler.ackRequest <- response
-	}()
+		select {
+		case refreshHandler.ackRequest <- response:
+		case <-refreshHandler.ctx.Done():
+		}
+	})
 	return nil
 }
 
@@ -170,7 +170,7 @@ func TestInvalidCredentialsMessageNotAcked(t *testing.T) {
 	credentialsManager := credentials.NewManager()
 
 	ctx, cancel := context.WithCancel(context.Background())
-	handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, nil)
+	handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, nil, nil)
 
 	// Start a goroutine to listen for acks. Cancelling the context stops the goroutine
 	go func() {
@@ -207,7 +207,7 @@ func TestCredentialsMessageNotAckedWhenTaskNotFound(t *testing.T) {
 	taskEngine.EXPECT().GetTaskByArn(taskArn).Return(nil, false)
 
 	ctx, cancel := context.WithCancel(context.Background())
-	handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, taskEngine)
+	handler := newRefreshCredentialsHandler(ctx, cluster, containerInstance, nil, credentialsManager, taskEngine, nil)
 
 	// Start a goroutine to listen for acks. Cancelling the context stops the goroutine
 	go func() {
@@ -250,7 +250,7 @@ func TestHandleRefreshMessageAckedWhenCredentialsUpdated(t *testing.T) {
 	// Return a task from the engine for GetTaskByArn
 	taskEngine.EXPECT().GetTaskByArn(taskArn).Return(&apitask.Task{}, true)
 
-	handler := newRefreshCredentialsHandler(ctx, clusterName, containerInstanceArn, mockWsClient, credentialsManager, taskEngine)
+	handler := newRefreshCredentialsHandler(ctx, clusterName, containerInstanceArn, mockWsClient, credentialsManager, taskEngine, nil)
 	go handler.sendAcks()
 
 	// test adding a credentials message without the MessageId field
@@ -296,7 +296,7 @@ func TestRefreshCredentialsHandler(t *testing.T) {
 	// Return a task from the engine for GetTaskByArn
 	taskEngine.EXPECT().GetTaskByArn(taskArn).Return(&apitask.Task{}, true)
 
-	handler := newRefreshCredentialsHandler(ctx, clusterName, containerInstanceArn, mockWsClient, credentialsManager, taskEngine)
+	handler := newRefreshCredentialsHandler(ctx, clusterName, containerInstanceArn, mockWsClient, credentialsManager, taskEngine, nil)
 	go handler.start()
 
 	handler.messageBuffer <- message
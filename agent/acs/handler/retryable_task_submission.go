@@ -0,0 +1,97 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/cihub/seelog"
+)
+
+// RetryableTaskSubmission makes the submission of the tasks of payload messages
+// to the task engine idempotent. A token made of the message ID and the task ARN
+// is saved once each task has been added to the task engine and saved, so that
+// a task isn't submitted again when ACS resends a message that wasn't acked
+// because the agent crashed after submitting its tasks. Only the ack of the
+// message is sent again in that case. Tasks still queued when the agent crashes
+// have no token, and are submitted again
+type RetryableTaskSubmission struct {
+	dataClient data.Client
+	// tokenTTL is the time after which a token expires, and the task can be
+	// submitted again
+	tokenTTL time.Duration
+}
+
+// newRetryableTaskSubmission returns a new RetryableTaskSubmission, or nil if
+// the tokens can't be saved or don't expire
+func newRetryableTaskSubmission(dataClient data.Client, tokenTTL time.Duration) *RetryableTaskSubmission {
+	if dataClient == nil || tokenTTL <= 0 {
+		return nil
+	}
+	return &RetryableTaskSubmission{
+		dataClient: dataClient,
+		tokenTTL:   tokenTTL,
+	}
+}
+
+// submitted returns true if a token that hasn't expired shows that the task of
+// the message was already submitted
+func (submission *RetryableTaskSubmission) submitted(messageID, taskARN string) bool {
+	if submission == nil {
+		return false
+	}
+	token, err := submission.dataClient.GetTaskSubmission(messageID, taskARN)
+	if err != nil {
+		return false
+	}
+	return time.Since(token.SubmittedAt) < submission.tokenTTL
+}
+
+// record saves the token of the submission of the task of the message. Failing
+// to save it only makes the submission not idempotent, it doesn't prevent it
+func (submission *RetryableTaskSubmission) record(messageID, taskARN string) {
+	if submission == nil {
+		return
+	}
+	err := submission.dataClient.SaveTaskSubmission(&data.TaskSubmission{
+		MessageID:   messageID,
+		TaskARN:     taskARN,
+		SubmittedAt: time.Now(),
+	})
+	if err != nil {
+		seelog.Warnf("Unable to save the submission of task %s of payload message %s: %v", taskARN, messageID, err)
+	}
+}
+
+// forget deletes the token of the submission of the task of the message, so
+// that the task is submitted again when ACS resends the message
+func (submission *RetryableTaskSubmission) forget(messageID, taskARN string) {
+	if submission == nil {
+		return
+	}
+	if err := submission.dataClient.DeleteTaskSubmission(messageID, taskARN); err != nil {
+		seelog.Warnf("Unable to delete the submission of task %s of payload message %s: %v", taskARN, messageID, err)
+	}
+}
+
+// purgeExpiredTokens deletes the tokens older than the token TTL
+func (submission *RetryableTaskSubmission) purgeExpiredTokens() {
+	if submission == nil {
+		return
+	}
+	if err := submission.dataClient.PurgeTaskSubmissions(submission.tokenTTL); err != nil {
+		seelog.Warnf("Unable to purge the expired task submissions: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"net/url"
+	"strconv"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// agentSupportedSchemaVersion is the latest version of the schema of the
+	// ACS messages the agent supports. It's advertised to ACS in the connection
+	// URL, and must be bumped whenever the agent supports a new schema
+	agentSupportedSchemaVersion = 1
+	// schemaVersionURLParameterName is the name of the URL parameter in the ACS
+	// URL advertising the latest message schema version the agent supports
+	schemaVersionURLParameterName = "schemaVersion"
+)
+
+// SchemaCompatibilityShim lets the agent process payload messages using a newer
+// schema than the one it supports. ACS sets the schema version of a message,
+// and the lowest schema version of the agents able to process it by ignoring
+// the fields they don't know, its compatible schema version:
+//   - Additive changes, e.g. a new optional task field, keep the compatible
+//     version. The unknown fields of the message are stripped: they're dropped
+//     when decoding the message, or ignored when the tasks are translated, even
+//     in strict decode mode.
+//   - Breaking changes, e.g. a new required field, set the compatible version
+//     to the new schema version. The message is nacked, as processing it could
+//     make the tasks behave incorrectly.
+//
+// Messages without a compatible schema version are assumed to be breaking.
+type SchemaCompatibilityShim struct {
+	supportedVersion int64
+}
+
+// newSchemaCompatibilityShim returns a new SchemaCompatibilityShim object for
+// an agent supporting the schema version
+func newSchemaCompatibilityShim(supportedVersion int64) *SchemaCompatibilityShim {
+	return &SchemaCompatibilityShim{
+		supportedVersion: supportedVersion,
+	}
+}
+
+// adapt returns whether the fields unknown to the agent in the tasks of the
+// payload message are to be stripped, or an error if the schema of the message
+// isn't compatible with the agent
+func (shim *SchemaCompatibilityShim) adapt(payload *ecsacs.PayloadMessage) (bool, error) {
+	schemaVersion := aws.Int64Value(payload.SchemaVersion)
+	if shim == nil || schemaVersion <= shim.supportedVersion {
+		return false, nil
+	}
+	compatibleVersion := aws.Int64Value(payload.CompatibleSchemaVersion)
+	if compatibleVersion == 0 || compatibleVersion > shim.supportedVersion {
+		return false, SchemaVersionUnsupportedError{
+			schemaVersion:     schemaVersion,
+			compatibleVersion: compatibleVersion,
+			supportedVersion:  shim.supportedVersion,
+		}
+	}
+	seelog.Infof("Payload message %s uses schema version %d, newer than the supported version %d: "+
+		"stripping the fields unknown to the agent", aws.StringValue(payload.MessageId), schemaVersion,
+		shim.supportedVersion)
+	return true, nil
+}
+
+// setSchemaVersionURLParameter advertises the latest message schema version
+// the agent supports in the ACS URL
+func setSchemaVersionURLParameter(query url.Values) {
+	query.Set(schemaVersionURLParameterName, strconv.Itoa(agentSupportedSchemaVersion))
+}
@@ -0,0 +1,161 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaCompatibilityShimAdapt(t *testing.T) {
+	testCases := []struct {
+		name                       string
+		schemaVersion              *int64
+		compatibleVersion          *int64
+		expectedStripUnknownFields bool
+		expectedError              bool
+	}{
+		{
+			name: "no schema version",
+		},
+		{
+			name:          "supported schema version",
+			schemaVersion: aws.Int64(2),
+		},
+		{
+			name:                       "newer schema version with additive changes",
+			schemaVersion:              aws.Int64(3),
+			compatibleVersion:          aws.Int64(1),
+			expectedStripUnknownFields: true,
+		},
+		{
+			name:                       "newer schema version compatible with the supported version",
+			schemaVersion:              aws.Int64(3),
+			compatibleVersion:          aws.Int64(2),
+			expectedStripUnknownFields: true,
+		},
+		{
+			name:              "newer schema version with breaking changes",
+			schemaVersion:     aws.Int64(3),
+			compatibleVersion: aws.Int64(3),
+			expectedError:     true,
+		},
+		{
+			name:          "newer schema version without compatible version",
+			schemaVersion: aws.Int64(3),
+			expectedError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			shim := newSchemaCompatibilityShim(2)
+			stripUnknownFields, err := shim.adapt(&ecsacs.PayloadMessage{
+				MessageId:               aws.String(payloadMessageId),
+				SchemaVersion:           tc.schemaVersion,
+				CompatibleSchemaVersion: tc.compatibleVersion,
+			})
+			assert.Equal(t, tc.expectedStripUnknownFields, stripUnknownFields)
+			if tc.expectedError {
+				require.IsType(t, SchemaVersionUnsupportedError{}, err)
+				assert.False(t, err.(SchemaVersionUnsupportedError).Retry())
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNilSchemaCompatibilityShim(t *testing.T) {
+	var shim *SchemaCompatibilityShim
+	stripUnknownFields, err := shim.adapt(&ecsacs.PayloadMessage{SchemaVersion: aws.Int64(100)})
+	assert.False(t, stripUnknownFields)
+	assert.NoError(t, err)
+}
+
+func TestHandlePayloadMessageWithBreakingSchemaVersion(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(0)
+	tester.mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(message interface{}) {
+		nack, ok := message.(*ecsacs.NackRequest)
+		require.True(t, ok, "Expected a nack request")
+		assert.Equal(t, payloadMessageId, aws.StringValue(nack.MessageId))
+		assert.Contains(t, aws.StringValue(nack.Reason), "SchemaVersionUnsupportedError")
+	}).Return(nil)
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("t1"),
+				DesiredStatus: aws.String("RUNNING"),
+			},
+		},
+		MessageId:               aws.String(payloadMessageId),
+		SchemaVersion:           aws.Int64(agentSupportedSchemaVersion + 1),
+		CompatibleSchemaVersion: aws.Int64(agentSupportedSchemaVersion + 1),
+	}
+	err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+	assert.IsType(t, SchemaVersionUnsupportedError{}, err)
+	assert.Empty(t, tester.payloadHandler.ListInFlightAcks())
+}
+
+// TestHandlePayloadMessageWithAdditiveSchemaVersion tests if tasks with fields
+// unknown to the agent are processed in strict decode mode when the schema of
+// the message is compatible with the agent
+func TestHandlePayloadMessageWithAdditiveSchemaVersion(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+	tester.payloadHandler.strictDecodeMode = true
+
+	defer func() {
+		checkUnknownACSTaskFields = apitask.CheckUnknownACSTaskFields
+	}()
+	checkUnknownACSTaskFields = func(task *ecsacs.Task) error {
+		return errors.New(`json: unknown field "newField"`)
+	}
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Times(1)
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn: aws.String("t1"),
+			},
+		},
+		MessageId:               aws.String(payloadMessageId),
+		SchemaVersion:           aws.Int64(agentSupportedSchemaVersion + 1),
+		CompatibleSchemaVersion: aws.Int64(agentSupportedSchemaVersion),
+	}
+	err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+	assert.NoError(t, err, "Error handling payload message")
+	select {
+	case mid := <-tester.payloadHandler.ackRequest:
+		assert.Equal(t, payloadMessageId, mid)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for payload message to be acked")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	asmfactory "github.com/aws/amazon-ecs-agent/agent/asm/factory"
+	rolecredentials "github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource/asmsecret"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// PrewarmedSecretTTL is how long the secret values fetched ahead of the
+	// tasks using them are kept, the tasks received later fetch them again
+	PrewarmedSecretTTL = 5 * time.Minute
+)
+
+// SecretsPrewarmer fetches the Secrets Manager secrets of the tasks listed in
+// the task manifests that haven't been received yet, so that their values are
+// already cached when ACS sends the tasks and the containers don't wait for
+// Secrets Manager to start. The secrets are fetched with the credentials of the
+// execution role of the tasks, which are only known if a task using the same
+// execution role runs on the instance; the secrets of the other tasks are
+// fetched when they are started, as before
+type SecretsPrewarmer struct {
+	secrets            *asmfactory.PrewarmedSecrets
+	clientCreator      asmfactory.ClientCreator
+	credentialsManager rolecredentials.Manager
+	taskEngine         engine.TaskEngine
+}
+
+// newSecretsPrewarmer returns a new SecretsPrewarmer caching the secret values
+// in secrets, or nil if secrets is nil
+func newSecretsPrewarmer(secrets *asmfactory.PrewarmedSecrets, clientCreator asmfactory.ClientCreator,
+	credentialsManager rolecredentials.Manager, taskEngine engine.TaskEngine) *SecretsPrewarmer {
+	if secrets == nil {
+		return nil
+	}
+	return &SecretsPrewarmer{
+		secrets:            secrets,
+		clientCreator:      clientCreator,
+		credentialsManager: credentialsManager,
+		taskEngine:         taskEngine,
+	}
+}
+
+// prewarm fetches the secrets of the tasks to run that the task engine doesn't
+// know yet and that aren't cached. It returns the number of secrets fetched
+func (prewarmer *SecretsPrewarmer) prewarm(ctx context.Context, tasks []*ecsacs.TaskIdentifier) int {
+	if prewarmer == nil {
+		return 0
+	}
+	prewarmer.secrets.Sweep()
+	var roleCredentials map[string]rolecredentials.IAMRoleCredentials
+	fetched := 0
+	for _, task := range tasks {
+		if aws.StringValue(task.DesiredStatus) != apitaskstatus.TaskRunningString || len(task.Secrets) == 0 {
+			continue
+		}
+		if _, ok := prewarmer.taskEngine.GetTaskByArn(aws.StringValue(task.TaskArn)); ok {
+			continue
+		}
+		if roleCredentials == nil {
+			roleCredentials = prewarmer.executionRoleCredentials()
+		}
+		roleARN := aws.StringValue(task.ExecutionRoleArn)
+		credentials, ok := roleCredentials[roleARN]
+		if !ok {
+			seelog.Debugf("No credentials of execution role %s to prewarm the secrets of task %s",
+				roleARN, aws.StringValue(task.TaskArn))
+			continue
+		}
+		for _, secret := range task.Secrets {
+			if ctx.Err() != nil {
+				return fetched
+			}
+			if prewarmer.prewarmSecret(secret, credentials) {
+				fetched++
+			}
+		}
+	}
+	if fetched > 0 {
+		seelog.Infof("Prewarmed %d secrets of the tasks of the task manifest", fetched)
+	}
+	return fetched
+}
+
+// prewarmSecret fetches the value of the secret with the credentials and caches
+// it. It returns true if the value was fetched
+func (prewarmer *SecretsPrewarmer) prewarmSecret(secret *ecsacs.Secret,
+	credentials rolecredentials.IAMRoleCredentials) bool {
+	if aws.StringValue(secret.Provider) != apicontainer.SecretProviderASM {
+		return false
+	}
+	input, err := asmsecret.GetSecretValueInput(aws.StringValue(secret.ValueFrom))
+	if err != nil || input.SecretId == nil {
+		return false
+	}
+	region := aws.StringValue(secret.Region)
+	if _, ok := prewarmer.secrets.Get(credentials.RoleArn, region, input); ok {
+		return false
+	}
+	output, err := prewarmer.clientCreator.NewASMClient(region, credentials).GetSecretValue(input)
+	if err != nil {
+		// The secret is fetched again when the task is started, which reports the error
+		seelog.Debugf("Unable to prewarm secret %s: %v", aws.StringValue(secret.ValueFrom), err)
+		return false
+	}
+	prewarmer.secrets.Set(credentials.RoleArn, region, input, output)
+	return true
+}
+
+// executionRoleCredentials returns the credentials of the execution roles of
+// the tasks of the task engine, by role ARN
+func (prewarmer *SecretsPrewarmer) executionRoleCredentials() map[string]rolecredentials.IAMRoleCredentials {
+	roleCredentials := make(map[string]rolecredentials.IAMRoleCredentials)
+	tasks, err := prewarmer.taskEngine.ListTasks()
+	if err != nil {
+		return roleCredentials
+	}
+	for _, task := range tasks {
+		credentialsID := task.GetExecutionCredentialsID()
+		if credentialsID == "" {
+			continue
+		}
+		taskCredentials, ok := prewarmer.credentialsManager.GetTaskCredentials(credentialsID)
+		if !ok {
+			continue
+		}
+		credentials := taskCredentials.GetIAMRoleCredentials()
+		if credentials.RoleArn != "" {
+			roleCredentials[credentials.RoleArn] = credentials
+		}
+	}
+	return roleCredentials
+}
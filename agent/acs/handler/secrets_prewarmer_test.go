@@ -0,0 +1,258 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	asmfactory "github.com/aws/amazon-ecs-agent/agent/asm/factory"
+	rolecredentials "github.com/aws/amazon-ecs-agent/agent/credentials"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/taskresource/asmsecret"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	prewarmTestRoleARN       = "arn:aws:iam::123456789012:role/execution"
+	prewarmTestCredentialsID = "execution-credentials-id"
+	prewarmTestRunningTask   = "arn:aws:ecs:us-west-2:123456789012:task/test-cluster/running"
+	prewarmTestNewTask       = "arn:aws:ecs:us-west-2:123456789012:task/test-cluster/new"
+	prewarmTestSecretARN     = "arn:aws:secretsmanager:us-west-2:123456789012:secret:db-password-abcdef"
+	prewarmTestRegion        = "us-west-2"
+	prewarmTestSecretsDelay  = 100 * time.Millisecond
+)
+
+// slowSecretsManager returns the value of all the secrets after a delay, like a
+// Secrets Manager far from the instance, and counts the calls
+type slowSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	calls int32
+	err   error
+}
+
+func (client *slowSecretsManager) GetSecretValue(
+	input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	atomic.AddInt32(&client.calls, 1)
+	time.Sleep(prewarmTestSecretsDelay)
+	if client.err != nil {
+		return nil, client.err
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String("value of " + aws.StringValue(input.SecretId))}, nil
+}
+
+// slowClientCreator returns the slowSecretsManager for all the regions and credentials
+type slowClientCreator struct {
+	client *slowSecretsManager
+}
+
+func (creator slowClientCreator) NewASMClient(region string,
+	creds rolecredentials.IAMRoleCredentials) secretsmanageriface.SecretsManagerAPI {
+	return creator.client
+}
+
+// newTestSecretsPrewarmer returns a prewarmer whose task engine runs a task with
+// the execution role prewarmTestRoleARN
+func newTestSecretsPrewarmer(t *testing.T, ctrl *gomock.Controller, client *slowSecretsManager) (*SecretsPrewarmer,
+	*asmfactory.PrewarmedSecrets, *mock_engine.MockTaskEngine) {
+	credentialsManager := rolecredentials.NewManager()
+	require.NoError(t, credentialsManager.SetTaskCredentials(&rolecredentials.TaskIAMRoleCredentials{
+		ARN: prewarmTestRunningTask,
+		IAMRoleCredentials: rolecredentials.IAMRoleCredentials{
+			CredentialsID: prewarmTestCredentialsID,
+			RoleArn:       prewarmTestRoleARN,
+		},
+	}))
+	runningTask := &apitask.Task{Arn: prewarmTestRunningTask}
+	runningTask.SetExecutionRoleCredentialsID(prewarmTestCredentialsID)
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().ListTasks().Return([]*apitask.Task{runningTask}, nil).AnyTimes()
+	taskEngine.EXPECT().GetTaskByArn(prewarmTestRunningTask).Return(runningTask, true).AnyTimes()
+	taskEngine.EXPECT().GetTaskByArn(gomock.Any()).Return(nil, false).AnyTimes()
+
+	secrets := asmfactory.NewPrewarmedSecrets(PrewarmedSecretTTL)
+	return newSecretsPrewarmer(secrets, slowClientCreator{client: client}, credentialsManager, taskEngine),
+		secrets, taskEngine
+}
+
+func prewarmTestSecret(provider string, valueFrom string) *ecsacs.Secret {
+	return &ecsacs.Secret{
+		Name:      aws.String("DB_PASSWORD"),
+		Provider:  aws.String(provider),
+		Region:    aws.String(prewarmTestRegion),
+		ValueFrom: aws.String(valueFrom),
+	}
+}
+
+func prewarmTestTask(taskARN string, desiredStatus string, roleARN string, secrets ...*ecsacs.Secret) *ecsacs.TaskIdentifier {
+	return &ecsacs.TaskIdentifier{
+		TaskArn:          aws.String(taskARN),
+		DesiredStatus:    aws.String(desiredStatus),
+		ExecutionRoleArn: aws.String(roleARN),
+		Secrets:          secrets,
+	}
+}
+
+func TestNewSecretsPrewarmerWithoutSecrets(t *testing.T) {
+	prewarmer := newSecretsPrewarmer(nil, asmfactory.NewClientCreator(), rolecredentials.NewManager(), nil)
+	assert.Nil(t, prewarmer)
+	assert.Equal(t, 0, prewarmer.prewarm(context.TODO(), []*ecsacs.TaskIdentifier{
+		prewarmTestTask(prewarmTestNewTask, apitaskstatus.TaskRunningString, prewarmTestRoleARN,
+			prewarmTestSecret(apicontainer.SecretProviderASM, prewarmTestSecretARN)),
+	}))
+}
+
+func TestSecretsPrewarmerPrewarmsSecretsOfNewTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := &slowSecretsManager{}
+	prewarmer, secrets, _ := newTestSecretsPrewarmer(t, ctrl, client)
+
+	fetched := prewarmer.prewarm(context.TODO(), []*ecsacs.TaskIdentifier{
+		prewarmTestTask(prewarmTestNewTask, apitaskstatus.TaskRunningString, prewarmTestRoleARN,
+			prewarmTestSecret(apicontainer.SecretProviderASM, prewarmTestSecretARN),
+			prewarmTestSecret(apicontainer.SecretProviderSSM, "arn:aws:ssm:us-west-2:123456789012:parameter/db"),
+			prewarmTestSecret(apicontainer.SecretProviderASM, "not an arn")),
+	})
+
+	assert.Equal(t, 1, fetched)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&client.calls))
+	input, err := asmsecret.GetSecretValueInput(prewarmTestSecretARN)
+	require.NoError(t, err)
+	output, ok := secrets.Get(prewarmTestRoleARN, prewarmTestRegion, input)
+	require.True(t, ok)
+	assert.Equal(t, "value of "+prewarmTestSecretARN, aws.StringValue(output.SecretString))
+
+	// The cached secrets aren't fetched again
+	assert.Equal(t, 0, prewarmer.prewarm(context.TODO(), []*ecsacs.TaskIdentifier{
+		prewarmTestTask(prewarmTestNewTask, apitaskstatus.TaskRunningString, prewarmTestRoleARN,
+			prewarmTestSecret(apicontainer.SecretProviderASM, prewarmTestSecretARN)),
+	}))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&client.calls))
+}
+
+func TestSecretsPrewarmerSkipsTasks(t *testing.T) {
+	secret := prewarmTestSecret(apicontainer.SecretProviderASM, prewarmTestSecretARN)
+	testCases := []struct {
+		name string
+		task *ecsacs.TaskIdentifier
+	}{
+		{"task already received", prewarmTestTask(prewarmTestRunningTask, apitaskstatus.TaskRunningString,
+			prewarmTestRoleARN, secret)},
+		{"task to stop", prewarmTestTask(prewarmTestNewTask, apitaskstatus.TaskStoppedString,
+			prewarmTestRoleARN, secret)},
+		{"no secrets", prewarmTestTask(prewarmTestNewTask, apitaskstatus.TaskRunningString, prewarmTestRoleARN)},
+		{"no credentials of the execution role", prewarmTestTask(prewarmTestNewTask, apitaskstatus.TaskRunningString,
+			"arn:aws:iam::123456789012:role/other", secret)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			client := &slowSecretsManager{}
+			prewarmer, secrets, _ := newTestSecretsPrewarmer(t, ctrl, client)
+
+			assert.Equal(t, 0, prewarmer.prewarm(context.TODO(), []*ecsacs.TaskIdentifier{tc.task}))
+			assert.EqualValues(t, 0, atomic.LoadInt32(&client.calls))
+			assert.Equal(t, 0, secrets.Len())
+		})
+	}
+}
+
+func TestSecretsPrewarmerIgnoresFailures(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := &slowSecretsManager{err: errors.New("access denied")}
+	prewarmer, secrets, _ := newTestSecretsPrewarmer(t, ctrl, client)
+
+	assert.Equal(t, 0, prewarmer.prewarm(context.TODO(), []*ecsacs.TaskIdentifier{
+		prewarmTestTask(prewarmTestNewTask, apitaskstatus.TaskRunningString, prewarmTestRoleARN,
+			prewarmTestSecret(apicontainer.SecretProviderASM, prewarmTestSecretARN)),
+	}))
+	assert.Equal(t, 0, secrets.Len())
+}
+
+// TestSecretsPrewarmingReducesManifestToStartLatency checks that the secrets of
+// a task listed in a manifest are retrieved without waiting for Secrets Manager
+// once the task is received and its secrets are retrieved to start it
+func TestSecretsPrewarmingReducesManifestToStartLatency(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := &slowSecretsManager{}
+	prewarmer, secrets, _ := newTestSecretsPrewarmer(t, ctrl, client)
+	creator := asmfactory.NewPrewarmedClientCreator(slowClientCreator{client: client}, secrets)
+	input, err := asmsecret.GetSecretValueInput(prewarmTestSecretARN)
+	require.NoError(t, err)
+	credentials := rolecredentials.IAMRoleCredentials{RoleArn: prewarmTestRoleARN}
+
+	// Without prewarming, starting the task waits for Secrets Manager
+	start := time.Now()
+	_, err = creator.NewASMClient(prewarmTestRegion, credentials).GetSecretValue(input)
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) >= prewarmTestSecretsDelay)
+
+	prewarmer.prewarm(context.TODO(), []*ecsacs.TaskIdentifier{
+		prewarmTestTask(prewarmTestNewTask, apitaskstatus.TaskRunningString, prewarmTestRoleARN,
+			prewarmTestSecret(apicontainer.SecretProviderASM, prewarmTestSecretARN)),
+	})
+	calls := atomic.LoadInt32(&client.calls)
+
+	start = time.Now()
+	output, err := creator.NewASMClient(prewarmTestRegion, credentials).GetSecretValue(input)
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) < prewarmTestSecretsDelay)
+	assert.Equal(t, "value of "+prewarmTestSecretARN, aws.StringValue(output.SecretString))
+	assert.Equal(t, calls, atomic.LoadInt32(&client.calls))
+}
+
+func TestTaskManifestHandlerQueuesLatestManifestForPrewarm(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	prewarmer, _, _ := newTestSecretsPrewarmer(t, ctrl, &slowSecretsManager{})
+	handler := newTaskManifestHandler(context.TODO(), "cluster", "containerInstance", nil, nil, nil,
+		aws.Int64(0), testManifestHistoryDepth, prewarmer, nil, nil, nil)
+
+	older := []*ecsacs.TaskIdentifier{prewarmTestTask("older", apitaskstatus.TaskRunningString, prewarmTestRoleARN)}
+	latest := []*ecsacs.TaskIdentifier{prewarmTestTask("latest", apitaskstatus.TaskRunningString, prewarmTestRoleARN)}
+	handler.queueSecretsPrewarm(older)
+	handler.queueSecretsPrewarm(latest)
+
+	select {
+	case tasks := <-handler.messageBufferSecretsPrewarm:
+		assert.Equal(t, latest, tasks)
+	default:
+		t.Fatal("tasks of the manifest not queued")
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+	"github.com/pborman/uuid"
+)
+
+// sessionMigration holds the acks that were queued, but not yet sent, when an
+// ACS session ended. They are carried over to the next session, and sent before
+// any new message is processed, so that ACS doesn't resend the messages and the
+// agent doesn't process them twice
+type sessionMigration struct {
+	// MigrationID correlates the session that queued the acks with the session
+	// that sends them
+	MigrationID     string                                 `json:"migrationID"`
+	PayloadAcks     []string                               `json:"payloadAcks,omitempty"`
+	CredentialsAcks []*ecsacs.IAMRoleCredentialsAckRequest `json:"credentialsAcks,omitempty"`
+}
+
+// newSessionMigration stops the handlers and collects the acks left in their queues
+func newSessionMigration(payloadHandler *payloadRequestHandler,
+	refreshHandler *refreshCredentialsHandler) *sessionMigration {
+	// Stop the handlers first so that the acks aren't being sent while they are collected
+	payloadHandler.stop()
+	refreshHandler.stop()
+
+	migration := &sessionMigration{
+		MigrationID: uuid.New(),
+	}
+	for {
+		select {
+		case messageID := <-payloadHandler.ackRequest:
+			migration.PayloadAcks = append(migration.PayloadAcks, messageID)
+		case ack := <-refreshHandler.ackRequest:
+			migration.CredentialsAcks = append(migration.CredentialsAcks, ack)
+		default:
+			return migration
+		}
+	}
+}
+
+// empty returns true if there are no acks to carry over
+func (migration *sessionMigration) empty() bool {
+	return migration == nil || (len(migration.PayloadAcks) == 0 && len(migration.CredentialsAcks) == 0)
+}
+
+// save persists the session migration so that it can be restored by the next session
+func (migration *sessionMigration) save(dataClient data.Client) {
+	if migration.empty() {
+		return
+	}
+	seelog.Infof("Saving %d payload acks and %d credentials acks of the ACS session, migration id: %s",
+		len(migration.PayloadAcks), len(migration.CredentialsAcks), migration.MigrationID)
+	migrationJSON, err := json.Marshal(migration)
+	if err != nil {
+		seelog.Warnf("Unable to marshal the ACS session migration %s: %v", migration.MigrationID, err)
+		return
+	}
+	if err := dataClient.SaveMetadata(data.ACSSessionMigrationKey, string(migrationJSON)); err != nil {
+		seelog.Warnf("Unable to save the ACS session migration %s: %v", migration.MigrationID, err)
+	}
+}
+
+// restoreSessionMigration returns the session migration saved by the previous
+// session, if any, and removes it from the data store so that it's restored
+// only once
+func restoreSessionMigration(dataClient data.Client) *sessionMigration {
+	migrationJSON, err := dataClient.GetMetadata(data.ACSSessionMigrationKey)
+	if err != nil || migrationJSON == "" {
+		// Nothing was saved by the previous session
+		return nil
+	}
+	if err := dataClient.SaveMetadata(data.ACSSessionMigrationKey, ""); err != nil {
+		seelog.Warnf("Unable to remove the restored ACS session migration: %v", err)
+	}
+
+	migration := &sessionMigration{}
+	if err := json.Unmarshal([]byte(migrationJSON), migration); err != nil {
+		seelog.Warnf("Unable to unmarshal the ACS session migration: %v", err)
+		return nil
+	}
+	return migration
+}
+
+// replay queues the acks carried over from the previous session to be sent by
+// the handlers of the new session
+func (migration *sessionMigration) replay(payloadHandler *payloadRequestHandler,
+	refreshHandler *refreshCredentialsHandler) {
+	if migration.empty() {
+		return
+	}
+	seelog.Infof("Replaying %d payload acks and %d credentials acks of the previous ACS session, migration id: %s",
+		len(migration.PayloadAcks), len(migration.CredentialsAcks), migration.MigrationID)
+	for _, messageID := range migration.PayloadAcks {
+		select {
+		case payloadHandler.ackRequest <- messageID:
+		case <-payloadHandler.ctx.Done():
+			return
+		}
+	}
+	for _, ack := range migration.CredentialsAcks {
+		seelog.Debugf("Replaying credentials ack, message id: %s", aws.StringValue(ack.MessageId))
+		select {
+		case refreshHandler.ackRequest <- ack:
+		case <-refreshHandler.ctx.Done():
+			return
+		}
+	}
+}
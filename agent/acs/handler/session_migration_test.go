@@ -0,0 +1,109 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMigrationTestHandlers() (*payloadRequestHandler, *refreshCredentialsHandler) {
+	ctx, cancel := context.WithCancel(context.TODO())
+	payloadHandler := &payloadRequestHandler{
+		ackRequest: make(chan string, payloadMessageBufferSize),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	refreshHandler := newRefreshCredentialsHandler(context.TODO(), clusterName, containerInstanceArn, nil, nil, nil, nil)
+	return payloadHandler, &refreshHandler
+}
+
+func TestSessionMigrationCarriesAcksOverToNextSession(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	// Queue acks in the handlers of the session being closed
+	oldPayloadHandler, oldRefreshHandler := newMigrationTestHandlers()
+	oldPayloadHandler.ackRequest <- "payload1"
+	oldPayloadHandler.ackRequest <- "payload2"
+	credentialsAck := &ecsacs.IAMRoleCredentialsAckRequest{
+		MessageId:     aws.String("credentials1"),
+		CredentialsId: aws.String("credentialsId"),
+	}
+	oldRefreshHandler.ackRequest <- credentialsAck
+
+	migration := newSessionMigration(oldPayloadHandler, oldRefreshHandler)
+	assert.Error(t, oldPayloadHandler.ctx.Err(), "payload handler should be stopped")
+	assert.Error(t, oldRefreshHandler.ctx.Err(), "credentials handler should be stopped")
+	assert.Equal(t, []string{"payload1", "payload2"}, migration.PayloadAcks)
+	require.Len(t, migration.CredentialsAcks, 1)
+	assert.NotEmpty(t, migration.MigrationID)
+	migration.save(dataClient)
+
+	// Restore the acks in the handlers of the new session
+	restored := restoreSessionMigration(dataClient)
+	require.NotNil(t, restored)
+	assert.Equal(t, migration.MigrationID, restored.MigrationID)
+
+	newPayloadHandler, newRefreshHandler := newMigrationTestHandlers()
+	restored.replay(newPayloadHandler, newRefreshHandler)
+	assert.Equal(t, "payload1", <-newPayloadHandler.ackRequest)
+	assert.Equal(t, "payload2", <-newPayloadHandler.ackRequest)
+	assert.Equal(t, credentialsAck, <-newRefreshHandler.ackRequest)
+
+	// The migration is restored only once
+	assert.Nil(t, restoreSessionMigration(dataClient))
+}
+
+func TestSessionMigrationWithoutAcksIsNotSaved(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	payloadHandler, refreshHandler := newMigrationTestHandlers()
+	migration := newSessionMigration(payloadHandler, refreshHandler)
+	assert.True(t, migration.empty())
+	migration.save(dataClient)
+
+	assert.Nil(t, restoreSessionMigration(dataClient))
+}
+
+func TestRestoreSessionMigrationNothingSaved(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	migration := restoreSessionMigration(dataClient)
+	assert.Nil(t, migration)
+
+	// Replaying a nil migration is a no-op
+	payloadHandler, refreshHandler := newMigrationTestHandlers()
+	migration.replay(payloadHandler, refreshHandler)
+	assert.Len(t, payloadHandler.ackRequest, 0)
+}
+
+func TestRestoreSessionMigrationInvalidData(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	require.NoError(t, dataClient.SaveMetadata(data.ACSSessionMigrationKey, "invalid"))
+	assert.Nil(t, restoreSessionMigration(dataClient))
+}
@@ -0,0 +1,113 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"sync"
+	"time"
+
+	tcshandler "github.com/aws/amazon-ecs-agent/agent/tcs/handler"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+)
+
+// SessionTelemetryUploader uploads the metrics aggregated over a connection to
+// ACS when the connection is closed
+type SessionTelemetryUploader interface {
+	Upload(telemetry tcshandler.SessionTelemetry) error
+}
+
+// sessionTelemetryCollector aggregates the metrics of a connection to ACS: the
+// number of messages handled by message type and the number of messages whose
+// handling failed
+type sessionTelemetryCollector struct {
+	lock          sync.Mutex
+	connectedAt   time.Time
+	messageCounts map[string]int64
+	errorCount    int64
+}
+
+// newSessionTelemetryCollector returns a new sessionTelemetryCollector
+func newSessionTelemetryCollector() *sessionTelemetryCollector {
+	return &sessionTelemetryCollector{
+		messageCounts: make(map[string]int64),
+	}
+}
+
+// connected records that the connection was established
+func (collector *sessionTelemetryCollector) connected() {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	collector.connectedAt = time.Now()
+}
+
+// use wraps the request handlers of the client with the middleware counting the
+// messages, if the client supports middlewares. It must be used before the
+// default middlewares so that the panics they recover from are counted as errors
+func (collector *sessionTelemetryCollector) use(client wsclient.ClientServer) {
+	if middlewareUser, ok := client.(requestHandlerMiddlewareUser); ok {
+		middlewareUser.UseRequestHandlerMiddleware(collector.middleware())
+	}
+}
+
+// middleware returns the request handler middleware counting the messages
+// handled and the errors of their handlers
+func (collector *sessionTelemetryCollector) middleware() wsclient.RequestHandlerMiddleware {
+	return func(messageType string, handle func() error) error {
+		err := handle()
+		collector.lock.Lock()
+		defer collector.lock.Unlock()
+		collector.messageCounts[messageType]++
+		if err != nil {
+			collector.errorCount++
+		}
+		return err
+	}
+}
+
+// telemetry returns the metrics aggregated since the connection was established.
+// sessionErr is the error the connection was closed with
+func (collector *sessionTelemetryCollector) telemetry(sessionID string, reconnectCount int, sessionErr error) tcshandler.SessionTelemetry {
+	collector.lock.Lock()
+	defer collector.lock.Unlock()
+	messageCounts := make(map[string]int64, len(collector.messageCounts))
+	for messageType, count := range collector.messageCounts {
+		messageCounts[messageType] = count
+	}
+	telemetry := tcshandler.SessionTelemetry{
+		SessionID:       sessionID,
+		ConnectedAt:     collector.connectedAt,
+		ConnectDuration: time.Since(collector.connectedAt),
+		MessageCounts:   messageCounts,
+		ErrorCount:      collector.errorCount,
+		ReconnectCount:  int64(reconnectCount),
+	}
+	if sessionErr != nil {
+		telemetry.CloseReason = sessionErr.Error()
+	}
+	return telemetry
+}
+
+// uploadSessionTelemetry uploads the metrics aggregated over the connection in
+// the background, so that reconnecting to ACS isn't delayed by the upload
+func (acsSession *session) uploadSessionTelemetry(collector *sessionTelemetryCollector, sessionErr error) {
+	if acsSession.telemetryUploader == nil {
+		return
+	}
+	telemetry := collector.telemetry(acsSession.sessionPersistentID, acsSession.connectionCount-1, sessionErr)
+	go func() {
+		if err := acsSession.telemetryUploader.Upload(telemetry); err != nil {
+			acsSession.logger().Warnf("Error uploading the telemetry of the ACS connection: %v", err)
+		}
+	}()
+}
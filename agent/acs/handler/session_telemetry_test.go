@@ -0,0 +1,213 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	mock_api "github.com/aws/amazon-ecs-agent/agent/api/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	tcsclient "github.com/aws/amazon-ecs-agent/agent/tcs/client"
+	tcshandler "github.com/aws/amazon-ecs-agent/agent/tcs/handler"
+	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/aws/amazon-ecs-agent/agent/utils/retry"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	wsmock "github.com/aws/amazon-ecs-agent/agent/wsclient/mock/utils"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingTelemetryUploader records the telemetry it uploads
+type recordingTelemetryUploader struct {
+	uploads chan tcshandler.SessionTelemetry
+}
+
+func (uploader *recordingTelemetryUploader) Upload(telemetry tcshandler.SessionTelemetry) error {
+	uploader.uploads <- telemetry
+	return nil
+}
+
+func (uploader *recordingTelemetryUploader) waitForUpload(t *testing.T) tcshandler.SessionTelemetry {
+	select {
+	case telemetry := <-uploader.uploads:
+		return telemetry
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the session telemetry to be uploaded")
+	}
+	return tcshandler.SessionTelemetry{}
+}
+
+// newTelemetryTestSession returns a session connecting with a mock client
+// whose Serve method returns serveErr
+func newTelemetryTestSession(ctrl *gomock.Controller, serveErr error,
+	uploader SessionTelemetryUploader) (*session, *mock_wsclient.MockClientServer, *mock_api.MockECSClient) {
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().Serve().Return(serveErr).AnyTimes()
+	mockWsClient.EXPECT().Close().Return(nil).AnyTimes()
+
+	acsSession := &session{
+		containerInstanceARN: "myArn",
+		sessionPersistentID:  "session-id",
+		credentialsProvider:  testCreds,
+		agentConfig:          testConfig,
+		taskEngine:           taskEngine,
+		ecsClient:            ecsClient,
+		dataClient:           data.NewNoopClient(),
+		ctx:                  context.Background(),
+		backoff:              retry.NewExponentialBackoff(connectionBackoffMin, connectionBackoffMax, connectionBackoffJitter, connectionBackoffMultiplier),
+		resources:            &mockSessionResources{},
+		telemetryUploader:    uploader,
+		_heartbeatTimeout:    time.Minute,
+		_heartbeatJitter:     time.Millisecond,
+	}
+	return acsSession, mockWsClient, ecsClient
+}
+
+func TestSessionTelemetryCollectorCountsMessages(t *testing.T) {
+	collector := newSessionTelemetryCollector()
+	collector.connected()
+	// The collector is the outermost middleware, it sees the panics recovered
+	// by the default middlewares as errors
+	recoverFromPanic := RecoverFromPanic(logger.NewNilSafeLogger(nil))
+	handle := func(messageType string, handler func() error) error {
+		return collector.middleware()(messageType, func() error {
+			return recoverFromPanic(messageType, handler)
+		})
+	}
+
+	assert.NoError(t, handle("HeartbeatMessage", func() error { return nil }))
+	assert.NoError(t, handle("HeartbeatMessage", func() error { return nil }))
+	assert.Error(t, handle("PayloadMessage", func() error { panic("payload") }))
+	assert.Error(t, handle("PayloadMessage", func() error { return errors.New("payload") }))
+
+	telemetry := collector.telemetry("session-id", 3, io.EOF)
+	assert.Equal(t, "session-id", telemetry.SessionID)
+	assert.Equal(t, map[string]int64{"HeartbeatMessage": 2, "PayloadMessage": 2}, telemetry.MessageCounts)
+	assert.Equal(t, int64(2), telemetry.ErrorCount)
+	assert.Equal(t, int64(3), telemetry.ReconnectCount)
+	assert.Equal(t, "EOF", telemetry.CloseReason)
+	assert.False(t, telemetry.ConnectedAt.IsZero())
+}
+
+func TestStartACSSessionUploadsTelemetryOnCleanClose(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uploader := &recordingTelemetryUploader{uploads: make(chan tcshandler.SessionTelemetry, 1)}
+	acsSession, mockWsClient, _ := newTelemetryTestSession(ctrl, io.EOF, uploader)
+	mockWsClient.EXPECT().Connect().Return(nil)
+
+	assert.Equal(t, io.EOF, acsSession.startACSSession(mockWsClient))
+	telemetry := uploader.waitForUpload(t)
+	assert.Equal(t, "session-id", telemetry.SessionID)
+	assert.Equal(t, io.EOF.Error(), telemetry.CloseReason)
+	assert.Equal(t, int64(0), telemetry.ReconnectCount)
+	assert.False(t, telemetry.ConnectedAt.IsZero())
+}
+
+func TestStartACSSessionUploadsTelemetryOnErrorClose(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uploader := &recordingTelemetryUploader{uploads: make(chan tcshandler.SessionTelemetry, 1)}
+	serveErr := errors.New("connection reset")
+	acsSession, mockWsClient, _ := newTelemetryTestSession(ctrl, serveErr, uploader)
+	mockWsClient.EXPECT().Connect().Return(nil).Times(2)
+
+	assert.Equal(t, serveErr, acsSession.startACSSession(mockWsClient))
+	assert.Equal(t, int64(0), uploader.waitForUpload(t).ReconnectCount)
+	assert.Equal(t, serveErr, acsSession.startACSSession(mockWsClient))
+	telemetry := uploader.waitForUpload(t)
+	assert.Equal(t, "connection reset", telemetry.CloseReason)
+	assert.Equal(t, int64(1), telemetry.ReconnectCount)
+}
+
+func TestStartACSSessionDoesntUploadTelemetryWithoutConnection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	uploader := &recordingTelemetryUploader{uploads: make(chan tcshandler.SessionTelemetry, 1)}
+	acsSession, mockWsClient, _ := newTelemetryTestSession(ctrl, nil, uploader)
+	mockWsClient.EXPECT().Connect().Return(errors.New("connection refused"))
+
+	assert.Error(t, acsSession.startACSSession(mockWsClient))
+	select {
+	case telemetry := <-uploader.uploads:
+		t.Errorf("Unexpected telemetry upload: %v", telemetry)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// TestStartACSSessionUploadsTelemetryToTelemetryServer tests that the telemetry
+// of a connection closed with an error is received by the telemetry service
+func TestStartACSSessionUploadsTelemetryToTelemetryServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	closeWS := make(chan []byte)
+	server, serverChan, requestChan, _, err := wsmock.GetMockServer(closeWS)
+	require.NoError(t, err)
+	server.StartTLS()
+	defer server.Close()
+	defer func() {
+		closeWS <- websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+		close(closeWS)
+		close(serverChan)
+	}()
+
+	serveErr := errors.New("connection reset")
+	acsSession, mockWsClient, ecsClient := newTelemetryTestSession(ctrl, serveErr, nil)
+	acsSession.telemetryUploader = tcshandler.NewTelemetryUploader(testConfig, testCreds, ecsClient,
+		acsSession.taskEngine, acsSession.containerInstanceARN)
+	ecsClient.EXPECT().DiscoverTelemetryEndpoint("myArn").Return(server.URL, nil)
+	mockWsClient.EXPECT().Connect().Return(nil)
+
+	assert.Equal(t, serveErr, acsSession.startACSSession(mockWsClient))
+
+	var request string
+	select {
+	case request = <-requestChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the telemetry service to receive the session telemetry")
+	}
+	lines := strings.Split(request, "\r\n")
+	message, messageType, err := wsclient.DecodeData([]byte(lines[len(lines)-1]), tcsclient.NewTCSDecoder())
+	require.NoError(t, err)
+	require.Equal(t, "PublishSessionTelemetryRequest", messageType)
+	telemetry := message.(*ecstcs.PublishSessionTelemetryRequest)
+	assert.Equal(t, "myArn", aws.StringValue(telemetry.Metadata.ContainerInstance))
+	assert.Equal(t, "session-id", aws.StringValue(telemetry.Metadata.SessionId))
+	assert.Equal(t, "connection reset", aws.StringValue(telemetry.CloseReason))
+	assert.Equal(t, int64(0), aws.Int64Value(telemetry.ReconnectCount))
+}
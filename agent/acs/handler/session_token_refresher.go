@@ -0,0 +1,105 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// sessionTokenCheckInterval is the interval at which the expiry of the
+	// credentials used to authenticate with ACS is checked
+	sessionTokenCheckInterval = time.Minute
+	// sessionTokenRefreshWindow is how long before they expire the credentials
+	// used to authenticate with ACS are refreshed
+	sessionTokenRefreshWindow = 5 * time.Minute
+)
+
+// sessionTokenRefresher proactively refreshes the credentials used to
+// authenticate with ACS before they expire. ACS authenticates the connection
+// when it is established, so the session is signaled to reconnect with the
+// refreshed credentials rather than letting a long-running connection outlive
+// them
+type sessionTokenRefresher struct {
+	credentialsProvider *credentials.Credentials
+	checkInterval       time.Duration
+	refreshWindow       time.Duration
+	// now returns the current time, it is overridden in unit tests
+	now func() time.Time
+}
+
+// newSessionTokenRefresher returns a new sessionTokenRefresher object
+func newSessionTokenRefresher(credentialsProvider *credentials.Credentials) *sessionTokenRefresher {
+	return &sessionTokenRefresher{
+		credentialsProvider: credentialsProvider,
+		checkInterval:       sessionTokenCheckInterval,
+		refreshWindow:       sessionTokenRefreshWindow,
+		now:                 time.Now,
+	}
+}
+
+// run checks the expiry of the credentials every check interval until the
+// context is cancelled. A signal is sent on reauthenticate every time the
+// credentials are refreshed
+func (refresher *sessionTokenRefresher) run(ctx context.Context, reauthenticate chan<- struct{}) {
+	if refresher == nil || refresher.credentialsProvider == nil {
+		return
+	}
+	ticker := time.NewTicker(refresher.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !refresher.refreshIfExpiring() {
+				continue
+			}
+			select {
+			case reauthenticate <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// expiresSoon returns true if the credentials expire within the refresh window.
+// Credentials whose provider doesn't expose their expiry are never refreshed
+func (refresher *sessionTokenRefresher) expiresSoon() bool {
+	expiresAt, err := refresher.credentialsProvider.ExpiresAt()
+	if err != nil {
+		return false
+	}
+	return expiresAt.Before(refresher.now().Add(refresher.refreshWindow))
+}
+
+// refreshIfExpiring refreshes the credentials if they expire within the refresh
+// window. It returns true if the credentials were refreshed
+func (refresher *sessionTokenRefresher) refreshIfExpiring() bool {
+	if !refresher.expiresSoon() {
+		return false
+	}
+	seelog.Info("Credentials used to authenticate with ACS are about to expire, refreshing them")
+	refresher.credentialsProvider.Expire()
+	if _, err := refresher.credentialsProvider.Get(); err != nil {
+		seelog.Warnf("Unable to refresh the credentials used to authenticate with ACS: %v", err)
+		return false
+	}
+	return true
+}
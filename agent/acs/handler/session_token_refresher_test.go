@@ -0,0 +1,116 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// expiringCredentialsProvider is a credentials provider returning credentials
+// that expire after the validity duration
+type expiringCredentialsProvider struct {
+	credentials.Expiry
+	validity  time.Duration
+	retrieved int
+	err       error
+}
+
+func (provider *expiringCredentialsProvider) Retrieve() (credentials.Value, error) {
+	if provider.err != nil {
+		return credentials.Value{}, provider.err
+	}
+	provider.retrieved++
+	provider.SetExpiration(time.Now().Add(provider.validity), 0)
+	return credentials.Value{
+		AccessKeyID:     "test-id",
+		SecretAccessKey: "test-secret",
+		SessionToken:    "test-token",
+		ProviderName:    "expiring",
+	}, nil
+}
+
+func newTestSessionTokenRefresher(t *testing.T, validity time.Duration) (*sessionTokenRefresher,
+	*expiringCredentialsProvider) {
+	provider := &expiringCredentialsProvider{validity: validity}
+	creds := credentials.NewCredentials(provider)
+	_, err := creds.Get()
+	require.NoError(t, err)
+	return newSessionTokenRefresher(creds), provider
+}
+
+func TestSessionTokenRefresherExpiresSoon(t *testing.T) {
+	refresher, _ := newTestSessionTokenRefresher(t, time.Hour)
+	assert.False(t, refresher.expiresSoon())
+
+	refresher.now = func() time.Time { return time.Now().Add(56 * time.Minute) }
+	assert.True(t, refresher.expiresSoon())
+}
+
+func TestSessionTokenRefresherRefreshesExpiringCredentials(t *testing.T) {
+	refresher, provider := newTestSessionTokenRefresher(t, 2*time.Minute)
+	assert.True(t, refresher.refreshIfExpiring())
+	assert.Equal(t, 2, provider.retrieved)
+}
+
+func TestSessionTokenRefresherDoesNotRefreshValidCredentials(t *testing.T) {
+	refresher, provider := newTestSessionTokenRefresher(t, time.Hour)
+	assert.False(t, refresher.refreshIfExpiring())
+	assert.Equal(t, 1, provider.retrieved)
+}
+
+func TestSessionTokenRefresherRefreshFailure(t *testing.T) {
+	refresher, provider := newTestSessionTokenRefresher(t, 2*time.Minute)
+	provider.err = errors.New("sts unavailable")
+	assert.False(t, refresher.refreshIfExpiring())
+}
+
+func TestSessionTokenRefresherIgnoresCredentialsWithoutExpiry(t *testing.T) {
+	refresher := newSessionTokenRefresher(credentials.NewStaticCredentials("test-id", "test-secret", "test-token"))
+	assert.False(t, refresher.expiresSoon())
+	assert.False(t, refresher.refreshIfExpiring())
+}
+
+func TestSessionTokenRefresherRunSignalsReauthentication(t *testing.T) {
+	refresher, _ := newTestSessionTokenRefresher(t, 2*time.Minute)
+	refresher.checkInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+
+	reauthenticate := make(chan struct{})
+	go refresher.run(ctx, reauthenticate)
+	select {
+	case <-reauthenticate:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the reauthentication signal")
+	}
+}
+
+func TestNilSessionTokenRefresher(t *testing.T) {
+	var refresher *sessionTokenRefresher
+	refresher.run(context.TODO(), make(chan struct{}))
+}
+
+func TestShouldReconnectWithoutBackoffToReauthenticate(t *testing.T) {
+	assert.True(t, shouldReconnectWithoutBackoff(errReauthenticate))
+}
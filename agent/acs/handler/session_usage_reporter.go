@@ -0,0 +1,90 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// sessionUsageReportInterval is the interval at which the usage of the
+	// connection to ACS is recorded
+	sessionUsageReportInterval = 5 * time.Minute
+)
+
+// sessionUsageReporter periodically records the bytes sent to and received from
+// ACS over a connection, to monitor the bandwidth used by the agent. A reporter
+// is created for every connection
+type sessionUsageReporter struct {
+	interval time.Duration
+	// bytesSent and bytesReceived are the counts of the connection already recorded
+	bytesSent     uint64
+	bytesReceived uint64
+}
+
+// newSessionUsageReporter returns a new sessionUsageReporter object
+func newSessionUsageReporter(interval time.Duration) *sessionUsageReporter {
+	return &sessionUsageReporter{
+		interval: interval,
+	}
+}
+
+// run records the usage of the connection of the client every interval until
+// the context is cancelled, at which point the remaining usage is recorded. It
+// returns right away if the client doesn't expose stats about its connection
+func (reporter *sessionUsageReporter) run(ctx context.Context, client wsclient.ClientServer) {
+	provider, ok := client.(sessionStatsProvider)
+	if !ok {
+		return
+	}
+	ticker := time.NewTicker(reporter.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			reporter.report(provider.SessionStats())
+		case <-ctx.Done():
+			reporter.report(provider.SessionStats())
+			return
+		}
+	}
+}
+
+// report records the usage of the connection since the last report
+func (reporter *sessionUsageReporter) report(stats wsclient.SessionStats) {
+	bytesSent, bytesReceived := reporter.delta(stats)
+	seelog.Debugf("ACS connection usage: %d bytes sent, %d bytes received, %.2f messages per second",
+		stats.BytesSent, stats.BytesReceived, stats.MessagesPerSecond)
+	metrics.MetricsEngineGlobal.RecordACSSessionUsage(bytesSent, bytesReceived, stats.MessagesPerSecond)
+}
+
+// delta returns the bytes sent and received since the last report, and marks
+// them as reported
+func (reporter *sessionUsageReporter) delta(stats wsclient.SessionStats) (uint64, uint64) {
+	var bytesSent, bytesReceived uint64
+	if stats.BytesSent > reporter.bytesSent {
+		bytesSent = stats.BytesSent - reporter.bytesSent
+		reporter.bytesSent = stats.BytesSent
+	}
+	if stats.BytesReceived > reporter.bytesReceived {
+		bytesReceived = stats.BytesReceived - reporter.bytesReceived
+		reporter.bytesReceived = stats.BytesReceived
+	}
+	return bytesSent, bytesReceived
+}
@@ -0,0 +1,82 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionUsageReporterDelta(t *testing.T) {
+	reporter := newSessionUsageReporter(sessionUsageReportInterval)
+
+	sent, received := reporter.delta(wsclient.SessionStats{BytesSent: 100, BytesReceived: 300})
+	assert.Equal(t, uint64(100), sent)
+	assert.Equal(t, uint64(300), received)
+
+	sent, received = reporter.delta(wsclient.SessionStats{BytesSent: 150, BytesReceived: 300})
+	assert.Equal(t, uint64(50), sent)
+	assert.Zero(t, received)
+}
+
+func TestSessionUsageReporterReportsWhenStopped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := &sessionStatsClientServer{
+		MockClientServer: mock_wsclient.NewMockClientServer(ctrl),
+		stats:            wsclient.SessionStats{BytesSent: 100, BytesReceived: 300},
+	}
+
+	reporter := newSessionUsageReporter(time.Hour)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reporter.run(ctx, client)
+	assert.Equal(t, uint64(100), reporter.bytesSent)
+	assert.Equal(t, uint64(300), reporter.bytesReceived)
+}
+
+func TestSessionUsageReporterReportsPeriodically(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := &sessionStatsClientServer{
+		MockClientServer: mock_wsclient.NewMockClientServer(ctrl),
+		stats:            wsclient.SessionStats{BytesSent: 100, BytesReceived: 300},
+	}
+
+	reporter := newSessionUsageReporter(10 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	reporter.run(ctx, client)
+	assert.Equal(t, uint64(100), reporter.bytesSent)
+	assert.Equal(t, uint64(300), reporter.bytesReceived)
+}
+
+func TestSessionUsageReporterWithoutStats(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Clients without stats are not reported, run returns right away
+	reporter := newSessionUsageReporter(time.Hour)
+	reporter.run(context.Background(), mock_wsclient.NewMockClientServer(ctrl))
+	assert.Zero(t, reporter.bytesSent)
+}
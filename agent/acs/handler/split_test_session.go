@@ -0,0 +1,257 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/utils/retry"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// maxPendingSplitTestMessages bounds the number of messages waiting for the
+// same message from the other endpoint of a split test session
+const maxPendingSplitTestMessages = 10000
+
+// splitTestEndpoint identifies an endpoint of a split test session
+type splitTestEndpoint int
+
+const (
+	// splitTestEndpointA is the primary endpoint, whose messages are processed
+	splitTestEndpointA splitTestEndpoint = iota
+	// splitTestEndpointB is the secondary endpoint, whose messages are only
+	// acked and compared with those of endpoint A
+	splitTestEndpointB
+)
+
+// splitTestMessageKey identifies a message received from both endpoints
+type splitTestMessageKey struct {
+	messageType string
+	messageID   string
+}
+
+type pendingSplitTestMessage struct {
+	endpoint   splitTestEndpoint
+	receivedAt time.Time
+}
+
+// splitTestComparator compares the messages delivered by the two endpoints of
+// a split test session. A message is matched if the other endpoint delivers a
+// message of the same type and id within the match window. The ratio of the
+// matched messages is exported as the split_test_message_match_rate metric
+type splitTestComparator struct {
+	lock     sync.Mutex
+	window   time.Duration
+	pending  map[splitTestMessageKey]pendingSplitTestMessage
+	matched  uint64
+	compared uint64
+	now      func() time.Time
+}
+
+// newSplitTestComparator creates a splitTestComparator, or nil if split
+// testing is disabled
+func newSplitTestComparator(cfg *config.Config) *splitTestComparator {
+	if !cfg.ACSSplitTestSession {
+		return nil
+	}
+	return &splitTestComparator{
+		window:  cfg.ACSSplitTestMatchWindow,
+		pending: make(map[splitTestMessageKey]pendingSplitTestMessage),
+		now:     time.Now,
+	}
+}
+
+// observe wraps the handler of any message of a connection, so that the
+// messages of the connection are recorded as received from the endpoint
+func (comparator *splitTestComparator) observe(endpoint splitTestEndpoint,
+	next func(interface{})) func(interface{}) {
+	if comparator == nil {
+		return next
+	}
+	return func(message interface{}) {
+		comparator.record(endpoint, message)
+		next(message)
+	}
+}
+
+// record records a message received from an endpoint. Heartbeats aren't
+// compared, their ids are specific to each connection
+func (comparator *splitTestComparator) record(endpoint splitTestEndpoint, message interface{}) {
+	if comparator == nil {
+		return
+	}
+	if _, ok := message.(*ecsacs.HeartbeatMessage); ok {
+		return
+	}
+	messageType, messageID := splitTestMessageIdentity(message)
+	if messageID == "" {
+		return
+	}
+	key := splitTestMessageKey{messageType: messageType, messageID: messageID}
+
+	comparator.lock.Lock()
+	defer comparator.lock.Unlock()
+
+	now := comparator.now()
+	compared := comparator.compared
+	comparator.expireUnsafe(now)
+	pending, ok := comparator.pending[key]
+	switch {
+	case ok && pending.endpoint != endpoint:
+		delete(comparator.pending, key)
+		comparator.matched++
+		comparator.compared++
+	case ok:
+		// ACS resent the message on the same endpoint
+	case len(comparator.pending) < maxPendingSplitTestMessages:
+		comparator.pending[key] = pendingSplitTestMessage{endpoint: endpoint, receivedAt: now}
+	}
+	if comparator.compared != compared {
+		metrics.MetricsEngineGlobal.RecordACSSplitTestMatchRate(comparator.matchRateUnsafe())
+	}
+}
+
+// expireUnsafe counts the messages that waited longer than the match window
+// as unmatched
+func (comparator *splitTestComparator) expireUnsafe(now time.Time) {
+	for key, pending := range comparator.pending {
+		if now.Sub(pending.receivedAt) > comparator.window {
+			delete(comparator.pending, key)
+			comparator.compared++
+		}
+	}
+}
+
+// matchRate returns the ratio of the compared messages that were matched
+func (comparator *splitTestComparator) matchRate() float64 {
+	comparator.lock.Lock()
+	defer comparator.lock.Unlock()
+
+	return comparator.matchRateUnsafe()
+}
+
+func (comparator *splitTestComparator) matchRateUnsafe() float64 {
+	if comparator.compared == 0 {
+		return 0
+	}
+	return float64(comparator.matched) / float64(comparator.compared)
+}
+
+// splitTestMessageIdentity returns the type and the id of an ACS message
+func splitTestMessageIdentity(message interface{}) (string, string) {
+	value := reflect.Indirect(reflect.ValueOf(message))
+	if value.Kind() != reflect.Struct {
+		return "", ""
+	}
+	field := value.FieldByName("MessageId")
+	if !field.IsValid() {
+		return value.Type().Name(), ""
+	}
+	messageID, _ := field.Interface().(*string)
+	return value.Type().Name(), aws.StringValue(messageID)
+}
+
+// splitTestAck returns the ack of a message received from endpoint B of a
+// split test session, or nil if the message isn't acked
+func splitTestAck(cluster, containerInstanceARN string, message interface{}) interface{} {
+	switch typedMessage := message.(type) {
+	case *ecsacs.HeartbeatMessage:
+		return &ecsacs.HeartbeatAckRequest{MessageId: typedMessage.MessageId}
+	case *ecsacs.IAMRoleCredentialsMessage:
+		ack := &ecsacs.IAMRoleCredentialsAckRequest{MessageId: typedMessage.MessageId}
+		if typedMessage.RoleCredentials != nil {
+			ack.CredentialsId = typedMessage.RoleCredentials.CredentialsId
+			ack.Expiration = typedMessage.RoleCredentials.Expiration
+		}
+		return ack
+	}
+	_, messageID := splitTestMessageIdentity(message)
+	if messageID == "" {
+		return nil
+	}
+	return &ecsacs.AckRequest{
+		Cluster:           aws.String(cluster),
+		ContainerInstance: aws.String(containerInstanceARN),
+		MessageId:         aws.String(messageID),
+	}
+}
+
+// runSplitTestSession keeps a connection open to endpoint B of the split test
+// session until the context is done, reconnecting with a backoff
+func (acsSession *session) runSplitTestSession(ctx context.Context) {
+	backoff := retry.NewExponentialBackoff(connectionBackoffMin, connectionBackoffMax,
+		connectionBackoffJitter, connectionBackoffMultiplier)
+	for {
+		err := acsSession.startSplitTestSession(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		delay := backoff.Duration()
+		acsSession.logger().Warnf("Split test connection to ACS endpoint B closed, reconnecting in %s: %v",
+			delay.String(), err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// startSplitTestSession connects to endpoint B of the split test session. The
+// messages of the connection are acked and compared with those of endpoint A,
+// they aren't processed. It returns when the connection is closed
+func (acsSession *session) startSplitTestSession(ctx context.Context) error {
+	cfg := acsSession.agentConfig
+	url := acsWsURL(cfg.ACSEndpointB, cfg.Cluster, acsSession.containerInstanceARN, acsSession.sessionPersistentID,
+		acsSession.protocolMismatchRecovery.protocolVersion(), acsSession.taskEngine, acsSession.resources,
+		acsSession.instanceResources, acsSession.instanceAttributesFetcher.fetch(),
+		detectWasmRuntime(acsSession.wasmRuntimeDetector))
+	client := acsSession.resources.createACSClient(url, acsSession.acsClientConfig())
+	defer client.Close()
+
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	acsSession.logger().Infof("Connected to split test ACS endpoint B, request id: %s", connectionRequestID(client))
+	timer := newDisconnectionTimer(client, acsSession.heartbeatTimeout(), acsSession.heartbeatJitter(), acsSession.logger())
+	defer timer.Stop()
+	anyMessage := anyMessageHandler(timer, client, acsSession.logger())
+	client.SetAnyRequestHandler(acsSession.splitTest.observe(splitTestEndpointB, func(message interface{}) {
+		anyMessage(message)
+		ack := splitTestAck(cfg.Cluster, acsSession.containerInstanceARN, message)
+		if ack == nil {
+			return
+		}
+		if err := client.MakeRequest(ack); err != nil {
+			acsSession.logger().Warnf("Unable to ack the message of split test ACS endpoint B: %v", err)
+		}
+	}))
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- client.Serve()
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-serveErr:
+		return err
+	}
+}
@@ -0,0 +1,184 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSplitTestComparator creates a comparator whose clock is advanced by
+// the tests
+func newTestSplitTestComparator() (*splitTestComparator, *time.Time) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	comparator := newSplitTestComparator(&config.Config{
+		ACSSplitTestSession:     true,
+		ACSSplitTestMatchWindow: time.Minute,
+	})
+	comparator.now = func() time.Time { return now }
+	return comparator, &now
+}
+
+func testSplitTestPayload(messageID string) *ecsacs.PayloadMessage {
+	return &ecsacs.PayloadMessage{MessageId: aws.String(messageID)}
+}
+
+func TestSplitTestComparatorMatchesMessages(t *testing.T) {
+	comparator, now := newTestSplitTestComparator()
+	comparator.record(splitTestEndpointA, testSplitTestPayload("m1"))
+	*now = now.Add(30 * time.Second)
+	comparator.record(splitTestEndpointB, testSplitTestPayload("m1"))
+	assert.Equal(t, 1.0, comparator.matchRate())
+	assert.Empty(t, comparator.pending)
+
+	// the same id in a message of another type doesn't match
+	comparator.record(splitTestEndpointB, testSplitTestPayload("m2"))
+	comparator.record(splitTestEndpointA, &ecsacs.TaskManifestMessage{MessageId: aws.String("m2")})
+	assert.Len(t, comparator.pending, 2)
+}
+
+func TestSplitTestComparatorExpiresUnmatchedMessages(t *testing.T) {
+	comparator, now := newTestSplitTestComparator()
+	comparator.record(splitTestEndpointA, testSplitTestPayload("m1"))
+	comparator.record(splitTestEndpointA, testSplitTestPayload("m2"))
+	comparator.record(splitTestEndpointB, testSplitTestPayload("m2"))
+	*now = now.Add(2 * time.Minute)
+	comparator.record(splitTestEndpointB, testSplitTestPayload("m1"))
+
+	assert.Equal(t, 0.5, comparator.matchRate(), "m1 was received from endpoint B after the match window")
+	assert.Len(t, comparator.pending, 1)
+}
+
+func TestSplitTestComparatorIgnoresDuplicatesAndHeartbeats(t *testing.T) {
+	comparator, _ := newTestSplitTestComparator()
+	comparator.record(splitTestEndpointA, testSplitTestPayload("m1"))
+	comparator.record(splitTestEndpointA, testSplitTestPayload("m1"))
+	comparator.record(splitTestEndpointA, &ecsacs.HeartbeatMessage{MessageId: aws.String("h1")})
+	comparator.record(splitTestEndpointA, &ecsacs.CloseMessage{})
+
+	assert.Len(t, comparator.pending, 1)
+	assert.Equal(t, 0.0, comparator.matchRate())
+}
+
+func TestSplitTestComparatorDisabled(t *testing.T) {
+	comparator := newSplitTestComparator(&config.Config{})
+	assert.Nil(t, comparator)
+	comparator.record(splitTestEndpointA, testSplitTestPayload("m1"))
+
+	called := false
+	comparator.observe(splitTestEndpointA, func(interface{}) { called = true })(testSplitTestPayload("m1"))
+	assert.True(t, called)
+}
+
+func TestSplitTestAck(t *testing.T) {
+	assert.Equal(t, &ecsacs.AckRequest{
+		Cluster:           aws.String("cluster"),
+		ContainerInstance: aws.String("myArn"),
+		MessageId:         aws.String("m1"),
+	}, splitTestAck("cluster", "myArn", testSplitTestPayload("m1")))
+	assert.Equal(t, &ecsacs.HeartbeatAckRequest{MessageId: aws.String("h1")},
+		splitTestAck("cluster", "myArn", &ecsacs.HeartbeatMessage{MessageId: aws.String("h1")}))
+	assert.Equal(t, &ecsacs.IAMRoleCredentialsAckRequest{
+		MessageId:     aws.String("c1"),
+		CredentialsId: aws.String("creds"),
+		Expiration:    aws.String("2020-01-01T00:00:00Z"),
+	}, splitTestAck("cluster", "myArn", &ecsacs.IAMRoleCredentialsMessage{
+		MessageId: aws.String("c1"),
+		RoleCredentials: &ecsacs.IAMRoleCredentials{
+			CredentialsId: aws.String("creds"),
+			Expiration:    aws.String("2020-01-01T00:00:00Z"),
+		},
+	}))
+	assert.Nil(t, splitTestAck("cluster", "myArn", &ecsacs.CloseMessage{}))
+}
+
+// TestStartSplitTestSessionAcksWithoutProcessing tests that the messages of
+// endpoint B are acked and recorded, and that no handler processes them
+func TestStartSplitTestSessionAcksWithoutProcessing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().Version().Return("Docker: 1.5.0", nil).AnyTimes()
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	cfg := &config.Config{
+		Cluster:                 "cluster",
+		ACSSplitTestSession:     true,
+		ACSEndpointA:            "https://ecs-a.us-west-2.amazonaws.com",
+		ACSEndpointB:            "https://ecs-b.us-west-2.amazonaws.com",
+		ACSSplitTestMatchWindow: time.Minute,
+	}
+	acsSession := &session{
+		containerInstanceARN: "myArn",
+		agentConfig:          cfg,
+		taskEngine:           taskEngine,
+		resources:            &mockSessionResources{client: mockWsClient},
+		splitTest:            newSplitTestComparator(cfg),
+		_heartbeatTimeout:    time.Minute,
+		_heartbeatJitter:     time.Millisecond,
+	}
+
+	var handler func(interface{})
+	mockWsClient.EXPECT().Connect().Return(nil)
+	mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).Do(func(f interface{}) {
+		handler = f.(func(interface{}))
+	})
+	mockWsClient.EXPECT().SetReadDeadline(gomock.Any()).Return(nil).AnyTimes()
+	mockWsClient.EXPECT().Serve().DoAndReturn(func() error {
+		handler(testSplitTestPayload("m1"))
+		handler(&ecsacs.HeartbeatMessage{MessageId: aws.String("h1")})
+		return io.EOF
+	})
+	gomock.InOrder(
+		mockWsClient.EXPECT().MakeRequest(&ecsacs.AckRequest{
+			Cluster:           aws.String("cluster"),
+			ContainerInstance: aws.String("myArn"),
+			MessageId:         aws.String("m1"),
+		}).Return(nil),
+		mockWsClient.EXPECT().MakeRequest(&ecsacs.HeartbeatAckRequest{MessageId: aws.String("h1")}).Return(nil),
+	)
+	mockWsClient.EXPECT().Close().Return(nil)
+
+	assert.Equal(t, io.EOF, acsSession.startSplitTestSession(context.Background()))
+	require.Len(t, acsSession.splitTest.pending, 1)
+	for _, pending := range acsSession.splitTest.pending {
+		assert.Equal(t, splitTestEndpointB, pending.endpoint)
+	}
+}
+
+func TestSplitTestSessionConnectsToEndpointA(t *testing.T) {
+	cfg := &config.Config{
+		ACSSplitTestSession: true,
+		ACSEndpointA:        "https://ecs-a.us-west-2.amazonaws.com",
+		ACSEndpointB:        "https://ecs-b.us-west-2.amazonaws.com",
+	}
+	acsSession := &session{agentConfig: cfg, splitTest: newSplitTestComparator(cfg)}
+	endpoint, err := acsSession.pollEndpoint()
+	require.NoError(t, err)
+	assert.Equal(t, cfg.ACSEndpointA, endpoint)
+}
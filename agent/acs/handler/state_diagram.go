@@ -0,0 +1,244 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+//go:generate go run -tags codegen ../../gogenerate/acsstatediagram -output acs_state_diagram.dot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const acsNodeName = "ACS"
+
+// acsMessageFlow describes how a message received from ACS is handled and which
+// messages are sent back to ACS as a result
+type acsMessageFlow struct {
+	messageType string
+	handler     string
+	// responses maps the type of each message sent back to ACS to the condition
+	// under which it is sent
+	responses map[string]string
+}
+
+// acsMessageFlows lists the messages received from ACS that the agent handles.
+// It must be kept in sync with the request handlers added in startACSSession and
+// by the updater, which is enforced by the tests; the state diagram is generated
+// from it.
+var acsMessageFlows = []acsMessageFlow{
+	{
+		messageType: "PayloadMessage",
+		handler:     "payloadRequestHandler",
+		responses: map[string]string{
+			"AckRequest":                   "all tasks added",
+			"IAMRoleCredentialsAckRequest": "task credentials set",
+			"NackRequest":                  "unsupported schema, unknown task fields, task role out of bounds or EBS volume not found",
+		},
+	},
+	{
+		messageType: "IAMRoleCredentialsMessage",
+		handler:     "refreshCredentialsHandler",
+		responses: map[string]string{
+			"IAMRoleCredentialsAckRequest": "credentials refreshed",
+		},
+	},
+	{
+		messageType: "HeartbeatMessage",
+		handler:     "heartbeatHandler",
+		responses: map[string]string{
+			"HeartbeatAckRequest": "always",
+		},
+	},
+	{
+		messageType: "AttachTaskNetworkInterfacesMessage",
+		handler:     "attachTaskENIHandler",
+		responses: map[string]string{
+			"AckRequest": "ENI attachment saved",
+		},
+	},
+	{
+		messageType: "AttachInstanceNetworkInterfacesMessage",
+		handler:     "attachInstanceENIHandler",
+		responses: map[string]string{
+			"AckRequest": "ENI attachment saved",
+		},
+	},
+	{
+		messageType: "ConfirmAttachmentMessage",
+		handler:     "genericAttachmentHandler",
+		responses: map[string]string{
+			"AckRequest": "resource attachment saved",
+		},
+	},
+	{
+		messageType: "TaskManifestMessage",
+		handler:     "taskManifestHandler",
+		responses: map[string]string{
+			"AckRequest":                  "newer sequence number",
+			"TaskStopVerificationMessage": "unexpected tasks running",
+		},
+	},
+	{
+		messageType: "TaskStopVerificationAck",
+		handler:     "taskManifestHandler",
+	},
+	{
+		messageType: "AckEchoMessage",
+		handler:     "connectionLatencyBudget",
+	},
+	{
+		messageType: "TaskDrainMessage",
+		handler:     "taskDrainHandler",
+		responses: map[string]string{
+			"AckRequest": "tasks drained or drain timed out",
+		},
+	},
+	{
+		messageType: "DiagnosticBundleRequest",
+		handler:     "diagnosticBundleHandler",
+		responses: map[string]string{
+			"AckRequest": "bundle uploaded",
+		},
+	},
+	{
+		messageType: "ContainerInstanceStatusMessage",
+		handler:     "containerInstanceStatusHandler",
+		responses: map[string]string{
+			"AckRequest": "status saved",
+		},
+	},
+	{
+		messageType: "UpdateAttributesMessage",
+		handler:     "attributeUpdateHandler",
+		responses: map[string]string{
+			"AckRequest": "attributes updated",
+		},
+	},
+	{
+		messageType: "ACSOperatorAlertMessage",
+		handler:     "operatorAlertHandler",
+		responses: map[string]string{
+			"AckRequest": "alert delivered or dropped",
+		},
+	},
+	{
+		messageType: "GetInstanceStateRequestMessage",
+		handler:     "getInstanceStateHandler",
+		responses: map[string]string{
+			"GetInstanceStateResponseMessage": "state snapshot taken",
+		},
+	},
+	{
+		messageType: "ManagedAgentUpdateMessage",
+		handler:     "managedAgentHandler",
+		responses: map[string]string{
+			"AckRequest": "managed agent updated",
+		},
+	},
+	{
+		messageType: "ACSAuthChallengeMessage",
+		handler:     "authChallengeHandler",
+		responses: map[string]string{
+			"ACSAuthChallengeResponseMessage": "challenge answered",
+		},
+	},
+	{
+		messageType: "StageUpdateMessage",
+		handler:     "updater",
+		responses: map[string]string{
+			"AckRequest":  "update downloaded",
+			"NackRequest": "updates disabled or download failed",
+		},
+	},
+	{
+		messageType: "PerformUpdateMessage",
+		handler:     "updater",
+		responses: map[string]string{
+			"AckRequest":  "update staged",
+			"NackRequest": "updates disabled or update not staged",
+		},
+	},
+}
+
+type diagramEdge struct {
+	from  string
+	to    string
+	label string
+}
+
+// GenerateStateDiagram returns a Graphviz DOT representation of the messages
+// received from ACS, the handlers that process them and the acks and nacks sent
+// back to ACS. Nodes and edges are sorted so that the output is deterministic.
+func GenerateStateDiagram() string {
+	messageTypes := make(map[string]struct{})
+	handlers := make(map[string]struct{})
+	responses := make(map[string]struct{})
+	edgeSet := make(map[diagramEdge]struct{})
+	for _, flow := range acsMessageFlows {
+		messageTypes[flow.messageType] = struct{}{}
+		handlers[flow.handler] = struct{}{}
+		edgeSet[diagramEdge{from: acsNodeName, to: flow.messageType}] = struct{}{}
+		edgeSet[diagramEdge{from: flow.messageType, to: flow.handler}] = struct{}{}
+		for response, condition := range flow.responses {
+			responses[response] = struct{}{}
+			edgeSet[diagramEdge{from: flow.handler, to: response, label: condition}] = struct{}{}
+			edgeSet[diagramEdge{from: response, to: acsNodeName}] = struct{}{}
+		}
+	}
+
+	edges := make([]diagramEdge, 0, len(edgeSet))
+	for edge := range edgeSet {
+		edges = append(edges, edge)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return edges[i].from < edges[j].from
+		}
+		if edges[i].to != edges[j].to {
+			return edges[i].to < edges[j].to
+		}
+		return edges[i].label < edges[j].label
+	})
+
+	var diagram strings.Builder
+	diagram.WriteString("// Code generated by go generate; DO NOT EDIT.\n")
+	diagram.WriteString("digraph acs {\n")
+	diagram.WriteString("\trankdir=LR;\n")
+	fmt.Fprintf(&diagram, "\t%q [shape=doublecircle];\n", acsNodeName)
+	writeDiagramNodes(&diagram, messageTypes, "box")
+	writeDiagramNodes(&diagram, handlers, "ellipse")
+	writeDiagramNodes(&diagram, responses, "note")
+	for _, edge := range edges {
+		if edge.label == "" {
+			fmt.Fprintf(&diagram, "\t%q -> %q;\n", edge.from, edge.to)
+		} else {
+			fmt.Fprintf(&diagram, "\t%q -> %q [label=%q];\n", edge.from, edge.to, edge.label)
+		}
+	}
+	diagram.WriteString("}\n")
+	return diagram.String()
+}
+
+// writeDiagramNodes writes the nodes, sorted by name, with the given shape
+func writeDiagramNodes(diagram *strings.Builder, nodes map[string]struct{}, shape string) {
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(diagram, "\t%q [shape=%s];\n", name, shape)
+	}
+}
@@ -0,0 +1,107 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	acsclient "github.com/aws/amazon-ecs-agent/agent/acs/client"
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateStateDiagramIsDeterministic(t *testing.T) {
+	diagram := GenerateStateDiagram()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, diagram, GenerateStateDiagram())
+	}
+	assert.Contains(t, diagram, `"PayloadMessage" -> "payloadRequestHandler";`)
+	assert.Contains(t, diagram, `"payloadRequestHandler" -> "AckRequest" [label="all tasks added"];`)
+	assert.Contains(t, diagram, `"AckRequest" -> "ACS";`)
+}
+
+// Tests that the checked in state diagram is up to date
+func TestStateDiagramFileUpToDate(t *testing.T) {
+	diagram, err := ioutil.ReadFile("acs_state_diagram.dot")
+	require.NoError(t, err)
+	assert.Equal(t, GenerateStateDiagram(), string(diagram),
+		"acs_state_diagram.dot is out of date, run 'go generate' to regenerate it")
+}
+
+// Tests that all the message types in the state diagram are recognized ACS messages
+func TestStateDiagramMessageTypesRecognized(t *testing.T) {
+	recognizedTypes := acsclient.NewACSDecoder().GetRecognizedTypes()
+	for _, flow := range acsMessageFlows {
+		assert.Contains(t, recognizedTypes, flow.messageType)
+		for response := range flow.responses {
+			assert.Contains(t, recognizedTypes, response)
+		}
+	}
+}
+
+// ackSendHookClient is a client that supports passing the acks to a hook, for
+// the handler of the ack echoes to be added
+type ackSendHookClient struct {
+	*mock_wsclient.MockClientServer
+}
+
+func (ackSendHookClient) UseAckSendHook(func(ack *ecsacs.AckRequest)) {}
+
+// Tests that the state diagram covers the request handlers added for a session
+// with ACS, and nothing else
+func TestStateDiagramMatchesRequestHandlers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handledTypes []string
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+	mockWsClient.EXPECT().SetAnyRequestHandler(gomock.Any()).AnyTimes()
+	mockWsClient.EXPECT().AddRequestHandler(gomock.Any()).Do(func(handler interface{}) {
+		handledTypes = append(handledTypes, reflect.TypeOf(handler).In(0).Elem().Name())
+	}).AnyTimes()
+	mockWsClient.EXPECT().Close().Return(nil).AnyTimes()
+	mockWsClient.EXPECT().Connect().Return(fmt.Errorf("connection refused"))
+	acsSession := session{
+		containerInstanceARN: "myArn",
+		credentialsProvider:  testCreds,
+		agentConfig:          testConfig,
+		taskEngine:           mock_engine.NewMockTaskEngine(ctrl),
+		dataClient:           data.NewNoopClient(),
+		ctx:                  ctx,
+		cancel:               cancel,
+		resources:            &mockSessionResources{mockWsClient},
+	}
+	require.Error(t, acsSession.startACSSession(ackSendHookClient{mockWsClient}))
+
+	var flowTypes []string
+	for _, flow := range acsMessageFlows {
+		flowTypes = append(flowTypes, flow.messageType)
+	}
+	assert.ElementsMatch(t, handledTypes, flowTypes,
+		"acsMessageFlows is out of sync with the request handlers, update it and run 'go generate'")
+}
@@ -0,0 +1,162 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+	"github.com/pborman/uuid"
+)
+
+const (
+	// stateReportPublishedEvent is the ACS event recorded when a container
+	// instance state report is sent to ACS
+	stateReportPublishedEvent = "ContainerInstanceStateReportPublished"
+)
+
+// periodicStatePublisher periodically reports the state of all the tasks and
+// containers managed by the agent to ACS. State changes are otherwise only
+// submitted as they happen, and a report allows ACS to detect and recover from
+// the ones it missed. The publisher outlives the ACS sessions so that at most
+// one report is sent per interval, even when the agent keeps reconnecting
+type periodicStatePublisher struct {
+	cluster              string
+	containerInstanceARN string
+	state                dockerstate.TaskEngineState
+	interval             time.Duration
+	lock                 sync.Mutex
+	lastPublished        time.Time
+	// now returns the current time, it is overridden in unit tests
+	now func() time.Time
+}
+
+// newPeriodicStatePublisher returns a new periodicStatePublisher object. The
+// first report is due one interval after the publisher is created. It returns
+// nil if the interval is not positive, as the reports are disabled then
+func newPeriodicStatePublisher(cluster string, containerInstanceARN string,
+	state dockerstate.TaskEngineState, interval time.Duration) *periodicStatePublisher {
+	if interval <= 0 {
+		return nil
+	}
+	return &periodicStatePublisher{
+		cluster:              cluster,
+		containerInstanceARN: containerInstanceARN,
+		state:                state,
+		interval:             interval,
+		lastPublished:        time.Now(),
+		now:                  time.Now,
+	}
+}
+
+// run sends a report to ACS through the client every interval, until the
+// context is cancelled
+func (publisher *periodicStatePublisher) run(ctx context.Context, client wsclient.ClientServer) {
+	if publisher == nil || publisher.state == nil {
+		return
+	}
+	for {
+		timer := time.NewTimer(publisher.nextPublishDelay())
+		select {
+		case <-timer.C:
+			publisher.publish(client)
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// nextPublishDelay returns the time left until the next report is due
+func (publisher *periodicStatePublisher) nextPublishDelay() time.Duration {
+	publisher.lock.Lock()
+	defer publisher.lock.Unlock()
+	delay := publisher.interval - publisher.now().Sub(publisher.lastPublished)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// publish sends a report to ACS unless one was already sent in the last
+// interval. It returns true if the report was sent
+func (publisher *periodicStatePublisher) publish(client wsclient.ClientServer) bool {
+	publisher.lock.Lock()
+	now := publisher.now()
+	if now.Sub(publisher.lastPublished) < publisher.interval {
+		publisher.lock.Unlock()
+		return false
+	}
+	// The report isn't retried if it can't be sent, the next one is due
+	// after the interval regardless
+	publisher.lastPublished = now
+	publisher.lock.Unlock()
+
+	report := publisher.report(now)
+	if err := client.MakeRequest(report); err != nil {
+		seelog.Warnf("Error publishing container instance state report to ACS: %v", err)
+		return false
+	}
+	seelog.Debugf("Published container instance state report with %d tasks to ACS, message id: %s",
+		len(report.Tasks), aws.StringValue(report.MessageId))
+	metrics.MetricsEngineGlobal.RecordACSEvent(stateReportPublishedEvent, 1)
+	return true
+}
+
+// report returns the current state of the tasks and containers managed by the agent
+func (publisher *periodicStatePublisher) report(generatedAt time.Time) *ecsacs.ContainerInstanceStateReport {
+	return &ecsacs.ContainerInstanceStateReport{
+		ClusterArn:           aws.String(publisher.cluster),
+		ContainerInstanceArn: aws.String(publisher.containerInstanceARN),
+		MessageId:            aws.String(uuid.New()),
+		GeneratedAt:          aws.Int64(generatedAt.UnixNano() / int64(time.Millisecond)),
+		Tasks:                taskStateReports(publisher.state),
+	}
+}
+
+// taskStateReports returns the current state of the tasks and containers in the state
+func taskStateReports(state dockerstate.TaskEngineState) []*ecsacs.TaskStateReport {
+	tasks := []*ecsacs.TaskStateReport{}
+	for _, task := range state.AllTasks() {
+		containers := []*ecsacs.ContainerStateReport{}
+		for _, container := range task.Containers {
+			containerReport := &ecsacs.ContainerStateReport{
+				Name:          aws.String(container.Name),
+				KnownStatus:   aws.String(container.GetKnownStatus().String()),
+				DesiredStatus: aws.String(container.GetDesiredStatus().String()),
+			}
+			if runtimeID := container.GetRuntimeID(); runtimeID != "" {
+				containerReport.RuntimeId = aws.String(runtimeID)
+			}
+			if exitCode := container.GetKnownExitCode(); exitCode != nil {
+				containerReport.ExitCode = aws.Int64(int64(*exitCode))
+			}
+			containers = append(containers, containerReport)
+		}
+		tasks = append(tasks, &ecsacs.TaskStateReport{
+			TaskArn:       aws.String(task.Arn),
+			KnownStatus:   aws.String(task.GetKnownStatus().String()),
+			DesiredStatus: aws.String(task.GetDesiredStatus().String()),
+			Containers:    containers,
+		})
+	}
+	return tasks
+}
@@ -0,0 +1,171 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testStateSyncInterval = 5 * time.Minute
+
+// testStatePublisher returns a publisher whose clock is controlled by the returned function
+func testStatePublisher(state dockerstate.TaskEngineState, interval time.Duration) (*periodicStatePublisher, func(time.Duration)) {
+	publisher := newPeriodicStatePublisher(clusterName, containerInstanceArn, state, interval)
+	now := publisher.lastPublished
+	publisher.now = func() time.Time { return now }
+	return publisher, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestStatePublisherReportContent(t *testing.T) {
+	exitCode := 137
+	stopped := &apicontainer.Container{Name: "stopped"}
+	stopped.SetKnownStatus(apicontainerstatus.ContainerStopped)
+	stopped.SetDesiredStatus(apicontainerstatus.ContainerStopped)
+	stopped.SetRuntimeID("runtime-stopped")
+	stopped.SetKnownExitCode(&exitCode)
+	pending := &apicontainer.Container{Name: "pending"}
+	pending.SetDesiredStatus(apicontainerstatus.ContainerRunning)
+
+	task := &apitask.Task{
+		Arn:        testTaskARN,
+		Containers: []*apicontainer.Container{stopped, pending},
+	}
+	task.SetKnownStatus(apitaskstatus.TaskRunning)
+	task.SetDesiredStatus(apitaskstatus.TaskStopped)
+	state := dockerstate.NewTaskEngineState()
+	state.AddTask(task)
+
+	publisher, _ := testStatePublisher(state, testStateSyncInterval)
+	generatedAt := time.Unix(1600000000, 0)
+	report := publisher.report(generatedAt)
+
+	assert.Equal(t, clusterName, aws.StringValue(report.ClusterArn))
+	assert.Equal(t, containerInstanceArn, aws.StringValue(report.ContainerInstanceArn))
+	assert.NotEmpty(t, aws.StringValue(report.MessageId))
+	assert.Equal(t, int64(1600000000000), aws.Int64Value(report.GeneratedAt))
+	require.Len(t, report.Tasks, 1)
+	taskReport := report.Tasks[0]
+	assert.Equal(t, testTaskARN, aws.StringValue(taskReport.TaskArn))
+	assert.Equal(t, "RUNNING", aws.StringValue(taskReport.KnownStatus))
+	assert.Equal(t, "STOPPED", aws.StringValue(taskReport.DesiredStatus))
+	assert.Equal(t, []*ecsacs.ContainerStateReport{
+		{
+			Name:          aws.String("stopped"),
+			RuntimeId:     aws.String("runtime-stopped"),
+			KnownStatus:   aws.String("STOPPED"),
+			DesiredStatus: aws.String("STOPPED"),
+			ExitCode:      aws.Int64(137),
+		},
+		{
+			Name:          aws.String("pending"),
+			KnownStatus:   aws.String("NONE"),
+			DesiredStatus: aws.String("RUNNING"),
+		},
+	}, taskReport.Containers)
+}
+
+func TestStatePublisherEmptyReport(t *testing.T) {
+	publisher, _ := testStatePublisher(dockerstate.NewTaskEngineState(), testStateSyncInterval)
+	report := publisher.report(time.Now())
+	assert.NotNil(t, report.Tasks)
+	assert.Empty(t, report.Tasks)
+}
+
+func TestStatePublisherRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	publisher, advance := testStatePublisher(dockerstate.NewTaskEngineState(), testStateSyncInterval)
+
+	// Nothing is published until an interval has elapsed since the publisher was created
+	assert.False(t, publisher.publish(mockWSClient))
+	assert.Equal(t, testStateSyncInterval, publisher.nextPublishDelay())
+
+	advance(testStateSyncInterval)
+	assert.Equal(t, time.Duration(0), publisher.nextPublishDelay())
+	mockWSClient.EXPECT().MakeRequest(gomock.Any()).Return(nil)
+	assert.True(t, publisher.publish(mockWSClient))
+
+	// A second report within the same interval is not sent
+	advance(testStateSyncInterval - time.Second)
+	assert.False(t, publisher.publish(mockWSClient))
+	assert.Equal(t, time.Second, publisher.nextPublishDelay())
+
+	advance(time.Second)
+	mockWSClient.EXPECT().MakeRequest(gomock.Any()).Return(nil)
+	assert.True(t, publisher.publish(mockWSClient))
+}
+
+func TestStatePublisherDoesNotRetryFailedReport(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	publisher, advance := testStatePublisher(dockerstate.NewTaskEngineState(), testStateSyncInterval)
+
+	advance(testStateSyncInterval)
+	mockWSClient.EXPECT().MakeRequest(gomock.Any()).Return(assert.AnError)
+	assert.False(t, publisher.publish(mockWSClient))
+	assert.False(t, publisher.publish(mockWSClient))
+	assert.Equal(t, testStateSyncInterval, publisher.nextPublishDelay())
+}
+
+func TestStatePublisherRunPublishesPeriodically(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	publisher := newPeriodicStatePublisher(clusterName, containerInstanceArn, dockerstate.NewTaskEngineState(),
+		20*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	published := make(chan *ecsacs.ContainerInstanceStateReport, 10)
+	mockWSClient.EXPECT().MakeRequest(gomock.Any()).Do(func(message interface{}) {
+		published <- message.(*ecsacs.ContainerInstanceStateReport)
+	}).Return(nil).MinTimes(2)
+
+	done := make(chan struct{})
+	go func() {
+		publisher.run(ctx, mockWSClient)
+		close(done)
+	}()
+	first := <-published
+	second := <-published
+	cancel()
+	<-done
+	assert.NotEqual(t, aws.StringValue(first.MessageId), aws.StringValue(second.MessageId))
+	assert.True(t, aws.Int64Value(second.GeneratedAt) >= aws.Int64Value(first.GeneratedAt)+20)
+}
+
+func TestNewStatePublisherDisabledWithZeroInterval(t *testing.T) {
+	publisher := newPeriodicStatePublisher(clusterName, containerInstanceArn, dockerstate.NewTaskEngineState(), 0)
+	assert.Nil(t, publisher)
+	// A disabled publisher doesn't send any report
+	publisher.run(context.Background(), nil)
+}
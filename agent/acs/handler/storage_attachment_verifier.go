@@ -0,0 +1,134 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// storageAttachmentRetryInterval is the interval at which the block devices
+	// of the host are listed again while verifying the EBS volumes of a task
+	storageAttachmentRetryInterval = time.Second
+	// resourceNotFoundReason prefixes the reason of the nacks of the payload
+	// messages whose EBS volumes aren't found on the host
+	resourceNotFoundReason = "RESOURCE_NOT_FOUND"
+	// ebsVolumeNotFoundEvent is recorded every time a payload message is nacked
+	// because the EBS volumes of one of its tasks aren't found on the host
+	ebsVolumeNotFoundEvent = "EBSVolumeNotFound"
+)
+
+// sysBlockPath is a variable so that it can be overridden in unit tests
+var sysBlockPath = "/sys/block"
+
+// StorageAttachmentVerifier verifies that the devices of the EBS volumes
+// attached to the tasks of a payload message are on the host before the tasks
+// are submitted to the task engine. Unlike the ebsVolumeAttachWaiter, which
+// starts the tasks anyway once it gives up waiting, the message is nacked when
+// the devices are still missing after the retries, so that ACS places the tasks
+// elsewhere instead of starting them without their volumes
+type StorageAttachmentVerifier struct {
+	ctx           context.Context
+	dataClient    data.Client
+	retries       int
+	retryInterval time.Duration
+}
+
+// newStorageAttachmentVerifier returns a new StorageAttachmentVerifier, nil if
+// the EBS volumes aren't verified
+func newStorageAttachmentVerifier(ctx context.Context, dataClient data.Client, retries int) *StorageAttachmentVerifier {
+	if retries <= 0 || dataClient == nil {
+		return nil
+	}
+	return &StorageAttachmentVerifier{
+		ctx:           ctx,
+		dataClient:    dataClient,
+		retries:       retries,
+		retryInterval: storageAttachmentRetryInterval,
+	}
+}
+
+// verify returns an error if the devices of the EBS volumes of the tasks of the
+// payload message to be started aren't in /sys/block, after listing the block
+// devices again up to the number of retries
+func (verifier *StorageAttachmentVerifier) verify(payload *ecsacs.PayloadMessage) error {
+	if verifier == nil {
+		return nil
+	}
+	taskDevices := make(map[string][]string)
+	for _, task := range payload.Tasks {
+		if task == nil || aws.StringValue(task.DesiredStatus) != apitaskstatus.TaskRunningString {
+			continue
+		}
+		taskARN := aws.StringValue(task.Arn)
+		if devices := ebsTaskDevices(verifier.dataClient, taskARN); len(devices) > 0 {
+			taskDevices[taskARN] = devices
+		}
+	}
+	if len(taskDevices) == 0 {
+		return nil
+	}
+	for attempt := 0; ; attempt++ {
+		missing, err := verifier.missingTaskDevices(taskDevices)
+		if err != nil {
+			seelog.Warnf("Unable to list the block devices of the host, not verifying the EBS volumes of payload message %s: %v",
+				aws.StringValue(payload.MessageId), err)
+			return nil
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		if attempt >= verifier.retries {
+			return fmt.Errorf("%s: EBS volume devices not found in %s: %s", resourceNotFoundReason, sysBlockPath,
+				strings.Join(missing, ", "))
+		}
+		select {
+		case <-time.After(verifier.retryInterval):
+		case <-verifier.ctx.Done():
+			return verifier.ctx.Err()
+		}
+	}
+}
+
+// missingTaskDevices returns the devices of the tasks that aren't in /sys/block,
+// as "<task arn>: <device>"
+func (verifier *StorageAttachmentVerifier) missingTaskDevices(taskDevices map[string][]string) ([]string, error) {
+	entries, err := ioutil.ReadDir(sysBlockPath)
+	if err != nil {
+		return nil, err
+	}
+	visible := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		visible[entry.Name()] = struct{}{}
+	}
+	var missing []string
+	for taskARN, devices := range taskDevices {
+		for _, device := range missingDevices(visible, devices) {
+			missing = append(missing, taskARN+": "+device)
+		}
+	}
+	sort.Strings(missing)
+	return missing, nil
+}
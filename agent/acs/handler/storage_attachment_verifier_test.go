@@ -0,0 +1,178 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSysBlock points the verifier to a temporary directory holding the block
+// devices and returns a function to add a device to it
+func setupSysBlock(t *testing.T, devices ...string) (func(string), func()) {
+	dir, err := ioutil.TempDir("", "storage_attachment_verifier_test")
+	require.NoError(t, err)
+	add := func(device string) {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, device), 0755))
+	}
+	for _, device := range devices {
+		add(device)
+	}
+	original := sysBlockPath
+	sysBlockPath = dir
+	return add, func() {
+		sysBlockPath = original
+		os.RemoveAll(dir)
+	}
+}
+
+func newTestStorageAttachmentVerifier(ctx context.Context, dataClient data.Client,
+	retries int) *StorageAttachmentVerifier {
+	verifier := newStorageAttachmentVerifier(ctx, dataClient, retries)
+	verifier.retryInterval = 10 * time.Millisecond
+	return verifier
+}
+
+func ebsPayload(desiredStatus string) *ecsacs.PayloadMessage {
+	return &ecsacs.PayloadMessage{
+		MessageId: aws.String(payloadMessageId),
+		Tasks: []*ecsacs.Task{{
+			Arn:           aws.String(ebsTaskARN),
+			DesiredStatus: aws.String(desiredStatus),
+		}},
+	}
+}
+
+func TestNewStorageAttachmentVerifierDisabled(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	verifier := newStorageAttachmentVerifier(context.Background(), dataClient, 0)
+	assert.Nil(t, verifier)
+	// A nil verifier accepts every message
+	assert.NoError(t, verifier.verify(ebsPayload("RUNNING")))
+}
+
+func TestStorageAttachmentVerifierDevicePresent(t *testing.T) {
+	testCases := []struct {
+		name       string
+		deviceName string
+		sysBlock   []string
+	}{
+		{
+			name:       "xvd device",
+			deviceName: "/dev/xvdf",
+			sysBlock:   []string{"xvda", "xvdf"},
+		},
+		{
+			name:       "sd device exposed as xvd device",
+			deviceName: "/dev/sdf",
+			sysBlock:   []string{"xvda", "xvdf"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, cleanupSysBlock := setupSysBlock(t, tc.sysBlock...)
+			defer cleanupSysBlock()
+			dataClient, cleanup := newTestDataClient(t)
+			defer cleanup()
+			saveEBSAttachment(t, dataClient, ebsTaskARN, tc.deviceName)
+
+			verifier := newTestStorageAttachmentVerifier(context.Background(), dataClient, 3)
+			assert.NoError(t, verifier.verify(ebsPayload("RUNNING")))
+		})
+	}
+}
+
+func TestStorageAttachmentVerifierNoAttachment(t *testing.T) {
+	_, cleanupSysBlock := setupSysBlock(t, "xvda")
+	defer cleanupSysBlock()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	// The attachments of other tasks are ignored
+	saveEBSAttachment(t, dataClient, "arn:aws:ecs:us-west-2:123456789012:task/default/other", "/dev/xvdg")
+
+	verifier := newTestStorageAttachmentVerifier(context.Background(), dataClient, 3)
+	assert.NoError(t, verifier.verify(ebsPayload("RUNNING")))
+}
+
+func TestStorageAttachmentVerifierIgnoresTasksToStop(t *testing.T) {
+	_, cleanupSysBlock := setupSysBlock(t, "xvda")
+	defer cleanupSysBlock()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	saveEBSAttachment(t, dataClient, ebsTaskARN, "/dev/xvdf")
+
+	verifier := newTestStorageAttachmentVerifier(context.Background(), dataClient, 3)
+	assert.NoError(t, verifier.verify(ebsPayload("STOPPED")))
+}
+
+func TestStorageAttachmentVerifierDeviceAppearsWhileRetrying(t *testing.T) {
+	addDevice, cleanupSysBlock := setupSysBlock(t, "xvda")
+	defer cleanupSysBlock()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	saveEBSAttachment(t, dataClient, ebsTaskARN, "/dev/xvdf")
+
+	verifier := newTestStorageAttachmentVerifier(context.Background(), dataClient, 100)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		addDevice("xvdf")
+	}()
+	assert.NoError(t, verifier.verify(ebsPayload("RUNNING")))
+}
+
+func TestStorageAttachmentVerifierDeviceMissing(t *testing.T) {
+	_, cleanupSysBlock := setupSysBlock(t, "xvda")
+	defer cleanupSysBlock()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	saveEBSAttachment(t, dataClient, ebsTaskARN, "/dev/xvdf")
+
+	verifier := newTestStorageAttachmentVerifier(context.Background(), dataClient, 3)
+	start := time.Now()
+	err := verifier.verify(ebsPayload("RUNNING"))
+	require.Error(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), resourceNotFoundReason), err.Error())
+	assert.Contains(t, err.Error(), ebsTaskARN+": /dev/xvdf")
+	// The devices are listed again for every retry
+	assert.True(t, time.Since(start) >= 3*verifier.retryInterval)
+}
+
+func TestStorageAttachmentVerifierSysBlockUnreadable(t *testing.T) {
+	original := sysBlockPath
+	sysBlockPath = filepath.Join(os.TempDir(), "storage_attachment_verifier_test_missing")
+	defer func() { sysBlockPath = original }()
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+	saveEBSAttachment(t, dataClient, ebsTaskARN, "/dev/xvdf")
+
+	// The message isn't nacked when the block devices can't be listed
+	verifier := newTestStorageAttachmentVerifier(context.Background(), dataClient, 3)
+	assert.NoError(t, verifier.verify(ebsPayload("RUNNING")))
+}
@@ -0,0 +1,173 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	// notifySocketEnvVar is the environment variable set by systemd to the
+	// socket to which notifications are sent
+	notifySocketEnvVar = "NOTIFY_SOCKET"
+	// watchdogUsecEnvVar is the environment variable set by systemd to the
+	// watchdog timeout, in microseconds, when the watchdog is enabled
+	watchdogUsecEnvVar = "WATCHDOG_USEC"
+	// watchdogPIDEnvVar is the environment variable set by systemd to the pid
+	// of the process expected to send the keepalives
+	watchdogPIDEnvVar = "WATCHDOG_PID"
+	// watchdogKeepalive is the notification resetting the systemd watchdog
+	watchdogKeepalive = "WATCHDOG=1"
+)
+
+// SystemdNotifyHook is a SessionRecoveryHook that feeds the systemd watchdog of
+// the agent service. Keepalives are sent while the session with ACS is healthy,
+// and stop being sent once the session has failed maxConsecutiveFailures times
+// in a row or has been disconnected for longer than the watchdog timeout, which
+// makes systemd restart the agent. It doesn't do anything if the watchdog isn't
+// enabled for the service
+type SystemdNotifyHook struct {
+	maxConsecutiveFailures int
+	lock                   sync.RWMutex
+	failed                 bool
+	// disconnectedSince is the time at which the session was first disconnected
+	// from ACS, zero while connected
+	disconnectedSince time.Time
+	// notify sends a notification to systemd, it's a field so that it can be
+	// overridden in tests
+	notify func(state string) error
+	// now returns the current time, it is overridden in unit tests
+	now func() time.Time
+}
+
+// NewSystemdNotifyHook returns a new SystemdNotifyHook object
+func NewSystemdNotifyHook(maxConsecutiveFailures int) *SystemdNotifyHook {
+	return &SystemdNotifyHook{
+		maxConsecutiveFailures: maxConsecutiveFailures,
+		notify:                 sdNotify,
+		now:                    time.Now,
+	}
+}
+
+// OnSessionFailed marks the session as failed once it has failed too many times
+// in a row. The session is healthy again after a failure following a successful
+// connection to ACS
+func (hook *SystemdNotifyHook) OnSessionFailed(reason string, consecutiveFailures int) {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	failed := consecutiveFailures >= hook.maxConsecutiveFailures
+	if failed && !hook.failed {
+		seelog.Criticalf("ACS session failed %d times in a row, stopping systemd watchdog keepalives: %s",
+			consecutiveFailures, reason)
+	}
+	hook.failed = failed
+	if consecutiveFailures <= 1 || hook.disconnectedSince.IsZero() {
+		hook.disconnectedSince = hook.now()
+	}
+}
+
+// OnSessionConnected marks the session as healthy
+func (hook *SystemdNotifyHook) OnSessionConnected() {
+	hook.lock.Lock()
+	defer hook.lock.Unlock()
+	hook.failed = false
+	hook.disconnectedSince = time.Time{}
+}
+
+// healthy returns false if the session has failed too many times in a row or
+// has been disconnected for longer than the watchdog timeout
+func (hook *SystemdNotifyHook) healthy(watchdogTimeout time.Duration) bool {
+	hook.lock.RLock()
+	defer hook.lock.RUnlock()
+	if hook.failed {
+		return false
+	}
+	return hook.disconnectedSince.IsZero() || hook.now().Sub(hook.disconnectedSince) <= watchdogTimeout
+}
+
+// Start sends keepalives to the systemd watchdog, at half the watchdog timeout,
+// until the context is canceled
+func (hook *SystemdNotifyHook) Start(ctx context.Context) {
+	interval, err := watchdogInterval()
+	if err != nil {
+		seelog.Warnf("Unable to determine the systemd watchdog timeout, not sending keepalives: %v", err)
+		return
+	}
+	if interval == 0 {
+		seelog.Debug("Systemd watchdog not enabled, not sending keepalives")
+		return
+	}
+	seelog.Infof("Sending systemd watchdog keepalives every %s", interval.String())
+	go hook.sendKeepalives(ctx, interval)
+}
+
+// sendKeepalives sends a keepalive every interval, half the watchdog timeout,
+// while the session is healthy
+func (hook *SystemdNotifyHook) sendKeepalives(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if hook.healthy(2 * interval) {
+			if err := hook.notify(watchdogKeepalive); err != nil {
+				seelog.Warnf("Unable to send systemd watchdog keepalive: %v", err)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watchdogInterval returns the interval at which keepalives must be sent, or
+// zero if the watchdog isn't enabled for this process
+func watchdogInterval() (time.Duration, error) {
+	usecEnv := os.Getenv(watchdogUsecEnvVar)
+	if usecEnv == "" {
+		return 0, nil
+	}
+	if pidEnv := os.Getenv(watchdogPIDEnvVar); pidEnv != "" && pidEnv != strconv.Itoa(os.Getpid()) {
+		// The watchdog is meant for another process
+		return 0, nil
+	}
+	usec, err := strconv.ParseInt(usecEnv, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, errors.Errorf("invalid %s: %s", watchdogUsecEnvVar, usecEnv)
+	}
+	return time.Duration(usec) * time.Microsecond / 2, nil
+}
+
+// sdNotify sends the state to the systemd notification socket
+func sdNotify(state string) error {
+	socket := os.Getenv(notifySocketEnvVar)
+	if socket == "" {
+		return errors.Errorf("%s not set", notifySocketEnvVar)
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,232 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemdNotifyHookOnSessionFailed(t *testing.T) {
+	hook := NewSystemdNotifyHook(3)
+	hook.OnSessionFailed("error", 1)
+	hook.OnSessionFailed("error", 2)
+	assert.False(t, hook.failed)
+	hook.OnSessionFailed("error", 3)
+	assert.True(t, hook.failed)
+	hook.OnSessionFailed("error", 4)
+	assert.True(t, hook.failed)
+	// The session failing once after a successful connection means it has recovered
+	hook.OnSessionFailed("error", 1)
+	assert.False(t, hook.failed)
+}
+
+func TestSystemdNotifyHookStopsKeepalivesWhenFailed(t *testing.T) {
+	var lock sync.Mutex
+	keepalives := 0
+	hook := NewSystemdNotifyHook(1)
+	hook.notify = func(state string) error {
+		assert.Equal(t, watchdogKeepalive, state)
+		lock.Lock()
+		defer lock.Unlock()
+		keepalives++
+		return nil
+	}
+	sent := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return keepalives
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hook.sendKeepalives(ctx, time.Millisecond)
+	for sent() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	hook.OnSessionFailed("error", 1)
+	// Let an in-flight keepalive go through before sampling the count
+	time.Sleep(10 * time.Millisecond)
+	count := sent()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, count, sent(), "No keepalive expected once the session has failed")
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	testCases := []struct {
+		name        string
+		usec        string
+		pid         string
+		expected    time.Duration
+		expectError bool
+	}{
+		{
+			name: "watchdog not enabled",
+		},
+		{
+			name:     "watchdog enabled",
+			usec:     "30000000",
+			expected: 15 * time.Second,
+		},
+		{
+			name:     "watchdog enabled for this process",
+			usec:     "30000000",
+			pid:      strconv.Itoa(os.Getpid()),
+			expected: 15 * time.Second,
+		},
+		{
+			name: "watchdog enabled for another process",
+			usec: "30000000",
+			pid:  strconv.Itoa(os.Getpid() + 1),
+		},
+		{
+			name:        "invalid timeout",
+			usec:        "invalid",
+			expectError: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Setenv(watchdogUsecEnvVar, tc.usec)
+			defer os.Unsetenv(watchdogUsecEnvVar)
+			os.Setenv(watchdogPIDEnvVar, tc.pid)
+			defer os.Unsetenv(watchdogPIDEnvVar)
+
+			interval, err := watchdogInterval()
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, interval)
+		})
+	}
+}
+
+func TestSdNotify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdnotify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	os.Setenv(notifySocketEnvVar, socket)
+	defer os.Unsetenv(notifySocketEnvVar)
+	require.NoError(t, sdNotify(watchdogKeepalive))
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, watchdogKeepalive, string(buf[:n]))
+}
+
+func TestSdNotifyNoSocket(t *testing.T) {
+	os.Unsetenv(notifySocketEnvVar)
+	assert.Error(t, sdNotify(watchdogKeepalive))
+}
+
+func TestSystemdNotifyHookUnhealthyWhenDisconnectedTooLong(t *testing.T) {
+	now := time.Now()
+	hook := NewSystemdNotifyHook(10)
+	hook.now = func() time.Time { return now }
+	assert.True(t, hook.healthy(time.Minute))
+
+	hook.OnSessionFailed("error", 1)
+	now = now.Add(30 * time.Second)
+	hook.OnSessionFailed("error", 2)
+	assert.True(t, hook.healthy(time.Minute))
+
+	// The disconnection is timed from the first failure
+	now = now.Add(31 * time.Second)
+	assert.False(t, hook.healthy(time.Minute))
+
+	hook.OnSessionConnected()
+	assert.True(t, hook.healthy(time.Minute))
+}
+
+func TestSystemdNotifyHookOnSessionConnectedClearsFailure(t *testing.T) {
+	hook := NewSystemdNotifyHook(1)
+	hook.OnSessionFailed("error", 1)
+	assert.False(t, hook.healthy(time.Minute))
+
+	hook.OnSessionConnected()
+	assert.True(t, hook.healthy(time.Minute))
+}
+
+// TestSystemdNotifyHookKeepalivesOnNotifySocket tests that keepalives are sent
+// to the notify socket and stop once the session has been disconnected for
+// longer than the watchdog timeout
+func TestSystemdNotifyHookKeepalivesOnNotifySocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sdnotify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+	os.Setenv(notifySocketEnvVar, socket)
+	defer os.Unsetenv(notifySocketEnvVar)
+
+	var lock sync.Mutex
+	now := time.Now()
+	hook := NewSystemdNotifyHook(10)
+	hook.now = func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go hook.sendKeepalives(ctx, 5*time.Millisecond)
+
+	buf := make([]byte, 64)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, watchdogKeepalive, string(buf[:n]))
+
+	hook.OnSessionFailed("error", 1)
+	lock.Lock()
+	now = now.Add(time.Second)
+	lock.Unlock()
+	// Drain the keepalives sent before the disconnection timed out
+	for {
+		conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = conn.Read(buf)
+	assert.Error(t, err, "No keepalive expected once the session has been disconnected for too long")
+}
@@ -0,0 +1,297 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// defaultTaskDrainTimeout is the time to wait for the tasks to stop when the
+	// TaskDrainMessage does not specify a drain timeout
+	defaultTaskDrainTimeout = 10 * time.Minute
+	// taskDrainPollInterval is the interval at which the status of a task being
+	// drained is checked
+	taskDrainPollInterval = time.Second
+	// taskDrainTimedOutEvent is the ACS event recorded for every task that did
+	// not stop within the drain timeout
+	taskDrainTimedOutEvent = "TaskDrainTimedOut"
+)
+
+// taskDrainState records whether the container instance is being drained. It is
+// shared across connections to ACS so that payloads received after reconnecting
+// are rejected as well. Once set by a task drain message, the instance stays in
+// the draining state until the agent is restarted, since it is expected to be
+// deregistered. The DRAINING status set on the container instance by ACS is
+// persisted and restored on restart instead, until ACS sets it back to ACTIVE
+type taskDrainState struct {
+	lock     sync.RWMutex
+	draining bool
+}
+
+// isDraining returns true if the container instance is being drained
+func (state *taskDrainState) isDraining() bool {
+	if state == nil {
+		return false
+	}
+	state.lock.RLock()
+	defer state.lock.RUnlock()
+	return state.draining
+}
+
+// setDraining marks the container instance as being drained
+func (state *taskDrainState) setDraining() {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.draining = true
+}
+
+// setActive marks the container instance as accepting new tasks again
+func (state *taskDrainState) setActive() {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.draining = false
+}
+
+// loadTaskDrainState returns the drain state of the container instance, draining
+// if ACS set the status of the container instance to DRAINING before the agent
+// was restarted
+func loadTaskDrainState(dataClient data.Client) *taskDrainState {
+	state := &taskDrainState{}
+	if dataClient == nil {
+		return state
+	}
+	status, err := dataClient.GetMetadata(data.ContainerInstanceStatusKey)
+	if err != nil {
+		// The status is only saved once ACS has changed it
+		return state
+	}
+	if status == containerInstanceStatusDraining {
+		seelog.Info("Container instance status is DRAINING, not accepting new tasks")
+		state.draining = true
+	}
+	return state
+}
+
+// taskDrainHandler handles the task drain messages sent by ACS before the
+// container instance is deregistered. Draining stops the instance from accepting
+// new tasks and gracefully stops the existing ones in reverse dependency order
+type taskDrainHandler struct {
+	messageBuffer        chan *ecsacs.TaskDrainMessage
+	ctx                  context.Context
+	cancel               context.CancelFunc
+	cluster              string
+	containerInstanceArn string
+	acsClient            wsclient.ClientServer
+	taskEngine           engine.TaskEngine
+	drainState           *taskDrainState
+	pollInterval         time.Duration
+	*inFlightAckTracker
+	routines *handlerRoutines
+}
+
+// newTaskDrainHandler returns an instance of the taskDrainHandler struct
+func newTaskDrainHandler(ctx context.Context,
+	cluster string, containerInstanceArn string, acsClient wsclient.ClientServer,
+	taskEngine engine.TaskEngine, drainState *taskDrainState) taskDrainHandler {
+
+	// Create a cancelable context from the parent context
+	derivedContext, cancel := context.WithCancel(ctx)
+	return taskDrainHandler{
+		messageBuffer:        make(chan *ecsacs.TaskDrainMessage),
+		ctx:                  derivedContext,
+		cancel:               cancel,
+		cluster:              cluster,
+		containerInstanceArn: containerInstanceArn,
+		acsClient:            acsClient,
+		taskEngine:           taskEngine,
+		drainState:           drainState,
+		pollInterval:         taskDrainPollInterval,
+		inFlightAckTracker:   newInFlightAckTracker(),
+		routines:             &handlerRoutines{},
+	}
+}
+
+// handlerFunc returns the request handler function for the TaskDrainMessage.
+// Messages received while a drain is in progress are dropped, ACS resends the
+// message if it is not acked
+func (handler *taskDrainHandler) handlerFunc() func(message *ecsacs.TaskDrainMessage) {
+	return func(message *ecsacs.TaskDrainMessage) {
+		handler.trackReceived("TaskDrainMessage", aws.StringValue(message.MessageId))
+		select {
+		case handler.messageBuffer <- message:
+		default:
+			handler.trackAcked(aws.StringValue(message.MessageId))
+			seelog.Infof("Task drain already in progress, ignoring task drain message: %s",
+				aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// start invokes go routines to handle task drain messages
+func (handler *taskDrainHandler) start() {
+	handler.routines.run(handler.handleMessages)
+}
+
+// stop is used to invoke a cancellation function
+func (handler *taskDrainHandler) stop() {
+	handler.cancel()
+}
+
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (handler *taskDrainHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, handler.stop, handler.routines, nil)
+}
+
+func (handler *taskDrainHandler) handleMessages() {
+	for {
+		select {
+		case <-handler.ctx.Done():
+			return
+		case message := <-handler.messageBuffer:
+			if err := handler.handleSingleMessage(message); err != nil {
+				seelog.Warnf("Unable to handle task drain message [%s]: %v", message.String(), err)
+			}
+			handler.trackAcked(aws.StringValue(message.MessageId))
+		}
+	}
+}
+
+// handleSingleMessage drains the container instance and acks the message once
+// all the tasks have stopped or the drain timeout has elapsed
+func (handler *taskDrainHandler) handleSingleMessage(message *ecsacs.TaskDrainMessage) error {
+	if message.MessageId == nil {
+		return fmt.Errorf("task drain handler: message id not set in message")
+	}
+	messageID := aws.StringValue(message.MessageId)
+
+	// Stop accepting new tasks before stopping the existing ones
+	handler.drainState.setDraining()
+
+	drainTimeout := defaultTaskDrainTimeout
+	if timeoutSeconds := aws.Int64Value(message.DrainTimeoutSeconds); timeoutSeconds > 0 {
+		drainTimeout = time.Duration(timeoutSeconds) * time.Second
+	}
+	seelog.Infof("Draining container instance, message id: %s, drain timeout: %s", messageID, drainTimeout.String())
+
+	tasks, err := handler.tasksToDrain(message.Tasks)
+	if err != nil {
+		return err
+	}
+
+	drainCtx, cancel := context.WithTimeout(handler.ctx, drainTimeout)
+	defer cancel()
+	handler.drainTasks(drainCtx, tasks)
+	if handler.ctx.Err() != nil {
+		return handler.ctx.Err()
+	}
+
+	tasksNotStopped := 0
+	for _, task := range tasks {
+		if task.GetKnownStatus() < apitaskstatus.TaskStopped {
+			seelog.Warnf("Task %s did not stop within the drain timeout of %s", task.Arn, drainTimeout.String())
+			tasksNotStopped++
+		}
+	}
+	metrics.MetricsEngineGlobal.RecordACSEvent(taskDrainTimedOutEvent, tasksNotStopped)
+
+	seelog.Infof("Container instance drained, %d tasks stopped, %d tasks did not stop in time, message id: %s",
+		len(tasks)-tasksNotStopped, tasksNotStopped, messageID)
+	return handler.acsClient.MakeRequest(&ecsacs.AckRequest{
+		Cluster:           aws.String(handler.cluster),
+		ContainerInstance: aws.String(handler.containerInstanceArn),
+		MessageId:         message.MessageId,
+	})
+}
+
+// tasksToDrain returns the running tasks to be drained in dependency order, that
+// is, a task only depends on tasks that appear before it. ACS lists the tasks in
+// dependency order in the message. If no task is listed, all the running tasks
+// on the instance are drained, ordered by the time they started
+func (handler *taskDrainHandler) tasksToDrain(taskIdentifiers []*ecsacs.TaskIdentifier) ([]*apitask.Task, error) {
+	var tasks []*apitask.Task
+	if len(taskIdentifiers) == 0 {
+		runningTasks, err := handler.taskEngine.ListTasks()
+		if err != nil {
+			return nil, err
+		}
+		for _, task := range runningTasks {
+			if task.GetDesiredStatus() == apitaskstatus.TaskRunning {
+				tasks = append(tasks, task)
+			}
+		}
+		sort.SliceStable(tasks, func(i, j int) bool {
+			return tasks[i].GetPullStartedAt().Before(tasks[j].GetPullStartedAt())
+		})
+		return tasks, nil
+	}
+
+	for _, taskIdentifier := range taskIdentifiers {
+		if taskIdentifier == nil {
+			continue
+		}
+		task, ok := handler.taskEngine.GetTaskByArn(aws.StringValue(taskIdentifier.TaskArn))
+		if !ok {
+			seelog.Debugf("Task to drain not found on the instance: %s", aws.StringValue(taskIdentifier.TaskArn))
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// drainTasks stops the tasks in reverse dependency order, waiting for each task
+// to stop before stopping the next one. Once the drain timeout has elapsed, the
+// remaining tasks are stopped without waiting
+func (handler *taskDrainHandler) drainTasks(ctx context.Context, tasks []*apitask.Task) {
+	for i := len(tasks) - 1; i >= 0; i-- {
+		task := tasks[i]
+		if task.GetKnownStatus() >= apitaskstatus.TaskStopped {
+			continue
+		}
+		seelog.Infof("Stopping task from task drain handler: %s", task.Arn)
+		task.SetDesiredStatus(apitaskstatus.TaskStopped)
+		handler.taskEngine.AddTask(task)
+		if ctx.Err() == nil {
+			handler.waitForTaskStopped(ctx, task)
+		}
+	}
+}
+
+// waitForTaskStopped waits for the task to stop or for the context to be done
+func (handler *taskDrainHandler) waitForTaskStopped(ctx context.Context, task *apitask.Task) {
+	ticker := time.NewTicker(handler.pollInterval)
+	defer ticker.Stop()
+	for task.GetKnownStatus() < apitaskstatus.TaskStopped {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,183 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	drainTestCluster              = "mock-cluster"
+	drainTestContainerInstanceArn = "mock-container-instance"
+	drainTestMessageId            = "mock-message-id"
+)
+
+func newTestTaskDrainHandler(ctrl *gomock.Controller) (taskDrainHandler, *mock_engine.MockTaskEngine,
+	*mock_wsclient.MockClientServer) {
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
+	handler := newTaskDrainHandler(context.TODO(), drainTestCluster, drainTestContainerInstanceArn,
+		mockWSClient, taskEngine, &taskDrainState{})
+	handler.pollInterval = 10 * time.Millisecond
+	return handler, taskEngine, mockWSClient
+}
+
+func newDrainTestTask(arn string) *apitask.Task {
+	return &apitask.Task{
+		Arn:                 arn,
+		DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+		KnownStatusUnsafe:   apitaskstatus.TaskRunning,
+	}
+}
+
+func drainTestAckRequest() *ecsacs.AckRequest {
+	return &ecsacs.AckRequest{
+		Cluster:           aws.String(drainTestCluster),
+		ContainerInstance: aws.String(drainTestContainerInstanceArn),
+		MessageId:         aws.String(drainTestMessageId),
+	}
+}
+
+// Tests that the tasks listed in the drain message are stopped in reverse order
+func TestTaskDrainHandlerStopsTasksInReverseDependencyOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	handler, taskEngine, mockWSClient := newTestTaskDrainHandler(ctrl)
+
+	task1 := newDrainTestTask("arn1")
+	task2 := newDrainTestTask("arn2")
+	taskEngine.EXPECT().GetTaskByArn("arn1").Return(task1, true)
+	taskEngine.EXPECT().GetTaskByArn("arn2").Return(task2, true)
+	taskEngine.EXPECT().GetTaskByArn("arn3").Return(nil, false)
+
+	var stoppedTasks []string
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		assert.Equal(t, apitaskstatus.TaskStopped, task.GetDesiredStatus())
+		stoppedTasks = append(stoppedTasks, task.Arn)
+		task.SetKnownStatus(apitaskstatus.TaskStopped)
+	}).Times(2)
+	mockWSClient.EXPECT().MakeRequest(drainTestAckRequest()).Return(nil)
+
+	err := handler.handleSingleMessage(&ecsacs.TaskDrainMessage{
+		MessageId: aws.String(drainTestMessageId),
+		Tasks: []*ecsacs.TaskIdentifier{
+			{TaskArn: aws.String("arn1")},
+			{TaskArn: aws.String("arn2")},
+			{TaskArn: aws.String("arn3")},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"arn2", "arn1"}, stoppedTasks)
+	assert.True(t, handler.drainState.isDraining())
+}
+
+// Tests that all the running tasks are drained, latest started first, when the
+// drain message doesn't list any task
+func TestTaskDrainHandlerDrainsAllRunningTasks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	handler, taskEngine, mockWSClient := newTestTaskDrainHandler(ctrl)
+
+	now := time.Now()
+	olderTask := newDrainTestTask("older")
+	olderTask.SetPullStartedAt(now.Add(-time.Hour))
+	newerTask := newDrainTestTask("newer")
+	newerTask.SetPullStartedAt(now)
+	stoppingTask := newDrainTestTask("stopping")
+	stoppingTask.SetDesiredStatus(apitaskstatus.TaskStopped)
+	taskEngine.EXPECT().ListTasks().Return([]*apitask.Task{newerTask, stoppingTask, olderTask}, nil)
+
+	var stoppedTasks []string
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		stoppedTasks = append(stoppedTasks, task.Arn)
+		task.SetKnownStatus(apitaskstatus.TaskStopped)
+	}).Times(2)
+	mockWSClient.EXPECT().MakeRequest(drainTestAckRequest()).Return(nil)
+
+	err := handler.handleSingleMessage(&ecsacs.TaskDrainMessage{
+		MessageId: aws.String(drainTestMessageId),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"newer", "older"}, stoppedTasks)
+}
+
+// Tests that the remaining tasks are stopped and the message is acked when the
+// tasks don't stop within the drain timeout
+func TestTaskDrainHandlerTimeout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	handler, taskEngine, mockWSClient := newTestTaskDrainHandler(ctrl)
+
+	task1 := newDrainTestTask("arn1")
+	task2 := newDrainTestTask("arn2")
+	taskEngine.EXPECT().GetTaskByArn("arn1").Return(task1, true)
+	taskEngine.EXPECT().GetTaskByArn("arn2").Return(task2, true)
+	taskEngine.EXPECT().AddTask(gomock.Any()).Times(2)
+	mockWSClient.EXPECT().MakeRequest(drainTestAckRequest()).Return(nil)
+
+	err := handler.handleSingleMessage(&ecsacs.TaskDrainMessage{
+		MessageId:           aws.String(drainTestMessageId),
+		DrainTimeoutSeconds: aws.Int64(1),
+		Tasks: []*ecsacs.TaskIdentifier{
+			{TaskArn: aws.String("arn1")},
+			{TaskArn: aws.String("arn2")},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, apitaskstatus.TaskStopped, task1.GetDesiredStatus())
+	assert.Equal(t, apitaskstatus.TaskStopped, task2.GetDesiredStatus())
+}
+
+// Tests that the drain message is not acked if the handler is stopped while draining
+func TestTaskDrainHandlerStoppedWhileDraining(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	handler, taskEngine, _ := newTestTaskDrainHandler(ctrl)
+
+	task1 := newDrainTestTask("arn1")
+	taskEngine.EXPECT().GetTaskByArn("arn1").Return(task1, true)
+	taskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		handler.stop()
+	})
+
+	err := handler.handleSingleMessage(&ecsacs.TaskDrainMessage{
+		MessageId: aws.String(drainTestMessageId),
+		Tasks:     []*ecsacs.TaskIdentifier{{TaskArn: aws.String("arn1")}},
+	})
+	assert.Error(t, err)
+}
+
+func TestTaskDrainHandlerMessageWithoutMessageId(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	handler, _, _ := newTestTaskDrainHandler(ctrl)
+
+	err := handler.handleSingleMessage(&ecsacs.TaskDrainMessage{})
+	assert.Error(t, err)
+	assert.False(t, handler.drainState.isDraining())
+}
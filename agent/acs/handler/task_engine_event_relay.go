@@ -0,0 +1,148 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
+	"github.com/aws/amazon-ecs-agent/agent/statechange"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+	"github.com/pborman/uuid"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// taskEngineEventBufferSize is the number of task engine events buffered
+	// while they can't be relayed to ACS, further events are dropped
+	taskEngineEventBufferSize = 1000
+	// taskEngineEventDroppedEvent is the ACS event recorded when a task engine
+	// event is dropped because the buffer is full
+	taskEngineEventDroppedEvent = "TaskEngineEventDropped"
+
+	// Types of the task engine events relayed to ACS
+	containerStartedEventType   = "ContainerStarted"
+	containerStoppedEventType   = "ContainerStopped"
+	containerOOMKilledEventType = "ContainerOOMKilled"
+)
+
+// TaskEngineEventRelay relays the significant state changes of the containers
+// managed by the task engine to ACS, which otherwise has no visibility into what
+// happens to a task once it's delivered. Events are buffered while the agent
+// isn't connected to ACS, and relayed at a limited rate so that a burst of state
+// changes doesn't flood the connection
+type TaskEngineEventRelay struct {
+	cluster              string
+	containerInstanceARN string
+	events               chan *ecsacs.TaskEngineEventMessage
+	limiter              *rate.Limiter
+}
+
+// newTaskEngineEventRelay returns a new TaskEngineEventRelay relaying at most
+// maxRate events per second
+func newTaskEngineEventRelay(cluster, containerInstanceARN string, maxRate int) *TaskEngineEventRelay {
+	if maxRate <= 0 {
+		maxRate = config.DefaultACSEventRelayMaxRate
+	}
+	return &TaskEngineEventRelay{
+		cluster:              cluster,
+		containerInstanceARN: containerInstanceARN,
+		events:               make(chan *ecsacs.TaskEngineEventMessage, taskEngineEventBufferSize),
+		limiter:              rate.NewLimiter(rate.Limit(maxRate), 1),
+	}
+}
+
+// observe buffers the message of the state change event if it's significant.
+// It doesn't block, the message is dropped if the buffer is full
+func (relay *TaskEngineEventRelay) observe(event statechange.Event) {
+	message := relay.message(event)
+	if message == nil {
+		return
+	}
+	select {
+	case relay.events <- message:
+	default:
+		seelog.Warnf("Dropping %s event of container %s of task %s, too many events are waiting to be relayed to ACS",
+			aws.StringValue(message.EventType), aws.StringValue(message.ContainerName), aws.StringValue(message.TaskArn))
+		metrics.MetricsEngineGlobal.RecordACSEvent(taskEngineEventDroppedEvent, 1)
+	}
+}
+
+// message returns the message relaying the state change event to ACS, or nil if
+// the event isn't relayed
+func (relay *TaskEngineEventRelay) message(event statechange.Event) *ecsacs.TaskEngineEventMessage {
+	change, ok := event.(api.ContainerStateChange)
+	if !ok {
+		return nil
+	}
+	var eventType string
+	switch change.Status {
+	case apicontainerstatus.ContainerRunning:
+		eventType = containerStartedEventType
+	case apicontainerstatus.ContainerStopped:
+		eventType = containerStoppedEventType
+		if strings.HasPrefix(change.Reason, dockerapi.OutOfMemoryError{}.ErrorName()) {
+			eventType = containerOOMKilledEventType
+		}
+	default:
+		return nil
+	}
+	message := &ecsacs.TaskEngineEventMessage{
+		ClusterArn:           aws.String(relay.cluster),
+		ContainerInstanceArn: aws.String(relay.containerInstanceARN),
+		MessageId:            aws.String(uuid.New()),
+		TaskArn:              aws.String(change.TaskArn),
+		ContainerName:        aws.String(change.ContainerName),
+		EventType:            aws.String(eventType),
+		Timestamp:            aws.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
+	}
+	if change.Reason != "" {
+		message.Reason = aws.String(change.Reason)
+	}
+	return message
+}
+
+// run relays the buffered events to ACS through the client until the context
+// is cancelled. An event that can't be sent is dropped
+func (relay *TaskEngineEventRelay) run(ctx context.Context, client wsclient.ClientServer) {
+	if relay == nil {
+		return
+	}
+	for {
+		// Wait for the rate limit before taking an event, so that no event is
+		// lost when the context is cancelled while waiting
+		if err := relay.limiter.Wait(ctx); err != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case message := <-relay.events:
+			if err := client.MakeRequest(message); err != nil {
+				seelog.Warnf("Error relaying %s event of container %s of task %s to ACS: %v",
+					aws.StringValue(message.EventType), aws.StringValue(message.ContainerName),
+					aws.StringValue(message.TaskArn), err)
+			}
+		}
+	}
+}
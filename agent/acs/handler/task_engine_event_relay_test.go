@@ -0,0 +1,195 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/eventhandler"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testContainerStateChange(status apicontainerstatus.ContainerStatus, reason string) api.ContainerStateChange {
+	return api.ContainerStateChange{
+		TaskArn:       testTaskARN,
+		ContainerName: "container",
+		Status:        status,
+		Reason:        reason,
+	}
+}
+
+func TestTaskEngineEventRelayMessage(t *testing.T) {
+	testCases := []struct {
+		name      string
+		event     api.ContainerStateChange
+		eventType string
+	}{
+		{
+			name:      "started",
+			event:     testContainerStateChange(apicontainerstatus.ContainerRunning, ""),
+			eventType: containerStartedEventType,
+		},
+		{
+			name:      "stopped",
+			event:     testContainerStateChange(apicontainerstatus.ContainerStopped, "Essential container exited"),
+			eventType: containerStoppedEventType,
+		},
+		{
+			name:      "oom killed",
+			event:     testContainerStateChange(apicontainerstatus.ContainerStopped, "OutOfMemoryError: Container killed due to memory usage"),
+			eventType: containerOOMKilledEventType,
+		},
+	}
+	relay := newTaskEngineEventRelay(clusterName, containerInstanceArn, 0)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			message := relay.message(tc.event)
+			require.NotNil(t, message)
+			assert.Equal(t, clusterName, aws.StringValue(message.ClusterArn))
+			assert.Equal(t, containerInstanceArn, aws.StringValue(message.ContainerInstanceArn))
+			assert.NotEmpty(t, aws.StringValue(message.MessageId))
+			assert.Equal(t, testTaskARN, aws.StringValue(message.TaskArn))
+			assert.Equal(t, "container", aws.StringValue(message.ContainerName))
+			assert.Equal(t, tc.eventType, aws.StringValue(message.EventType))
+			assert.Equal(t, tc.event.Reason, aws.StringValue(message.Reason))
+			assert.NotZero(t, aws.Int64Value(message.Timestamp))
+		})
+	}
+}
+
+func TestTaskEngineEventRelayIgnoresInsignificantEvents(t *testing.T) {
+	relay := newTaskEngineEventRelay(clusterName, containerInstanceArn, 0)
+	relay.observe(testContainerStateChange(apicontainerstatus.ContainerPulled, ""))
+	relay.observe(api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning})
+	assert.Len(t, relay.events, 0)
+}
+
+func TestTaskEngineEventRelayDropsEventsWhenBufferIsFull(t *testing.T) {
+	relay := newTaskEngineEventRelay(clusterName, containerInstanceArn, 0)
+	for i := 0; i < taskEngineEventBufferSize+10; i++ {
+		relay.observe(testContainerStateChange(apicontainerstatus.ContainerRunning, ""))
+	}
+	assert.Len(t, relay.events, taskEngineEventBufferSize)
+}
+
+func TestTaskEngineEventRelayDeliversEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+
+	relay := newTaskEngineEventRelay(clusterName, containerInstanceArn, 100)
+	// Events observed while disconnected are buffered until the relay runs
+	relay.observe(testContainerStateChange(apicontainerstatus.ContainerRunning, ""))
+	relay.observe(testContainerStateChange(apicontainerstatus.ContainerStopped, ""))
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	var eventTypes []string
+	gomock.InOrder(
+		mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(message interface{}) {
+			eventTypes = append(eventTypes, aws.StringValue(message.(*ecsacs.TaskEngineEventMessage).EventType))
+			wg.Done()
+		}).Return(errors.New("connection closed")),
+		mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(message interface{}) {
+			eventTypes = append(eventTypes, aws.StringValue(message.(*ecsacs.TaskEngineEventMessage).EventType))
+			wg.Done()
+		}).Return(nil),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.run(ctx, mockWsClient)
+		close(done)
+	}()
+	wg.Wait()
+	cancel()
+	<-done
+	assert.Equal(t, []string{containerStartedEventType, containerStoppedEventType}, eventTypes)
+}
+
+func TestTaskEngineEventRelayRateLimit(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockWsClient := mock_wsclient.NewMockClientServer(ctrl)
+
+	const maxRate = 20
+	relay := newTaskEngineEventRelay(clusterName, containerInstanceArn, maxRate)
+	for i := 0; i < 5; i++ {
+		relay.observe(testContainerStateChange(apicontainerstatus.ContainerRunning, ""))
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	mockWsClient.EXPECT().MakeRequest(gomock.Any()).Do(func(interface{}) {
+		wg.Done()
+	}).Return(nil).Times(5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	start := time.Now()
+	go relay.run(ctx, mockWsClient)
+	wg.Wait()
+	// The first event is relayed right away, the others one rate interval apart
+	assert.True(t, time.Since(start) >= 4*time.Second/maxRate-10*time.Millisecond,
+		"Events were relayed faster than %d per second", maxRate)
+}
+
+func TestNewTaskEngineEventRelayDefaultRate(t *testing.T) {
+	relay := newTaskEngineEventRelay(clusterName, containerInstanceArn, -1)
+	assert.EqualValues(t, config.DefaultACSEventRelayMaxRate, relay.limiter.Limit())
+}
+
+// TestSessionUnregistersEventRelayObserver tests that the events are no longer
+// buffered by the relay once the session stops observing the task handler
+func TestSessionUnregistersEventRelayObserver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	taskHandler := eventhandler.NewTaskHandler(ctx, data.NewNoopClient(), nil, nil)
+	relay := newTaskEngineEventRelay(clusterName, containerInstanceArn, 0)
+	acsSession := &session{
+		taskHandler: taskHandler,
+		eventRelay:  relay,
+	}
+
+	unregister := acsSession.observeTaskStateChanges()
+	taskHandler.AddStateChangeEvent(testContainerStateChange(apicontainerstatus.ContainerRunning, ""), nil)
+	assert.Len(t, relay.events, 1)
+
+	unregister()
+	taskHandler.AddStateChangeEvent(testContainerStateChange(apicontainerstatus.ContainerStopped, ""), nil)
+	assert.Len(t, relay.events, 1, "the relay should stop buffering events once unregistered")
+}
+
+func TestNewSessionEventRelayDisabledByDefault(t *testing.T) {
+	acsSession := NewSession(context.Background(), SessionParams{Config: testConfig, ContainerInstanceARN: "myArn"}).(*session)
+	assert.Nil(t, acsSession.eventRelay)
+}
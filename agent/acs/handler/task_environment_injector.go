@@ -0,0 +1,118 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"sync"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// instanceIDEnvVar is the environment variable holding the ID of the instance
+	instanceIDEnvVar = "ECS_INSTANCE_ID"
+	// instanceAvailabilityZoneEnvVar is the environment variable holding the
+	// availability zone of the instance
+	instanceAvailabilityZoneEnvVar = "ECS_INSTANCE_AVAILABILITY_ZONE"
+	// instanceTypeEnvVar is the environment variable holding the type of the instance
+	instanceTypeEnvVar = "ECS_INSTANCE_TYPE"
+	// instanceClusterEnvVar is the environment variable holding the name of the
+	// cluster the instance is registered to
+	instanceClusterEnvVar = "ECS_INSTANCE_CLUSTER"
+)
+
+// TaskEnvironmentInjector adds environment variables describing the instance
+// to the containers of the tasks received from ACS, when configured with
+// ACSInjectInstanceEnvVars. The values are retrieved from the EC2 instance
+// metadata service once, when the session starts. The variables set by the task
+// definition are kept, the variables set from environment files or secrets
+// aren't known until the containers are created though, and are overridden
+// unless they are listed in ACSInstanceEnvVarDenyList
+type TaskEnvironmentInjector struct {
+	cluster                   string
+	ec2MetadataClient         ec2.EC2MetadataClient
+	instanceAttributesFetcher *instanceAttributesFetcher
+	// denyList holds the names of the variables never added
+	denyList map[string]struct{}
+	lock     sync.RWMutex
+	envVars  map[string]string
+}
+
+// newTaskEnvironmentInjector returns a new TaskEnvironmentInjector object, or
+// nil if the injection isn't enabled
+func newTaskEnvironmentInjector(enabled bool, cluster string, ec2MetadataClient ec2.EC2MetadataClient,
+	instanceAttributesFetcher *instanceAttributesFetcher, denyList []string) *TaskEnvironmentInjector {
+	if !enabled {
+		return nil
+	}
+	injector := &TaskEnvironmentInjector{
+		cluster:                   cluster,
+		ec2MetadataClient:         ec2MetadataClient,
+		instanceAttributesFetcher: instanceAttributesFetcher,
+		denyList:                  make(map[string]struct{}),
+	}
+	for _, name := range denyList {
+		injector.denyList[name] = struct{}{}
+	}
+	return injector
+}
+
+// load retrieves the values of the environment variables. The variables whose
+// value can't be retrieved aren't added to the containers
+func (injector *TaskEnvironmentInjector) load() {
+	if injector == nil {
+		return
+	}
+	envVars := map[string]string{
+		instanceClusterEnvVar: injector.cluster,
+	}
+	if injector.ec2MetadataClient != nil {
+		instanceID, err := injector.ec2MetadataClient.InstanceID()
+		if err != nil {
+			seelog.Warnf("Unable to get the instance ID from EC2 metadata service, it will not be added to the containers: %v", err)
+		}
+		envVars[instanceIDEnvVar] = instanceID
+	}
+	if attributes := injector.instanceAttributesFetcher.fetch(); attributes != nil {
+		envVars[instanceAvailabilityZoneEnvVar] = attributes.AvailabilityZone
+		envVars[instanceTypeEnvVar] = attributes.InstanceType
+	}
+	for name, value := range envVars {
+		if _, denied := injector.denyList[name]; denied || value == "" {
+			delete(envVars, name)
+		}
+	}
+
+	injector.lock.Lock()
+	defer injector.lock.Unlock()
+	injector.envVars = envVars
+}
+
+// inject adds the environment variables to the containers of the task that
+// don't set them already
+func (injector *TaskEnvironmentInjector) inject(task *apitask.Task) {
+	if injector == nil {
+		return
+	}
+	injector.lock.RLock()
+	defer injector.lock.RUnlock()
+	if len(injector.envVars) == 0 {
+		return
+	}
+	for _, container := range task.Containers {
+		container.MergeMissingEnvironmentVariables(injector.envVars)
+	}
+}
@@ -0,0 +1,154 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	mock_ec2 "github.com/aws/amazon-ecs-agent/agent/ec2/mocks"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestEnvironmentMetadataClient returns an EC2 metadata client returning the
+// metadata of the instance
+func newTestEnvironmentMetadataClient(ctrl *gomock.Controller) *mock_ec2.MockEC2MetadataClient {
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().InstanceID().Return("i-1234567890abcdef0", nil)
+	ec2MetadataClient.EXPECT().GetMetadata(availabilityZoneResource).Return("us-west-2a", nil)
+	ec2MetadataClient.EXPECT().GetMetadata(amiIDResource).Return("ami-12345678", nil)
+	ec2MetadataClient.EXPECT().GetMetadata(instanceLifeCycleResource).Return("on-demand", nil)
+	ec2MetadataClient.EXPECT().InstanceType().Return("m5.large", nil)
+	return ec2MetadataClient
+}
+
+func TestTaskEnvironmentInjectorDisabled(t *testing.T) {
+	injector := newTaskEnvironmentInjector(false, "cluster", nil, nil, nil)
+	assert.Nil(t, injector)
+	injector.load()
+	task := &apitask.Task{Containers: []*apicontainer.Container{{}}}
+	injector.inject(task)
+	assert.Nil(t, task.Containers[0].Environment)
+}
+
+func TestTaskEnvironmentInjectorInjectsInstanceEnvVars(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ec2MetadataClient := newTestEnvironmentMetadataClient(ctrl)
+	injector := newTaskEnvironmentInjector(true, "cluster", ec2MetadataClient,
+		newInstanceAttributesFetcher(ec2MetadataClient), nil)
+	injector.load()
+
+	task := &apitask.Task{Containers: []*apicontainer.Container{
+		{Environment: map[string]string{"APP": "web", instanceClusterEnvVar: "task-defined"}},
+		{},
+	}}
+	injector.inject(task)
+	assert.Equal(t, map[string]string{
+		"APP":                          "web",
+		instanceClusterEnvVar:          "task-defined",
+		instanceIDEnvVar:               "i-1234567890abcdef0",
+		instanceAvailabilityZoneEnvVar: "us-west-2a",
+		instanceTypeEnvVar:             "m5.large",
+	}, task.Containers[0].Environment, "the variables of the task definition should be kept")
+	assert.Equal(t, map[string]string{
+		instanceClusterEnvVar:          "cluster",
+		instanceIDEnvVar:               "i-1234567890abcdef0",
+		instanceAvailabilityZoneEnvVar: "us-west-2a",
+		instanceTypeEnvVar:             "m5.large",
+	}, task.Containers[1].Environment)
+}
+
+func TestTaskEnvironmentInjectorDenyList(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ec2MetadataClient := newTestEnvironmentMetadataClient(ctrl)
+	injector := newTaskEnvironmentInjector(true, "cluster", ec2MetadataClient,
+		newInstanceAttributesFetcher(ec2MetadataClient), []string{instanceIDEnvVar, instanceTypeEnvVar})
+	injector.load()
+
+	task := &apitask.Task{Containers: []*apicontainer.Container{{}}}
+	injector.inject(task)
+	assert.Equal(t, map[string]string{
+		instanceClusterEnvVar:          "cluster",
+		instanceAvailabilityZoneEnvVar: "us-west-2a",
+	}, task.Containers[0].Environment)
+}
+
+// TestTaskEnvironmentInjectorMetadataUnavailable tests if only the variables
+// whose value is known are added when the instance metadata service fails
+func TestTaskEnvironmentInjectorMetadataUnavailable(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().InstanceID().Return("", errors.New("timeout"))
+	ec2MetadataClient.EXPECT().GetMetadata(gomock.Any()).Return("", errors.New("timeout")).Times(3)
+	ec2MetadataClient.EXPECT().InstanceType().Return("", errors.New("timeout"))
+	injector := newTaskEnvironmentInjector(true, "cluster", ec2MetadataClient,
+		newInstanceAttributesFetcher(ec2MetadataClient), nil)
+	injector.load()
+
+	task := &apitask.Task{Containers: []*apicontainer.Container{{}}}
+	injector.inject(task)
+	assert.Equal(t, map[string]string{instanceClusterEnvVar: "cluster"}, task.Containers[0].Environment)
+}
+
+// TestPayloadHandlerInjectsInstanceEnvVars tests that the instance environment
+// variables are added to the containers of the tasks to be started
+func TestPayloadHandlerInjectsInstanceEnvVars(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	ec2MetadataClient := newTestEnvironmentMetadataClient(tester.ctrl)
+	tester.payloadHandler.envInjector = newTaskEnvironmentInjector(true, "cluster", ec2MetadataClient,
+		newInstanceAttributesFetcher(ec2MetadataClient), nil)
+	tester.payloadHandler.envInjector.load()
+
+	var addedTask *apitask.Task
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(
+		func(task *apitask.Task) {
+			addedTask = task
+		})
+
+	payloadMessage := &ecsacs.PayloadMessage{
+		Tasks: []*ecsacs.Task{
+			{
+				Arn:           aws.String("arn"),
+				DesiredStatus: aws.String("RUNNING"),
+				Containers: []*ecsacs.Container{
+					{
+						Environment: map[string]*string{"APP": aws.String("web")},
+					},
+				},
+			},
+		},
+		MessageId: aws.String(payloadMessageId),
+	}
+
+	err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+	assert.NoError(t, err)
+
+	require.NotNil(t, addedTask)
+	assert.Equal(t, "web", addedTask.Containers[0].Environment["APP"])
+	assert.Equal(t, "i-1234567890abcdef0", addedTask.Containers[0].Environment[instanceIDEnvVar])
+	assert.Equal(t, "cluster", addedTask.Containers[0].Environment[instanceClusterEnvVar])
+}
@@ -0,0 +1,261 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/statechange"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	hostConfigTmpfsField = "Tmpfs"
+	hostConfigBindsField = "Binds"
+)
+
+// mountSyscalls are the system calls mounting the tmpfs of tasks, they are
+// swapped out by the tests
+type mountSyscalls interface {
+	// mountTmpfs mounts a tmpfs on the target directory
+	mountTmpfs(target string, options tmpfsOptions) error
+	// unmount unmounts the file system mounted on the target directory
+	unmount(target string) error
+}
+
+// tmpfsOptions are the options of a tmpfs mount, parsed from the docker tmpfs
+// options of a container. Like the tmpfs mounts created by docker, the mounts
+// are noexec, nosuid and nodev unless requested otherwise
+type tmpfsOptions struct {
+	readOnly bool
+	noExec   bool
+	noSuid   bool
+	noDev    bool
+	// data are the tmpfs specific options, such as size and mode
+	data string
+}
+
+// parseTmpfsOptions parses the comma separated docker tmpfs options
+func parseTmpfsOptions(options string) tmpfsOptions {
+	parsed := tmpfsOptions{noExec: true, noSuid: true, noDev: true}
+	var data []string
+	for _, option := range strings.Split(options, ",") {
+		switch option {
+		case "":
+		case "ro":
+			parsed.readOnly = true
+		case "rw":
+			parsed.readOnly = false
+		case "exec", "noexec":
+			parsed.noExec = option == "noexec"
+		case "suid", "nosuid":
+			parsed.noSuid = option == "nosuid"
+		case "dev", "nodev":
+			parsed.noDev = option == "nodev"
+		default:
+			data = append(data, option)
+		}
+	}
+	parsed.data = strings.Join(data, ",")
+	return parsed
+}
+
+// preparedTaskFilesystem are the tmpfs mounts created for a task
+type preparedTaskFilesystem struct {
+	dir    string
+	mounts []string
+}
+
+// TaskFilesystemPreparator creates the tmpfs mounts requested by the containers
+// of a task on the host, under a directory of the task, before the task is
+// added to the task engine. The tmpfs mounts of the containers are replaced by
+// binds of the mounts of the task, so that tasks writing to their tmpfs can't
+// interfere with each other through docker. The mounts of a task are removed
+// once the task is stopped. A mount that can't be created is left to docker.
+type TaskFilesystemPreparator struct {
+	root     string
+	syscalls mountSyscalls
+	lock     sync.Mutex
+	// tasks maps the arn of the tasks to the mounts created for them
+	tasks map[string]preparedTaskFilesystem
+}
+
+// newTaskFilesystemPreparator returns a new TaskFilesystemPreparator creating
+// the mounts of the tasks under root, or nil if root is empty
+func newTaskFilesystemPreparator(root string, syscalls mountSyscalls) *TaskFilesystemPreparator {
+	if root == "" {
+		return nil
+	}
+	return &TaskFilesystemPreparator{
+		root:     root,
+		syscalls: syscalls,
+		tasks:    make(map[string]preparedTaskFilesystem),
+	}
+}
+
+// prepare creates the tmpfs mounts of the containers of the task and updates
+// the host config of the containers to bind them. The task must not have been
+// added to the task engine yet. Tasks already prepared are left untouched
+func (preparator *TaskFilesystemPreparator) prepare(task *apitask.Task) {
+	if preparator == nil {
+		return
+	}
+	preparator.lock.Lock()
+	defer preparator.lock.Unlock()
+
+	if _, ok := preparator.tasks[task.Arn]; ok {
+		return
+	}
+	prepared := preparedTaskFilesystem{dir: filepath.Join(preparator.root, task.GetID())}
+	for _, container := range task.Containers {
+		hostConfig := container.GetHostConfig()
+		if hostConfig == nil {
+			continue
+		}
+		updated, mounts := preparator.prepareContainer(filepath.Join(prepared.dir, container.Name), *hostConfig)
+		if len(mounts) == 0 {
+			continue
+		}
+		prepared.mounts = append(prepared.mounts, mounts...)
+		container.DockerConfig.HostConfig = aws.String(updated)
+	}
+	if len(prepared.mounts) > 0 {
+		seelog.Infof("Created %d tmpfs mounts for task %s", len(prepared.mounts), task.Arn)
+		preparator.tasks[task.Arn] = prepared
+	}
+}
+
+// prepareContainer creates the tmpfs mounts of the host config of a container
+// under dir. It returns the updated host config and the created mounts
+func (preparator *TaskFilesystemPreparator) prepareContainer(dir string, hostConfig string) (string, []string) {
+	// The host config is updated field by field, the fields that aren't set
+	// mustn't override the defaults of the agent
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(hostConfig), &fields); err != nil {
+		return hostConfig, nil
+	}
+	var tmpfs map[string]string
+	if err := json.Unmarshal(fields[hostConfigTmpfsField], &tmpfs); err != nil || len(tmpfs) == 0 {
+		return hostConfig, nil
+	}
+	var binds []string
+	if raw, ok := fields[hostConfigBindsField]; ok {
+		if err := json.Unmarshal(raw, &binds); err != nil {
+			return hostConfig, nil
+		}
+	}
+
+	containerPaths := make([]string, 0, len(tmpfs))
+	for containerPath := range tmpfs {
+		containerPaths = append(containerPaths, containerPath)
+	}
+	sort.Strings(containerPaths)
+	var mounts []string
+	for i, containerPath := range containerPaths {
+		options := parseTmpfsOptions(tmpfs[containerPath])
+		mount := filepath.Join(dir, strconv.Itoa(i))
+		if err := preparator.mount(mount, options); err != nil {
+			seelog.Warnf("Unable to create the tmpfs mount of %s on the host, leaving it to docker: %v", containerPath, err)
+			continue
+		}
+		mounts = append(mounts, mount)
+		bind := mount + ":" + containerPath
+		if options.readOnly {
+			bind += ":ro"
+		}
+		binds = append(binds, bind)
+		delete(tmpfs, containerPath)
+	}
+	if len(mounts) == 0 {
+		return hostConfig, nil
+	}
+
+	if len(tmpfs) == 0 {
+		delete(fields, hostConfigTmpfsField)
+	} else {
+		fields[hostConfigTmpfsField], _ = json.Marshal(tmpfs)
+	}
+	fields[hostConfigBindsField], _ = json.Marshal(binds)
+	updated, err := json.Marshal(fields)
+	if err != nil {
+		// The mounts are removed along with the others of the task
+		return hostConfig, mounts
+	}
+	return string(updated), mounts
+}
+
+// mount creates the directory of the mount and mounts a tmpfs on it
+func (preparator *TaskFilesystemPreparator) mount(target string, options tmpfsOptions) error {
+	if err := os.MkdirAll(target, 0700); err != nil {
+		return err
+	}
+	if err := preparator.syscalls.mountTmpfs(target, options); err != nil {
+		os.Remove(target)
+		return err
+	}
+	return nil
+}
+
+// observe is registered with the task handler to remove the mounts of the
+// tasks once they are stopped
+func (preparator *TaskFilesystemPreparator) observe(event statechange.Event) {
+	change, ok := event.(api.TaskStateChange)
+	if !ok || change.Status != apitaskstatus.TaskStopped {
+		return
+	}
+	// Observers mustn't block the task handler
+	go preparator.cleanup(change.TaskARN)
+}
+
+// cleanup unmounts the tmpfs mounts of a task and removes its directory. The
+// directory is kept if a mount can't be unmounted, so that its content isn't
+// removed
+func (preparator *TaskFilesystemPreparator) cleanup(taskARN string) {
+	if preparator == nil {
+		return
+	}
+	preparator.lock.Lock()
+	prepared, ok := preparator.tasks[taskARN]
+	delete(preparator.tasks, taskARN)
+	preparator.lock.Unlock()
+	if !ok {
+		return
+	}
+
+	unmounted := true
+	for _, mount := range prepared.mounts {
+		if err := preparator.syscalls.unmount(mount); err != nil {
+			seelog.Warnf("Unable to unmount the tmpfs mount %s of task %s: %v", mount, taskARN, err)
+			unmounted = false
+		}
+	}
+	if !unmounted {
+		return
+	}
+	if err := os.RemoveAll(prepared.dir); err != nil {
+		seelog.Warnf("Unable to remove the tmpfs directory of task %s: %v", taskARN, err)
+		return
+	}
+	seelog.Infof("Removed the tmpfs mounts of task %s", taskARN)
+}
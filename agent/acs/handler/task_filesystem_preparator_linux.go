@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import "golang.org/x/sys/unix"
+
+// linuxMountSyscalls implements mountSyscalls with mount and umount
+type linuxMountSyscalls struct{}
+
+// newMountSyscalls returns the mountSyscalls of the platform
+func newMountSyscalls() mountSyscalls {
+	return linuxMountSyscalls{}
+}
+
+func (linuxMountSyscalls) mountTmpfs(target string, options tmpfsOptions) error {
+	var flags uintptr
+	if options.readOnly {
+		flags |= unix.MS_RDONLY
+	}
+	if options.noExec {
+		flags |= unix.MS_NOEXEC
+	}
+	if options.noSuid {
+		flags |= unix.MS_NOSUID
+	}
+	if options.noDev {
+		flags |= unix.MS_NODEV
+	}
+	return unix.Mount("tmpfs", target, "tmpfs", flags, options.data)
+}
+
+func (linuxMountSyscalls) unmount(target string) error {
+	return unix.Unmount(target, 0)
+}
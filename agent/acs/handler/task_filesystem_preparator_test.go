@@ -0,0 +1,228 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMountSyscalls records the mounts of the tests and fails the targets
+// listed in failMount and failUnmount
+type fakeMountSyscalls struct {
+	lock        sync.Mutex
+	mounts      map[string]tmpfsOptions
+	unmounts    []string
+	failMount   map[string]bool
+	failUnmount map[string]bool
+}
+
+func newFakeMountSyscalls() *fakeMountSyscalls {
+	return &fakeMountSyscalls{
+		mounts:      make(map[string]tmpfsOptions),
+		failMount:   make(map[string]bool),
+		failUnmount: make(map[string]bool),
+	}
+}
+
+func (syscalls *fakeMountSyscalls) mountTmpfs(target string, options tmpfsOptions) error {
+	syscalls.lock.Lock()
+	defer syscalls.lock.Unlock()
+	if syscalls.failMount[target] {
+		return errors.New("mount failed")
+	}
+	syscalls.mounts[target] = options
+	return nil
+}
+
+func (syscalls *fakeMountSyscalls) unmount(target string) error {
+	syscalls.lock.Lock()
+	defer syscalls.lock.Unlock()
+	syscalls.unmounts = append(syscalls.unmounts, target)
+	if syscalls.failUnmount[target] {
+		return errors.New("unmount failed")
+	}
+	return nil
+}
+
+func (syscalls *fakeMountSyscalls) unmounted() []string {
+	syscalls.lock.Lock()
+	defer syscalls.lock.Unlock()
+	return append([]string(nil), syscalls.unmounts...)
+}
+
+// testTmpfsTask returns a task with a container of the given host config
+func testTmpfsTask(hostConfig string) *apitask.Task {
+	return &apitask.Task{
+		Arn: testTaskARN,
+		Containers: []*apicontainer.Container{
+			{
+				Name: "web",
+				DockerConfig: apicontainer.DockerConfig{
+					HostConfig: aws.String(hostConfig),
+				},
+			},
+		},
+	}
+}
+
+// hostConfigFields decodes the host config of the first container of the task
+func hostConfigFields(t *testing.T, task *apitask.Task) map[string]json.RawMessage {
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal([]byte(aws.StringValue(task.Containers[0].DockerConfig.HostConfig)), &fields))
+	return fields
+}
+
+func TestParseTmpfsOptions(t *testing.T) {
+	testCases := []struct {
+		options  string
+		expected tmpfsOptions
+	}{
+		{"", tmpfsOptions{noExec: true, noSuid: true, noDev: true}},
+		{"size=64m,mode=1777", tmpfsOptions{noExec: true, noSuid: true, noDev: true, data: "size=64m,mode=1777"}},
+		{"ro,exec", tmpfsOptions{readOnly: true, noSuid: true, noDev: true}},
+		{"ro,rw,suid,dev", tmpfsOptions{noExec: true}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.options, func(t *testing.T) {
+			assert.Equal(t, tc.expected, parseTmpfsOptions(tc.options))
+		})
+	}
+}
+
+func TestNewTaskFilesystemPreparatorWithoutRoot(t *testing.T) {
+	preparator := newTaskFilesystemPreparator("", newFakeMountSyscalls())
+	assert.Nil(t, preparator)
+
+	// A nil preparator leaves the tasks untouched
+	task := testTmpfsTask(`{"Tmpfs":{"/scratch":""}}`)
+	preparator.prepare(task)
+	preparator.cleanup(task.Arn)
+	assert.Equal(t, `{"Tmpfs":{"/scratch":""}}`, aws.StringValue(task.Containers[0].DockerConfig.HostConfig))
+}
+
+func TestTaskFilesystemPreparatorPrepare(t *testing.T) {
+	root := t.TempDir()
+	syscalls := newFakeMountSyscalls()
+	preparator := newTaskFilesystemPreparator(root, syscalls)
+
+	task := testTmpfsTask(`{"Tmpfs":{"/scratch":"size=64m","/cache":"ro"},"Binds":["/data:/data"],"Privileged":true}`)
+	preparator.prepare(task)
+
+	dir := filepath.Join(root, "abc", "web")
+	require.Len(t, syscalls.mounts, 2)
+	assert.Equal(t, tmpfsOptions{readOnly: true, noExec: true, noSuid: true, noDev: true}, syscalls.mounts[filepath.Join(dir, "0")])
+	assert.Equal(t, tmpfsOptions{noExec: true, noSuid: true, noDev: true, data: "size=64m"}, syscalls.mounts[filepath.Join(dir, "1")])
+	assert.DirExists(t, filepath.Join(dir, "0"))
+
+	fields := hostConfigFields(t, task)
+	assert.NotContains(t, fields, hostConfigTmpfsField)
+	assert.JSONEq(t, `true`, string(fields["Privileged"]))
+	var binds []string
+	require.NoError(t, json.Unmarshal(fields[hostConfigBindsField], &binds))
+	assert.Equal(t, []string{
+		"/data:/data",
+		filepath.Join(dir, "0") + ":/cache:ro",
+		filepath.Join(dir, "1") + ":/scratch",
+	}, binds)
+
+	// Preparing the task again doesn't mount anything
+	preparator.prepare(task)
+	assert.Len(t, syscalls.mounts, 2)
+}
+
+func TestTaskFilesystemPreparatorLeavesFailedMountsToDocker(t *testing.T) {
+	root := t.TempDir()
+	syscalls := newFakeMountSyscalls()
+	dir := filepath.Join(root, "abc", "web")
+	syscalls.failMount[filepath.Join(dir, "0")] = true
+	preparator := newTaskFilesystemPreparator(root, syscalls)
+
+	task := testTmpfsTask(`{"Tmpfs":{"/cache":"","/scratch":""}}`)
+	preparator.prepare(task)
+
+	_, err := os.Stat(filepath.Join(dir, "0"))
+	assert.True(t, os.IsNotExist(err))
+	fields := hostConfigFields(t, task)
+	assert.JSONEq(t, `{"/cache":""}`, string(fields[hostConfigTmpfsField]))
+	assert.JSONEq(t, `["`+filepath.Join(dir, "1")+`:/scratch"]`, string(fields[hostConfigBindsField]))
+}
+
+func TestTaskFilesystemPreparatorSkipsContainersWithoutTmpfs(t *testing.T) {
+	syscalls := newFakeMountSyscalls()
+	preparator := newTaskFilesystemPreparator(t.TempDir(), syscalls)
+
+	for _, hostConfig := range []string{`{"Privileged":true}`, `{"Tmpfs":{}}`, `not json`} {
+		task := testTmpfsTask(hostConfig)
+		preparator.prepare(task)
+		assert.Equal(t, hostConfig, aws.StringValue(task.Containers[0].DockerConfig.HostConfig))
+	}
+	assert.Empty(t, syscalls.mounts)
+}
+
+func TestTaskFilesystemPreparatorCleansUpStoppedTasks(t *testing.T) {
+	root := t.TempDir()
+	syscalls := newFakeMountSyscalls()
+	preparator := newTaskFilesystemPreparator(root, syscalls)
+	preparator.prepare(testTmpfsTask(`{"Tmpfs":{"/scratch":""}}`))
+
+	// Running tasks keep their mounts
+	preparator.observe(api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskRunning})
+	preparator.observe(api.TaskStateChange{TaskARN: testTaskARN, Status: apitaskstatus.TaskStopped})
+
+	// The mounts are removed in the background
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(filepath.Join(root, "abc")); os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, err := os.Stat(filepath.Join(root, "abc"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, []string{filepath.Join(root, "abc", "web", "0")}, syscalls.unmounted())
+
+	// The task is only cleaned up once
+	preparator.cleanup(testTaskARN)
+	assert.Len(t, syscalls.unmounted(), 1)
+}
+
+func TestTaskFilesystemPreparatorKeepsDirectoryOfFailedUnmounts(t *testing.T) {
+	root := t.TempDir()
+	syscalls := newFakeMountSyscalls()
+	mount := filepath.Join(root, "abc", "web", "0")
+	syscalls.failUnmount[mount] = true
+	preparator := newTaskFilesystemPreparator(root, syscalls)
+	preparator.prepare(testTmpfsTask(`{"Tmpfs":{"/scratch":""}}`))
+
+	preparator.cleanup(testTaskARN)
+
+	assert.Equal(t, []string{mount}, syscalls.unmounted())
+	assert.DirExists(t, mount)
+}
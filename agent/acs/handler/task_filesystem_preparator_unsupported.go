@@ -0,0 +1,36 @@
+//go:build !linux
+// +build !linux
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import "errors"
+
+// unsupportedMountSyscalls implements mountSyscalls on platforms where the
+// tmpfs of tasks can't be created by the agent
+type unsupportedMountSyscalls struct{}
+
+// newMountSyscalls returns the mountSyscalls of the platform
+func newMountSyscalls() mountSyscalls {
+	return unsupportedMountSyscalls{}
+}
+
+func (unsupportedMountSyscalls) mountTmpfs(target string, options tmpfsOptions) error {
+	return errors.New("tmpfs mounts are only supported on linux")
+}
+
+func (unsupportedMountSyscalls) unmount(target string) error {
+	return errors.New("tmpfs mounts are only supported on linux")
+}
@@ -0,0 +1,206 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// taskGroupThrottlePollInterval is the interval at which the status of a
+	// throttled task is checked to determine if it has finished starting
+	taskGroupThrottlePollInterval = time.Second
+)
+
+// pendingTaskStart is a task waiting for a start slot of its task group
+type pendingTaskStart struct {
+	task  *apitask.Task
+	start func()
+}
+
+// taskGroupThrottle limits the number of tasks belonging to the same task group
+// that are started concurrently. ACS can push a large number of tasks of the
+// same service at once and starting all of them at the same time puts a lot of
+// stress on docker. Tasks beyond the limit are queued and started, in the order
+// they were received, as the earlier tasks of the group reach RUNNING. The start
+// slots are tracked by task arn, a task sent again by ACS doesn't take another
+// slot of its group
+type taskGroupThrottle struct {
+	ctx                 context.Context
+	taskEngine          engine.TaskEngine
+	maxConcurrentStarts int
+	pollInterval        time.Duration
+	lock                sync.Mutex
+	// starting maps a task group to the arns of its tasks being started
+	starting map[string]map[string]struct{}
+	// pending maps a task group to the tasks waiting to be started
+	pending map[string][]pendingTaskStart
+}
+
+// newTaskGroupThrottle returns a new taskGroupThrottle object. The queued tasks
+// are dropped once the context is canceled
+func newTaskGroupThrottle(ctx context.Context, taskEngine engine.TaskEngine, maxConcurrentStarts int) *taskGroupThrottle {
+	if maxConcurrentStarts <= 0 {
+		maxConcurrentStarts = config.DefaultACSTaskGroupMaxConcurrentStarts
+	}
+	return &taskGroupThrottle{
+		ctx:                 ctx,
+		taskEngine:          taskEngine,
+		maxConcurrentStarts: maxConcurrentStarts,
+		pollInterval:        taskGroupThrottlePollInterval,
+		starting:            make(map[string]map[string]struct{}),
+		pending:             make(map[string][]pendingTaskStart),
+	}
+}
+
+// submit invokes start for the task right away if the task does not belong to a
+// task group or if its task group has not reached the concurrency limit. Otherwise,
+// the task is queued until a start slot is freed up. A task already being started
+// is started again right away with the slot it holds, a task already queued keeps
+// its place in the queue
+func (throttle *taskGroupThrottle) submit(group string, task *apitask.Task, start func()) {
+	if throttle == nil || group == "" {
+		start()
+		return
+	}
+
+	throttle.lock.Lock()
+	if _, ok := throttle.starting[group][task.Arn]; ok {
+		throttle.lock.Unlock()
+		seelog.Infof("Task %s of task group %s is already being started, starting it again", task.Arn, group)
+		start()
+		return
+	}
+	for i, queued := range throttle.pending[group] {
+		if queued.task.Arn != task.Arn {
+			continue
+		}
+		previousStart := queued.start
+		throttle.pending[group][i].start = func() {
+			previousStart()
+			start()
+		}
+		throttle.lock.Unlock()
+		seelog.Infof("Task %s of task group %s is already queued, keeping its place in the queue", task.Arn, group)
+		return
+	}
+	if len(throttle.starting[group]) >= throttle.maxConcurrentStarts {
+		throttle.pending[group] = append(throttle.pending[group], pendingTaskStart{task: task, start: start})
+		queued := len(throttle.pending[group])
+		throttle.lock.Unlock()
+		seelog.Infof("Task group %s has reached the limit of %d concurrently starting tasks, queuing task %s (%d queued)",
+			group, throttle.maxConcurrentStarts, task.Arn, queued)
+		return
+	}
+	throttle.acquireUnsafe(group, task.Arn)
+	throttle.lock.Unlock()
+
+	throttle.startTask(group, task, start)
+}
+
+// acquireUnsafe takes a start slot of the task group for the task
+func (throttle *taskGroupThrottle) acquireUnsafe(group string, arn string) {
+	if throttle.starting[group] == nil {
+		throttle.starting[group] = make(map[string]struct{})
+	}
+	throttle.starting[group][arn] = struct{}{}
+}
+
+// startTask starts the task and waits in the background for it to finish starting
+func (throttle *taskGroupThrottle) startTask(group string, task *apitask.Task, start func()) {
+	start()
+	go throttle.waitForTaskStart(group, task)
+}
+
+// waitForTaskStart waits for the task to either reach RUNNING or to be stopped
+// before releasing its start slot. The slot is released as well once the
+// context is canceled
+func (throttle *taskGroupThrottle) waitForTaskStart(group string, task *apitask.Task) {
+	defer throttle.release(group, task.Arn)
+	ticker := time.NewTicker(throttle.pollInterval)
+	defer ticker.Stop()
+	for !throttle.taskStarted(task) {
+		select {
+		case <-ticker.C:
+		case <-throttle.ctx.Done():
+			return
+		}
+	}
+}
+
+// taskStarted returns true once the task is either RUNNING or to be stopped
+func (throttle *taskGroupThrottle) taskStarted(task *apitask.Task) bool {
+	// The task engine keeps the task it was first given when the same task is
+	// added again, the status is read from the task of the engine
+	if throttle.taskEngine != nil {
+		if managedTask, ok := throttle.taskEngine.GetTaskByArn(task.Arn); ok {
+			task = managedTask
+		}
+	}
+	return task.GetKnownStatus() >= apitaskstatus.TaskRunning || task.GetDesiredStatus().Terminal()
+}
+
+// release frees up the start slot of the task and hands it over to the next
+// queued task of the group, if any
+func (throttle *taskGroupThrottle) release(group string, arn string) {
+	throttle.lock.Lock()
+	delete(throttle.starting[group], arn)
+	if len(throttle.starting[group]) == 0 {
+		delete(throttle.starting, group)
+	}
+	if throttle.ctx.Err() != nil {
+		// The queued tasks are dropped, they're sent again by ACS
+		delete(throttle.pending, group)
+		throttle.lock.Unlock()
+		return
+	}
+	queue := throttle.pending[group]
+	if len(queue) == 0 {
+		throttle.lock.Unlock()
+		return
+	}
+	next := queue[0]
+	if len(queue) == 1 {
+		delete(throttle.pending, group)
+	} else {
+		throttle.pending[group] = queue[1:]
+	}
+	throttle.acquireUnsafe(group, next.task.Arn)
+	throttle.lock.Unlock()
+
+	seelog.Infof("Starting queued task %s of task group %s", next.task.Arn, group)
+	throttle.startTask(group, next.task, next.start)
+}
+
+// pendingCount returns the number of tasks of the task group waiting to be started
+func (throttle *taskGroupThrottle) pendingCount(group string) int {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+	return len(throttle.pending[group])
+}
+
+// startingCount returns the number of tasks of the task group being started
+func (throttle *taskGroupThrottle) startingCount(group string) int {
+	throttle.lock.Lock()
+	defer throttle.lock.Unlock()
+	return len(throttle.starting[group])
+}
@@ -0,0 +1,243 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testTaskGroup            = "service:test"
+	testThrottlePollInterval = 10 * time.Millisecond
+	testThrottleWaitTimeout  = 5 * time.Second
+)
+
+// startRecorder records the tasks started through the throttle
+type startRecorder struct {
+	lock    sync.Mutex
+	started []string
+}
+
+func (recorder *startRecorder) startFunc(task *apitask.Task) func() {
+	return func() {
+		recorder.lock.Lock()
+		defer recorder.lock.Unlock()
+		recorder.started = append(recorder.started, task.Arn)
+	}
+}
+
+func (recorder *startRecorder) startedTasks() []string {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	return append([]string{}, recorder.started...)
+}
+
+// waitForStartedTasks waits until the expected number of tasks have been started
+func (recorder *startRecorder) waitForStartedTasks(t *testing.T, expected int) {
+	deadline := time.Now().Add(testThrottleWaitTimeout)
+	for len(recorder.startedTasks()) < expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d tasks to be started, started: %v", expected, recorder.startedTasks())
+		}
+		time.Sleep(testThrottlePollInterval)
+	}
+}
+
+func newThrottledTestTask(arn string) *apitask.Task {
+	task := &apitask.Task{Arn: arn}
+	task.SetDesiredStatus(apitaskstatus.TaskRunning)
+	return task
+}
+
+func newTestTaskGroupThrottle(ctx context.Context, maxConcurrentStarts int) *taskGroupThrottle {
+	throttle := newTaskGroupThrottle(ctx, nil, maxConcurrentStarts)
+	throttle.pollInterval = testThrottlePollInterval
+	return throttle
+}
+
+func TestNewTaskGroupThrottleDefaultsInvalidLimit(t *testing.T) {
+	throttle := newTaskGroupThrottle(context.TODO(), nil, 0)
+	assert.Equal(t, config.DefaultACSTaskGroupMaxConcurrentStarts, throttle.maxConcurrentStarts)
+}
+
+func TestTaskGroupThrottleQueuesTasksBeyondLimit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	throttle := newTestTaskGroupThrottle(ctx, 2)
+	recorder := &startRecorder{}
+
+	tasks := []*apitask.Task{
+		newThrottledTestTask("task1"),
+		newThrottledTestTask("task2"),
+		newThrottledTestTask("task3"),
+	}
+	for _, task := range tasks {
+		throttle.submit(testTaskGroup, task, recorder.startFunc(task))
+	}
+
+	assert.Equal(t, []string{"task1", "task2"}, recorder.startedTasks())
+	assert.Equal(t, 1, throttle.pendingCount(testTaskGroup))
+
+	tasks[0].SetKnownStatus(apitaskstatus.TaskRunning)
+	recorder.waitForStartedTasks(t, 3)
+	assert.Equal(t, []string{"task1", "task2", "task3"}, recorder.startedTasks())
+	assert.Equal(t, 0, throttle.pendingCount(testTaskGroup))
+}
+
+func TestTaskGroupThrottleReleasesSlotWhenTaskStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	throttle := newTestTaskGroupThrottle(ctx, 1)
+	recorder := &startRecorder{}
+
+	task1 := newThrottledTestTask("task1")
+	task2 := newThrottledTestTask("task2")
+	throttle.submit(testTaskGroup, task1, recorder.startFunc(task1))
+	throttle.submit(testTaskGroup, task2, recorder.startFunc(task2))
+	assert.Equal(t, []string{"task1"}, recorder.startedTasks())
+
+	task1.SetDesiredStatus(apitaskstatus.TaskStopped)
+	recorder.waitForStartedTasks(t, 2)
+}
+
+// TestTaskGroupThrottleResentTaskKeepsSlot tests that a task sent again by ACS while
+// being started doesn't take another slot of its group, and that the slot is released
+// once the task known by the task engine is running
+func TestTaskGroupThrottleResentTaskKeepsSlot(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The task engine keeps the task it was first given
+	managedTask := newThrottledTestTask("task1")
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	taskEngine.EXPECT().GetTaskByArn("task1").Return(managedTask, true).AnyTimes()
+	taskEngine.EXPECT().GetTaskByArn(gomock.Any()).Return(nil, false).AnyTimes()
+	throttle := newTaskGroupThrottle(ctx, taskEngine, 1)
+	throttle.pollInterval = testThrottlePollInterval
+	recorder := &startRecorder{}
+
+	resentTask := newThrottledTestTask("task1")
+	task2 := newThrottledTestTask("task2")
+	throttle.submit(testTaskGroup, managedTask, recorder.startFunc(managedTask))
+	throttle.submit(testTaskGroup, resentTask, recorder.startFunc(resentTask))
+	throttle.submit(testTaskGroup, task2, recorder.startFunc(task2))
+	assert.Equal(t, []string{"task1", "task1"}, recorder.startedTasks())
+	assert.Equal(t, 1, throttle.startingCount(testTaskGroup))
+	assert.Equal(t, 1, throttle.pendingCount(testTaskGroup))
+
+	// Only the task of the task engine is updated
+	managedTask.SetKnownStatus(apitaskstatus.TaskRunning)
+	recorder.waitForStartedTasks(t, 3)
+	assert.Equal(t, []string{"task1", "task1", "task2"}, recorder.startedTasks())
+}
+
+// TestTaskGroupThrottleResentQueuedTaskKeepsPlace tests that a task sent again by ACS
+// while queued is started once, in its place in the queue
+func TestTaskGroupThrottleResentQueuedTaskKeepsPlace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	throttle := newTestTaskGroupThrottle(ctx, 1)
+	recorder := &startRecorder{}
+
+	task1 := newThrottledTestTask("task1")
+	task2 := newThrottledTestTask("task2")
+	resentTask2 := newThrottledTestTask("task2")
+	throttle.submit(testTaskGroup, task1, recorder.startFunc(task1))
+	throttle.submit(testTaskGroup, task2, recorder.startFunc(task2))
+	throttle.submit(testTaskGroup, resentTask2, recorder.startFunc(resentTask2))
+	assert.Equal(t, 1, throttle.pendingCount(testTaskGroup))
+
+	task1.SetKnownStatus(apitaskstatus.TaskRunning)
+	recorder.waitForStartedTasks(t, 3)
+	assert.Equal(t, []string{"task1", "task2", "task2"}, recorder.startedTasks())
+	assert.Equal(t, 1, throttle.startingCount(testTaskGroup))
+}
+
+// TestTaskGroupThrottleReleasesSlotWhenContextCanceled tests that the start slots are
+// released and the queued tasks dropped once the context is canceled
+func TestTaskGroupThrottleReleasesSlotWhenContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	throttle := newTestTaskGroupThrottle(ctx, 1)
+	recorder := &startRecorder{}
+
+	task1 := newThrottledTestTask("task1")
+	task2 := newThrottledTestTask("task2")
+	throttle.submit(testTaskGroup, task1, recorder.startFunc(task1))
+	throttle.submit(testTaskGroup, task2, recorder.startFunc(task2))
+	cancel()
+
+	deadline := time.Now().Add(testThrottleWaitTimeout)
+	for throttle.startingCount(testTaskGroup) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the start slot to be released")
+		}
+		time.Sleep(testThrottlePollInterval)
+	}
+	assert.Equal(t, 0, throttle.pendingCount(testTaskGroup))
+	assert.Equal(t, []string{"task1"}, recorder.startedTasks())
+}
+
+func TestTaskGroupThrottleTasksWithoutGroupNotThrottled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	throttle := newTestTaskGroupThrottle(ctx, 1)
+	recorder := &startRecorder{}
+
+	for _, arn := range []string{"task1", "task2", "task3"} {
+		task := newThrottledTestTask(arn)
+		throttle.submit("", task, recorder.startFunc(task))
+	}
+	assert.Len(t, recorder.startedTasks(), 3)
+}
+
+func TestTaskGroupThrottleGroupsAreIndependent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	throttle := newTestTaskGroupThrottle(ctx, 1)
+	recorder := &startRecorder{}
+
+	task1 := newThrottledTestTask("task1")
+	task2 := newThrottledTestTask("task2")
+	task3 := newThrottledTestTask("task3")
+	throttle.submit("service:a", task1, recorder.startFunc(task1))
+	throttle.submit("service:b", task2, recorder.startFunc(task2))
+	throttle.submit("service:a", task3, recorder.startFunc(task3))
+
+	assert.Equal(t, []string{"task1", "task2"}, recorder.startedTasks())
+	assert.Equal(t, 1, throttle.pendingCount("service:a"))
+	assert.Equal(t, 0, throttle.pendingCount("service:b"))
+}
+
+func TestNilTaskGroupThrottleStartsTask(t *testing.T) {
+	var throttle *taskGroupThrottle
+	recorder := &startRecorder{}
+	task := newThrottledTestTask("task1")
+	throttle.submit(testTaskGroup, task, recorder.startFunc(task))
+	assert.Equal(t, []string{"task1"}, recorder.startedTasks())
+}
@@ -0,0 +1,72 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+// TaskManifestFilterer removes the tasks that the task engine already knows are
+// stopped from the diff between a task manifest and the tasks of the engine, so
+// that applying the manifest doesn't try to stop them again
+type TaskManifestFilterer struct {
+	stoppedTaskARNs map[string]struct{}
+}
+
+// newTaskManifestFilterer returns a new TaskManifestFilterer object for the tasks of the engine
+func newTaskManifestFilterer(engineTasks []*apitask.Task) *TaskManifestFilterer {
+	stoppedTaskARNs := make(map[string]struct{})
+	for _, task := range engineTasks {
+		if task.GetKnownStatus().Terminal() {
+			stoppedTaskARNs[task.Arn] = struct{}{}
+		}
+	}
+	return &TaskManifestFilterer{
+		stoppedTaskARNs: stoppedTaskARNs,
+	}
+}
+
+// filterManifest returns the tasks of the manifest that are not already stopped in the engine
+func (filterer *TaskManifestFilterer) filterManifest(manifest []*ecsacs.TaskIdentifier) []*ecsacs.TaskIdentifier {
+	filtered := make([]*ecsacs.TaskIdentifier, 0, len(manifest))
+	for _, task := range manifest {
+		if filterer.isStopped(aws.StringValue(task.TaskArn)) {
+			seelog.Debugf("Task %s of the task manifest is already stopped, ignoring it", aws.StringValue(task.TaskArn))
+			continue
+		}
+		filtered = append(filtered, task)
+	}
+	return filtered
+}
+
+// filterEngineTasks returns the tasks of the engine that are not already stopped
+func (filterer *TaskManifestFilterer) filterEngineTasks(engineTasks []*apitask.Task) []*apitask.Task {
+	filtered := make([]*apitask.Task, 0, len(engineTasks))
+	for _, task := range engineTasks {
+		if filterer.isStopped(task.Arn) {
+			continue
+		}
+		filtered = append(filtered, task)
+	}
+	return filtered
+}
+
+// isStopped returns true if the task is already stopped in the engine
+func (filterer *TaskManifestFilterer) isStopped(taskARN string) bool {
+	_, ok := filterer.stoppedTaskARNs[taskARN]
+	return ok
+}
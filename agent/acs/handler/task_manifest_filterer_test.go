@@ -0,0 +1,97 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func testManifestEngineTask(arn string, known, desired apitaskstatus.TaskStatus) *apitask.Task {
+	task := &apitask.Task{Arn: arn}
+	task.SetKnownStatus(known)
+	task.SetDesiredStatus(desired)
+	return task
+}
+
+func testManifestTask(arn, desiredStatus string) *ecsacs.TaskIdentifier {
+	return &ecsacs.TaskIdentifier{
+		TaskArn:        aws.String(arn),
+		DesiredStatus:  aws.String(desiredStatus),
+		TaskClusterArn: aws.String(clusterName),
+	}
+}
+
+func TestTaskManifestFiltererFiltersStoppedTasks(t *testing.T) {
+	engineTasks := []*apitask.Task{
+		testManifestEngineTask("running", apitaskstatus.TaskRunning, apitaskstatus.TaskRunning),
+		testManifestEngineTask("stopping", apitaskstatus.TaskRunning, apitaskstatus.TaskStopped),
+		testManifestEngineTask("stopped", apitaskstatus.TaskStopped, apitaskstatus.TaskStopped),
+	}
+	manifest := []*ecsacs.TaskIdentifier{
+		testManifestTask("running", apitaskstatus.TaskRunningString),
+		testManifestTask("stopping", apitaskstatus.TaskStoppedString),
+		testManifestTask("stopped", apitaskstatus.TaskStoppedString),
+		testManifestTask("unknown", apitaskstatus.TaskRunningString),
+	}
+
+	filterer := newTaskManifestFilterer(engineTasks)
+	assert.Equal(t, []*ecsacs.TaskIdentifier{manifest[0], manifest[1], manifest[3]}, filterer.filterManifest(manifest))
+	assert.Equal(t, []*apitask.Task{engineTasks[0], engineTasks[1]}, filterer.filterEngineTasks(engineTasks))
+}
+
+func TestTaskManifestFiltererStoppedTaskNotStoppedAgain(t *testing.T) {
+	// The task stopped on its own, before the desired status was updated. It
+	// isn't in the manifest anymore but doesn't need to be stopped
+	engineTasks := []*apitask.Task{
+		testManifestEngineTask("running", apitaskstatus.TaskRunning, apitaskstatus.TaskRunning),
+		testManifestEngineTask("orphaned", apitaskstatus.TaskRunning, apitaskstatus.TaskRunning),
+		testManifestEngineTask("stopped", apitaskstatus.TaskStopped, apitaskstatus.TaskRunning),
+	}
+	manifest := []*ecsacs.TaskIdentifier{
+		testManifestTask("running", apitaskstatus.TaskRunningString),
+		testManifestTask("stopped", apitaskstatus.TaskStoppedString),
+	}
+
+	filterer := newTaskManifestFilterer(engineTasks)
+	tasksToKill := compareTasks(filterer.filterManifest(manifest), filterer.filterEngineTasks(engineTasks), clusterName)
+	assert.Equal(t, []*ecsacs.TaskIdentifier{
+		{
+			DesiredStatus:  aws.String(apitaskstatus.TaskStoppedString),
+			TaskArn:        aws.String("orphaned"),
+			TaskClusterArn: aws.String(clusterName),
+		},
+	}, tasksToKill)
+}
+
+func TestTaskManifestFiltererNoStoppedTasks(t *testing.T) {
+	engineTasks := []*apitask.Task{
+		testManifestEngineTask("running", apitaskstatus.TaskRunning, apitaskstatus.TaskRunning),
+	}
+	manifest := []*ecsacs.TaskIdentifier{
+		testManifestTask("running", apitaskstatus.TaskRunningString),
+	}
+
+	filterer := newTaskManifestFilterer(engineTasks)
+	assert.Equal(t, manifest, filterer.filterManifest(manifest))
+	assert.Equal(t, engineTasks, filterer.filterEngineTasks(engineTasks))
+}
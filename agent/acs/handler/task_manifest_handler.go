@@ -16,12 +16,14 @@ import (
 	"context"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
 	"github.com/aws/amazon-ecs-agent/agent/data"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/aws/amazon-ecs-agent/agent/metrics"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/cihub/seelog"
@@ -33,6 +35,7 @@ type taskManifestHandler struct {
 	messageBufferTaskManifestAck             chan string
 	messageBufferTaskStopVerificationMessage chan *ecsacs.TaskStopVerificationMessage
 	messageBufferTaskStopVerificationAck     chan *ecsacs.TaskStopVerificationAck
+	messageBufferSecretsPrewarm              chan []*ecsacs.TaskIdentifier
 	ctx                                      context.Context
 	taskEngine                               engine.TaskEngine
 	cancel                                   context.CancelFunc
@@ -41,14 +44,26 @@ type taskManifestHandler struct {
 	containerInstanceArn                     string
 	acsClient                                wsclient.ClientServer
 	latestSeqNumberTaskManifest              *int64
+	manifestHistoryDepth                     int
+	secretsPrewarmer                         *SecretsPrewarmer
+	signatureVerifier                        *ManifestSignatureVerifier
+	imagePrePuller                           *ImagePrePuller
 	messageId                                string
 	lock                                     sync.RWMutex
+	*inFlightAckTracker
+	routines *handlerRoutines
+	// goroutines limits the goroutines started by the handler, nil if they
+	// aren't limited
+	goroutines *HandlerGoroutineLimiter
 }
 
 // newTaskManifestHandler returns an instance of the taskManifestHandler struct
 func newTaskManifestHandler(ctx context.Context,
 	cluster string, containerInstanceArn string, acsClient wsclient.ClientServer,
-	dataClient data.Client, taskEngine engine.TaskEngine, latestSeqNumberTaskManifest *int64) taskManifestHandler {
+	dataClient data.Client, taskEngine engine.TaskEngine, latestSeqNumberTaskManifest *int64,
+	manifestHistoryDepth int, secretsPrewarmer *SecretsPrewarmer,
+	signatureVerifier *ManifestSignatureVerifier, imagePrePuller *ImagePrePuller,
+	goroutines *HandlerGoroutineLimiter) taskManifestHandler {
 
 	// Create a cancelable context from the parent context
 	derivedContext, cancel := context.WithCancel(ctx)
@@ -57,6 +72,7 @@ func newTaskManifestHandler(ctx context.Context,
 		messageBufferTaskManifestAck:             make(chan string),
 		messageBufferTaskStopVerificationMessage: make(chan *ecsacs.TaskStopVerificationMessage),
 		messageBufferTaskStopVerificationAck:     make(chan *ecsacs.TaskStopVerificationAck),
+		messageBufferSecretsPrewarm:              make(chan []*ecsacs.TaskIdentifier, 1),
 		ctx:                                      derivedContext,
 		cancel:                                   cancel,
 		cluster:                                  cluster,
@@ -65,32 +81,51 @@ func newTaskManifestHandler(ctx context.Context,
 		taskEngine:                               taskEngine,
 		dataClient:                               dataClient,
 		latestSeqNumberTaskManifest:              latestSeqNumberTaskManifest,
+		manifestHistoryDepth:                     manifestHistoryDepth,
+		secretsPrewarmer:                         secretsPrewarmer,
+		signatureVerifier:                        signatureVerifier,
+		imagePrePuller:                           imagePrePuller,
+		inFlightAckTracker:                       newInFlightAckTracker(),
+		routines:                                 &handlerRoutines{},
+		goroutines:                               goroutines,
 	}
 }
 
 func (taskManifestHandler *taskManifestHandler) handlerFuncTaskManifestMessage() func(
 	message *ecsacs.TaskManifestMessage) {
 	return func(message *ecsacs.TaskManifestMessage) {
-		taskManifestHandler.messageBufferTaskManifest <- message
+		taskManifestHandler.trackReceived("TaskManifestMessage", aws.StringValue(message.MessageId))
+		select {
+		case taskManifestHandler.messageBufferTaskManifest <- message:
+		case <-taskManifestHandler.ctx.Done():
+			taskManifestHandler.trackAcked(aws.StringValue(message.MessageId))
+		}
 	}
 }
 
 func (taskManifestHandler *taskManifestHandler) handlerFuncTaskStopVerificationMessage() func(
 	message *ecsacs.TaskStopVerificationAck) {
 	return func(message *ecsacs.TaskStopVerificationAck) {
-		taskManifestHandler.messageBufferTaskStopVerificationAck <- message
+		select {
+		case taskManifestHandler.messageBufferTaskStopVerificationAck <- message:
+		case <-taskManifestHandler.ctx.Done():
+		}
 	}
 }
 
 func (taskManifestHandler *taskManifestHandler) start() {
 	// Task manifest and it's ack
-	go taskManifestHandler.handleTaskManifestMessage()
-	go taskManifestHandler.sendTaskManifestMessageAck()
+	taskManifestHandler.routines.run(taskManifestHandler.handleTaskManifestMessage)
+	taskManifestHandler.routines.run(taskManifestHandler.sendTaskManifestMessageAck)
 
 	// Task stop verification message and it's ack
-	go taskManifestHandler.sendTaskStopVerificationMessage()
-	go taskManifestHandler.handleTaskStopVerificationAck()
+	taskManifestHandler.routines.run(taskManifestHandler.sendTaskStopVerificationMessage)
+	taskManifestHandler.routines.run(taskManifestHandler.handleTaskStopVerificationAck)
 
+	// Secrets of the tasks of the manifests not received yet
+	if taskManifestHandler.secretsPrewarmer != nil {
+		taskManifestHandler.routines.run(taskManifestHandler.prewarmSecrets)
+	}
 }
 
 func (taskManifestHandler *taskManifestHandler) getMessageId() string {
@@ -151,6 +186,7 @@ func (taskManifestHandler *taskManifestHandler) ackTaskManifestMessage(messageID
 	if err != nil {
 		seelog.Warnf("Error 'ack'ing TaskManifestMessage with messageID: %s, error: %v", messageID, err)
 	}
+	taskManifestHandler.trackAcked(messageID)
 }
 
 // stop is used to invoke a cancellation function
@@ -158,6 +194,11 @@ func (taskManifestHandler *taskManifestHandler) stop() {
 	taskManifestHandler.cancel()
 }
 
+// StopWithTimeout stops the handler and waits for its goroutines to exit until ctx is done
+func (taskManifestHandler *taskManifestHandler) StopWithTimeout(ctx context.Context) error {
+	return stopWithTimeout(ctx, taskManifestHandler.stop, taskManifestHandler.routines, taskManifestHandler.clearAcks)
+}
+
 func (taskManifestHandler *taskManifestHandler) handleTaskManifestMessage() {
 	for {
 		select {
@@ -166,11 +207,41 @@ func (taskManifestHandler *taskManifestHandler) handleTaskManifestMessage() {
 		case message := <-taskManifestHandler.messageBufferTaskManifest:
 			if err := taskManifestHandler.handleTaskManifestSingleMessage(message); err != nil {
 				seelog.Warnf("Unable to handle taskManifest message [%s]: %v", message.String(), err)
+				taskManifestHandler.trackAcked(aws.StringValue(message.MessageId))
 			}
 		}
 	}
 }
 
+// prewarmSecrets fetches the secrets of the tasks of the latest task manifest in
+// the background, so that the handling of the manifests isn't delayed
+func (taskManifestHandler *taskManifestHandler) prewarmSecrets() {
+	for {
+		select {
+		case <-taskManifestHandler.ctx.Done():
+			return
+		case tasks := <-taskManifestHandler.messageBufferSecretsPrewarm:
+			taskManifestHandler.secretsPrewarmer.prewarm(taskManifestHandler.ctx, tasks)
+		}
+	}
+}
+
+// queueSecretsPrewarm queues the tasks of the manifest for their secrets to be
+// prewarmed, replacing the tasks of an older manifest not prewarmed yet
+func (taskManifestHandler *taskManifestHandler) queueSecretsPrewarm(tasks []*ecsacs.TaskIdentifier) {
+	if taskManifestHandler.secretsPrewarmer == nil {
+		return
+	}
+	select {
+	case <-taskManifestHandler.messageBufferSecretsPrewarm:
+	default:
+	}
+	select {
+	case taskManifestHandler.messageBufferSecretsPrewarm <- tasks:
+	default:
+	}
+}
+
 func (taskManifestHandler *taskManifestHandler) sendTaskStopVerificationMessage() {
 	for {
 		select {
@@ -238,6 +309,13 @@ func (taskManifestHandler *taskManifestHandler) handleSingleMessageVerificationA
 
 func (taskManifestHandler *taskManifestHandler) handleTaskManifestSingleMessage(
 	message *ecsacs.TaskManifestMessage) error {
+	// Manifests that aren't signed by the signing key are neither applied nor acked
+	if taskManifestHandler.signatureVerifier != nil {
+		if err := taskManifestHandler.signatureVerifier.verifyMessage(message); err != nil {
+			metrics.MetricsEngineGlobal.RecordACSEvent(taskManifestSignatureInvalidEvent, 1)
+			return err
+		}
+	}
 	taskListManifestHandler := message.Tasks
 	seqNumberFromMessage := *message.Timeline
 	clusterARN := *message.ClusterArn
@@ -255,28 +333,55 @@ func (taskManifestHandler *taskManifestHandler) handleTaskManifestSingleMessage(
 		if err != nil {
 			return err
 		}
+		// Keep the manifest for diagnosis, failing to do so doesn't prevent it from being applied
+		err = taskManifestHandler.dataClient.SaveTaskManifest(&data.TaskManifest{
+			SequenceNumber: seqNumberFromMessage,
+			MessageID:      aws.StringValue(message.MessageId),
+			ClusterARN:     clusterARN,
+			Tasks:          taskListManifestHandler,
+			ReceivedAt:     time.Now(),
+		}, taskManifestHandler.manifestHistoryDepth)
+		if err != nil {
+			seelog.Warnf("Unable to save the task manifest with sequence number %d: %v", seqNumberFromMessage, err)
+		}
 
-		tasksToKill := compareTasks(taskListManifestHandler, runningTasksOnInstance, clusterARN)
+		taskManifestHandler.queueSecretsPrewarm(taskListManifestHandler)
+		// Pull the images of the tasks not received yet in the background
+		taskManifestHandler.imagePrePuller.prePull(taskListManifestHandler)
+
+		// Leave out the tasks already stopped, so that they aren't stopped again
+		filterer := newTaskManifestFilterer(runningTasksOnInstance)
+		tasksToKill := compareTasks(filterer.filterManifest(taskListManifestHandler),
+			filterer.filterEngineTasks(runningTasksOnInstance), clusterARN)
 
 		// Update messageId so that it can be compared to the messageId in TaskStopVerificationAck message
 		taskManifestHandler.setMessageId(*message.MessageId)
 
 		// Throw the task manifest ack and task verification message in async so that it does not block the current
 		// thread.
-		go func() {
-			taskManifestHandler.messageBufferTaskManifestAck <- *message.MessageId
+		taskManifestHandler.trackAckQueued(*message.MessageId)
+		taskManifestHandler.goroutines.spawn(taskManifestMessageType, func() {
+			select {
+			case taskManifestHandler.messageBufferTaskManifestAck <- *message.MessageId:
+			case <-taskManifestHandler.ctx.Done():
+				return
+			}
 			if len(tasksToKill) > 0 {
 				taskStopVerificationMessage := ecsacs.TaskStopVerificationMessage{
 					MessageId:      message.MessageId,
 					StopCandidates: tasksToKill,
 				}
 
-				taskManifestHandler.messageBufferTaskStopVerificationMessage <- &taskStopVerificationMessage
+				select {
+				case taskManifestHandler.messageBufferTaskStopVerificationMessage <- &taskStopVerificationMessage:
+				case <-taskManifestHandler.ctx.Done():
+				}
 			}
-		}()
+		})
 	} else {
 		seelog.Debugf("Skipping the task manifest message. sequence number from task manifest: %d. sequence number "+
 			" from Agent: %d", seqNumberFromMessage, agentLatestSequenceNumber)
+		taskManifestHandler.trackAcked(aws.StringValue(message.MessageId))
 	}
 
 	return nil
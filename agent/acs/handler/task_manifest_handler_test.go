@@ -34,7 +34,8 @@ import (
 )
 
 const (
-	testSeqNum = 12
+	testSeqNum               = 12
+	testManifestHistoryDepth = 5
 )
 
 // Tests the case when all the tasks running on the instance needs to be killed
@@ -54,7 +55,7 @@ func TestManifestHandlerKillAllTasks(t *testing.T) {
 	defer cleanup()
 
 	newTaskManifest := newTaskManifestHandler(ctx, cluster, containerInstanceArn, mockWSClient,
-		dataClient, taskEngine, aws.Int64(11))
+		dataClient, taskEngine, aws.Int64(11), testManifestHistoryDepth, nil, nil, nil, nil)
 
 	ackRequested := &ecsacs.AckRequest{
 		Cluster:           aws.String(cluster),
@@ -130,6 +131,14 @@ func TestManifestHandlerKillAllTasks(t *testing.T) {
 	seqnum, err := dataClient.GetMetadata(data.TaskManifestSeqNumKey)
 	require.NoError(t, err)
 	assert.Equal(t, strconv.FormatInt(int64(testSeqNum), 10), seqnum)
+
+	// Verify that the manifest has been saved to the manifest history.
+	manifests, err := dataClient.GetManifestHistory()
+	require.NoError(t, err)
+	require.Len(t, manifests, 1)
+	assert.Equal(t, int64(testSeqNum), manifests[0].SequenceNumber)
+	assert.Equal(t, messageId, manifests[0].MessageID)
+	assert.Equal(t, message.Tasks, manifests[0].Tasks)
 }
 
 // Tests the case when two of three tasks running on the instance needs to be killed
@@ -149,7 +158,7 @@ func TestManifestHandlerKillFewTasks(t *testing.T) {
 	defer cleanup()
 
 	newTaskManifest := newTaskManifestHandler(ctx, cluster, containerInstanceArn, mockWSClient,
-		dataClient, taskEngine, aws.Int64(11))
+		dataClient, taskEngine, aws.Int64(11), testManifestHistoryDepth, nil, nil, nil, nil)
 
 	ackRequested := &ecsacs.AckRequest{
 		Cluster:           aws.String(cluster),
@@ -253,7 +262,7 @@ func TestManifestHandlerKillNoTasks(t *testing.T) {
 	defer cleanup()
 
 	newTaskManifest := newTaskManifestHandler(ctx, cluster, containerInstanceArn, mockWSClient,
-		dataClient, taskEngine, aws.Int64(11))
+		dataClient, taskEngine, aws.Int64(11), testManifestHistoryDepth, nil, nil, nil, nil)
 
 	ackRequested := &ecsacs.AckRequest{
 		Cluster:           aws.String(cluster),
@@ -343,7 +352,7 @@ func TestManifestHandlerDifferentTaskLists(t *testing.T) {
 	defer cleanup()
 
 	newTaskManifest := newTaskManifestHandler(ctx, cluster, containerInstanceArn, mockWSClient,
-		dataClient, taskEngine, aws.Int64(11))
+		dataClient, taskEngine, aws.Int64(11), testManifestHistoryDepth, nil, nil, nil, nil)
 
 	ackRequested := &ecsacs.AckRequest{
 		Cluster:           aws.String(cluster),
@@ -464,7 +473,7 @@ func TestManifestHandlerSequenceNumbers(t *testing.T) {
 			ctx := context.TODO()
 			mockWSClient := mock_wsclient.NewMockClientServer(ctrl)
 			newTaskManifest := newTaskManifestHandler(ctx, cluster, containerInstanceArn, mockWSClient,
-				data.NewNoopClient(), taskEngine, aws.Int64(tc.inputSequenceNumber))
+				data.NewNoopClient(), taskEngine, aws.Int64(tc.inputSequenceNumber), testManifestHistoryDepth, nil, nil, nil, nil)
 
 			taskList := []*task.Task{
 				{Arn: "arn2", DesiredStatusUnsafe: apitaskstatus.TaskRunning},
@@ -0,0 +1,120 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	dockercontainer "github.com/docker/docker/api/types/container"
+	"github.com/pkg/errors"
+)
+
+const (
+	// cpuSharesPerVCPU is the number of cpu shares corresponding to a vCPU
+	cpuSharesPerVCPU = 1024
+	bytesPerMiB      = 1024 * 1024
+	// taskValidationFailureEvent is the ACS event recorded when a task received
+	// from ACS is rejected because of an invalid resource configuration
+	taskValidationFailureEvent = "TaskValidationFailure"
+)
+
+// taskResourceValidator validates the cpu and memory configuration of the tasks
+// received from ACS before they are handed over to the task engine. Docker
+// either rejects invalid configurations when creating the containers or starts
+// the containers with limits that can't be honored, so such tasks are better
+// stopped right away
+type taskResourceValidator struct{}
+
+// validate returns an error if the resources requested by the containers of the
+// task are inconsistent with each other or with the task limits, or if they exceed
+// the resources available on the instance. The instance capacity isn't validated
+// if the instance resources are unknown
+func (validator taskResourceValidator) validate(task *apitask.Task, resources *instanceResources) error {
+	for _, container := range task.Containers {
+		reservationMiB, err := memoryReservationMiB(container)
+		if err != nil {
+			return err
+		}
+		if container.Memory > 0 && reservationMiB > int64(container.Memory) {
+			return errors.Errorf("container %s: memory reservation (%d MiB) exceeds the memory limit (%d MiB)",
+				container.Name, reservationMiB, container.Memory)
+		}
+		if task.Memory > 0 && int64(container.Memory) > task.Memory {
+			return errors.Errorf("container %s: memory limit (%d MiB) exceeds the task memory limit (%d MiB)",
+				container.Name, container.Memory, task.Memory)
+		}
+	}
+
+	if resources == nil {
+		return nil
+	}
+	taskCPU, taskMemoryMiB, err := taskReservation(task)
+	if err != nil {
+		return err
+	}
+	if resources.availableCPU > 0 && taskCPU > resources.availableCPU {
+		return errors.Errorf("task cpu (%d units) exceeds the cpu available on the instance (%d units)",
+			taskCPU, resources.availableCPU)
+	}
+	if resources.availableMemoryMiB > 0 && taskMemoryMiB > resources.availableMemoryMiB {
+		return errors.Errorf("task memory (%d MiB) exceeds the memory available on the instance (%d MiB)",
+			taskMemoryMiB, resources.availableMemoryMiB)
+	}
+	return nil
+}
+
+// taskReservation returns the cpu units and the memory, in MiB, reserved on the
+// instance by the task: its task level limits if set, the sum of the resources
+// of its containers otherwise
+func taskReservation(task *apitask.Task) (int64, int64, error) {
+	var containersCPU, containersMemoryMiB int64
+	for _, container := range task.Containers {
+		reservationMiB, err := memoryReservationMiB(container)
+		if err != nil {
+			return 0, 0, err
+		}
+		containersCPU += int64(container.CPU)
+		if int64(container.Memory) > reservationMiB {
+			containersMemoryMiB += int64(container.Memory)
+		} else {
+			containersMemoryMiB += reservationMiB
+		}
+	}
+
+	taskCPU := containersCPU
+	if task.CPU > 0 {
+		taskCPU = int64(task.CPU * cpuSharesPerVCPU)
+	}
+	taskMemoryMiB := containersMemoryMiB
+	if task.Memory > 0 {
+		taskMemoryMiB = task.Memory
+	}
+	return taskCPU, taskMemoryMiB, nil
+}
+
+// memoryReservationMiB returns the memory reservation of the container, which
+// is only found in the docker host config sent by ACS
+func memoryReservationMiB(container *apicontainer.Container) (int64, error) {
+	rawHostConfig := container.GetHostConfig()
+	if rawHostConfig == nil {
+		return 0, nil
+	}
+	hostConfig := &dockercontainer.HostConfig{}
+	if err := json.Unmarshal([]byte(*rawHostConfig), hostConfig); err != nil {
+		return 0, errors.Wrapf(err, "container %s: unable to decode host config", container.Name)
+	}
+	return hostConfig.MemoryReservation / bytesPerMiB, nil
+}
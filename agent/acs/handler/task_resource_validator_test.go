@@ -0,0 +1,159 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"fmt"
+	"testing"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+// testResourceContainer returns a container with the given cpu, memory limit and
+// memory reservation, the latter being set in the docker host config
+func testResourceContainer(cpu uint, memoryMiB uint, reservationMiB int64) *apicontainer.Container {
+	container := &apicontainer.Container{
+		Name:   "container",
+		CPU:    cpu,
+		Memory: memoryMiB,
+	}
+	if reservationMiB > 0 {
+		container.DockerConfig.HostConfig = aws.String(fmt.Sprintf(`{"MemoryReservation":%d}`, reservationMiB*bytesPerMiB))
+	}
+	return container
+}
+
+func TestTaskResourceValidator(t *testing.T) {
+	resources := &instanceResources{
+		instanceType:       "c5.large",
+		availableCPU:       2048,
+		availableMemoryMiB: 3500,
+	}
+	testCases := []struct {
+		name        string
+		task        *apitask.Task
+		resources   *instanceResources
+		expectError bool
+	}{
+		{
+			name: "valid task",
+			task: &apitask.Task{
+				Containers: []*apicontainer.Container{
+					testResourceContainer(512, 1024, 512),
+					testResourceContainer(512, 0, 512),
+				},
+			},
+			resources: resources,
+		},
+		{
+			name: "memory reservation exceeds container memory limit",
+			task: &apitask.Task{
+				Containers: []*apicontainer.Container{testResourceContainer(512, 256, 512)},
+			},
+			resources:   resources,
+			expectError: true,
+		},
+		{
+			name: "memory reservation without container memory limit",
+			task: &apitask.Task{
+				Containers: []*apicontainer.Container{testResourceContainer(512, 0, 2048)},
+			},
+			resources: resources,
+		},
+		{
+			name: "invalid host config",
+			task: &apitask.Task{
+				Containers: []*apicontainer.Container{{
+					Name:         "container",
+					DockerConfig: apicontainer.DockerConfig{HostConfig: aws.String("{")},
+				}},
+			},
+			resources:   resources,
+			expectError: true,
+		},
+		{
+			name: "container memory limit exceeds task memory limit",
+			task: &apitask.Task{
+				Memory:     512,
+				Containers: []*apicontainer.Container{testResourceContainer(512, 1024, 0)},
+			},
+			resources:   resources,
+			expectError: true,
+		},
+		{
+			name: "task cpu exceeds instance cpu",
+			task: &apitask.Task{
+				CPU:        4,
+				Containers: []*apicontainer.Container{testResourceContainer(0, 512, 0)},
+			},
+			resources:   resources,
+			expectError: true,
+		},
+		{
+			name: "container cpu exceeds instance cpu",
+			task: &apitask.Task{
+				Containers: []*apicontainer.Container{
+					testResourceContainer(1024, 512, 0),
+					testResourceContainer(1536, 512, 0),
+				},
+			},
+			resources:   resources,
+			expectError: true,
+		},
+		{
+			name: "task memory exceeds instance memory",
+			task: &apitask.Task{
+				Memory:     4096,
+				Containers: []*apicontainer.Container{testResourceContainer(512, 1024, 0)},
+			},
+			resources:   resources,
+			expectError: true,
+		},
+		{
+			name: "container memory exceeds instance memory",
+			task: &apitask.Task{
+				Containers: []*apicontainer.Container{
+					testResourceContainer(512, 2048, 0),
+					testResourceContainer(512, 0, 2048),
+				},
+			},
+			resources:   resources,
+			expectError: true,
+		},
+		{
+			name: "instance capacity not validated when unknown",
+			task: &apitask.Task{
+				CPU:        4,
+				Memory:     4096,
+				Containers: []*apicontainer.Container{testResourceContainer(512, 1024, 0)},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := taskResourceValidator{}.validate(tc.task, tc.resources)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// taskSubmitRateLimiter limits the rate at which the tasks of a payload message
+// are submitted to the task engine. ACS can send payload messages with a large
+// number of tasks, starting all of them at once makes docker pull many images
+// concurrently and saturates the network bandwidth of the instance
+type taskSubmitRateLimiter struct {
+	limiter *rate.Limiter
+}
+
+// newTaskSubmitRateLimiter returns a new taskSubmitRateLimiter object allowing
+// ratePerSecond task submissions per second. Submissions are evenly spaced
+// rather than bursted, so that the image pulls of the tasks are spread out. It
+// returns nil, which doesn't limit submissions, if the rate is not positive
+func newTaskSubmitRateLimiter(ratePerSecond int) *taskSubmitRateLimiter {
+	if ratePerSecond <= 0 {
+		return nil
+	}
+	return &taskSubmitRateLimiter{
+		limiter: rate.NewLimiter(rate.Limit(ratePerSecond), 1),
+	}
+}
+
+// wait blocks until the next task can be submitted. An error is returned if
+// the context is cancelled first
+func (submitLimiter *taskSubmitRateLimiter) wait(ctx context.Context) error {
+	if submitLimiter == nil {
+		return nil
+	}
+	return submitLimiter.limiter.Wait(ctx)
+}
@@ -0,0 +1,155 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// benchmarkBatchSize is the number of tasks in the payload messages of the benchmarks
+	benchmarkBatchSize = 50
+	// benchmarkImagePullDuration is how long the simulated image pull of a task takes
+	benchmarkImagePullDuration = 10 * time.Millisecond
+)
+
+func TestNewTaskSubmitRateLimiterDisabled(t *testing.T) {
+	assert.Nil(t, newTaskSubmitRateLimiter(0))
+	assert.Nil(t, newTaskSubmitRateLimiter(-1))
+}
+
+func TestNilTaskSubmitRateLimiter(t *testing.T) {
+	var submitLimiter *taskSubmitRateLimiter
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, submitLimiter.wait(context.TODO()))
+	}
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestTaskSubmitRateLimiterPacesSubmissions(t *testing.T) {
+	submitLimiter := newTaskSubmitRateLimiter(20)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		require.NoError(t, submitLimiter.wait(context.TODO()))
+	}
+	// The first submission is immediate, the next ones are 50ms apart
+	assert.True(t, time.Since(start) >= 190*time.Millisecond, "submissions were not rate limited")
+}
+
+func TestTaskSubmitRateLimiterCanceled(t *testing.T) {
+	submitLimiter := newTaskSubmitRateLimiter(1)
+	require.NoError(t, submitLimiter.wait(context.TODO()))
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	assert.Error(t, submitLimiter.wait(ctx))
+}
+
+func TestHandlePayloadMessageRateLimitsTaskSubmissions(t *testing.T) {
+	tester := setup(t)
+	defer tester.ctrl.Finish()
+	defer tester.cancel()
+	tester.payloadHandler.submitRatePerSecond = 20
+
+	payloadMessage := &ecsacs.PayloadMessage{MessageId: aws.String(payloadMessageId)}
+	for i := 0; i < 5; i++ {
+		payloadMessage.Tasks = append(payloadMessage.Tasks, &ecsacs.Task{
+			Arn:           aws.String(fmt.Sprintf("%s-%d", testTaskARN, i)),
+			DesiredStatus: aws.String("RUNNING"),
+		})
+	}
+
+	var addedTasks int32
+	tester.mockTaskEngine.EXPECT().AddTask(gomock.Any()).Do(func(task *apitask.Task) {
+		atomic.AddInt32(&addedTasks, 1)
+	}).Times(5)
+
+	start := time.Now()
+	err := tester.payloadHandler.handleSingleMessage(payloadMessage)
+	assert.NoError(t, err, "Error handling payload message")
+	assert.True(t, time.Since(start) >= 190*time.Millisecond, "task submissions were not rate limited")
+
+	select {
+	case mid := <-tester.payloadHandler.ackRequest:
+		assert.Equal(t, payloadMessageId, mid)
+		// The message is only acked once all its tasks have been submitted
+		assert.Equal(t, int32(5), atomic.LoadInt32(&addedTasks))
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for payload message to be acked")
+	}
+}
+
+// submitBenchmarkBatch submits a batch of tasks, each simulating an image pull,
+// through the rate limiter and returns the peak number of concurrent pulls
+func submitBenchmarkBatch(submitLimiter *taskSubmitRateLimiter) int32 {
+	var current, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < benchmarkBatchSize; i++ {
+		submitLimiter.wait(context.TODO())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pulls := atomic.AddInt32(&current, 1)
+			for {
+				observed := atomic.LoadInt32(&peak)
+				if pulls <= observed || atomic.CompareAndSwapInt32(&peak, observed, pulls) {
+					break
+				}
+			}
+			time.Sleep(benchmarkImagePullDuration)
+			atomic.AddInt32(&current, -1)
+		}()
+	}
+	wg.Wait()
+	return peak
+}
+
+// BenchmarkRateLimitedTaskSubmission and BenchmarkUnlimitedTaskSubmission report
+// the peak number of concurrent image pulls when submitting the tasks of a
+// payload message with and without the rate limiter
+func BenchmarkRateLimitedTaskSubmission(b *testing.B) {
+	var peak int32
+	for i := 0; i < b.N; i++ {
+		if batchPeak := submitBenchmarkBatch(newTaskSubmitRateLimiter(1000)); batchPeak > peak {
+			peak = batchPeak
+		}
+	}
+	b.ReportMetric(float64(peak), "peak-concurrent-pulls")
+}
+
+func BenchmarkUnlimitedTaskSubmission(b *testing.B) {
+	var peak int32
+	for i := 0; i < b.N; i++ {
+		if batchPeak := submitBenchmarkBatch(nil); batchPeak > peak {
+			peak = batchPeak
+		}
+	}
+	b.ReportMetric(float64(peak), "peak-concurrent-pulls")
+}
@@ -0,0 +1,192 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// taskTagLabelPrefix is the prefix of the docker labels the tags of a
+	// task are propagated to
+	taskTagLabelPrefix = "com.amazonaws.ecs.tag."
+	// dockerConfigLabelsKey is the key of the labels in the docker config of a container
+	dockerConfigLabelsKey = "Labels"
+)
+
+// cachedTaskTags are the tags of a task fetched from the ECS API. The tags are
+// nil if they couldn't be fetched
+type cachedTaskTags struct {
+	tags      map[string]string
+	fetchedAt time.Time
+}
+
+// taskTagsSynchronizer propagates the tags of the tasks to the docker labels of
+// their containers, so that they are visible when inspecting the containers.
+// The tags are taken from the payload message and fetched from the ECS API when
+// the message doesn't include them. Fetched tags, and failures to fetch them,
+// are cached so that tasks sent again by ACS don't result in more API calls
+type taskTagsSynchronizer struct {
+	ecsClient api.ECSClient
+	ttl       time.Duration
+	lock      sync.Mutex
+	cache     map[string]cachedTaskTags
+	// now returns the current time, it is overridden in unit tests
+	now func() time.Time
+}
+
+// newTaskTagsSynchronizer returns a new taskTagsSynchronizer object, nil if the
+// propagation of the tags isn't enabled
+func newTaskTagsSynchronizer(enabled bool, ecsClient api.ECSClient, ttl time.Duration) *taskTagsSynchronizer {
+	if !enabled {
+		return nil
+	}
+	if ttl <= 0 {
+		ttl = config.DefaultACSTagCacheTTL
+	}
+	return &taskTagsSynchronizer{
+		ecsClient: ecsClient,
+		ttl:       ttl,
+		cache:     make(map[string]cachedTaskTags),
+		now:       time.Now,
+	}
+}
+
+// propagate adds the tags of the task received from ACS to the docker config of
+// the containers of the task as labels. Labels set by the task definition take
+// precedence over the tags. Failing to get the tags doesn't prevent the task
+// from being started
+func (synchronizer *taskTagsSynchronizer) propagate(acsTask *ecsacs.Task, task *apitask.Task) {
+	if synchronizer == nil {
+		return
+	}
+	tags := synchronizer.tags(acsTask)
+	if len(tags) == 0 {
+		return
+	}
+	for _, container := range task.Containers {
+		dockerConfig, err := addDockerConfigLabels(aws.StringValue(container.DockerConfig.Config), tags)
+		if err != nil {
+			seelog.Warnf("Unable to add the tags of task %s to the labels of container %s: %v",
+				task.Arn, container.Name, err)
+			continue
+		}
+		container.DockerConfig.Config = aws.String(dockerConfig)
+	}
+}
+
+// tags returns the tags of the task, from the payload message if it includes
+// them, from the cache or the ECS API otherwise. The ECS API isn't called with
+// the lock held, so that a slow call doesn't hold back the other tasks
+func (synchronizer *taskTagsSynchronizer) tags(acsTask *ecsacs.Task) map[string]string {
+	if len(acsTask.Tags) > 0 {
+		return aws.StringValueMap(acsTask.Tags)
+	}
+
+	taskARN := aws.StringValue(acsTask.Arn)
+	if cached, ok := synchronizer.cached(taskARN); ok {
+		return cached.tags
+	}
+
+	var tags map[string]string
+	ecsTags, err := synchronizer.ecsClient.GetResourceTags(taskARN)
+	if err != nil {
+		seelog.Warnf("Unable to get the tags of task %s, they won't be added to the container labels: %v",
+			taskARN, err)
+	} else {
+		tags = make(map[string]string, len(ecsTags))
+		for _, tag := range ecsTags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+	}
+	synchronizer.store(taskARN, tags)
+	return tags
+}
+
+// cached returns the cached tags of the task, if they were fetched within the TTL
+func (synchronizer *taskTagsSynchronizer) cached(taskARN string) (cachedTaskTags, bool) {
+	synchronizer.lock.Lock()
+	defer synchronizer.lock.Unlock()
+	cached, ok := synchronizer.cache[taskARN]
+	if !ok || synchronizer.now().Sub(cached.fetchedAt) >= synchronizer.ttl {
+		return cachedTaskTags{}, false
+	}
+	return cached, true
+}
+
+// store caches the fetched tags of the task and evicts the expired ones
+func (synchronizer *taskTagsSynchronizer) store(taskARN string, tags map[string]string) {
+	synchronizer.lock.Lock()
+	defer synchronizer.lock.Unlock()
+	now := synchronizer.now()
+	for arn, cached := range synchronizer.cache {
+		if now.Sub(cached.fetchedAt) >= synchronizer.ttl {
+			delete(synchronizer.cache, arn)
+		}
+	}
+	synchronizer.cache[taskARN] = cachedTaskTags{tags: tags, fetchedAt: now}
+}
+
+// addDockerConfigLabels adds the tags as labels to the serialized docker config
+// of a container and returns the updated config. Other fields of the config are
+// kept as is
+func addDockerConfigLabels(dockerConfig string, tags map[string]string) (string, error) {
+	fields := make(map[string]json.RawMessage)
+	if dockerConfig != "" {
+		if err := json.Unmarshal([]byte(dockerConfig), &fields); err != nil {
+			return "", err
+		}
+	}
+	// Docker config fields are decoded case insensitively
+	labelsKey := dockerConfigLabelsKey
+	for key := range fields {
+		if strings.EqualFold(key, dockerConfigLabelsKey) {
+			labelsKey = key
+		}
+	}
+
+	labels := make(map[string]string)
+	if rawLabels, ok := fields[labelsKey]; ok && string(rawLabels) != "null" {
+		if err := json.Unmarshal(rawLabels, &labels); err != nil {
+			return "", err
+		}
+	}
+	for key, value := range tags {
+		label := taskTagLabelPrefix + key
+		if _, ok := labels[label]; !ok {
+			labels[label] = value
+		}
+	}
+
+	rawLabels, err := json.Marshal(labels)
+	if err != nil {
+		return "", err
+	}
+	fields[labelsKey] = rawLabels
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,189 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	mock_api "github.com/aws/amazon-ecs-agent/agent/api/mocks"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/ecs_client/model/ecs"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const taggedTaskARN = "arn:aws:ecs:us-west-2:123456789012:task/default/tagged"
+
+func newTaggedTask(dockerConfig *string) *apitask.Task {
+	return &apitask.Task{
+		Arn: taggedTaskARN,
+		Containers: []*apicontainer.Container{
+			{
+				Name:         "c1",
+				DockerConfig: apicontainer.DockerConfig{Config: dockerConfig},
+			},
+		},
+	}
+}
+
+func containerLabels(t *testing.T, container *apicontainer.Container) map[string]string {
+	var config struct {
+		Labels map[string]string
+	}
+	require.NoError(t, json.Unmarshal([]byte(aws.StringValue(container.DockerConfig.Config)), &config))
+	return config.Labels
+}
+
+func TestTaskTagsSynchronizerUsesPayloadTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	synchronizer := newTaskTagsSynchronizer(true, ecsClient, time.Minute)
+
+	task := newTaggedTask(nil)
+	synchronizer.propagate(&ecsacs.Task{
+		Arn:  aws.String(taggedTaskARN),
+		Tags: map[string]*string{"team": aws.String("blue")},
+	}, task)
+
+	assert.Equal(t, map[string]string{"com.amazonaws.ecs.tag.team": "blue"}, containerLabels(t, task.Containers[0]))
+}
+
+func TestTaskTagsSynchronizerFetchesMissingTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	synchronizer := newTaskTagsSynchronizer(true, ecsClient, time.Minute)
+
+	ecsClient.EXPECT().GetResourceTags(taggedTaskARN).Return([]*ecs.Tag{
+		{Key: aws.String("team"), Value: aws.String("blue")},
+	}, nil)
+
+	task := newTaggedTask(nil)
+	synchronizer.propagate(&ecsacs.Task{Arn: aws.String(taggedTaskARN)}, task)
+
+	assert.Equal(t, map[string]string{"com.amazonaws.ecs.tag.team": "blue"}, containerLabels(t, task.Containers[0]))
+}
+
+func TestTaskTagsSynchronizerCachesFetchedTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	synchronizer := newTaskTagsSynchronizer(true, ecsClient, time.Minute)
+	now := time.Now()
+	synchronizer.now = func() time.Time { return now }
+
+	gomock.InOrder(
+		ecsClient.EXPECT().GetResourceTags(taggedTaskARN).Return([]*ecs.Tag{
+			{Key: aws.String("team"), Value: aws.String("blue")},
+		}, nil),
+		ecsClient.EXPECT().GetResourceTags(taggedTaskARN).Return([]*ecs.Tag{
+			{Key: aws.String("team"), Value: aws.String("red")},
+		}, nil),
+	)
+
+	acsTask := &ecsacs.Task{Arn: aws.String(taggedTaskARN)}
+	task := newTaggedTask(nil)
+	synchronizer.propagate(acsTask, task)
+	now = now.Add(30 * time.Second)
+	// The tags are served from the cache within the TTL
+	task = newTaggedTask(nil)
+	synchronizer.propagate(acsTask, task)
+	assert.Equal(t, map[string]string{"com.amazonaws.ecs.tag.team": "blue"}, containerLabels(t, task.Containers[0]))
+
+	// And fetched again once it has elapsed
+	now = now.Add(time.Minute)
+	task = newTaggedTask(nil)
+	synchronizer.propagate(acsTask, task)
+	assert.Equal(t, map[string]string{"com.amazonaws.ecs.tag.team": "red"}, containerLabels(t, task.Containers[0]))
+}
+
+func TestTaskTagsSynchronizerFetchError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	synchronizer := newTaskTagsSynchronizer(true, ecsClient, time.Minute)
+
+	now := time.Now()
+	synchronizer.now = func() time.Time { return now }
+
+	gomock.InOrder(
+		ecsClient.EXPECT().GetResourceTags(taggedTaskARN).Return(nil, errors.New("throttled")),
+		ecsClient.EXPECT().GetResourceTags(taggedTaskARN).Return([]*ecs.Tag{
+			{Key: aws.String("team"), Value: aws.String("blue")},
+		}, nil),
+	)
+
+	acsTask := &ecsacs.Task{Arn: aws.String(taggedTaskARN)}
+	task := newTaggedTask(aws.String(`{"Image":"busybox"}`))
+	synchronizer.propagate(acsTask, task)
+	assert.Equal(t, `{"Image":"busybox"}`, aws.StringValue(task.Containers[0].DockerConfig.Config))
+
+	// The failure is cached within the TTL
+	now = now.Add(30 * time.Second)
+	task = newTaggedTask(aws.String(`{"Image":"busybox"}`))
+	synchronizer.propagate(acsTask, task)
+	assert.Equal(t, `{"Image":"busybox"}`, aws.StringValue(task.Containers[0].DockerConfig.Config))
+
+	// And the tags are fetched again once it has elapsed
+	now = now.Add(time.Minute)
+	task = newTaggedTask(nil)
+	synchronizer.propagate(acsTask, task)
+	assert.Equal(t, map[string]string{"com.amazonaws.ecs.tag.team": "blue"}, containerLabels(t, task.Containers[0]))
+}
+
+func TestTaskTagsSynchronizerPreservesDockerConfig(t *testing.T) {
+	synchronizer := newTaskTagsSynchronizer(true, nil, time.Minute)
+
+	task := newTaggedTask(aws.String(
+		`{"Image":"busybox","labels":{"app":"web","com.amazonaws.ecs.tag.team":"green"}}`))
+	synchronizer.propagate(&ecsacs.Task{
+		Arn: aws.String(taggedTaskARN),
+		Tags: map[string]*string{
+			"team":  aws.String("blue"),
+			"stage": aws.String("prod"),
+		},
+	}, task)
+
+	var config map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(aws.StringValue(task.Containers[0].DockerConfig.Config)), &config))
+	assert.Equal(t, "busybox", config["Image"])
+	// Labels set by the task definition take precedence over the tags
+	assert.Equal(t, map[string]interface{}{
+		"app":                         "web",
+		"com.amazonaws.ecs.tag.team":  "green",
+		"com.amazonaws.ecs.tag.stage": "prod",
+	}, config["labels"])
+}
+
+func TestTaskTagsSynchronizerNil(t *testing.T) {
+	synchronizer := newTaskTagsSynchronizer(false, nil, time.Minute)
+	require.Nil(t, synchronizer)
+	task := newTaggedTask(nil)
+	synchronizer.propagate(&ecsacs.Task{
+		Arn:  aws.String(taggedTaskARN),
+		Tags: map[string]*string{"team": aws.String("blue")},
+	}, task)
+	assert.Nil(t, task.Containers[0].DockerConfig.Config)
+}
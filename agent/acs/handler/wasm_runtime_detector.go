@@ -0,0 +1,83 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"net/url"
+	"os/exec"
+)
+
+const (
+	wasmRuntimeURLParameterName = "wasmRuntime"
+	// runwasiRuntime is the containerd shim running WebAssembly workloads
+	runwasiRuntime = "runwasi"
+)
+
+// lookPath finds the executable in the PATH, it is overridden in unit tests
+var lookPath = exec.LookPath
+
+// WasmRuntimeDetector detects the WebAssembly runtime installed on the host
+type WasmRuntimeDetector interface {
+	// Detect returns the name of the WebAssembly runtime installed on the host,
+	// and false if there's none
+	Detect() (string, bool)
+}
+
+// pathWasmRuntimeDetector detects the WebAssembly runtimes installed in the PATH
+type pathWasmRuntimeDetector struct {
+	// runtimes are the executables of the supported runtimes, in order of preference
+	runtimes []string
+}
+
+// newPathWasmRuntimeDetector returns a WasmRuntimeDetector looking for runwasi
+// in the PATH
+func newPathWasmRuntimeDetector() WasmRuntimeDetector {
+	return &pathWasmRuntimeDetector{
+		runtimes: []string{runwasiRuntime},
+	}
+}
+
+// Detect returns the first supported runtime found in the PATH
+func (detector *pathWasmRuntimeDetector) Detect() (string, bool) {
+	for _, runtime := range detector.runtimes {
+		if _, err := lookPath(runtime); err == nil {
+			return runtime, true
+		}
+	}
+	return "", false
+}
+
+// detectWasmRuntime returns the WebAssembly runtime to advertise to ACS, empty
+// if there's none or if there's no detector, when advertising it is disabled.
+// Runtimes are detected on every connection so that a runtime installed while
+// the agent is running is picked up
+func detectWasmRuntime(detector WasmRuntimeDetector) string {
+	if detector == nil {
+		return ""
+	}
+	runtime, ok := detector.Detect()
+	if !ok {
+		return ""
+	}
+	return runtime
+}
+
+// setWasmRuntimeURLParameter sets the WebAssembly runtime URL parameter in the
+// query if a runtime was detected
+func setWasmRuntimeURLParameter(query url.Values, runtime string) {
+	if runtime == "" {
+		return
+	}
+	query.Set(wasmRuntimeURLParameterName, runtime)
+}
@@ -0,0 +1,65 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setLookPath overrides the lookup of executables in the PATH with the given
+// executables and returns a function restoring it
+func setLookPath(executables ...string) func() {
+	original := lookPath
+	lookPath = func(file string) (string, error) {
+		for _, executable := range executables {
+			if executable == file {
+				return "/usr/local/bin/" + file, nil
+			}
+		}
+		return "", errors.New("executable file not found in $PATH")
+	}
+	return func() {
+		lookPath = original
+	}
+}
+
+func TestWasmRuntimeDetectorRuntimePresent(t *testing.T) {
+	defer setLookPath("runwasi")()
+
+	runtime, ok := newPathWasmRuntimeDetector().Detect()
+	assert.True(t, ok)
+	assert.Equal(t, "runwasi", runtime)
+	assert.Equal(t, "runwasi", detectWasmRuntime(newPathWasmRuntimeDetector()))
+}
+
+func TestWasmRuntimeDetectorRuntimeAbsent(t *testing.T) {
+	defer setLookPath("runc")()
+
+	_, ok := newPathWasmRuntimeDetector().Detect()
+	assert.False(t, ok)
+	assert.Empty(t, detectWasmRuntime(newPathWasmRuntimeDetector()))
+}
+
+func TestWasmRuntimeDetectorDisabled(t *testing.T) {
+	defer setLookPath("runwasi")()
+
+	// No detector is created when advertising the runtime is disabled
+	assert.Empty(t, detectWasmRuntime(nil))
+}
@@ -22,6 +22,124 @@ import (
 	"github.com/aws/aws-sdk-go/private/protocol"
 )
 
+type ACSAuthChallengeInput struct {
+	_ struct{} `type:"structure"`
+
+	Challenge *string `locationName:"challenge" type:"string"`
+
+	ChallengeType *string `locationName:"challengeType" type:"string"`
+
+	Cluster *string `locationName:"cluster" type:"string"`
+
+	ContainerInstance *string `locationName:"containerInstance" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+}
+
+// String returns the string representation
+func (s ACSAuthChallengeInput) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ACSAuthChallengeInput) GoString() string {
+	return s.String()
+}
+
+type ACSAuthChallengeMessage struct {
+	_ struct{} `type:"structure"`
+
+	Challenge *string `locationName:"challenge" type:"string"`
+
+	ChallengeType *string `locationName:"challengeType" type:"string"`
+
+	Cluster *string `locationName:"cluster" type:"string"`
+
+	ContainerInstance *string `locationName:"containerInstance" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+}
+
+// String returns the string representation
+func (s ACSAuthChallengeMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ACSAuthChallengeMessage) GoString() string {
+	return s.String()
+}
+
+type ACSAuthChallengeOutput struct {
+	_ struct{} `type:"structure"`
+
+	Cluster *string `locationName:"cluster" type:"string"`
+
+	ContainerInstance *string `locationName:"containerInstance" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	Response *string `locationName:"response" type:"string"`
+}
+
+// String returns the string representation
+func (s ACSAuthChallengeOutput) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ACSAuthChallengeOutput) GoString() string {
+	return s.String()
+}
+
+type ACSAuthChallengeResponseMessage struct {
+	_ struct{} `type:"structure"`
+
+	Cluster *string `locationName:"cluster" type:"string"`
+
+	ContainerInstance *string `locationName:"containerInstance" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	Response *string `locationName:"response" type:"string"`
+}
+
+// String returns the string representation
+func (s ACSAuthChallengeResponseMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ACSAuthChallengeResponseMessage) GoString() string {
+	return s.String()
+}
+
+type ACSOperatorAlertMessage struct {
+	_ struct{} `type:"structure"`
+
+	Body *string `locationName:"body" type:"string"`
+
+	Cluster *string `locationName:"cluster" type:"string"`
+
+	ContainerInstance *string `locationName:"containerInstance" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	Severity *string `locationName:"severity" type:"string"`
+
+	Title *string `locationName:"title" type:"string"`
+}
+
+// String returns the string representation
+func (s ACSOperatorAlertMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ACSOperatorAlertMessage) GoString() string {
+	return s.String()
+}
+
 type ASMAuthData struct {
 	_ struct{} `type:"structure"`
 
@@ -95,6 +213,28 @@ func (s *AccessDeniedException) RequestID() string {
 	return s.RespMetadata.RequestID
 }
 
+type AckEchoMessage struct {
+	_ struct{} `type:"structure"`
+
+	Cluster *string `locationName:"cluster" type:"string"`
+
+	ContainerInstance *string `locationName:"containerInstance" type:"string"`
+
+	CorrelationId *string `locationName:"correlationId" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+}
+
+// String returns the string representation
+func (s AckEchoMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s AckEchoMessage) GoString() string {
+	return s.String()
+}
+
 type AckRequest struct {
 	_ struct{} `type:"structure"`
 
@@ -102,6 +242,10 @@ type AckRequest struct {
 
 	ContainerInstance *string `locationName:"containerInstance" type:"string"`
 
+	CorrelationId *string `locationName:"correlationId" type:"string"`
+
+	HeartbeatAck *HeartbeatAckRequest `locationName:"heartbeatAck" type:"structure"`
+
 	MessageId *string `locationName:"messageId" type:"string"`
 }
 
@@ -115,6 +259,80 @@ func (s AckRequest) GoString() string {
 	return s.String()
 }
 
+type AgentCrashReportInput struct {
+	_ struct{} `type:"structure"`
+
+	AgentVersion *string `locationName:"agentVersion" type:"string"`
+
+	Cluster *string `locationName:"cluster" type:"string"`
+
+	ContainerInstance *string `locationName:"containerInstance" type:"string"`
+
+	CrashedAt *int64 `locationName:"crashedAt" type:"long"`
+
+	ExitCode *int64 `locationName:"exitCode" type:"integer"`
+
+	GoroutineDumpPath *string `locationName:"goroutineDumpPath" type:"string"`
+
+	LastError *string `locationName:"lastError" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+}
+
+// String returns the string representation
+func (s AgentCrashReportInput) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s AgentCrashReportInput) GoString() string {
+	return s.String()
+}
+
+type AgentCrashReportMessage struct {
+	_ struct{} `type:"structure"`
+
+	AgentVersion *string `locationName:"agentVersion" type:"string"`
+
+	Cluster *string `locationName:"cluster" type:"string"`
+
+	ContainerInstance *string `locationName:"containerInstance" type:"string"`
+
+	CrashedAt *int64 `locationName:"crashedAt" type:"long"`
+
+	ExitCode *int64 `locationName:"exitCode" type:"integer"`
+
+	GoroutineDumpPath *string `locationName:"goroutineDumpPath" type:"string"`
+
+	LastError *string `locationName:"lastError" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+}
+
+// String returns the string representation
+func (s AgentCrashReportMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s AgentCrashReportMessage) GoString() string {
+	return s.String()
+}
+
+type AgentCrashReportOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+// String returns the string representation
+func (s AgentCrashReportOutput) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s AgentCrashReportOutput) GoString() string {
+	return s.String()
+}
+
 type Association struct {
 	_ struct{} `type:"structure"`
 
@@ -196,6 +414,8 @@ type AttachInstanceNetworkInterfacesOutput struct {
 
 	ContainerInstance *string `locationName:"containerInstance" type:"string"`
 
+	HeartbeatAck *HeartbeatAckRequest `locationName:"heartbeatAck" type:"structure"`
+
 	MessageId *string `locationName:"messageId" type:"string"`
 }
 
@@ -272,6 +492,8 @@ type AttachTaskNetworkInterfacesOutput struct {
 
 	ContainerInstance *string `locationName:"containerInstance" type:"string"`
 
+	HeartbeatAck *HeartbeatAckRequest `locationName:"heartbeatAck" type:"structure"`
+
 	MessageId *string `locationName:"messageId" type:"string"`
 }
 
@@ -285,6 +507,62 @@ func (s AttachTaskNetworkInterfacesOutput) GoString() string {
 	return s.String()
 }
 
+type Attachment struct {
+	_ struct{} `type:"structure"`
+
+	AttachmentArn *string `locationName:"attachmentArn" type:"string"`
+
+	AttachmentProperties []*AttachmentProperty `locationName:"attachmentProperties" type:"list"`
+
+	AttachmentType *string `locationName:"attachmentType" type:"string"`
+}
+
+// String returns the string representation
+func (s Attachment) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s Attachment) GoString() string {
+	return s.String()
+}
+
+type AttachmentProperty struct {
+	_ struct{} `type:"structure"`
+
+	Name *string `locationName:"name" type:"string"`
+
+	Value *string `locationName:"value" type:"string"`
+}
+
+// String returns the string representation
+func (s AttachmentProperty) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s AttachmentProperty) GoString() string {
+	return s.String()
+}
+
+type Attribute struct {
+	_ struct{} `type:"structure"`
+
+	Name *string `locationName:"name" type:"string"`
+
+	Value *string `locationName:"value" type:"string"`
+}
+
+// String returns the string representation
+func (s Attribute) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s Attribute) GoString() string {
+	return s.String()
+}
+
 type BadRequestException struct {
 	_            struct{}                  `type:"structure"`
 	RespMetadata protocol.ResponseMetadata `json:"-" xml:"-"`
@@ -356,6 +634,34 @@ func (s CloseMessage) GoString() string {
 	return s.String()
 }
 
+type ConfirmAttachmentMessage struct {
+	_ struct{} `type:"structure"`
+
+	Attachment *Attachment `locationName:"attachment" type:"structure"`
+
+	ClusterArn *string `locationName:"clusterArn" type:"string"`
+
+	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
+
+	GeneratedAt *int64 `locationName:"generatedAt" type:"long"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	TaskArn *string `locationName:"taskArn" type:"string"`
+
+	WaitTimeoutMs *int64 `locationName:"waitTimeoutMs" type:"long"`
+}
+
+// String returns the string representation
+func (s ConfirmAttachmentMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ConfirmAttachmentMessage) GoString() string {
+	return s.String()
+}
+
 type Container struct {
 	_ struct{} `type:"structure"`
 
@@ -393,48 +699,140 @@ type Container struct {
 
 	MountPoints []*MountPoint `locationName:"mountPoints" type:"list"`
 
-	Name *string `locationName:"name" type:"string"`
+	Name *string `locationName:"name" type:"string"`
+
+	Overrides *string `locationName:"overrides" type:"string"`
+
+	PortMappings []*PortMapping `locationName:"portMappings" type:"list"`
+
+	RegistryAuthentication *RegistryAuthenticationData `locationName:"registryAuthentication" type:"structure"`
+
+	Secrets []*Secret `locationName:"secrets" type:"list"`
+
+	StartTimeout *int64 `locationName:"startTimeout" type:"integer"`
+
+	StopTimeout *int64 `locationName:"stopTimeout" type:"integer"`
+
+	VolumesFrom []*VolumeFrom `locationName:"volumesFrom" type:"list"`
+}
+
+// String returns the string representation
+func (s Container) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s Container) GoString() string {
+	return s.String()
+}
+
+type ContainerDependency struct {
+	_ struct{} `type:"structure"`
+
+	Condition *string `locationName:"condition" type:"string" enum:"ContainerCondition"`
+
+	ContainerName *string `locationName:"containerName" type:"string"`
+}
+
+// String returns the string representation
+func (s ContainerDependency) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ContainerDependency) GoString() string {
+	return s.String()
+}
+
+type ContainerInstanceStateReport struct {
+	_ struct{} `type:"structure"`
+
+	ClusterArn *string `locationName:"clusterArn" type:"string"`
+
+	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
+
+	GeneratedAt *int64 `locationName:"generatedAt" type:"long"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	Tasks []*TaskStateReport `locationName:"tasks" type:"list"`
+}
+
+// String returns the string representation
+func (s ContainerInstanceStateReport) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ContainerInstanceStateReport) GoString() string {
+	return s.String()
+}
+
+type ContainerInstanceStatusMessage struct {
+	_ struct{} `type:"structure"`
+
+	ClusterArn *string `locationName:"clusterArn" type:"string"`
+
+	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	Status *string `locationName:"status" type:"string"`
+}
+
+// String returns the string representation
+func (s ContainerInstanceStatusMessage) String() string {
+	return awsutil.Prettify(s)
+}
 
-	Overrides *string `locationName:"overrides" type:"string"`
+// GoString returns the string representation
+func (s ContainerInstanceStatusMessage) GoString() string {
+	return s.String()
+}
 
-	PortMappings []*PortMapping `locationName:"portMappings" type:"list"`
+type ContainerStateReport struct {
+	_ struct{} `type:"structure"`
 
-	RegistryAuthentication *RegistryAuthenticationData `locationName:"registryAuthentication" type:"structure"`
+	DesiredStatus *string `locationName:"desiredStatus" type:"string"`
 
-	Secrets []*Secret `locationName:"secrets" type:"list"`
+	ExitCode *int64 `locationName:"exitCode" type:"integer"`
 
-	StartTimeout *int64 `locationName:"startTimeout" type:"integer"`
+	KnownStatus *string `locationName:"knownStatus" type:"string"`
 
-	StopTimeout *int64 `locationName:"stopTimeout" type:"integer"`
+	Name *string `locationName:"name" type:"string"`
 
-	VolumesFrom []*VolumeFrom `locationName:"volumesFrom" type:"list"`
+	RuntimeId *string `locationName:"runtimeId" type:"string"`
 }
 
 // String returns the string representation
-func (s Container) String() string {
+func (s ContainerStateReport) String() string {
 	return awsutil.Prettify(s)
 }
 
 // GoString returns the string representation
-func (s Container) GoString() string {
+func (s ContainerStateReport) GoString() string {
 	return s.String()
 }
 
-type ContainerDependency struct {
+type DiagnosticBundleRequest struct {
 	_ struct{} `type:"structure"`
 
-	Condition *string `locationName:"condition" type:"string" enum:"ContainerCondition"`
+	ClusterArn *string `locationName:"clusterArn" type:"string"`
 
-	ContainerName *string `locationName:"containerName" type:"string"`
+	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	UploadUrl *string `locationName:"uploadUrl" type:"string" sensitive:"true"`
 }
 
 // String returns the string representation
-func (s ContainerDependency) String() string {
+func (s DiagnosticBundleRequest) String() string {
 	return awsutil.Prettify(s)
 }
 
 // GoString returns the string representation
-func (s ContainerDependency) GoString() string {
+func (s DiagnosticBundleRequest) GoString() string {
 	return s.String()
 }
 
@@ -546,6 +944,32 @@ func (s EFSVolumeConfiguration) GoString() string {
 	return s.String()
 }
 
+type ENIAttachmentStateReport struct {
+	_ struct{} `type:"structure"`
+
+	AttachSent *bool `locationName:"attachSent" type:"boolean"`
+
+	AttachmentArn *string `locationName:"attachmentArn" type:"string"`
+
+	AttachmentType *string `locationName:"attachmentType" type:"string"`
+
+	MacAddress *string `locationName:"macAddress" type:"string"`
+
+	Status *string `locationName:"status" type:"string"`
+
+	TaskArn *string `locationName:"taskArn" type:"string"`
+}
+
+// String returns the string representation
+func (s ENIAttachmentStateReport) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ENIAttachmentStateReport) GoString() string {
+	return s.String()
+}
+
 type ElasticNetworkInterface struct {
 	_ struct{} `type:"structure"`
 
@@ -720,9 +1144,63 @@ func (s FirelensConfiguration) GoString() string {
 	return s.String()
 }
 
+type GetInstanceStateRequestMessage struct {
+	_ struct{} `type:"structure"`
+
+	ClusterArn *string `locationName:"clusterArn" type:"string"`
+
+	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+}
+
+// String returns the string representation
+func (s GetInstanceStateRequestMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s GetInstanceStateRequestMessage) GoString() string {
+	return s.String()
+}
+
+type GetInstanceStateResponseMessage struct {
+	_ struct{} `type:"structure"`
+
+	ClusterArn *string `locationName:"clusterArn" type:"string"`
+
+	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
+
+	EniAttachments []*ENIAttachmentStateReport `locationName:"eniAttachments" type:"list"`
+
+	GeneratedAt *int64 `locationName:"generatedAt" type:"long"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	Tasks []*TaskStateReport `locationName:"tasks" type:"list"`
+}
+
+// String returns the string representation
+func (s GetInstanceStateResponseMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s GetInstanceStateResponseMessage) GoString() string {
+	return s.String()
+}
+
 type HeartbeatAckRequest struct {
 	_ struct{} `type:"structure"`
 
+	AvailableCpu *int64 `locationName:"availableCpu" type:"long"`
+
+	AvailableMemoryMiB *int64 `locationName:"availableMemoryMiB" type:"long"`
+
+	HostCpuPercent *float64 `locationName:"hostCpuPercent" type:"double"`
+
+	HostMemoryUsedMiB *int64 `locationName:"hostMemoryUsedMiB" type:"long"`
+
 	MessageId *string `locationName:"messageId" type:"string"`
 }
 
@@ -775,6 +1253,14 @@ func (s HeartbeatMessage) GoString() string {
 type HeartbeatOutput struct {
 	_ struct{} `type:"structure"`
 
+	AvailableCpu *int64 `locationName:"availableCpu" type:"long"`
+
+	AvailableMemoryMiB *int64 `locationName:"availableMemoryMiB" type:"long"`
+
+	HostCpuPercent *float64 `locationName:"hostCpuPercent" type:"double"`
+
+	HostMemoryUsedMiB *int64 `locationName:"hostMemoryUsedMiB" type:"long"`
+
 	MessageId *string `locationName:"messageId" type:"string"`
 }
 
@@ -1089,6 +1575,32 @@ func (s ManagedAgent) GoString() string {
 	return s.String()
 }
 
+type ManagedAgentUpdateMessage struct {
+	_ struct{} `type:"structure"`
+
+	ClusterArn *string `locationName:"clusterArn" type:"string"`
+
+	ConfigBlob *string `locationName:"configBlob" type:"string" sensitive:"true"`
+
+	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
+
+	ManagedAgentType *string `locationName:"managedAgentType" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	TaskArn *string `locationName:"taskArn" type:"string"`
+}
+
+// String returns the string representation
+func (s ManagedAgentUpdateMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ManagedAgentUpdateMessage) GoString() string {
+	return s.String()
+}
+
 type MountPoint struct {
 	_ struct{} `type:"structure"`
 
@@ -1154,12 +1666,18 @@ type PayloadInput struct {
 
 	ClusterArn *string `locationName:"clusterArn" type:"string"`
 
+	CompatibleSchemaVersion *int64 `locationName:"compatibleSchemaVersion" type:"integer"`
+
 	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
 
 	GeneratedAt *int64 `locationName:"generatedAt" type:"long"`
 
 	MessageId *string `locationName:"messageId" type:"string"`
 
+	SchemaVersion *int64 `locationName:"schemaVersion" type:"integer"`
+
+	SentAt *int64 `locationName:"sentAt" type:"long"`
+
 	SeqNum *int64 `locationName:"seqNum" type:"integer"`
 
 	Tasks []*Task `locationName:"tasks" type:"list"`
@@ -1180,12 +1698,18 @@ type PayloadMessage struct {
 
 	ClusterArn *string `locationName:"clusterArn" type:"string"`
 
+	CompatibleSchemaVersion *int64 `locationName:"compatibleSchemaVersion" type:"integer"`
+
 	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
 
 	GeneratedAt *int64 `locationName:"generatedAt" type:"long"`
 
 	MessageId *string `locationName:"messageId" type:"string"`
 
+	SchemaVersion *int64 `locationName:"schemaVersion" type:"integer"`
+
+	SentAt *int64 `locationName:"sentAt" type:"long"`
+
 	SeqNum *int64 `locationName:"seqNum" type:"integer"`
 
 	Tasks []*Task `locationName:"tasks" type:"list"`
@@ -1208,6 +1732,8 @@ type PayloadOutput struct {
 
 	ContainerInstance *string `locationName:"containerInstance" type:"string"`
 
+	HeartbeatAck *HeartbeatAckRequest `locationName:"heartbeatAck" type:"structure"`
+
 	MessageId *string `locationName:"messageId" type:"string"`
 }
 
@@ -1272,6 +1798,8 @@ type PerformUpdateOutput struct {
 
 	ContainerInstance *string `locationName:"containerInstance" type:"string"`
 
+	HeartbeatAck *HeartbeatAckRequest `locationName:"heartbeatAck" type:"structure"`
+
 	MessageId *string `locationName:"messageId" type:"string"`
 }
 
@@ -1369,6 +1897,61 @@ func (s PortMapping) GoString() string {
 	return s.String()
 }
 
+type ProtocolVersionUnsupportedException struct {
+	_            struct{}                  `type:"structure"`
+	RespMetadata protocol.ResponseMetadata `json:"-" xml:"-"`
+
+	Message_ *string `locationName:"message" type:"string"`
+}
+
+// String returns the string representation
+func (s ProtocolVersionUnsupportedException) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s ProtocolVersionUnsupportedException) GoString() string {
+	return s.String()
+}
+
+func newErrorProtocolVersionUnsupportedException(v protocol.ResponseMetadata) error {
+	return &ProtocolVersionUnsupportedException{
+		RespMetadata: v,
+	}
+}
+
+// Code returns the exception type name.
+func (s *ProtocolVersionUnsupportedException) Code() string {
+	return "ProtocolVersionUnsupportedException"
+}
+
+// Message returns the exception's message.
+func (s *ProtocolVersionUnsupportedException) Message() string {
+	if s.Message_ != nil {
+		return *s.Message_
+	}
+	return ""
+}
+
+// OrigErr always returns nil, satisfies awserr.Error interface.
+func (s *ProtocolVersionUnsupportedException) OrigErr() error {
+	return nil
+}
+
+func (s *ProtocolVersionUnsupportedException) Error() string {
+	return fmt.Sprintf("%s: %s", s.Code(), s.Message())
+}
+
+// Status code returns the HTTP status code for the request's response error.
+func (s *ProtocolVersionUnsupportedException) StatusCode() int {
+	return s.RespMetadata.StatusCode
+}
+
+// RequestID returns the service's response RequestID for request.
+func (s *ProtocolVersionUnsupportedException) RequestID() string {
+	return s.RespMetadata.RequestID
+}
+
 type ProxyConfiguration struct {
 	_ struct{} `type:"structure"`
 
@@ -1585,6 +2168,8 @@ type StageUpdateOutput struct {
 
 	ContainerInstance *string `locationName:"containerInstance" type:"string"`
 
+	HeartbeatAck *HeartbeatAckRequest `locationName:"heartbeatAck" type:"structure"`
+
 	MessageId *string `locationName:"messageId" type:"string"`
 }
 
@@ -1617,6 +2202,8 @@ type Task struct {
 
 	Family *string `locationName:"family" type:"string"`
 
+	Group *string `locationName:"group" type:"string"`
+
 	IpcMode *string `locationName:"ipcMode" type:"string"`
 
 	LaunchType *string `locationName:"launchType" type:"string"`
@@ -1631,6 +2218,8 @@ type Task struct {
 
 	RoleCredentials *IAMRoleCredentials `locationName:"roleCredentials" type:"structure"`
 
+	Tags map[string]*string `locationName:"tags" type:"map"`
+
 	TaskDefinitionAccountId *string `locationName:"taskDefinitionAccountId" type:"string"`
 
 	Version *string `locationName:"version" type:"string"`
@@ -1648,11 +2237,71 @@ func (s Task) GoString() string {
 	return s.String()
 }
 
+type TaskDrainMessage struct {
+	_ struct{} `type:"structure"`
+
+	ClusterArn *string `locationName:"clusterArn" type:"string"`
+
+	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
+
+	DrainTimeoutSeconds *int64 `locationName:"drainTimeoutSeconds" type:"long"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	Tasks []*TaskIdentifier `locationName:"tasks" type:"list"`
+}
+
+// String returns the string representation
+func (s TaskDrainMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s TaskDrainMessage) GoString() string {
+	return s.String()
+}
+
+type TaskEngineEventMessage struct {
+	_ struct{} `type:"structure"`
+
+	ClusterArn *string `locationName:"clusterArn" type:"string"`
+
+	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
+
+	ContainerName *string `locationName:"containerName" type:"string"`
+
+	EventType *string `locationName:"eventType" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+
+	Reason *string `locationName:"reason" type:"string"`
+
+	TaskArn *string `locationName:"taskArn" type:"string"`
+
+	Timestamp *int64 `locationName:"timestamp" type:"long"`
+}
+
+// String returns the string representation
+func (s TaskEngineEventMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s TaskEngineEventMessage) GoString() string {
+	return s.String()
+}
+
 type TaskIdentifier struct {
 	_ struct{} `type:"structure"`
 
 	DesiredStatus *string `locationName:"desiredStatus" type:"string"`
 
+	ExecutionRoleArn *string `locationName:"executionRoleArn" type:"string"`
+
+	Images []*string `locationName:"images" type:"list"`
+
+	Secrets []*Secret `locationName:"secrets" type:"list"`
+
 	TaskArn *string `locationName:"taskArn" type:"string"`
 
 	TaskClusterArn *string `locationName:"taskClusterArn" type:"string"`
@@ -1677,6 +2326,8 @@ type TaskManifestMessage struct {
 
 	GeneratedAt *int64 `locationName:"generatedAt" type:"long"`
 
+	ManifestSignature *string `locationName:"manifestSignature" type:"string"`
+
 	MessageId *string `locationName:"messageId" type:"string"`
 
 	Tasks []*TaskIdentifier `locationName:"tasks" type:"list"`
@@ -1694,6 +2345,28 @@ func (s TaskManifestMessage) GoString() string {
 	return s.String()
 }
 
+type TaskStateReport struct {
+	_ struct{} `type:"structure"`
+
+	Containers []*ContainerStateReport `locationName:"containers" type:"list"`
+
+	DesiredStatus *string `locationName:"desiredStatus" type:"string"`
+
+	KnownStatus *string `locationName:"knownStatus" type:"string"`
+
+	TaskArn *string `locationName:"taskArn" type:"string"`
+}
+
+// String returns the string representation
+func (s TaskStateReport) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s TaskStateReport) GoString() string {
+	return s.String()
+}
+
 type TaskStopVerificationAck struct {
 	_ struct{} `type:"structure"`
 
@@ -1732,6 +2405,28 @@ func (s TaskStopVerificationMessage) GoString() string {
 	return s.String()
 }
 
+type UpdateAttributesMessage struct {
+	_ struct{} `type:"structure"`
+
+	Attributes []*Attribute `locationName:"attributes" type:"list"`
+
+	ClusterArn *string `locationName:"clusterArn" type:"string"`
+
+	ContainerInstanceArn *string `locationName:"containerInstanceArn" type:"string"`
+
+	MessageId *string `locationName:"messageId" type:"string"`
+}
+
+// String returns the string representation
+func (s UpdateAttributesMessage) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s UpdateAttributesMessage) GoString() string {
+	return s.String()
+}
+
 type UpdateFailureInput struct {
 	_ struct{} `type:"structure"`
 
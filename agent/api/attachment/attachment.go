@@ -0,0 +1,52 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package attachment
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// EBSVolumeAttachmentType represents the type of an EBS volume attachment
+	EBSVolumeAttachmentType = "amazonebs"
+
+	// VolumeIDKey is the attachment property holding the id of an EBS volume
+	VolumeIDKey = "volumeId"
+	// DeviceNameKey is the attachment property holding the device name of an EBS volume
+	DeviceNameKey = "deviceName"
+)
+
+// ResourceAttachment contains the information of the attachment of a resource,
+// other than an ENI, to a task
+type ResourceAttachment struct {
+	// AttachmentType is the type of the attachment, such as "amazonebs"
+	AttachmentType string `json:"attachmentType"`
+	// TaskARN is the task identifier from ecs
+	TaskARN string `json:"taskArn"`
+	// AttachmentARN is the identifier for the attachment
+	AttachmentARN string `json:"attachmentArn"`
+	// AttachmentProperties are the properties of the attached resource, such as
+	// the id of an EBS volume
+	AttachmentProperties map[string]string `json:"attachmentProperties"`
+	// ExpiresAt is the timestamp past which the attachment is considered unsuccessful
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// String returns a string representation of the resource attachment
+func (attachment *ResourceAttachment) String() string {
+	return fmt.Sprintf("Resource Attachment: attachment=%s;type=%s;task=%s;expiresAt=%s",
+		attachment.AttachmentARN, attachment.AttachmentType, attachment.TaskARN,
+		attachment.ExpiresAt.UTC().Format(time.RFC3339))
+}
@@ -1000,6 +1000,22 @@ func (c *Container) MergeEnvironmentVariables(envVars map[string]string) {
 	}
 }
 
+// MergeMissingEnvironmentVariables appends the envVarName:envVarValue pairs whose
+// names aren't set yet to the container's environment values structure
+func (c *Container) MergeMissingEnvironmentVariables(envVars map[string]string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.Environment == nil {
+		c.Environment = make(map[string]string)
+	}
+	for k, v := range envVars {
+		if _, ok := c.Environment[k]; !ok {
+			c.Environment[k] = v
+		}
+	}
+}
+
 // MergeEnvironmentVariablesFromEnvfiles appends environment variable pairs from
 // the retrieved envfiles to the container's environment values list
 // envvars from envfiles will have lower precedence than existing envvars
@@ -735,6 +735,16 @@ func TestShouldCreateWithEnvfiles(t *testing.T) {
 	}
 }
 
+func TestMergeMissingEnvironmentVariables(t *testing.T) {
+	container := &Container{}
+	container.MergeMissingEnvironmentVariables(map[string]string{"key1": "value1"})
+	assert.Equal(t, map[string]string{"key1": "value1"}, container.Environment)
+
+	container.MergeMissingEnvironmentVariables(map[string]string{"key1": "other", "key2": "value2"})
+	assert.Equal(t, map[string]string{"key1": "value1", "key2": "value2"}, container.Environment,
+		"the existing environment variables should be kept")
+}
+
 func TestMergeEnvironmentVariablesFromEnvfiles(t *testing.T) {
 	cases := []struct {
 		Name                   string
@@ -572,6 +572,20 @@ func (client *APIECSClient) DiscoverPollEndpoint(containerInstanceArn string) (s
 	return aws.StringValue(resp.Endpoint), nil
 }
 
+// ForceDiscoverPollEndpoint invokes the DiscoverPollEndpoint API regardless of the
+// cached endpoint, which may not have expired yet. It's used when the cached
+// endpoint keeps failing, to give ECS the opportunity to hand out a different one
+func (client *APIECSClient) ForceDiscoverPollEndpoint(containerInstanceArn string) (string, error) {
+	// Fall back to the cached endpoint, whether it has expired or not, if the API call fails
+	cachedEndpoint, _, _ := client.pollEndpointCache.Get(containerInstanceArn)
+	resp, err := client.invokeDiscoverPollEndpoint(containerInstanceArn, cachedEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.StringValue(resp.Endpoint), nil
+}
+
 func (client *APIECSClient) DiscoverTelemetryEndpoint(containerInstanceArn string) (string, error) {
 	resp, err := client.discoverPollEndpoint(containerInstanceArn)
 	if err != nil {
@@ -600,25 +614,34 @@ func (client *APIECSClient) discoverPollEndpoint(containerInstanceArn string) (*
 	}
 
 	// Cache miss or expired, invoke the ECS DiscoverPollEndpoint API.
+	// If we got an error calling the API, fallback to an expired cached endpoint if
+	// we have it.
+	var fallback interface{}
+	if expired {
+		fallback = cachedEndpoint
+	}
+	return client.invokeDiscoverPollEndpoint(containerInstanceArn, fallback)
+}
+
+// invokeDiscoverPollEndpoint invokes the ECS DiscoverPollEndpoint API and caches
+// its response. The fallback endpoint, if any, is returned when the API call fails
+func (client *APIECSClient) invokeDiscoverPollEndpoint(containerInstanceArn string,
+	fallback interface{}) (*ecs.DiscoverPollEndpointOutput, error) {
 	seelog.Debugf("Invoking DiscoverPollEndpoint for '%s'", containerInstanceArn)
 	output, err := client.standardClient.DiscoverPollEndpoint(&ecs.DiscoverPollEndpointInput{
 		ContainerInstance: &containerInstanceArn,
 		Cluster:           &client.config.Cluster,
 	})
 	if err != nil {
-		// if we got an error calling the API, fallback to an expired cached endpoint if
-		// we have it.
-		if expired {
-			if output, ok := cachedEndpoint.(*ecs.DiscoverPollEndpointOutput); ok {
-				logger.Info("Error calling DiscoverPollEndpoint. Using cached-but-expired endpoint as a fallback.", logger.Fields{
-					"endpoint":             aws.StringValue(output.Endpoint),
-					"telemetryEndpoint":    aws.StringValue(output.TelemetryEndpoint),
-					"containerInstanceARN": containerInstanceArn,
-				})
-				return output, nil
-			}
+		if output, ok := fallback.(*ecs.DiscoverPollEndpointOutput); ok {
+			logger.Info("Error calling DiscoverPollEndpoint. Using cached endpoint as a fallback.", logger.Fields{
+				"endpoint":             aws.StringValue(output.Endpoint),
+				"telemetryEndpoint":    aws.StringValue(output.TelemetryEndpoint),
+				"containerInstanceARN": containerInstanceArn,
+			})
+			return output, nil
 		}
-		return nil, err
+		return nil, wrapRequestFailure(err)
 	}
 
 	// Cache the response from ECS.
@@ -645,3 +668,21 @@ func (client *APIECSClient) UpdateContainerInstancesState(instanceARN string, st
 	})
 	return err
 }
+
+func (client *APIECSClient) UpdateContainerInstanceAttributes(instanceARN string, attributes []*ecs.Attribute) error {
+	seelog.Debugf("Invoking PutAttributes, %d attributes, instanceARN='%s'", len(attributes), instanceARN)
+	targetAttributes := make([]*ecs.Attribute, 0, len(attributes))
+	for _, attribute := range attributes {
+		targetAttributes = append(targetAttributes, &ecs.Attribute{
+			Name:       attribute.Name,
+			Value:      attribute.Value,
+			TargetId:   aws.String(instanceARN),
+			TargetType: aws.String(ecs.TargetTypeContainerInstance),
+		})
+	}
+	_, err := client.standardClient.PutAttributes(&ecs.PutAttributesInput{
+		Attributes: targetAttributes,
+		Cluster:    &client.config.Cluster,
+	})
+	return err
+}
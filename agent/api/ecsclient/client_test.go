@@ -32,6 +32,7 @@ import (
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
 	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
 	apieni "github.com/aws/amazon-ecs-agent/agent/api/eni"
+	apierrors "github.com/aws/amazon-ecs-agent/agent/api/errors"
 	mock_api "github.com/aws/amazon-ecs-agent/agent/api/mocks"
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
 	"github.com/aws/amazon-ecs-agent/agent/async"
@@ -758,6 +759,31 @@ func TestDiscoverTelemetryEndpointError(t *testing.T) {
 	}
 }
 
+func TestDiscoverPollEndpointRetryableErrors(t *testing.T) {
+	testCases := []struct {
+		name              string
+		err               error
+		expectedRetryable bool
+	}{
+		{"not found", awserr.NewRequestFailure(awserr.New("NotFound", "", nil), 404, ""), false},
+		{"server error", awserr.NewRequestFailure(awserr.New("ServerException", "", nil), 500, ""), true},
+		{"throttled", awserr.NewRequestFailure(awserr.New("ThrottlingException", "", nil), 429, ""), true},
+		{"not a request failure", errors.New("connection reset"), true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+			client, mc, _ := NewMockClient(mockCtrl, ec2.NewBlackholeEC2MetadataClient(), nil)
+			mc.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(nil, tc.err)
+			_, err := client.DiscoverPollEndpoint("containerInstance")
+			require.Error(t, err)
+			assert.Equal(t, tc.expectedRetryable, apierrors.IsRetryable(err))
+			assert.Equal(t, tc.err.Error(), err.Error())
+		})
+	}
+}
+
 func TestDiscoverNilTelemetryEndpoint(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -804,6 +830,43 @@ func TestUpdateContainerInstancesStateError(t *testing.T) {
 	assert.Error(t, err, "Expected an error calling UpdateContainerInstancesState but got nil")
 }
 
+func TestUpdateContainerInstanceAttributes(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client, mc, _ := NewMockClient(mockCtrl, ec2.NewBlackholeEC2MetadataClient(), nil)
+
+	instanceARN := "myInstanceARN"
+	mc.EXPECT().PutAttributes(&ecs.PutAttributesInput{
+		Attributes: []*ecs.Attribute{
+			{
+				Name:       aws.String("software"),
+				Value:      aws.String("installed"),
+				TargetId:   aws.String(instanceARN),
+				TargetType: aws.String("container-instance"),
+			},
+		},
+		Cluster: aws.String(configuredCluster),
+	}).Return(&ecs.PutAttributesOutput{}, nil)
+
+	err := client.UpdateContainerInstanceAttributes(instanceARN, []*ecs.Attribute{
+		{Name: aws.String("software"), Value: aws.String("installed")},
+	})
+	assert.NoError(t, err)
+}
+
+func TestUpdateContainerInstanceAttributesError(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client, mc, _ := NewMockClient(mockCtrl, ec2.NewBlackholeEC2MetadataClient(), nil)
+
+	mc.EXPECT().PutAttributes(gomock.Any()).Return(nil, fmt.Errorf("ERROR"))
+
+	err := client.UpdateContainerInstanceAttributes("myInstanceARN", []*ecs.Attribute{
+		{Name: aws.String("software")},
+	})
+	assert.Error(t, err)
+}
+
 func TestGetResourceTags(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -936,6 +999,75 @@ func TestDiscoverPollEndpointExpiredButDPEFailed(t *testing.T) {
 	}
 }
 
+func TestForceDiscoverPollEndpointBypassesCache(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockSDK := mock_api.NewMockECSSDK(mockCtrl)
+	pollEndpointCache := async.NewTTLCache(10 * time.Minute)
+	client := &APIECSClient{
+		credentialProvider: credentials.AnonymousCredentials,
+		config: &config.Config{
+			Cluster:   configuredCluster,
+			AWSRegion: "us-east-1",
+		},
+		standardClient:    mockSDK,
+		ec2metadata:       ec2.NewBlackholeEC2MetadataClient(),
+		pollEndpointCache: pollEndpointCache,
+	}
+
+	staleEndpoint := "http://127.0.0.1"
+	freshEndpoint := "http://127.0.0.2"
+	gomock.InOrder(
+		mockSDK.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(
+			&ecs.DiscoverPollEndpointOutput{Endpoint: aws.String(staleEndpoint)}, nil),
+		mockSDK.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(
+			&ecs.DiscoverPollEndpointOutput{Endpoint: aws.String(freshEndpoint)}, nil),
+	)
+	endpoint, err := client.DiscoverPollEndpoint("containerInstance")
+	require.NoError(t, err)
+	assert.Equal(t, staleEndpoint, endpoint)
+
+	endpoint, err = client.ForceDiscoverPollEndpoint("containerInstance")
+	require.NoError(t, err)
+	assert.Equal(t, freshEndpoint, endpoint)
+
+	// The fresh endpoint replaces the cached one
+	endpoint, err = client.DiscoverPollEndpoint("containerInstance")
+	require.NoError(t, err)
+	assert.Equal(t, freshEndpoint, endpoint)
+}
+
+func TestForceDiscoverPollEndpointFallsBackToCachedEndpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockSDK := mock_api.NewMockECSSDK(mockCtrl)
+	pollEndpointCache := async.NewTTLCache(10 * time.Minute)
+	client := &APIECSClient{
+		credentialProvider: credentials.AnonymousCredentials,
+		config: &config.Config{
+			Cluster:   configuredCluster,
+			AWSRegion: "us-east-1",
+		},
+		standardClient:    mockSDK,
+		ec2metadata:       ec2.NewBlackholeEC2MetadataClient(),
+		pollEndpointCache: pollEndpointCache,
+	}
+
+	// Without a cached endpoint, the error is returned
+	mockSDK.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(nil, fmt.Errorf("error!"))
+	_, err := client.ForceDiscoverPollEndpoint("containerInstance")
+	assert.Error(t, err)
+
+	pollEndpoint := "http://127.0.0.1"
+	pollEndpointCache.Set("containerInstance", &ecs.DiscoverPollEndpointOutput{Endpoint: aws.String(pollEndpoint)})
+	mockSDK.EXPECT().DiscoverPollEndpoint(gomock.Any()).Return(nil, fmt.Errorf("error!"))
+	endpoint, err := client.ForceDiscoverPollEndpoint("containerInstance")
+	require.NoError(t, err)
+	assert.Equal(t, pollEndpoint, endpoint)
+}
+
 func TestDiscoverTelemetryEndpointAfterPollEndpointCacheHit(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -0,0 +1,42 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ecsclient
+
+import (
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// requestFailure wraps a failed ECS API request. It implements
+// apierrors.Retriable, while retaining the awserr.RequestFailure methods
+// of the wrapped error so that callers can keep inspecting it
+type requestFailure struct {
+	awserr.RequestFailure
+}
+
+// wrapRequestFailure wraps the error returned by an ECS API call if it is a
+// request failure, other errors are returned unchanged
+func wrapRequestFailure(err error) error {
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		return &requestFailure{reqErr}
+	}
+	return err
+}
+
+// Retry returns false if ECS reported that the requested resource does not
+// exist, as retrying the request would yield the same result
+func (err *requestFailure) Retry() bool {
+	return err.StatusCode() != http.StatusNotFound
+}
@@ -54,6 +54,15 @@ type RetriableError interface {
 	error
 }
 
+// IsRetryable returns false if the error implements Retriable and reports that
+// it can't be retried. All other errors are considered retriable
+func IsRetryable(err error) bool {
+	if retriable, ok := err.(Retriable); ok {
+		return retriable.Retry()
+	}
+	return true
+}
+
 // DefaultRetriableError is used to wrap a retriable error
 type DefaultRetriableError struct {
 	Retriable
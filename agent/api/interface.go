@@ -41,6 +41,10 @@ type ECSClient interface {
 	// DiscoverPollEndpoint takes a ContainerInstanceARN and returns the
 	// endpoint at which this Agent should contact ACS
 	DiscoverPollEndpoint(containerInstanceArn string) (string, error)
+	// ForceDiscoverPollEndpoint takes a ContainerInstanceARN and returns the
+	// endpoint at which this Agent should contact ACS, bypassing the endpoint
+	// cached by previous calls
+	ForceDiscoverPollEndpoint(containerInstanceArn string) (string, error)
 	// DiscoverTelemetryEndpoint takes a ContainerInstanceARN and returns the
 	// endpoint at which this Agent should contact Telemetry Service
 	DiscoverTelemetryEndpoint(containerInstanceArn string) (string, error)
@@ -49,6 +53,9 @@ type ECSClient interface {
 	// UpdateContainerInstancesState updates the given container Instance ID with
 	// the given status. Only valid statuses are ACTIVE and DRAINING.
 	UpdateContainerInstancesState(instanceARN, status string) error
+	// UpdateContainerInstanceAttributes puts the given attributes on the given
+	// container instance in a single call, either all or none of them are set
+	UpdateContainerInstanceAttributes(instanceARN string, attributes []*ecs.Attribute) error
 }
 
 // ECSSDK is an interface that specifies the subset of the AWS Go SDK's ECS
@@ -60,6 +67,7 @@ type ECSSDK interface {
 	DiscoverPollEndpoint(*ecs.DiscoverPollEndpointInput) (*ecs.DiscoverPollEndpointOutput, error)
 	ListTagsForResource(*ecs.ListTagsForResourceInput) (*ecs.ListTagsForResourceOutput, error)
 	UpdateContainerInstancesState(input *ecs.UpdateContainerInstancesStateInput) (*ecs.UpdateContainerInstancesStateOutput, error)
+	PutAttributes(input *ecs.PutAttributesInput) (*ecs.PutAttributesOutput, error)
 }
 
 // ECSSubmitStateSDK is an interface with customized ecs client that
@@ -94,6 +94,21 @@ func (mr *MockECSSDKMockRecorder) ListTagsForResource(arg0 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTagsForResource", reflect.TypeOf((*MockECSSDK)(nil).ListTagsForResource), arg0)
 }
 
+// PutAttributes mocks base method
+func (m *MockECSSDK) PutAttributes(arg0 *ecs.PutAttributesInput) (*ecs.PutAttributesOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutAttributes", arg0)
+	ret0, _ := ret[0].(*ecs.PutAttributesOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PutAttributes indicates an expected call of PutAttributes
+func (mr *MockECSSDKMockRecorder) PutAttributes(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutAttributes", reflect.TypeOf((*MockECSSDK)(nil).PutAttributes), arg0)
+}
+
 // RegisterContainerInstance mocks base method
 func (m *MockECSSDK) RegisterContainerInstance(arg0 *ecs.RegisterContainerInstanceInput) (*ecs.RegisterContainerInstanceOutput, error) {
 	m.ctrl.T.Helper()
@@ -245,6 +260,21 @@ func (mr *MockECSClientMockRecorder) DiscoverTelemetryEndpoint(arg0 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DiscoverTelemetryEndpoint", reflect.TypeOf((*MockECSClient)(nil).DiscoverTelemetryEndpoint), arg0)
 }
 
+// ForceDiscoverPollEndpoint mocks base method
+func (m *MockECSClient) ForceDiscoverPollEndpoint(arg0 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForceDiscoverPollEndpoint", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ForceDiscoverPollEndpoint indicates an expected call of ForceDiscoverPollEndpoint
+func (mr *MockECSClientMockRecorder) ForceDiscoverPollEndpoint(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForceDiscoverPollEndpoint", reflect.TypeOf((*MockECSClient)(nil).ForceDiscoverPollEndpoint), arg0)
+}
+
 // GetResourceTags mocks base method
 func (m *MockECSClient) GetResourceTags(arg0 string) ([]*ecs.Tag, error) {
 	m.ctrl.T.Helper()
@@ -318,6 +348,20 @@ func (mr *MockECSClientMockRecorder) SubmitTaskStateChange(arg0 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SubmitTaskStateChange", reflect.TypeOf((*MockECSClient)(nil).SubmitTaskStateChange), arg0)
 }
 
+// UpdateContainerInstanceAttributes mocks base method
+func (m *MockECSClient) UpdateContainerInstanceAttributes(arg0 string, arg1 []*ecs.Attribute) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateContainerInstanceAttributes", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateContainerInstanceAttributes indicates an expected call of UpdateContainerInstanceAttributes
+func (mr *MockECSClientMockRecorder) UpdateContainerInstanceAttributes(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateContainerInstanceAttributes", reflect.TypeOf((*MockECSClient)(nil).UpdateContainerInstanceAttributes), arg0, arg1)
+}
+
 // UpdateContainerInstancesState mocks base method
 func (m *MockECSClient) UpdateContainerInstancesState(arg0, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -14,6 +14,7 @@
 package task
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -305,6 +306,42 @@ func TaskFromACS(acsTask *ecsacs.Task, envelope *ecsacs.PayloadMessage) (*Task,
 	return task, nil
 }
 
+// acsTaskFieldsHandledSeparately are the fields of ecsacs.Task that aren't
+// unmarshaled into the Task by TaskFromACS, but translated by the payload handler
+var acsTaskFieldsHandledSeparately = []string{
+	"elasticNetworkInterfaces",
+	"executionRoleCredentials",
+	"group",
+	"proxyConfiguration",
+	"roleCredentials",
+	"tags",
+	"taskDefinitionAccountId",
+}
+
+// CheckUnknownACSTaskFields returns an error if the ecsacs.Task has fields that
+// TaskFromACS would silently ignore, which typically happens when a new task
+// definition field is added to the ACS model before being supported by the agent
+func CheckUnknownACSTaskFields(acsTask *ecsacs.Task) error {
+	data, err := jsonutil.BuildJSON(acsTask)
+	if err != nil {
+		return err
+	}
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for _, field := range acsTaskFieldsHandledSeparately {
+		delete(fields, field)
+	}
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(&Task{})
+}
+
 func (task *Task) initializeVolumes(cfg *config.Config, dockerClient dockerapi.DockerClient, ctx context.Context) error {
 	err := task.initializeDockerLocalVolumes(dockerClient, ctx)
 	if err != nil {
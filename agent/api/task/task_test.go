@@ -3281,6 +3281,42 @@ func TestTaskFromACSPerContainerTimeouts(t *testing.T) {
 	assert.Equal(t, task.Containers[0].StopTimeout, expectedTimeout)
 }
 
+func TestCheckUnknownACSTaskFields(t *testing.T) {
+	taskFromACS := ecsacs.Task{
+		Arn:                     strptr("myArn"),
+		DesiredStatus:           strptr("RUNNING"),
+		Family:                  strptr("myFamily"),
+		Group:                   strptr("service:myService"),
+		TaskDefinitionAccountId: strptr("123456789012"),
+		RoleCredentials:         &ecsacs.IAMRoleCredentials{CredentialsId: strptr("credsId")},
+		Containers: []*ecsacs.Container{
+			{
+				Name:         strptr("myName"),
+				Image:        strptr("image:tag"),
+				StartTimeout: aws.Int64(10),
+			},
+		},
+	}
+	assert.NoError(t, CheckUnknownACSTaskFields(&taskFromACS))
+}
+
+func TestCheckUnknownACSTaskFieldsReportsFieldsNotHandled(t *testing.T) {
+	handledSeparately := acsTaskFieldsHandledSeparately
+	defer func() {
+		acsTaskFieldsHandledSeparately = handledSeparately
+	}()
+	// Pretend that the task group is a field the agent doesn't know about
+	acsTaskFieldsHandledSeparately = []string{}
+
+	taskFromACS := ecsacs.Task{
+		Arn:   strptr("myArn"),
+		Group: strptr("service:myService"),
+	}
+	err := CheckUnknownACSTaskFields(&taskFromACS)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown field "group"`)
+}
+
 func TestGetContainerIndex(t *testing.T) {
 	task := &Task{
 		Containers: []*apicontainer.Container{
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"time"
 
 	"github.com/aws/amazon-ecs-agent/agent/logger"
@@ -31,11 +32,13 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/engine/execcmd"
 	"github.com/aws/amazon-ecs-agent/agent/metrics"
 
+	acsclient "github.com/aws/amazon-ecs-agent/agent/acs/client"
 	acshandler "github.com/aws/amazon-ecs-agent/agent/acs/handler"
 	"github.com/aws/amazon-ecs-agent/agent/api"
 	"github.com/aws/amazon-ecs-agent/agent/api/ecsclient"
 	apierrors "github.com/aws/amazon-ecs-agent/agent/api/errors"
 	"github.com/aws/amazon-ecs-agent/agent/app/factory"
+	asmfactory "github.com/aws/amazon-ecs-agent/agent/asm/factory"
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/containermetadata"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
@@ -95,6 +98,10 @@ const (
 	inServiceState                 = "InService"
 	asgLifecyclePollWait           = time.Minute
 	asgLifecyclePollMax            = 120 // given each poll cycle waits for about a minute, this gives 2-3 hours before timing out
+
+	// maxACSSessionFailures is the number of ACS sessions failing in a row after which the
+	// systemd watchdog keepalives stop, for systemd to restart the agent
+	maxACSSessionFailures = 10
 )
 
 var (
@@ -145,6 +152,13 @@ type ecsAgent struct {
 	resourceFields              *taskresource.ResourceFields
 	availabilityZone            string
 	latestSeqNumberTaskManifest *int64
+	taskMetadataCache           *containermetadata.TaskMetadataCache
+	inFlightAcks                *acshandler.InFlightAckRegistry
+	acsPauseResume              *acshandler.ACSSessionPauseResume
+	instanceIdentityVerifier    *ec2.InstanceIdentityVerifier
+	crashReporter               *acshandler.AgentCrashReporter
+	prewarmedSecrets            *asmfactory.PrewarmedSecrets
+	prePulledImages             *dockerapi.PrePulledImages
 }
 
 // newAgent returns a new ecsAgent object, but does not start anything
@@ -193,7 +207,7 @@ func newAgent(blackholeEC2Metadata bool, acceptInsecureCert *bool) (agent, error
 
 	var dataClient data.Client
 	if cfg.Checkpoint.Enabled() {
-		dataClient, err = data.New(cfg.DataDir)
+		dataClient, err = data.New(cfg.DataDir, cfg.DataCompressionThreshold)
 		if err != nil {
 			logger.Critical("Error creating Docker client", logger.Fields{
 				field.Error: err,
@@ -234,6 +248,10 @@ func newAgent(blackholeEC2Metadata bool, acceptInsecureCert *bool) (agent, error
 		terminationHandler:          sighandlers.StartDefaultTerminationHandler,
 		mobyPlugins:                 mobypkgwrapper.NewPlugins(),
 		latestSeqNumberTaskManifest: &initialSeqNumber,
+		taskMetadataCache:           containermetadata.NewTaskMetadataCache(),
+		inFlightAcks:                acshandler.NewInFlightAckRegistry(),
+		acsPauseResume:              acshandler.NewACSSessionPauseResume(),
+		crashReporter:               acshandler.NewAgentCrashReporter(cfg.DataDir),
 	}, nil
 }
 
@@ -260,7 +278,9 @@ func (agent *ecsAgent) setTerminationHandler(handler sighandlers.TerminationHand
 }
 
 // start starts the ECS Agent
-func (agent *ecsAgent) start() int {
+func (agent *ecsAgent) start() (exitCode int) {
+	// Record the abnormal exits of the agent, to report them to ACS on the next start
+	defer agent.crashReporter.RecordExit(&exitCode)
 	sighandlers.StartDebugHandler()
 
 	containerChangeEventStream := eventstream.NewEventStream(containerChangeEventStreamName, agent.ctx)
@@ -269,6 +289,14 @@ func (agent *ecsAgent) start() int {
 	imageManager := engine.NewImageManager(agent.cfg, agent.dockerClient, state)
 	client := ecsclient.NewECSClient(agent.credentialProvider, agent.cfg, agent.ec2MetadataClient)
 
+	// The secrets prewarmed by the ACS session are read by the secret resources of the tasks
+	if agent.cfg.ACSSecretsPrewarm {
+		agent.prewarmedSecrets = asmfactory.NewPrewarmedSecrets(acshandler.PrewarmedSecretTTL)
+	}
+	// The images pre-pulled by the ACS session are waited for by the task engine
+	if agent.cfg.ACSPrePullImages {
+		agent.prePulledImages = dockerapi.NewPrePulledImages(acshandler.PrePulledImageTTL)
+	}
 	agent.initializeResourceFields(credentialsManager)
 	return agent.doStart(containerChangeEventStream, credentialsManager, state, imageManager, client, execcmd.NewManager())
 }
@@ -402,10 +430,13 @@ func (agent *ecsAgent) doStart(containerChangeEventStream *eventstream.EventStre
 	// Begin listening to the docker daemon and saving changes
 	taskEngine.SetDataClient(agent.dataClient)
 	imageManager.SetDataClient(agent.dataClient)
+	if dockerTaskEngine, ok := taskEngine.(*engine.DockerTaskEngine); ok {
+		dockerTaskEngine.SetTaskMetadataCache(agent.taskMetadataCache)
+	}
 	taskEngine.MustInit(agent.ctx)
 
 	// Start back ground routines, including the telemetry session
-	deregisterInstanceEventStream := eventstream.NewEventStream(
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream(
 		deregisterContainerInstanceEventStreamName, agent.ctx)
 	deregisterInstanceEventStream.StartListening()
 	taskHandler := eventhandler.NewTaskHandler(agent.ctx, agent.dataClient, state, client)
@@ -494,7 +525,7 @@ func (agent *ecsAgent) newTaskEngine(containerChangeEventStream *eventstream.Eve
 
 	if !agent.cfg.Checkpoint.Enabled() {
 		seelog.Info("Checkpointing not enabled; a new container instance will be created each time the agent is run")
-		return engine.NewTaskEngine(agent.cfg, agent.dockerClient, credentialsManager,
+		return engine.NewTaskEngine(agent.cfg, agent.engineDockerClient(), credentialsManager,
 			containerChangeEventStream, imageManager, state,
 			agent.metadataManager, agent.resourceFields, execCmdMgr), "", nil
 	}
@@ -519,7 +550,7 @@ func (agent *ecsAgent) newTaskEngine(containerChangeEventStream *eventstream.Eve
 		// Reset agent state as a new container instance
 		state.Reset()
 		// Reset taskEngine; all the other values are still default
-		return engine.NewTaskEngine(agent.cfg, agent.dockerClient, credentialsManager,
+		return engine.NewTaskEngine(agent.cfg, agent.engineDockerClient(), credentialsManager,
 			containerChangeEventStream, imageManager, state, agent.metadataManager,
 			agent.resourceFields, execCmdMgr), currentEC2InstanceID, nil
 	}
@@ -562,6 +593,15 @@ func (agent *ecsAgent) newDoctorWithHealthchecks(cluster, containerInstanceARN s
 	healthcheckList := []doctor.Healthcheck{
 		runtimeHealthCheck,
 	}
+	// The clock sync check queries the NTP server on every run, it's opt-in. The
+	// default NTP server, the Amazon Time Sync Service, is only reachable from EC2
+	// instances. External instances only check their clock against an NTP server
+	// configured explicitly
+	if agent.cfg.ACSClockSyncCheck &&
+		(!agent.cfg.External.Enabled() || agent.cfg.ACSNTPServer != config.DefaultACSNTPServer) {
+		healthcheckList = append(healthcheckList,
+			doctor.NewNTPSyncCheck(agent.cfg.ACSNTPServer, agent.cfg.ACSClockSkewThreshold))
+	}
 
 	// set up the doctor and return it
 	return doctor.NewDoctor(healthcheckList, cluster, containerInstanceARN)
@@ -707,6 +747,8 @@ func (agent *ecsAgent) registerContainerInstance(
 			"containerInstanceARN": agent.containerInstanceARN,
 			"cluster":              agent.cfg.Cluster,
 		})
+		// Keep the attributes pushed by ACS since the instance was registered
+		capabilities = mergeAttributes(capabilities, acshandler.LoadContainerInstanceAttributes(agent.dataClient))
 		return agent.reregisterContainerInstance(client, capabilities, tags, uuid.New(), platformDevices, outpostARN)
 	}
 
@@ -787,7 +829,7 @@ func (agent *ecsAgent) startAsyncRoutines(
 	credentialsManager credentials.Manager,
 	imageManager engine.ImageManager,
 	taskEngine engine.TaskEngine,
-	deregisterInstanceEventStream *eventstream.EventStream,
+	deregisterInstanceEventStream *eventstream.DeregisterInstanceEventStream,
 	client api.ECSClient,
 	taskHandler *eventhandler.TaskHandler,
 	attachmentEventHandler *eventhandler.AttachmentEventHandler,
@@ -806,16 +848,19 @@ func (agent *ecsAgent) startAsyncRoutines(
 	}
 
 	// Agent introspection api
-	go handlers.ServeIntrospectionHTTPEndpoint(agent.ctx, &agent.containerInstanceARN, taskEngine, agent.cfg)
+	go handlers.ServeIntrospectionHTTPEndpoint(agent.ctx, &agent.containerInstanceARN, taskEngine, agent.cfg,
+		agent.inFlightAcks, agent.dataClient, agent.acsPauseResume)
 
 	statsEngine := stats.NewDockerStatsEngine(agent.cfg, agent.dockerClient, containerChangeEventStream)
 
 	// Start serving the endpoint to fetch IAM Role credentials and other task metadata
 	if agent.cfg.TaskMetadataAZDisabled {
 		// send empty availability zone
-		go handlers.ServeTaskHTTPEndpoint(agent.ctx, credentialsManager, state, client, agent.containerInstanceARN, agent.cfg, statsEngine, "")
+		go handlers.ServeTaskHTTPEndpoint(agent.ctx, credentialsManager, state, client, agent.containerInstanceARN, agent.cfg, statsEngine, "",
+			agent.taskMetadataCache)
 	} else {
-		go handlers.ServeTaskHTTPEndpoint(agent.ctx, credentialsManager, state, client, agent.containerInstanceARN, agent.cfg, statsEngine, agent.availabilityZone)
+		go handlers.ServeTaskHTTPEndpoint(agent.ctx, credentialsManager, state, client, agent.containerInstanceARN, agent.cfg, statsEngine, agent.availabilityZone,
+			agent.taskMetadataCache)
 	}
 
 	// Start sending events to the backend
@@ -889,37 +934,96 @@ func (agent *ecsAgent) spotInstanceDrainingPoller(client api.ECSClient) bool {
 func (agent *ecsAgent) startACSSession(
 	credentialsManager credentials.Manager,
 	taskEngine engine.TaskEngine,
-	deregisterInstanceEventStream *eventstream.EventStream,
+	deregisterInstanceEventStream *eventstream.DeregisterInstanceEventStream,
 	client api.ECSClient,
 	state dockerstate.TaskEngineState,
 	taskHandler *eventhandler.TaskHandler,
 	doctor *doctor.Doctor) int {
 
-	acsSession := acshandler.NewSession(
-		agent.ctx,
-		agent.cfg,
-		deregisterInstanceEventStream,
-		agent.containerInstanceARN,
-		agent.credentialProvider,
-		agent.dockerClient,
-		client,
-		state,
-		agent.dataClient,
-		taskEngine,
-		credentialsManager,
-		taskHandler,
-		agent.latestSeqNumberTaskManifest,
-		doctor,
-	)
+	if err := agent.verifyInstanceIdentity(); err != nil {
+		seelog.Criticalf("Unable to verify the instance identity document, not connecting to ACS: %v", err)
+		return exitcodes.ExitTerminal
+	}
+
+	certVerification, err := acsclient.NewSecureBootVerification(agent.cfg)
+	if err != nil {
+		seelog.Criticalf("Unable to load the intermediate CAs ACS certificates are pinned to, not connecting to ACS: %v", err)
+		return exitcodes.ExitTerminal
+	}
+
+	recoveryHook := acshandler.NewSystemdNotifyHook(maxACSSessionFailures)
+	recoveryHook.Start(agent.ctx)
+
+	acsSession := acshandler.NewSession(agent.ctx, acshandler.SessionParams{
+		Config:                        agent.cfg,
+		DeregisterInstanceEventStream: deregisterInstanceEventStream,
+		ContainerInstanceARN:          agent.containerInstanceARN,
+		CredentialsProvider:           agent.credentialProvider,
+		DockerClient:                  agent.dockerClient,
+		ECSClient:                     client,
+		TaskEngineState:               state,
+		DataClient:                    agent.dataClient,
+		TaskEngine:                    taskEngine,
+		CredentialsManager:            credentialsManager,
+		TaskHandler:                   taskHandler,
+		LatestSeqNumTaskManifest:      agent.latestSeqNumberTaskManifest,
+		Doctor:                        doctor,
+		EC2MetadataClient:             agent.ec2MetadataClient,
+		TaskMetadataCache:             agent.taskMetadataCache,
+		RecoveryHook:                  recoveryHook,
+		InFlightAcks:                  agent.inFlightAcks,
+		FeatureFlag:                   acshandler.NewPercentageBasedFeatureFlag(agent.cfg.ACSFeatureRollout),
+		TelemetryUploader: tcshandler.NewTelemetryUploader(agent.cfg, agent.credentialProvider, client, taskEngine,
+			agent.containerInstanceARN),
+		CrashReporter:     agent.crashReporter,
+		CertVerification:  certVerification,
+		PrewarmedSecrets:  agent.prewarmedSecrets,
+		PauseResume:       agent.acsPauseResume,
+		BackupCredentials: acshandler.NewACSBackupCredentialsProvider(agent.credentialProvider),
+		PrePulledImages:   agent.prePulledImages,
+	})
 	seelog.Info("Beginning Polling for updates")
-	err := acsSession.Start()
+	err = acsSession.Start()
 	if err != nil {
 		seelog.Criticalf("Unretriable error starting communicating with ACS: %v", err)
+		agent.crashReporter.RecordError(err)
 		return exitcodes.ExitTerminal
 	}
 	return exitcodes.ExitSuccess
 }
 
+// engineDockerClient returns the docker client of the task engine, whose image
+// pulls wait for the images being pre-pulled by the ACS session
+func (agent *ecsAgent) engineDockerClient() dockerapi.DockerClient {
+	return dockerapi.NewPrePullAwareDockerClient(agent.dockerClient, agent.prePulledImages)
+}
+
+// verifyInstanceIdentity verifies the signature of the instance identity document
+// when a certificate to verify it against is configured. The verified document is
+// cached, so that it is only verified once for the lifetime of the process
+func (agent *ecsAgent) verifyInstanceIdentity() error {
+	if agent.cfg.InstanceIdentityCertificatePath == "" || agent.cfg.NoIID {
+		return nil
+	}
+	if agent.instanceIdentityVerifier == nil {
+		certificate, err := ioutil.ReadFile(agent.cfg.InstanceIdentityCertificatePath)
+		if err != nil {
+			return err
+		}
+		verifier, err := ec2.NewInstanceIdentityVerifier(agent.ec2MetadataClient, certificate)
+		if err != nil {
+			return err
+		}
+		agent.instanceIdentityVerifier = verifier
+	}
+	document, err := agent.instanceIdentityVerifier.Verify()
+	if err != nil {
+		return err
+	}
+	seelog.Infof("Verified the instance identity document of instance %s", document.InstanceID)
+	return nil
+}
+
 // validateRequiredVersion validates docker version.
 // Minimum docker version supported is 1.9.0, maps to api version 1.21
 // see https://docs.docker.com/develop/sdk/#api-version-matrix
@@ -970,6 +1074,22 @@ func mergeTags(localTags []*ecs.Tag, ec2Tags []*ecs.Tag) []*ecs.Tag {
 	return utils.MapToTags(tagsMap)
 }
 
+// mergeAttributes appends the additional attributes to the attributes, skipping
+// the ones with the same name as one of the attributes
+func mergeAttributes(attributes []*ecs.Attribute, additionalAttributes []*ecs.Attribute) []*ecs.Attribute {
+	names := make(map[string]struct{})
+	for _, attribute := range attributes {
+		names[aws.StringValue(attribute.Name)] = struct{}{}
+	}
+	for _, attribute := range additionalAttributes {
+		if _, ok := names[aws.StringValue(attribute.Name)]; ok {
+			continue
+		}
+		attributes = append(attributes, attribute)
+	}
+	return attributes
+}
+
 // getHostPrivateIPv4AddressFromEC2Metadata will retrieve the PrivateIPAddress (IPv4) of this
 // instance throught the EC2 API
 func (agent *ecsAgent) getHostPrivateIPv4AddressFromEC2Metadata() string {
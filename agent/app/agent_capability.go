@@ -73,6 +73,7 @@ const (
 	capabilityExecConfigRelativePath                       = "config"
 	capabilityExecCertsRelativePath                        = "certs"
 	capabilityExternal                                     = "external"
+	capabilityACSOperatorAlerts                            = "acs-operator-alerts"
 )
 
 var (
@@ -96,6 +97,8 @@ var (
 		capabilityFullTaskSync,
 		// ecs agent version 1.39.0 supports bulk loading env vars through environmentFiles in S3
 		capabilityEnvFilesS3,
+		// support the operator alerts pushed by ACS
+		capabilityACSOperatorAlerts,
 	}
 	// use empty struct as value type to simulate set
 	capabilityExecInvalidSsmVersions = map[string]struct{}{}
@@ -176,6 +179,7 @@ var (
 //    ecs.capability.fsxWindowsFileServer
 //    ecs.capability.execute-command
 //    ecs.capability.external
+//    ecs.capability.acs-operator-alerts
 func (agent *ecsAgent) capabilities() ([]*ecs.Attribute, error) {
 	var capabilities []*ecs.Attribute
 
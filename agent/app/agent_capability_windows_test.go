@@ -184,6 +184,7 @@ func TestSupportedCapabilitiesWindows(t *testing.T) {
 		attributePrefix + capabilityContainerOrdering,
 		attributePrefix + capabilityFullTaskSync,
 		attributePrefix + capabilityEnvFilesS3,
+		attributePrefix + capabilityACSOperatorAlerts,
 		attributePrefix + taskENIBlockInstanceMetadataAttributeSuffix}
 
 	var expectedCapabilities []*ecs.Attribute
@@ -38,6 +38,7 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
 	mock_dockerapi "github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/doctor"
 	mock_ec2 "github.com/aws/amazon-ecs-agent/agent/ec2/mocks"
 	"github.com/aws/amazon-ecs-agent/agent/ecs_client/model/ecs"
 	"github.com/aws/amazon-ecs-agent/agent/engine"
@@ -362,6 +363,8 @@ func testDoStartHappyPathWithConditions(t *testing.T, blackholed bool, warmPools
 	ec2MetadataClient.EXPECT().PrivateIPv4Address().Return(hostPrivateIPv4Address, nil)
 	ec2MetadataClient.EXPECT().PublicIPv4Address().Return(hostPublicIPv4Address, nil)
 	ec2MetadataClient.EXPECT().OutpostARN().Return("", nil)
+	ec2MetadataClient.EXPECT().InstanceType().Return("c5.xlarge", nil).AnyTimes()
+	ec2MetadataClient.EXPECT().GetMetadata(gomock.Any()).Return("", errors.New("not found")).AnyTimes()
 
 	if blackholed {
 		if warmPoolsEnv {
@@ -1329,6 +1332,24 @@ func TestMergeTags(t *testing.T) {
 	assert.Equal(t, localValue, aws.StringValue(mergedTags[2].Value))
 }
 
+func TestMergeAttributes(t *testing.T) {
+	attributes := []*ecs.Attribute{
+		{Name: aws.String("ecs.capability.secrets.asm.environment-variables")},
+		{Name: aws.String("software"), Value: aws.String("agent")},
+	}
+	pushedAttributes := []*ecs.Attribute{
+		{Name: aws.String("software"), Value: aws.String("pushed")},
+		{Name: aws.String("gpu-driver"), Value: aws.String("470")},
+	}
+
+	merged := mergeAttributes(attributes, pushedAttributes)
+
+	require.Len(t, merged, 3)
+	assert.Equal(t, "agent", aws.StringValue(merged[1].Value))
+	assert.Equal(t, "gpu-driver", aws.StringValue(merged[2].Name))
+	assert.Equal(t, "470", aws.StringValue(merged[2].Value))
+}
+
 func TestGetContainerInstanceTagsFromEC2API(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -1537,9 +1558,14 @@ func TestSaveMetadata(t *testing.T) {
 	assert.Equal(t, availabilityZone, az)
 }
 
+// testNTPServer is a closed port, refusing the queries of the clock skew check
+// right away instead of letting them time out
+const testNTPServer = "127.0.0.1:1"
+
 func getTestConfig() config.Config {
 	cfg := config.DefaultConfig()
 	cfg.TaskCPUMemLimit.Value = config.ExplicitlyDisabled
+	cfg.ACSNTPServer = testNTPServer
 	return cfg
 }
 
@@ -1597,3 +1623,56 @@ func TestWaitUntilInstanceInServicePolling(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyInstanceIdentityDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cfg := getTestConfig()
+	// No call to the instance metadata service is expected
+	agent := &ecsAgent{ec2MetadataClient: mock_ec2.NewMockEC2MetadataClient(ctrl), cfg: &cfg}
+	assert.NoError(t, agent.verifyInstanceIdentity())
+}
+
+func TestVerifyInstanceIdentityMissingCertificate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	cfg := getTestConfig()
+	cfg.InstanceIdentityCertificatePath = "/nonexistent/aws-certificate.pem"
+	agent := &ecsAgent{ec2MetadataClient: mock_ec2.NewMockEC2MetadataClient(ctrl), cfg: &cfg}
+	assert.Error(t, agent.verifyInstanceIdentity())
+}
+
+func TestNewDoctorWithHealthchecksNTPSyncCheck(t *testing.T) {
+	testCases := []struct {
+		name              string
+		enabled           bool
+		external          bool
+		ntpServer         string
+		expectedNTPChecks int
+	}{
+		{"disabled", false, false, config.DefaultACSNTPServer, 0},
+		{"EC2 instance", true, false, config.DefaultACSNTPServer, 1},
+		{"external instance", true, true, config.DefaultACSNTPServer, 0},
+		{"external instance with an NTP server", true, true, "10.0.0.1:123", 1},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := getTestConfig()
+			cfg.ACSClockSyncCheck = tc.enabled
+			cfg.ACSNTPServer = tc.ntpServer
+			if tc.external {
+				cfg.External = config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled}
+			}
+			agent := &ecsAgent{cfg: &cfg}
+			agentDoctor, err := agent.newDoctorWithHealthchecks(clusterName, containerInstanceARN)
+			require.NoError(t, err)
+			ntpChecks := 0
+			for _, healthcheck := range *agentDoctor.GetHealthchecks() {
+				if _, ok := healthcheck.(*doctor.NTPSyncCheck); ok {
+					ntpChecks++
+				}
+			}
+			assert.Equal(t, tc.expectedNTPChecks, ntpChecks)
+		})
+	}
+}
@@ -155,7 +155,7 @@ func (agent *ecsAgent) initializeResourceFields(credentialsManager credentials.M
 		Control: cgroup.New(),
 		ResourceFieldsCommon: &taskresource.ResourceFieldsCommon{
 			IOUtil:             ioutilwrapper.NewIOUtil(),
-			ASMClientCreator:   asmfactory.NewClientCreator(),
+			ASMClientCreator:   asmfactory.NewPrewarmedClientCreator(asmfactory.NewClientCreator(), agent.prewarmedSecrets),
 			SSMClientCreator:   ssmfactory.NewSSMClientCreator(),
 			CredentialsManager: credentialsManager,
 			EC2InstanceID:      agent.getEC2InstanceID(),
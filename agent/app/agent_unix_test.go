@@ -76,6 +76,8 @@ func TestDoStartTaskENIHappyPath(t *testing.T) {
 	mockPauseLoader := mock_pause.NewMockLoader(ctrl)
 	mockUdevMonitor := mock_udev.NewMockUdev(ctrl)
 	mockMetadata := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	mockMetadata.EXPECT().InstanceType().Return("c5.xlarge", nil).AnyTimes()
+	mockMetadata.EXPECT().GetMetadata(gomock.Any()).Return("", errors.New("not found")).AnyTimes()
 	mockMobyPlugins := mock_mobypkgwrapper.NewMockPlugins(ctrl)
 
 	eniWatcher := &watcher.ENIWatcher{}
@@ -432,6 +434,8 @@ func TestDoStartCgroupInitHappyPath(t *testing.T) {
 	containerChangeEvents := make(chan dockerapi.DockerContainerChangeEvent)
 
 	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().InstanceType().Return("c5.xlarge", nil).AnyTimes()
+	ec2MetadataClient.EXPECT().GetMetadata(gomock.Any()).Return("", errors.New("not found")).AnyTimes()
 	dockerClient.EXPECT().Version(gomock.Any(), gomock.Any()).AnyTimes()
 	dockerClient.EXPECT().SupportedVersions().Return(apiVersions)
 	imageManager.EXPECT().StartImageCleanupProcess(gomock.Any()).MaxTimes(1)
@@ -471,6 +475,7 @@ func TestDoStartCgroupInitHappyPath(t *testing.T) {
 	)
 
 	cfg := config.DefaultConfig()
+	cfg.ACSNTPServer = testNTPServer
 	ctx, cancel := context.WithCancel(context.TODO())
 	// Cancel the context to cancel async routines
 	agent := &ecsAgent{
@@ -558,6 +563,8 @@ func TestDoStartGPUManagerHappyPath(t *testing.T) {
 	mockGPUManager := mock_gpu.NewMockGPUManager(ctrl)
 	mockMobyPlugins := mock_mobypkgwrapper.NewMockPlugins(ctrl)
 	ec2MetadataClient := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	ec2MetadataClient.EXPECT().InstanceType().Return("c5.xlarge", nil).AnyTimes()
+	ec2MetadataClient.EXPECT().GetMetadata(gomock.Any()).Return("", errors.New("not found")).AnyTimes()
 	mockPauseLoader := mock_pause.NewMockLoader(ctrl)
 
 	devices := []*ecs.PlatformDevice{
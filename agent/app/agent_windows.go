@@ -304,7 +304,7 @@ func (t *termHandlerIndicator) wait() uint32 {
 func (agent *ecsAgent) initializeResourceFields(credentialsManager credentials.Manager) {
 	agent.resourceFields = &taskresource.ResourceFields{
 		ResourceFieldsCommon: &taskresource.ResourceFieldsCommon{
-			ASMClientCreator:   asmfactory.NewClientCreator(),
+			ASMClientCreator:   asmfactory.NewPrewarmedClientCreator(asmfactory.NewClientCreator(), agent.prewarmedSecrets),
 			SSMClientCreator:   ssmfactory.NewSSMClientCreator(),
 			FSxClientCreator:   fsxfactory.NewFSxClientCreator(),
 			CredentialsManager: credentialsManager,
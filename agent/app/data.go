@@ -66,7 +66,7 @@ func (agent *ecsAgent) loadData(containerChangeEventStream *eventstream.EventStr
 	imageManager engine.ImageManager,
 	execCmdMgr execcmd.Manager) (*savedData, error) {
 	s := &savedData{
-		taskEngine: engine.NewTaskEngine(agent.cfg, agent.dockerClient, credentialsManager,
+		taskEngine: engine.NewTaskEngine(agent.cfg, agent.engineDockerClient(), credentialsManager,
 			containerChangeEventStream, imageManager, state,
 			agent.metadataManager, agent.resourceFields, execCmdMgr),
 	}
@@ -0,0 +1,170 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//    http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package factory
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+// prewarmedSecret is a secret value fetched ahead of the tasks using it
+type prewarmedSecret struct {
+	output    *secretsmanager.GetSecretValueOutput
+	expiresAt time.Time
+}
+
+// PrewarmedSecrets holds the secret values fetched before the tasks using them
+// are received, so that the tasks don't wait for Secrets Manager when they are
+// started. The values are kept by execution role, a task only gets the values
+// fetched with the credentials of its own execution role, and are forgotten
+// once their TTL elapses so that rotated secrets are picked up
+type PrewarmedSecrets struct {
+	ttl     time.Duration
+	lock    sync.Mutex
+	secrets map[string]prewarmedSecret
+}
+
+// NewPrewarmedSecrets returns a new PrewarmedSecrets keeping the values for ttl
+func NewPrewarmedSecrets(ttl time.Duration) *PrewarmedSecrets {
+	return &PrewarmedSecrets{
+		ttl:     ttl,
+		secrets: make(map[string]prewarmedSecret),
+	}
+}
+
+// prewarmedSecretKey returns the key of the value of the secret fetched with
+// the input, in the region, with the credentials of the role
+func prewarmedSecretKey(roleARN string, region string, input *secretsmanager.GetSecretValueInput) string {
+	return strings.Join([]string{
+		roleARN,
+		region,
+		aws.StringValue(input.SecretId),
+		aws.StringValue(input.VersionStage),
+		aws.StringValue(input.VersionId),
+	}, "|")
+}
+
+// Get returns the value of the secret fetched with the input, in the region,
+// with the credentials of the role, if it was prewarmed and hasn't expired
+func (secrets *PrewarmedSecrets) Get(roleARN string, region string,
+	input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, bool) {
+	if secrets == nil || input == nil {
+		return nil, false
+	}
+	key := prewarmedSecretKey(roleARN, region, input)
+	secrets.lock.Lock()
+	defer secrets.lock.Unlock()
+	secret, ok := secrets.secrets[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(secret.expiresAt) {
+		delete(secrets.secrets, key)
+		return nil, false
+	}
+	return secret.output, true
+}
+
+// Set records the value of the secret fetched with the input, in the region,
+// with the credentials of the role
+func (secrets *PrewarmedSecrets) Set(roleARN string, region string,
+	input *secretsmanager.GetSecretValueInput, output *secretsmanager.GetSecretValueOutput) {
+	if secrets == nil || input == nil || output == nil {
+		return
+	}
+	secrets.lock.Lock()
+	defer secrets.lock.Unlock()
+	secrets.secrets[prewarmedSecretKey(roleARN, region, input)] = prewarmedSecret{
+		output:    output,
+		expiresAt: time.Now().Add(secrets.ttl),
+	}
+}
+
+// Sweep forgets the values whose TTL has elapsed
+func (secrets *PrewarmedSecrets) Sweep() {
+	if secrets == nil {
+		return
+	}
+	now := time.Now()
+	secrets.lock.Lock()
+	defer secrets.lock.Unlock()
+	for key, secret := range secrets.secrets {
+		if now.After(secret.expiresAt) {
+			delete(secrets.secrets, key)
+		}
+	}
+}
+
+// Len returns the number of values held, expired or not
+func (secrets *PrewarmedSecrets) Len() int {
+	if secrets == nil {
+		return 0
+	}
+	secrets.lock.Lock()
+	defer secrets.lock.Unlock()
+	return len(secrets.secrets)
+}
+
+// NewPrewarmedClientCreator returns a ClientCreator whose clients return the
+// prewarmed secret values instead of fetching them, and fall back to the
+// clients of the creator otherwise. The creator is returned as is if secrets
+// is nil
+func NewPrewarmedClientCreator(creator ClientCreator, secrets *PrewarmedSecrets) ClientCreator {
+	if secrets == nil {
+		return creator
+	}
+	return &prewarmedClientCreator{
+		creator: creator,
+		secrets: secrets,
+	}
+}
+
+type prewarmedClientCreator struct {
+	creator ClientCreator
+	secrets *PrewarmedSecrets
+}
+
+func (creator *prewarmedClientCreator) NewASMClient(region string,
+	creds credentials.IAMRoleCredentials) secretsmanageriface.SecretsManagerAPI {
+	return &prewarmedClient{
+		SecretsManagerAPI: creator.creator.NewASMClient(region, creds),
+		secrets:           creator.secrets,
+		roleARN:           creds.RoleArn,
+		region:            region,
+	}
+}
+
+// prewarmedClient is a Secrets Manager client returning the prewarmed secret
+// values fetched with the credentials of its role
+type prewarmedClient struct {
+	secretsmanageriface.SecretsManagerAPI
+	secrets *PrewarmedSecrets
+	roleARN string
+	region  string
+}
+
+// GetSecretValue returns the prewarmed value of the secret, or fetches it
+func (client *prewarmedClient) GetSecretValue(
+	input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	if output, ok := client.secrets.Get(client.roleARN, client.region, input); ok {
+		return output, nil
+	}
+	return client.SecretsManagerAPI.GetSecretValue(input)
+}
@@ -0,0 +1,125 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package factory
+
+import (
+	"testing"
+	"time"
+
+	mock_secretsmanageriface "github.com/aws/amazon-ecs-agent/agent/asm/mocks"
+	"github.com/aws/amazon-ecs-agent/agent/credentials"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRoleARN  = "arn:aws:iam::123456789012:role/execution"
+	testRegion   = "us-west-2"
+	testSecretID = "arn:aws:secretsmanager:us-west-2:123456789012:secret:db-password-abcdef"
+)
+
+// fixedClientCreator returns the same client for all the regions and credentials
+type fixedClientCreator struct {
+	client secretsmanageriface.SecretsManagerAPI
+}
+
+func (creator fixedClientCreator) NewASMClient(region string,
+	creds credentials.IAMRoleCredentials) secretsmanageriface.SecretsManagerAPI {
+	return creator.client
+}
+
+func testSecretInput() *secretsmanager.GetSecretValueInput {
+	return &secretsmanager.GetSecretValueInput{SecretId: aws.String(testSecretID)}
+}
+
+func TestPrewarmedSecretsGetSet(t *testing.T) {
+	secrets := NewPrewarmedSecrets(time.Minute)
+	output := &secretsmanager.GetSecretValueOutput{SecretString: aws.String("secret")}
+
+	_, ok := secrets.Get(testRoleARN, testRegion, testSecretInput())
+	assert.False(t, ok)
+
+	secrets.Set(testRoleARN, testRegion, testSecretInput(), output)
+	cached, ok := secrets.Get(testRoleARN, testRegion, testSecretInput())
+	require.True(t, ok)
+	assert.Equal(t, output, cached)
+
+	// The values are only returned for the role and region they were fetched with
+	_, ok = secrets.Get("arn:aws:iam::123456789012:role/other", testRegion, testSecretInput())
+	assert.False(t, ok)
+	_, ok = secrets.Get(testRoleARN, "us-east-1", testSecretInput())
+	assert.False(t, ok)
+	staged := testSecretInput()
+	staged.VersionStage = aws.String("AWSPREVIOUS")
+	_, ok = secrets.Get(testRoleARN, testRegion, staged)
+	assert.False(t, ok)
+}
+
+func TestPrewarmedSecretsExpire(t *testing.T) {
+	secrets := NewPrewarmedSecrets(time.Millisecond)
+	secrets.Set(testRoleARN, testRegion, testSecretInput(), &secretsmanager.GetSecretValueOutput{})
+	secrets.Set(testRoleARN, "us-east-1", testSecretInput(), &secretsmanager.GetSecretValueOutput{})
+	time.Sleep(5 * time.Millisecond)
+
+	_, ok := secrets.Get(testRoleARN, testRegion, testSecretInput())
+	assert.False(t, ok)
+	assert.Equal(t, 1, secrets.Len())
+
+	secrets.Sweep()
+	assert.Equal(t, 0, secrets.Len())
+}
+
+func TestNilPrewarmedSecrets(t *testing.T) {
+	var secrets *PrewarmedSecrets
+	secrets.Set(testRoleARN, testRegion, testSecretInput(), &secretsmanager.GetSecretValueOutput{})
+	secrets.Sweep()
+	_, ok := secrets.Get(testRoleARN, testRegion, testSecretInput())
+	assert.False(t, ok)
+	assert.Equal(t, 0, secrets.Len())
+
+	creator := NewClientCreator()
+	assert.Equal(t, creator, NewPrewarmedClientCreator(creator, nil))
+}
+
+func TestPrewarmedClientReturnsPrewarmedValues(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	client := mock_secretsmanageriface.NewMockSecretsManagerAPI(ctrl)
+	secrets := NewPrewarmedSecrets(time.Minute)
+	prewarmed := &secretsmanager.GetSecretValueOutput{SecretString: aws.String("prewarmed")}
+	secrets.Set(testRoleARN, testRegion, testSecretInput(), prewarmed)
+	creator := NewPrewarmedClientCreator(fixedClientCreator{client: client}, secrets)
+
+	// The prewarmed value is returned without calling Secrets Manager
+	output, err := creator.NewASMClient(testRegion, credentials.IAMRoleCredentials{RoleArn: testRoleARN}).
+		GetSecretValue(testSecretInput())
+	require.NoError(t, err)
+	assert.Equal(t, prewarmed, output)
+
+	// The values of the other roles are fetched
+	fetched := &secretsmanager.GetSecretValueOutput{SecretString: aws.String("fetched")}
+	client.EXPECT().GetSecretValue(testSecretInput()).Return(fetched, nil)
+	output, err = creator.NewASMClient(testRegion, credentials.IAMRoleCredentials{RoleArn: "other"}).
+		GetSecretValue(testSecretInput())
+	require.NoError(t, err)
+	assert.Equal(t, fetched, output)
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"time"
@@ -148,6 +149,156 @@ const (
 	// DefaultContainerMetricsPublishInterval is the default interval that we publish
 	// metrics to the ECS telemetry backend (TACS)
 	DefaultContainerMetricsPublishInterval = 20 * time.Second
+
+	// DefaultACSTaskGroupMaxConcurrentStarts is the default number of tasks of the same task group
+	// that are started concurrently
+	DefaultACSTaskGroupMaxConcurrentStarts = 5
+
+	// DefaultACSLaunchSuccessRateWindowSize is the default number of task launches over which
+	// the task launch success rate is computed
+	DefaultACSLaunchSuccessRateWindowSize = 100
+
+	// DefaultACSMinLaunchSuccessRate is the default task launch success rate below which the
+	// agent considers that it is failing to start tasks
+	DefaultACSMinLaunchSuccessRate = 0.5
+
+	// DefaultACSPriorityMessageThreshold is the default priority at and above which messages
+	// received from ACS skip the message queue, which is credentials refreshes and heartbeats
+	DefaultACSPriorityMessageThreshold = 2
+
+	// DefaultACSPayloadBufferMin is the default minimum number of payload messages buffered
+	// before the handler blocks
+	DefaultACSPayloadBufferMin = 10
+
+	// DefaultACSPayloadBufferMax is the default maximum number of payload messages buffered
+	// before the handler blocks
+	DefaultACSPayloadBufferMax = 100
+
+	// DefaultACSMaxPayloadMessageAge is the default age after which payload messages received
+	// from ACS are discarded
+	DefaultACSMaxPayloadMessageAge = 24 * time.Hour
+
+	// DefaultCompletedTaskHistoryTTL is the default duration for which tasks remain queryable
+	// through the introspection API after being cleaned up
+	DefaultCompletedTaskHistoryTTL = time.Hour
+
+	// DefaultACSStateSyncInterval is the default interval at which the state of the tasks
+	// running on the instance is reported to ACS, the reports are disabled by default since
+	// older ACS endpoints do not accept them
+	DefaultACSStateSyncInterval = 0 * time.Minute
+
+	// DefaultACSEndpointRotationThreshold is the default number of consecutive failures to
+	// connect to the same ACS endpoint IP after which a new endpoint is discovered
+	DefaultACSEndpointRotationThreshold = 3
+
+	// DefaultDockerHealthCheckInterval is the default interval at which the docker daemon
+	// health is checked
+	DefaultDockerHealthCheckInterval = 30 * time.Second
+
+	// DefaultDockerHealthFailureThreshold is the default number of consecutive failed docker
+	// health checks after which docker is considered unhealthy
+	DefaultDockerHealthFailureThreshold = 3
+
+	// DefaultACSBatchSubmitRatePerSecond is the default maximum number of tasks of a payload
+	// message submitted to the task engine per second
+	DefaultACSBatchSubmitRatePerSecond = 10
+
+	// DefaultACSTagCacheTTL is the default duration for which the fetched tags of a task are cached
+	DefaultACSTagCacheTTL = 5 * time.Minute
+
+	// DefaultEBSVolumeAttachTimeout is the default duration a task waits for its EBS volumes to be visible on the host
+	DefaultEBSVolumeAttachTimeout = 2 * time.Minute
+
+	// DefaultACSAckBatchWindow is the default duration for which the acks sent to ACS are batched, ack batching
+	// is disabled by default since older ACS endpoints do not accept a frame holding several acks
+	DefaultACSAckBatchWindow = 0 * time.Millisecond
+
+	// DefaultACSSessionCacheSize is the default number of TLS sessions cached for reconnecting to ACS
+	DefaultACSSessionCacheSize = 10
+
+	// DefaultACSMaxConnectsPerMinute is the default number of connections to ACS allowed in a minute
+	DefaultACSMaxConnectsPerMinute = 20
+
+	// DefaultDataCompressionThreshold is the default size above which the tasks saved to the data directory are compressed,
+	// compression is disabled by default since the compressed values cannot be read by earlier versions of the agent
+	DefaultDataCompressionThreshold = 0
+
+	// DefaultACSManifestHistoryDepth is the default number of task manifests saved to the data directory
+	DefaultACSManifestHistoryDepth = 5
+
+	// DefaultACSHandlerStopTimeout is the default time the agent waits for an ACS message handler to stop
+	DefaultACSHandlerStopTimeout = 10 * time.Second
+
+	// DefaultACSIdempotencyTokenTTL is the default time for which task submissions are remembered
+	DefaultACSIdempotencyTokenTTL = 48 * time.Hour
+
+	// DefaultACSEventRelayMaxRate is the default number of task engine events relayed to ACS per second
+	DefaultACSEventRelayMaxRate = 10
+
+	// DefaultACSGetInstanceStateTimeout is the default time allowed to take a snapshot of the state of the tasks
+	DefaultACSGetInstanceStateTimeout = 5 * time.Second
+
+	// DefaultACSReconnectStaggerInterval is the default interval between the first reconnects to ACS of the agents
+	// of consecutive stagger slots
+	DefaultACSReconnectStaggerInterval = 500 * time.Millisecond
+
+	// DefaultIAMCheckCacheTTL is the default duration the result of the check of a task IAM role against the
+	// permissions boundary of the instance role is cached
+	DefaultIAMCheckCacheTTL = 10 * time.Minute
+
+	// DefaultACSMessageTraceMaxSizeMB is the default size in megabytes at which the ACS message trace file is rotated
+	DefaultACSMessageTraceMaxSizeMB = 100
+
+	// DefaultACSMessageTraceMinFreeMB is the default free disk space in megabytes below which ACS messages stop being
+	// traced
+	DefaultACSMessageTraceMinFreeMB = 512
+
+	// DefaultACSSplitTestMatchWindow is the default time a message of a split test session waits for the same message
+	// from the other endpoint
+	DefaultACSSplitTestMatchWindow = time.Minute
+
+	// DefaultACSMemoryPressureThreshold is the default available memory in megabytes below which the host is considered
+	// under memory pressure
+	DefaultACSMemoryPressureThreshold = 256
+
+	// DefaultACSNTPServer is the default NTP server the system clock is compared to, the Amazon Time Sync Service
+	DefaultACSNTPServer = "169.254.169.123"
+
+	// DefaultACSClockSkewThreshold is the default skew of the system clock above which the agent warns that the
+	// connections to ACS may fail
+	DefaultACSClockSkewThreshold = 2 * time.Minute
+
+	// DefaultACSDeregistrationGracePeriod is the default time the agent waits for the running tasks to stop before
+	// notifying the deregistration of the container instance
+	DefaultACSDeregistrationGracePeriod = 5 * time.Minute
+
+	// DefaultACSPrimaryFailoverThreshold is the default number of consecutive failures to connect to ACS in the region
+	// of the agent after which the agent fails over to the backup ACS endpoint
+	DefaultACSPrimaryFailoverThreshold = 10
+
+	// DefaultACSPrimaryRecoveryInterval is the default interval at which the agent checks whether ACS in its own
+	// region is reachable again once it failed over to the backup ACS endpoint
+	DefaultACSPrimaryRecoveryInterval = 10 * time.Minute
+
+	// DefaultACSPrePullConcurrency is the default maximum number of images pulled concurrently ahead of the tasks
+	// using them
+	DefaultACSPrePullConcurrency = 2
+
+	// DefaultACSMaxHandlerGoroutines is the default maximum number of goroutines run concurrently by the handlers
+	// of ACS messages
+	DefaultACSMaxHandlerGoroutines = 100
+
+	// DefaultACSMaxRTT is the default round-trip latency budget of the connection to ACS
+	DefaultACSMaxRTT = 2 * time.Second
+)
+
+const (
+	// IPVersionAuto makes the agent attempt to connect over IPv6 first and fall back to IPv4
+	IPVersionAuto = "auto"
+	// IPVersionIPv4 makes the agent only connect over IPv4
+	IPVersionIPv4 = "ipv4"
+	// IPVersionIPv6 makes the agent only connect over IPv6
+	IPVersionIPv6 = "ipv6"
 )
 
 const (
@@ -363,6 +514,234 @@ func (cfg *Config) validateAndOverrideBounds() error {
 		cfg.TaskMetadataBurstRate = DefaultTaskMetadataBurstRate
 	}
 
+	if cfg.ACSTaskGroupMaxConcurrentStarts <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_TASK_GROUP_MAX_CONCURRENT_STARTS, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSTaskGroupMaxConcurrentStarts, cfg.ACSTaskGroupMaxConcurrentStarts)
+		cfg.ACSTaskGroupMaxConcurrentStarts = DefaultACSTaskGroupMaxConcurrentStarts
+	}
+
+	if cfg.ACSLaunchSuccessRateWindowSize <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_LAUNCH_SUCCESS_RATE_WINDOW_SIZE, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSLaunchSuccessRateWindowSize, cfg.ACSLaunchSuccessRateWindowSize)
+		cfg.ACSLaunchSuccessRateWindowSize = DefaultACSLaunchSuccessRateWindowSize
+	}
+
+	if cfg.ACSMinLaunchSuccessRate <= 0 || cfg.ACSMinLaunchSuccessRate > 1 {
+		seelog.Warnf("Invalid value for ECS_ACS_MIN_LAUNCH_SUCCESS_RATE, will be overridden with the default value: %v. Parsed value: %v.", DefaultACSMinLaunchSuccessRate, cfg.ACSMinLaunchSuccessRate)
+		cfg.ACSMinLaunchSuccessRate = DefaultACSMinLaunchSuccessRate
+	}
+
+	if cfg.ACSPriorityMessageThreshold < 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_PRIORITY_MESSAGE_THRESHOLD, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSPriorityMessageThreshold, cfg.ACSPriorityMessageThreshold)
+		cfg.ACSPriorityMessageThreshold = DefaultACSPriorityMessageThreshold
+	}
+
+	if cfg.ACSPayloadBufferMin <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_PAYLOAD_BUFFER_MIN, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSPayloadBufferMin, cfg.ACSPayloadBufferMin)
+		cfg.ACSPayloadBufferMin = DefaultACSPayloadBufferMin
+	}
+
+	if cfg.ACSPayloadBufferMax < cfg.ACSPayloadBufferMin {
+		seelog.Warnf("Invalid value for ECS_ACS_PAYLOAD_BUFFER_MAX, must not be lower than ECS_ACS_PAYLOAD_BUFFER_MIN (%d), will be overridden with that value. Parsed value: %d.", cfg.ACSPayloadBufferMin, cfg.ACSPayloadBufferMax)
+		cfg.ACSPayloadBufferMax = cfg.ACSPayloadBufferMin
+	}
+
+	if cfg.ACSMaxPayloadMessageAge <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_MAX_PAYLOAD_MESSAGE_AGE, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSMaxPayloadMessageAge.String(), cfg.ACSMaxPayloadMessageAge)
+		cfg.ACSMaxPayloadMessageAge = DefaultACSMaxPayloadMessageAge
+	}
+
+	if cfg.CompletedTaskHistoryTTL <= 0 {
+		seelog.Warnf("Invalid value for ECS_COMPLETED_TASK_HISTORY_TTL, will be overridden with the default value: %s. Parsed value: %v.", DefaultCompletedTaskHistoryTTL.String(), cfg.CompletedTaskHistoryTTL)
+		cfg.CompletedTaskHistoryTTL = DefaultCompletedTaskHistoryTTL
+	}
+
+	if cfg.ACSStateSyncInterval < 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_STATE_SYNC_INTERVAL, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSStateSyncInterval.String(), cfg.ACSStateSyncInterval)
+		cfg.ACSStateSyncInterval = DefaultACSStateSyncInterval
+	}
+
+	if cfg.ACSEndpointRotationThreshold <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_ENDPOINT_ROTATION_THRESHOLD, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSEndpointRotationThreshold, cfg.ACSEndpointRotationThreshold)
+		cfg.ACSEndpointRotationThreshold = DefaultACSEndpointRotationThreshold
+	}
+
+	if cfg.DockerHealthCheckInterval <= 0 {
+		seelog.Warnf("Invalid value for ECS_DOCKER_HEALTH_CHECK_INTERVAL, will be overridden with the default value: %s. Parsed value: %v.", DefaultDockerHealthCheckInterval.String(), cfg.DockerHealthCheckInterval)
+		cfg.DockerHealthCheckInterval = DefaultDockerHealthCheckInterval
+	}
+
+	if cfg.DockerHealthFailureThreshold <= 0 {
+		seelog.Warnf("Invalid value for ECS_DOCKER_HEALTH_FAILURE_THRESHOLD, will be overridden with the default value: %d. Parsed value: %d.", DefaultDockerHealthFailureThreshold, cfg.DockerHealthFailureThreshold)
+		cfg.DockerHealthFailureThreshold = DefaultDockerHealthFailureThreshold
+	}
+
+	if cfg.ACSBatchSubmitRatePerSecond <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_BATCH_SUBMIT_RATE_PER_SECOND, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSBatchSubmitRatePerSecond, cfg.ACSBatchSubmitRatePerSecond)
+		cfg.ACSBatchSubmitRatePerSecond = DefaultACSBatchSubmitRatePerSecond
+	}
+
+	if cfg.ACSTagCacheTTL <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_TAG_CACHE_TTL, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSTagCacheTTL.String(), cfg.ACSTagCacheTTL)
+		cfg.ACSTagCacheTTL = DefaultACSTagCacheTTL
+	}
+
+	if cfg.EBSVolumeAttachTimeout <= 0 {
+		seelog.Warnf("Invalid value for ECS_EBS_VOLUME_ATTACH_TIMEOUT, will be overridden with the default value: %s. Parsed value: %v.", DefaultEBSVolumeAttachTimeout.String(), cfg.EBSVolumeAttachTimeout)
+		cfg.EBSVolumeAttachTimeout = DefaultEBSVolumeAttachTimeout
+	}
+
+	if cfg.ACSAckBatchWindow < 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_ACK_BATCH_WINDOW, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSAckBatchWindow.String(), cfg.ACSAckBatchWindow)
+		cfg.ACSAckBatchWindow = DefaultACSAckBatchWindow
+	}
+
+	if cfg.ACSSessionCacheSize <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_SESSION_CACHE_SIZE, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSSessionCacheSize, cfg.ACSSessionCacheSize)
+		cfg.ACSSessionCacheSize = DefaultACSSessionCacheSize
+	}
+
+	if cfg.ACSMaxConnectsPerMinute <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_MAX_CONNECTS_PER_MINUTE, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSMaxConnectsPerMinute, cfg.ACSMaxConnectsPerMinute)
+		cfg.ACSMaxConnectsPerMinute = DefaultACSMaxConnectsPerMinute
+	}
+
+	if cfg.DataCompressionThreshold < 0 {
+		seelog.Warnf("Invalid value for ECS_DATA_COMPRESSION_THRESHOLD, will be overridden with the default value: %d. Parsed value: %d.", DefaultDataCompressionThreshold, cfg.DataCompressionThreshold)
+		cfg.DataCompressionThreshold = DefaultDataCompressionThreshold
+	}
+
+	if cfg.ACSManifestHistoryDepth <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_MANIFEST_HISTORY_DEPTH, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSManifestHistoryDepth, cfg.ACSManifestHistoryDepth)
+		cfg.ACSManifestHistoryDepth = DefaultACSManifestHistoryDepth
+	}
+
+	if cfg.ACSHandlerStopTimeout <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_HANDLER_STOP_TIMEOUT, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSHandlerStopTimeout.String(), cfg.ACSHandlerStopTimeout)
+		cfg.ACSHandlerStopTimeout = DefaultACSHandlerStopTimeout
+	}
+
+	if cfg.ACSIdempotencyTokenTTL <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_IDEMPOTENCY_TOKEN_TTL, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSIdempotencyTokenTTL.String(), cfg.ACSIdempotencyTokenTTL)
+		cfg.ACSIdempotencyTokenTTL = DefaultACSIdempotencyTokenTTL
+	}
+
+	if cfg.ACSEventRelayMaxRate <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_EVENT_RELAY_MAX_RATE, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSEventRelayMaxRate, cfg.ACSEventRelayMaxRate)
+		cfg.ACSEventRelayMaxRate = DefaultACSEventRelayMaxRate
+	}
+
+	if cfg.ACSGetInstanceStateTimeout <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_GET_INSTANCE_STATE_TIMEOUT, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSGetInstanceStateTimeout.String(), cfg.ACSGetInstanceStateTimeout)
+		cfg.ACSGetInstanceStateTimeout = DefaultACSGetInstanceStateTimeout
+	}
+
+	if cfg.ACSReconnectStaggerSlot < 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_RECONNECT_STAGGER_SLOT, will be overridden with the first slot: 0. Parsed value: %d.", cfg.ACSReconnectStaggerSlot)
+		cfg.ACSReconnectStaggerSlot = 0
+	}
+
+	if cfg.ACSReconnectStaggerInterval <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_RECONNECT_STAGGER_INTERVAL, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSReconnectStaggerInterval.String(), cfg.ACSReconnectStaggerInterval)
+		cfg.ACSReconnectStaggerInterval = DefaultACSReconnectStaggerInterval
+	}
+
+	if cfg.IAMCheckCacheTTL <= 0 {
+		seelog.Warnf("Invalid value for ECS_IAM_CHECK_CACHE_TTL, will be overridden with the default value: %s. Parsed value: %v.", DefaultIAMCheckCacheTTL.String(), cfg.IAMCheckCacheTTL)
+		cfg.IAMCheckCacheTTL = DefaultIAMCheckCacheTTL
+	}
+
+	if cfg.ACSMessageTraceMaxSizeMB <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_MESSAGE_TRACE_MAX_SIZE_MB, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSMessageTraceMaxSizeMB, cfg.ACSMessageTraceMaxSizeMB)
+		cfg.ACSMessageTraceMaxSizeMB = DefaultACSMessageTraceMaxSizeMB
+	}
+
+	if cfg.ACSMessageTraceMinFreeMB < 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_MESSAGE_TRACE_MIN_FREE_MB, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSMessageTraceMinFreeMB, cfg.ACSMessageTraceMinFreeMB)
+		cfg.ACSMessageTraceMinFreeMB = DefaultACSMessageTraceMinFreeMB
+	}
+
+	if cfg.ACSSplitTestMatchWindow <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_SPLIT_TEST_MATCH_WINDOW, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSSplitTestMatchWindow.String(), cfg.ACSSplitTestMatchWindow)
+		cfg.ACSSplitTestMatchWindow = DefaultACSSplitTestMatchWindow
+	}
+
+	if cfg.ACSMemoryPressureThreshold < 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_MEMORY_PRESSURE_THRESHOLD, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSMemoryPressureThreshold, cfg.ACSMemoryPressureThreshold)
+		cfg.ACSMemoryPressureThreshold = DefaultACSMemoryPressureThreshold
+	}
+
+	if cfg.ACSClockSkewThreshold <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_CLOCK_SKEW_THRESHOLD, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSClockSkewThreshold.String(), cfg.ACSClockSkewThreshold)
+		cfg.ACSClockSkewThreshold = DefaultACSClockSkewThreshold
+	}
+
+	if cfg.ACSDeregistrationGracePeriod < 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_DEREGISTRATION_GRACE_PERIOD, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSDeregistrationGracePeriod.String(), cfg.ACSDeregistrationGracePeriod)
+		cfg.ACSDeregistrationGracePeriod = DefaultACSDeregistrationGracePeriod
+	}
+
+	if !cfg.ACSDeregistrationGracePeriodEnabled.Enabled() {
+		cfg.ACSDeregistrationGracePeriod = 0
+	}
+
+	if cfg.EBSMountRetries < 0 {
+		seelog.Warnf("Invalid value for ECS_EBS_MOUNT_RETRIES, EBS volumes won't be verified. Parsed value: %d.", cfg.EBSMountRetries)
+		cfg.EBSMountRetries = 0
+	}
+
+	if cfg.ACSVerifyManifestSignature && cfg.ACSManifestSigningKeySecretID == "" {
+		seelog.Errorf("Invalid value for ECS_ACS_MANIFEST_SIGNING_KEY_SECRET_ID, it must be set when ECS_ACS_VERIFY_MANIFEST_SIGNATURE is, all the task manifests will be rejected.")
+	}
+
+	if cfg.ACSBackupEndpoint != "" && cfg.ACSBackupRegion == "" {
+		seelog.Warnf("Invalid value for ECS_ACS_BACKUP_REGION, it must be set when ECS_ACS_BACKUP_ENDPOINT is, failover to the backup endpoint will be disabled.")
+		cfg.ACSBackupEndpoint = ""
+	}
+
+	if cfg.ACSPrimaryFailoverThreshold <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_PRIMARY_FAILOVER_THRESHOLD, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSPrimaryFailoverThreshold, cfg.ACSPrimaryFailoverThreshold)
+		cfg.ACSPrimaryFailoverThreshold = DefaultACSPrimaryFailoverThreshold
+	}
+
+	if cfg.ACSPrimaryRecoveryInterval <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_PRIMARY_RECOVERY_INTERVAL, will be overridden with the default value: %s. Parsed value: %v.", DefaultACSPrimaryRecoveryInterval.String(), cfg.ACSPrimaryRecoveryInterval)
+		cfg.ACSPrimaryRecoveryInterval = DefaultACSPrimaryRecoveryInterval
+	}
+
+	if cfg.ACSPrePullConcurrency <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_PRE_PULL_CONCURRENCY, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSPrePullConcurrency, cfg.ACSPrePullConcurrency)
+		cfg.ACSPrePullConcurrency = DefaultACSPrePullConcurrency
+	}
+
+	if cfg.ACSMaxHandlerGoroutines <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_MAX_HANDLER_GOROUTINES, will be overridden with the default value: %d. Parsed value: %d.", DefaultACSMaxHandlerGoroutines, cfg.ACSMaxHandlerGoroutines)
+		cfg.ACSMaxHandlerGoroutines = DefaultACSMaxHandlerGoroutines
+	}
+
+	if cfg.ACSMaxReconnectInterval < 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_MAX_RECONNECT_INTERVAL, will be ignored. Parsed value: %v.", cfg.ACSMaxReconnectInterval)
+		cfg.ACSMaxReconnectInterval = 0
+	}
+
+	if cfg.ACSMaxRTT <= 0 {
+		seelog.Warnf("Invalid value for ECS_ACS_MAX_RTT, will be overridden with the default value: %v. Parsed value: %v.", DefaultACSMaxRTT, cfg.ACSMaxRTT)
+		cfg.ACSMaxRTT = DefaultACSMaxRTT
+	}
+
+	if cfg.ACSSplitTestSession && (cfg.ACSEndpointA == "" || cfg.ACSEndpointB == "") {
+		seelog.Warnf("Invalid value for ECS_ACS_SPLIT_TEST_SESSION, both ECS_ACS_ENDPOINT_A and ECS_ACS_ENDPOINT_B must be set, split testing will be disabled.")
+		cfg.ACSSplitTestSession = false
+	}
+
+	if cfg.ACSTaskTmpfsDir != "" && !filepath.IsAbs(cfg.ACSTaskTmpfsDir) {
+		seelog.Warnf("Invalid value for ECS_ACS_TASK_TMPFS_DIR, the path must be absolute, tmpfs mounts will be left to docker. Parsed value: %s.", cfg.ACSTaskTmpfsDir)
+		cfg.ACSTaskTmpfsDir = ""
+	}
+
+	if cfg.ACSHandlerCgroupPath != "" && !filepath.IsAbs(cfg.ACSHandlerCgroupPath) {
+		seelog.Warnf("Invalid value for ECS_ACS_HANDLER_CGROUP_PATH, the path must be absolute, ACS handlers will run in the agent cgroup. Parsed value: %s.", cfg.ACSHandlerCgroupPath)
+		cfg.ACSHandlerCgroupPath = ""
+	}
+
 	// check the PollMetrics specific configurations
 	cfg.pollMetricsOverrides()
 
@@ -521,6 +900,8 @@ func environmentConfig() (Config, error) {
 
 	additionalLocalRoutes, errs := parseAdditionalLocalRoutes(errs)
 
+	acsFeatureRollout, errs := parseACSFeatureRollout(errs)
+
 	var err error
 	if len(errs) > 0 {
 		err = apierrors.NewMultiError(errs...)
@@ -594,8 +975,89 @@ func environmentConfig() (Config, error) {
 		FSxWindowsFileServerCapable:         parseFSxWindowsFileServerCapability(),
 		External:                            parseBooleanDefaultFalseConfig("ECS_EXTERNAL"),
 		EnableRuntimeStats:                  parseBooleanDefaultFalseConfig("ECS_ENABLE_RUNTIME_STATS"),
+		EnableACSPauseEndpoints:             parseBooleanDefaultFalseConfig("ECS_ENABLE_ACS_PAUSE_ENDPOINTS"),
 		ShouldExcludeIPv6PortBinding:        parseBooleanDefaultTrueConfig("ECS_EXCLUDE_IPV6_PORTBINDING"),
 		WarmPoolsSupport:                    parseBooleanDefaultFalseConfig("ECS_WARM_POOLS_CHECK"),
+		ACSTaskGroupMaxConcurrentStarts:     parseEnvVariableInt("ECS_ACS_TASK_GROUP_MAX_CONCURRENT_STARTS"),
+		ACSLaunchSuccessRateWindowSize:      parseEnvVariableInt("ECS_ACS_LAUNCH_SUCCESS_RATE_WINDOW_SIZE"),
+		ACSMinLaunchSuccessRate:             parseEnvVariableFloat64("ECS_ACS_MIN_LAUNCH_SUCCESS_RATE"),
+		ACSReconnectOnLowLaunchSuccessRate:  parseBooleanDefaultFalseConfig("ECS_ACS_RECONNECT_ON_LOW_LAUNCH_SUCCESS_RATE"),
+		ACSPriorityMessageThreshold:         parseEnvVariableInt("ECS_ACS_PRIORITY_MESSAGE_THRESHOLD"),
+		ACSIPVersion:                        parseACSIPVersion(),
+		ACSHandlerCgroupPath:                os.Getenv("ECS_ACS_HANDLER_CGROUP_PATH"),
+		ACSHandlerNetworkNamespace:          utils.ParseBool(os.Getenv("ECS_ACS_HANDLER_NETWORK_NAMESPACE"), false),
+		ACSPayloadBufferMin:                 parseEnvVariableInt("ECS_ACS_PAYLOAD_BUFFER_MIN"),
+		ACSPayloadBufferMax:                 parseEnvVariableInt("ECS_ACS_PAYLOAD_BUFFER_MAX"),
+		ACSEndpointSNI:                      os.Getenv("ECS_ACS_ENDPOINT_SNI"),
+		ACSMaxPayloadMessageAge:             parseEnvVariableDuration("ECS_ACS_MAX_PAYLOAD_MESSAGE_AGE"),
+		CompletedTaskHistoryTTL:             parseEnvVariableDuration("ECS_COMPLETED_TASK_HISTORY_TTL"),
+		ACSStateSyncInterval:                parseEnvVariableDuration("ECS_ACS_STATE_SYNC_INTERVAL"),
+		ACSEndpointRotationThreshold:        parseEnvVariableInt("ECS_ACS_ENDPOINT_ROTATION_THRESHOLD"),
+		StrictDecodeMode:                    utils.ParseBool(os.Getenv("ECS_ACS_STRICT_DECODE_MODE"), false),
+		ACSQueueURL:                         os.Getenv("ECS_ACS_QUEUE_URL"),
+		DockerHealthCheckInterval:           parseEnvVariableDuration("ECS_DOCKER_HEALTH_CHECK_INTERVAL"),
+		DockerHealthFailureThreshold:        parseEnvVariableInt("ECS_DOCKER_HEALTH_FAILURE_THRESHOLD"),
+		ACSBatchSubmitRatePerSecond:         parseEnvVariableInt("ECS_ACS_BATCH_SUBMIT_RATE_PER_SECOND"),
+		ACSPropagateTaskTags:                utils.ParseBool(os.Getenv("ECS_ACS_PROPAGATE_TASK_TAGS"), false),
+		ACSTagCacheTTL:                      parseEnvVariableDuration("ECS_ACS_TAG_CACHE_TTL"),
+		InstanceIdentityCertificatePath:     os.Getenv("ECS_INSTANCE_IDENTITY_CERTIFICATE_PATH"),
+		EBSVolumeAttachTimeout:              parseEnvVariableDuration("ECS_EBS_VOLUME_ATTACH_TIMEOUT"),
+		ACSAckBatchWindow:                   parseEnvVariableDuration("ECS_ACS_ACK_BATCH_WINDOW"),
+		ACSSessionCacheSize:                 parseEnvVariableInt("ECS_ACS_SESSION_CACHE_SIZE"),
+		ACSHeartbeatHostMetrics:             utils.ParseBool(os.Getenv("ECS_ACS_HEARTBEAT_HOST_METRICS"), false),
+		ACSMaxConnectsPerMinute:             parseEnvVariableInt("ECS_ACS_MAX_CONNECTS_PER_MINUTE"),
+		DataCompressionThreshold:            parseEnvVariableInt("ECS_DATA_COMPRESSION_THRESHOLD"),
+		ACSAdvertiseWasm:                    utils.ParseBool(os.Getenv("ECS_ACS_ADVERTISE_WASM"), false),
+		ACSFeatureRollout:                   acsFeatureRollout,
+		ACSManifestHistoryDepth:             parseEnvVariableInt("ECS_ACS_MANIFEST_HISTORY_DEPTH"),
+		PiggybackHeartbeat:                  utils.ParseBool(os.Getenv("ECS_ACS_PIGGYBACK_HEARTBEAT"), false),
+		ACSConnectionFingerprintLogging:     utils.ParseBool(os.Getenv("ECS_ACS_CONNECTION_FINGERPRINT_LOGGING"), false),
+		ACSHandlerStopTimeout:               parseEnvVariableDuration("ECS_ACS_HANDLER_STOP_TIMEOUT"),
+		ACSIdempotencyTokenTTL:              parseEnvVariableDuration("ECS_ACS_IDEMPOTENCY_TOKEN_TTL"),
+		ACSRelayTaskEngineEvents:            utils.ParseBool(os.Getenv("ECS_ACS_RELAY_TASK_ENGINE_EVENTS"), false),
+		ACSEventRelayMaxRate:                parseEnvVariableInt("ECS_ACS_EVENT_RELAY_MAX_RATE"),
+		ACSGetInstanceStateTimeout:          parseEnvVariableDuration("ECS_ACS_GET_INSTANCE_STATE_TIMEOUT"),
+		ACSReconnectStaggerSlot:             parseEnvVariableInt("ECS_ACS_RECONNECT_STAGGER_SLOT"),
+		ACSReconnectStaggerInterval:         parseEnvVariableDuration("ECS_ACS_RECONNECT_STAGGER_INTERVAL"),
+		ACSIAMPrecheck:                      utils.ParseBool(os.Getenv("ECS_ACS_IAM_PRECHECK"), false),
+		IAMCheckCacheTTL:                    parseEnvVariableDuration("ECS_IAM_CHECK_CACHE_TTL"),
+		ACSPinnedCAPath:                     os.Getenv("ECS_ACS_PINNED_CA_PATH"),
+		ACSBypassCertPin:                    utils.ParseBool(os.Getenv("ECS_ACS_BYPASS_CERT_PIN"), false),
+		ACSMessageTraceFile:                 os.Getenv("ECS_ACS_MESSAGE_TRACE_FILE"),
+		ACSMessageTraceMaxSizeMB:            parseEnvVariableInt("ECS_ACS_MESSAGE_TRACE_MAX_SIZE_MB"),
+		ACSMessageTraceMinFreeMB:            parseEnvVariableInt("ECS_ACS_MESSAGE_TRACE_MIN_FREE_MB"),
+		ACSProcessorAffinity:                os.Getenv("ECS_ACS_PROCESSOR_AFFINITY"),
+		ACSAuthChallengeRequired:            utils.ParseBool(os.Getenv("ECS_ACS_AUTH_CHALLENGE_REQUIRED"), false),
+		ACSSplitTestSession:                 utils.ParseBool(os.Getenv("ECS_ACS_SPLIT_TEST_SESSION"), false),
+		ACSEndpointA:                        os.Getenv("ECS_ACS_ENDPOINT_A"),
+		ACSEndpointB:                        os.Getenv("ECS_ACS_ENDPOINT_B"),
+		ACSSplitTestMatchWindow:             parseEnvVariableDuration("ECS_ACS_SPLIT_TEST_MATCH_WINDOW"),
+		ACSMemoryPressureThreshold:          parseEnvVariableInt("ECS_ACS_MEMORY_PRESSURE_THRESHOLD"),
+		ACSMemoryPressureMonitorEnabled:     parseACSMemoryPressureMonitorEnabled(),
+		ACSTaskTmpfsDir:                     os.Getenv("ECS_ACS_TASK_TMPFS_DIR"),
+		ACSOperatorAlertsSNSTopicARN:        os.Getenv("ECS_ACS_OPERATOR_ALERTS_SNS_TOPIC_ARN"),
+		ACSSecretsPrewarm:                   utils.ParseBool(os.Getenv("ECS_ACS_SECRETS_PREWARM"), false),
+		ACSClockSyncCheck:                   utils.ParseBool(os.Getenv("ECS_ACS_CLOCK_SYNC_CHECK"), false),
+		ACSNTPServer:                        os.Getenv("ECS_ACS_NTP_SERVER"),
+		ACSClockSkewThreshold:               parseEnvVariableDuration("ECS_ACS_CLOCK_SKEW_THRESHOLD"),
+		ACSFlushDNSOnReconnect:              utils.ParseBool(os.Getenv("ECS_ACS_FLUSH_DNS_ON_RECONNECT"), false),
+		ACSDeregistrationGracePeriod:        parseEnvVariableDuration("ECS_ACS_DEREGISTRATION_GRACE_PERIOD"),
+		ACSDeregistrationGracePeriodEnabled: parseACSDeregistrationGracePeriodEnabled(),
+		EBSMountRetries:                     parseEnvVariableInt("ECS_EBS_MOUNT_RETRIES"),
+		ACSVerifyManifestSignature:          utils.ParseBool(os.Getenv("ECS_ACS_VERIFY_MANIFEST_SIGNATURE"), false),
+		ACSManifestSigningKeySecretID:       os.Getenv("ECS_ACS_MANIFEST_SIGNING_KEY_SECRET_ID"),
+		ACSBackupEndpoint:                   os.Getenv("ECS_ACS_BACKUP_ENDPOINT"),
+		ACSBackupRegion:                     os.Getenv("ECS_ACS_BACKUP_REGION"),
+		ACSPrimaryFailoverThreshold:         parseEnvVariableInt("ECS_ACS_PRIMARY_FAILOVER_THRESHOLD"),
+		ACSPrimaryRecoveryInterval:          parseEnvVariableDuration("ECS_ACS_PRIMARY_RECOVERY_INTERVAL"),
+		ACSPrePullImages:                    utils.ParseBool(os.Getenv("ECS_ACS_PRE_PULL_IMAGES"), false),
+		ACSPrePullConcurrency:               parseEnvVariableInt("ECS_ACS_PRE_PULL_CONCURRENCY"),
+		ACSAvailabilityZoneAffinity:         utils.ParseBool(os.Getenv("ECS_ACS_AVAILABILITY_ZONE_AFFINITY"), false),
+		ACSMaxHandlerGoroutines:             parseEnvVariableInt("ECS_ACS_MAX_HANDLER_GOROUTINES"),
+		ACSInjectInstanceEnvVars:            utils.ParseBool(os.Getenv("ECS_ACS_INJECT_INSTANCE_ENV_VARS"), false),
+		ACSInstanceEnvVarDenyList:           parseEnvVariableStringList("ECS_ACS_INSTANCE_ENV_VAR_DENY_LIST"),
+		ACSMaxReconnectInterval:             parseEnvVariableDuration("ECS_ACS_MAX_RECONNECT_INTERVAL"),
+		ACSMaxRTT:                           parseEnvVariableDuration("ECS_ACS_MAX_RTT"),
 	}, err
 }
 
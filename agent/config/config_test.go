@@ -160,6 +160,84 @@ func TestEnvironmentConfig(t *testing.T) {
 	defer setTestEnv("ECS_ENABLE_RUNTIME_STATS", "true")()
 	defer setTestEnv("ECS_EXCLUDE_IPV6_PORTBINDING", "true")()
 	defer setTestEnv("ECS_WARM_POOLS_CHECK", "false")()
+	defer setTestEnv("ECS_ACS_TASK_GROUP_MAX_CONCURRENT_STARTS", "10")()
+	defer setTestEnv("ECS_ACS_LAUNCH_SUCCESS_RATE_WINDOW_SIZE", "50")()
+	defer setTestEnv("ECS_ACS_MIN_LAUNCH_SUCCESS_RATE", "0.8")()
+	defer setTestEnv("ECS_ACS_RECONNECT_ON_LOW_LAUNCH_SUCCESS_RATE", "true")()
+	defer setTestEnv("ECS_ACS_PRIORITY_MESSAGE_THRESHOLD", "3")()
+	defer setTestEnv("ECS_ACS_IP_VERSION", "ipv6")()
+	defer setTestEnv("ECS_ACS_HANDLER_CGROUP_PATH", "/sys/fs/cgroup/ecs-agent/acs")()
+	defer setTestEnv("ECS_ACS_HANDLER_NETWORK_NAMESPACE", "true")()
+	defer setTestEnv("ECS_ACS_PAYLOAD_BUFFER_MIN", "20")()
+	defer setTestEnv("ECS_ACS_PAYLOAD_BUFFER_MAX", "200")()
+	defer setTestEnv("ECS_ACS_ENDPOINT_SNI", "shard-1.ecs.us-west-2.amazonaws.com")()
+	defer setTestEnv("ECS_ACS_MAX_PAYLOAD_MESSAGE_AGE", "1h")()
+	defer setTestEnv("ECS_COMPLETED_TASK_HISTORY_TTL", "30m")()
+	defer setTestEnv("ECS_ACS_STATE_SYNC_INTERVAL", "10m")()
+	defer setTestEnv("ECS_ACS_ENDPOINT_ROTATION_THRESHOLD", "5")()
+	defer setTestEnv("ECS_ACS_STRICT_DECODE_MODE", "true")()
+	defer setTestEnv("ECS_ACS_QUEUE_URL", "https://sqs.us-west-2.amazonaws.com/123456789012/acs")()
+	defer setTestEnv("ECS_DOCKER_HEALTH_CHECK_INTERVAL", "1m")()
+	defer setTestEnv("ECS_DOCKER_HEALTH_FAILURE_THRESHOLD", "5")()
+	defer setTestEnv("ECS_ACS_BATCH_SUBMIT_RATE_PER_SECOND", "20")()
+	defer setTestEnv("ECS_ACS_PROPAGATE_TASK_TAGS", "true")()
+	defer setTestEnv("ECS_ACS_TAG_CACHE_TTL", "10m")()
+	defer setTestEnv("ECS_INSTANCE_IDENTITY_CERTIFICATE_PATH", "/etc/ecs/aws-certificate.pem")()
+	defer setTestEnv("ECS_EBS_VOLUME_ATTACH_TIMEOUT", "5m")()
+	defer setTestEnv("ECS_ACS_ACK_BATCH_WINDOW", "50ms")()
+	defer setTestEnv("ECS_ACS_SESSION_CACHE_SIZE", "20")()
+	defer setTestEnv("ECS_ACS_HEARTBEAT_HOST_METRICS", "true")()
+	defer setTestEnv("ECS_ACS_MAX_CONNECTS_PER_MINUTE", "30")()
+	defer setTestEnv("ECS_DATA_COMPRESSION_THRESHOLD", "1024")()
+	defer setTestEnv("ECS_ACS_ADVERTISE_WASM", "true")()
+	defer setTestEnv("ECS_ACS_FEATURE_ROLLOUT", "{\"AckBatching\": 25}")()
+	defer setTestEnv("ECS_ACS_MANIFEST_HISTORY_DEPTH", "10")()
+	defer setTestEnv("ECS_ACS_PIGGYBACK_HEARTBEAT", "true")()
+	defer setTestEnv("ECS_ACS_CONNECTION_FINGERPRINT_LOGGING", "true")()
+	defer setTestEnv("ECS_ACS_HANDLER_STOP_TIMEOUT", "30s")()
+	defer setTestEnv("ECS_ACS_IDEMPOTENCY_TOKEN_TTL", "24h")()
+	defer setTestEnv("ECS_ACS_RELAY_TASK_ENGINE_EVENTS", "true")()
+	defer setTestEnv("ECS_ACS_EVENT_RELAY_MAX_RATE", "5")()
+	defer setTestEnv("ECS_ACS_GET_INSTANCE_STATE_TIMEOUT", "30s")()
+	defer setTestEnv("ECS_ACS_RECONNECT_STAGGER_SLOT", "3")()
+	defer setTestEnv("ECS_ACS_RECONNECT_STAGGER_INTERVAL", "2s")()
+	defer setTestEnv("ECS_ACS_IAM_PRECHECK", "true")()
+	defer setTestEnv("ECS_IAM_CHECK_CACHE_TTL", "5m")()
+	defer setTestEnv("ECS_ACS_PINNED_CA_PATH", "/etc/ecs/acs-intermediates.pem")()
+	defer setTestEnv("ECS_ACS_BYPASS_CERT_PIN", "true")()
+	defer setTestEnv("ECS_ACS_MESSAGE_TRACE_FILE", "/var/log/ecs/acs-trace.jsonl")()
+	defer setTestEnv("ECS_ACS_MESSAGE_TRACE_MAX_SIZE_MB", "10")()
+	defer setTestEnv("ECS_ACS_MESSAGE_TRACE_MIN_FREE_MB", "256")()
+	defer setTestEnv("ECS_ACS_PROCESSOR_AFFINITY", "0-3,8")()
+	defer setTestEnv("ECS_ACS_AUTH_CHALLENGE_REQUIRED", "true")()
+	defer setTestEnv("ECS_ACS_SPLIT_TEST_SESSION", "true")()
+	defer setTestEnv("ECS_ACS_ENDPOINT_A", "https://ecs-a.us-west-2.amazonaws.com")()
+	defer setTestEnv("ECS_ACS_ENDPOINT_B", "https://ecs-b.us-west-2.amazonaws.com")()
+	defer setTestEnv("ECS_ACS_SPLIT_TEST_MATCH_WINDOW", "30s")()
+	defer setTestEnv("ECS_ACS_MEMORY_PRESSURE_THRESHOLD", "512")()
+	defer setTestEnv("ECS_ACS_TASK_TMPFS_DIR", "/var/lib/ecs/tmpfs")()
+	defer setTestEnv("ECS_ACS_OPERATOR_ALERTS_SNS_TOPIC_ARN", "arn:aws:sns:us-west-2:123456789012:ecs-alerts")()
+	defer setTestEnv("ECS_ACS_SECRETS_PREWARM", "true")()
+	defer setTestEnv("ECS_ACS_CLOCK_SYNC_CHECK", "true")()
+	defer setTestEnv("ECS_ACS_NTP_SERVER", "10.0.0.1:123")()
+	defer setTestEnv("ECS_ACS_CLOCK_SKEW_THRESHOLD", "1m")()
+	defer setTestEnv("ECS_ACS_FLUSH_DNS_ON_RECONNECT", "true")()
+	defer setTestEnv("ECS_ACS_DEREGISTRATION_GRACE_PERIOD", "10m")()
+	defer setTestEnv("ECS_EBS_MOUNT_RETRIES", "3")()
+	defer setTestEnv("ECS_ACS_VERIFY_MANIFEST_SIGNATURE", "true")()
+	defer setTestEnv("ECS_ACS_MANIFEST_SIGNING_KEY_SECRET_ID", "ecs/manifest-signing-key")()
+	defer setTestEnv("ECS_ACS_BACKUP_ENDPOINT", "https://ecs-a-1.us-east-1.amazonaws.com")()
+	defer setTestEnv("ECS_ACS_BACKUP_REGION", "us-east-1")()
+	defer setTestEnv("ECS_ACS_PRIMARY_FAILOVER_THRESHOLD", "5")()
+	defer setTestEnv("ECS_ACS_PRIMARY_RECOVERY_INTERVAL", "15m")()
+	defer setTestEnv("ECS_ACS_PRE_PULL_IMAGES", "true")()
+	defer setTestEnv("ECS_ACS_PRE_PULL_CONCURRENCY", "4")()
+	defer setTestEnv("ECS_ACS_AVAILABILITY_ZONE_AFFINITY", "true")()
+	defer setTestEnv("ECS_ACS_MAX_HANDLER_GOROUTINES", "50")()
+	defer setTestEnv("ECS_ACS_INJECT_INSTANCE_ENV_VARS", "true")()
+	defer setTestEnv("ECS_ACS_INSTANCE_ENV_VAR_DENY_LIST", "ECS_INSTANCE_ID, ECS_INSTANCE_TYPE,")()
+	defer setTestEnv("ECS_ACS_MAX_RECONNECT_INTERVAL", "30m")()
+	defer setTestEnv("ECS_ACS_MAX_RTT", "500ms")()
 	additionalLocalRoutesJSON := `["1.2.3.4/22","5.6.7.8/32"]`
 	setTestEnv("ECS_AWSVPC_ADDITIONAL_LOCAL_ROUTES", additionalLocalRoutesJSON)
 	setTestEnv("ECS_ENABLE_CONTAINER_METADATA", "true")
@@ -219,6 +297,84 @@ func TestEnvironmentConfig(t *testing.T) {
 	assert.True(t, conf.EnableRuntimeStats.Enabled(), "Wrong value for EnableRuntimeStats")
 	assert.True(t, conf.ShouldExcludeIPv6PortBinding.Enabled(), "Wrong value for ShouldExcludeIPv6PortBinding")
 	assert.False(t, conf.WarmPoolsSupport.Enabled(), "Wrong value for WarmPoolsSupport")
+	assert.Equal(t, 10, conf.ACSTaskGroupMaxConcurrentStarts)
+	assert.Equal(t, 50, conf.ACSLaunchSuccessRateWindowSize)
+	assert.Equal(t, 0.8, conf.ACSMinLaunchSuccessRate)
+	assert.True(t, conf.ACSReconnectOnLowLaunchSuccessRate.Enabled(), "Wrong value for ACSReconnectOnLowLaunchSuccessRate")
+	assert.Equal(t, 3, conf.ACSPriorityMessageThreshold)
+	assert.Equal(t, IPVersionIPv6, conf.ACSIPVersion)
+	assert.Equal(t, "/sys/fs/cgroup/ecs-agent/acs", conf.ACSHandlerCgroupPath)
+	assert.True(t, conf.ACSHandlerNetworkNamespace)
+	assert.Equal(t, 20, conf.ACSPayloadBufferMin)
+	assert.Equal(t, 200, conf.ACSPayloadBufferMax)
+	assert.Equal(t, "shard-1.ecs.us-west-2.amazonaws.com", conf.ACSEndpointSNI)
+	assert.Equal(t, time.Hour, conf.ACSMaxPayloadMessageAge)
+	assert.Equal(t, 30*time.Minute, conf.CompletedTaskHistoryTTL)
+	assert.Equal(t, 10*time.Minute, conf.ACSStateSyncInterval)
+	assert.Equal(t, 5, conf.ACSEndpointRotationThreshold)
+	assert.True(t, conf.StrictDecodeMode)
+	assert.Equal(t, "https://sqs.us-west-2.amazonaws.com/123456789012/acs", conf.ACSQueueURL)
+	assert.Equal(t, time.Minute, conf.DockerHealthCheckInterval)
+	assert.Equal(t, 5, conf.DockerHealthFailureThreshold)
+	assert.Equal(t, 20, conf.ACSBatchSubmitRatePerSecond)
+	assert.True(t, conf.ACSPropagateTaskTags)
+	assert.Equal(t, 10*time.Minute, conf.ACSTagCacheTTL)
+	assert.Equal(t, "/etc/ecs/aws-certificate.pem", conf.InstanceIdentityCertificatePath)
+	assert.Equal(t, 5*time.Minute, conf.EBSVolumeAttachTimeout)
+	assert.Equal(t, 50*time.Millisecond, conf.ACSAckBatchWindow)
+	assert.Equal(t, 20, conf.ACSSessionCacheSize)
+	assert.True(t, conf.ACSHeartbeatHostMetrics)
+	assert.Equal(t, 30, conf.ACSMaxConnectsPerMinute)
+	assert.Equal(t, 1024, conf.DataCompressionThreshold)
+	assert.True(t, conf.ACSAdvertiseWasm)
+	assert.Equal(t, map[string]int{"AckBatching": 25}, conf.ACSFeatureRollout)
+	assert.Equal(t, 10, conf.ACSManifestHistoryDepth)
+	assert.True(t, conf.PiggybackHeartbeat)
+	assert.True(t, conf.ACSConnectionFingerprintLogging)
+	assert.Equal(t, 30*time.Second, conf.ACSHandlerStopTimeout)
+	assert.Equal(t, 24*time.Hour, conf.ACSIdempotencyTokenTTL)
+	assert.True(t, conf.ACSRelayTaskEngineEvents)
+	assert.Equal(t, 5, conf.ACSEventRelayMaxRate)
+	assert.Equal(t, 30*time.Second, conf.ACSGetInstanceStateTimeout)
+	assert.Equal(t, 3, conf.ACSReconnectStaggerSlot)
+	assert.Equal(t, 2*time.Second, conf.ACSReconnectStaggerInterval)
+	assert.True(t, conf.ACSIAMPrecheck)
+	assert.Equal(t, 5*time.Minute, conf.IAMCheckCacheTTL)
+	assert.Equal(t, "/etc/ecs/acs-intermediates.pem", conf.ACSPinnedCAPath)
+	assert.True(t, conf.ACSBypassCertPin)
+	assert.Equal(t, "/var/log/ecs/acs-trace.jsonl", conf.ACSMessageTraceFile)
+	assert.Equal(t, 10, conf.ACSMessageTraceMaxSizeMB)
+	assert.Equal(t, 256, conf.ACSMessageTraceMinFreeMB)
+	assert.Equal(t, "0-3,8", conf.ACSProcessorAffinity)
+	assert.True(t, conf.ACSAuthChallengeRequired)
+	assert.True(t, conf.ACSSplitTestSession)
+	assert.Equal(t, "https://ecs-a.us-west-2.amazonaws.com", conf.ACSEndpointA)
+	assert.Equal(t, "https://ecs-b.us-west-2.amazonaws.com", conf.ACSEndpointB)
+	assert.Equal(t, 30*time.Second, conf.ACSSplitTestMatchWindow)
+	assert.Equal(t, 512, conf.ACSMemoryPressureThreshold)
+	assert.Equal(t, "/var/lib/ecs/tmpfs", conf.ACSTaskTmpfsDir)
+	assert.Equal(t, "arn:aws:sns:us-west-2:123456789012:ecs-alerts", conf.ACSOperatorAlertsSNSTopicARN)
+	assert.True(t, conf.ACSSecretsPrewarm)
+	assert.True(t, conf.ACSClockSyncCheck)
+	assert.Equal(t, "10.0.0.1:123", conf.ACSNTPServer)
+	assert.Equal(t, time.Minute, conf.ACSClockSkewThreshold)
+	assert.True(t, conf.ACSFlushDNSOnReconnect)
+	assert.Equal(t, 10*time.Minute, conf.ACSDeregistrationGracePeriod)
+	assert.Equal(t, 3, conf.EBSMountRetries)
+	assert.True(t, conf.ACSVerifyManifestSignature)
+	assert.Equal(t, "ecs/manifest-signing-key", conf.ACSManifestSigningKeySecretID)
+	assert.Equal(t, "https://ecs-a-1.us-east-1.amazonaws.com", conf.ACSBackupEndpoint)
+	assert.Equal(t, "us-east-1", conf.ACSBackupRegion)
+	assert.Equal(t, 5, conf.ACSPrimaryFailoverThreshold)
+	assert.Equal(t, 15*time.Minute, conf.ACSPrimaryRecoveryInterval)
+	assert.True(t, conf.ACSPrePullImages)
+	assert.Equal(t, 4, conf.ACSPrePullConcurrency)
+	assert.True(t, conf.ACSAvailabilityZoneAffinity)
+	assert.Equal(t, 50, conf.ACSMaxHandlerGoroutines)
+	assert.True(t, conf.ACSInjectInstanceEnvVars)
+	assert.Equal(t, []string{"ECS_INSTANCE_ID", "ECS_INSTANCE_TYPE"}, conf.ACSInstanceEnvVarDenyList)
+	assert.Equal(t, 30*time.Minute, conf.ACSMaxReconnectInterval)
+	assert.Equal(t, 500*time.Millisecond, conf.ACSMaxRTT)
 }
 
 func TestTrimWhitespaceWhenCreating(t *testing.T) {
@@ -277,6 +433,21 @@ func TestBadTagsSerialization(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestBadACSFeatureRolloutSerialization(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_FEATURE_ROLLOUT", "This is not valid JSON")()
+	_, err := environmentConfig()
+	assert.Error(t, err)
+}
+
+func TestOutOfRangeACSFeatureRollout(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_FEATURE_ROLLOUT", "{\"AckBatching\": 101, \"HeartbeatHostMetrics\": 50}")()
+	conf, err := environmentConfig()
+	assert.Error(t, err)
+	assert.Equal(t, map[string]int{"HeartbeatHostMetrics": 50}, conf.ACSFeatureRollout)
+}
+
 func TestInvalidLoggingDriver(t *testing.T) {
 	conf := DefaultConfig()
 	conf.AWSRegion = "us-west-2"
@@ -487,6 +658,34 @@ func TestValidForImagesCleanupExclusion(t *testing.T) {
 	assert.Equal(t, expectedImages, imagesNotDelete, "unexpected imageCleanupExclusionList")
 }
 
+func TestInvalidFormatParseEnvVariableInt(t *testing.T) {
+	defer setTestRegion()()
+	setTestEnv("FOO", "foo")
+	var1 := parseEnvVariableInt("FOO")
+	assert.Zero(t, var1, "Expected 0 from parseEnvVariableInt for invalid format")
+}
+
+func TestValidFormatParseEnvVariableInt(t *testing.T) {
+	defer setTestRegion()()
+	setTestEnv("FOO", "-7")
+	var1 := parseEnvVariableInt("FOO")
+	assert.Equal(t, -7, var1, "Unexpected value parsed in parseEnvVariableInt.")
+}
+
+func TestInvalidFormatParseEnvVariableFloat64(t *testing.T) {
+	defer setTestRegion()()
+	setTestEnv("FOO", "foo")
+	var1 := parseEnvVariableFloat64("FOO")
+	assert.Zero(t, var1, "Expected 0 from parseEnvVariableFloat64 for invalid format")
+}
+
+func TestValidFormatParseEnvVariableFloat64(t *testing.T) {
+	defer setTestRegion()()
+	setTestEnv("FOO", "0.25")
+	var1 := parseEnvVariableFloat64("FOO")
+	assert.Equal(t, 0.25, var1, "Unexpected value parsed in parseEnvVariableFloat64.")
+}
+
 func TestValidFormatParseEnvVariableDuration(t *testing.T) {
 	defer setTestRegion()()
 	setTestEnv("FOO", "1s")
@@ -588,6 +787,417 @@ func TestImageCleanupMinimumNumImagesToDeletePerCycle(t *testing.T) {
 	assert.Equal(t, DefaultNumImagesToDeletePerCycle, cfg.NumImagesToDeletePerCycle, "Wrong value for NumImagesToDeletePerCycle")
 }
 
+func TestInvalidACSTaskGroupMaxConcurrentStartsOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_TASK_GROUP_MAX_CONCURRENT_STARTS", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSTaskGroupMaxConcurrentStarts, cfg.ACSTaskGroupMaxConcurrentStarts, "Wrong value for ACSTaskGroupMaxConcurrentStarts")
+}
+
+func TestInvalidACSLaunchSuccessRateWindowSizeOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_LAUNCH_SUCCESS_RATE_WINDOW_SIZE", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSLaunchSuccessRateWindowSize, cfg.ACSLaunchSuccessRateWindowSize, "Wrong value for ACSLaunchSuccessRateWindowSize")
+}
+
+func TestInvalidACSMinLaunchSuccessRateOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MIN_LAUNCH_SUCCESS_RATE", "1.5")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSMinLaunchSuccessRate, cfg.ACSMinLaunchSuccessRate, "Wrong value for ACSMinLaunchSuccessRate")
+}
+
+func TestInvalidACSPriorityMessageThresholdOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_PRIORITY_MESSAGE_THRESHOLD", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSPriorityMessageThreshold, cfg.ACSPriorityMessageThreshold, "Wrong value for ACSPriorityMessageThreshold")
+}
+
+func TestInvalidACSIPVersionOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_IP_VERSION", "ipv5")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, IPVersionAuto, cfg.ACSIPVersion, "Wrong value for ACSIPVersion")
+}
+
+func TestInvalidACSPayloadBufferBoundsOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_PAYLOAD_BUFFER_MIN", "-1")()
+	defer setTestEnv("ECS_ACS_PAYLOAD_BUFFER_MAX", "5")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSPayloadBufferMin, cfg.ACSPayloadBufferMin, "Wrong value for ACSPayloadBufferMin")
+	assert.Equal(t, DefaultACSPayloadBufferMin, cfg.ACSPayloadBufferMax, "Wrong value for ACSPayloadBufferMax")
+}
+
+func TestInvalidACSMaxPayloadMessageAgeOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MAX_PAYLOAD_MESSAGE_AGE", "-1h")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSMaxPayloadMessageAge, cfg.ACSMaxPayloadMessageAge, "Wrong value for ACSMaxPayloadMessageAge")
+}
+
+func TestInvalidCompletedTaskHistoryTTLOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_COMPLETED_TASK_HISTORY_TTL", "-1h")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultCompletedTaskHistoryTTL, cfg.CompletedTaskHistoryTTL, "Wrong value for CompletedTaskHistoryTTL")
+}
+
+func TestInvalidACSStateSyncIntervalOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_STATE_SYNC_INTERVAL", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSStateSyncInterval, cfg.ACSStateSyncInterval, "Wrong value for ACSStateSyncInterval")
+}
+
+func TestZeroACSStateSyncIntervalDisablesStateReports(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_STATE_SYNC_INTERVAL", "0s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.ACSStateSyncInterval, "Wrong value for ACSStateSyncInterval")
+}
+
+func TestInvalidACSEndpointRotationThresholdOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_ENDPOINT_ROTATION_THRESHOLD", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSEndpointRotationThreshold, cfg.ACSEndpointRotationThreshold, "Wrong value for ACSEndpointRotationThreshold")
+}
+
+func TestInvalidDockerHealthCheckIntervalOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_DOCKER_HEALTH_CHECK_INTERVAL", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDockerHealthCheckInterval, cfg.DockerHealthCheckInterval, "Wrong value for DockerHealthCheckInterval")
+}
+
+func TestInvalidDockerHealthFailureThresholdOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_DOCKER_HEALTH_FAILURE_THRESHOLD", "0")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDockerHealthFailureThreshold, cfg.DockerHealthFailureThreshold, "Wrong value for DockerHealthFailureThreshold")
+}
+
+func TestInvalidACSBatchSubmitRatePerSecondOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_BATCH_SUBMIT_RATE_PER_SECOND", "0")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSBatchSubmitRatePerSecond, cfg.ACSBatchSubmitRatePerSecond, "Wrong value for ACSBatchSubmitRatePerSecond")
+}
+
+func TestInvalidACSTagCacheTTLOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_TAG_CACHE_TTL", "-1m")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSTagCacheTTL, cfg.ACSTagCacheTTL, "Wrong value for ACSTagCacheTTL")
+}
+
+func TestInvalidEBSVolumeAttachTimeoutOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_EBS_VOLUME_ATTACH_TIMEOUT", "-1m")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultEBSVolumeAttachTimeout, cfg.EBSVolumeAttachTimeout, "Wrong value for EBSVolumeAttachTimeout")
+}
+
+func TestInvalidACSAckBatchWindowOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_ACK_BATCH_WINDOW", "-1ms")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSAckBatchWindow, cfg.ACSAckBatchWindow, "Wrong value for ACSAckBatchWindow")
+}
+
+func TestZeroACSAckBatchWindowDisablesAckBatching(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_ACK_BATCH_WINDOW", "0s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.ACSAckBatchWindow, "Wrong value for ACSAckBatchWindow")
+}
+
+func TestInvalidACSSessionCacheSizeOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_SESSION_CACHE_SIZE", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSSessionCacheSize, cfg.ACSSessionCacheSize, "Wrong value for ACSSessionCacheSize")
+}
+
+func TestInvalidACSMaxConnectsPerMinuteOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MAX_CONNECTS_PER_MINUTE", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSMaxConnectsPerMinute, cfg.ACSMaxConnectsPerMinute, "Wrong value for ACSMaxConnectsPerMinute")
+}
+
+func TestInvalidDataCompressionThresholdOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_DATA_COMPRESSION_THRESHOLD", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDataCompressionThreshold, cfg.DataCompressionThreshold, "Wrong value for DataCompressionThreshold")
+}
+
+func TestZeroDataCompressionThresholdDisablesCompression(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_DATA_COMPRESSION_THRESHOLD", "0")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.DataCompressionThreshold, "Wrong value for DataCompressionThreshold")
+}
+
+func TestInvalidACSManifestHistoryDepthOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MANIFEST_HISTORY_DEPTH", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSManifestHistoryDepth, cfg.ACSManifestHistoryDepth, "Wrong value for ACSManifestHistoryDepth")
+}
+
+func TestInvalidACSHandlerStopTimeoutOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_HANDLER_STOP_TIMEOUT", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSHandlerStopTimeout, cfg.ACSHandlerStopTimeout, "Wrong value for ACSHandlerStopTimeout")
+}
+
+func TestInvalidACSIdempotencyTokenTTLOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_IDEMPOTENCY_TOKEN_TTL", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSIdempotencyTokenTTL, cfg.ACSIdempotencyTokenTTL, "Wrong value for ACSIdempotencyTokenTTL")
+}
+
+func TestInvalidACSEventRelayMaxRateOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_EVENT_RELAY_MAX_RATE", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSEventRelayMaxRate, cfg.ACSEventRelayMaxRate, "Wrong value for ACSEventRelayMaxRate")
+}
+
+func TestInvalidACSGetInstanceStateTimeoutOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_GET_INSTANCE_STATE_TIMEOUT", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSGetInstanceStateTimeout, cfg.ACSGetInstanceStateTimeout, "Wrong value for ACSGetInstanceStateTimeout")
+}
+
+func TestInvalidACSReconnectStaggerSlotOverridesToFirstSlot(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_RECONNECT_STAGGER_SLOT", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cfg.ACSReconnectStaggerSlot, "Wrong value for ACSReconnectStaggerSlot")
+}
+
+func TestInvalidACSReconnectStaggerIntervalOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_RECONNECT_STAGGER_INTERVAL", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSReconnectStaggerInterval, cfg.ACSReconnectStaggerInterval, "Wrong value for ACSReconnectStaggerInterval")
+}
+
+func TestInvalidIAMCheckCacheTTLOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_IAM_CHECK_CACHE_TTL", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultIAMCheckCacheTTL, cfg.IAMCheckCacheTTL, "Wrong value for IAMCheckCacheTTL")
+}
+
+func TestInvalidACSMessageTraceMaxSizeMBOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MESSAGE_TRACE_MAX_SIZE_MB", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSMessageTraceMaxSizeMB, cfg.ACSMessageTraceMaxSizeMB, "Wrong value for ACSMessageTraceMaxSizeMB")
+}
+
+func TestInvalidACSMessageTraceMinFreeMBOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MESSAGE_TRACE_MIN_FREE_MB", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSMessageTraceMinFreeMB, cfg.ACSMessageTraceMinFreeMB, "Wrong value for ACSMessageTraceMinFreeMB")
+}
+
+func TestInvalidACSSplitTestMatchWindowOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_SPLIT_TEST_MATCH_WINDOW", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSSplitTestMatchWindow, cfg.ACSSplitTestMatchWindow, "Wrong value for ACSSplitTestMatchWindow")
+}
+
+func TestACSSplitTestSessionWithoutEndpointBIsDisabled(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_SPLIT_TEST_SESSION", "true")()
+	defer setTestEnv("ECS_ACS_ENDPOINT_A", "https://ecs-a.us-west-2.amazonaws.com")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.ACSSplitTestSession, "Split testing should be disabled without endpoint B")
+}
+
+func TestInvalidACSMemoryPressureThresholdOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MEMORY_PRESSURE_THRESHOLD", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSMemoryPressureThreshold, cfg.ACSMemoryPressureThreshold, "Wrong value for ACSMemoryPressureThreshold")
+}
+
+func TestZeroACSMemoryPressureThresholdDisablesMonitor(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MEMORY_PRESSURE_THRESHOLD", "0")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.ACSMemoryPressureMonitorEnabled.Enabled(), "Memory pressure monitor should be disabled")
+}
+
+func TestACSMemoryPressureMonitorDisabled(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MEMORY_PRESSURE_MONITOR_ENABLED", "false")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.False(t, cfg.ACSMemoryPressureMonitorEnabled.Enabled(), "Memory pressure monitor should be disabled")
+	assert.Equal(t, DefaultACSMemoryPressureThreshold, cfg.ACSMemoryPressureThreshold, "Wrong value for ACSMemoryPressureThreshold")
+}
+
+func TestRelativeACSHandlerCgroupPathIsIgnored(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_HANDLER_CGROUP_PATH", "ecs-agent/acs")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.ACSHandlerCgroupPath, "Wrong value for ACSHandlerCgroupPath")
+}
+
+func TestInvalidACSClockSkewThresholdOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_CLOCK_SKEW_THRESHOLD", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSClockSkewThreshold, cfg.ACSClockSkewThreshold, "Wrong value for ACSClockSkewThreshold")
+}
+
+func TestInvalidACSDeregistrationGracePeriodOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_DEREGISTRATION_GRACE_PERIOD", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSDeregistrationGracePeriod, cfg.ACSDeregistrationGracePeriod, "Wrong value for ACSDeregistrationGracePeriod")
+}
+
+func TestZeroACSDeregistrationGracePeriodDisablesGracePeriod(t *testing.T) {
+	for _, period := range []string{"0", "0s"} {
+		t.Run(period, func(t *testing.T) {
+			defer setTestRegion()()
+			defer setTestEnv("ECS_ACS_DEREGISTRATION_GRACE_PERIOD", period)()
+			cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+			assert.NoError(t, err)
+			assert.False(t, cfg.ACSDeregistrationGracePeriodEnabled.Enabled(), "Deregistration grace period should be disabled")
+			assert.Zero(t, cfg.ACSDeregistrationGracePeriod, "Wrong value for ACSDeregistrationGracePeriod")
+		})
+	}
+}
+
+func TestACSDeregistrationGracePeriodDisabled(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_DEREGISTRATION_GRACE_PERIOD_ENABLED", "false")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.ACSDeregistrationGracePeriod, "Wrong value for ACSDeregistrationGracePeriod")
+}
+
+func TestInvalidACSPrimaryFailoverThresholdOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_PRIMARY_FAILOVER_THRESHOLD", "0")()
+	defer setTestEnv("ECS_ACS_PRIMARY_RECOVERY_INTERVAL", "-1m")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSPrimaryFailoverThreshold, cfg.ACSPrimaryFailoverThreshold, "Wrong value for ACSPrimaryFailoverThreshold")
+	assert.Equal(t, DefaultACSPrimaryRecoveryInterval, cfg.ACSPrimaryRecoveryInterval, "Wrong value for ACSPrimaryRecoveryInterval")
+}
+
+func TestInvalidACSPrePullConcurrencyOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_PRE_PULL_CONCURRENCY", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSPrePullConcurrency, cfg.ACSPrePullConcurrency, "Wrong value for ACSPrePullConcurrency")
+}
+
+func TestInvalidACSMaxHandlerGoroutinesOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MAX_HANDLER_GOROUTINES", "0")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSMaxHandlerGoroutines, cfg.ACSMaxHandlerGoroutines, "Wrong value for ACSMaxHandlerGoroutines")
+}
+
+func TestNegativeACSMaxReconnectIntervalIsIgnored(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MAX_RECONNECT_INTERVAL", "-1m")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.ACSMaxReconnectInterval, "Wrong value for ACSMaxReconnectInterval")
+}
+
+func TestInvalidACSMaxRTTOverridesToDefault(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_MAX_RTT", "-1s")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultACSMaxRTT, cfg.ACSMaxRTT, "Wrong value for ACSMaxRTT")
+}
+
+func TestACSBackupEndpointWithoutRegionIsIgnored(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_BACKUP_ENDPOINT", "https://ecs-a-1.us-east-1.amazonaws.com")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.ACSBackupEndpoint, "Wrong value for ACSBackupEndpoint")
+}
+
+func TestNegativeEBSMountRetriesDisablesVerification(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_EBS_MOUNT_RETRIES", "-1")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Zero(t, cfg.EBSMountRetries, "Wrong value for EBSMountRetries")
+}
+
+func TestRelativeACSTaskTmpfsDirIsIgnored(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ACS_TASK_TMPFS_DIR", "ecs/tmpfs")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.ACSTaskTmpfsDir, "Wrong value for ACSTaskTmpfsDir")
+}
+
 func TestInvalidImagePullBehavior(t *testing.T) {
 	defer setTestRegion()()
 	defer setTestEnv("ECS_IMAGE_PULL_BEHAVIOR", "invalid")()
@@ -612,6 +1222,14 @@ func TestEnableRuntimeStatsConfigEnabled(t *testing.T) {
 	assert.True(t, cfg.EnableRuntimeStats.Enabled(), "Wrong value for EnableRuntimeStats")
 }
 
+func TestEnableACSPauseEndpointsConfigEnabled(t *testing.T) {
+	defer setTestRegion()()
+	defer setTestEnv("ECS_ENABLE_ACS_PAUSE_ENDPOINTS", "true")()
+	cfg, err := NewConfig(ec2.NewBlackholeEC2MetadataClient())
+	assert.NoError(t, err)
+	assert.True(t, cfg.EnableACSPauseEndpoints.Enabled(), "Wrong value for EnableACSPauseEndpoints")
+}
+
 func TestParseImagePullBehavior(t *testing.T) {
 	testcases := []struct {
 		name                      string
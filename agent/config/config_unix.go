@@ -104,7 +104,50 @@ func DefaultConfig() Config {
 		FSxWindowsFileServerCapable:         false,
 		RuntimeStatsLogFile:                 defaultRuntimeStatsLogFile,
 		EnableRuntimeStats:                  BooleanDefaultFalse{Value: NotSet},
+		EnableACSPauseEndpoints:             BooleanDefaultFalse{Value: NotSet},
 		ShouldExcludeIPv6PortBinding:        BooleanDefaultTrue{Value: ExplicitlyEnabled},
+		ACSTaskGroupMaxConcurrentStarts:     DefaultACSTaskGroupMaxConcurrentStarts,
+		ACSLaunchSuccessRateWindowSize:      DefaultACSLaunchSuccessRateWindowSize,
+		ACSMinLaunchSuccessRate:             DefaultACSMinLaunchSuccessRate,
+		ACSReconnectOnLowLaunchSuccessRate:  BooleanDefaultFalse{Value: NotSet},
+		ACSPriorityMessageThreshold:         DefaultACSPriorityMessageThreshold,
+		ACSIPVersion:                        IPVersionAuto,
+		ACSPayloadBufferMin:                 DefaultACSPayloadBufferMin,
+		ACSPayloadBufferMax:                 DefaultACSPayloadBufferMax,
+		ACSMaxPayloadMessageAge:             DefaultACSMaxPayloadMessageAge,
+		CompletedTaskHistoryTTL:             DefaultCompletedTaskHistoryTTL,
+		ACSStateSyncInterval:                DefaultACSStateSyncInterval,
+		ACSEndpointRotationThreshold:        DefaultACSEndpointRotationThreshold,
+		DockerHealthCheckInterval:           DefaultDockerHealthCheckInterval,
+		DockerHealthFailureThreshold:        DefaultDockerHealthFailureThreshold,
+		ACSBatchSubmitRatePerSecond:         DefaultACSBatchSubmitRatePerSecond,
+		ACSTagCacheTTL:                      DefaultACSTagCacheTTL,
+		EBSVolumeAttachTimeout:              DefaultEBSVolumeAttachTimeout,
+		ACSAckBatchWindow:                   DefaultACSAckBatchWindow,
+		ACSSessionCacheSize:                 DefaultACSSessionCacheSize,
+		ACSMaxConnectsPerMinute:             DefaultACSMaxConnectsPerMinute,
+		DataCompressionThreshold:            DefaultDataCompressionThreshold,
+		ACSManifestHistoryDepth:             DefaultACSManifestHistoryDepth,
+		ACSHandlerStopTimeout:               DefaultACSHandlerStopTimeout,
+		ACSIdempotencyTokenTTL:              DefaultACSIdempotencyTokenTTL,
+		ACSEventRelayMaxRate:                DefaultACSEventRelayMaxRate,
+		ACSGetInstanceStateTimeout:          DefaultACSGetInstanceStateTimeout,
+		ACSReconnectStaggerInterval:         DefaultACSReconnectStaggerInterval,
+		IAMCheckCacheTTL:                    DefaultIAMCheckCacheTTL,
+		ACSMessageTraceMaxSizeMB:            DefaultACSMessageTraceMaxSizeMB,
+		ACSMessageTraceMinFreeMB:            DefaultACSMessageTraceMinFreeMB,
+		ACSSplitTestMatchWindow:             DefaultACSSplitTestMatchWindow,
+		ACSMemoryPressureThreshold:          DefaultACSMemoryPressureThreshold,
+		ACSMemoryPressureMonitorEnabled:     BooleanDefaultTrue{Value: NotSet},
+		ACSNTPServer:                        DefaultACSNTPServer,
+		ACSClockSkewThreshold:               DefaultACSClockSkewThreshold,
+		ACSDeregistrationGracePeriod:        DefaultACSDeregistrationGracePeriod,
+		ACSDeregistrationGracePeriodEnabled: BooleanDefaultTrue{Value: NotSet},
+		ACSPrimaryFailoverThreshold:         DefaultACSPrimaryFailoverThreshold,
+		ACSPrimaryRecoveryInterval:          DefaultACSPrimaryRecoveryInterval,
+		ACSPrePullConcurrency:               DefaultACSPrePullConcurrency,
+		ACSMaxHandlerGoroutines:             DefaultACSMaxHandlerGoroutines,
+		ACSMaxRTT:                           DefaultACSMaxRTT,
 	}
 }
 
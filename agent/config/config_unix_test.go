@@ -73,7 +73,78 @@ func TestConfigDefault(t *testing.T) {
 	assert.False(t, cfg.DependentContainersPullUpfront.Enabled(), "Default DependentContainersPullUpfront set incorrectly")
 	assert.False(t, cfg.PollMetrics.Enabled(), "ECS_POLL_METRICS default should be false")
 	assert.False(t, cfg.EnableRuntimeStats.Enabled(), "Default EnableRuntimeStats set incorrectly")
+	assert.False(t, cfg.EnableACSPauseEndpoints.Enabled(), "Default EnableACSPauseEndpoints set incorrectly")
 	assert.True(t, cfg.ShouldExcludeIPv6PortBinding.Enabled(), "Default ShouldExcludeIPv6PortBinding set incorrectly")
+	assert.Equal(t, DefaultACSTaskGroupMaxConcurrentStarts, cfg.ACSTaskGroupMaxConcurrentStarts, "Default ACSTaskGroupMaxConcurrentStarts set incorrectly")
+	assert.Equal(t, DefaultACSLaunchSuccessRateWindowSize, cfg.ACSLaunchSuccessRateWindowSize, "Default ACSLaunchSuccessRateWindowSize set incorrectly")
+	assert.Equal(t, DefaultACSMinLaunchSuccessRate, cfg.ACSMinLaunchSuccessRate, "Default ACSMinLaunchSuccessRate set incorrectly")
+	assert.False(t, cfg.ACSReconnectOnLowLaunchSuccessRate.Enabled(), "Default ACSReconnectOnLowLaunchSuccessRate set incorrectly")
+	assert.Equal(t, DefaultACSPriorityMessageThreshold, cfg.ACSPriorityMessageThreshold, "Default ACSPriorityMessageThreshold set incorrectly")
+	assert.Equal(t, IPVersionAuto, cfg.ACSIPVersion, "Default ACSIPVersion set incorrectly")
+	assert.Equal(t, DefaultACSPayloadBufferMin, cfg.ACSPayloadBufferMin, "Default ACSPayloadBufferMin set incorrectly")
+	assert.Equal(t, DefaultACSPayloadBufferMax, cfg.ACSPayloadBufferMax, "Default ACSPayloadBufferMax set incorrectly")
+	assert.Equal(t, DefaultACSMaxPayloadMessageAge, cfg.ACSMaxPayloadMessageAge, "Default ACSMaxPayloadMessageAge set incorrectly")
+	assert.Equal(t, DefaultCompletedTaskHistoryTTL, cfg.CompletedTaskHistoryTTL, "Default CompletedTaskHistoryTTL set incorrectly")
+	assert.Equal(t, DefaultACSStateSyncInterval, cfg.ACSStateSyncInterval, "Default ACSStateSyncInterval set incorrectly")
+	assert.Equal(t, DefaultACSEndpointRotationThreshold, cfg.ACSEndpointRotationThreshold, "Default ACSEndpointRotationThreshold set incorrectly")
+	assert.False(t, cfg.StrictDecodeMode, "Default StrictDecodeMode set incorrectly")
+	assert.Equal(t, DefaultDockerHealthCheckInterval, cfg.DockerHealthCheckInterval, "Default DockerHealthCheckInterval set incorrectly")
+	assert.Equal(t, DefaultDockerHealthFailureThreshold, cfg.DockerHealthFailureThreshold, "Default DockerHealthFailureThreshold set incorrectly")
+	assert.Equal(t, DefaultACSBatchSubmitRatePerSecond, cfg.ACSBatchSubmitRatePerSecond, "Default ACSBatchSubmitRatePerSecond set incorrectly")
+	assert.False(t, cfg.ACSPropagateTaskTags, "Default ACSPropagateTaskTags set incorrectly")
+	assert.Equal(t, DefaultACSTagCacheTTL, cfg.ACSTagCacheTTL, "Default ACSTagCacheTTL set incorrectly")
+	assert.Equal(t, DefaultEBSVolumeAttachTimeout, cfg.EBSVolumeAttachTimeout, "Default EBSVolumeAttachTimeout set incorrectly")
+	assert.Equal(t, DefaultACSAckBatchWindow, cfg.ACSAckBatchWindow, "Default ACSAckBatchWindow set incorrectly")
+	assert.Equal(t, DefaultACSSessionCacheSize, cfg.ACSSessionCacheSize, "Default ACSSessionCacheSize set incorrectly")
+	assert.False(t, cfg.ACSHeartbeatHostMetrics, "Default ACSHeartbeatHostMetrics set incorrectly")
+	assert.False(t, cfg.ACSHandlerNetworkNamespace, "Default ACSHandlerNetworkNamespace set incorrectly")
+	assert.Equal(t, DefaultACSMaxConnectsPerMinute, cfg.ACSMaxConnectsPerMinute, "Default ACSMaxConnectsPerMinute set incorrectly")
+	assert.Equal(t, DefaultDataCompressionThreshold, cfg.DataCompressionThreshold, "Default DataCompressionThreshold set incorrectly")
+	assert.False(t, cfg.ACSAdvertiseWasm, "Default ACSAdvertiseWasm set incorrectly")
+	assert.Equal(t, DefaultACSManifestHistoryDepth, cfg.ACSManifestHistoryDepth, "Default ACSManifestHistoryDepth set incorrectly")
+	assert.False(t, cfg.PiggybackHeartbeat, "Default PiggybackHeartbeat set incorrectly")
+	assert.False(t, cfg.ACSConnectionFingerprintLogging, "Default ACSConnectionFingerprintLogging set incorrectly")
+	assert.Equal(t, DefaultACSHandlerStopTimeout, cfg.ACSHandlerStopTimeout, "Default ACSHandlerStopTimeout set incorrectly")
+	assert.Equal(t, DefaultACSIdempotencyTokenTTL, cfg.ACSIdempotencyTokenTTL, "Default ACSIdempotencyTokenTTL set incorrectly")
+	assert.False(t, cfg.ACSRelayTaskEngineEvents, "Default ACSRelayTaskEngineEvents set incorrectly")
+	assert.Equal(t, DefaultACSEventRelayMaxRate, cfg.ACSEventRelayMaxRate, "Default ACSEventRelayMaxRate set incorrectly")
+	assert.Equal(t, DefaultACSGetInstanceStateTimeout, cfg.ACSGetInstanceStateTimeout, "Default ACSGetInstanceStateTimeout set incorrectly")
+	assert.Equal(t, 0, cfg.ACSReconnectStaggerSlot, "Default ACSReconnectStaggerSlot set incorrectly")
+	assert.Equal(t, DefaultACSReconnectStaggerInterval, cfg.ACSReconnectStaggerInterval, "Default ACSReconnectStaggerInterval set incorrectly")
+	assert.False(t, cfg.ACSIAMPrecheck, "Default ACSIAMPrecheck set incorrectly")
+	assert.Empty(t, cfg.ACSPinnedCAPath, "Default ACSPinnedCAPath set incorrectly")
+	assert.False(t, cfg.ACSBypassCertPin, "Default ACSBypassCertPin set incorrectly")
+	assert.Empty(t, cfg.ACSMessageTraceFile, "Default ACSMessageTraceFile set incorrectly")
+	assert.Equal(t, DefaultACSMessageTraceMaxSizeMB, cfg.ACSMessageTraceMaxSizeMB, "Default ACSMessageTraceMaxSizeMB set incorrectly")
+	assert.Equal(t, DefaultACSMessageTraceMinFreeMB, cfg.ACSMessageTraceMinFreeMB, "Default ACSMessageTraceMinFreeMB set incorrectly")
+	assert.Empty(t, cfg.ACSProcessorAffinity, "Default ACSProcessorAffinity set incorrectly")
+	assert.False(t, cfg.ACSAuthChallengeRequired, "Default ACSAuthChallengeRequired set incorrectly")
+	assert.False(t, cfg.ACSSplitTestSession, "Default ACSSplitTestSession set incorrectly")
+	assert.Equal(t, DefaultACSSplitTestMatchWindow, cfg.ACSSplitTestMatchWindow, "Default ACSSplitTestMatchWindow set incorrectly")
+	assert.Equal(t, DefaultACSMemoryPressureThreshold, cfg.ACSMemoryPressureThreshold, "Default ACSMemoryPressureThreshold set incorrectly")
+	assert.True(t, cfg.ACSMemoryPressureMonitorEnabled.Enabled(), "Default ACSMemoryPressureMonitorEnabled set incorrectly")
+	assert.Empty(t, cfg.ACSTaskTmpfsDir, "Default ACSTaskTmpfsDir set incorrectly")
+	assert.Empty(t, cfg.ACSOperatorAlertsSNSTopicARN, "Default ACSOperatorAlertsSNSTopicARN set incorrectly")
+	assert.False(t, cfg.ACSSecretsPrewarm, "Default ACSSecretsPrewarm set incorrectly")
+	assert.False(t, cfg.ACSClockSyncCheck, "Default ACSClockSyncCheck set incorrectly")
+	assert.Equal(t, DefaultACSNTPServer, cfg.ACSNTPServer, "Default ACSNTPServer set incorrectly")
+	assert.Equal(t, DefaultACSClockSkewThreshold, cfg.ACSClockSkewThreshold, "Default ACSClockSkewThreshold set incorrectly")
+	assert.False(t, cfg.ACSFlushDNSOnReconnect, "Default ACSFlushDNSOnReconnect set incorrectly")
+	assert.Equal(t, DefaultACSDeregistrationGracePeriod, cfg.ACSDeregistrationGracePeriod, "Default ACSDeregistrationGracePeriod set incorrectly")
+	assert.True(t, cfg.ACSDeregistrationGracePeriodEnabled.Enabled(), "Default ACSDeregistrationGracePeriodEnabled set incorrectly")
+	assert.Equal(t, DefaultACSPrimaryFailoverThreshold, cfg.ACSPrimaryFailoverThreshold, "Default ACSPrimaryFailoverThreshold set incorrectly")
+	assert.Equal(t, DefaultACSPrimaryRecoveryInterval, cfg.ACSPrimaryRecoveryInterval, "Default ACSPrimaryRecoveryInterval set incorrectly")
+	assert.False(t, cfg.ACSPrePullImages, "Default ACSPrePullImages set incorrectly")
+	assert.Equal(t, DefaultACSPrePullConcurrency, cfg.ACSPrePullConcurrency, "Default ACSPrePullConcurrency set incorrectly")
+	assert.False(t, cfg.ACSAvailabilityZoneAffinity, "Default ACSAvailabilityZoneAffinity set incorrectly")
+	assert.Equal(t, DefaultACSMaxHandlerGoroutines, cfg.ACSMaxHandlerGoroutines, "Default ACSMaxHandlerGoroutines set incorrectly")
+	assert.False(t, cfg.ACSInjectInstanceEnvVars, "Default ACSInjectInstanceEnvVars set incorrectly")
+	assert.Empty(t, cfg.ACSInstanceEnvVarDenyList, "Default ACSInstanceEnvVarDenyList set incorrectly")
+	assert.Zero(t, cfg.ACSMaxReconnectInterval, "Default ACSMaxReconnectInterval set incorrectly")
+	assert.Equal(t, DefaultACSMaxRTT, cfg.ACSMaxRTT, "Default ACSMaxRTT set incorrectly")
+	assert.Zero(t, cfg.EBSMountRetries, "Default EBSMountRetries set incorrectly")
+	assert.False(t, cfg.ACSVerifyManifestSignature, "Default ACSVerifyManifestSignature set incorrectly")
+	assert.Equal(t, DefaultIAMCheckCacheTTL, cfg.IAMCheckCacheTTL, "Default IAMCheckCacheTTL set incorrectly")
 }
 
 // TestConfigFromFile tests the configuration can be read from file
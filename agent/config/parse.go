@@ -179,6 +179,18 @@ func parseImagePullBehavior() ImagePullBehaviorType {
 	}
 }
 
+func parseACSIPVersion() string {
+	ipVersion := os.Getenv("ECS_ACS_IP_VERSION")
+	switch ipVersion {
+	case "", IPVersionAuto, IPVersionIPv4, IPVersionIPv6:
+		return ipVersion
+	default:
+		seelog.Warnf("Invalid value for ECS_ACS_IP_VERSION: %s, expected one of %s, %s, %s. The default value will be used.",
+			ipVersion, IPVersionAuto, IPVersionIPv4, IPVersionIPv6)
+		return ""
+	}
+}
+
 func parseInstanceAttributes(errs []error) (map[string]string, []error) {
 	var instanceAttributes map[string]string
 	instanceAttributesEnv := os.Getenv("ECS_INSTANCE_ATTRIBUTES")
@@ -197,6 +209,33 @@ func parseInstanceAttributes(errs []error) (map[string]string, []error) {
 	return instanceAttributes, errs
 }
 
+func parseACSFeatureRollout(errs []error) (map[string]int, []error) {
+	var featureRollout map[string]int
+	featureRolloutEnv := os.Getenv("ECS_ACS_FEATURE_ROLLOUT")
+	if featureRolloutEnv == "" {
+		return featureRollout, errs
+	}
+	err := json.Unmarshal([]byte(featureRolloutEnv), &featureRollout)
+	if err != nil {
+		wrappedErr := fmt.Errorf("Invalid format for ECS_ACS_FEATURE_ROLLOUT. Expected a json hash of percentages: %v", err)
+		seelog.Error(wrappedErr)
+		return nil, append(errs, wrappedErr)
+	}
+	for feature, percentage := range featureRollout {
+		if percentage < 0 || percentage > 100 {
+			wrappedErr := fmt.Errorf("Invalid rollout percentage for ACS feature %s: %d. Expected a value from 0 to 100",
+				feature, percentage)
+			seelog.Error(wrappedErr)
+			errs = append(errs, wrappedErr)
+			delete(featureRollout, feature)
+			continue
+		}
+		seelog.Debugf("Setting rollout of ACS feature %v: %v%%", feature, percentage)
+	}
+
+	return featureRollout, errs
+}
+
 func parseAdditionalLocalRoutes(errs []error) ([]cnitypes.IPNet, []error) {
 	var additionalLocalRoutes []cnitypes.IPNet
 	additionalLocalRoutesEnv := os.Getenv("ECS_AWSVPC_ADDITIONAL_LOCAL_ROUTES")
@@ -253,6 +292,26 @@ func parseBooleanDefaultTrueConfig(envVarName string) BooleanDefaultTrue {
 	return boolDefaultTrueCofig
 }
 
+// parseACSMemoryPressureMonitorEnabled returns whether the available memory of
+// the host is monitored, which is explicitly disabled by a zero threshold
+func parseACSMemoryPressureMonitorEnabled() BooleanDefaultTrue {
+	if strings.TrimSpace(os.Getenv("ECS_ACS_MEMORY_PRESSURE_THRESHOLD")) == "0" {
+		return BooleanDefaultTrue{Value: ExplicitlyDisabled}
+	}
+	return parseBooleanDefaultTrueConfig("ECS_ACS_MEMORY_PRESSURE_MONITOR_ENABLED")
+}
+
+// parseACSDeregistrationGracePeriodEnabled returns whether the deregistration of
+// the container instance is held back, which is explicitly disabled by a zero
+// grace period
+func parseACSDeregistrationGracePeriodEnabled() BooleanDefaultTrue {
+	period := strings.TrimSpace(os.Getenv("ECS_ACS_DEREGISTRATION_GRACE_PERIOD"))
+	if duration, err := time.ParseDuration(period); err == nil && duration == 0 {
+		return BooleanDefaultTrue{Value: ExplicitlyDisabled}
+	}
+	return parseBooleanDefaultTrueConfig("ECS_ACS_DEREGISTRATION_GRACE_PERIOD_ENABLED")
+}
+
 func parseTaskMetadataThrottles() (int, int) {
 	var steadyStateRate, burstRate int
 	rpsLimitEnvVal := os.Getenv("ECS_TASK_METADATA_RPS_LIMIT")
@@ -325,6 +384,32 @@ func parseEnvVariableUint16(envVar string) uint16 {
 	return var16
 }
 
+func parseEnvVariableInt(envVar string) int {
+	envVal := os.Getenv(envVar)
+	var intVal int
+	if envVal != "" {
+		var err error
+		intVal, err = strconv.Atoi(envVal)
+		if err != nil {
+			seelog.Warnf("Invalid format for \""+envVar+"\" environment variable; expected integer. err %v", err)
+		}
+	}
+	return intVal
+}
+
+func parseEnvVariableFloat64(envVar string) float64 {
+	envVal := os.Getenv(envVar)
+	var floatVal float64
+	if envVal != "" {
+		var err error
+		floatVal, err = strconv.ParseFloat(envVal, 64)
+		if err != nil {
+			seelog.Warnf("Invalid format for \""+envVar+"\" environment variable; expected float. err %v", err)
+		}
+	}
+	return floatVal
+}
+
 func parseEnvVariableDuration(envVar string) time.Duration {
 	var duration time.Duration
 	envVal := os.Getenv(envVar)
@@ -353,6 +438,18 @@ func parseImageCleanupExclusionList(envVar string) []string {
 	return imageCleanupExclusionList
 }
 
+// parseEnvVariableStringList parses a comma separated list of values, ignoring
+// the empty ones
+func parseEnvVariableStringList(envVar string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(envVar), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func parseCgroupCPUPeriod() time.Duration {
 	duration := parseEnvVariableDuration("ECS_CGROUP_CPU_PERIOD")
 
@@ -350,6 +350,11 @@ type Config struct {
 	// is set to false and can be overridden by means of the ECS_ENABLE_RUNTIME_STATS environment variable.
 	EnableRuntimeStats BooleanDefaultFalse
 
+	// EnableACSPauseEndpoints specifies if the endpoints pausing and resuming the processing of the ACS payload
+	// messages are served by the agent introspection server. By default, this configuration is set to false and can
+	// be overridden by means of the ECS_ENABLE_ACS_PAUSE_ENDPOINTS environment variable.
+	EnableACSPauseEndpoints BooleanDefaultFalse
+
 	// ShouldExcludeIPv6PortBinding specifies whether agent should exclude IPv6 port bindings reported from docker. This configuration
 	// is set to true by default, and can be overridden by the ECS_EXCLUDE_IPV6_PORTBINDING environment variable. This is a workaround
 	// for docker's bug as detailed in https://github.com/aws/amazon-ecs-agent/issues/2870.
@@ -358,4 +363,372 @@ type Config struct {
 	// WarmPoolsSupport specifies whether the agent should poll IMDS to check the target lifecycle state for a starting
 	// instance
 	WarmPoolsSupport BooleanDefaultFalse
+
+	// ACSTaskGroupMaxConcurrentStarts specifies the maximum number of tasks belonging to the same task group that
+	// the agent will start concurrently when they are received from ACS. Tasks beyond this limit are queued until
+	// earlier tasks of the group are running.
+	ACSTaskGroupMaxConcurrentStarts int
+
+	// ACSLaunchSuccessRateWindowSize specifies the number of most recent task launches over which the success rate
+	// of launching tasks received from ACS is computed.
+	ACSLaunchSuccessRateWindowSize int
+
+	// ACSMinLaunchSuccessRate specifies the task launch success rate, between 0 and 1, below which the agent
+	// considers that it is failing to start tasks received from ACS.
+	ACSMinLaunchSuccessRate float64
+
+	// ACSReconnectOnLowLaunchSuccessRate specifies whether the agent should reconnect to ACS when the task launch
+	// success rate drops below ACSMinLaunchSuccessRate, to signal the issue to ECS.
+	ACSReconnectOnLowLaunchSuccessRate BooleanDefaultFalse
+
+	// ACSPriorityMessageThreshold specifies the priority at and above which messages received from ACS are handled as
+	// soon as they are read, instead of being queued behind other messages. Priorities are: 0 for task payloads, 1 for
+	// ENI attachments, 2 for credentials refreshes and 3 for heartbeats.
+	ACSPriorityMessageThreshold int
+
+	// ACSIPVersion specifies the IP version used to connect to ACS: "ipv4", "ipv6", or "auto" to attempt IPv6 first
+	// and fall back to IPv4 if the IPv6 connection can't be established quickly.
+	ACSIPVersion string
+
+	// ACSHandlerCgroupPath specifies the path of a threaded cgroup v2 cgroup in which the goroutines processing
+	// ACS payloads are run, to isolate the agent overhead from the task containers. It's not set by default.
+	ACSHandlerCgroupPath string
+
+	// ACSHandlerNetworkNamespace specifies whether the connections to ACS are established from a dedicated network
+	// namespace, connected to the host namespace through a veth pair, instead of the host namespace shared with the
+	// containers. The host must forward and masquerade the traffic of the namespace. It's disabled by default.
+	ACSHandlerNetworkNamespace bool
+
+	// ACSPayloadBufferMin specifies the minimum number of payload messages received from ACS that are buffered
+	// while the agent processes earlier messages. The buffer grows when it's consistently almost full and shrinks
+	// back when it's consistently almost empty.
+	ACSPayloadBufferMin int
+
+	// ACSPayloadBufferMax specifies the maximum number of payload messages received from ACS that are buffered
+	// while the agent processes earlier messages.
+	ACSPayloadBufferMax int
+
+	// ACSEndpointSNI specifies the server name sent when connecting to ACS, to select an ACS shard. It allows
+	// multiple agents running on the same host, such as during blue/green updates, to connect to separate shards.
+	// The ACS endpoint host name is used when it's not set.
+	ACSEndpointSNI string
+
+	// ACSMaxPayloadMessageAge specifies how long after being sent by ACS a payload message is still processed.
+	// Older messages, typically received in a burst when reconnecting after being offline for a long time, are
+	// acked without starting or stopping any task.
+	ACSMaxPayloadMessageAge time.Duration
+
+	// CompletedTaskHistoryTTL specifies how long tasks remain queryable through the introspection API after
+	// being cleaned up, when requested with the includeCompleted query parameter.
+	CompletedTaskHistoryTTL time.Duration
+
+	// ACSStateSyncInterval specifies the interval at which the agent reports the state of all its tasks and
+	// containers to ACS, regardless of the state changes submitted in between. It allows ACS to recover from
+	// missed state change events. At most one report is sent per interval. An interval of 0, the default,
+	// disables the reports.
+	ACSStateSyncInterval time.Duration
+
+	// ACSEndpointRotationThreshold specifies the number of consecutive failures to connect to the same ACS
+	// endpoint IP after which the cached ACS endpoint is discarded and a new one is discovered.
+	ACSEndpointRotationThreshold int
+
+	// StrictDecodeMode specifies whether tasks received from ACS with fields that the agent doesn't know about are
+	// rejected. Such tasks are nacked instead of being started with the unknown fields ignored. When disabled, a
+	// warning is logged for the unknown fields and the tasks are processed.
+	StrictDecodeMode bool
+
+	// ACSQueueURL specifies the URL of an SQS queue the messages sent by ACS are fanned out to. When set, the
+	// messages are received from the queue instead of a websocket connection to ACS, for environments where
+	// websocket traffic is blocked.
+	ACSQueueURL string
+
+	// DockerHealthCheckInterval specifies the interval at which the agent checks that the docker daemon responds.
+	DockerHealthCheckInterval time.Duration
+
+	// DockerHealthFailureThreshold specifies the number of consecutive failed docker health checks after which
+	// the docker daemon is considered unhealthy. Tasks received from ACS are queued instead of being added to the
+	// task engine until docker is healthy again.
+	DockerHealthFailureThreshold int
+
+	// ACSBatchSubmitRatePerSecond specifies the maximum number of tasks of a single payload message received from
+	// ACS that are submitted to the task engine per second, so that large payloads don't make docker pull a large
+	// number of images at once. The payload message is acked once all its tasks have been submitted. Submitting
+	// doesn't mean started: a submitted task may still be held back by the docker health check, the memory pressure
+	// gate, its EBS volumes or the task group throttle after the message is acked. The submissions are paced on the
+	// goroutine handling the payload messages, so a payload of N tasks to start delays the handling of the
+	// following messages, including the tasks they stop, by up to N divided by this rate seconds.
+	ACSBatchSubmitRatePerSecond int
+
+	// ACSPropagateTaskTags specifies whether the tags of the tasks received from ACS are added to their containers
+	// as docker labels. Tags not included in the payload message are fetched from the ECS API, which requires the
+	// ecs:ListTagsForResource permission on the instance role. It's disabled by default.
+	ACSPropagateTaskTags bool
+
+	// ACSTagCacheTTL specifies how long the tags of a task fetched from the ECS API, when they are not
+	// included in the payload message received from ACS, are cached before being fetched again. Failures to
+	// fetch the tags are cached as well. It's only used when ACSPropagateTaskTags is enabled.
+	ACSTagCacheTTL time.Duration
+
+	// InstanceIdentityCertificatePath specifies the path to the AWS public certificate of the region, in PEM
+	// format, used to verify the signature of the instance identity document before connecting to ACS. The
+	// agent refuses to connect to ACS if the verification fails. The verification is skipped when unset.
+	InstanceIdentityCertificatePath string
+
+	// EBSVolumeAttachTimeout specifies how long a task with EBS volume attachments waits for the volumes to be
+	// visible on the host before being started. The task is started once the timeout has elapsed even if some
+	// of its volumes are still not visible.
+	EBSVolumeAttachTimeout time.Duration
+
+	// ACSAckBatchWindow specifies how long the acks sent to ACS are accumulated before being written to the
+	// websocket connection. Acks sent within the same window are written as a single frame holding a JSON array
+	// of the acks, a single ack is written in its own frame as usual. A window of 0, the default, disables ack
+	// batching.
+	ACSAckBatchWindow time.Duration
+
+	// ACSSessionCacheSize specifies the number of TLS sessions cached to resume them when reconnecting to ACS,
+	// saving a full TLS handshake. Sessions are only resumed when reconnecting to the same endpoint IP.
+	ACSSessionCacheSize int
+
+	// ACSHeartbeatHostMetrics specifies whether the CPU and memory usage of the instance are included in the
+	// acks of the heartbeats received from ACS, so that ACS can take them into account when placing tasks.
+	ACSHeartbeatHostMetrics bool
+
+	// ACSMaxConnectsPerMinute specifies the number of connections to ACS allowed in a minute before the agent is
+	// considered to be stuck in a connect-disconnect loop, in which case it stops connecting for a while.
+	ACSMaxConnectsPerMinute int
+
+	// DataCompressionThreshold specifies the size, in bytes, above which the tasks saved to the data directory
+	// are gzip-compressed, to keep the size of the values stored in the database down. A threshold of 0, the
+	// default, disables compression. Compressed values cannot be read by earlier versions of the agent, so the
+	// data directory must be cleared before downgrading an agent with compression enabled.
+	DataCompressionThreshold int
+
+	// ACSAdvertiseWasm specifies whether the WebAssembly runtime installed on the instance, if any, is advertised
+	// to ACS when connecting, so that ACS can place Wasm tasks on the instance.
+	ACSAdvertiseWasm bool
+
+	// ACSFeatureRollout maps the name of an ACS handler feature to the percentage, from 0 to 100, of container
+	// instances the feature is enabled on. Features that are not listed are enabled on every instance.
+	ACSFeatureRollout map[string]int
+
+	// ACSManifestHistoryDepth specifies the number of the most recent task manifests received from ACS that are
+	// saved to the data directory, to diagnose issues caused by a bad manifest.
+	ACSManifestHistoryDepth int
+
+	// PiggybackHeartbeat specifies whether a heartbeat ack waiting to be sent is included in the next payload ack
+	// instead of being sent in its own message, to reduce the number of messages sent to ACS.
+	PiggybackHeartbeat bool
+
+	// ACSConnectionFingerprintLogging specifies whether the fingerprint of the certificate presented by ACS is
+	// logged on each connection, with a warning when it differs from the one seen on the previous connection.
+	ACSConnectionFingerprintLogging bool
+
+	// ACSHandlerStopTimeout specifies how long the agent waits for each ACS message handler to stop when the ACS
+	// session ends, after which the acks waiting to be sent by the handler are dropped.
+	ACSHandlerStopTimeout time.Duration
+
+	// ACSIdempotencyTokenTTL specifies how long the submission of a task of a payload message is remembered, so that
+	// the task isn't submitted again if ACS resends the message after an agent restart.
+	ACSIdempotencyTokenTTL time.Duration
+
+	// ACSRelayTaskEngineEvents specifies whether task engine events, such as containers starting, stopping or being
+	// killed for running out of memory, are relayed to ACS. Events are not relayed by default since older ACS
+	// endpoints do not accept them.
+	ACSRelayTaskEngineEvents bool
+
+	// ACSEventRelayMaxRate specifies the maximum number of task engine events relayed to ACS per second, when
+	// ACSRelayTaskEngineEvents is enabled.
+	ACSEventRelayMaxRate int
+
+	// ACSGetInstanceStateTimeout specifies the maximum time allowed to take a snapshot of the state of the tasks when
+	// ACS queries it. No response is sent to ACS if the snapshot takes longer.
+	ACSGetInstanceStateTimeout time.Duration
+
+	// ACSReconnectStaggerSlot specifies the index, from 0 to N, of the agent among the agents running on the same
+	// host. The first reconnect to ACS after a disconnection is delayed by (slot+1) * ACSReconnectStaggerInterval,
+	// so that the agents of the host don't all reconnect at the same time after a network blip.
+	ACSReconnectStaggerSlot int
+
+	// ACSReconnectStaggerInterval specifies the interval between the first reconnects to ACS of the agents of
+	// consecutive ACSReconnectStaggerSlot slots after a disconnection.
+	ACSReconnectStaggerInterval time.Duration
+
+	// ACSIAMPrecheck specifies whether the IAM roles of the tasks received from ACS are checked against the
+	// permissions boundary of the instance role before the tasks are started, using the IAM policy simulator. Tasks
+	// with roles exceeding the boundary are rejected. It's disabled by default, as the check adds latency to task
+	// starts and requires IAM read and simulation permissions on the instance role.
+	ACSIAMPrecheck bool
+
+	// IAMCheckCacheTTL specifies how long the result of the check of a task IAM role against the permissions
+	// boundary of the instance role is cached, when ACSIAMPrecheck is enabled.
+	IAMCheckCacheTTL time.Duration
+
+	// ACSPinnedCAPath specifies the path to a file of PEM encoded intermediate CA certificates the certificate chain
+	// of ACS is pinned to. The agent doesn't connect to ACS if none of the certificates of the chain presented by ACS
+	// is one of these intermediates. ACS certificates aren't pinned if empty.
+	ACSPinnedCAPath string
+
+	// ACSBypassCertPin disables the pinning of the ACS certificate chain to the intermediate CAs of ACSPinnedCAPath.
+	// It's meant for testing against ACS endpoints with other certificates.
+	ACSBypassCertPin bool
+
+	// ACSMessageTraceFile specifies the path to a file all the messages exchanged with ACS are written to, as JSON
+	// lines, for debugging. The credentials in the messages are redacted. Messages aren't traced if empty.
+	ACSMessageTraceFile string
+
+	// ACSMessageTraceMaxSizeMB specifies the size in megabytes at which the ACS message trace file is rotated. The
+	// previous trace is kept alongside, with a .1 suffix.
+	ACSMessageTraceMaxSizeMB int
+
+	// ACSMessageTraceMinFreeMB specifies the free disk space in megabytes below which ACS messages stop being written
+	// to the trace file, so that tracing doesn't fill up the disk.
+	ACSMessageTraceMinFreeMB int
+
+	// ACSProcessorAffinity specifies the CPUs the goroutine processing the payload messages of ACS is pinned to, in
+	// the CPU list syntax of cpusets, such as 0-3,8. Pinning the handler to the CPUs of a NUMA node improves its cache
+	// locality on large NUMA hosts. The handler isn't pinned if empty.
+	ACSProcessorAffinity string
+
+	// ACSAuthChallengeRequired specifies whether ACS requires the agent to answer an authentication challenge after
+	// connecting. When enabled, task payloads aren't processed until the challenge of the connection is completed,
+	// and the connection is closed if it isn't completed within a minute.
+	ACSAuthChallengeRequired bool
+
+	// ACSSplitTestSession specifies whether the agent connects to both ACSEndpointA and ACSEndpointB instead of the
+	// discovered ACS endpoint, to verify that a new endpoint delivers the same messages as the old one. The messages
+	// of endpoint A are processed, those of endpoint B are only acked and compared with them.
+	ACSSplitTestSession bool
+
+	// ACSEndpointA specifies the primary ACS endpoint of split test sessions, whose messages are processed.
+	ACSEndpointA string
+
+	// ACSEndpointB specifies the secondary ACS endpoint of split test sessions, whose messages are only acked and
+	// compared with those of ACSEndpointA.
+	ACSEndpointB string
+
+	// ACSSplitTestMatchWindow specifies how long a message received from one endpoint of a split test session waits
+	// for the same message from the other endpoint before it's counted as unmatched.
+	ACSSplitTestMatchWindow time.Duration
+
+	// ACSMemoryPressureThreshold specifies the available memory of the host in megabytes below which the tasks to be
+	// started are held back until enough memory is available again, so that the kernel doesn't kill containers to
+	// start new ones.
+	ACSMemoryPressureThreshold int
+
+	// ACSMemoryPressureMonitorEnabled specifies whether the available memory of the host is monitored against
+	// ACSMemoryPressureThreshold. It's also disabled when ECS_ACS_MEMORY_PRESSURE_THRESHOLD is set to 0, as the zero
+	// threshold would otherwise be overridden by its default value.
+	ACSMemoryPressureMonitorEnabled BooleanDefaultTrue
+
+	// ACSTaskTmpfsDir specifies the host directory under which the tmpfs mounts of the containers of tasks are created
+	// before the tasks are added to the task engine. The containers then use the mounts of their task instead of the
+	// tmpfs mounts created by docker, and the mounts are removed once the task is stopped. Tmpfs mounts are left to
+	// docker if empty.
+	ACSTaskTmpfsDir string
+
+	// ACSOperatorAlertsSNSTopicARN specifies the ARN of the SNS topic the alerts pushed by ACS for the operators of the
+	// instance are published to, such as the end of life of the AMI. The alerts are logged if empty.
+	ACSOperatorAlertsSNSTopicARN string
+
+	// ACSSecretsPrewarm specifies whether the Secrets Manager secrets of the tasks listed in the task manifests are
+	// fetched before the tasks are received, with the credentials of the execution role of the tasks already running
+	// on the instance, so that the containers don't wait for Secrets Manager when they are started.
+	ACSSecretsPrewarm bool
+
+	// ACSClockSyncCheck specifies whether the system clock is compared to the time of ACSNTPServer by the doctor
+	// healthchecks and before connecting to ACS. The check is disabled by default as it queries the NTP server on
+	// every doctor run.
+	ACSClockSyncCheck bool
+
+	// ACSNTPServer specifies the NTP server the system clock is compared to before connecting to ACS, as a host or a
+	// host:port.
+	ACSNTPServer string
+
+	// ACSClockSkewThreshold specifies how far the system clock can be from the time of ACSNTPServer before the agent
+	// warns that the TLS handshakes with ACS may fail. The clock isn't checked when the NTP server doesn't answer, nor
+	// on external instances unless ACSNTPServer is set.
+	ACSClockSkewThreshold time.Duration
+
+	// ACSFlushDNSOnReconnect specifies whether the caches of the OS are flushed before every reconnection to ACS, so
+	// that the agent doesn't keep trying the old IPs of the ACS endpoint once they are rotated.
+	ACSFlushDNSOnReconnect bool
+
+	// ACSDeregistrationGracePeriod specifies how long the agent waits for the tasks running on the container instance
+	// to stop, once ACS reports the instance as deregistered, before notifying the deregistration. New tasks aren't
+	// accepted meanwhile. The deregistration is notified right away if zero.
+	ACSDeregistrationGracePeriod time.Duration
+
+	// ACSDeregistrationGracePeriodEnabled specifies whether the deregistration is held back for
+	// ACSDeregistrationGracePeriod. It's also disabled when ECS_ACS_DEREGISTRATION_GRACE_PERIOD is set to 0, as the
+	// zero grace period would otherwise be overridden by its default value. ACSDeregistrationGracePeriod is set to zero
+	// when disabled.
+	ACSDeregistrationGracePeriodEnabled BooleanDefaultTrue
+
+	// EBSMountRetries specifies how many times the block devices of the host are listed again when the EBS volumes of
+	// a task to be started aren't found in /sys/block. The payload message is nacked if they are still missing, so
+	// that the task is placed elsewhere. The EBS volumes aren't verified if zero.
+	EBSMountRetries int
+
+	// ACSVerifyManifestSignature specifies whether the HMAC-SHA256 signature of the task manifests is verified before
+	// they are applied. Manifests whose signature doesn't match the signing key are neither applied nor acked.
+	ACSVerifyManifestSignature bool
+
+	// ACSManifestSigningKeySecretID specifies the ID or ARN of the Secrets Manager secret holding the key the task
+	// manifests are signed with. The current and the previous versions of the secret are accepted, so that the key can
+	// be rotated. It must be set when ACSVerifyManifestSignature is.
+	ACSManifestSigningKeySecretID string
+
+	// ACSBackupEndpoint specifies the ACS endpoint of the backup region the agent fails over to when it can't connect
+	// to ACS in its own region. There is no failover if it's empty.
+	ACSBackupEndpoint string
+
+	// ACSBackupRegion specifies the region of ACSBackupEndpoint, the requests to the backup endpoint are signed for it.
+	// It must be set when ACSBackupEndpoint is.
+	ACSBackupRegion string
+
+	// ACSPrimaryFailoverThreshold specifies the number of consecutive failures to connect to ACS in the region of the
+	// agent after which the agent fails over to ACSBackupEndpoint.
+	ACSPrimaryFailoverThreshold int
+
+	// ACSPrimaryRecoveryInterval specifies how often the agent checks whether ACS in its own region is reachable again
+	// once it failed over to ACSBackupEndpoint. The agent reverts to its own region as soon as it is.
+	ACSPrimaryRecoveryInterval time.Duration
+
+	// ACSPrePullImages specifies whether the container images of the tasks listed in the task manifests are pulled
+	// before the tasks are received, so that the containers don't wait for the pulls to start. The tasks received
+	// while their images are being pre-pulled wait for the pulls in progress instead of pulling the images again.
+	ACSPrePullImages bool
+
+	// ACSPrePullConcurrency specifies the maximum number of images pulled concurrently ahead of the tasks using them,
+	// so that pre-pulls don't starve the pulls of the tasks being started.
+	ACSPrePullConcurrency int
+
+	// ACSAvailabilityZoneAffinity specifies whether the agent prefers the ACS hosts in the availability zone of the
+	// instance. The ACS endpoint resolves to hosts in several availability zones, the agent connects to the hosts in
+	// its own availability zone first, and to any host if none of them is.
+	ACSAvailabilityZoneAffinity bool
+
+	// ACSMaxHandlerGoroutines specifies the maximum number of goroutines run concurrently by the handlers of ACS
+	// messages, such as the goroutines sending the acks. The goroutines beyond the limit are queued until a slot
+	// frees up, so that bursts of messages don't pile up goroutines faster than they complete.
+	ACSMaxHandlerGoroutines int
+
+	// ACSInjectInstanceEnvVars specifies whether environment variables describing the instance, such as its ID, its
+	// availability zone and its cluster, are added to the containers of the tasks received from ACS. The variables
+	// are named ECS_INSTANCE_*, and don't override the variables of the same name set by the task definitions.
+	ACSInjectInstanceEnvVars bool
+
+	// ACSInstanceEnvVarDenyList lists the names of the instance environment variables that are not added to the
+	// containers when ACSInjectInstanceEnvVars is enabled.
+	ACSInstanceEnvVarDenyList []string
+
+	// ACSMaxReconnectInterval specifies the maximum delay before reconnecting to ACS after a disconnection, whatever
+	// the backoff, jitter and stagger applied to the delay. When unset, the delay is capped at the maximum backoff
+	// after unexpected disconnections, and at one hour when the container instance is inactive.
+	ACSMaxReconnectInterval time.Duration
+
+	// ACSMaxRTT specifies the round-trip latency budget of the connection to ACS, measured from sending an ack to
+	// receiving its echo from ACS. The connection is closed when three consecutive acks exceed it, and the agent
+	// reconnects with the same backoff as after an unexpected disconnection. It only applies when ACS echoes the acks.
+	ACSMaxRTT time.Duration
 }
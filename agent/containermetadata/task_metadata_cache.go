@@ -0,0 +1,169 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package containermetadata
+
+import (
+	"sync"
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+)
+
+const (
+	// stoppedTaskMetadataTTL is the duration for which the metadata of a task
+	// that ACS wants stopped is kept in the cache
+	stoppedTaskMetadataTTL = time.Hour
+	// taskMetadataCachePruneInterval is the minimum interval between two
+	// passes over the cache to remove expired entries
+	taskMetadataCachePruneInterval = time.Minute
+)
+
+// CachedTaskMetadata is a snapshot of the metadata of a task, as received from
+// ACS. Snapshots are never modified once they have been added to the cache
+type CachedTaskMetadata struct {
+	TaskARN string
+	Family  string
+	Version string
+	// DesiredStatus is empty if ACS didn't set the desired status of the task
+	DesiredStatus string
+	// Containers maps the name of each container of the task to its metadata
+	Containers map[string]CachedContainerMetadata
+	// UpdatedAt is the time at which the snapshot was added to the cache
+	UpdatedAt time.Time
+}
+
+// CachedContainerMetadata is a snapshot of the metadata of a container, as
+// received from ACS
+type CachedContainerMetadata struct {
+	Name  string
+	Image string
+	// DesiredStatus is empty if ACS didn't set the desired status of the container
+	DesiredStatus string
+}
+
+// TaskMetadataCache holds the most recent metadata of the tasks received from
+// ACS, keyed by task ARN and container name. The engine state is only updated
+// once the task engine has processed a task, which can lag behind ACS during
+// rapid task churn. The task metadata endpoint fills the fields the engine state
+// hasn't populated yet from this cache. The task engine removes the metadata of
+// the tasks it cleans up
+type TaskMetadataCache struct {
+	lock       sync.RWMutex
+	tasks      map[string]*CachedTaskMetadata
+	lastPruned time.Time
+}
+
+// NewTaskMetadataCache returns a new TaskMetadataCache object
+func NewTaskMetadataCache() *TaskMetadataCache {
+	return &TaskMetadataCache{
+		tasks:      make(map[string]*CachedTaskMetadata),
+		lastPruned: time.Now(),
+	}
+}
+
+// Update replaces the cached metadata of the task with a snapshot of the task.
+// Readers either get the previous snapshot or the new one, never a mix of both
+func (cache *TaskMetadataCache) Update(task *apitask.Task) {
+	if cache == nil || task == nil {
+		return
+	}
+	now := time.Now()
+	snapshot := &CachedTaskMetadata{
+		TaskARN:       task.Arn,
+		Family:        task.Family,
+		Version:       task.Version,
+		DesiredStatus: taskDesiredStatus(task),
+		Containers:    make(map[string]CachedContainerMetadata, len(task.Containers)),
+		UpdatedAt:     now,
+	}
+	for _, container := range task.Containers {
+		snapshot.Containers[container.Name] = CachedContainerMetadata{
+			Name:          container.Name,
+			Image:         container.Image,
+			DesiredStatus: containerDesiredStatus(container),
+		}
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	cache.tasks[task.Arn] = snapshot
+	if now.Sub(cache.lastPruned) >= taskMetadataCachePruneInterval {
+		cache.pruneUnsafe(now)
+	}
+}
+
+// taskDesiredStatus returns the desired status of the task, or an empty string
+// if ACS didn't set it
+func taskDesiredStatus(task *apitask.Task) string {
+	if status := task.GetDesiredStatus(); status != apitaskstatus.TaskStatusNone {
+		return status.String()
+	}
+	return ""
+}
+
+// containerDesiredStatus returns the desired status of the container, or an
+// empty string if ACS didn't set it
+func containerDesiredStatus(container *apicontainer.Container) string {
+	if status := container.GetDesiredStatus(); status != apicontainerstatus.ContainerStatusNone {
+		return status.String()
+	}
+	return ""
+}
+
+// pruneUnsafe removes the metadata of tasks that ACS wanted stopped more than
+// stoppedTaskMetadataTTL ago, which the task engine may never have been handed
+// and so never cleans up. The caller must hold the lock
+func (cache *TaskMetadataCache) pruneUnsafe(now time.Time) {
+	for arn, snapshot := range cache.tasks {
+		if snapshot.DesiredStatus == apitaskstatus.TaskStopped.String() && now.Sub(snapshot.UpdatedAt) >= stoppedTaskMetadataTTL {
+			delete(cache.tasks, arn)
+		}
+	}
+	cache.lastPruned = now
+}
+
+// Task returns the cached metadata of the task
+func (cache *TaskMetadataCache) Task(taskARN string) (*CachedTaskMetadata, bool) {
+	if cache == nil {
+		return nil, false
+	}
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+	snapshot, ok := cache.tasks[taskARN]
+	return snapshot, ok
+}
+
+// Container returns the cached metadata of the container of the task
+func (cache *TaskMetadataCache) Container(taskARN, containerName string) (CachedContainerMetadata, bool) {
+	snapshot, ok := cache.Task(taskARN)
+	if !ok {
+		return CachedContainerMetadata{}, false
+	}
+	container, ok := snapshot.Containers[containerName]
+	return container, ok
+}
+
+// Remove removes the cached metadata of the task, once the task engine has
+// cleaned it up
+func (cache *TaskMetadataCache) Remove(taskARN string) {
+	if cache == nil {
+		return
+	}
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	delete(cache.tasks, taskARN)
+}
@@ -0,0 +1,166 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package containermetadata
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCacheTestTask(version string, desiredStatus apitaskstatus.TaskStatus) *apitask.Task {
+	return &apitask.Task{
+		Arn:                 "t1",
+		Family:              "sleep",
+		Version:             version,
+		DesiredStatusUnsafe: desiredStatus,
+		Containers: []*apicontainer.Container{
+			{
+				Name:                "sleepy",
+				Image:               "busybox:" + version,
+				DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+			},
+			{
+				Name:  "sidecar",
+				Image: "envoy",
+			},
+		},
+	}
+}
+
+func TestTaskMetadataCacheReturnsLatestUpdate(t *testing.T) {
+	cache := NewTaskMetadataCache()
+	_, ok := cache.Task("t1")
+	assert.False(t, ok)
+
+	cache.Update(newCacheTestTask("1", apitaskstatus.TaskRunning))
+	cache.Update(newCacheTestTask("2", apitaskstatus.TaskStopped))
+
+	cached, ok := cache.Task("t1")
+	require.True(t, ok)
+	assert.Equal(t, "sleep", cached.Family)
+	assert.Equal(t, "2", cached.Version)
+	assert.Equal(t, "STOPPED", cached.DesiredStatus)
+
+	container, ok := cache.Container("t1", "sleepy")
+	require.True(t, ok)
+	assert.Equal(t, "busybox:2", container.Image)
+	assert.Equal(t, "RUNNING", container.DesiredStatus)
+
+	container, ok = cache.Container("t1", "sidecar")
+	require.True(t, ok)
+	assert.Empty(t, container.DesiredStatus, "Unset desired status should not be cached")
+
+	_, ok = cache.Container("t1", "missing")
+	assert.False(t, ok)
+	_, ok = cache.Container("t2", "sleepy")
+	assert.False(t, ok)
+
+	cache.Remove("t1")
+	_, ok = cache.Task("t1")
+	assert.False(t, ok)
+}
+
+func TestTaskMetadataCacheSnapshotIsNotModifiedByUpdates(t *testing.T) {
+	cache := NewTaskMetadataCache()
+	task := newCacheTestTask("1", apitaskstatus.TaskRunning)
+	cache.Update(task)
+	snapshot, _ := cache.Task("t1")
+
+	task.SetDesiredStatus(apitaskstatus.TaskStopped)
+	cache.Update(newCacheTestTask("2", apitaskstatus.TaskStopped))
+
+	assert.Equal(t, "1", snapshot.Version)
+	assert.Equal(t, "RUNNING", snapshot.DesiredStatus)
+	assert.Equal(t, "busybox:1", snapshot.Containers["sleepy"].Image)
+}
+
+func TestTaskMetadataCachePrunesStoppedTasks(t *testing.T) {
+	cache := NewTaskMetadataCache()
+	cache.Update(newCacheTestTask("1", apitaskstatus.TaskStopped))
+	running := newCacheTestTask("1", apitaskstatus.TaskRunning)
+	running.Arn = "t2"
+	cache.Update(running)
+
+	// Age the entries and force the next update to prune the cache
+	cache.lock.Lock()
+	for _, snapshot := range cache.tasks {
+		snapshot.UpdatedAt = snapshot.UpdatedAt.Add(-2 * stoppedTaskMetadataTTL)
+	}
+	cache.lastPruned = time.Now().Add(-2 * taskMetadataCachePruneInterval)
+	cache.lock.Unlock()
+
+	other := newCacheTestTask("1", apitaskstatus.TaskRunning)
+	other.Arn = "t3"
+	cache.Update(other)
+
+	_, ok := cache.Task("t1")
+	assert.False(t, ok, "Expired stopped task should have been pruned")
+	_, ok = cache.Task("t2")
+	assert.True(t, ok, "Running task should not be pruned")
+	_, ok = cache.Task("t3")
+	assert.True(t, ok)
+}
+
+func TestTaskMetadataCacheConcurrentUpdates(t *testing.T) {
+	cache := NewTaskMetadataCache()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		version := strconv.Itoa(i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cache.Update(newCacheTestTask(version, apitaskstatus.TaskRunning))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				cached, ok := cache.Task("t1")
+				if !ok {
+					continue
+				}
+				// A snapshot is never a mix of two updates
+				assert.Equal(t, "busybox:"+cached.Version, cached.Containers["sleepy"].Image)
+			}
+		}()
+	}
+	wg.Wait()
+
+	cached, ok := cache.Task("t1")
+	require.True(t, ok)
+	assert.Len(t, cached.Containers, 2)
+}
+
+func TestNilTaskMetadataCache(t *testing.T) {
+	var cache *TaskMetadataCache
+	cache.Update(newCacheTestTask("1", apitaskstatus.TaskRunning))
+	cache.Remove("t1")
+	_, ok := cache.Task("t1")
+	assert.False(t, ok)
+	_, ok = cache.Container("t1", "sleepy")
+	assert.False(t, ok)
+}
@@ -16,10 +16,13 @@ package data
 import (
 	"path/filepath"
 	"sync"
+	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/api/attachment"
 	"github.com/aws/amazon-ecs-agent/agent/api/container"
 	"github.com/aws/amazon-ecs-agent/agent/api/eni"
 	"github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/engine/image"
 
 	bolt "go.etcd.io/bbolt"
@@ -29,11 +32,15 @@ const (
 	dbName = "agent.db"
 	dbMode = 0600
 
-	containersBucketName     = "containers"
-	tasksBucketName          = "tasks"
-	imagesBucketName         = "images"
-	eniAttachmentsBucketName = "eniattachments"
-	metadataBucketName       = "metadata"
+	containersBucketName          = "containers"
+	tasksBucketName               = "tasks"
+	imagesBucketName              = "images"
+	eniAttachmentsBucketName      = "eniattachments"
+	metadataBucketName            = "metadata"
+	resourceAttachmentsBucketName = "resourceattachments"
+	completedTasksBucketName      = "completedtasks"
+	taskManifestsBucketName       = "taskmanifests"
+	taskSubmissionsBucketName     = "tasksubmissions"
 )
 
 var (
@@ -46,6 +53,10 @@ var (
 		tasksBucketName,
 		eniAttachmentsBucketName,
 		metadataBucketName,
+		resourceAttachmentsBucketName,
+		completedTasksBucketName,
+		taskManifestsBucketName,
+		taskSubmissionsBucketName,
 	}
 )
 
@@ -70,6 +81,13 @@ type Client interface {
 	// GetTasks gets the data of all the tasks.
 	GetTasks() ([]*task.Task, error)
 
+	// SaveCompletedTask saves the data of a task that was removed from the agent state.
+	SaveCompletedTask(*task.Task) error
+	// GetCompletedTasks gets the data of all the completed tasks.
+	GetCompletedTasks() ([]*task.Task, error)
+	// PurgeCompletedTasks deletes the data of the completed tasks saved longer than the given duration ago.
+	PurgeCompletedTasks(time.Duration) error
+
 	// SaveImageState saves the data of an image state.
 	SaveImageState(*image.ImageState) error
 	// DeleteImageState deletes the data of an image state.
@@ -84,6 +102,27 @@ type Client interface {
 	// GetENIAttachments gets the data of all the ENI attachment.
 	GetENIAttachments() ([]*eni.ENIAttachment, error)
 
+	// SaveResourceAttachment saves the data of a resource attachment.
+	SaveResourceAttachment(*attachment.ResourceAttachment) error
+	// DeleteResourceAttachment deletes the data of a resource attachment.
+	DeleteResourceAttachment(string) error
+	// GetResourceAttachments gets the data of all the resource attachments.
+	GetResourceAttachments() ([]*attachment.ResourceAttachment, error)
+
+	// SaveTaskManifest saves a task manifest received from ACS, keeping the given number of the most recent ones.
+	SaveTaskManifest(*TaskManifest, int) error
+	// GetManifestHistory gets the most recent task manifests received from ACS, the most recent first.
+	GetManifestHistory() ([]TaskManifest, error)
+
+	// SaveTaskSubmission saves the submission of a task of a payload message to the task engine.
+	SaveTaskSubmission(*TaskSubmission) error
+	// GetTaskSubmission gets the submission of the task with the given ARN of the payload message with the given ID.
+	GetTaskSubmission(string, string) (*TaskSubmission, error)
+	// DeleteTaskSubmission deletes the submission of the task with the given ARN of the payload message with the given ID.
+	DeleteTaskSubmission(string, string) error
+	// PurgeTaskSubmissions deletes the task submissions saved longer than the given duration ago.
+	PurgeTaskSubmissions(time.Duration) error
+
 	// SaveMetadata saves a key value pair of metadata.
 	SaveMetadata(string, string) error
 	// GetMetadata gets the value of a certain kind of metadata.
@@ -96,13 +135,16 @@ type Client interface {
 // client implements the Client interface using boltdb as the backing data store.
 type client struct {
 	db *bolt.DB
+	// compressionThreshold is the size above which the tasks are compressed
+	compressionThreshold int
 }
 
 // New returns a data client that implements the Client interface with boltdb.
-func New(dataDir string) (Client, error) {
+// Tasks whose serialized size exceeds compressionThreshold bytes are compressed.
+func New(dataDir string, compressionThreshold int) (Client, error) {
 	var err error
 	once.Do(func() {
-		dbClient, err = setup(dataDir)
+		dbClient, err = setup(dataDir, compressionThreshold)
 	})
 	if err != nil {
 		return nil, err
@@ -113,11 +155,11 @@ func New(dataDir string) (Client, error) {
 // NewWithSetup returns a data client that implements the Client interface with boltdb.
 // It always runs the db setup. Used for testing.
 func NewWithSetup(dataDir string) (Client, error) {
-	return setup(dataDir)
+	return setup(dataDir, config.DefaultDataCompressionThreshold)
 }
 
 // setup initiates the boltdb client and makes sure the buckets we use are created.
-func setup(dataDir string) (*client, error) {
+func setup(dataDir string, compressionThreshold int) (*client, error) {
 	db, err := bolt.Open(filepath.Join(dataDir, dbName), dbMode, nil)
 	err = db.Update(func(tx *bolt.Tx) error {
 		for _, b := range buckets {
@@ -133,7 +175,8 @@ func setup(dataDir string) (*client, error) {
 		return nil, err
 	}
 	return &client{
-		db: db,
+		db:                   db,
+		compressionThreshold: compressionThreshold,
 	}, nil
 }
 
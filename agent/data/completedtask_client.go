@@ -0,0 +1,94 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"encoding/json"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// completedTask is a task removed from the agent state, along with the time at
+// which it was removed
+type completedTask struct {
+	Task        *apitask.Task
+	CompletedAt time.Time
+}
+
+// SaveCompletedTask saves a task to the completed task bucket.
+func (c *client) SaveCompletedTask(task *apitask.Task) error {
+	id, err := utils.GetTaskID(task.Arn)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate database id")
+	}
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(completedTasksBucketName))
+		return putCompressedObject(b, id, &completedTask{
+			Task:        task,
+			CompletedAt: time.Now(),
+		}, c.compressionThreshold)
+	})
+}
+
+// GetCompletedTasks returns all the tasks in the completed task bucket.
+func (c *client) GetCompletedTasks() ([]*apitask.Task, error) {
+	var tasks []*apitask.Task
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(completedTasksBucketName))
+		return walk(bucket, func(id string, data []byte) error {
+			completed := completedTask{}
+			if err := json.Unmarshal(data, &completed); err != nil {
+				return err
+			}
+			tasks = append(tasks, completed.Task)
+			return nil
+		})
+	})
+	return tasks, err
+}
+
+// PurgeCompletedTasks deletes the tasks saved to the completed task bucket longer
+// than maxAge ago.
+func (c *client) PurgeCompletedTasks(maxAge time.Duration) error {
+	cutoff := time.Now().Add(-maxAge)
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(completedTasksBucketName))
+		var expired []string
+		err := walk(bucket, func(id string, data []byte) error {
+			completed := completedTask{}
+			if err := json.Unmarshal(data, &completed); err != nil {
+				return err
+			}
+			if completed.CompletedAt.Before(cutoff) {
+				expired = append(expired, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Keys can't be deleted while iterating over the bucket with a cursor
+		for _, id := range expired {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,63 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"testing"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManageCompletedTasks(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+	testTask := &apitask.Task{
+		Arn: testTaskArn,
+	}
+
+	require.NoError(t, testClient.SaveCompletedTask(testTask))
+	res, err := testClient.GetCompletedTasks()
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, testTaskArn, res[0].Arn)
+
+	// The task was completed just now, it's kept
+	require.NoError(t, testClient.PurgeCompletedTasks(time.Hour))
+	res, err = testClient.GetCompletedTasks()
+	require.NoError(t, err)
+	assert.Len(t, res, 1)
+
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, testClient.PurgeCompletedTasks(time.Millisecond))
+	res, err = testClient.GetCompletedTasks()
+	require.NoError(t, err)
+	assert.Len(t, res, 0)
+}
+
+func TestSaveCompletedTaskInvalidID(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+
+	testTask := &apitask.Task{
+		Arn: "invalid-arn",
+	}
+	assert.Error(t, testClient.SaveCompletedTask(testTask))
+}
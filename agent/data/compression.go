@@ -0,0 +1,60 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// compressedValuePrefix is the byte prepended to the values compressed before
+// being stored. Values are stored as JSON, which never starts with this byte, so
+// that uncompressed values, including the ones stored by earlier versions of the
+// agent, can still be read as is
+const compressedValuePrefix byte = 0x01
+
+// compressValue gzip-compresses the value and prepends the compressed value prefix
+func compressValue(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(compressedValuePrefix)
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressValue returns the decompressed value if it has the compressed value
+// prefix, or the value as is otherwise
+func decompressValue(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != compressedValuePrefix {
+		return data, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data[1:]))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read compressed value")
+	}
+	defer reader.Close()
+	decompressed, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decompress value")
+	}
+	return decompressed, nil
+}
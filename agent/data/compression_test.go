@@ -0,0 +1,204 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestCompressValue(t *testing.T) {
+	value := []byte(`{"Arn":"` + strings.Repeat("a", 1024) + `"}`)
+
+	compressed, err := compressValue(value)
+	require.NoError(t, err)
+	assert.Equal(t, compressedValuePrefix, compressed[0])
+	assert.True(t, len(compressed) < len(value))
+
+	decompressed, err := decompressValue(compressed)
+	require.NoError(t, err)
+	assert.Equal(t, value, decompressed)
+}
+
+func TestDecompressValueUncompressed(t *testing.T) {
+	value := []byte(`{"Arn":"abc"}`)
+	decompressed, err := decompressValue(value)
+	require.NoError(t, err)
+	assert.Equal(t, value, decompressed)
+}
+
+func TestDecompressValueCorrupted(t *testing.T) {
+	_, err := decompressValue([]byte{compressedValuePrefix, 'n', 'o', 't', 'g', 'z'})
+	assert.Error(t, err)
+}
+
+func TestSaveTaskCompressesLargeTasks(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+	testClient.(*client).compressionThreshold = 512
+
+	largeTask := newTestTaskWithContainers("abc", 20)
+	smallTask := &apitask.Task{Arn: "arn:aws:ecs:us-west-2:1234567890:task/test-cluster/def"}
+	require.NoError(t, testClient.SaveTask(largeTask))
+	require.NoError(t, testClient.SaveTask(smallTask))
+
+	require.NoError(t, testClient.(*client).db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(tasksBucketName))
+		assert.Equal(t, compressedValuePrefix, bucket.Get([]byte("abc"))[0])
+		assert.Equal(t, byte('{'), bucket.Get([]byte("def"))[0])
+		return nil
+	}))
+
+	tasks, err := testClient.GetTasks()
+	require.NoError(t, err)
+	require.Len(t, tasks, 2)
+	assert.Equal(t, largeTask.Arn, tasks[0].Arn)
+	assert.Len(t, tasks[0].Containers, 20)
+	assert.Equal(t, smallTask.Arn, tasks[1].Arn)
+}
+
+func TestSaveCompletedTaskCompressesLargeTasks(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+	testClient.(*client).compressionThreshold = 512
+
+	require.NoError(t, testClient.SaveCompletedTask(newTestTaskWithContainers("abc", 20)))
+	tasks, err := testClient.GetCompletedTasks()
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Len(t, tasks[0].Containers, 20)
+}
+
+func TestSaveTaskCompressionDisabledByDefault(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+
+	require.NoError(t, testClient.SaveTask(newTestTaskWithContainers("abc", 20)))
+	require.NoError(t, testClient.(*client).db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(tasksBucketName))
+		assert.Equal(t, byte('{'), bucket.Get([]byte("abc"))[0])
+		return nil
+	}))
+}
+
+// newTestTaskWithContainers returns a task with the given number of containers
+func newTestTaskWithContainers(id string, containers int) *apitask.Task {
+	task := &apitask.Task{
+		Arn:                 "arn:aws:ecs:us-west-2:1234567890:task/test-cluster/" + id,
+		Family:              "test-family",
+		Version:             "1",
+		DesiredStatusUnsafe: 1,
+	}
+	for i := 0; i < containers; i++ {
+		task.Containers = append(task.Containers, &apicontainer.Container{
+			Name:        fmt.Sprintf("container-%d", i),
+			Image:       "123456789012.dkr.ecr.us-west-2.amazonaws.com/test-image:latest",
+			CPU:         256,
+			Memory:      512,
+			Essential:   true,
+			Environment: map[string]string{"ENVIRONMENT": "production", "LOG_LEVEL": "info"},
+		})
+	}
+	return task
+}
+
+// testTaskManifest returns the serialized state of 1000 tasks
+func testTaskManifest(b *testing.B) []byte {
+	var tasks []*apitask.Task
+	for i := 0; i < 1000; i++ {
+		tasks = append(tasks, newTestTaskWithContainers(fmt.Sprintf("task-%d", i), 2))
+	}
+	manifest, err := json.Marshal(tasks)
+	require.NoError(b, err)
+	return manifest
+}
+
+func BenchmarkCompressTaskManifest(b *testing.B) {
+	manifest := testTaskManifest(b)
+	compressed, err := compressValue(manifest)
+	require.NoError(b, err)
+	b.Logf("Compressed %d bytes to %d bytes (ratio %.1f)", len(manifest), len(compressed),
+		float64(len(manifest))/float64(len(compressed)))
+
+	b.SetBytes(int64(len(manifest)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compressValue(manifest)
+	}
+}
+
+func BenchmarkDecompressTaskManifest(b *testing.B) {
+	compressed, err := compressValue(testTaskManifest(b))
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		decompressValue(compressed)
+	}
+}
+
+// benchmarkGetTasks reads back 1000 saved tasks, all of them compressed or none
+// of them. Saving is not benchmarked as it is dominated by the database syncs
+func benchmarkGetTasks(b *testing.B, compress bool) {
+	testDir, err := ioutil.TempDir("", "agent_data_benchmark")
+	require.NoError(b, err)
+	defer os.RemoveAll(testDir)
+	testClient, err := setup(testDir, config.DefaultDataCompressionThreshold)
+	require.NoError(b, err)
+	defer testClient.Close()
+	testClient.compressionThreshold = 0
+	if compress {
+		testClient.compressionThreshold = 1
+	}
+	require.NoError(b, testClient.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(tasksBucketName))
+		for i := 0; i < 1000; i++ {
+			id := fmt.Sprintf("task-%d", i)
+			err := putCompressedObject(bucket, id, newTestTaskWithContainers(id, 2), testClient.compressionThreshold)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := testClient.GetTasks()
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkGetTasksCompressed(b *testing.B) {
+	benchmarkGetTasks(b, true)
+}
+
+func BenchmarkGetTasksUncompressed(b *testing.B) {
+	benchmarkGetTasks(b, false)
+}
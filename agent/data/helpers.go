@@ -21,12 +21,26 @@ import (
 )
 
 func putObject(bucket *bolt.Bucket, key string, obj interface{}) error {
+	return putCompressedObject(bucket, key, obj, 0)
+}
+
+// putCompressedObject puts the object in the bucket, compressed if its marshaled
+// size exceeds compressionThreshold. Values are never compressed if the
+// threshold is not positive
+func putCompressedObject(bucket *bolt.Bucket, key string, obj interface{}, compressionThreshold int) error {
 	keyBytes := []byte(key)
 	data, err := json.Marshal(obj)
 	if err != nil {
 		return errors.Wrapf(err, "failed to marshal object with key %q", key)
 	}
 
+	if compressionThreshold > 0 && len(data) > compressionThreshold {
+		data, err = compressValue(data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to compress object with key %q", key)
+		}
+	}
+
 	if err := bucket.Put(keyBytes, data); err != nil {
 		return errors.Wrapf(err, "failed to insert object with key %q", key)
 	}
@@ -40,6 +54,10 @@ func getObject(tx *bolt.Tx, bucketName, id string, out interface{}) error {
 	if data == nil {
 		return errors.Errorf("object %s not found in bucket %s", id, bucketName)
 	}
+	data, err := decompressValue(data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read object with key %q", id)
+	}
 
 	if out != nil {
 		if err := json.Unmarshal(data, out); err != nil {
@@ -54,6 +72,10 @@ func walk(bucket *bolt.Bucket, callback func(id string, data []byte) error) erro
 	cursor := bucket.Cursor()
 
 	for id, data := cursor.First(); id != nil; id, data = cursor.Next() {
+		data, err := decompressValue(data)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read object with key %q", string(id))
+		}
 		if err := callback(string(id), data); err != nil {
 			return err
 		}
@@ -24,6 +24,19 @@ const (
 	ContainerInstanceARNKey = "container-instance-arn"
 	EC2InstanceIDKey        = "ec2-instance-id"
 	TaskManifestSeqNumKey   = "task-manifest-seq-num"
+	ACSSessionMigrationKey  = "acs-session-migration"
+	// ContainerInstanceStatusKey is the key of the status of the container
+	// instance last set by ACS
+	ContainerInstanceStatusKey = "container-instance-status"
+	// ContainerInstanceAttributesKey is the key of the container instance
+	// attributes last pushed by ACS
+	ContainerInstanceAttributesKey = "container-instance-attributes"
+	// ACSCertificateFingerprintKey is the key of the fingerprint of the
+	// certificate presented by ACS on the last connection
+	ACSCertificateFingerprintKey = "acs-certificate-fingerprint"
+	// ACSProtocolVersionKey is the key of the version of the ACS protocol of
+	// the last successful connection to ACS
+	ACSProtocolVersionKey = "acs-protocol-version"
 )
 
 func (c *client) SaveMetadata(key, val string) error {
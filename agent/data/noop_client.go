@@ -14,10 +14,15 @@
 package data
 
 import (
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api/attachment"
 	"github.com/aws/amazon-ecs-agent/agent/api/container"
 	"github.com/aws/amazon-ecs-agent/agent/api/eni"
 	"github.com/aws/amazon-ecs-agent/agent/api/task"
 	"github.com/aws/amazon-ecs-agent/agent/engine/image"
+
+	"github.com/pkg/errors"
 )
 
 type noopClient struct{}
@@ -56,6 +61,18 @@ func (c *noopClient) GetTasks() ([]*task.Task, error) {
 	return nil, nil
 }
 
+func (c *noopClient) SaveCompletedTask(*task.Task) error {
+	return nil
+}
+
+func (c *noopClient) GetCompletedTasks() ([]*task.Task, error) {
+	return nil, nil
+}
+
+func (c *noopClient) PurgeCompletedTasks(time.Duration) error {
+	return nil
+}
+
 func (c *noopClient) SaveImageState(*image.ImageState) error {
 	return nil
 }
@@ -80,6 +97,42 @@ func (c *noopClient) GetENIAttachments() ([]*eni.ENIAttachment, error) {
 	return nil, nil
 }
 
+func (c *noopClient) SaveResourceAttachment(*attachment.ResourceAttachment) error {
+	return nil
+}
+
+func (c *noopClient) DeleteResourceAttachment(string) error {
+	return nil
+}
+
+func (c *noopClient) GetResourceAttachments() ([]*attachment.ResourceAttachment, error) {
+	return nil, nil
+}
+
+func (c *noopClient) SaveTaskManifest(*TaskManifest, int) error {
+	return nil
+}
+
+func (c *noopClient) GetManifestHistory() ([]TaskManifest, error) {
+	return nil, nil
+}
+
+func (c *noopClient) SaveTaskSubmission(*TaskSubmission) error {
+	return nil
+}
+
+func (c *noopClient) GetTaskSubmission(string, string) (*TaskSubmission, error) {
+	return nil, errors.New("task submission not found")
+}
+
+func (c *noopClient) DeleteTaskSubmission(string, string) error {
+	return nil
+}
+
+func (c *noopClient) PurgeTaskSubmissions(time.Duration) error {
+	return nil
+}
+
 func (c *noopClient) SaveMetadata(string, string) error {
 	return nil
 }
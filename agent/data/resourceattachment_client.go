@@ -0,0 +1,58 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"encoding/json"
+
+	"github.com/aws/amazon-ecs-agent/agent/api/attachment"
+	"github.com/aws/amazon-ecs-agent/agent/utils"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+func (c *client) SaveResourceAttachment(resourceAttachment *attachment.ResourceAttachment) error {
+	id, err := utils.GetENIAttachmentId(resourceAttachment.AttachmentARN)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate database id")
+	}
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(resourceAttachmentsBucketName))
+		return putObject(b, id, resourceAttachment)
+	})
+}
+
+func (c *client) DeleteResourceAttachment(id string) error {
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(resourceAttachmentsBucketName))
+		return b.Delete([]byte(id))
+	})
+}
+
+func (c *client) GetResourceAttachments() ([]*attachment.ResourceAttachment, error) {
+	var resourceAttachments []*attachment.ResourceAttachment
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(resourceAttachmentsBucketName))
+		return walk(bucket, func(id string, data []byte) error {
+			resourceAttachment := attachment.ResourceAttachment{}
+			if err := json.Unmarshal(data, &resourceAttachment); err != nil {
+				return err
+			}
+			resourceAttachments = append(resourceAttachments, &resourceAttachment)
+			return nil
+		})
+	})
+	return resourceAttachments, err
+}
@@ -0,0 +1,69 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/api/attachment"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManageResourceAttachments(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+
+	testResourceAttachment := &attachment.ResourceAttachment{
+		AttachmentARN:  testAttachmentArn,
+		AttachmentType: attachment.EBSVolumeAttachmentType,
+		AttachmentProperties: map[string]string{
+			attachment.VolumeIDKey: "vol-12345",
+		},
+	}
+
+	assert.NoError(t, testClient.SaveResourceAttachment(testResourceAttachment))
+	res, err := testClient.GetResourceAttachments()
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, testAttachmentArn, res[0].AttachmentARN)
+	assert.Equal(t, "vol-12345", res[0].AttachmentProperties[attachment.VolumeIDKey])
+
+	testResourceAttachment2 := &attachment.ResourceAttachment{
+		AttachmentARN: testAttachmentArn2,
+	}
+	assert.NoError(t, testClient.SaveResourceAttachment(testResourceAttachment2))
+	res, err = testClient.GetResourceAttachments()
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+
+	assert.NoError(t, testClient.DeleteResourceAttachment("test-arn"))
+	res, err = testClient.GetResourceAttachments()
+	assert.NoError(t, err)
+	assert.Len(t, res, 1)
+	assert.Equal(t, testAttachmentArn2, res[0].AttachmentARN)
+}
+
+func TestSaveResourceAttachmentInvalidID(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+
+	testResourceAttachment := &attachment.ResourceAttachment{
+		AttachmentARN: "invalid-arn",
+	}
+	assert.Error(t, testClient.SaveResourceAttachment(testResourceAttachment))
+}
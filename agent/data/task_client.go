@@ -31,7 +31,7 @@ func (c *client) SaveTask(task *apitask.Task) error {
 	}
 	return c.db.Batch(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(tasksBucketName))
-		return putObject(b, id, task)
+		return putCompressedObject(b, id, task, c.compressionThreshold)
 	})
 }
 
@@ -0,0 +1,85 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TaskManifest is a task manifest received from ACS, saved to diagnose issues
+// caused by a bad manifest
+type TaskManifest struct {
+	// SequenceNumber is the timeline of the manifest
+	SequenceNumber int64
+	MessageID      string
+	ClusterARN     string
+	// Tasks are the tasks that should be running on the instance according to
+	// the manifest
+	Tasks []*ecsacs.TaskIdentifier
+	// ReceivedAt is the time at which the manifest was received from ACS
+	ReceivedAt time.Time
+}
+
+// taskManifestKey returns the key of the manifest in the task manifest bucket.
+// Sequence numbers are zero-padded so that keys sort in sequence order
+func taskManifestKey(sequenceNumber int64) string {
+	return fmt.Sprintf("%020d", sequenceNumber)
+}
+
+// SaveTaskManifest saves a manifest to the task manifest bucket and deletes the
+// oldest ones, so that at most historyDepth manifests are kept.
+func (c *client) SaveTaskManifest(manifest *TaskManifest, historyDepth int) error {
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(taskManifestsBucketName))
+		if err := putObject(bucket, taskManifestKey(manifest.SequenceNumber), manifest); err != nil {
+			return err
+		}
+		var keys [][]byte
+		cursor := bucket.Cursor()
+		for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+			keys = append(keys, append([]byte(nil), key...))
+		}
+		// Keys can't be deleted while iterating over the bucket with a cursor
+		for i := 0; i < len(keys)-historyDepth; i++ {
+			if err := bucket.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetManifestHistory returns the manifests in the task manifest bucket, the most
+// recent first.
+func (c *client) GetManifestHistory() ([]TaskManifest, error) {
+	var manifests []TaskManifest
+	err := c.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(taskManifestsBucketName))
+		return walk(bucket, func(id string, data []byte) error {
+			manifest := TaskManifest{}
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				return err
+			}
+			manifests = append([]TaskManifest{manifest}, manifests...)
+			return nil
+		})
+	})
+	return manifests, err
+}
@@ -0,0 +1,96 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/aws-sdk-go/aws"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTaskManifest(sequenceNumber int64) *TaskManifest {
+	return &TaskManifest{
+		SequenceNumber: sequenceNumber,
+		MessageID:      "messageId",
+		ClusterARN:     "cluster",
+		Tasks: []*ecsacs.TaskIdentifier{
+			{
+				TaskArn:        aws.String(testTaskArn),
+				DesiredStatus:  aws.String("RUNNING"),
+				TaskClusterArn: aws.String("cluster"),
+			},
+		},
+		ReceivedAt: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func TestManageTaskManifests(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+
+	res, err := testClient.GetManifestHistory()
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	manifest := newTestTaskManifest(1)
+	require.NoError(t, testClient.SaveTaskManifest(manifest, 5))
+	res, err = testClient.GetManifestHistory()
+	require.NoError(t, err)
+	require.Len(t, res, 1)
+	assert.Equal(t, *manifest, res[0])
+}
+
+func TestTaskManifestHistoryDepth(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+
+	// Sequence numbers with different numbers of digits are kept in sequence
+	// order
+	for _, sequenceNumber := range []int64{1, 2, 9, 10, 11, 100, 1000} {
+		require.NoError(t, testClient.SaveTaskManifest(newTestTaskManifest(sequenceNumber), 3))
+	}
+
+	res, err := testClient.GetManifestHistory()
+	require.NoError(t, err)
+	require.Len(t, res, 3)
+	assert.Equal(t, int64(1000), res[0].SequenceNumber)
+	assert.Equal(t, int64(100), res[1].SequenceNumber)
+	assert.Equal(t, int64(11), res[2].SequenceNumber)
+}
+
+func TestTaskManifestHistoryDepthDecrease(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+
+	for sequenceNumber := int64(1); sequenceNumber <= 5; sequenceNumber++ {
+		require.NoError(t, testClient.SaveTaskManifest(newTestTaskManifest(sequenceNumber), 5))
+	}
+	// The agent was restarted with a smaller depth, the extra manifests are
+	// deleted on the next save
+	require.NoError(t, testClient.SaveTaskManifest(newTestTaskManifest(6), 2))
+
+	res, err := testClient.GetManifestHistory()
+	require.NoError(t, err)
+	require.Len(t, res, 2)
+	assert.Equal(t, int64(6), res[0].SequenceNumber)
+	assert.Equal(t, int64(5), res[1].SequenceNumber)
+}
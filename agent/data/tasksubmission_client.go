@@ -0,0 +1,96 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TaskSubmission records the submission of a task of a payload message to the
+// task engine, so that the task isn't submitted again when the message is
+// resent by ACS after an agent restart
+type TaskSubmission struct {
+	MessageID string
+	TaskARN   string
+	// SubmittedAt is the time at which the task was submitted
+	SubmittedAt time.Time
+}
+
+// taskSubmissionKey returns the key of the submission of the task of the message
+// in the task submission bucket
+func taskSubmissionKey(messageID, taskARN string) string {
+	return messageID + "/" + taskARN
+}
+
+// SaveTaskSubmission saves a task submission to the task submission bucket.
+func (c *client) SaveTaskSubmission(submission *TaskSubmission) error {
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(taskSubmissionsBucketName))
+		return putObject(bucket, taskSubmissionKey(submission.MessageID, submission.TaskARN), submission)
+	})
+}
+
+// GetTaskSubmission returns the submission of the task of the message from the
+// task submission bucket. An error is returned if the task wasn't submitted.
+func (c *client) GetTaskSubmission(messageID, taskARN string) (*TaskSubmission, error) {
+	submission := &TaskSubmission{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return getObject(tx, taskSubmissionsBucketName, taskSubmissionKey(messageID, taskARN), submission)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return submission, nil
+}
+
+// DeleteTaskSubmission deletes the submission of the task of the message from
+// the task submission bucket.
+func (c *client) DeleteTaskSubmission(messageID, taskARN string) error {
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(taskSubmissionsBucketName))
+		return bucket.Delete([]byte(taskSubmissionKey(messageID, taskARN)))
+	})
+}
+
+// PurgeTaskSubmissions deletes the task submissions saved longer than maxAge ago.
+func (c *client) PurgeTaskSubmissions(maxAge time.Duration) error {
+	cutoff := time.Now().Add(-maxAge)
+	return c.db.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(taskSubmissionsBucketName))
+		var expired []string
+		err := walk(bucket, func(id string, data []byte) error {
+			submission := TaskSubmission{}
+			if err := json.Unmarshal(data, &submission); err != nil {
+				return err
+			}
+			if submission.SubmittedAt.Before(cutoff) {
+				expired = append(expired, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// Keys can't be deleted while iterating over the bucket with a cursor
+		for _, id := range expired {
+			if err := bucket.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,72 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManageTaskSubmissions(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+
+	_, err := testClient.GetTaskSubmission("messageId", testTaskArn)
+	assert.Error(t, err)
+
+	submission := &TaskSubmission{
+		MessageID:   "messageId",
+		TaskARN:     testTaskArn,
+		SubmittedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	require.NoError(t, testClient.SaveTaskSubmission(submission))
+	res, err := testClient.GetTaskSubmission("messageId", testTaskArn)
+	require.NoError(t, err)
+	assert.Equal(t, submission, res)
+
+	_, err = testClient.GetTaskSubmission("otherMessageId", testTaskArn)
+	assert.Error(t, err, "submissions should be saved per message")
+
+	require.NoError(t, testClient.DeleteTaskSubmission("messageId", testTaskArn))
+	_, err = testClient.GetTaskSubmission("messageId", testTaskArn)
+	assert.Error(t, err)
+}
+
+func TestPurgeTaskSubmissions(t *testing.T) {
+	testClient, cleanup := newTestClient(t)
+	defer cleanup()
+
+	require.NoError(t, testClient.SaveTaskSubmission(&TaskSubmission{
+		MessageID:   "expired",
+		TaskARN:     testTaskArn,
+		SubmittedAt: time.Now().Add(-2 * time.Hour),
+	}))
+	require.NoError(t, testClient.SaveTaskSubmission(&TaskSubmission{
+		MessageID:   "recent",
+		TaskARN:     testTaskArn,
+		SubmittedAt: time.Now(),
+	}))
+
+	require.NoError(t, testClient.PurgeTaskSubmissions(time.Hour))
+	_, err := testClient.GetTaskSubmission("expired", testTaskArn)
+	assert.Error(t, err)
+	_, err = testClient.GetTaskSubmission("recent", testTaskArn)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,221 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package diagnostics
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient"
+	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	tasksFileName      = "tasks.json"
+	sessionFileName    = "acs_session.json"
+	dockerInfoFileName = "docker_info.json"
+	agentLogFileName   = "ecs-agent.log"
+
+	// maxLogLines is the number of most recent lines of the agent log that
+	// are included in the bundle
+	maxLogLines = 1000
+)
+
+// SessionStats describes the ACS session over which the bundle was requested
+type SessionStats struct {
+	Cluster              string `json:"Cluster"`
+	ContainerInstanceARN string `json:"ContainerInstanceARN"`
+	IPVersion            string `json:"IPVersion,omitempty"`
+	RequestID            string `json:"RequestID,omitempty"`
+}
+
+// taskState is the state of a task included in the bundle. It only holds the
+// fields needed to troubleshoot the task, the environment and credentials of
+// the task are deliberately left out
+type taskState struct {
+	Arn           string           `json:"Arn"`
+	Family        string           `json:"Family"`
+	Version       string           `json:"Version"`
+	DesiredStatus string           `json:"DesiredStatus"`
+	KnownStatus   string           `json:"KnownStatus"`
+	Containers    []containerState `json:"Containers"`
+}
+
+// containerState is the state of a container included in the bundle
+type containerState struct {
+	Name          string `json:"Name"`
+	Image         string `json:"Image"`
+	DesiredStatus string `json:"DesiredStatus"`
+	KnownStatus   string `json:"KnownStatus"`
+	ExitCode      *int   `json:"ExitCode,omitempty"`
+}
+
+// DiagnosticCollector collects the state of the agent into a diagnostic bundle:
+// a gzipped tar archive with the task and container states, the ACS session
+// stats, the docker info output and the most recent lines of the agent log.
+// Anything that looks like an IAM credential is redacted from the bundle
+type DiagnosticCollector struct {
+	taskEngine   engine.TaskEngine
+	dockerClient dockerapi.DockerClient
+	sessionStats SessionStats
+	logFile      string
+}
+
+// NewDiagnosticCollector returns a new DiagnosticCollector object. The agent log
+// is left out of the bundle if logFile is empty
+func NewDiagnosticCollector(taskEngine engine.TaskEngine, dockerClient dockerapi.DockerClient,
+	sessionStats SessionStats, logFile string) *DiagnosticCollector {
+	return &DiagnosticCollector{
+		taskEngine:   taskEngine,
+		dockerClient: dockerClient,
+		sessionStats: sessionStats,
+		logFile:      logFile,
+	}
+}
+
+// Collect returns the diagnostic bundle. Failing to collect the docker info or
+// the agent log doesn't fail the collection, the error is recorded in the
+// bundle instead
+func (collector *DiagnosticCollector) Collect() ([]byte, error) {
+	tasks, err := collector.taskEngine.ListTasks()
+	if err != nil {
+		return nil, errors.Wrap(err, "diagnostics: unable to list tasks")
+	}
+	tasksJSON, err := json.MarshalIndent(newTaskStates(tasks), "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "diagnostics: unable to marshal task states")
+	}
+	sessionJSON, err := json.MarshalIndent(collector.sessionStats, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "diagnostics: unable to marshal session stats")
+	}
+
+	files := []bundleFile{
+		{name: tasksFileName, data: tasksJSON},
+		{name: sessionFileName, data: sessionJSON},
+		{name: dockerInfoFileName, data: collector.dockerInfo()},
+	}
+	if collector.logFile != "" {
+		files = append(files, bundleFile{name: agentLogFileName, data: collector.recentLogLines()})
+	}
+	return archive(files)
+}
+
+// newTaskStates returns the states of the tasks to be included in the bundle
+func newTaskStates(tasks []*apitask.Task) []taskState {
+	states := make([]taskState, 0, len(tasks))
+	for _, task := range tasks {
+		state := taskState{
+			Arn:           task.Arn,
+			Family:        task.Family,
+			Version:       task.Version,
+			DesiredStatus: task.GetDesiredStatus().String(),
+			KnownStatus:   task.GetKnownStatus().String(),
+		}
+		for _, container := range task.Containers {
+			state.Containers = append(state.Containers, containerState{
+				Name:          container.Name,
+				Image:         container.Image,
+				DesiredStatus: container.GetDesiredStatus().String(),
+				KnownStatus:   container.GetKnownStatus().String(),
+				ExitCode:      container.GetKnownExitCode(),
+			})
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// dockerInfo returns the output of docker info, or the error returned by docker
+func (collector *DiagnosticCollector) dockerInfo() []byte {
+	info, err := collector.dockerClient.Info(context.Background(), dockerclient.InfoTimeout)
+	if err != nil {
+		seelog.Warnf("Unable to get docker info for the diagnostic bundle: %v", err)
+		return []byte("Unable to get docker info: " + err.Error())
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return []byte("Unable to marshal docker info: " + err.Error())
+	}
+	return data
+}
+
+// recentLogLines returns the last maxLogLines lines of the agent log
+func (collector *DiagnosticCollector) recentLogLines() []byte {
+	file, err := os.Open(collector.logFile)
+	if err != nil {
+		seelog.Warnf("Unable to read the agent log for the diagnostic bundle: %v", err)
+		return []byte("Unable to read the agent log: " + err.Error())
+	}
+	defer file.Close()
+
+	lines := make([][]byte, 0, maxLogLines)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(lines) == maxLogLines {
+			lines = lines[1:]
+		}
+		lines = append(lines, append([]byte{}, scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		lines = append(lines, []byte("Unable to read the rest of the agent log: "+err.Error()))
+	}
+	return append(bytes.Join(lines, []byte("\n")), '\n')
+}
+
+// bundleFile is a file of the diagnostic bundle
+type bundleFile struct {
+	name string
+	data []byte
+}
+
+// archive redacts the files and writes them into a gzipped tar archive
+func archive(files []bundleFile) ([]byte, error) {
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	tarWriter := tar.NewWriter(gzipWriter)
+	modTime := time.Now()
+	for _, file := range files {
+		data := Redact(file.data)
+		header := &tar.Header{
+			Name:    file.name,
+			Mode:    0400,
+			Size:    int64(len(data)),
+			ModTime: modTime,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return nil, errors.Wrapf(err, "diagnostics: unable to write header of %s", file.name)
+		}
+		if _, err := tarWriter.Write(data); err != nil {
+			return nil, errors.Wrapf(err, "diagnostics: unable to write %s", file.name)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return nil, errors.Wrap(err, "diagnostics: unable to close tar writer")
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return nil, errors.Wrap(err, "diagnostics: unable to close gzip writer")
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,33 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package diagnostics
+
+import "regexp"
+
+const redactedValue = "[REDACTED]"
+
+var (
+	// accessKeyIDPattern matches long term and temporary AWS access key ids
+	accessKeyIDPattern = regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)
+	// credentialFieldPattern matches the value of fields holding credentials,
+	// such as `"secretAccessKey": "..."` or `AWS_SESSION_TOKEN=...`
+	credentialFieldPattern = regexp.MustCompile(
+		`(?i)((?:aws_)?(?:access_?key_?id|secret_?access_?key|session_?token)"?\s*[:=]\s*"?)[^"\s,}]+`)
+)
+
+// Redact replaces anything that looks like an IAM credential in the data
+func Redact(data []byte) []byte {
+	data = credentialFieldPattern.ReplaceAll(data, []byte("${1}"+redactedValue))
+	return accessKeyIDPattern.ReplaceAll(data, []byte(redactedValue))
+}
@@ -0,0 +1,77 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package diagnostics
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/httpclient"
+	"github.com/pkg/errors"
+)
+
+const (
+	// uploadTimeout is the timeout for uploading the diagnostic bundle
+	uploadTimeout = 5 * time.Minute
+	// maxErrorResponseSize is the maximum number of bytes of the response
+	// body included in the error when the upload fails
+	maxErrorResponseSize = 1024
+)
+
+// S3Uploader uploads diagnostic bundles to S3 using pre-signed URLs
+type S3Uploader struct {
+	client *http.Client
+}
+
+// NewS3Uploader returns a new S3Uploader object
+func NewS3Uploader() *S3Uploader {
+	return &S3Uploader{
+		client: httpclient.New(uploadTimeout, false),
+	}
+}
+
+// Upload uploads the data to the pre-signed S3 URL. Only https URLs are
+// accepted, so that the bundle is never sent in clear text
+func (uploader *S3Uploader) Upload(uploadURL string, data []byte) error {
+	parsedURL, err := url.Parse(uploadURL)
+	if err != nil {
+		return errors.Wrap(err, "diagnostics: invalid upload url")
+	}
+	if parsedURL.Scheme != "https" {
+		return errors.Errorf("diagnostics: upload url scheme must be https, got: %q", parsedURL.Scheme)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "diagnostics: unable to create upload request")
+	}
+	req.ContentLength = int64(len(data))
+	resp, err := uploader.client.Do(req)
+	if err != nil {
+		// The error contains the url, which holds the signature of the request
+		return errors.Errorf("diagnostics: unable to upload bundle to %s", parsedURL.Host)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorResponseSize))
+		return errors.Errorf("diagnostics: unable to upload bundle, status: %s, response: %s",
+			resp.Status, string(body))
+	}
+	return nil
+}
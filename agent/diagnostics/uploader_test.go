@@ -0,0 +1,73 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package diagnostics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpload(t *testing.T) {
+	var received []byte
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "signature", r.URL.Query().Get("X-Amz-Signature"))
+		received, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	uploader := NewS3Uploader()
+	uploader.client = server.Client()
+	require.NoError(t, uploader.Upload(server.URL+"/bundle?X-Amz-Signature=signature", []byte("bundle")))
+	assert.Equal(t, "bundle", string(received))
+}
+
+func TestUploadErrorResponse(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("<Error><Code>AccessDenied</Code></Error>"))
+	}))
+	defer server.Close()
+
+	uploader := NewS3Uploader()
+	uploader.client = server.Client()
+	err := uploader.Upload(server.URL+"/bundle", []byte("bundle"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "403")
+	assert.Contains(t, err.Error(), "AccessDenied")
+}
+
+func TestUploadConnectionErrorDoesNotLeakSignature(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	uploadURL := server.URL + "/bundle?X-Amz-Signature=signature"
+	server.Close()
+
+	err := NewS3Uploader().Upload(uploadURL, []byte("bundle"))
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "signature")
+}
+
+func TestUploadRejectsHTTPURL(t *testing.T) {
+	err := NewS3Uploader().Upload("http://bucket.s3.amazonaws.com/bundle", []byte("bundle"))
+	assert.Error(t, err)
+}
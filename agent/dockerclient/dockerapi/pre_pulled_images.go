@@ -0,0 +1,142 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+)
+
+// prePulledImage is an image pulled, or being pulled, ahead of the tasks using it
+type prePulledImage struct {
+	// done is closed once the pull is finished
+	done      chan struct{}
+	metadata  DockerContainerMetadata
+	expiresAt time.Time
+}
+
+// PrePulledImages tracks the images pulled before the tasks using them are
+// received, so that the tasks wait for the pulls in progress instead of pulling
+// the same images again. The images pulled successfully are tracked until their
+// TTL elapses, the tasks received later pull them again
+type PrePulledImages struct {
+	ttl    time.Duration
+	lock   sync.Mutex
+	images map[string]*prePulledImage
+}
+
+// NewPrePulledImages returns a new PrePulledImages tracking the images pulled
+// successfully for ttl
+func NewPrePulledImages(ttl time.Duration) *PrePulledImages {
+	return &PrePulledImages{
+		ttl:    ttl,
+		images: make(map[string]*prePulledImage),
+	}
+}
+
+// Start records the start of the pre-pull of the image. It returns the function
+// recording the end of the pull, or false if the image is already being pulled
+// or was pulled successfully less than a TTL ago
+func (images *PrePulledImages) Start(image string) (func(DockerContainerMetadata), bool) {
+	if images == nil {
+		return nil, false
+	}
+	images.lock.Lock()
+	defer images.lock.Unlock()
+	if pulled, ok := images.images[image]; ok {
+		select {
+		case <-pulled.done:
+			if time.Now().Before(pulled.expiresAt) {
+				return nil, false
+			}
+		default:
+			return nil, false
+		}
+	}
+	pulled := &prePulledImage{done: make(chan struct{})}
+	images.images[image] = pulled
+	return func(metadata DockerContainerMetadata) {
+		images.finish(image, pulled, metadata)
+	}, true
+}
+
+// finish records the end of the pre-pull of the image. Images that couldn't be
+// pulled are forgotten, so that they are pulled again
+func (images *PrePulledImages) finish(image string, pulled *prePulledImage, metadata DockerContainerMetadata) {
+	images.lock.Lock()
+	defer images.lock.Unlock()
+	pulled.metadata = metadata
+	pulled.expiresAt = time.Now().Add(images.ttl)
+	close(pulled.done)
+	if metadata.Error != nil && images.images[image] == pulled {
+		delete(images.images, image)
+	}
+}
+
+// Wait waits for the pre-pull of the image in progress, if any, until ctx is
+// done. It returns the result of the pull, and false if the image isn't being
+// pre-pulled nor was pre-pulled less than a TTL ago
+func (images *PrePulledImages) Wait(ctx context.Context, image string) (DockerContainerMetadata, bool) {
+	if images == nil {
+		return DockerContainerMetadata{}, false
+	}
+	images.lock.Lock()
+	pulled, ok := images.images[image]
+	images.lock.Unlock()
+	if !ok {
+		return DockerContainerMetadata{}, false
+	}
+	select {
+	case <-pulled.done:
+	case <-ctx.Done():
+		return DockerContainerMetadata{}, false
+	}
+	if pulled.metadata.Error == nil && time.Now().After(pulled.expiresAt) {
+		return DockerContainerMetadata{}, false
+	}
+	return pulled.metadata, true
+}
+
+// NewPrePullAwareDockerClient returns a DockerClient whose image pulls wait
+// for the pre-pull of the same image in progress instead of pulling it again,
+// and fall back to pulling the image with the client otherwise. The client is
+// returned as is if images is nil. The pre-pulls must be made with the client,
+// not with the returned one
+func NewPrePullAwareDockerClient(client DockerClient, images *PrePulledImages) DockerClient {
+	if images == nil {
+		return client
+	}
+	return &prePullAwareDockerClient{
+		DockerClient: client,
+		images:       images,
+	}
+}
+
+type prePullAwareDockerClient struct {
+	DockerClient
+	images *PrePulledImages
+}
+
+// PullImage returns the result of the pre-pull of the image if it succeeded,
+// or pulls the image
+func (client *prePullAwareDockerClient) PullImage(ctx context.Context, image string,
+	authData *apicontainer.RegistryAuthenticationData, timeout time.Duration) DockerContainerMetadata {
+	if metadata, ok := client.images.Wait(ctx, image); ok && metadata.Error == nil {
+		return metadata
+	}
+	return client.DockerClient.PullImage(ctx, image, authData, timeout)
+}
@@ -0,0 +1,110 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package dockerapi
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPrePulledImage = "busybox:latest"
+
+// countingPullClient counts the images it pulls
+type countingPullClient struct {
+	DockerClient
+	pulls int
+}
+
+func (client *countingPullClient) PullImage(ctx context.Context, image string,
+	authData *apicontainer.RegistryAuthenticationData, timeout time.Duration) DockerContainerMetadata {
+	client.pulls++
+	return DockerContainerMetadata{}
+}
+
+func TestPrePulledImagesStart(t *testing.T) {
+	images := NewPrePulledImages(time.Minute)
+	finish, ok := images.Start(testPrePulledImage)
+	require.True(t, ok)
+	_, ok = images.Start(testPrePulledImage)
+	assert.False(t, ok, "an image being pulled shouldn't be pulled again")
+
+	finish(DockerContainerMetadata{})
+	_, ok = images.Start(testPrePulledImage)
+	assert.False(t, ok, "an image just pulled shouldn't be pulled again")
+
+	images.images[testPrePulledImage].expiresAt = time.Now().Add(-time.Second)
+	finish, ok = images.Start(testPrePulledImage)
+	require.True(t, ok, "an image pulled more than a TTL ago should be pulled again")
+
+	finish(DockerContainerMetadata{Error: CannotPullContainerError{FromError: errors.New("not found")}})
+	_, ok = images.Start(testPrePulledImage)
+	assert.True(t, ok, "an image that couldn't be pulled should be pulled again")
+}
+
+func TestPrePulledImagesWaitForPullInProgress(t *testing.T) {
+	images := NewPrePulledImages(time.Minute)
+	_, ok := images.Wait(context.TODO(), testPrePulledImage)
+	assert.False(t, ok)
+
+	finish, ok := images.Start(testPrePulledImage)
+	require.True(t, ok)
+	done := make(chan bool)
+	go func() {
+		_, ok := images.Wait(context.TODO(), testPrePulledImage)
+		done <- ok
+	}()
+	select {
+	case <-done:
+		t.Fatal("the pull in progress should be waited for")
+	case <-time.After(10 * time.Millisecond):
+	}
+	finish(DockerContainerMetadata{})
+	assert.True(t, <-done)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	_, ok = images.Start("other")
+	require.True(t, ok)
+	_, ok = images.Wait(ctx, "other")
+	assert.False(t, ok, "waiting should stop once the context is done")
+}
+
+func TestPrePullAwareDockerClient(t *testing.T) {
+	client := &countingPullClient{}
+	assert.Equal(t, client, NewPrePullAwareDockerClient(client, nil))
+
+	images := NewPrePulledImages(time.Minute)
+	awareClient := NewPrePullAwareDockerClient(client, images)
+	finish, _ := images.Start(testPrePulledImage)
+	finish(DockerContainerMetadata{})
+	assert.NoError(t, awareClient.PullImage(context.TODO(), testPrePulledImage, nil, time.Minute).Error)
+	assert.Zero(t, client.pulls, "the pre-pulled image shouldn't be pulled again")
+
+	awareClient.PullImage(context.TODO(), "other", nil, time.Minute)
+	assert.Equal(t, 1, client.pulls)
+
+	finish, _ = images.Start("failing")
+	finish(DockerContainerMetadata{Error: CannotPullContainerError{FromError: errors.New("denied")}})
+	awareClient.PullImage(context.TODO(), "failing", nil, time.Minute)
+	assert.Equal(t, 2, client.pulls, "the image should be pulled if the pre-pull failed")
+}
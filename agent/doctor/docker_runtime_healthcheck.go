@@ -55,8 +55,16 @@ func NewDockerRuntimeHealthcheck(client dockerapi.DockerClient) *dockerRuntimeHe
 }
 
 func (dhc *dockerRuntimeHealthcheck) RunCheck() HealthcheckStatus {
-	// TODO pass in context as an argument
-	res := dhc.client.SystemPing(context.TODO(), systemPingTimeout)
+	return dhc.RunCheckWithContext(context.TODO())
+}
+
+// RunCheckWithContext pings docker, the status isn't updated if the context is
+// cancelled before docker answers
+func (dhc *dockerRuntimeHealthcheck) RunCheckWithContext(ctx context.Context) HealthcheckStatus {
+	res := dhc.client.SystemPing(ctx, systemPingTimeout)
+	if res.Error != nil && ctx.Err() != nil {
+		return HealthcheckStatusUnknown
+	}
 	resultStatus := HealthcheckStatusOk
 	if res.Error != nil {
 		seelog.Infof("[DockerRuntimeHealthcheck] Docker Ping failed with error: %v", res.Error)
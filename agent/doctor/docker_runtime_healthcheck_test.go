@@ -1,6 +1,7 @@
 package doctor
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -61,6 +62,24 @@ func TestRunCheck(t *testing.T) {
 	}
 }
 
+func TestRunCheckWithCancelledContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	dockerClient := mock_dockerapi.NewMockDockerClient(ctrl)
+	dockerRuntimeHealthCheck := NewDockerRuntimeHealthcheck(dockerClient)
+	dockerClient.EXPECT().SystemPing(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, timeout time.Duration) dockerapi.PingResponse {
+			<-ctx.Done()
+			return dockerapi.PingResponse{Error: ctx.Err()}
+		})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, HealthcheckStatusUnknown, dockerRuntimeHealthCheck.RunCheckWithContext(ctx))
+	assert.Equal(t, HealthcheckStatusInitializing, dockerRuntimeHealthCheck.Status,
+		"the status shouldn't change when the check is cancelled")
+}
+
 func TestSetHealthCheckStatus(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -14,7 +14,9 @@
 package doctor
 
 import (
+	"context"
 	"sync"
+	"time"
 
 	"github.com/cihub/seelog"
 	"github.com/pkg/errors"
@@ -107,6 +109,65 @@ func (doc *Doctor) RunHealthchecks() bool {
 	return doc.allRight(allChecksResult)
 }
 
+// CheckResult is the result of a healthcheck run by BudgetedRunChecks
+type CheckResult struct {
+	HealthcheckType string
+	Status          HealthcheckStatus
+}
+
+// BudgetedRunChecks runs every healthcheck that the doctor knows about in
+// parallel, and returns their results once they're all done or the budget is
+// spent, whichever comes first. Checks that don't complete within the budget
+// are cancelled if they're cancellable, and reported as UNKNOWN
+func (doc *Doctor) BudgetedRunChecks(budget time.Duration) []CheckResult {
+	healthchecks := *doc.GetHealthchecks()
+	ctx, cancel := context.WithTimeout(context.Background(), budget)
+	defer cancel()
+
+	type indexedStatus struct {
+		index  int
+		status HealthcheckStatus
+	}
+	// Buffered so that the checks completing after the budget don't block
+	statuses := make(chan indexedStatus, len(healthchecks))
+	results := make([]CheckResult, len(healthchecks))
+	for i, healthcheck := range healthchecks {
+		results[i] = CheckResult{
+			HealthcheckType: healthcheck.GetHealthcheckType(),
+			Status:          HealthcheckStatusUnknown,
+		}
+		go func(index int, healthcheck Healthcheck) {
+			statuses <- indexedStatus{index: index, status: runCheck(ctx, healthcheck)}
+		}(i, healthcheck)
+	}
+
+collect:
+	for remaining := len(healthchecks); remaining > 0; remaining-- {
+		select {
+		case status := <-statuses:
+			results[status.index].Status = status.status
+		case <-ctx.Done():
+			seelog.Warnf("Instance healthchecks didn't complete within %s, %d of them are reported as %s",
+				budget.String(), remaining, HealthcheckStatusUnknown.String())
+			break collect
+		}
+	}
+	for _, result := range results {
+		seelog.Debugf("instance healthcheck result: %s: %s", result.HealthcheckType, result.Status.String())
+	}
+
+	doc.SetStatusReported(false)
+	return results
+}
+
+// runCheck runs the healthcheck, with the context if it's cancellable
+func runCheck(ctx context.Context, healthcheck Healthcheck) HealthcheckStatus {
+	if cancellable, ok := healthcheck.(CancellableHealthcheck); ok {
+		return cancellable.RunCheckWithContext(ctx)
+	}
+	return healthcheck.RunCheck()
+}
+
 // GetHealthchecks returns a copy of list of healthchecks that the
 // doctor is holding internally.
 func (doc *Doctor) GetHealthchecks() *[]Healthcheck {
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -193,3 +194,45 @@ func TestAllRight(t *testing.T) {
 		})
 	}
 }
+
+// slowHealthcheck is a healthcheck that doesn't complete until it's released
+type slowHealthcheck struct {
+	trueHealthcheck
+	release chan struct{}
+}
+
+func (sc *slowHealthcheck) RunCheck() HealthcheckStatus {
+	<-sc.release
+	return HealthcheckStatusOk
+}
+func (sc *slowHealthcheck) GetHealthcheckType() string { return HealthcheckTypeContainerRuntime }
+
+func TestBudgetedRunChecks(t *testing.T) {
+	newDoctor, _ := NewDoctor([]Healthcheck{&trueHealthcheck{}, &falseHealthcheck{}}, TEST_CLUSTER, TEST_INSTANCE_ARN)
+	newDoctor.SetStatusReported(true)
+
+	results := newDoctor.BudgetedRunChecks(time.Second)
+	assert.Equal(t, []CheckResult{
+		{HealthcheckType: HealthcheckTypeAgent, Status: HealthcheckStatusOk},
+		{HealthcheckType: HealthcheckTypeAgent, Status: HealthcheckStatusImpaired},
+	}, results)
+	assert.False(t, newDoctor.HasStatusBeenReported())
+}
+
+func TestBudgetedRunChecksReturnsPartialResults(t *testing.T) {
+	slow := &slowHealthcheck{release: make(chan struct{})}
+	defer close(slow.release)
+	newDoctor, _ := NewDoctor([]Healthcheck{slow, &falseHealthcheck{}}, TEST_CLUSTER, TEST_INSTANCE_ARN)
+
+	start := time.Now()
+	results := newDoctor.BudgetedRunChecks(50 * time.Millisecond)
+	assert.True(t, time.Since(start) < time.Second, "the checks should be given up on once the budget is spent")
+	require.Len(t, results, 2)
+	assert.Equal(t, CheckResult{HealthcheckType: HealthcheckTypeContainerRuntime, Status: HealthcheckStatusUnknown}, results[0])
+	assert.Equal(t, CheckResult{HealthcheckType: HealthcheckTypeAgent, Status: HealthcheckStatusImpaired}, results[1])
+}
+
+func TestBudgetedRunChecksWithoutHealthchecks(t *testing.T) {
+	newDoctor, _ := NewDoctor([]Healthcheck{}, TEST_CLUSTER, TEST_INSTANCE_ARN)
+	assert.Empty(t, newDoctor.BudgetedRunChecks(time.Second))
+}
@@ -14,12 +14,14 @@
 package doctor
 
 import (
+	"context"
 	"time"
 )
 
 const (
 	HealthcheckTypeContainerRuntime = "ContainerRuntime"
 	HealthcheckTypeAgent            = "Agent"
+	HealthcheckTypeNTPSync          = "NTPSync"
 )
 
 type Healthcheck interface {
@@ -32,3 +34,10 @@ type Healthcheck interface {
 	RunCheck() HealthcheckStatus
 	SetHealthcheckStatus(status HealthcheckStatus)
 }
+
+// CancellableHealthcheck is a Healthcheck that can be cancelled. A cancelled
+// check returns HealthcheckStatusUnknown, without updating its status
+type CancellableHealthcheck interface {
+	Healthcheck
+	RunCheckWithContext(ctx context.Context) HealthcheckStatus
+}
@@ -25,6 +25,8 @@ const (
 	HealthcheckStatusOk
 	// HealthcheckStatusImpaired represents a healthcheck with a false/fail result
 	HealthcheckStatusImpaired
+	// HealthcheckStatusUnknown represents a healthcheck that didn't complete in time
+	HealthcheckStatusUnknown
 )
 
 // HealthcheckStatus is an enumeration of possible instance statuses
@@ -34,6 +36,7 @@ var healthcheckStatusMap = map[string]HealthcheckStatus{
 	"INITIALIZING": HealthcheckStatusInitializing,
 	"OK":           HealthcheckStatusOk,
 	"IMPAIRED":     HealthcheckStatusImpaired,
+	"UNKNOWN":      HealthcheckStatusUnknown,
 }
 
 // String returns a human readable string representation of this object
@@ -30,6 +30,9 @@ func TestOk(t *testing.T) {
 	assert.True(t, initializingStatus.Ok())
 	assert.True(t, okStatus.Ok())
 	assert.False(t, impairedStatus.Ok())
+	unknownStatus := HealthcheckStatusUnknown
+	assert.False(t, unknownStatus.Ok())
+	assert.Equal(t, "UNKNOWN", unknownStatus.String())
 }
 
 type testHealthcheckStatus struct {
@@ -0,0 +1,260 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package doctor
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/cihub/seelog"
+	"github.com/pkg/errors"
+)
+
+const (
+	ntpPort         = "123"
+	ntpQueryTimeout = time.Second * 2
+	ntpPacketSize   = 48
+	// ntpEpochOffset is the number of seconds from the NTP epoch, 1900, to the
+	// unix epoch
+	ntpEpochOffset = 2208988800
+	// ntpEraSeconds is the number of seconds of an NTP era, after which the
+	// seconds of the timestamps wrap around
+	ntpEraSeconds = 1 << 32
+	// ntpEraMSB is the most significant bit of the seconds of the timestamps,
+	// set from 1968 until the end of the first era in 2036
+	ntpEraMSB = 1 << 31
+	// ntpClientRequest is the first byte of a request: no leap indicator,
+	// version 4, client mode
+	ntpClientRequest = 0x23
+	ntpModeServer    = 4
+)
+
+// NTPSyncCheck compares the system clock to the time of an NTP server. The
+// check is impaired when the clock is further than the threshold from the time
+// of the server, as the TLS handshakes with the backend fail when the clock is
+// skewed. The status is unknown when the server doesn't answer
+type NTPSyncCheck struct {
+	// HealthcheckType is the reported healthcheck type
+	HealthcheckType string `json:"HealthcheckType,omitempty"`
+	// Status is the clock sync status
+	Status HealthcheckStatus `json:"HealthcheckStatus,omitempty"`
+	// Timestamp is the timestamp when clock sync status changed
+	TimeStamp time.Time `json:"TimeStamp,omitempty"`
+	// StatusChangeTime is the latest time the clock sync status changed
+	StatusChangeTime time.Time `json:"StatusChangeTime,omitempty"`
+
+	// LastStatus is the last clock sync status
+	LastStatus HealthcheckStatus `json:"LastStatus,omitempty"`
+	// LastTimeStamp is the timestamp of last clock sync status
+	LastTimeStamp time.Time `json:"LastTimeStamp,omitempty"`
+
+	server    string
+	threshold time.Duration
+	// skew is the offset of the system clock from the time of the server
+	// measured by the last check
+	skew time.Duration
+	lock sync.RWMutex
+}
+
+// NewNTPSyncCheck returns a check comparing the system clock to the time of the
+// NTP server, a host or a host:port
+func NewNTPSyncCheck(server string, threshold time.Duration) *NTPSyncCheck {
+	nowTime := time.Now()
+	return &NTPSyncCheck{
+		HealthcheckType:  HealthcheckTypeNTPSync,
+		Status:           HealthcheckStatusInitializing,
+		TimeStamp:        nowTime,
+		StatusChangeTime: nowTime,
+		server:           server,
+		threshold:        threshold,
+	}
+}
+
+func (nsc *NTPSyncCheck) RunCheck() HealthcheckStatus {
+	return nsc.RunCheckWithContext(context.TODO())
+}
+
+// RunCheckWithContext queries the NTP server, the status isn't updated if the
+// context is cancelled before the server answers
+func (nsc *NTPSyncCheck) RunCheckWithContext(ctx context.Context) HealthcheckStatus {
+	offset, err := queryNTPOffset(ctx, nsc.server)
+	if err != nil && ctx.Err() != nil {
+		return HealthcheckStatusUnknown
+	}
+	resultStatus := HealthcheckStatusOk
+	if err != nil {
+		seelog.Infof("[NTPSyncHealthcheck] Unable to query NTP server %s: %v", nsc.server, err)
+		resultStatus = HealthcheckStatusUnknown
+	} else if offset > nsc.threshold || -offset > nsc.threshold {
+		seelog.Warnf("[NTPSyncHealthcheck] System clock is %s off the time of NTP server %s", offset.String(), nsc.server)
+		resultStatus = HealthcheckStatusImpaired
+	}
+	nsc.lock.Lock()
+	nsc.skew = offset
+	nsc.lock.Unlock()
+	nsc.SetHealthcheckStatus(resultStatus)
+	return resultStatus
+}
+
+// CheckSkew runs the check, and returns an error if the system clock is further
+// than the threshold from the time of the NTP server
+func (nsc *NTPSyncCheck) CheckSkew(ctx context.Context) error {
+	if nsc.RunCheckWithContext(ctx) != HealthcheckStatusImpaired {
+		return nil
+	}
+	return errors.Errorf("system clock is %s off the time of NTP server %s, above the threshold of %s",
+		nsc.GetSkew().String(), nsc.server, nsc.threshold.String())
+}
+
+// GetSkew returns the offset of the system clock from the time of the NTP server
+// measured by the last check
+func (nsc *NTPSyncCheck) GetSkew() time.Duration {
+	nsc.lock.RLock()
+	defer nsc.lock.RUnlock()
+	return nsc.skew
+}
+
+func (nsc *NTPSyncCheck) SetHealthcheckStatus(healthStatus HealthcheckStatus) {
+	nsc.lock.Lock()
+	defer nsc.lock.Unlock()
+	nowTime := time.Now()
+	// if the status has changed, update status change timestamp
+	if nsc.Status != healthStatus {
+		nsc.StatusChangeTime = nowTime
+	}
+	// track previous status
+	nsc.LastStatus = nsc.Status
+	nsc.LastTimeStamp = nsc.TimeStamp
+
+	// update latest status
+	nsc.Status = healthStatus
+	nsc.TimeStamp = nowTime
+}
+
+func (nsc *NTPSyncCheck) GetHealthcheckType() string {
+	nsc.lock.RLock()
+	defer nsc.lock.RUnlock()
+	return nsc.HealthcheckType
+}
+
+func (nsc *NTPSyncCheck) GetHealthcheckStatus() HealthcheckStatus {
+	nsc.lock.RLock()
+	defer nsc.lock.RUnlock()
+	return nsc.Status
+}
+
+func (nsc *NTPSyncCheck) GetHealthcheckTime() time.Time {
+	nsc.lock.RLock()
+	defer nsc.lock.RUnlock()
+	return nsc.TimeStamp
+}
+
+func (nsc *NTPSyncCheck) GetStatusChangeTime() time.Time {
+	nsc.lock.RLock()
+	defer nsc.lock.RUnlock()
+	return nsc.StatusChangeTime
+}
+
+func (nsc *NTPSyncCheck) GetLastHealthcheckStatus() HealthcheckStatus {
+	nsc.lock.RLock()
+	defer nsc.lock.RUnlock()
+	return nsc.LastStatus
+}
+
+func (nsc *NTPSyncCheck) GetLastHealthcheckTime() time.Time {
+	nsc.lock.RLock()
+	defer nsc.lock.RUnlock()
+	return nsc.LastTimeStamp
+}
+
+// queryNTPOffset returns the offset of the system clock from the time of the NTP
+// server, computed from the timestamps of a single SNTP exchange
+func queryNTPOffset(ctx context.Context, server string) (time.Duration, error) {
+	address := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		address = net.JoinHostPort(server, ntpPort)
+	}
+	ctx, cancel := context.WithTimeout(ctx, ntpQueryTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", address)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to dial %s", address)
+	}
+	defer conn.Close()
+	// Unblock the exchange as soon as the context is done
+	exchanged := make(chan struct{})
+	defer close(exchanged)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-exchanged:
+		}
+	}()
+
+	request := make([]byte, ntpPacketSize)
+	request[0] = ntpClientRequest
+	originTime := time.Now()
+	// The server copies the transmit timestamp of the request to the origin
+	// timestamp of its response
+	putNTPTime(request[40:48], originTime)
+	if _, err := conn.Write(request); err != nil {
+		return 0, errors.Wrapf(err, "unable to send request to %s", address)
+	}
+	response := make([]byte, ntpPacketSize)
+	n, err := conn.Read(response)
+	destinationTime := time.Now()
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to read response from %s", address)
+	}
+	if n < ntpPacketSize {
+		return 0, errors.Errorf("short response from %s: %d bytes", address, n)
+	}
+	if response[0]&0x7 != ntpModeServer {
+		return 0, errors.Errorf("invalid response mode from %s: %d", address, response[0]&0x7)
+	}
+	if response[1] == 0 {
+		return 0, errors.Errorf("kiss-o'-death response from %s: %s", address, string(response[12:16]))
+	}
+	if binary.BigEndian.Uint64(response[24:32]) != binary.BigEndian.Uint64(request[40:48]) {
+		return 0, errors.Errorf("response from %s doesn't match the request", address)
+	}
+	receiveTime := ntpTime(response[32:40])
+	transmitTime := ntpTime(response[40:48])
+	return (receiveTime.Sub(originTime) + transmitTime.Sub(destinationTime)) / 2, nil
+}
+
+// ntpTime decodes an NTP timestamp. As in RFC 4330, timestamps with the most
+// significant bit set are in the era from 1968 to 2036, the others wrapped around
+// and are in the era from 2036 to 2104
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[0:4]))
+	if seconds&ntpEraMSB == 0 {
+		seconds += ntpEraSeconds
+	}
+	fraction := binary.BigEndian.Uint32(b[4:8])
+	nanoseconds := (uint64(fraction) * uint64(time.Second)) >> 32
+	return time.Unix(seconds-ntpEpochOffset, int64(nanoseconds))
+}
+
+// putNTPTime encodes the time as an NTP timestamp, the seconds wrap around at
+// the end of each era
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:8], uint32((uint64(t.Nanosecond())<<32)/uint64(time.Second)))
+}
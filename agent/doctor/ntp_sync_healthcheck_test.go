@@ -0,0 +1,149 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package doctor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startMockNTPResponder starts an NTP server whose clock is skewed from the
+// system clock, answering with the stratum. It returns the address of the server
+func startMockNTPResponder(t *testing.T, skew time.Duration, stratum byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		request := make([]byte, ntpPacketSize)
+		for {
+			n, addr, err := conn.ReadFrom(request)
+			if err != nil {
+				return
+			}
+			if n < ntpPacketSize {
+				continue
+			}
+			response := make([]byte, ntpPacketSize)
+			// No leap indicator, version 4, server mode
+			response[0] = 0x24
+			response[1] = stratum
+			copy(response[12:16], "RATE")
+			copy(response[24:32], request[40:48])
+			putNTPTime(response[32:40], time.Now().Add(skew))
+			putNTPTime(response[40:48], time.Now().Add(skew))
+			conn.WriteTo(response, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNTPTimeRoundTrip(t *testing.T) {
+	now := time.Unix(1700000000, 123456789)
+	b := make([]byte, 8)
+	putNTPTime(b, now)
+	assert.WithinDuration(t, now, ntpTime(b), time.Microsecond)
+}
+
+func TestNTPTimeRoundTripAfterEraRollover(t *testing.T) {
+	for _, date := range []time.Time{
+		time.Date(2036, time.February, 7, 6, 28, 15, 0, time.UTC),
+		time.Date(2036, time.February, 7, 6, 28, 16, 0, time.UTC),
+		time.Date(2050, time.June, 1, 12, 0, 0, 500, time.UTC),
+	} {
+		b := make([]byte, 8)
+		putNTPTime(b, date)
+		assert.WithinDuration(t, date, ntpTime(b), time.Microsecond, "wrong time decoded for %s", date)
+	}
+}
+
+func TestNTPSyncCheckRunCheck(t *testing.T) {
+	testcases := []struct {
+		name           string
+		skew           time.Duration
+		expectedStatus HealthcheckStatus
+	}{
+		{
+			name:           "clock in sync",
+			skew:           0,
+			expectedStatus: HealthcheckStatusOk,
+		},
+		{
+			name:           "clock behind below the threshold",
+			skew:           90 * time.Second,
+			expectedStatus: HealthcheckStatusOk,
+		},
+		{
+			name:           "clock behind above the threshold",
+			skew:           5 * time.Minute,
+			expectedStatus: HealthcheckStatusImpaired,
+		},
+		{
+			name:           "clock ahead above the threshold",
+			skew:           -5 * time.Minute,
+			expectedStatus: HealthcheckStatusImpaired,
+		},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := startMockNTPResponder(t, tc.skew, 2)
+			check := NewNTPSyncCheck(server, 2*time.Minute)
+			assert.Equal(t, HealthcheckStatusInitializing, check.GetHealthcheckStatus())
+			assert.Equal(t, tc.expectedStatus, check.RunCheck())
+			assert.Equal(t, tc.expectedStatus, check.GetHealthcheckStatus())
+			assert.Equal(t, HealthcheckStatusInitializing, check.GetLastHealthcheckStatus())
+			assert.InDelta(t, tc.skew.Seconds(), check.GetSkew().Seconds(), 1)
+		})
+	}
+}
+
+func TestNTPSyncCheckCheckSkew(t *testing.T) {
+	check := NewNTPSyncCheck(startMockNTPResponder(t, 10*time.Minute, 2), 2*time.Minute)
+	err := check.CheckSkew(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "above the threshold of 2m0s")
+
+	check = NewNTPSyncCheck(startMockNTPResponder(t, time.Second, 2), 2*time.Minute)
+	assert.NoError(t, check.CheckSkew(context.Background()))
+}
+
+func TestNTPSyncCheckServerNotAnswering(t *testing.T) {
+	// A listener that never answers
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	check := NewNTPSyncCheck(conn.LocalAddr().String(), 2*time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	// The check isn't updated when cancelled
+	assert.Equal(t, HealthcheckStatusUnknown, check.RunCheckWithContext(ctx))
+	assert.Equal(t, HealthcheckStatusInitializing, check.GetHealthcheckStatus())
+	// The clock isn't considered skewed when the server doesn't answer
+	assert.NoError(t, check.CheckSkew(ctx))
+}
+
+func TestNTPSyncCheckKissOfDeath(t *testing.T) {
+	check := NewNTPSyncCheck(startMockNTPResponder(t, 10*time.Minute, 0), 2*time.Minute)
+	assert.Equal(t, HealthcheckStatusUnknown, check.RunCheck())
+	assert.Equal(t, HealthcheckStatusUnknown, check.GetHealthcheckStatus())
+	assert.NoError(t, check.CheckSkew(context.Background()))
+}
@@ -88,3 +88,7 @@ func (blackholeMetadataClient) OutpostARN() (string, error) {
 func (blackholeMetadataClient) TargetLifecycleState() (string, error) {
 	return "", errors.New("blackholed")
 }
+
+func (blackholeMetadataClient) InstanceType() (string, error) {
+	return "", errors.New("blackholed")
+}
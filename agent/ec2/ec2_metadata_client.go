@@ -41,6 +41,7 @@ const (
 	OutpostARN                                = "outpost-arn"
 	PrimaryIPV4VPCCIDRResourceFormat          = "network/interfaces/macs/%s/vpc-ipv4-cidr-block"
 	TargetLifecycleState                      = "autoscaling/target-lifecycle-state"
+	InstanceTypeResource                      = "instance-type"
 )
 
 const (
@@ -84,6 +85,7 @@ type EC2MetadataClient interface {
 	SpotInstanceAction() (string, error)
 	OutpostARN() (string, error)
 	TargetLifecycleState() (string, error)
+	InstanceType() (string, error)
 }
 
 type ec2MetadataClientImpl struct {
@@ -209,3 +211,8 @@ func (c *ec2MetadataClientImpl) OutpostARN() (string, error) {
 func (c *ec2MetadataClientImpl) TargetLifecycleState() (string, error) {
 	return c.client.GetMetadata(TargetLifecycleState)
 }
+
+// InstanceType returns the type of this instance, such as "m5.large"
+func (c *ec2MetadataClientImpl) InstanceType() (string, error) {
+	return c.client.GetMetadata(InstanceTypeResource)
+}
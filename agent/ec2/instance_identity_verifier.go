@@ -0,0 +1,101 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ec2
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/pkg/errors"
+)
+
+// InstanceIdentityVerifier verifies the signature of the instance identity
+// document retrieved from the instance metadata service against the AWS public
+// certificate of the region, to make sure the instance ID the agent identifies
+// itself with hasn't been forged. The verified document is cached for the
+// lifetime of the process
+type InstanceIdentityVerifier struct {
+	client      EC2MetadataClient
+	certificate *x509.Certificate
+	lock        sync.Mutex
+	document    *ec2metadata.EC2InstanceIdentityDocument
+}
+
+// NewInstanceIdentityVerifier returns a new InstanceIdentityVerifier object
+// verifying the document against the PEM encoded certificate
+func NewInstanceIdentityVerifier(client EC2MetadataClient, certificatePEM []byte) (*InstanceIdentityVerifier, error) {
+	block, _ := pem.Decode(certificatePEM)
+	if block == nil {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse certificate")
+	}
+	return &InstanceIdentityVerifier{
+		client:      client,
+		certificate: certificate,
+	}, nil
+}
+
+// Verify fetches the instance identity document and its signature and verifies
+// the signature. It also makes sure the instance ID of the document is the one
+// reported by the instance metadata service. It returns the verified document
+func (verifier *InstanceIdentityVerifier) Verify() (ec2metadata.EC2InstanceIdentityDocument, error) {
+	verifier.lock.Lock()
+	defer verifier.lock.Unlock()
+	if verifier.document != nil {
+		return *verifier.document, nil
+	}
+
+	rawDocument, err := verifier.client.GetDynamicData(InstanceIdentityDocumentResource)
+	if err != nil {
+		return ec2metadata.EC2InstanceIdentityDocument{}, errors.Wrap(err, "unable to get instance identity document")
+	}
+	encodedSignature, err := verifier.client.GetDynamicData(InstanceIdentityDocumentSignatureResource)
+	if err != nil {
+		return ec2metadata.EC2InstanceIdentityDocument{}, errors.Wrap(err, "unable to get instance identity document signature")
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedSignature))
+	if err != nil {
+		return ec2metadata.EC2InstanceIdentityDocument{}, errors.Wrap(err, "unable to decode instance identity document signature")
+	}
+	err = verifier.certificate.CheckSignature(x509.SHA256WithRSA, []byte(rawDocument), signature)
+	if err != nil {
+		return ec2metadata.EC2InstanceIdentityDocument{}, errors.Wrap(err, "invalid instance identity document signature")
+	}
+
+	var document ec2metadata.EC2InstanceIdentityDocument
+	if err := json.Unmarshal([]byte(rawDocument), &document); err != nil {
+		return ec2metadata.EC2InstanceIdentityDocument{}, errors.Wrap(err, "unable to parse instance identity document")
+	}
+	instanceID, err := verifier.client.InstanceID()
+	if err != nil {
+		return ec2metadata.EC2InstanceIdentityDocument{}, errors.Wrap(err, "unable to get instance ID")
+	}
+	if instanceID != document.InstanceID {
+		return ec2metadata.EC2InstanceIdentityDocument{}, fmt.Errorf(
+			"instance ID %s doesn't match the instance ID %s of the instance identity document",
+			instanceID, document.InstanceID)
+	}
+
+	verifier.document = &document
+	return document, nil
+}
@@ -0,0 +1,155 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ec2_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/ec2"
+	mock_ec2 "github.com/aws/amazon-ecs-agent/agent/ec2/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIdentityDocument = `{"instanceId":"i-01234567","region":"us-west-2","accountId":"012345678901"}`
+
+// newTestIdentityCertificate returns a self signed PEM encoded certificate and
+// its private key to sign test instance identity documents with
+func newTestIdentityCertificate(t *testing.T) ([]byte, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"Amazon Web Services LLC"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), key
+}
+
+func signIdentityDocument(t *testing.T, key *rsa.PrivateKey, document string) string {
+	digest := sha256.Sum256([]byte(document))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+func TestInstanceIdentityVerifierValidSignature(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMetadata := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	certificate, key := newTestIdentityCertificate(t)
+
+	// The document is only fetched once, it is cached once verified
+	mockMetadata.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentResource).Return(testIdentityDocument, nil)
+	mockMetadata.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentSignatureResource).Return(
+		signIdentityDocument(t, key, testIdentityDocument), nil)
+	mockMetadata.EXPECT().InstanceID().Return("i-01234567", nil)
+
+	verifier, err := ec2.NewInstanceIdentityVerifier(mockMetadata, certificate)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		document, err := verifier.Verify()
+		require.NoError(t, err)
+		assert.Equal(t, "i-01234567", document.InstanceID)
+		assert.Equal(t, "us-west-2", document.Region)
+	}
+}
+
+func TestInstanceIdentityVerifierInvalidSignature(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMetadata := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	certificate, key := newTestIdentityCertificate(t)
+
+	forgedDocument := `{"instanceId":"i-forged","region":"us-west-2","accountId":"012345678901"}`
+	mockMetadata.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentResource).Return(forgedDocument, nil)
+	mockMetadata.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentSignatureResource).Return(
+		signIdentityDocument(t, key, testIdentityDocument), nil)
+
+	verifier, err := ec2.NewInstanceIdentityVerifier(mockMetadata, certificate)
+	require.NoError(t, err)
+	_, err = verifier.Verify()
+	assert.Error(t, err)
+}
+
+func TestInstanceIdentityVerifierSignedByAnotherKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMetadata := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	certificate, _ := newTestIdentityCertificate(t)
+	_, otherKey := newTestIdentityCertificate(t)
+
+	mockMetadata.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentResource).Return(testIdentityDocument, nil)
+	mockMetadata.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentSignatureResource).Return(
+		signIdentityDocument(t, otherKey, testIdentityDocument), nil)
+
+	verifier, err := ec2.NewInstanceIdentityVerifier(mockMetadata, certificate)
+	require.NoError(t, err)
+	_, err = verifier.Verify()
+	assert.Error(t, err)
+}
+
+func TestInstanceIdentityVerifierInstanceIDMismatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMetadata := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	certificate, key := newTestIdentityCertificate(t)
+
+	mockMetadata.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentResource).Return(testIdentityDocument, nil)
+	mockMetadata.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentSignatureResource).Return(
+		signIdentityDocument(t, key, testIdentityDocument), nil)
+	mockMetadata.EXPECT().InstanceID().Return("i-forged", nil)
+
+	verifier, err := ec2.NewInstanceIdentityVerifier(mockMetadata, certificate)
+	require.NoError(t, err)
+	_, err = verifier.Verify()
+	assert.Error(t, err)
+}
+
+func TestInstanceIdentityVerifierMetadataError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockMetadata := mock_ec2.NewMockEC2MetadataClient(ctrl)
+	certificate, _ := newTestIdentityCertificate(t)
+
+	mockMetadata.EXPECT().GetDynamicData(ec2.InstanceIdentityDocumentResource).Return("", errors.New("timeout"))
+
+	verifier, err := ec2.NewInstanceIdentityVerifier(mockMetadata, certificate)
+	require.NoError(t, err)
+	_, err = verifier.Verify()
+	assert.Error(t, err)
+}
+
+func TestNewInstanceIdentityVerifierInvalidCertificate(t *testing.T) {
+	_, err := ec2.NewInstanceIdentityVerifier(nil, []byte("not a certificate"))
+	assert.Error(t, err)
+}
@@ -156,6 +156,21 @@ func (mr *MockEC2MetadataClientMockRecorder) InstanceIdentityDocument() *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstanceIdentityDocument", reflect.TypeOf((*MockEC2MetadataClient)(nil).InstanceIdentityDocument))
 }
 
+// InstanceType mocks base method
+func (m *MockEC2MetadataClient) InstanceType() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InstanceType")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// InstanceType indicates an expected call of InstanceType
+func (mr *MockEC2MetadataClientMockRecorder) InstanceType() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InstanceType", reflect.TypeOf((*MockEC2MetadataClient)(nil).InstanceType))
+}
+
 // OutpostARN mocks base method
 func (m *MockEC2MetadataClient) OutpostARN() (string, error) {
 	m.ctrl.T.Helper()
@@ -192,6 +192,20 @@ func (engine *DockerTaskEngine) saveTaskData(task *apitask.Task) {
 	}
 }
 
+func (engine *DockerTaskEngine) saveCompletedTaskData(task *apitask.Task) {
+	err := engine.dataClient.SaveCompletedTask(task)
+	if err != nil {
+		seelog.Errorf("Failed to save data for completed task %s: %v", task.Arn, err)
+	}
+}
+
+func (engine *DockerTaskEngine) purgeCompletedTaskData() {
+	err := engine.dataClient.PurgeCompletedTasks(engine.cfg.CompletedTaskHistoryTTL)
+	if err != nil {
+		seelog.Errorf("Failed to purge data for completed tasks: %v", err)
+	}
+}
+
 func (engine *DockerTaskEngine) saveContainerData(container *apicontainer.Container) {
 	err := engine.dataClient.SaveContainer(container)
 	if err != nil {
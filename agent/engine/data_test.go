@@ -20,11 +20,13 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
 	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
 	"github.com/aws/amazon-ecs-agent/agent/api/eni"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/data"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	"github.com/aws/amazon-ecs-agent/agent/engine/image"
@@ -223,6 +225,33 @@ func TestSaveAndRemoveTaskData(t *testing.T) {
 	assert.Len(t, tasks, 0)
 }
 
+func TestSaveAndPurgeCompletedTaskData(t *testing.T) {
+	dataClient, cleanup := newTestDataClient(t)
+	defer cleanup()
+
+	engine := &DockerTaskEngine{
+		dataClient: dataClient,
+		cfg:        &config.Config{CompletedTaskHistoryTTL: time.Hour},
+	}
+	engine.saveCompletedTaskData(testTask)
+	tasks, err := engine.CompletedTasks()
+	require.NoError(t, err)
+	require.Len(t, tasks, 1)
+	assert.Equal(t, testTaskARN, tasks[0].Arn)
+
+	// The task was completed less than the TTL ago, it's kept
+	engine.purgeCompletedTaskData()
+	tasks, err = engine.CompletedTasks()
+	require.NoError(t, err)
+	assert.Len(t, tasks, 1)
+
+	engine.cfg.CompletedTaskHistoryTTL = time.Nanosecond
+	engine.purgeCompletedTaskData()
+	tasks, err = engine.CompletedTasks()
+	require.NoError(t, err)
+	assert.Len(t, tasks, 0)
+}
+
 func TestSaveContainerData(t *testing.T) {
 	dataClient, cleanup := newTestDataClient(t)
 	defer cleanup()
@@ -102,6 +102,8 @@ const (
 
 	defaultMonitorExecAgentsInterval = 15 * time.Minute
 
+	defaultCompletedTaskPurgeInterval = 5 * time.Minute
+
 	defaultStopContainerBackoffMin = time.Second
 	defaultStopContainerBackoffMax = time.Second * 5
 	stopContainerBackoffJitter     = 0.2
@@ -176,9 +178,25 @@ type DockerTaskEngine struct {
 	monitorExecAgentsTicker   *time.Ticker
 	execCmdMgr                execcmd.Manager
 	monitorExecAgentsInterval time.Duration
-	stopContainerBackoffMin   time.Duration
-	stopContainerBackoffMax   time.Duration
-	namespaceHelper           ecscni.NamespaceHelper
+	// completedTaskPurgeInterval is the interval at which the completed tasks older than
+	// the history TTL are deleted
+	completedTaskPurgeInterval time.Duration
+	stopContainerBackoffMin    time.Duration
+	stopContainerBackoffMax    time.Duration
+	namespaceHelper            ecscni.NamespaceHelper
+	// managedAgentSocketDir is the directory containing the sockets of the
+	// managed agents of the tasks
+	managedAgentSocketDir     string
+	managedAgentUpdateTimeout time.Duration
+	// managedAgentConfigs maps a task arn and managed agent type to the last
+	// configuration acknowledged by the managed agent
+	managedAgentConfigs     map[string]string
+	managedAgentConfigsLock sync.Mutex
+	// launchTracker records the launch latencies of the task families
+	launchTracker *TaskFamilyLaunchTracker
+	// taskMetadataCache holds the metadata of the tasks received from ACS,
+	// which is removed once the tasks are cleaned up
+	taskMetadataCache *containermetadata.TaskMetadataCache
 }
 
 // NewDockerTaskEngine returns a created, but uninitialized, DockerTaskEngine.
@@ -217,9 +235,14 @@ func NewDockerTaskEngine(cfg *config.Config,
 		handleDelay:                       time.Sleep,
 		execCmdMgr:                        execCmdMgr,
 		monitorExecAgentsInterval:         defaultMonitorExecAgentsInterval,
+		completedTaskPurgeInterval:        defaultCompletedTaskPurgeInterval,
 		stopContainerBackoffMin:           defaultStopContainerBackoffMin,
 		stopContainerBackoffMax:           defaultStopContainerBackoffMax,
 		namespaceHelper:                   ecscni.NewNamespaceHelper(client),
+		managedAgentSocketDir:             defaultManagedAgentSocketDir,
+		managedAgentUpdateTimeout:         defaultManagedAgentUpdateTimeout,
+		managedAgentConfigs:               make(map[string]string),
+		launchTracker:                     NewTaskFamilyLaunchTracker(),
 	}
 
 	dockerTaskEngine.initializeContainerStatusToTransitionFunction()
@@ -273,6 +296,7 @@ func (engine *DockerTaskEngine) Init(ctx context.Context) error {
 	go engine.handleDockerEvents(derivedCtx)
 	engine.initialized = true
 	go engine.startPeriodicExecAgentsMonitoring(derivedCtx)
+	go engine.startPeriodicCompletedTaskPurge(derivedCtx)
 	return nil
 }
 
@@ -289,6 +313,27 @@ func (engine *DockerTaskEngine) startPeriodicExecAgentsMonitoring(ctx context.Co
 	}
 }
 
+// startPeriodicCompletedTaskPurge periodically deletes the completed tasks that were
+// cleaned up longer than the completed task history TTL ago
+func (engine *DockerTaskEngine) startPeriodicCompletedTaskPurge(ctx context.Context) {
+	ticker := time.NewTicker(engine.completedTaskPurgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			engine.purgeCompletedTaskData()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// CompletedTasks returns the tasks that were cleaned up less than the completed
+// task history TTL ago
+func (engine *DockerTaskEngine) CompletedTasks() ([]*apitask.Task, error) {
+	return engine.dataClient.GetCompletedTasks()
+}
+
 func (engine *DockerTaskEngine) monitorExecAgentProcesses(ctx context.Context) {
 	// TODO: [ecs-exec]add jitter between containers to not overload docker with top calls
 	engine.tasksLock.RLock()
@@ -377,6 +422,12 @@ func (engine *DockerTaskEngine) SetDataClient(client data.Client) {
 	engine.dataClient = client
 }
 
+// SetTaskMetadataCache sets the cache of the metadata of the tasks received from
+// ACS, from which the tasks are removed once cleaned up
+func (engine *DockerTaskEngine) SetTaskMetadataCache(cache *containermetadata.TaskMetadataCache) {
+	engine.taskMetadataCache = cache
+}
+
 func (engine *DockerTaskEngine) Context() context.Context {
 	return engine.ctx
 }
@@ -709,6 +760,11 @@ func (engine *DockerTaskEngine) deleteTask(task *apitask.Task) {
 		}
 	}
 
+	// Keep the task queryable through the introspection API for a while
+	engine.saveCompletedTaskData(task)
+	engine.launchTracker.forget(task.Arn)
+	engine.taskMetadataCache.Remove(task.Arn)
+
 	// Now remove ourselves from the global state and cleanup channels
 	engine.tasksLock.Lock()
 	engine.state.RemoveTask(task)
@@ -900,6 +956,12 @@ func (engine *DockerTaskEngine) StateChangeEvents() chan statechange.Event {
 	return engine.stateChangeEvents
 }
 
+// TaskFamilyLaunchTracker returns the tracker of the launch latencies of the
+// task families
+func (engine *DockerTaskEngine) TaskFamilyLaunchTracker() *TaskFamilyLaunchTracker {
+	return engine.launchTracker
+}
+
 // AddTask starts tracking a task
 func (engine *DockerTaskEngine) AddTask(task *apitask.Task) {
 	defer metrics.MetricsEngineGlobal.RecordTaskEngineMetric("ADD_TASK")()
@@ -928,6 +990,7 @@ func (engine *DockerTaskEngine) AddTask(task *apitask.Task) {
 		engine.updateTaskENIDependencies(task)
 
 		engine.state.AddTask(task)
+		engine.launchTracker.received(task)
 		if dependencygraph.ValidDependencies(task, engine.cfg) {
 			engine.startTask(task)
 		} else {
@@ -33,6 +33,7 @@ import (
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/containermetadata"
 	"github.com/aws/amazon-ecs-agent/agent/credentials"
 	"github.com/aws/amazon-ecs-agent/agent/data"
 	"github.com/aws/amazon-ecs-agent/agent/dockerclient/dockerapi"
@@ -199,6 +200,10 @@ func TestDeleteTask(t *testing.T) {
 	tasks, err := dataClient.GetTasks()
 	require.NoError(t, err)
 	assert.Len(t, tasks, 0)
+	completedTasks, err := dataClient.GetCompletedTasks()
+	require.NoError(t, err)
+	require.Len(t, completedTasks, 1)
+	assert.Equal(t, testTaskARN, completedTasks[0].Arn)
 	attachments, err = taskEngine.dataClient.GetENIAttachments()
 	assert.NoError(t, err)
 	assert.Len(t, attachments, 0)
@@ -225,10 +230,13 @@ func TestDeleteTaskBranchENIEnabled(t *testing.T) {
 	cfg.TaskCPUMemLimit.Value = config.ExplicitlyEnabled
 	mockState := mock_dockerstate.NewMockTaskEngineState(ctrl)
 
+	taskMetadataCache := containermetadata.NewTaskMetadataCache()
+	taskMetadataCache.Update(task)
 	taskEngine := &DockerTaskEngine{
-		state:      mockState,
-		cfg:        &cfg,
-		dataClient: data.NewNoopClient(),
+		state:             mockState,
+		cfg:               &cfg,
+		dataClient:        data.NewNoopClient(),
+		taskMetadataCache: taskMetadataCache,
 	}
 
 	gomock.InOrder(
@@ -237,6 +245,8 @@ func TestDeleteTaskBranchENIEnabled(t *testing.T) {
 	)
 
 	taskEngine.deleteTask(task)
+	_, ok := taskMetadataCache.Task(testTaskARN)
+	assert.False(t, ok, "the task should be removed from the task metadata cache")
 }
 
 // TestResourceContainerProgressionFailure ensures that task moves to STOPPED when
@@ -49,6 +49,10 @@ type TaskEngine interface {
 	// GetTaskByArn gets a managed task, given a task arn.
 	GetTaskByArn(string) (*apitask.Task, bool)
 
+	// UpdateManagedAgent pushes a configuration update to a managed agent of
+	// a task. It returns once the managed agent has acknowledged the update.
+	UpdateManagedAgent(taskARN, agentType, configBlob string) error
+
 	Version() (string, error)
 
 	// LoadState loads the task engine state with data in db.
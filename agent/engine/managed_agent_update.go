@@ -0,0 +1,132 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/logger"
+	"github.com/aws/amazon-ecs-agent/agent/logger/field"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultManagedAgentSocketDir is the directory in which managed sidecar
+	// agents, such as the Service Connect agent, create the unix sockets the
+	// agent pushes their configuration updates to. The socket of an agent is
+	// <dir>/<task id>/<agent type>.sock
+	defaultManagedAgentSocketDir = "/var/run/ecs/managed-agents"
+	// defaultManagedAgentUpdateTimeout is the time a managed agent has to
+	// acknowledge a configuration update
+	defaultManagedAgentUpdateTimeout = 30 * time.Second
+	// managedAgentUpdateAckStatus is the status sent back by a managed agent
+	// that has applied a configuration update
+	managedAgentUpdateAckStatus = "ACK"
+)
+
+// managedAgentUpdateRequest is the configuration update sent to a managed agent
+type managedAgentUpdateRequest struct {
+	AgentType string `json:"agentType"`
+	Config    string `json:"config"`
+}
+
+// managedAgentUpdateResponse is the response of a managed agent to a
+// configuration update
+type managedAgentUpdateResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// UpdateManagedAgent pushes a configuration update to a managed agent of the
+// task through its local unix socket. It returns once the managed agent has
+// acknowledged the update. If the managed agent fails to acknowledge it, the
+// last configuration the managed agent acknowledged is pushed back to it, so
+// that it isn't left with a partially applied update, and an error is returned
+func (engine *DockerTaskEngine) UpdateManagedAgent(taskARN, agentType, configBlob string) error {
+	task, ok := engine.state.TaskByArn(taskARN)
+	if !ok {
+		return errors.Errorf("managed agent update: task %s not found", taskARN)
+	}
+	if task.GetDesiredStatus().Terminal() {
+		return errors.Errorf("managed agent update: task %s is stopping", taskARN)
+	}
+	socketPath := filepath.Join(engine.managedAgentSocketDir, task.GetID(), agentType+".sock")
+	configKey := taskARN + "/" + agentType
+
+	engine.managedAgentConfigsLock.Lock()
+	defer engine.managedAgentConfigsLock.Unlock()
+	err := engine.pushManagedAgentConfig(socketPath, agentType, configBlob)
+	if err == nil {
+		engine.managedAgentConfigs[configKey] = configBlob
+		logger.Info("Managed agent acknowledged configuration update", logger.Fields{
+			field.TaskID:       task.GetID(),
+			field.ManagedAgent: agentType,
+		})
+		return nil
+	}
+
+	if previousConfig, ok := engine.managedAgentConfigs[configKey]; ok {
+		if rollbackErr := engine.pushManagedAgentConfig(socketPath, agentType, previousConfig); rollbackErr != nil {
+			logger.Error("Unable to roll back the configuration of the managed agent", logger.Fields{
+				field.TaskID:       task.GetID(),
+				field.ManagedAgent: agentType,
+				field.Error:        rollbackErr,
+			})
+		} else {
+			logger.Warn("Rolled back the configuration of the managed agent", logger.Fields{
+				field.TaskID:       task.GetID(),
+				field.ManagedAgent: agentType,
+			})
+		}
+	}
+	return errors.Wrapf(err, "managed agent update: %s agent of task %s did not acknowledge the update",
+		agentType, taskARN)
+}
+
+// pushManagedAgentConfig sends the configuration to the managed agent listening
+// on the socket and waits for it to be acknowledged
+func (engine *DockerTaskEngine) pushManagedAgentConfig(socketPath, agentType, configBlob string) error {
+	conn, err := net.DialTimeout("unix", socketPath, engine.managedAgentUpdateTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(engine.managedAgentUpdateTimeout)); err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(conn).Encode(managedAgentUpdateRequest{
+		AgentType: agentType,
+		Config:    configBlob,
+	}); err != nil {
+		return err
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	var response managedAgentUpdateResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return err
+	}
+	if response.Status != managedAgentUpdateAckStatus {
+		return fmt.Errorf("update rejected with status %s: %s", response.Status, response.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+//go:build linux && unit
+// +build linux,unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	managedAgentTestTaskARN   = "arn:aws:ecs:us-west-2:123456789012:task/default/0123456789abcdef"
+	managedAgentTestAgentType = "ServiceConnect"
+)
+
+// fakeManagedAgent listens on the socket of a managed agent and answers the
+// configuration updates it receives with the status returned by respond. No
+// response is sent if the status is empty
+type fakeManagedAgent struct {
+	listener net.Listener
+	respond  func(config string) string
+	lock     sync.Mutex
+	received []string
+}
+
+func newFakeManagedAgent(t *testing.T, socketDir string, respond func(config string) string) *fakeManagedAgent {
+	socketPath := filepath.Join(socketDir, "0123456789abcdef", managedAgentTestAgentType+".sock")
+	require.NoError(t, os.MkdirAll(filepath.Dir(socketPath), 0700))
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	agent := &fakeManagedAgent{listener: listener, respond: respond}
+	go agent.serve()
+	return agent
+}
+
+func (agent *fakeManagedAgent) serve() {
+	for {
+		conn, err := agent.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			line, err := bufio.NewReader(conn).ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			var request managedAgentUpdateRequest
+			if err := json.Unmarshal(line, &request); err != nil {
+				return
+			}
+			agent.lock.Lock()
+			agent.received = append(agent.received, request.Config)
+			agent.lock.Unlock()
+			status := agent.respond(request.Config)
+			if status == "" {
+				// Keep the connection open without answering
+				ioutil.ReadAll(conn)
+				return
+			}
+			json.NewEncoder(conn).Encode(managedAgentUpdateResponse{Status: status})
+		}()
+	}
+}
+
+func (agent *fakeManagedAgent) receivedConfigs() []string {
+	agent.lock.Lock()
+	defer agent.lock.Unlock()
+	return append([]string{}, agent.received...)
+}
+
+func newManagedAgentTestEngine(t *testing.T) (*DockerTaskEngine, string) {
+	socketDir, err := ioutil.TempDir("", "managed-agents")
+	require.NoError(t, err)
+	engine := &DockerTaskEngine{
+		state:                     dockerstate.NewTaskEngineState(),
+		managedAgentSocketDir:     socketDir,
+		managedAgentUpdateTimeout: 200 * time.Millisecond,
+		managedAgentConfigs:       make(map[string]string),
+	}
+	task := &apitask.Task{
+		Arn:                 managedAgentTestTaskARN,
+		DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+	}
+	engine.state.AddTask(task)
+	return engine, socketDir
+}
+
+func TestUpdateManagedAgent(t *testing.T) {
+	engine, socketDir := newManagedAgentTestEngine(t)
+	defer os.RemoveAll(socketDir)
+	agent := newFakeManagedAgent(t, socketDir, func(string) string { return managedAgentUpdateAckStatus })
+	defer agent.listener.Close()
+
+	require.NoError(t, engine.UpdateManagedAgent(managedAgentTestTaskARN, managedAgentTestAgentType, "config-v1"))
+	assert.Equal(t, []string{"config-v1"}, agent.receivedConfigs())
+	assert.Equal(t, "config-v1", engine.managedAgentConfigs[managedAgentTestTaskARN+"/"+managedAgentTestAgentType])
+}
+
+func TestUpdateManagedAgentAckTimeout(t *testing.T) {
+	engine, socketDir := newManagedAgentTestEngine(t)
+	defer os.RemoveAll(socketDir)
+	agent := newFakeManagedAgent(t, socketDir, func(string) string { return "" })
+	defer agent.listener.Close()
+
+	start := time.Now()
+	assert.Error(t, engine.UpdateManagedAgent(managedAgentTestTaskARN, managedAgentTestAgentType, "config-v1"))
+	assert.True(t, time.Since(start) < 5*time.Second, "update did not time out")
+	assert.Empty(t, engine.managedAgentConfigs)
+}
+
+func TestUpdateManagedAgentRollsBackRejectedUpdate(t *testing.T) {
+	engine, socketDir := newManagedAgentTestEngine(t)
+	defer os.RemoveAll(socketDir)
+	agent := newFakeManagedAgent(t, socketDir, func(config string) string {
+		if config == "config-v2" {
+			return "NACK"
+		}
+		return managedAgentUpdateAckStatus
+	})
+	defer agent.listener.Close()
+
+	require.NoError(t, engine.UpdateManagedAgent(managedAgentTestTaskARN, managedAgentTestAgentType, "config-v1"))
+	assert.Error(t, engine.UpdateManagedAgent(managedAgentTestTaskARN, managedAgentTestAgentType, "config-v2"))
+	// The last acknowledged configuration is pushed back to the managed agent
+	assert.Equal(t, []string{"config-v1", "config-v2", "config-v1"}, agent.receivedConfigs())
+	assert.Equal(t, "config-v1", engine.managedAgentConfigs[managedAgentTestTaskARN+"/"+managedAgentTestAgentType])
+}
+
+func TestUpdateManagedAgentUnknownTask(t *testing.T) {
+	engine, socketDir := newManagedAgentTestEngine(t)
+	defer os.RemoveAll(socketDir)
+
+	assert.Error(t, engine.UpdateManagedAgent("arn:aws:ecs:us-west-2:123456789012:task/default/unknown",
+		managedAgentTestAgentType, "config-v1"))
+}
+
+func TestUpdateManagedAgentNotListening(t *testing.T) {
+	engine, socketDir := newManagedAgentTestEngine(t)
+	defer os.RemoveAll(socketDir)
+
+	assert.Error(t, engine.UpdateManagedAgent(managedAgentTestTaskARN, managedAgentTestAgentType, "config-v1"))
+}
@@ -216,6 +216,20 @@ func (mr *MockTaskEngineMockRecorder) UnmarshalJSON(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnmarshalJSON", reflect.TypeOf((*MockTaskEngine)(nil).UnmarshalJSON), arg0)
 }
 
+// UpdateManagedAgent mocks base method
+func (m *MockTaskEngine) UpdateManagedAgent(arg0, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateManagedAgent", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateManagedAgent indicates an expected call of UpdateManagedAgent
+func (mr *MockTaskEngineMockRecorder) UpdateManagedAgent(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateManagedAgent", reflect.TypeOf((*MockTaskEngine)(nil).UpdateManagedAgent), arg0, arg1, arg2)
+}
+
 // Version mocks base method
 func (m *MockTaskEngine) Version() (string, error) {
 	m.ctrl.T.Helper()
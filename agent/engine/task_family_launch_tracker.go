@@ -0,0 +1,211 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	handlersutils "github.com/aws/amazon-ecs-agent/agent/handlers/utils"
+)
+
+const (
+	// maxTaskFamilyLaunches is the maximum number of task families whose
+	// launch latencies are tracked. The families with the fewest launches are
+	// evicted first
+	maxTaskFamilyLaunches = 100
+	// maxPendingTaskLaunches bounds the number of tasks waiting for their
+	// first container to run
+	maxPendingTaskLaunches = 5000
+	infiniteBucketBound    = "+Inf"
+)
+
+// launchLatencyBuckets are the upper bounds of the launch latency histogram
+// buckets. The last bucket has no upper bound
+var launchLatencyBuckets = []time.Duration{
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+	2 * time.Minute,
+	5 * time.Minute,
+	10 * time.Minute,
+}
+
+// TaskFamilyLaunchTracker records the launch latency of tasks, from the
+// receipt of their payload to their first container running, as a histogram
+// per task family. The histograms are only kept in memory
+type TaskFamilyLaunchTracker struct {
+	lock sync.Mutex
+	// pending maps the arn of the tasks whose containers haven't run yet to
+	// their family and the time their payload was received
+	pending  map[string]pendingTaskLaunch
+	families map[string]*launchLatencyHistogram
+	now      func() time.Time
+}
+
+type pendingTaskLaunch struct {
+	family     string
+	receivedAt time.Time
+}
+
+type launchLatencyHistogram struct {
+	count      uint64
+	sum        time.Duration
+	min        time.Duration
+	max        time.Duration
+	buckets    []uint64
+	lastUpdate time.Time
+}
+
+// NewTaskFamilyLaunchTracker creates a TaskFamilyLaunchTracker
+func NewTaskFamilyLaunchTracker() *TaskFamilyLaunchTracker {
+	return &TaskFamilyLaunchTracker{
+		pending:  make(map[string]pendingTaskLaunch),
+		families: make(map[string]*launchLatencyHistogram),
+		now:      time.Now,
+	}
+}
+
+// received records that the payload of a task was received
+func (tracker *TaskFamilyLaunchTracker) received(task *apitask.Task) {
+	if tracker == nil {
+		return
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	if _, ok := tracker.pending[task.Arn]; ok || len(tracker.pending) >= maxPendingTaskLaunches {
+		return
+	}
+	tracker.pending[task.Arn] = pendingTaskLaunch{
+		family:     task.Family,
+		receivedAt: tracker.now(),
+	}
+}
+
+// containerRunning records that a container of a task is running. Only the
+// first container running after the receipt of the task's payload is recorded
+func (tracker *TaskFamilyLaunchTracker) containerRunning(task *apitask.Task) {
+	if tracker == nil {
+		return
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	launch, ok := tracker.pending[task.Arn]
+	if !ok {
+		return
+	}
+	delete(tracker.pending, task.Arn)
+	now := tracker.now()
+	histogram, ok := tracker.families[launch.family]
+	if !ok {
+		if len(tracker.families) >= maxTaskFamilyLaunches {
+			tracker.evictFamilyUnsafe()
+		}
+		histogram = &launchLatencyHistogram{buckets: make([]uint64, len(launchLatencyBuckets)+1)}
+		tracker.families[launch.family] = histogram
+	}
+	histogram.observe(now.Sub(launch.receivedAt), now)
+}
+
+// forget stops tracking the launch of a task, if its containers never ran
+func (tracker *TaskFamilyLaunchTracker) forget(taskArn string) {
+	if tracker == nil {
+		return
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	delete(tracker.pending, taskArn)
+}
+
+// evictFamilyUnsafe evicts the family with the fewest launches, the least
+// recently updated one on ties
+func (tracker *TaskFamilyLaunchTracker) evictFamilyUnsafe() {
+	var evicted string
+	var evictedHistogram *launchLatencyHistogram
+	for family, histogram := range tracker.families {
+		if evictedHistogram == nil || histogram.count < evictedHistogram.count ||
+			(histogram.count == evictedHistogram.count && histogram.lastUpdate.Before(evictedHistogram.lastUpdate)) {
+			evicted = family
+			evictedHistogram = histogram
+		}
+	}
+	delete(tracker.families, evicted)
+}
+
+// ListTaskFamilyLaunches lists the launch latencies of the task families,
+// the families with the most launches first
+func (tracker *TaskFamilyLaunchTracker) ListTaskFamilyLaunches() []handlersutils.TaskFamilyLaunches {
+	launches := []handlersutils.TaskFamilyLaunches{}
+	if tracker == nil {
+		return launches
+	}
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	for family, histogram := range tracker.families {
+		launches = append(launches, histogram.toResponse(family))
+	}
+	sort.Slice(launches, func(i, j int) bool {
+		if launches[i].Count != launches[j].Count {
+			return launches[i].Count > launches[j].Count
+		}
+		return launches[i].Family < launches[j].Family
+	})
+	return launches
+}
+
+func (histogram *launchLatencyHistogram) observe(latency time.Duration, now time.Time) {
+	if histogram.count == 0 || latency < histogram.min {
+		histogram.min = latency
+	}
+	if latency > histogram.max {
+		histogram.max = latency
+	}
+	histogram.count++
+	histogram.sum += latency
+	histogram.lastUpdate = now
+	bucket := sort.Search(len(launchLatencyBuckets), func(i int) bool {
+		return latency <= launchLatencyBuckets[i]
+	})
+	histogram.buckets[bucket]++
+}
+
+func (histogram *launchLatencyHistogram) toResponse(family string) handlersutils.TaskFamilyLaunches {
+	buckets := make([]handlersutils.LaunchLatencyBucket, 0, len(histogram.buckets))
+	for i, count := range histogram.buckets {
+		upperBound := infiniteBucketBound
+		if i < len(launchLatencyBuckets) {
+			upperBound = launchLatencyBuckets[i].String()
+		}
+		buckets = append(buckets, handlersutils.LaunchLatencyBucket{
+			UpperBound: upperBound,
+			Count:      count,
+		})
+	}
+	return handlersutils.TaskFamilyLaunches{
+		Family:     family,
+		Count:      histogram.count,
+		SumSeconds: histogram.sum.Seconds(),
+		MinSeconds: histogram.min.Seconds(),
+		MaxSeconds: histogram.max.Seconds(),
+		Buckets:    buckets,
+	}
+}
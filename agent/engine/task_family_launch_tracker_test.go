@@ -0,0 +1,128 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package engine
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	handlersutils "github.com/aws/amazon-ecs-agent/agent/handlers/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTaskFamilyLaunchTracker creates a tracker whose clock is advanced by
+// the tests
+func newTestTaskFamilyLaunchTracker() (*TaskFamilyLaunchTracker, *time.Time) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewTaskFamilyLaunchTracker()
+	tracker.now = func() time.Time { return now }
+	return tracker, &now
+}
+
+func launchTask(tracker *TaskFamilyLaunchTracker, now *time.Time, task *apitask.Task, latency time.Duration) {
+	tracker.received(task)
+	*now = now.Add(latency)
+	tracker.containerRunning(task)
+}
+
+func TestTaskFamilyLaunchTrackerRecordsLatencies(t *testing.T) {
+	tracker, now := newTestTaskFamilyLaunchTracker()
+	launchTask(tracker, now, &apitask.Task{Arn: "t1", Family: "web"}, 500*time.Millisecond)
+	launchTask(tracker, now, &apitask.Task{Arn: "t2", Family: "web"}, 45*time.Second)
+	launchTask(tracker, now, &apitask.Task{Arn: "t3", Family: "web"}, time.Hour)
+	launchTask(tracker, now, &apitask.Task{Arn: "t4", Family: "batch"}, 5*time.Second)
+
+	launches := tracker.ListTaskFamilyLaunches()
+	require.Len(t, launches, 2)
+	web := launches[0]
+	assert.Equal(t, "web", web.Family)
+	assert.Equal(t, uint64(3), web.Count)
+	assert.Equal(t, 3645.5, web.SumSeconds)
+	assert.Equal(t, 0.5, web.MinSeconds)
+	assert.Equal(t, 3600.0, web.MaxSeconds)
+	assert.Equal(t, []handlersutils.LaunchLatencyBucket{
+		{UpperBound: "1s", Count: 1},
+		{UpperBound: "5s", Count: 0},
+		{UpperBound: "10s", Count: 0},
+		{UpperBound: "30s", Count: 0},
+		{UpperBound: "1m0s", Count: 1},
+		{UpperBound: "2m0s", Count: 0},
+		{UpperBound: "5m0s", Count: 0},
+		{UpperBound: "10m0s", Count: 0},
+		{UpperBound: "+Inf", Count: 1},
+	}, web.Buckets)
+
+	batch := launches[1]
+	assert.Equal(t, "batch", batch.Family)
+	assert.Equal(t, uint64(1), batch.Count)
+	assert.Equal(t, uint64(1), batch.Buckets[1].Count, "a latency equal to a bound belongs to its bucket")
+}
+
+func TestTaskFamilyLaunchTrackerRecordsFirstContainerOnly(t *testing.T) {
+	tracker, now := newTestTaskFamilyLaunchTracker()
+	task := &apitask.Task{Arn: "t1", Family: "web"}
+	launchTask(tracker, now, task, time.Second)
+	*now = now.Add(time.Minute)
+	tracker.containerRunning(task)
+	// the task is already known, its payload isn't received again
+	tracker.received(task)
+
+	launches := tracker.ListTaskFamilyLaunches()
+	require.Len(t, launches, 1)
+	assert.Equal(t, uint64(1), launches[0].Count)
+	assert.Equal(t, 1.0, launches[0].MaxSeconds)
+}
+
+func TestTaskFamilyLaunchTrackerForget(t *testing.T) {
+	tracker, _ := newTestTaskFamilyLaunchTracker()
+	task := &apitask.Task{Arn: "t1", Family: "web"}
+	tracker.received(task)
+	tracker.forget(task.Arn)
+	tracker.containerRunning(task)
+
+	assert.Empty(t, tracker.ListTaskFamilyLaunches())
+	assert.Empty(t, tracker.pending)
+}
+
+func TestTaskFamilyLaunchTrackerEvictsLeastLaunchedFamilies(t *testing.T) {
+	tracker, now := newTestTaskFamilyLaunchTracker()
+	launchTask(tracker, now, &apitask.Task{Arn: "popular-1", Family: "popular"}, time.Second)
+	launchTask(tracker, now, &apitask.Task{Arn: "popular-2", Family: "popular"}, time.Second)
+	for i := 0; i < maxTaskFamilyLaunches; i++ {
+		family := fmt.Sprintf("family-%d", i)
+		launchTask(tracker, now, &apitask.Task{Arn: family, Family: family}, time.Second)
+	}
+
+	launches := tracker.ListTaskFamilyLaunches()
+	require.Len(t, launches, maxTaskFamilyLaunches)
+	assert.Equal(t, "popular", launches[0].Family)
+	for _, launch := range launches {
+		assert.NotEqual(t, "family-0", launch.Family, "the least recently launched family should be evicted")
+	}
+}
+
+func TestNilTaskFamilyLaunchTracker(t *testing.T) {
+	var tracker *TaskFamilyLaunchTracker
+	task := &apitask.Task{Arn: "t1", Family: "web"}
+	tracker.received(task)
+	tracker.containerRunning(task)
+	tracker.forget(task.Arn)
+	assert.Empty(t, tracker.ListTaskFamilyLaunches())
+}
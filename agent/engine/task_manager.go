@@ -493,6 +493,9 @@ func (mtask *managedTask) handleContainerChange(containerChange dockerContainerC
 		mtask.handleManagedAgentStoppedTransition(container, execcmd.ExecuteCommandAgentName)
 	}
 
+	if event.Status == apicontainerstatus.ContainerRunning && !container.IsInternal() {
+		mtask.engine.launchTracker.containerRunning(mtask.Task)
+	}
 	mtask.RecordExecutionStoppedAt(container)
 	logger.Debug("Sending container change event to tcs", eventLogFields)
 	err := mtask.containerChangeEventStream.WriteToEventStream(event)
@@ -80,6 +80,12 @@ type TaskHandler struct {
 	state  dockerstate.TaskEngineState
 	client api.ECSClient
 	ctx    context.Context
+
+	// observers are called with every state change event added to the handler,
+	// they are protected by observersLock
+	observers      map[int]func(statechange.Event)
+	nextObserverID int
+	observersLock  sync.RWMutex
 }
 
 // taskSendableEvents is used to group all events for a task
@@ -131,6 +137,7 @@ func NewTaskHandler(ctx context.Context,
 // handler.submitTaskEvents method to submit the batched container state
 // changes and the task state change to ECS
 func (handler *TaskHandler) AddStateChangeEvent(change statechange.Event, client api.ECSClient) error {
+	handler.notifyObservers(change)
 	handler.lock.Lock()
 	defer handler.lock.Unlock()
 	switch change.GetEventType() {
@@ -449,3 +456,31 @@ func handleInvalidParamException(err error, events *list.List, eventToSubmit *li
 		events.Remove(eventToSubmit)
 	}
 }
+
+// Observe registers a function called with every state change event added to
+// the handler, before the event is queued to be sent to ECS. The function must
+// not block. The returned function unregisters it
+func (handler *TaskHandler) Observe(observer func(statechange.Event)) func() {
+	handler.observersLock.Lock()
+	defer handler.observersLock.Unlock()
+	if handler.observers == nil {
+		handler.observers = make(map[int]func(statechange.Event))
+	}
+	id := handler.nextObserverID
+	handler.nextObserverID++
+	handler.observers[id] = observer
+	return func() {
+		handler.observersLock.Lock()
+		defer handler.observersLock.Unlock()
+		delete(handler.observers, id)
+	}
+}
+
+// notifyObservers calls the observers of the handler with the event
+func (handler *TaskHandler) notifyObservers(change statechange.Event) {
+	handler.observersLock.RLock()
+	defer handler.observersLock.RUnlock()
+	for _, observer := range handler.observers {
+		observer(change)
+	}
+}
@@ -706,3 +706,27 @@ func TestGetBatchedManagedAgentEventsStoppedTask(t *testing.T) {
 	events := handler.taskStateChangesToSend()
 	assert.Len(t, events, 0)
 }
+
+func TestObserveStateChangeEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_api.NewMockECSClient(ctrl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := NewTaskHandler(ctx, data.NewNoopClient(), dockerstate.NewTaskEngineState(), client)
+	defer cancel()
+
+	var observed []statechange.Event
+	unregister := handler.Observe(func(event statechange.Event) {
+		observed = append(observed, event)
+	})
+
+	contEvent := containerEvent(taskARN)
+	handler.AddStateChangeEvent(contEvent, client)
+	assert.Len(t, observed, 1)
+	assert.Equal(t, contEvent, observed[0])
+
+	unregister()
+	handler.AddStateChangeEvent(containerEvent(taskARN), client)
+	assert.Len(t, observed, 1, "Unregistered observer should not be called")
+}
@@ -0,0 +1,36 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventstream
+
+// ConnectionEventType is the type of a ConnectionEvent
+type ConnectionEventType string
+
+const (
+	// InstanceDeregistered is the type of the event written when the container
+	// instance is deregistered
+	InstanceDeregistered ConnectionEventType = "InstanceDeregistered"
+	// InstanceStatusChanged is the type of the event written when ACS changes the
+	// status of the container instance, e.g. to DRAINING
+	InstanceStatusChanged ConnectionEventType = "InstanceStatusChanged"
+)
+
+// ConnectionEvent is an event about the registration of the container instance
+// to the cluster, written by the ACS session to the deregister instance event
+// stream
+type ConnectionEvent struct {
+	Type ConnectionEventType
+	// Status is the new status of the container instance, for the
+	// InstanceStatusChanged events
+	Status string
+}
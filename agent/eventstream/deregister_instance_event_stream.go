@@ -0,0 +1,30 @@
+//go:build !typedeventstream
+// +build !typedeventstream
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventstream
+
+import "context"
+
+// DeregisterInstanceEventStream is the stream the ACS session notifies its
+// listeners of the ConnectionEvents on. Unless the agent is built with the
+// typedeventstream tag, it is an untyped EventStream, and the events are written
+// to it in their legacy form
+type DeregisterInstanceEventStream = EventStream
+
+// NewDeregisterInstanceEventStream returns a new DeregisterInstanceEventStream
+func NewDeregisterInstanceEventStream(name string, ctx context.Context) *DeregisterInstanceEventStream {
+	return NewEventStream(name, ctx)
+}
@@ -0,0 +1,29 @@
+//go:build typedeventstream && go1.21
+// +build typedeventstream,go1.21
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventstream
+
+import "context"
+
+// DeregisterInstanceEventStream is the stream the ACS session notifies its
+// listeners of the ConnectionEvents on. With the typedeventstream tag, it is a
+// TypedEventStream of ConnectionEvents
+type DeregisterInstanceEventStream = TypedEventStream[ConnectionEvent]
+
+// NewDeregisterInstanceEventStream returns a new DeregisterInstanceEventStream
+func NewDeregisterInstanceEventStream(name string, ctx context.Context) *DeregisterInstanceEventStream {
+	return NewTypedEventStream[ConnectionEvent](name, ctx)
+}
@@ -0,0 +1,128 @@
+//go:build typedeventstream && go1.21
+// +build typedeventstream,go1.21
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventstream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cihub/seelog"
+)
+
+// TypedEventStream notifies its subscribers of the events written to it, like
+// EventStream, but the events are of a single type and the subscribers receive
+// them from a channel rather than through a handler. The type parameter requires
+// the file version upgrade of Go 1.21 toolchains, as go.mod predates generics:
+// the stream is only built with the typedeventstream tag
+type TypedEventStream[T any] struct {
+	name        string
+	open        bool
+	ctx         context.Context
+	subscribers map[<-chan T]*typedSubscription[T]
+	lock        sync.RWMutex
+}
+
+// typedSubscription is a subscriber of a TypedEventStream. The events channel is
+// never closed, done is closed instead when the subscriber unsubscribes, so that
+// the pending writes to the channel are dropped
+type typedSubscription[T any] struct {
+	events chan T
+	done   chan struct{}
+}
+
+// NewTypedEventStream returns a new TypedEventStream
+func NewTypedEventStream[T any](name string, ctx context.Context) *TypedEventStream[T] {
+	return &TypedEventStream[T]{
+		name:        name,
+		ctx:         ctx,
+		subscribers: make(map[<-chan T]*typedSubscription[T]),
+	}
+}
+
+// Subscribe returns a new channel the events written to the stream are sent to.
+// As with EventStream, the events are delivered concurrently, and may be
+// received out of order
+func (eventStream *TypedEventStream[T]) Subscribe() <-chan T {
+	eventStream.lock.Lock()
+	defer eventStream.lock.Unlock()
+
+	subscription := &typedSubscription[T]{
+		events: make(chan T, 1),
+		done:   make(chan struct{}),
+	}
+	eventStream.subscribers[subscription.events] = subscription
+	return subscription.events
+}
+
+// Unsubscribe stops sending events to the channel returned by Subscribe
+func (eventStream *TypedEventStream[T]) Unsubscribe(events <-chan T) {
+	eventStream.lock.Lock()
+	defer eventStream.lock.Unlock()
+
+	if subscription, ok := eventStream.subscribers[events]; ok {
+		seelog.Debugf("Unsubscribing a listener from event stream %s", eventStream.name)
+		close(subscription.done)
+		delete(eventStream.subscribers, events)
+	}
+}
+
+// Write sends the event to all the subscribers. It doesn't wait for them to
+// receive it
+func (eventStream *TypedEventStream[T]) Write(event T) error {
+	eventStream.lock.RLock()
+	defer eventStream.lock.RUnlock()
+
+	if !eventStream.open {
+		return fmt.Errorf("Event stream is closed")
+	}
+	seelog.Debugf("Event stream %s received events, broadcasting to listeners...", eventStream.name)
+	for _, subscription := range eventStream.subscribers {
+		go eventStream.send(subscription, event)
+	}
+	return nil
+}
+
+// send sends the event to the subscriber until it unsubscribes or the stream
+// is closed
+func (eventStream *TypedEventStream[T]) send(subscription *typedSubscription[T], event T) {
+	select {
+	case subscription.events <- event:
+	case <-subscription.done:
+	case <-eventStream.ctx.Done():
+	}
+}
+
+// Context returns the context of event stream
+func (eventStream *TypedEventStream[T]) Context() context.Context {
+	return eventStream.ctx
+}
+
+// StartListening marks the event stream as open until its context is done
+func (eventStream *TypedEventStream[T]) StartListening() {
+	eventStream.lock.Lock()
+	defer eventStream.lock.Unlock()
+	eventStream.open = true
+
+	go func() {
+		<-eventStream.ctx.Done()
+		seelog.Infof("Event stream %s stopped listening...", eventStream.name)
+		eventStream.lock.Lock()
+		eventStream.open = false
+		eventStream.lock.Unlock()
+	}()
+}
@@ -0,0 +1,110 @@
+//go:build unit && typedeventstream && go1.21
+// +build unit,typedeventstream,go1.21
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package eventstream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receiveEvent returns the event received from the channel, or false if none is
+// received in time
+func receiveEvent(events <-chan ConnectionEvent, timeout time.Duration) (ConnectionEvent, bool) {
+	select {
+	case event := <-events:
+		return event, true
+	case <-time.After(timeout):
+		return ConnectionEvent{}, false
+	}
+}
+
+func TestTypedEventStreamSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventStream := NewTypedEventStream[ConnectionEvent]("TestTypedEventStreamSubscribe", ctx)
+	events1 := eventStream.Subscribe()
+	events2 := eventStream.Subscribe()
+	eventStream.StartListening()
+
+	event := ConnectionEvent{Type: InstanceStatusChanged, Status: "DRAINING"}
+	assert.NoError(t, eventStream.Write(event))
+	received, ok := receiveEvent(events1, time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, event, received)
+	received, ok = receiveEvent(events2, time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, event, received)
+}
+
+func TestTypedEventStreamUnsubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventStream := NewTypedEventStream[ConnectionEvent]("TestTypedEventStreamUnsubscribe", ctx)
+	events1 := eventStream.Subscribe()
+	events2 := eventStream.Subscribe()
+	eventStream.StartListening()
+
+	eventStream.Unsubscribe(events1)
+	// Unsubscribing twice is a no-op
+	eventStream.Unsubscribe(events1)
+	assert.NoError(t, eventStream.Write(ConnectionEvent{Type: InstanceDeregistered}))
+	_, ok := receiveEvent(events2, time.Second)
+	assert.True(t, ok)
+	_, ok = receiveEvent(events1, 100*time.Millisecond)
+	assert.False(t, ok, "unsubscribed listener should not be notified")
+}
+
+// TestTypedEventStreamSlowSubscriber tests that writing to the stream doesn't
+// block on the subscribers not receiving the events
+func TestTypedEventStreamSlowSubscriber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	eventStream := NewTypedEventStream[ConnectionEvent]("TestTypedEventStreamSlowSubscriber", ctx)
+	events := eventStream.Subscribe()
+	eventStream.StartListening()
+
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, eventStream.Write(ConnectionEvent{Type: InstanceDeregistered}))
+	}
+	for i := 0; i < 10; i++ {
+		_, ok := receiveEvent(events, time.Second)
+		assert.True(t, ok)
+	}
+}
+
+func TestTypedEventStreamClosed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	eventStream := NewTypedEventStream[ConnectionEvent]("TestTypedEventStreamClosed", ctx)
+	assert.Error(t, eventStream.Write(ConnectionEvent{}), "the stream should be closed until it starts listening")
+
+	eventStream.StartListening()
+	assert.NoError(t, eventStream.Write(ConnectionEvent{}))
+	cancel()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if eventStream.Write(ConnectionEvent{}) != nil {
+			break
+		}
+	}
+	assert.Error(t, eventStream.Write(ConnectionEvent{}), "the stream should be closed once its context is done")
+}
@@ -39,7 +39,7 @@ require (
 	golang.org/x/net v0.0.0-20210525063256-abc453219eb5
 	golang.org/x/sys v0.0.0-20210510120138-977fb7262007
 	golang.org/x/text v0.3.6 // indirect
-	golang.org/x/time v0.0.0-20170927054726-6dc17368e09b // indirect
+	golang.org/x/time v0.0.0-20170927054726-6dc17368e09b
 	golang.org/x/tools v0.1.5
 	google.golang.org/grpc v1.38.0 // indirect
 	gotest.tools v2.2.0+incompatible // indirect
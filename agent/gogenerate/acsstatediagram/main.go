@@ -0,0 +1,38 @@
+//go:build codegen
+// +build codegen
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Note: This package uses the 'codegen' directive so that it is only built
+// when running go generate.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/handler"
+)
+
+func main() {
+	output := flag.String("output", "acs_state_diagram.dot", "file to write the ACS state diagram to")
+	flag.Parse()
+
+	if err := ioutil.WriteFile(*output, []byte(handler.GenerateStateDiagram()), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to write ACS state diagram: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -55,8 +55,15 @@ var (
 	pprofTraceHandler   = pprof.Trace
 )
 
-func introspectionServerSetup(containerInstanceArn *string, taskEngine handlersutils.DockerStateResolver, cfg *config.Config) *http.Server {
-	paths := []string{v1.AgentMetadataPath, v1.TaskContainerMetadataPath, v1.LicensePath}
+func introspectionServerSetup(containerInstanceArn *string, taskEngine handlersutils.DockerStateResolver, cfg *config.Config,
+	inFlightAcks handlersutils.InFlightAckLister, manifestHistory handlersutils.TaskManifestHistoryGetter,
+	launches handlersutils.TaskFamilyLaunchLister, pauser handlersutils.ACSSessionPauser) *http.Server {
+	paths := []string{v1.AgentMetadataPath, v1.TaskContainerMetadataPath, v1.LicensePath, v1.ACSInFlightAcksPath,
+		v1.ACSManifestHistoryPath, v1.TaskFamilyLaunchesPath}
+
+	if cfg.EnableACSPauseEndpoints.Enabled() {
+		paths = append(paths, v1.ACSPausePath, v1.ACSResumePath)
+	}
 
 	if cfg.EnableRuntimeStats.Enabled() {
 		paths = append(paths, pprofBasePath, pprofCMDLinePath, pprofProfilePath, pprofSymbolPath, pprofTracePath)
@@ -76,7 +83,7 @@ func introspectionServerSetup(containerInstanceArn *string, taskEngine handlersu
 	serverMux := http.NewServeMux()
 	serverMux.HandleFunc("/", defaultHandler)
 
-	v1HandlersSetup(serverMux, containerInstanceArn, taskEngine, cfg)
+	v1HandlersSetup(serverMux, containerInstanceArn, taskEngine, cfg, inFlightAcks, manifestHistory, launches, pauser)
 	pprofHandlerSetup(serverMux, cfg)
 
 	// Log all requests and then pass through to serverMux
@@ -101,10 +108,23 @@ func introspectionServerSetup(containerInstanceArn *string, taskEngine handlersu
 func v1HandlersSetup(serverMux *http.ServeMux,
 	containerInstanceArn *string,
 	taskEngine handlersutils.DockerStateResolver,
-	cfg *config.Config) {
+	cfg *config.Config,
+	inFlightAcks handlersutils.InFlightAckLister,
+	manifestHistory handlersutils.TaskManifestHistoryGetter,
+	launches handlersutils.TaskFamilyLaunchLister,
+	pauser handlersutils.ACSSessionPauser) {
 	serverMux.HandleFunc(v1.AgentMetadataPath, v1.AgentMetadataHandler(containerInstanceArn, cfg))
 	serverMux.HandleFunc(v1.TaskContainerMetadataPath, v1.TaskContainerMetadataHandler(taskEngine))
 	serverMux.HandleFunc(v1.LicensePath, v1.LicenseHandler)
+	serverMux.HandleFunc(v1.ACSInFlightAcksPath, v1.ACSInFlightAcksHandler(inFlightAcks))
+	serverMux.HandleFunc(v1.ACSManifestHistoryPath, v1.ACSManifestHistoryHandler(manifestHistory))
+	serverMux.HandleFunc(v1.TaskFamilyLaunchesPath, v1.TaskFamilyLaunchesHandler(launches))
+	// Any client able to reach the introspection server could stop the tasks from
+	// being started, the endpoints changing the state of the agent are opt-in
+	if cfg.EnableACSPauseEndpoints.Enabled() {
+		serverMux.HandleFunc(v1.ACSPausePath, v1.ACSPauseHandler(pauser))
+		serverMux.HandleFunc(v1.ACSResumePath, v1.ACSResumeHandler(pauser))
+	}
 }
 
 func pprofHandlerSetup(serverMux *http.ServeMux, cfg *config.Config) {
@@ -121,12 +141,15 @@ func pprofHandlerSetup(serverMux *http.ServeMux, cfg *config.Config) {
 // ServeIntrospectionHTTPEndpoint serves information about this agent/containerInstance and tasks
 // running on it. "V1" here indicates the hostname version of this server instead
 // of the handler versions, i.e. "V1" server can include "V1" and "V2" handlers.
-func ServeIntrospectionHTTPEndpoint(ctx context.Context, containerInstanceArn *string, taskEngine engine.TaskEngine, cfg *config.Config) {
+func ServeIntrospectionHTTPEndpoint(ctx context.Context, containerInstanceArn *string, taskEngine engine.TaskEngine, cfg *config.Config,
+	inFlightAcks handlersutils.InFlightAckLister, manifestHistory handlersutils.TaskManifestHistoryGetter,
+	pauser handlersutils.ACSSessionPauser) {
 	// Is this the right level to type assert, assuming we'd abstract multiple taskengines here?
 	// Revisit if we ever add another type..
 	dockerTaskEngine := taskEngine.(*engine.DockerTaskEngine)
 
-	server := introspectionServerSetup(containerInstanceArn, dockerTaskEngine, cfg)
+	server := introspectionServerSetup(containerInstanceArn, dockerTaskEngine, cfg, inFlightAcks, manifestHistory,
+		dockerTaskEngine.TaskFamilyLaunchTracker(), pauser)
 
 	go func() {
 		<-ctx.Done()
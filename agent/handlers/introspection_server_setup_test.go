@@ -18,21 +18,27 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
 	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
 	apieni "github.com/aws/amazon-ecs-agent/agent/api/eni"
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
 	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/data"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	mock_utils "github.com/aws/amazon-ecs-agent/agent/handlers/mocks"
+	handlersutils "github.com/aws/amazon-ecs-agent/agent/handlers/utils"
 	v1 "github.com/aws/amazon-ecs-agent/agent/handlers/v1"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -64,6 +70,264 @@ func TestMetadataHandler(t *testing.T) {
 	}
 }
 
+// fakeInFlightAckLister returns a fixed list of in-flight acks
+type fakeInFlightAckLister []handlersutils.InFlightAck
+
+func (lister fakeInFlightAckLister) ListInFlightAcks() []handlersutils.InFlightAck {
+	return lister
+}
+
+func TestACSInFlightAcksHandler(t *testing.T) {
+	receivedAt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	lister := fakeInFlightAckLister{
+		{
+			MessageID:    "payload-message",
+			MessageType:  "PayloadMessage",
+			ReceivedAt:   receivedAt,
+			WaitingSince: receivedAt.Add(time.Second),
+		},
+		{
+			MessageID:   "heartbeat-message",
+			MessageType: "HeartbeatMessage",
+			ReceivedAt:  receivedAt.Add(time.Minute),
+		},
+	}
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		&config.Config{Cluster: testClusterArn}, lister, nil, nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.ACSInFlightAcksPath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var acks []handlersutils.InFlightAck
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &acks))
+	require.Len(t, acks, 2)
+	assert.Equal(t, "payload-message", acks[0].MessageID)
+	assert.Equal(t, "PayloadMessage", acks[0].MessageType)
+	assert.True(t, receivedAt.Equal(acks[0].ReceivedAt))
+	assert.True(t, receivedAt.Add(time.Second).Equal(acks[0].WaitingSince))
+	assert.Equal(t, "heartbeat-message", acks[1].MessageID)
+	assert.True(t, acks[1].WaitingSince.IsZero())
+}
+
+func TestACSInFlightAcksHandlerWithoutACSSession(t *testing.T) {
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		&config.Config{Cluster: testClusterArn}, nil, nil, nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.ACSInFlightAcksPath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "[]", recorder.Body.String())
+}
+
+// fakeTaskManifestHistoryGetter returns a fixed task manifest history
+type fakeTaskManifestHistoryGetter struct {
+	manifests []data.TaskManifest
+	err       error
+}
+
+func (getter fakeTaskManifestHistoryGetter) GetManifestHistory() ([]data.TaskManifest, error) {
+	return getter.manifests, getter.err
+}
+
+func TestACSManifestHistoryHandler(t *testing.T) {
+	receivedAt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	getter := fakeTaskManifestHistoryGetter{
+		manifests: []data.TaskManifest{
+			{
+				SequenceNumber: 2,
+				MessageID:      "manifest-2",
+				ClusterARN:     testClusterArn,
+				Tasks: []*ecsacs.TaskIdentifier{
+					{
+						TaskArn:        aws.String("task1"),
+						DesiredStatus:  aws.String("RUNNING"),
+						TaskClusterArn: aws.String(testClusterArn),
+					},
+				},
+				ReceivedAt: receivedAt.Add(time.Minute),
+			},
+			{
+				SequenceNumber: 1,
+				MessageID:      "manifest-1",
+				ClusterARN:     testClusterArn,
+				ReceivedAt:     receivedAt,
+			},
+		},
+	}
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		&config.Config{Cluster: testClusterArn}, nil, getter, nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.ACSManifestHistoryPath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	var manifests []data.TaskManifest
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &manifests))
+	assert.Equal(t, getter.manifests, manifests)
+}
+
+func TestACSManifestHistoryHandlerError(t *testing.T) {
+	getter := fakeTaskManifestHistoryGetter{err: errors.New("oops")}
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		&config.Config{Cluster: testClusterArn}, nil, getter, nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.ACSManifestHistoryPath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+func TestACSManifestHistoryHandlerWithoutDataClient(t *testing.T) {
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		&config.Config{Cluster: testClusterArn}, nil, nil, nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.ACSManifestHistoryPath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "[]", recorder.Body.String())
+}
+
+// fakeTaskFamilyLaunchLister returns fixed task family launches
+type fakeTaskFamilyLaunchLister []handlersutils.TaskFamilyLaunches
+
+func (lister fakeTaskFamilyLaunchLister) ListTaskFamilyLaunches() []handlersutils.TaskFamilyLaunches {
+	return lister
+}
+
+func TestTaskFamilyLaunchesHandler(t *testing.T) {
+	lister := fakeTaskFamilyLaunchLister{
+		{
+			Family:     "web",
+			Count:      2,
+			SumSeconds: 3,
+			MinSeconds: 1,
+			MaxSeconds: 2,
+			Buckets: []handlersutils.LaunchLatencyBucket{
+				{UpperBound: "1s", Count: 1},
+				{UpperBound: "+Inf", Count: 1},
+			},
+		},
+	}
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		&config.Config{Cluster: testClusterArn}, nil, nil, lister, nil)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.TaskFamilyLaunchesPath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `[{"Family":"web","Count":2,"SumSeconds":3,"MinSeconds":1,"MaxSeconds":2,`+
+		`"Buckets":[{"UpperBound":"1s","Count":1},{"UpperBound":"+Inf","Count":1}]}]`, recorder.Body.String())
+}
+
+func TestTaskFamilyLaunchesHandlerWithoutTracker(t *testing.T) {
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		&config.Config{Cluster: testClusterArn}, nil, nil, nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.TaskFamilyLaunchesPath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "[]", recorder.Body.String())
+}
+
+// fakeACSSessionPauser records whether the processing of the payload messages
+// is paused
+type fakeACSSessionPauser struct {
+	paused bool
+}
+
+func (pauser *fakeACSSessionPauser) Pause() {
+	pauser.paused = true
+}
+
+func (pauser *fakeACSSessionPauser) Resume() {
+	pauser.paused = false
+}
+
+func (pauser *fakeACSSessionPauser) IsPaused() bool {
+	return pauser.paused
+}
+
+func TestACSPauseResumeHandlers(t *testing.T) {
+	pauser := &fakeACSSessionPauser{}
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		testACSPauseEndpointsConfig(), nil, nil, nil, pauser)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", v1.ACSPausePath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"Paused":true}`, recorder.Body.String())
+	assert.True(t, pauser.paused)
+
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", v1.ACSResumePath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"Paused":false}`, recorder.Body.String())
+	assert.False(t, pauser.paused)
+}
+
+func TestACSPauseHandlerRejectsGet(t *testing.T) {
+	pauser := &fakeACSSessionPauser{}
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		testACSPauseEndpointsConfig(), nil, nil, nil, pauser)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", v1.ACSPausePath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	assert.Equal(t, http.MethodPost, recorder.Header().Get("Allow"))
+	assert.False(t, pauser.paused)
+}
+
+func TestACSPauseHandlerWithoutACSSession(t *testing.T) {
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		testACSPauseEndpointsConfig(), nil, nil, nil, nil)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", v1.ACSPausePath, nil)
+	server.Handler.ServeHTTP(recorder, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+// TestACSPauseHandlersDisabledByDefault tests that the pause and resume
+// endpoints aren't served unless enabled, as any client able to reach the
+// introspection server could stop the tasks from being started otherwise
+func TestACSPauseHandlersDisabledByDefault(t *testing.T) {
+	pauser := &fakeACSSessionPauser{}
+	server := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), nil,
+		&config.Config{Cluster: testClusterArn}, nil, nil, nil, pauser)
+
+	for _, path := range []string{v1.ACSPausePath, v1.ACSResumePath} {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", path, nil)
+		server.Handler.ServeHTTP(recorder, req)
+		assert.NotContains(t, recorder.Body.String(), "Paused")
+	}
+	assert.False(t, pauser.paused)
+}
+
+// testACSPauseEndpointsConfig returns a config enabling the pause and resume endpoints
+func testACSPauseEndpointsConfig() *config.Config {
+	return &config.Config{
+		Cluster:                 testClusterArn,
+		EnableACSPauseEndpoints: config.BooleanDefaultFalse{Value: config.ExplicitlyEnabled},
+	}
+}
+
 func TestListMultipleTasks(t *testing.T) {
 	recorder := performMockRequest(t, "/v1/tasks")
 
@@ -243,6 +507,53 @@ func TestBackendMismatchMapping(t *testing.T) {
 	}
 }
 
+func TestListTasksIncludeCompleted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStateResolver := mock_utils.NewMockDockerStateResolver(ctrl)
+	state := dockerstate.NewTaskEngineState()
+	stateSetupHelper(state, testTasks)
+
+	completedTask := &apitask.Task{
+		Arn:                 "completedTask",
+		DesiredStatusUnsafe: apitaskstatus.TaskStopped,
+		KnownStatusUnsafe:   apitaskstatus.TaskStopped,
+		Family:              "test",
+		Version:             "1",
+		Containers: []*apicontainer.Container{
+			{
+				Name:      "c1",
+				RuntimeID: "dockerid-completed",
+			},
+		},
+	}
+	mockStateResolver.EXPECT().State().Return(state).Times(2)
+	// Completed tasks still in the state are only listed once
+	mockStateResolver.EXPECT().CompletedTasks().Return([]*apitask.Task{completedTask, testTasks[0]}, nil)
+	requestHandler := v1.TaskContainerMetadataHandler(mockStateResolver)
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/tasks?includeCompleted=true", nil)
+	requestHandler(recorder, req)
+
+	var tasksResponse v1.TasksResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &tasksResponse))
+	require.Len(t, tasksResponse.Tasks, len(testTasks)+1)
+	completedResponse := tasksResponse.Tasks[len(testTasks)]
+	assert.Equal(t, "completedTask", completedResponse.Arn)
+	assert.Equal(t, "STOPPED", completedResponse.KnownStatus)
+	require.Len(t, completedResponse.Containers, 1)
+	assert.Equal(t, "dockerid-completed", completedResponse.Containers[0].DockerID)
+
+	// Completed tasks aren't listed unless requested
+	recorder = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/v1/tasks", nil)
+	requestHandler(recorder, req)
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &tasksResponse))
+	assert.Len(t, tasksResponse.Tasks, len(testTasks))
+}
+
 func setupMockPprofHandlers() func() {
 	runtimeStatsConfigForTestBkp := runtimeStatsConfigForTest
 	pprofIndexHandlerBkp := pprofIndexHandler
@@ -299,7 +610,7 @@ func TestPProfHandlerSetup(t *testing.T) {
 					assert.Equal(t, p, recorder.Body.String())
 				} else {
 					assert.Equal(t, http.StatusOK, recorder.Code)
-					assert.Equal(t, `{"AvailableCommands":["/v1/metadata","/v1/tasks","/license"]}`, recorder.Body.String())
+					assert.Equal(t, `{"AvailableCommands":["/v1/metadata","/v1/tasks","/license","/v1/acs/inflight","/v1/acs/manifest-history","/v1/metrics/task-families"]}`, recorder.Body.String())
 
 				}
 			})
@@ -484,7 +795,7 @@ func performMockRequest(t *testing.T, path string) *httptest.ResponseRecorder {
 	requestHandler := introspectionServerSetup(utils.Strptr(testContainerInstanceArn), mockStateResolver, &config.Config{
 		Cluster:            testClusterArn,
 		EnableRuntimeStats: runtimeStatsConfigForTest,
-	})
+	}, nil, nil, nil, nil)
 
 	recorder := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", path, nil)
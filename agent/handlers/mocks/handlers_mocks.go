@@ -21,6 +21,7 @@ package mock_utils
 import (
 	reflect "reflect"
 
+	task "github.com/aws/amazon-ecs-agent/agent/api/task"
 	dockerstate "github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
 	gomock "github.com/golang/mock/gomock"
 )
@@ -48,6 +49,21 @@ func (m *MockDockerStateResolver) EXPECT() *MockDockerStateResolverMockRecorder
 	return m.recorder
 }
 
+// CompletedTasks mocks base method
+func (m *MockDockerStateResolver) CompletedTasks() ([]*task.Task, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CompletedTasks")
+	ret0, _ := ret[0].([]*task.Task)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompletedTasks indicates an expected call of CompletedTasks
+func (mr *MockDockerStateResolverMockRecorder) CompletedTasks() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompletedTasks", reflect.TypeOf((*MockDockerStateResolver)(nil).CompletedTasks))
+}
+
 // State mocks base method
 func (m *MockDockerStateResolver) State() dockerstate.TaskEngineState {
 	m.ctrl.T.Helper()
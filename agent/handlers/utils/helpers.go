@@ -51,6 +51,21 @@ const (
 	// RequestTypeContainerAssociation specifies the container association request type of ContainerAssociationHandler.
 	RequestTypeContainerAssociation = "container association"
 
+	// RequestTypeACSInFlightAcks specifies the request type of ACSInFlightAcksHandler.
+	RequestTypeACSInFlightAcks = "acs in-flight acks"
+
+	// RequestTypeACSManifestHistory specifies the request type of ACSManifestHistoryHandler.
+	RequestTypeACSManifestHistory = "acs manifest history"
+
+	// RequestTypeTaskFamilyLaunches specifies the request type of TaskFamilyLaunchesHandler.
+	RequestTypeTaskFamilyLaunches = "task family launches"
+
+	// RequestTypeACSPause specifies the request type of ACSPauseHandler.
+	RequestTypeACSPause = "acs pause"
+
+	// RequestTypeACSResume specifies the request type of ACSResumeHandler.
+	RequestTypeACSResume = "acs resume"
+
 	// AnythingButSlashRegEx is a regex pattern that matches any string without slash.
 	AnythingButSlashRegEx = "[^/]*"
 
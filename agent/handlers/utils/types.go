@@ -13,10 +13,74 @@
 
 package utils
 
-import "github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+import (
+	"time"
+
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
+)
 
 // DockerStateResolver is a sub-interface for the engine.TaskEngine interface
 // to make it easy to test code in this package
 type DockerStateResolver interface {
 	State() dockerstate.TaskEngineState
+	// CompletedTasks returns the tasks that were recently removed from the state
+	CompletedTasks() ([]*apitask.Task, error)
+}
+
+// InFlightAck describes a message received from ACS that hasn't been acked yet
+type InFlightAck struct {
+	MessageID   string `json:"MessageID"`
+	MessageType string `json:"MessageType"`
+	// ReceivedAt is the time at which the message was received from ACS
+	ReceivedAt time.Time `json:"ReceivedAt"`
+	// WaitingSince is the time at which the message was handled and its ack
+	// queued. It's the zero time while the message is still being handled
+	WaitingSince time.Time `json:"WaitingSince"`
+}
+
+// InFlightAckLister lists the messages received from ACS that haven't been
+// acked yet
+type InFlightAckLister interface {
+	ListInFlightAcks() []InFlightAck
+}
+
+// TaskManifestHistoryGetter gets the most recent task manifests received from
+// ACS
+type TaskManifestHistoryGetter interface {
+	GetManifestHistory() ([]data.TaskManifest, error)
+}
+
+// TaskFamilyLaunches describes the launch latencies of the tasks of a task
+// family, from the receipt of their payload to their first container running
+type TaskFamilyLaunches struct {
+	Family     string  `json:"Family"`
+	Count      uint64  `json:"Count"`
+	SumSeconds float64 `json:"SumSeconds"`
+	MinSeconds float64 `json:"MinSeconds"`
+	MaxSeconds float64 `json:"MaxSeconds"`
+	// Buckets counts the launches by latency. Each bucket counts the launches
+	// that took at most its upper bound and more than the previous one
+	Buckets []LaunchLatencyBucket `json:"Buckets"`
+}
+
+// LaunchLatencyBucket is a bucket of a launch latency histogram
+type LaunchLatencyBucket struct {
+	// UpperBound is the upper bound of the bucket as a duration, or "+Inf"
+	UpperBound string `json:"UpperBound"`
+	Count      uint64 `json:"Count"`
+}
+
+// TaskFamilyLaunchLister lists the launch latencies of the task families
+type TaskFamilyLaunchLister interface {
+	ListTaskFamilyLaunches() []TaskFamilyLaunches
+}
+
+// ACSSessionPauser pauses and resumes the processing of the payload messages
+// received from ACS
+type ACSSessionPauser interface {
+	Pause()
+	Resume()
+	IsPaused() bool
 }
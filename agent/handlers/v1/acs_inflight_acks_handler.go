@@ -0,0 +1,40 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/agent/handlers/utils"
+)
+
+// ACSInFlightAcksPath is the path of the ACS in-flight acks v1 handler.
+const ACSInFlightAcksPath = "/v1/acs/inflight"
+
+// ACSInFlightAcksHandler creates response for '/v1/acs/inflight' API. It lists
+// the messages received from ACS that haven't been acked yet.
+func ACSInFlightAcksHandler(lister utils.InFlightAckLister) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		acks := []utils.InFlightAck{}
+		if lister != nil {
+			acks = lister.ListInFlightAcks()
+		}
+		responseJSON, err := json.Marshal(acks)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, utils.RequestTypeACSInFlightAcks)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/agent/data"
+	"github.com/aws/amazon-ecs-agent/agent/handlers/utils"
+	"github.com/cihub/seelog"
+)
+
+// ACSManifestHistoryPath is the path of the ACS task manifest history v1 handler.
+const ACSManifestHistoryPath = "/v1/acs/manifest-history"
+
+// ACSManifestHistoryHandler creates response for '/v1/acs/manifest-history' API.
+// It lists the most recent task manifests received from ACS, the most recent first.
+func ACSManifestHistoryHandler(getter utils.TaskManifestHistoryGetter) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		manifests := []data.TaskManifest{}
+		if getter != nil {
+			history, err := getter.GetManifestHistory()
+			if err != nil {
+				seelog.Errorf("Unable to get the task manifest history: %v", err)
+				utils.WriteJSONToResponse(w, http.StatusInternalServerError, []byte(`{}`),
+					utils.RequestTypeACSManifestHistory)
+				return
+			}
+			manifests = append(manifests, history...)
+		}
+		responseJSON, err := json.Marshal(manifests)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, utils.RequestTypeACSManifestHistory)
+	}
+}
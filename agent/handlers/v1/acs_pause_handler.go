@@ -0,0 +1,68 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/agent/handlers/utils"
+)
+
+const (
+	// ACSPausePath is the path of the ACS pause v1 handler.
+	ACSPausePath = "/v1/acs/pause"
+	// ACSResumePath is the path of the ACS resume v1 handler.
+	ACSResumePath = "/v1/acs/resume"
+)
+
+// ACSPauseResponse is the response of the ACS pause and resume handlers.
+type ACSPauseResponse struct {
+	Paused bool `json:"Paused"`
+}
+
+// ACSPauseHandler creates response for '/v1/acs/pause' API. It pauses the
+// processing of the payload messages received from ACS. Only POST requests are
+// accepted, since the request changes the state of the agent.
+func ACSPauseHandler(pauser utils.ACSSessionPauser) func(http.ResponseWriter, *http.Request) {
+	return acsPauseResumeHandler(pauser, func() { pauser.Pause() }, utils.RequestTypeACSPause)
+}
+
+// ACSResumeHandler creates response for '/v1/acs/resume' API. It resumes the
+// processing of the payload messages received from ACS. Only POST requests are
+// accepted, since the request changes the state of the agent.
+func ACSResumeHandler(pauser utils.ACSSessionPauser) func(http.ResponseWriter, *http.Request) {
+	return acsPauseResumeHandler(pauser, func() { pauser.Resume() }, utils.RequestTypeACSResume)
+}
+
+func acsPauseResumeHandler(pauser utils.ACSSessionPauser, apply func(),
+	requestType string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			utils.WriteJSONToResponse(w, http.StatusMethodNotAllowed, []byte(`{}`), requestType)
+			return
+		}
+		if pauser == nil {
+			utils.WriteJSONToResponse(w, http.StatusServiceUnavailable, []byte(`{}`), requestType)
+			return
+		}
+		apply()
+		responseJSON, err := json.Marshal(ACSPauseResponse{Paused: pauser.IsPaused()})
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, requestType)
+	}
+}
@@ -184,3 +184,27 @@ func NewTasksResponse(state dockerstate.TaskEngineState) *TasksResponse {
 
 	return &TasksResponse{Tasks: taskResponses}
 }
+
+// NewCompletedTaskResponse creates TaskResponse for a task that was removed from the
+// state. The docker names of its containers are no longer known.
+func NewCompletedTaskResponse(task *apitask.Task) *TaskResponse {
+	containerMap := make(map[string]*apicontainer.DockerContainer)
+	for _, container := range task.Containers {
+		containerMap[container.Name] = &apicontainer.DockerContainer{
+			DockerID:  container.GetRuntimeID(),
+			Container: container,
+		}
+	}
+	return NewTaskResponse(task, containerMap)
+}
+
+// AddCompletedTasks adds the completed tasks that are no longer in the state to the
+// TasksResponse.
+func (response *TasksResponse) AddCompletedTasks(completedTasks []*apitask.Task, state dockerstate.TaskEngineState) {
+	for _, task := range completedTasks {
+		if _, ok := state.TaskByArn(task.Arn); ok {
+			continue
+		}
+		response.Tasks = append(response.Tasks, NewCompletedTaskResponse(task))
+	}
+}
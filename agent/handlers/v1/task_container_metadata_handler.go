@@ -16,6 +16,7 @@ package v1
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 
 	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
 	"github.com/aws/amazon-ecs-agent/agent/engine/dockerstate"
@@ -25,10 +26,11 @@ import (
 
 const (
 	// TaskContainerMetadataPath is the task/container metadata path for v1 handler.
-	TaskContainerMetadataPath = "/v1/tasks"
-	dockerIDQueryField        = "dockerid"
-	taskARNQueryField         = "taskarn"
-	dockerShortIDLen          = 12
+	TaskContainerMetadataPath  = "/v1/tasks"
+	dockerIDQueryField         = "dockerid"
+	taskARNQueryField          = "taskarn"
+	includeCompletedQueryField = "includeCompleted"
+	dockerShortIDLen           = 12
 )
 
 // createTaskResponse creates JSON response and sets the http status code for the task queried.
@@ -54,8 +56,8 @@ func createTaskResponse(task *apitask.Task, found bool, resourceID string, state
 }
 
 // TaskContainerMetadataHandler creates response for the 'v1/tasks' API. Lists all tasks if the request
-// doesn't contain any fields. Returns a Task if either of 'dockerid' or
-// 'taskarn' are specified in the request.
+// doesn't contain any fields, including the recently cleaned up ones if 'includeCompleted' is true.
+// Returns a Task if either of 'dockerid' or 'taskarn' are specified in the request.
 func TaskContainerMetadataHandler(taskEngine utils.DockerStateResolver) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var err error
@@ -100,7 +102,15 @@ func TaskContainerMetadataHandler(taskEngine utils.DockerStateResolver) func(htt
 			w.WriteHeader(status)
 		} else {
 			// List all tasks.
-			responseJSON, err = json.Marshal(NewTasksResponse(dockerTaskEngineState))
+			tasksResponse := NewTasksResponse(dockerTaskEngineState)
+			if includeCompleted(r) {
+				completedTasks, err := taskEngine.CompletedTasks()
+				if err != nil {
+					seelog.Warnf("Unable to get completed tasks: %v", err)
+				}
+				tasksResponse.AddCompletedTasks(completedTasks, dockerTaskEngineState)
+			}
+			responseJSON, err = json.Marshal(tasksResponse)
 			if err != nil {
 				responseJSON = []byte("")
 				w.WriteHeader(http.StatusInternalServerError)
@@ -109,3 +119,10 @@ func TaskContainerMetadataHandler(taskEngine utils.DockerStateResolver) func(htt
 		w.Write(responseJSON)
 	}
 }
+
+// includeCompleted returns true if the request asks for the completed tasks to be listed
+func includeCompleted(r *http.Request) bool {
+	value, _ := utils.ValueFromRequest(r, includeCompletedQueryField)
+	include, err := strconv.ParseBool(value)
+	return err == nil && include
+}
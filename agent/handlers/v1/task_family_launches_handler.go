@@ -0,0 +1,41 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/aws/amazon-ecs-agent/agent/handlers/utils"
+)
+
+// TaskFamilyLaunchesPath is the path of the task family launch metrics v1 handler.
+const TaskFamilyLaunchesPath = "/v1/metrics/task-families"
+
+// TaskFamilyLaunchesHandler creates response for '/v1/metrics/task-families' API.
+// It lists the launch latency histograms of the task families with the most
+// launches, the most launched first.
+func TaskFamilyLaunchesHandler(lister utils.TaskFamilyLaunchLister) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		launches := []utils.TaskFamilyLaunches{}
+		if lister != nil {
+			launches = append(launches, lister.ListTaskFamilyLaunches()...)
+		}
+		responseJSON, err := json.Marshal(launches)
+		if e := utils.WriteResponseIfMarshalError(w, err); e != nil {
+			return
+		}
+		utils.WriteJSONToResponse(w, http.StatusOK, responseJSON, utils.RequestTypeTaskFamilyLaunches)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v4
+
+import (
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/containermetadata"
+	v2 "github.com/aws/amazon-ecs-agent/agent/handlers/v2"
+)
+
+// applyCachedTaskMetadata fills the fields of the task response, and of its
+// container responses, that the engine state hasn't populated yet with the
+// metadata ACS last sent for the task if it is in the cache. The engine state
+// takes precedence, it keeps being updated once the engine processes the task,
+// including when the engine stops the task on its own
+func applyCachedTaskMetadata(taskResponse *TaskResponse, cache *containermetadata.TaskMetadataCache) {
+	cached, ok := cache.Task(taskResponse.TaskARN)
+	if !ok {
+		return
+	}
+	if taskResponse.Family == "" {
+		taskResponse.Family = cached.Family
+	}
+	if taskResponse.Revision == "" {
+		taskResponse.Revision = cached.Version
+	}
+	if taskResponse.DesiredStatus == "" || taskResponse.DesiredStatus == apitaskstatus.TaskStatusNone.String() {
+		if cached.DesiredStatus != "" {
+			taskResponse.DesiredStatus = cached.DesiredStatus
+		}
+	}
+	for _, containerResponse := range taskResponse.Containers {
+		if cachedContainer, ok := cached.Containers[containerResponse.Name]; ok {
+			applyCachedContainerMetadata(containerResponse.ContainerResponse, cachedContainer)
+		}
+	}
+}
+
+// applyCachedContainerMetadata fills the fields of the container response that
+// the engine state hasn't populated yet with the cached metadata of the container
+func applyCachedContainerMetadata(containerResponse *v2.ContainerResponse, cached containermetadata.CachedContainerMetadata) {
+	if containerResponse.Image == "" {
+		containerResponse.Image = cached.Image
+	}
+	if containerResponse.DesiredStatus == "" || containerResponse.DesiredStatus == apicontainerstatus.ContainerStatusNone.String() {
+		if cached.DesiredStatus != "" {
+			containerResponse.DesiredStatus = cached.DesiredStatus
+		}
+	}
+}
@@ -0,0 +1,101 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package v4
+
+import (
+	"testing"
+
+	apicontainer "github.com/aws/amazon-ecs-agent/agent/api/container"
+	apicontainerstatus "github.com/aws/amazon-ecs-agent/agent/api/container/status"
+	apitask "github.com/aws/amazon-ecs-agent/agent/api/task"
+	apitaskstatus "github.com/aws/amazon-ecs-agent/agent/api/task/status"
+	"github.com/aws/amazon-ecs-agent/agent/containermetadata"
+	v2 "github.com/aws/amazon-ecs-agent/agent/handlers/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTaskMetadataCache() *containermetadata.TaskMetadataCache {
+	cache := containermetadata.NewTaskMetadataCache()
+	cache.Update(&apitask.Task{
+		Arn:                 taskARN,
+		Family:              family,
+		Version:             version,
+		DesiredStatusUnsafe: apitaskstatus.TaskRunning,
+		Containers: []*apicontainer.Container{
+			{
+				Name:                containerName,
+				Image:               imageName,
+				DesiredStatusUnsafe: apicontainerstatus.ContainerRunning,
+			},
+		},
+	})
+	return cache
+}
+
+func TestApplyCachedTaskMetadataFillsUnpopulatedFields(t *testing.T) {
+	taskResponse := &TaskResponse{
+		TaskResponse: &v2.TaskResponse{
+			TaskARN:       taskARN,
+			DesiredStatus: apitaskstatus.TaskStatusNone.String(),
+		},
+		Containers: []ContainerResponse{
+			{
+				ContainerResponse: &v2.ContainerResponse{
+					Name:          containerName,
+					DesiredStatus: apicontainerstatus.ContainerStatusNone.String(),
+				},
+			},
+		},
+	}
+	applyCachedTaskMetadata(taskResponse, newTestTaskMetadataCache())
+
+	assert.Equal(t, family, taskResponse.Family)
+	assert.Equal(t, version, taskResponse.Revision)
+	assert.Equal(t, "RUNNING", taskResponse.DesiredStatus)
+	assert.Equal(t, imageName, taskResponse.Containers[0].Image)
+	assert.Equal(t, "RUNNING", taskResponse.Containers[0].DesiredStatus)
+}
+
+// TestApplyCachedTaskMetadataKeepsEngineState tests that the fields populated
+// from the engine state aren't overridden, as the engine may have stopped the
+// task on its own since ACS sent it
+func TestApplyCachedTaskMetadataKeepsEngineState(t *testing.T) {
+	taskResponse := &TaskResponse{
+		TaskResponse: &v2.TaskResponse{
+			TaskARN:       taskARN,
+			Family:        "other-family",
+			Revision:      "7",
+			DesiredStatus: "STOPPED",
+		},
+		Containers: []ContainerResponse{
+			{
+				ContainerResponse: &v2.ContainerResponse{
+					Name:          containerName,
+					Image:         "other-image",
+					DesiredStatus: "STOPPED",
+				},
+			},
+		},
+	}
+	applyCachedTaskMetadata(taskResponse, newTestTaskMetadataCache())
+
+	assert.Equal(t, "other-family", taskResponse.Family)
+	assert.Equal(t, "7", taskResponse.Revision)
+	assert.Equal(t, "STOPPED", taskResponse.DesiredStatus)
+	assert.Equal(t, "other-image", taskResponse.Containers[0].Image)
+	assert.Equal(t, "STOPPED", taskResponse.Containers[0].DesiredStatus)
+}
@@ -30,7 +30,10 @@ import (
 var ContainerMetadataPath = "/v4/" + utils.ConstructMuxVar(v3.V3EndpointIDMuxName, utils.AnythingButSlashRegEx)
 
 // ContainerMetadataHandler returns the handler method for handling container metadata requests.
-func ContainerMetadataHandler(state dockerstate.TaskEngineState) func(http.ResponseWriter, *http.Request) {
+// The metadata ACS last sent for the container is read from the task metadata
+// cache first, the rest of the response is built from the engine state.
+func ContainerMetadataHandler(state dockerstate.TaskEngineState,
+	taskMetadataCache *containermetadata.TaskMetadataCache) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		containerID, err := v3.GetContainerIDByRequest(r, state)
 		if err != nil {
@@ -51,6 +54,13 @@ func ContainerMetadataHandler(state dockerstate.TaskEngineState) func(http.Respo
 			utils.WriteJSONToResponse(w, http.StatusInternalServerError, errResponseJSON, utils.RequestTypeContainerMetadata)
 			return
 		}
+		if taskMetadataCache != nil {
+			if task, ok := state.TaskByID(containerID); ok {
+				if cached, ok := taskMetadataCache.Container(task.Arn, containerResponse.Name); ok {
+					applyCachedContainerMetadata(containerResponse.ContainerResponse, cached)
+				}
+			}
+		}
 		seelog.Infof("V4 container metadata handler: writing response for container '%s'", containerID)
 
 		responseJSON, err := json.Marshal(containerResponse)
@@ -0,0 +1,126 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import "github.com/cihub/seelog"
+
+// Logger has the same logging methods as the seelog loggers, so that it can be
+// injected in place of the global seelog functions
+type Logger interface {
+	Tracef(format string, params ...interface{})
+	Debugf(format string, params ...interface{})
+	Infof(format string, params ...interface{})
+	Warnf(format string, params ...interface{}) error
+	Errorf(format string, params ...interface{}) error
+	Criticalf(format string, params ...interface{}) error
+	Trace(v ...interface{})
+	Debug(v ...interface{})
+	Info(v ...interface{})
+	Warn(v ...interface{}) error
+	Error(v ...interface{}) error
+	Critical(v ...interface{}) error
+}
+
+// NilSafeLogger routes the log calls to a seelog logger, or drops them when the
+// logger isn't initialized instead of panicking
+type NilSafeLogger struct {
+	// logger is the seelog logger the calls are routed to, the global seelog
+	// logger when nil
+	logger seelog.LoggerInterface
+}
+
+// NewNilSafeLogger returns a NilSafeLogger routing the log calls to the given
+// seelog logger, or to the global seelog logger when it's nil
+func NewNilSafeLogger(logger seelog.LoggerInterface) *NilSafeLogger {
+	return &NilSafeLogger{
+		logger: logger,
+	}
+}
+
+// current returns the logger the calls are routed to, a nopLogger if there's none
+func (l *NilSafeLogger) current() Logger {
+	if l != nil && l.logger != nil {
+		return l.logger
+	}
+	loggerMux.RLock()
+	defer loggerMux.RUnlock()
+	if seelog.Current == nil {
+		return nopLogger{}
+	}
+	return seelog.Current
+}
+
+func (l *NilSafeLogger) Tracef(format string, params ...interface{}) {
+	l.current().Tracef(format, params...)
+}
+
+func (l *NilSafeLogger) Debugf(format string, params ...interface{}) {
+	l.current().Debugf(format, params...)
+}
+
+func (l *NilSafeLogger) Infof(format string, params ...interface{}) {
+	l.current().Infof(format, params...)
+}
+
+func (l *NilSafeLogger) Warnf(format string, params ...interface{}) error {
+	return l.current().Warnf(format, params...)
+}
+
+func (l *NilSafeLogger) Errorf(format string, params ...interface{}) error {
+	return l.current().Errorf(format, params...)
+}
+
+func (l *NilSafeLogger) Criticalf(format string, params ...interface{}) error {
+	return l.current().Criticalf(format, params...)
+}
+
+func (l *NilSafeLogger) Trace(v ...interface{}) {
+	l.current().Trace(v...)
+}
+
+func (l *NilSafeLogger) Debug(v ...interface{}) {
+	l.current().Debug(v...)
+}
+
+func (l *NilSafeLogger) Info(v ...interface{}) {
+	l.current().Info(v...)
+}
+
+func (l *NilSafeLogger) Warn(v ...interface{}) error {
+	return l.current().Warn(v...)
+}
+
+func (l *NilSafeLogger) Error(v ...interface{}) error {
+	return l.current().Error(v...)
+}
+
+func (l *NilSafeLogger) Critical(v ...interface{}) error {
+	return l.current().Critical(v...)
+}
+
+// nopLogger drops every log call
+type nopLogger struct{}
+
+func (nopLogger) Tracef(format string, params ...interface{})          {}
+func (nopLogger) Debugf(format string, params ...interface{})          {}
+func (nopLogger) Infof(format string, params ...interface{})           {}
+func (nopLogger) Warnf(format string, params ...interface{}) error     { return nil }
+func (nopLogger) Errorf(format string, params ...interface{}) error    { return nil }
+func (nopLogger) Criticalf(format string, params ...interface{}) error { return nil }
+func (nopLogger) Trace(v ...interface{})                               {}
+func (nopLogger) Debug(v ...interface{})                               {}
+func (nopLogger) Info(v ...interface{})                                {}
+func (nopLogger) Warn(v ...interface{}) error                          { return nil }
+func (nopLogger) Error(v ...interface{}) error                         { return nil }
+func (nopLogger) Critical(v ...interface{}) error                      { return nil }
@@ -0,0 +1,84 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/cihub/seelog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBufferLogger returns a seelog logger writing the messages to the buffer
+func newBufferLogger(t *testing.T, buf *bytes.Buffer) seelog.LoggerInterface {
+	logger, err := seelog.LoggerFromWriterWithMinLevelAndFormat(buf, seelog.TraceLvl, "%Msg%n")
+	require.NoError(t, err)
+	return logger
+}
+
+func TestNilSafeLoggerRoutesToInjectedLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	seeLogger := newBufferLogger(t, buf)
+	logger := NewNilSafeLogger(seeLogger)
+
+	logger.Debugf("debug %d", 1)
+	logger.Info("info")
+	assert.Error(t, logger.Errorf("error %s", "message"))
+	seeLogger.Flush()
+
+	assert.Equal(t, "debug 1\ninfo\nerror message\n", buf.String())
+}
+
+func TestNilSafeLoggerRoutesToGlobalLogger(t *testing.T) {
+	defer globalLoggerBackup()()
+	buf := &bytes.Buffer{}
+	seeLogger := newBufferLogger(t, buf)
+	require.NoError(t, seelog.ReplaceLogger(seeLogger))
+
+	logger := NewNilSafeLogger(nil)
+	logger.Warnf("warn %d", 1)
+	seeLogger.Flush()
+
+	assert.Equal(t, "warn 1\n", buf.String())
+}
+
+func TestNilSafeLoggerDoesNotPanicWithoutLogger(t *testing.T) {
+	defer globalLoggerBackup()()
+	loggerMux.Lock()
+	seelog.Current = nil
+	loggerMux.Unlock()
+
+	var nilLogger *NilSafeLogger
+	for _, logger := range []Logger{NewNilSafeLogger(nil), nilLogger} {
+		assert.NotPanics(t, func() {
+			logger.Tracef("trace %d", 1)
+			logger.Debugf("debug %d", 1)
+			logger.Infof("info %d", 1)
+			assert.NoError(t, logger.Warnf("warn %d", 1))
+			assert.NoError(t, logger.Errorf("error %d", 1))
+			assert.NoError(t, logger.Criticalf("critical %d", 1))
+			logger.Trace("trace")
+			logger.Debug("debug")
+			logger.Info("info")
+			assert.NoError(t, logger.Warn("warn"))
+			assert.NoError(t, logger.Error("error"))
+			assert.NoError(t, logger.Critical("critical"))
+		})
+	}
+}
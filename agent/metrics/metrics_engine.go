@@ -30,6 +30,14 @@ type MetricsEngine struct {
 	cfg            *config.Config
 	Registry       *prometheus.Registry
 	managedMetrics map[APIType]MetricsClient
+	acsEvents      *prometheus.CounterVec
+	ebsWait        *prometheus.HistogramVec
+	handlerPanics  *prometheus.CounterVec
+	blocked        *prometheus.CounterVec
+	latencyBudget  *prometheus.CounterVec
+	sessionBytes   *prometheus.CounterVec
+	sessionRate    *prometheus.GaugeVec
+	splitTestMatch *prometheus.GaugeVec
 }
 
 const (
@@ -86,6 +94,14 @@ func NewMetricsEngine(cfg *config.Config, registry *prometheus.Registry) *Metric
 		cfg:            cfg,
 		Registry:       registry,
 		managedMetrics: make(map[APIType]MetricsClient),
+		acsEvents:      newACSEventCounterVec(registry),
+		ebsWait:        newEBSWaitDurationHistogram(registry),
+		handlerPanics:  newACSHandlerPanicCounterVec(registry),
+		blocked:        newACSHandlerGoroutinesBlockedCounterVec(registry),
+		latencyBudget:  newACSLatencyBudgetExceededCounterVec(registry),
+		sessionBytes:   newACSSessionBytesCounterVec(registry),
+		sessionRate:    newACSSessionMessageRateGauge(registry),
+		splitTestMatch: newACSSplitTestMatchRateGauge(registry),
 	}
 	for managedAPI := range managedAPIs {
 		aClient := NewMetricsClient(managedAPI, metricsEngine.Registry)
@@ -114,6 +130,80 @@ func (engine *MetricsEngine) RecordECSClientMetric(callName string) func() {
 	return engine.recordGenericMetric(ECSClient, callName)
 }
 
+// RecordACSEvent adds count to the number of times the event happened while
+// handling messages from ACS. It is a no-op if metrics collection is disabled
+func (engine *MetricsEngine) RecordACSEvent(eventName string, count int) {
+	if engine == nil || !engine.collection || count <= 0 {
+		return
+	}
+	engine.acsEvents.WithLabelValues(eventName).Add(float64(count))
+}
+
+// RecordACSHandlerPanic counts a panic recovered from the handler of ACS
+// messages of the given type. It is a no-op if metrics collection is disabled
+func (engine *MetricsEngine) RecordACSHandlerPanic(messageType string) {
+	if engine == nil || !engine.collection {
+		return
+	}
+	engine.handlerPanics.WithLabelValues(messageType).Inc()
+}
+
+// RecordACSHandlerGoroutineBlocked counts a goroutine of the handler of ACS
+// messages of the given type queued because the handlers already run the
+// maximum number of goroutines. It is a no-op if metrics collection is disabled
+func (engine *MetricsEngine) RecordACSHandlerGoroutineBlocked(messageType string) {
+	if engine == nil || !engine.collection {
+		return
+	}
+	engine.blocked.WithLabelValues(messageType).Inc()
+}
+
+// RecordACSLatencyBudgetExceeded counts a connection to ACS closed because its
+// round-trip latency exceeded the budget. It is a no-op if metrics collection
+// is disabled
+func (engine *MetricsEngine) RecordACSLatencyBudgetExceeded() {
+	if engine == nil || !engine.collection {
+		return
+	}
+	engine.latencyBudget.WithLabelValues().Inc()
+}
+
+// RecordACSSessionUsage adds the bytes sent to and received from ACS since the
+// last call, and sets the average number of messages exchanged with ACS per
+// second over the current connection. It is a no-op if metrics collection is disabled
+func (engine *MetricsEngine) RecordACSSessionUsage(bytesSent, bytesReceived uint64, messagesPerSecond float64) {
+	if engine == nil || !engine.collection {
+		return
+	}
+	engine.sessionBytes.WithLabelValues("Sent").Add(float64(bytesSent))
+	engine.sessionBytes.WithLabelValues("Received").Add(float64(bytesReceived))
+	engine.sessionRate.WithLabelValues().Set(messagesPerSecond)
+}
+
+// RecordACSSplitTestMatchRate sets the ratio of the messages of ACS split test
+// sessions received from both endpoints within the match window. It is a no-op
+// if metrics collection is disabled
+func (engine *MetricsEngine) RecordACSSplitTestMatchRate(matchRate float64) {
+	if engine == nil || !engine.collection {
+		return
+	}
+	engine.splitTestMatch.WithLabelValues().Set(matchRate)
+}
+
+// RecordEBSWaitDuration records how long a task waited for its EBS volumes to be
+// visible on the host before being started, and whether they became visible in
+// time. It is a no-op if metrics collection is disabled
+func (engine *MetricsEngine) RecordEBSWaitDuration(duration time.Duration, timedOut bool) {
+	if engine == nil || !engine.collection {
+		return
+	}
+	outcome := "Attached"
+	if timedOut {
+		outcome = "TimedOut"
+	}
+	engine.ebsWait.WithLabelValues(outcome).Observe(duration.Seconds())
+}
+
 // Records a call's start and returns a function to be deferred.
 // Wrapper functions will use this function for GenericMetricsClients.
 // If Metrics collection is enabled from the cfg, we record a metric with callID
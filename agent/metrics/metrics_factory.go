@@ -26,6 +26,7 @@ const (
 	TaskEngineSubsystem   = "TaskEngine"
 	StateManagerSubsystem = "StateManager"
 	ECSClientSubsystem    = "ECSClient"
+	ACSSubsystem          = "ACS"
 )
 
 // A factory method that enables various MetricsClients to be created.
@@ -45,6 +46,117 @@ func NewMetricsClient(api APIType, registry *prometheus.Registry) MetricsClient
 	}
 }
 
+// newACSEventCounterVec creates the counter vector used to count events that
+// happen while handling messages from ACS
+func newACSEventCounterVec(registry *prometheus.Registry) *prometheus.CounterVec {
+	aCounterVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: AgentNamespace,
+		Subsystem: ACSSubsystem,
+		Name:      "event_count",
+		Help:      ACSSubsystem + " event count",
+	}, []string{"Event"})
+	registry.MustRegister(aCounterVec)
+	return aCounterVec
+}
+
+// newACSHandlerPanicCounterVec creates the counter of the panics recovered from
+// the handlers of ACS messages
+func newACSHandlerPanicCounterVec(registry *prometheus.Registry) *prometheus.CounterVec {
+	aCounterVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: AgentNamespace,
+		Subsystem: ACSSubsystem,
+		Name:      "handler_panics_total",
+		Help:      "Number of panics recovered from the handlers of " + ACSSubsystem + " messages",
+	}, []string{"MessageType"})
+	registry.MustRegister(aCounterVec)
+	return aCounterVec
+}
+
+// newACSHandlerGoroutinesBlockedCounterVec creates the counter of the goroutines
+// of the handlers of ACS messages that were queued because the handlers already
+// ran the maximum number of goroutines
+func newACSHandlerGoroutinesBlockedCounterVec(registry *prometheus.Registry) *prometheus.CounterVec {
+	aCounterVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: AgentNamespace,
+		Subsystem: ACSSubsystem,
+		Name:      "handler_goroutines_blocked_total",
+		Help:      "Number of goroutines of the handlers of " + ACSSubsystem + " messages queued for a free slot",
+	}, []string{"MessageType"})
+	registry.MustRegister(aCounterVec)
+	return aCounterVec
+}
+
+// newACSLatencyBudgetExceededCounterVec creates the counter of the connections
+// to ACS closed because of their round-trip latency. Like the message rate
+// gauge, it is a vector without labels so that the counter is only exported
+// once a connection has been closed
+func newACSLatencyBudgetExceededCounterVec(registry *prometheus.Registry) *prometheus.CounterVec {
+	aCounterVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: AgentNamespace,
+		Subsystem: ACSSubsystem,
+		Name:      "latency_budget_exceeded_total",
+		Help:      "Number of connections to " + ACSSubsystem + " closed because their round-trip latency exceeded the budget",
+	}, nil)
+	registry.MustRegister(aCounterVec)
+	return aCounterVec
+}
+
+// newACSSessionBytesCounterVec creates the counter of the bytes sent to and
+// received from ACS
+func newACSSessionBytesCounterVec(registry *prometheus.Registry) *prometheus.CounterVec {
+	aCounterVec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: AgentNamespace,
+		Subsystem: ACSSubsystem,
+		Name:      "session_bytes_total",
+		Help:      "Number of bytes sent to and received from " + ACSSubsystem,
+	}, []string{"Direction"})
+	registry.MustRegister(aCounterVec)
+	return aCounterVec
+}
+
+// newACSSessionMessageRateGauge creates the gauge of the average number of
+// messages exchanged with ACS per second over the current connection. It is a
+// vector without labels so that the gauge is only exported once a connection
+// has been established
+func newACSSessionMessageRateGauge(registry *prometheus.Registry) *prometheus.GaugeVec {
+	aGaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: AgentNamespace,
+		Subsystem: ACSSubsystem,
+		Name:      "session_messages_per_second",
+		Help:      "Average number of messages exchanged with " + ACSSubsystem + " per second over the current connection",
+	}, nil)
+	registry.MustRegister(aGaugeVec)
+	return aGaugeVec
+}
+
+// newACSSplitTestMatchRateGauge creates the gauge of the ratio of the messages
+// of ACS split test sessions received from both endpoints. Like the message
+// rate gauge, it is only exported once a split test session compared messages
+func newACSSplitTestMatchRateGauge(registry *prometheus.Registry) *prometheus.GaugeVec {
+	aGaugeVec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: AgentNamespace,
+		Subsystem: ACSSubsystem,
+		Name:      "split_test_message_match_rate",
+		Help:      "Ratio of the messages of " + ACSSubsystem + " split test sessions received from both endpoints",
+	}, nil)
+	registry.MustRegister(aGaugeVec)
+	return aGaugeVec
+}
+
+// newEBSWaitDurationHistogram creates the histogram of the time tasks wait for
+// their EBS volumes to be visible on the host before being started
+func newEBSWaitDurationHistogram(registry *prometheus.Registry) *prometheus.HistogramVec {
+	aHistogramVec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: AgentNamespace,
+		Subsystem: ACSSubsystem,
+		Name:      "ebs_wait_duration_seconds",
+		Help:      "Time tasks wait for their EBS volumes to be visible on the host in seconds",
+		Buckets:   []float64{1, 2, 5, 10, 20, 30, 60, 90, 120},
+	}, []string{"Outcome"})
+	registry.MustRegister(aHistogramVec)
+	return aHistogramVec
+}
+
 func NewGenericMetricsClient(subsystem string, registry *prometheus.Registry) *GenericMetrics {
 	aDurationVec := prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace:  AgentNamespace,
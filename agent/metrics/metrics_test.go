@@ -26,6 +26,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Create default config for Metrics. PrometheusMetricsEnabled is set to false
@@ -159,6 +160,218 @@ func TestMetricCollection(t *testing.T) {
 	assert.True(t, verifyStats(metricFamilies, expected), "Metrics are not accurate")
 }
 
+// Tests that ACS events are counted when metrics collection is enabled
+func TestRecordACSEvent(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	MetricsEngineGlobal.RecordACSEvent("TestEvent", 2)
+	MetricsEngineGlobal.RecordACSEvent("TestEvent", 1)
+	MetricsEngineGlobal.RecordACSEvent("TestEvent", 0)
+
+	metricFamilies, err := MetricsEngineGlobal.Registry.Gather()
+	assert.NoError(t, err)
+
+	expected := make(metricMap)
+	expected["AgentMetrics_ACS_event_count"] = make(map[string][]interface{})
+	expected["AgentMetrics_ACS_event_count"]["EventTestEvent"] = []interface{}{
+		"COUNTER",
+		3.0,
+	}
+	assert.True(t, verifyStats(metricFamilies, expected), "Metrics are not accurate")
+}
+
+// Tests that recording ACS events is a no-op when metrics collection is disabled
+func TestRecordACSEventCollectionDisabled(t *testing.T) {
+	assert.NotPanics(t, func() {
+		MetricsEngineGlobal.RecordACSEvent("TestEvent", 1)
+	})
+}
+
+// Tests that the panics of ACS handlers are counted by message type when metrics
+// collection is enabled
+func TestRecordACSHandlerPanic(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	MetricsEngineGlobal.RecordACSHandlerPanic("PayloadMessage")
+	MetricsEngineGlobal.RecordACSHandlerPanic("PayloadMessage")
+
+	metricFamilies, err := MetricsEngineGlobal.Registry.Gather()
+	assert.NoError(t, err)
+
+	expected := make(metricMap)
+	expected["AgentMetrics_ACS_handler_panics_total"] = make(map[string][]interface{})
+	expected["AgentMetrics_ACS_handler_panics_total"]["MessageTypePayloadMessage"] = []interface{}{
+		"COUNTER",
+		2.0,
+	}
+	assert.True(t, verifyStats(metricFamilies, expected), "Metrics are not accurate")
+}
+
+// Tests that the queued goroutines of ACS handlers are counted by message type
+// when metrics collection is enabled
+func TestRecordACSHandlerGoroutineBlocked(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	MetricsEngineGlobal.RecordACSHandlerGoroutineBlocked("HeartbeatMessage")
+
+	metricFamilies, err := MetricsEngineGlobal.Registry.Gather()
+	assert.NoError(t, err)
+
+	expected := make(metricMap)
+	expected["AgentMetrics_ACS_handler_goroutines_blocked_total"] = make(map[string][]interface{})
+	expected["AgentMetrics_ACS_handler_goroutines_blocked_total"]["MessageTypeHeartbeatMessage"] = []interface{}{
+		"COUNTER",
+		1.0,
+	}
+	assert.True(t, verifyStats(metricFamilies, expected), "Metrics are not accurate")
+}
+
+// Tests that the connections closed because of their latency are counted when
+// metrics collection is enabled
+func TestRecordACSLatencyBudgetExceeded(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	MetricsEngineGlobal.RecordACSLatencyBudgetExceeded()
+	MetricsEngineGlobal.RecordACSLatencyBudgetExceeded()
+
+	metricFamilies, err := MetricsEngineGlobal.Registry.Gather()
+	assert.NoError(t, err)
+
+	var exceeded *dto.MetricFamily
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() == "AgentMetrics_ACS_latency_budget_exceeded_total" {
+			exceeded = metricFamily
+		}
+	}
+	require.NotNil(t, exceeded)
+	require.Len(t, exceeded.GetMetric(), 1)
+	assert.Equal(t, 2.0, exceeded.GetMetric()[0].GetCounter().GetValue())
+}
+
+// Tests that the usage of the ACS connection is recorded when metrics collection
+// is enabled
+func TestRecordACSSessionUsage(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	MetricsEngineGlobal.RecordACSSessionUsage(100, 300, 1.5)
+	MetricsEngineGlobal.RecordACSSessionUsage(50, 0, 0.5)
+
+	metricFamilies, err := MetricsEngineGlobal.Registry.Gather()
+	assert.NoError(t, err)
+
+	expected := make(metricMap)
+	expected["AgentMetrics_ACS_session_bytes_total"] = make(map[string][]interface{})
+	expected["AgentMetrics_ACS_session_bytes_total"]["DirectionSent"] = []interface{}{
+		"COUNTER",
+		150.0,
+	}
+	expected["AgentMetrics_ACS_session_bytes_total"]["DirectionReceived"] = []interface{}{
+		"COUNTER",
+		300.0,
+	}
+	var messageRate *dto.MetricFamily
+	var otherFamilies []*dto.MetricFamily
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() == "AgentMetrics_ACS_session_messages_per_second" {
+			messageRate = metricFamily
+			continue
+		}
+		otherFamilies = append(otherFamilies, metricFamily)
+	}
+	assert.True(t, verifyStats(otherFamilies, expected), "Metrics are not accurate")
+	require.NotNil(t, messageRate)
+	require.Len(t, messageRate.GetMetric(), 1)
+	assert.Equal(t, 0.5, messageRate.GetMetric()[0].GetGauge().GetValue())
+}
+
+// Tests that the time tasks wait for their EBS volumes is recorded when metrics
+// collection is enabled
+func TestRecordEBSWaitDuration(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	MetricsEngineGlobal.RecordEBSWaitDuration(3*time.Second, false)
+	MetricsEngineGlobal.RecordEBSWaitDuration(time.Minute, false)
+	MetricsEngineGlobal.RecordEBSWaitDuration(2*time.Minute, true)
+
+	metricFamilies, err := MetricsEngineGlobal.Registry.Gather()
+	assert.NoError(t, err)
+	histograms := make(map[string]*dto.Histogram)
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() != "AgentMetrics_ACS_ebs_wait_duration_seconds" {
+			continue
+		}
+		for _, metric := range metricFamily.GetMetric() {
+			histograms[metric.GetLabel()[0].GetValue()] = metric.GetHistogram()
+		}
+	}
+	require.Len(t, histograms, 2)
+	assert.Equal(t, uint64(2), histograms["Attached"].GetSampleCount())
+	assert.Equal(t, 63.0, histograms["Attached"].GetSampleSum())
+	assert.Equal(t, uint64(1), histograms["TimedOut"].GetSampleCount())
+}
+
+// Tests that recording the EBS wait duration is a no-op when metrics collection is disabled
+func TestRecordEBSWaitDurationCollectionDisabled(t *testing.T) {
+	assert.NotPanics(t, func() {
+		MetricsEngineGlobal.RecordEBSWaitDuration(time.Second, false)
+	})
+}
+
+// Tests that the match rate of the ACS split test sessions is exported as a gauge
+func TestRecordACSSplitTestMatchRate(t *testing.T) {
+	defer func() {
+		MetricsEngineGlobal = &MetricsEngine{
+			collection: false,
+		}
+	}()
+	cfg := getTestConfig()
+	MustInit(&cfg, prometheus.NewRegistry())
+	MetricsEngineGlobal.RecordACSSplitTestMatchRate(0.25)
+	MetricsEngineGlobal.RecordACSSplitTestMatchRate(0.75)
+
+	metricFamilies, err := MetricsEngineGlobal.Registry.Gather()
+	assert.NoError(t, err)
+	var matchRate *dto.MetricFamily
+	for _, metricFamily := range metricFamilies {
+		if metricFamily.GetName() == "AgentMetrics_ACS_split_test_message_match_rate" {
+			matchRate = metricFamily
+		}
+	}
+	require.NotNil(t, matchRate)
+	require.Len(t, matchRate.GetMetric(), 1)
+	assert.Equal(t, 0.75, matchRate.GetMetric()[0].GetGauge().GetValue())
+}
+
 // A type for storing a Tree-based map. We map the MetricName to a map of metrics
 // under that name. This second map indexes by MetricLabelName+MetricLabelValue to
 // a slice MetricType and MetricValue.
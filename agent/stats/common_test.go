@@ -313,6 +313,10 @@ func (engine *MockTaskEngine) GetTaskByArn(arn string) (*apitask.Task, bool) {
 	return nil, false
 }
 
+func (engine *MockTaskEngine) UpdateManagedAgent(taskARN, agentType, configBlob string) error {
+	return nil
+}
+
 func (engine *MockTaskEngine) UnmarshalJSON([]byte) error {
 	return nil
 }
@@ -366,6 +366,13 @@ func getASMParametersFromInput(valueFrom string) (input *secretsmanager.GetSecre
 	return input, jsonKey, nil
 }
 
+// GetSecretValueInput returns the input of the GetSecretValue call retrieving
+// the secret referenced by valueFrom
+func GetSecretValueInput(valueFrom string) (*secretsmanager.GetSecretValueInput, error) {
+	input, _, err := getASMParametersFromInput(valueFrom)
+	return input, err
+}
+
 // this method is to reconstruct an ASM ARN that has the enhancement parameters
 // attached to it. in order to call secretsmanager:GetSecretValue, the entire ARN
 // (including the 6 character special identifier tacked on by ASM) is required or
@@ -48,6 +48,8 @@ func init() {
 		ecstcs.InvalidParameterException{},
 		ecstcs.AckPublishInstanceStatus{},
 		ecstcs.PublishInstanceStatusRequest{},
+		ecstcs.PublishSessionTelemetryRequest{},
+		ecstcs.AckPublishSessionTelemetry{},
 	}
 }
 
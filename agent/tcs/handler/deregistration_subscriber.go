@@ -0,0 +1,51 @@
+//go:build !typedeventstream
+// +build !typedeventstream
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcshandler
+
+import (
+	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+)
+
+// subscribeToDeregistration subscribes to the deregister instance event stream
+// to disconnect the client from TCS when the container instance is deregistered,
+// and returns the function unsubscribing from it
+func subscribeToDeregistration(deregisterInstanceEventStream *eventstream.DeregisterInstanceEventStream,
+	client wsclient.ClientServer) (func(), error) {
+	err := deregisterInstanceEventStream.Subscribe(deregisterContainerInstanceHandler, disconnectOnDeregistration(client))
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		deregisterInstanceEventStream.Unsubscribe(deregisterContainerInstanceHandler)
+	}, nil
+}
+
+// disconnectOnDeregistration returns the handler of the deregister instance event
+// stream disconnecting the client from TCS when the container instance is
+// deregistered. Other events written to the stream, such as the container
+// instance being put into the DRAINING status, don't affect the connection
+func disconnectOnDeregistration(client wsclient.ClientServer) func(...interface{}) error {
+	return func(events ...interface{}) error {
+		for _, event := range events {
+			if _, ok := event.(struct{}); ok {
+				return client.Disconnect()
+			}
+		}
+		return nil
+	}
+}
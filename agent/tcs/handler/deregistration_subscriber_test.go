@@ -0,0 +1,39 @@
+//go:build unit && !typedeventstream
+// +build unit,!typedeventstream
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcshandler
+
+import (
+	"testing"
+
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisconnectOnDeregistration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	client := mock_wsclient.NewMockClientServer(ctrl)
+	handler := disconnectOnDeregistration(client)
+
+	// The container instance being put into the DRAINING status doesn't
+	// disconnect the client
+	assert.NoError(t, handler("DRAINING"))
+
+	client.EXPECT().Disconnect().Return(nil)
+	assert.NoError(t, handler(struct{}{}))
+}
@@ -0,0 +1,55 @@
+//go:build typedeventstream && go1.21
+// +build typedeventstream,go1.21
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcshandler
+
+import (
+	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	"github.com/cihub/seelog"
+)
+
+// subscribeToDeregistration subscribes to the deregister instance event stream
+// to disconnect the client from TCS when the container instance is deregistered,
+// and returns the function unsubscribing from it. Other events written to the
+// stream, such as the container instance being put into the DRAINING status,
+// don't affect the connection
+func subscribeToDeregistration(deregisterInstanceEventStream *eventstream.DeregisterInstanceEventStream,
+	client wsclient.ClientServer) (func(), error) {
+	events := deregisterInstanceEventStream.Subscribe()
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case event := <-events:
+				if event.Type != eventstream.InstanceDeregistered {
+					continue
+				}
+				if err := client.Disconnect(); err != nil {
+					seelog.Debugf("Error disconnecting from TCS on deregistration: %v", err)
+				}
+			case <-done:
+				return
+			case <-deregisterInstanceEventStream.Context().Done():
+				return
+			}
+		}
+	}()
+	return func() {
+		deregisterInstanceEventStream.Unsubscribe(events)
+		close(done)
+	}, nil
+}
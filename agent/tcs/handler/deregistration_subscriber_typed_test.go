@@ -0,0 +1,60 @@
+//go:build unit && typedeventstream && go1.21
+// +build unit,typedeventstream,go1.21
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcshandler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/eventstream"
+	mock_wsclient "github.com/aws/amazon-ecs-agent/agent/wsclient/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisconnectOnDeregistration(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	eventStream := eventstream.NewDeregisterInstanceEventStream("Deregister_Instance", ctx)
+	eventStream.StartListening()
+	client := mock_wsclient.NewMockClientServer(ctrl)
+	unsubscribe, err := subscribeToDeregistration(eventStream, client)
+	require.NoError(t, err)
+	defer unsubscribe()
+
+	// The container instance being put into the DRAINING status doesn't
+	// disconnect the client
+	assert.NoError(t, eventStream.Write(eventstream.ConnectionEvent{
+		Type:   eventstream.InstanceStatusChanged,
+		Status: "DRAINING",
+	}))
+
+	disconnected := make(chan struct{})
+	client.EXPECT().Disconnect().Do(func() {
+		close(disconnected)
+	}).Return(nil)
+	assert.NoError(t, eventStream.Write(eventstream.ConnectionEvent{Type: eventstream.InstanceDeregistered}))
+	select {
+	case <-disconnected:
+	case <-time.After(time.Second):
+		t.Fatal("Client not disconnected on deregistration")
+	}
+}
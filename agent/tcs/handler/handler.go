@@ -114,18 +114,18 @@ func startSession(
 	statsEngine stats.Engine,
 	heartbeatTimeout, heartbeatJitter,
 	publishMetricsInterval time.Duration,
-	deregisterInstanceEventStream *eventstream.EventStream,
+	deregisterInstanceEventStream *eventstream.DeregisterInstanceEventStream,
 	doctor *doctor.Doctor,
 ) error {
 	client := tcsclient.New(url, cfg, credentialProvider, statsEngine,
 		publishMetricsInterval, wsRWTimeout, cfg.DisableMetrics.Enabled(), doctor)
 	defer client.Close()
 
-	err := deregisterInstanceEventStream.Subscribe(deregisterContainerInstanceHandler, client.Disconnect)
+	unsubscribe, err := subscribeToDeregistration(deregisterInstanceEventStream, client)
 	if err != nil {
 		return err
 	}
-	defer deregisterInstanceEventStream.Unsubscribe(deregisterContainerInstanceHandler)
+	defer unsubscribe()
 
 	err = client.Connect()
 	if err != nil {
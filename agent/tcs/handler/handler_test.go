@@ -136,7 +136,7 @@ func TestStartSession(t *testing.T) {
 		close(serverChan)
 	}()
 
-	deregisterInstanceEventStream := eventstream.NewEventStream("Deregister_Instance", context.Background())
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("Deregister_Instance", context.Background())
 	// Start a session with the test server.
 	go startSession(ctx, server.URL, testCfg, testCreds, &mockStatsEngine{},
 		defaultHeartbeatTimeout, defaultHeartbeatJitter,
@@ -197,7 +197,7 @@ func TestSessionConnectionClosedByRemote(t *testing.T) {
 	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
-	deregisterInstanceEventStream := eventstream.NewEventStream("Deregister_Instance", ctx)
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("Deregister_Instance", ctx)
 	deregisterInstanceEventStream.StartListening()
 	defer cancel()
 
@@ -235,7 +235,7 @@ func TestConnectionInactiveTimeout(t *testing.T) {
 	}()
 
 	ctx, cancel := context.WithCancel(context.Background())
-	deregisterInstanceEventStream := eventstream.NewEventStream("Deregister_Instance", ctx)
+	deregisterInstanceEventStream := eventstream.NewDeregisterInstanceEventStream("Deregister_Instance", ctx)
 	deregisterInstanceEventStream.StartListening()
 	defer cancel()
 	// Start a session with the test server.
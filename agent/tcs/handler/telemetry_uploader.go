@@ -0,0 +1,137 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcshandler
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/api"
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/aws/amazon-ecs-agent/agent/engine"
+	tcsclient "github.com/aws/amazon-ecs-agent/agent/tcs/client"
+	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/cihub/seelog"
+)
+
+// SessionTelemetry contains the metrics aggregated over a connection to ACS
+type SessionTelemetry struct {
+	// SessionID is the persistent ID of the ACS session the connection belongs to
+	SessionID string
+	// ConnectedAt is the time the connection was established
+	ConnectedAt time.Time
+	// ConnectDuration is the time the connection remained established
+	ConnectDuration time.Duration
+	// MessageCounts is the number of messages handled, by message type
+	MessageCounts map[string]int64
+	// ErrorCount is the number of messages whose handling failed
+	ErrorCount int64
+	// ReconnectCount is the number of connections of the session that
+	// preceded this one
+	ReconnectCount int64
+	// CloseReason is the error the connection was closed with, empty if it
+	// was closed without error
+	CloseReason string
+}
+
+// TelemetryUploader uploads the metrics aggregated over a connection to ACS to
+// the telemetry service when the connection is closed. Every upload discovers
+// the telemetry endpoint and opens a dedicated connection to it, so that the
+// upload doesn't depend on the metrics session being established
+type TelemetryUploader struct {
+	cfg                  *config.Config
+	credentialProvider   *credentials.Credentials
+	ecsClient            api.ECSClient
+	taskEngine           engine.TaskEngine
+	containerInstanceArn string
+}
+
+// NewTelemetryUploader returns a new TelemetryUploader for the container instance
+func NewTelemetryUploader(
+	cfg *config.Config,
+	credentialProvider *credentials.Credentials,
+	ecsClient api.ECSClient,
+	taskEngine engine.TaskEngine,
+	containerInstanceArn string,
+) *TelemetryUploader {
+	return &TelemetryUploader{
+		cfg:                  cfg,
+		credentialProvider:   credentialProvider,
+		ecsClient:            ecsClient,
+		taskEngine:           taskEngine,
+		containerInstanceArn: containerInstanceArn,
+	}
+}
+
+// Upload sends the telemetry of the connection to the telemetry service
+func (uploader *TelemetryUploader) Upload(telemetry SessionTelemetry) error {
+	tcsEndpoint, err := uploader.ecsClient.DiscoverTelemetryEndpoint(uploader.containerInstanceArn)
+	if err != nil {
+		seelog.Errorf("tcs: unable to discover poll endpoint: %v", err)
+		return err
+	}
+	url := formatURL(tcsEndpoint, uploader.cfg.Cluster, uploader.containerInstanceArn, uploader.taskEngine)
+	return uploader.upload(url, telemetry)
+}
+
+// upload connects to the telemetry service at the url and sends the telemetry
+// of the connection to ACS
+func (uploader *TelemetryUploader) upload(url string, telemetry SessionTelemetry) error {
+	// The client is never served, it doesn't publish the metrics of the stats engine
+	client := tcsclient.New(url, uploader.cfg, uploader.credentialProvider, nil,
+		config.DefaultContainerMetricsPublishInterval, wsRWTimeout, true, nil)
+	defer client.Close()
+
+	if err := client.Connect(); err != nil {
+		seelog.Errorf("Error connecting to TCS to upload the ACS session telemetry: %v", err)
+		return err
+	}
+	return client.MakeRequest(uploader.request(telemetry))
+}
+
+// request returns the message publishing the telemetry of the connection to ACS
+func (uploader *TelemetryUploader) request(telemetry SessionTelemetry) *ecstcs.PublishSessionTelemetryRequest {
+	messageTypes := make([]string, 0, len(telemetry.MessageCounts))
+	for messageType := range telemetry.MessageCounts {
+		messageTypes = append(messageTypes, messageType)
+	}
+	sort.Strings(messageTypes)
+	messageCounts := make([]*ecstcs.MessageCount, 0, len(messageTypes))
+	for _, messageType := range messageTypes {
+		messageCounts = append(messageCounts, &ecstcs.MessageCount{
+			MessageType: aws.String(messageType),
+			Count:       aws.Int64(telemetry.MessageCounts[messageType]),
+		})
+	}
+
+	request := &ecstcs.PublishSessionTelemetryRequest{
+		Metadata: &ecstcs.SessionTelemetryMetadata{
+			Cluster:           aws.String(uploader.cfg.Cluster),
+			ContainerInstance: aws.String(uploader.containerInstanceArn),
+			SessionId:         aws.String(telemetry.SessionID),
+		},
+		ConnectedAt:       aws.Time(telemetry.ConnectedAt),
+		ConnectDurationMs: aws.Int64(int64(telemetry.ConnectDuration / time.Millisecond)),
+		MessageCounts:     messageCounts,
+		ErrorCount:        aws.Int64(telemetry.ErrorCount),
+		ReconnectCount:    aws.Int64(telemetry.ReconnectCount),
+		Timestamp:         aws.Time(time.Now()),
+	}
+	if telemetry.CloseReason != "" {
+		request.CloseReason = aws.String(telemetry.CloseReason)
+	}
+	return request
+}
@@ -0,0 +1,141 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package tcshandler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	mock_api "github.com/aws/amazon-ecs-agent/agent/api/mocks"
+	mock_engine "github.com/aws/amazon-ecs-agent/agent/engine/mocks"
+	tcsclient "github.com/aws/amazon-ecs-agent/agent/tcs/client"
+	"github.com/aws/amazon-ecs-agent/agent/tcs/model/ecstcs"
+	"github.com/aws/amazon-ecs-agent/agent/wsclient"
+	wsmock "github.com/aws/amazon-ecs-agent/agent/wsclient/mock/utils"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testSessionTelemetry() SessionTelemetry {
+	return SessionTelemetry{
+		SessionID:       "session-id",
+		ConnectedAt:     time.Unix(1600000000, 0),
+		ConnectDuration: 90 * time.Second,
+		MessageCounts: map[string]int64{
+			"PayloadMessage":      3,
+			"HeartbeatMessage":    10,
+			"TaskManifestMessage": 1,
+		},
+		ErrorCount:     1,
+		ReconnectCount: 2,
+		CloseReason:    "EOF",
+	}
+}
+
+// receiveSessionTelemetry returns the session telemetry request received by the
+// mock telemetry server
+func receiveSessionTelemetry(t *testing.T, requestChan <-chan string) *ecstcs.PublishSessionTelemetryRequest {
+	select {
+	case request := <-requestChan:
+		payload, err := getPayloadFromRequest(request)
+		require.NoError(t, err)
+		message, messageType, err := wsclient.DecodeData([]byte(payload), tcsclient.NewTCSDecoder())
+		require.NoError(t, err)
+		require.Equal(t, "PublishSessionTelemetryRequest", messageType)
+		return message.(*ecstcs.PublishSessionTelemetryRequest)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the session telemetry")
+	}
+	return nil
+}
+
+func TestTelemetryUploaderUpload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	closeWS := make(chan []byte)
+	server, serverChan, requestChan, _, err := wsmock.GetMockServer(closeWS)
+	require.NoError(t, err)
+	server.StartTLS()
+	defer server.Close()
+	defer func() {
+		closeSocket(closeWS)
+		close(serverChan)
+	}()
+
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	taskEngine := mock_engine.NewMockTaskEngine(ctrl)
+	ecsClient.EXPECT().DiscoverTelemetryEndpoint(testInstanceArn).Return(server.URL, nil)
+	taskEngine.EXPECT().Version().Return("Docker version result", nil)
+
+	cfg := *testCfg
+	cfg.Cluster = testClusterArn
+	uploader := NewTelemetryUploader(&cfg, testCreds, ecsClient, taskEngine, testInstanceArn)
+
+	uploadErr := make(chan error, 1)
+	go func() {
+		uploadErr <- uploader.Upload(testSessionTelemetry())
+	}()
+	request := receiveSessionTelemetry(t, requestChan)
+	assert.NoError(t, <-uploadErr)
+
+	assert.Equal(t, testClusterArn, aws.StringValue(request.Metadata.Cluster))
+	assert.Equal(t, testInstanceArn, aws.StringValue(request.Metadata.ContainerInstance))
+	assert.Equal(t, "session-id", aws.StringValue(request.Metadata.SessionId))
+	assert.Equal(t, time.Unix(1600000000, 0).Unix(), aws.TimeValue(request.ConnectedAt).Unix())
+	assert.Equal(t, int64(90000), aws.Int64Value(request.ConnectDurationMs))
+	assert.Equal(t, int64(1), aws.Int64Value(request.ErrorCount))
+	assert.Equal(t, int64(2), aws.Int64Value(request.ReconnectCount))
+	assert.Equal(t, "EOF", aws.StringValue(request.CloseReason))
+	require.Len(t, request.MessageCounts, 3)
+	// Message counts are sorted by message type
+	assert.Equal(t, "HeartbeatMessage", aws.StringValue(request.MessageCounts[0].MessageType))
+	assert.Equal(t, int64(10), aws.Int64Value(request.MessageCounts[0].Count))
+	assert.Equal(t, "PayloadMessage", aws.StringValue(request.MessageCounts[1].MessageType))
+	assert.Equal(t, int64(3), aws.Int64Value(request.MessageCounts[1].Count))
+	assert.Equal(t, "TaskManifestMessage", aws.StringValue(request.MessageCounts[2].MessageType))
+	assert.Equal(t, int64(1), aws.Int64Value(request.MessageCounts[2].Count))
+}
+
+func TestTelemetryUploaderCleanClose(t *testing.T) {
+	uploader := NewTelemetryUploader(testCfg, testCreds, nil, nil, testInstanceArn)
+	telemetry := testSessionTelemetry()
+	telemetry.CloseReason = ""
+
+	request := uploader.request(telemetry)
+	assert.Nil(t, request.CloseReason)
+	assert.Len(t, request.MessageCounts, 3)
+}
+
+func TestTelemetryUploaderDiscoverEndpointError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ecsClient := mock_api.NewMockECSClient(ctrl)
+	ecsClient.EXPECT().DiscoverTelemetryEndpoint(testInstanceArn).Return("", errors.New("error"))
+
+	uploader := NewTelemetryUploader(testCfg, testCreds, ecsClient, nil, testInstanceArn)
+	assert.Error(t, uploader.Upload(testSessionTelemetry()))
+}
+
+func TestTelemetryUploaderConnectError(t *testing.T) {
+	uploader := NewTelemetryUploader(testCfg, testCreds, nil, nil, testInstanceArn)
+	assert.Error(t, uploader.upload("https://127.0.0.1:0/ws", testSessionTelemetry()))
+}
@@ -35,7 +35,7 @@ type TelemetrySessionParams struct {
 	ContainerInstanceArn          string
 	CredentialProvider            *credentials.Credentials
 	Cfg                           *config.Config
-	DeregisterInstanceEventStream *eventstream.EventStream
+	DeregisterInstanceEventStream *eventstream.DeregisterInstanceEventStream
 	AcceptInvalidCert             bool
 	ECSClient                     api.ECSClient
 	TaskEngine                    engine.TaskEngine
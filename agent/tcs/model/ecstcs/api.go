@@ -72,6 +72,22 @@ func (s AckPublishMetric) GoString() string {
 	return s.String()
 }
 
+type AckPublishSessionTelemetry struct {
+	_ struct{} `type:"structure"`
+
+	Message *string `locationName:"message" type:"string"`
+}
+
+// String returns the string representation
+func (s AckPublishSessionTelemetry) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s AckPublishSessionTelemetry) GoString() string {
+	return s.String()
+}
+
 type BadRequestException struct {
 	_            struct{}                  `type:"structure"`
 	RespMetadata protocol.ResponseMetadata `json:"-" xml:"-"`
@@ -380,6 +396,24 @@ func (s *InvalidParameterException) RequestID() string {
 	return s.RespMetadata.RequestID
 }
 
+type MessageCount struct {
+	_ struct{} `type:"structure"`
+
+	Count *int64 `locationName:"count" type:"long"`
+
+	MessageType *string `locationName:"messageType" type:"string"`
+}
+
+// String returns the string representation
+func (s MessageCount) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s MessageCount) GoString() string {
+	return s.String()
+}
+
 type MetricsMetadata struct {
 	_ struct{} `type:"structure"`
 
@@ -686,6 +720,82 @@ func (s PublishMetricsRequest) GoString() string {
 	return s.String()
 }
 
+type PublishSessionTelemetryInput struct {
+	_ struct{} `type:"structure"`
+
+	CloseReason *string `locationName:"closeReason" type:"string"`
+
+	ConnectDurationMs *int64 `locationName:"connectDurationMs" type:"long"`
+
+	ConnectedAt *time.Time `locationName:"connectedAt" type:"timestamp"`
+
+	ErrorCount *int64 `locationName:"errorCount" type:"long"`
+
+	MessageCounts []*MessageCount `locationName:"messageCounts" type:"list"`
+
+	Metadata *SessionTelemetryMetadata `locationName:"metadata" type:"structure"`
+
+	ReconnectCount *int64 `locationName:"reconnectCount" type:"long"`
+
+	Timestamp *time.Time `locationName:"timestamp" type:"timestamp"`
+}
+
+// String returns the string representation
+func (s PublishSessionTelemetryInput) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s PublishSessionTelemetryInput) GoString() string {
+	return s.String()
+}
+
+type PublishSessionTelemetryOutput struct {
+	_ struct{} `type:"structure"`
+
+	Message *string `locationName:"message" type:"string"`
+}
+
+// String returns the string representation
+func (s PublishSessionTelemetryOutput) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s PublishSessionTelemetryOutput) GoString() string {
+	return s.String()
+}
+
+type PublishSessionTelemetryRequest struct {
+	_ struct{} `type:"structure"`
+
+	CloseReason *string `locationName:"closeReason" type:"string"`
+
+	ConnectDurationMs *int64 `locationName:"connectDurationMs" type:"long"`
+
+	ConnectedAt *time.Time `locationName:"connectedAt" type:"timestamp"`
+
+	ErrorCount *int64 `locationName:"errorCount" type:"long"`
+
+	MessageCounts []*MessageCount `locationName:"messageCounts" type:"list"`
+
+	Metadata *SessionTelemetryMetadata `locationName:"metadata" type:"structure"`
+
+	ReconnectCount *int64 `locationName:"reconnectCount" type:"long"`
+
+	Timestamp *time.Time `locationName:"timestamp" type:"timestamp"`
+}
+
+// String returns the string representation
+func (s PublishSessionTelemetryRequest) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s PublishSessionTelemetryRequest) GoString() string {
+	return s.String()
+}
+
 type ResourceValidationException struct {
 	_            struct{}                  `type:"structure"`
 	RespMetadata protocol.ResponseMetadata `json:"-" xml:"-"`
@@ -796,6 +906,26 @@ func (s *ServerException) RequestID() string {
 	return s.RespMetadata.RequestID
 }
 
+type SessionTelemetryMetadata struct {
+	_ struct{} `type:"structure"`
+
+	Cluster *string `locationName:"cluster" type:"string"`
+
+	ContainerInstance *string `locationName:"containerInstance" type:"string"`
+
+	SessionId *string `locationName:"sessionId" type:"string"`
+}
+
+// String returns the string representation
+func (s SessionTelemetryMetadata) String() string {
+	return awsutil.Prettify(s)
+}
+
+// GoString returns the string representation
+func (s SessionTelemetryMetadata) GoString() string {
+	return s.String()
+}
+
 type StartTelemetrySessionInput struct {
 	_ struct{} `type:"structure"`
 
@@ -36,13 +36,13 @@ import (
 	"github.com/aws/amazon-ecs-agent/agent/logger"
 
 	"crypto/tls"
+	"crypto/x509"
 
 	"github.com/aws/amazon-ecs-agent/agent/config"
 	"github.com/aws/amazon-ecs-agent/agent/utils"
 	"github.com/aws/amazon-ecs-agent/agent/utils/cipher"
 	"github.com/aws/amazon-ecs-agent/agent/wsclient/wsconn"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
 	"github.com/cihub/seelog"
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
@@ -69,6 +69,18 @@ const (
 	defaultNoProxyIP = "169.254.169.254,169.254.170.2"
 
 	errClosed = "use of closed network connection"
+
+	// requestIDHeader is the header of the backend responses holding the ID of
+	// the request
+	requestIDHeader = "X-Amzn-RequestId"
+
+	// availabilityZoneHeader is the header of the backend responses holding the
+	// availability zone of the backend host
+	availabilityZoneHeader = "X-ACS-AZ"
+
+	// defaultMessageQueueCapacity is the default maximum number of messages
+	// waiting in the message queue
+	defaultMessageQueueCapacity = 16
 )
 
 // ReceivedMessage is the intermediate message used to unmarshal a
@@ -123,9 +135,57 @@ type ClientServerImpl struct {
 	// message with said message. It will be called before a RequestHandler is
 	// called. It must take a single interface{} argument.
 	AnyRequestHandler RequestHandler
+	// MessagePriorities is an optional map from message types to the priority
+	// with which they are dispatched. If set, messages whose priority is below
+	// PriorityThreshold are queued and dispatched in priority order by a separate
+	// goroutine, so that slow handlers of low priority messages don't delay the
+	// handling of higher priority messages. Other messages, including the ones of
+	// types not present in the map, are dispatched as soon as they are read.
+	MessagePriorities map[string]MessagePriority
+	// PriorityThreshold is the priority at and above which messages skip the
+	// message queue.
+	PriorityThreshold MessagePriority
+	// MessageQueueCapacity is the maximum number of messages waiting in the
+	// message queue. Reading further messages from the connection blocks while
+	// the queue is full, so that a backend sending messages faster than they
+	// are handled is slowed down. If 0, defaultMessageQueueCapacity is used.
+	MessageQueueCapacity int
+	// IPVersion is the IP version used to connect to the backend, one of
+	// config.IPVersionAuto, config.IPVersionIPv4 or config.IPVersionIPv6. If
+	// empty, the system default is used.
+	IPVersion string
+	// ServerName is the server name sent in the TLS handshake. If empty, the
+	// host of the URL is used.
+	ServerName string
+	// RequestHeaders are optional headers added to the websocket upgrade request.
+	RequestHeaders http.Header
+	// NetDial is an optional function opening the network connections to the
+	// backend, such as to open them from another network namespace. If nil,
+	// the connections are opened with a net.Dialer.
+	NetDial func(network, address string) (net.Conn, error)
 	// MakeRequestHook is an optional callback that, if set, is called on every
 	// generated request with the raw request body.
 	MakeRequestHook MakeRequestHookFunc
+	// MessageTraceHook is an optional callback that, if set, is called with
+	// every raw message sent to or received from the backend. It must be set
+	// before connecting, see UseMessageTraceHook.
+	MessageTraceHook MessageTraceHookFunc
+	// RequestHandlerMiddlewares wrap every invocation of the request handlers,
+	// the first one being the outermost. They must be set before serving
+	// messages, see UseRequestHandlerMiddleware.
+	RequestHandlerMiddlewares []RequestHandlerMiddleware
+	// TLSSessionCache is an optional cache of TLS sessions, used to resume the
+	// session instead of performing a full TLS handshake when reconnecting to
+	// the same endpoint IP.
+	TLSSessionCache tls.ClientSessionCache
+	// VerifyPeerCertificate is an optional function called with the certificates
+	// presented by the backend during the TLS handshake, after the normal
+	// verification of the certificates. The connection fails if it returns an
+	// error. See tls.Config.VerifyPeerCertificate.
+	VerifyPeerCertificate func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error
+	// Codec encodes and decodes the messages exchanged with the backend. If
+	// nil, the messages are encoded as JSON.
+	Codec ProtocolCodec
 	// URL is the full url to the backend, including path, querystring, and so on.
 	URL string
 	// RWTimeout is the duration used for setting read and write deadlines
@@ -133,16 +193,42 @@ type ClientServerImpl struct {
 	RWTimeout time.Duration
 	// writeLock needed to ensure that only one routine is writing to the socket
 	writeLock sync.RWMutex
+	// sessionStats holds information about the current connection, it is
+	// protected by writeLock
+	sessionStats SessionStats
+	// usage counts the data sent and received over the current connection, it
+	// is protected by writeLock
+	usage *sessionUsage
 	ClientServer
 	ServiceError
 	TypeDecoder
 }
 
+// RequestHandlerMiddleware wraps the invocation of a request handler with the
+// message of the given type. handle invokes the next middleware of the chain, or
+// the request handler itself for the last one, and returns its error. An error
+// returned by the outermost middleware is logged.
+type RequestHandlerMiddleware func(messageType string, handle func() error) error
+
 // MakeRequestHookFunc is a function that is invoked on every generated request
 // with the raw request body.  MakeRequestHookFunc must return either the body
 // to send or an error.
 type MakeRequestHookFunc func([]byte) ([]byte, error)
 
+// MessageDirection is the direction of a message exchanged with the backend
+type MessageDirection string
+
+const (
+	// MessageInbound is the direction of the messages received from the backend
+	MessageInbound MessageDirection = "inbound"
+	// MessageOutbound is the direction of the messages sent to the backend
+	MessageOutbound MessageDirection = "outbound"
+)
+
+// MessageTraceHookFunc is a function that is invoked with every raw message
+// exchanged with the backend and its direction. It must not modify the message.
+type MessageTraceHookFunc func(direction MessageDirection, message []byte)
+
 // Connect opens a connection to the backend and upgrades it to a websocket. Calls to
 // 'MakeRequest' can be made after calling this, but responses will not be
 // receivable until 'Serve' is also called.
@@ -164,6 +250,11 @@ func (cs *ClientServerImpl) Connect() error {
 	// NewRequest never returns an error if the url parses and we just verified
 	// it did above
 	request, _ := http.NewRequest("GET", parsedURL.String(), nil)
+	for name, values := range cs.RequestHeaders {
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
 
 	// Sign the request; we'll send its headers via the websocket client which includes the signature
 	err = utils.SignHTTPRequest(request, cs.AgentConfig.AWSRegion, ServiceName, cs.CredentialProvider, nil)
@@ -171,9 +262,26 @@ func (cs *ClientServerImpl) Connect() error {
 		return err
 	}
 
-	timeoutDialer := &net.Dialer{Timeout: wsConnectTimeout}
-	tlsConfig := &tls.Config{ServerName: parsedURL.Host, InsecureSkipVerify: cs.AgentConfig.AcceptInsecureCert}
+	timeoutDialer := newIPVersionDialer(&net.Dialer{Timeout: wsConnectTimeout}, cs.IPVersion)
+	if cs.NetDial != nil {
+		timeoutDialer.dial = cs.NetDial
+	}
+	serverName := parsedURL.Host
+	if cs.ServerName != "" {
+		serverName = cs.ServerName
+	}
+	tlsConfig := &tls.Config{ServerName: serverName, InsecureSkipVerify: cs.AgentConfig.AcceptInsecureCert}
+	tlsConfig.VerifyPeerCertificate = cs.VerifyPeerCertificate
 	cipher.WithSupportedCipherSuites(tlsConfig)
+	var dialedConn *metricsConn
+	dial := metricsDial(timeoutDialer.Dial, func(conn *metricsConn) {
+		dialedConn = conn
+	})
+	if cs.TLSSessionCache != nil {
+		sessionCache := newIPScopedSessionCache(cs.TLSSessionCache)
+		tlsConfig.ClientSessionCache = sessionCache
+		dial = sessionCache.wrapDial(dial)
+	}
 
 	// Ensure that NO_PROXY gets set
 	noProxy := os.Getenv("NO_PROXY")
@@ -193,13 +301,19 @@ func (cs *ClientServerImpl) Connect() error {
 		WriteBufferSize:  writeBufSize,
 		TLSClientConfig:  tlsConfig,
 		Proxy:            utils.Proxy,
-		NetDial:          timeoutDialer.Dial,
+		NetDial:          dial,
 		HandshakeTimeout: wsHandshakeTimeout,
 	}
 
-	websocketConn, httpResponse, err := dialer.Dial(parsedURL.String(), request.Header)
+	var tlsHandshake tlsHandshakeStats
+	websocketConn, httpResponse, err := dialer.DialContext(tlsHandshake.traceContext(context.Background()),
+		parsedURL.String(), request.Header)
+	requestID := ""
+	availabilityZone := ""
 	if httpResponse != nil {
 		defer httpResponse.Body.Close()
+		requestID = httpResponse.Header.Get(requestIDHeader)
+		availabilityZone = httpResponse.Header.Get(availabilityZoneHeader)
 	}
 
 	if err != nil {
@@ -212,24 +326,55 @@ func (cs *ClientServerImpl) Connect() error {
 			}
 			// If there's a response, we can try to unmarshal it into one of the
 			// modeled error types
-			possibleError, _, decodeErr := DecodeData(resp, cs.TypeDecoder)
+			possibleError, _, decodeErr := DecodeDataWithCodec(resp, cs.TypeDecoder, cs.codec())
 			if decodeErr == nil {
 				return cs.NewError(possibleError)
 			}
 		}
-		seelog.Warnf("Error creating a websocket client: %v", err)
-		return errors.Wrapf(err, "websocket client: unable to dial %s response: %s",
-			parsedURL.Host, string(resp))
+		seelog.Warnf("Error creating a websocket client, request id: %s: %v", requestID, err)
+		return errors.Wrapf(err, "websocket client: unable to dial %s request id: %s response: %s",
+			parsedURL.Host, requestID, string(resp))
 	}
 
 	cs.writeLock.Lock()
 	defer cs.writeLock.Unlock()
 
 	cs.conn = websocketConn
-	seelog.Debugf("Established a Websocket connection to %s", cs.URL)
+	cs.usage = newSessionUsage(dialedConn, time.Now())
+	cs.sessionStats = SessionStats{
+		IPVersion:              connIPVersion(websocketConn.UnderlyingConn()),
+		LastRequestID:          requestID,
+		TLSHandshakeDuration:   tlsHandshake.duration,
+		TLSSessionResumed:      tlsHandshake.resumed,
+		CertificateFingerprint: connCertificateFingerprint(websocketConn.UnderlyingConn()),
+		RemoteIP:               connRemoteIP(websocketConn.UnderlyingConn()),
+		AvailabilityZone:       availabilityZone,
+	}
+	seelog.Debugf("Established a Websocket connection to %s over %s, request id: %s", cs.URL,
+		cs.sessionStats.IPVersion, requestID)
+	if tlsHandshake.duration > 0 {
+		seelog.Infof("TLS handshake with %s took %s, session resumed: %t", parsedURL.Host,
+			tlsHandshake.duration.String(), tlsHandshake.resumed)
+	}
 	return nil
 }
 
+// SessionStats returns information about the current connection to the backend
+func (cs *ClientServerImpl) SessionStats() SessionStats {
+	cs.writeLock.RLock()
+	defer cs.writeLock.RUnlock()
+	stats := cs.sessionStats
+	cs.usage.setStats(&stats, time.Now())
+	return stats
+}
+
+// currentUsage returns the usage counters of the current connection
+func (cs *ClientServerImpl) currentUsage() *sessionUsage {
+	cs.writeLock.RLock()
+	defer cs.writeLock.RUnlock()
+	return cs.usage
+}
+
 // IsReady gives a boolean response that informs the caller if the websocket
 // connection is fully established.
 func (cs *ClientServerImpl) IsReady() bool {
@@ -312,11 +457,14 @@ func (cs *ClientServerImpl) Disconnect(...interface{}) error {
 // argument *must* be a pointer to a recognized 'ecsacs' struct.
 // E.g. if you desired to handle messages from acs of type 'FooMessage', you
 // would pass the following handler in:
-//     func(message *ecsacs.FooMessage)
+//
+//	func(message *ecsacs.FooMessage)
+//
 // This function will panic if the passed in function does not have one pointer
 // argument or the argument is not a recognized type.
 // Additionally, the request handler will block processing of further messages
-// on this connection so it's important that it return quickly.
+// on this connection (or, for queued messages, of further queued messages) so
+// it's important that it return quickly.
 func (cs *ClientServerImpl) AddRequestHandler(f RequestHandler) {
 	firstArg := reflect.TypeOf(f).In(0)
 	firstArgTypeStr := firstArg.Elem().Name()
@@ -328,6 +476,25 @@ func (cs *ClientServerImpl) AddRequestHandler(f RequestHandler) {
 	cs.RequestHandlers[firstArgTypeStr] = f
 }
 
+// UseRequestHandlerMiddleware appends middlewares to the chain wrapping the
+// invocations of the request handlers. Like request handlers, middlewares must
+// be added prior to serving messages.
+func (cs *ClientServerImpl) UseRequestHandlerMiddleware(middlewares ...RequestHandlerMiddleware) {
+	cs.RequestHandlerMiddlewares = append(cs.RequestHandlerMiddlewares, middlewares...)
+}
+
+// UseNetDial sets the function opening the network connections to the backend.
+// Like request handlers, it must be set prior to connecting.
+func (cs *ClientServerImpl) UseNetDial(dial func(network, address string) (net.Conn, error)) {
+	cs.NetDial = dial
+}
+
+// UseMessageTraceHook sets the callback invoked with every raw message exchanged
+// with the backend. Like request handlers, it must be set prior to connecting.
+func (cs *ClientServerImpl) UseMessageTraceHook(hook MessageTraceHookFunc) {
+	cs.MessageTraceHook = hook
+}
+
 // SetAnyRequestHandler passes a RequestHandler object into the client.
 func (cs *ClientServerImpl) SetAnyRequestHandler(f RequestHandler) {
 	cs.AnyRequestHandler = f
@@ -365,12 +532,32 @@ func (cs *ClientServerImpl) WriteMessage(send []byte) error {
 		seelog.Warnf("Unable to set write deadline for websocket connection: %v for %s", err, cs.URL)
 	}
 
-	return cs.conn.WriteMessage(websocket.TextMessage, send)
+	if err := cs.conn.WriteMessage(websocket.TextMessage, send); err != nil {
+		return err
+	}
+	cs.usage.messageSent()
+	if cs.MessageTraceHook != nil {
+		cs.MessageTraceHook(MessageOutbound, send)
+	}
+	return nil
 }
 
 // ConsumeMessages reads messages from the websocket connection and handles read
 // messages from an active connection.
 func (cs *ClientServerImpl) ConsumeMessages() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var queue *MessagePriorityQueue
+	if len(cs.MessagePriorities) > 0 {
+		capacity := cs.MessageQueueCapacity
+		if capacity <= 0 {
+			capacity = defaultMessageQueueCapacity
+		}
+		queue = NewMessagePriorityQueue(capacity)
+		go cs.dispatchQueuedMessages(ctx, queue)
+	}
+
+	usage := cs.currentUsage()
 	for {
 		if err := cs.SetReadDeadline(time.Now().Add(cs.RWTimeout)); err != nil {
 			return err
@@ -383,16 +570,20 @@ func (cs *ClientServerImpl) ConsumeMessages() error {
 				// maybe not fatal though, we'll try to process it anyways
 				seelog.Errorf("Unexpected messageType: %v", messageType)
 			}
-			cs.handleMessage(message)
+			usage.messageReceived()
+			if cs.MessageTraceHook != nil {
+				cs.MessageTraceHook(MessageInbound, message)
+			}
+			cs.handleMessage(ctx, message, queue)
 
 		case permissibleCloseCode(err):
-			seelog.Debugf("Connection closed for a valid reason: %s", err)
+			seelog.Debugf("Connection closed for a valid reason: %s, request id: %s", err, cs.SessionStats().LastRequestID)
 			return io.EOF
 
 		default:
 			// Unexpected error occurred
-			seelog.Debugf("Error getting message from ws backend: error: [%v], messageType: [%v] ",
-				err, messageType)
+			seelog.Debugf("Error getting message from ws backend: error: [%v], messageType: [%v], request id: [%s]",
+				err, messageType, cs.SessionStats().LastRequestID)
 			return err
 		}
 
@@ -415,7 +606,7 @@ func (cs *ClientServerImpl) CreateRequestMessage(input interface{}) ([]byte, err
 	if msg.Type == "" {
 		return nil, &UnrecognizedWSRequestType{reflect.TypeOf(input).String()}
 	}
-	messageData, err := jsonutil.BuildJSON(input)
+	messageData, err := cs.codec().Encode(input)
 	if err != nil {
 		return nil, &NotMarshallableWSRequest{msg.Type, err}
 	}
@@ -428,10 +619,20 @@ func (cs *ClientServerImpl) CreateRequestMessage(input interface{}) ([]byte, err
 	return send, nil
 }
 
+// codec returns the codec of the messages exchanged with the backend
+func (cs *ClientServerImpl) codec() ProtocolCodec {
+	if cs.Codec == nil {
+		return JSONCodec{}
+	}
+	return cs.Codec
+}
+
 // handleMessage dispatches a message to the correct 'requestHandler' for its
-// type. If no request handler is found, the message is discarded.
-func (cs *ClientServerImpl) handleMessage(data []byte) {
-	typedMessage, typeStr, err := DecodeData(data, cs.TypeDecoder)
+// type, or adds it to the message queue if its priority is below the priority
+// threshold, waiting for room in the queue if it's full. If no request handler
+// is found, the message is discarded.
+func (cs *ClientServerImpl) handleMessage(ctx context.Context, data []byte, queue *MessagePriorityQueue) {
+	typedMessage, typeStr, err := DecodeDataWithCodec(data, cs.TypeDecoder, cs.codec())
 	if err != nil {
 		seelog.Warnf("Unable to handle message from backend: %v", err)
 		return
@@ -440,16 +641,84 @@ func (cs *ClientServerImpl) handleMessage(data []byte) {
 	seelog.Debugf("Received message of type: %s", typeStr)
 
 	if cs.AnyRequestHandler != nil {
-		reflect.ValueOf(cs.AnyRequestHandler).Call([]reflect.Value{reflect.ValueOf(typedMessage)})
+		cs.invokeRequestHandler(cs.AnyRequestHandler, typeStr, typedMessage)
+	}
+
+	if priority, ok := cs.MessagePriorities[typeStr]; ok && queue != nil && priority < cs.PriorityThreshold {
+		queue.Push(ctx, typeStr, typedMessage, priority)
+		return
+	}
+	cs.dispatchMessage(typeStr, typedMessage)
+}
+
+// DispatchMessage decodes a message received from the backend through another
+// channel than the websocket connection and dispatches it right away to the
+// 'requestHandler' for its type. An error is returned if the message can't be
+// decoded
+func (cs *ClientServerImpl) DispatchMessage(data []byte) error {
+	if cs.MessageTraceHook != nil {
+		cs.MessageTraceHook(MessageInbound, data)
+	}
+	typedMessage, typeStr, err := DecodeDataWithCodec(data, cs.TypeDecoder, cs.codec())
+	if err != nil {
+		return err
+	}
+
+	seelog.Debugf("Received message of type: %s", typeStr)
+
+	if cs.AnyRequestHandler != nil {
+		cs.invokeRequestHandler(cs.AnyRequestHandler, typeStr, typedMessage)
+	}
+	cs.dispatchMessage(typeStr, typedMessage)
+	return nil
+}
+
+// dispatchQueuedMessages dispatches the messages in the queue, highest priority
+// first, until the context is canceled
+func (cs *ClientServerImpl) dispatchQueuedMessages(ctx context.Context, queue *MessagePriorityQueue) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-queue.Ready():
+		}
+		for ctx.Err() == nil {
+			typeStr, typedMessage, ok := queue.Pop()
+			if !ok {
+				break
+			}
+			cs.dispatchMessage(typeStr, typedMessage)
+		}
 	}
+}
 
+// dispatchMessage calls the request handler of the message's type with the message
+func (cs *ClientServerImpl) dispatchMessage(typeStr string, typedMessage interface{}) {
 	if handler, ok := cs.RequestHandlers[typeStr]; ok {
-		reflect.ValueOf(handler).Call([]reflect.Value{reflect.ValueOf(typedMessage)})
+		cs.invokeRequestHandler(handler, typeStr, typedMessage)
 	} else {
 		seelog.Infof("No handler for message type: %s %s", typeStr, typedMessage)
 	}
 }
 
+// invokeRequestHandler calls the request handler with the message through the
+// chain of request handler middlewares
+func (cs *ClientServerImpl) invokeRequestHandler(handler RequestHandler, typeStr string, typedMessage interface{}) {
+	handle := func() error {
+		reflect.ValueOf(handler).Call([]reflect.Value{reflect.ValueOf(typedMessage)})
+		return nil
+	}
+	for i := len(cs.RequestHandlerMiddlewares) - 1; i >= 0; i-- {
+		middleware, next := cs.RequestHandlerMiddlewares[i], handle
+		handle = func() error {
+			return middleware(typeStr, next)
+		}
+	}
+	if err := handle(); err != nil {
+		seelog.Errorf("Error handling message of type %s: %v", typeStr, err)
+	}
+}
+
 func websocketScheme(httpScheme string) (string, error) {
 	// gorilla/websocket expects the websocket scheme (ws[s]://)
 	var wsScheme string
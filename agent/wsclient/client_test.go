@@ -17,9 +17,13 @@
 package wsclient
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
@@ -102,6 +106,139 @@ func TestConcurrentWritesDontPanic(t *testing.T) {
 	waitForRequests.Wait()
 }
 
+func TestConnectServerNameAndRequestHeaders(t *testing.T) {
+	type upgradeRequest struct {
+		serverName string
+		shard      string
+	}
+	requests := make(chan upgradeRequest, 1)
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- upgradeRequest{serverName: r.TLS.ServerName, shard: r.Header.Get("X-ACS-Shard")}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			ws.Close()
+		}
+	}))
+	server.StartTLS()
+	defer server.Close()
+
+	cs := getClientServer(server.URL)
+	cs.ServerName = "shard-1.ecs.us-east-1.amazonaws.com"
+	cs.RequestHeaders = http.Header{"X-ACS-Shard": []string{"shard-1.ecs.us-east-1.amazonaws.com"}}
+	require.NoError(t, cs.Connect())
+	defer cs.Close()
+
+	request := <-requests
+	assert.Equal(t, "shard-1.ecs.us-east-1.amazonaws.com", request.serverName)
+	assert.Equal(t, "shard-1.ecs.us-east-1.amazonaws.com", request.shard)
+}
+
+func TestConnectDefaultServerName(t *testing.T) {
+	serverNames := make(chan string, 1)
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverNames <- r.TLS.ServerName
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			ws.Close()
+		}
+	}))
+	server.StartTLS()
+	defer server.Close()
+
+	// Use a host name rather than the IP address of the server, since IP
+	// addresses are not sent as server names
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	cs := getClientServer("https://localhost:" + serverURL.Port())
+	require.NoError(t, cs.Connect())
+	defer cs.Close()
+
+	assert.Equal(t, "localhost:"+serverURL.Port(), <-serverNames, "host of the url should be used as server name")
+}
+
+func TestConnectExtractsRequestID(t *testing.T) {
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, http.Header{"X-Amzn-RequestId": []string{"request-id"}})
+		if err == nil {
+			ws.Close()
+		}
+	}))
+	defer server.Close()
+
+	cs := getClientServer(server.URL)
+	assert.Empty(t, cs.SessionStats().LastRequestID)
+	require.NoError(t, cs.Connect())
+	defer cs.Close()
+
+	assert.Equal(t, "request-id", cs.SessionStats().LastRequestID)
+}
+
+func TestConnectExtractsAvailabilityZone(t *testing.T) {
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, http.Header{"X-ACS-AZ": []string{"us-west-2a"}})
+		if err == nil {
+			ws.Close()
+		}
+	}))
+	defer server.Close()
+
+	cs := getClientServer(server.URL)
+	require.NoError(t, cs.Connect())
+	defer cs.Close()
+
+	assert.Equal(t, "us-west-2a", cs.SessionStats().AvailabilityZone)
+	assert.Equal(t, "127.0.0.1", cs.SessionStats().RemoteIP)
+}
+
+func TestConnectWithoutRequestID(t *testing.T) {
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			ws.Close()
+		}
+	}))
+	defer server.Close()
+
+	cs := getClientServer(server.URL)
+	require.NoError(t, cs.Connect())
+	defer cs.Close()
+
+	assert.Empty(t, cs.SessionStats().LastRequestID)
+	assert.Empty(t, cs.SessionStats().AvailabilityZone)
+}
+
+func TestConnectRecordsCertificateFingerprint(t *testing.T) {
+	server := newUpgradingTLSServer()
+	defer server.Close()
+
+	cs := getClientServer(server.URL)
+	assert.Empty(t, cs.SessionStats().CertificateFingerprint)
+	require.NoError(t, cs.Connect())
+	defer cs.Close()
+
+	digest := sha256.Sum256(server.Certificate().Raw)
+	assert.Equal(t, hex.EncodeToString(digest[:]), cs.SessionStats().CertificateFingerprint)
+}
+
+func TestConnectErrorIncludesRequestID(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-RequestId", "failed-request-id")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("forbidden"))
+	}))
+	defer server.Close()
+
+	cs := getClientServer(server.URL)
+	err := cs.Connect()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed-request-id")
+}
+
 func getClientServer(url string) *ClientServerImpl {
 	types := []interface{}{ecsacs.AckRequest{}}
 	testCreds := credentials.NewStaticCredentials("test-id", "test-secret", "test-token")
@@ -280,3 +417,245 @@ func TestSetReadDeadlineError(t *testing.T) {
 	)
 	assert.Error(t, cs.ConsumeMessages())
 }
+
+// TestConsumeMessagesHeartbeatPriorityUnderLoad tests that heartbeats are handled
+// while the handler of queued task payloads is blocked
+func TestConsumeMessagesHeartbeatPriorityUnderLoad(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := mock_wsconn.NewMockWebsocketConn(ctrl)
+	cs := &ClientServerImpl{
+		conn:            conn,
+		RequestHandlers: make(map[string]RequestHandler),
+		TypeDecoder: BuildTypeDecoder([]interface{}{
+			ecsacs.HeartbeatMessage{},
+			ecsacs.PayloadMessage{},
+		}),
+		MessagePriorities: map[string]MessagePriority{
+			"PayloadMessage":   0,
+			"HeartbeatMessage": 3,
+		},
+		PriorityThreshold: 2,
+	}
+
+	unblockPayloads := make(chan struct{})
+	payloadsHandled := make(chan string, 10)
+	cs.AddRequestHandler(func(payload *ecsacs.PayloadMessage) {
+		<-unblockPayloads
+		payloadsHandled <- aws.StringValue(payload.MessageId)
+	})
+	heartbeatHandled := make(chan struct{})
+	cs.AddRequestHandler(func(*ecsacs.HeartbeatMessage) {
+		close(heartbeatHandled)
+	})
+
+	// Simulate a load of payloads ahead of the heartbeat
+	var reads []*gomock.Call
+	for i := 0; i < 5; i++ {
+		payload := `{"type":"PayloadMessage","message":{"messageId":"` + string(rune('0'+i)) + `"}}`
+		reads = append(reads, conn.EXPECT().ReadMessage().Return(websocket.TextMessage, []byte(payload), nil))
+	}
+	reads = append(reads, conn.EXPECT().ReadMessage().Return(websocket.TextMessage,
+		[]byte(`{"type":"HeartbeatMessage","message":{"healthy":true,"messageId":"hb"}}`), nil))
+	readsDone := make(chan struct{})
+	reads = append(reads, conn.EXPECT().ReadMessage().DoAndReturn(func() (int, []byte, error) {
+		<-readsDone
+		return 0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	}))
+	gomock.InOrder(reads...)
+	conn.EXPECT().SetReadDeadline(gomock.Any()).Return(nil).AnyTimes()
+
+	consumeErr := make(chan error)
+	go func() {
+		consumeErr <- cs.ConsumeMessages()
+	}()
+
+	select {
+	case <-heartbeatHandled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Heartbeat was not handled while the payload handler was blocked")
+	}
+
+	close(unblockPayloads)
+	for i := 0; i < 5; i++ {
+		select {
+		case messageID := <-payloadsHandled:
+			assert.Equal(t, string(rune('0'+i)), messageID, "Payloads should be handled in order")
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for payloads to be handled")
+		}
+	}
+	close(readsDone)
+	assert.Equal(t, io.EOF, <-consumeErr)
+}
+
+// TestConsumeMessagesBlocksWhenQueueFull tests that no more messages are read from the
+// connection while the message queue is full
+func TestConsumeMessagesBlocksWhenQueueFull(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := mock_wsconn.NewMockWebsocketConn(ctrl)
+	cs := &ClientServerImpl{
+		conn:            conn,
+		RequestHandlers: make(map[string]RequestHandler),
+		TypeDecoder: BuildTypeDecoder([]interface{}{
+			ecsacs.PayloadMessage{},
+		}),
+		MessagePriorities: map[string]MessagePriority{
+			"PayloadMessage": 0,
+		},
+		PriorityThreshold:    2,
+		MessageQueueCapacity: 1,
+	}
+
+	unblockPayloads := make(chan struct{})
+	payloadsHandled := make(chan string, 10)
+	cs.AddRequestHandler(func(payload *ecsacs.PayloadMessage) {
+		<-unblockPayloads
+		payloadsHandled <- aws.StringValue(payload.MessageId)
+	})
+
+	// The first payload is being handled, the second one fills the queue and
+	// the third one waits for room in the queue
+	var reads []*gomock.Call
+	for i := 0; i < 3; i++ {
+		payload := `{"type":"PayloadMessage","message":{"messageId":"` + string(rune('0'+i)) + `"}}`
+		reads = append(reads, conn.EXPECT().ReadMessage().Return(websocket.TextMessage, []byte(payload), nil))
+	}
+	lastRead := make(chan struct{})
+	readsDone := make(chan struct{})
+	reads = append(reads, conn.EXPECT().ReadMessage().DoAndReturn(func() (int, []byte, error) {
+		close(lastRead)
+		<-readsDone
+		return 0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure}
+	}))
+	gomock.InOrder(reads...)
+	conn.EXPECT().SetReadDeadline(gomock.Any()).Return(nil).AnyTimes()
+
+	consumeErr := make(chan error)
+	go func() {
+		consumeErr <- cs.ConsumeMessages()
+	}()
+
+	select {
+	case <-lastRead:
+		t.Fatal("Messages should not be read while the message queue is full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(unblockPayloads)
+	for i := 0; i < 3; i++ {
+		select {
+		case messageID := <-payloadsHandled:
+			assert.Equal(t, string(rune('0'+i)), messageID, "Payloads should be handled in order")
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for payloads to be handled")
+		}
+	}
+	close(readsDone)
+	assert.Equal(t, io.EOF, <-consumeErr)
+}
+
+func TestRequestHandlerMiddlewaresWrapHandlers(t *testing.T) {
+	cs := getClientServer("https://localhost")
+	cs.RequestHandlers = make(map[string]RequestHandler)
+	var calls []string
+	cs.AddRequestHandler(func(ack *ecsacs.AckRequest) {
+		calls = append(calls, "handler "+aws.StringValue(ack.MessageId))
+	})
+	cs.SetAnyRequestHandler(func(interface{}) {
+		calls = append(calls, "any handler")
+	})
+	middleware := func(name string) RequestHandlerMiddleware {
+		return func(messageType string, handle func() error) error {
+			calls = append(calls, name+" before "+messageType)
+			err := handle()
+			calls = append(calls, name+" after "+messageType)
+			return err
+		}
+	}
+	cs.UseRequestHandlerMiddleware(middleware("outer"), middleware("inner"))
+
+	require.NoError(t, cs.DispatchMessage([]byte(`{"type":"AckRequest","message":{"messageId":"msg"}}`)))
+	assert.Equal(t, []string{
+		"outer before AckRequest", "inner before AckRequest", "any handler", "inner after AckRequest", "outer after AckRequest",
+		"outer before AckRequest", "inner before AckRequest", "handler msg", "inner after AckRequest", "outer after AckRequest",
+	}, calls)
+}
+
+func TestRequestHandlerMiddlewareSkipsHandler(t *testing.T) {
+	cs := getClientServer("https://localhost")
+	cs.RequestHandlers = make(map[string]RequestHandler)
+	handled := false
+	cs.AddRequestHandler(func(*ecsacs.AckRequest) {
+		handled = true
+	})
+	cs.UseRequestHandlerMiddleware(func(messageType string, handle func() error) error {
+		return errors.New("rejected")
+	})
+
+	require.NoError(t, cs.DispatchMessage([]byte(`{"type":"AckRequest","message":{"messageId":"msg"}}`)))
+	assert.False(t, handled, "the handler shouldn't be invoked when a middleware doesn't call it")
+}
+
+func TestConnectUsesNetDial(t *testing.T) {
+	server := newUpgradingTLSServer()
+	defer server.Close()
+
+	cs := getClientServer(server.URL)
+	var dialedAddresses []string
+	cs.UseNetDial(func(network, address string) (net.Conn, error) {
+		dialedAddresses = append(dialedAddresses, address)
+		return net.Dial(network, address)
+	})
+	require.NoError(t, cs.Connect())
+	defer cs.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, []string{serverURL.Host}, dialedAddresses)
+}
+
+func TestMessageTraceHook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	conn := mock_wsconn.NewMockWebsocketConn(ctrl)
+	cs := &ClientServerImpl{
+		conn:            conn,
+		RequestHandlers: make(map[string]RequestHandler),
+		TypeDecoder:     BuildTypeDecoder([]interface{}{ecsacs.AckRequest{}}),
+	}
+	type tracedMessage struct {
+		direction MessageDirection
+		message   string
+	}
+	var traced []tracedMessage
+	cs.UseMessageTraceHook(func(direction MessageDirection, message []byte) {
+		traced = append(traced, tracedMessage{direction, string(message)})
+	})
+
+	inbound := `{"type":"AckRequest","message":{"messageId":"in"}}`
+	gomock.InOrder(
+		conn.EXPECT().ReadMessage().Return(websocket.TextMessage, []byte(inbound), nil),
+		conn.EXPECT().ReadMessage().Return(0, nil, &websocket.CloseError{Code: websocket.CloseNormalClosure}),
+	)
+	conn.EXPECT().SetReadDeadline(gomock.Any()).Return(nil).AnyTimes()
+	assert.Equal(t, io.EOF, cs.ConsumeMessages())
+
+	outbound := `{"type":"AckRequest","message":{"messageId":"out"}}`
+	conn.EXPECT().SetWriteDeadline(gomock.Any()).Return(nil)
+	conn.EXPECT().WriteMessage(websocket.TextMessage, []byte(outbound)).Return(nil)
+	require.NoError(t, cs.WriteMessage([]byte(outbound)))
+
+	dispatched := `{"type":"AckRequest","message":{"messageId":"dispatched"}}`
+	require.NoError(t, cs.DispatchMessage([]byte(dispatched)))
+
+	assert.Equal(t, []tracedMessage{
+		{MessageInbound, inbound},
+		{MessageOutbound, outbound},
+		{MessageInbound, dispatched},
+	}, traced)
+}
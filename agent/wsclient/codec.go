@@ -0,0 +1,43 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"bytes"
+
+	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
+)
+
+// ProtocolCodec encodes the messages sent to the backend and decodes the
+// messages received from it. Messages are the generated aws-sdk-go types of the
+// backend model. The envelope holding the type of each message is always JSON.
+type ProtocolCodec interface {
+	// Encode returns the encoded message
+	Encode(msg interface{}) ([]byte, error)
+	// Decode decodes the data into msg, which must be a pointer to a message
+	Decode(data []byte, msg interface{}) error
+}
+
+// JSONCodec encodes messages as JSON, using the field names of the backend model
+type JSONCodec struct{}
+
+// Encode returns the JSON encoding of the message
+func (JSONCodec) Encode(msg interface{}) ([]byte, error) {
+	return jsonutil.BuildJSON(msg)
+}
+
+// Decode decodes the JSON data into msg
+func (JSONCodec) Decode(data []byte, msg interface{}) error {
+	return jsonutil.UnmarshalJSON(msg, bytes.NewReader(data))
+}
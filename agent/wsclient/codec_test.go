@@ -0,0 +1,74 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-ecs-agent/agent/acs/model/ecsacs"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCodec counts the messages encoded and decoded with the JSON codec
+type countingCodec struct {
+	JSONCodec
+	encoded int
+	decoded int
+}
+
+func (codec *countingCodec) Encode(msg interface{}) ([]byte, error) {
+	codec.encoded++
+	return codec.JSONCodec.Encode(msg)
+}
+
+func (codec *countingCodec) Decode(data []byte, msg interface{}) error {
+	codec.decoded++
+	return codec.JSONCodec.Decode(data, msg)
+}
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	codec := JSONCodec{}
+	data, err := codec.Encode(&ecsacs.AckRequest{MessageId: aws.String("msg")})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"messageId":"msg"}`, string(data), "the field names of the model should be used")
+
+	ack := &ecsacs.AckRequest{}
+	require.NoError(t, codec.Decode(data, ack))
+	assert.Equal(t, "msg", aws.StringValue(ack.MessageId))
+}
+
+func TestClientServerUsesCodec(t *testing.T) {
+	cs := getClientServer("https://localhost")
+	cs.RequestHandlers = make(map[string]RequestHandler)
+	codec := &countingCodec{}
+	cs.Codec = codec
+	var received *ecsacs.AckRequest
+	cs.AddRequestHandler(func(ack *ecsacs.AckRequest) {
+		received = ack
+	})
+
+	data, err := cs.CreateRequestMessage(&ecsacs.AckRequest{MessageId: aws.String("msg")})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"AckRequest","message":{"messageId":"msg"}}`, string(data))
+	require.NoError(t, cs.DispatchMessage(data))
+	require.NotNil(t, received)
+	assert.Equal(t, "msg", aws.StringValue(received.MessageId))
+	assert.Equal(t, 1, codec.encoded)
+	assert.Equal(t, 1, codec.decoded)
+}
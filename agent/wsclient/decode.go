@@ -19,11 +19,8 @@
 package wsclient
 
 import (
-	"bytes"
 	"encoding/json"
 	"reflect"
-
-	"github.com/aws/aws-sdk-go/private/protocol/json/jsonutil"
 )
 
 // DecodeData decodes a raw message into its type. E.g. An ACS message of the
@@ -31,6 +28,12 @@ import (
 // corresponding *ecsacs.FooMessage type. The type string, "FooMessage", will
 // also be returned as a convenience.
 func DecodeData(data []byte, dec TypeDecoder) (interface{}, string, error) {
+	return DecodeDataWithCodec(data, dec, JSONCodec{})
+}
+
+// DecodeDataWithCodec decodes a raw message into its type like DecodeData, the
+// message itself being decoded with the codec
+func DecodeDataWithCodec(data []byte, dec TypeDecoder, codec ProtocolCodec) (interface{}, string, error) {
 	raw := &ReceivedMessage{}
 	// Delay unmarshal until we know the type
 	err := json.Unmarshal(data, raw)
@@ -48,7 +51,7 @@ func DecodeData(data []byte, dec TypeDecoder) (interface{}, string, error) {
 	if !ok {
 		return nil, raw.Type, &UnrecognizedWSRequestType{raw.Type}
 	}
-	err = jsonutil.UnmarshalJSON(reqMessage, bytes.NewReader(raw.Message))
+	err = codec.Decode(raw.Message, reqMessage)
 	return reqMessage, raw.Type, err
 }
 
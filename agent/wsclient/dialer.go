@@ -0,0 +1,244 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/cihub/seelog"
+)
+
+const (
+	// happyEyeballsDelay is the time given to an IPv6 connection attempt to
+	// succeed before an IPv4 connection attempt is started in parallel, as
+	// recommended by RFC 8305
+	happyEyeballsDelay = 250 * time.Millisecond
+)
+
+// SessionStats holds information about the websocket connection to the backend
+type SessionStats struct {
+	// IPVersion is the IP version used by the connection, either
+	// config.IPVersionIPv4 or config.IPVersionIPv6. It is empty if the version could not be determined
+	IPVersion string
+	// LastRequestID is the request ID returned by the backend in the response to
+	// the websocket upgrade request, used to correlate the connection with the
+	// backend request traces. It is empty if the backend didn't return one
+	LastRequestID string
+	// TLSHandshakeDuration is the duration of the TLS handshake of the connection
+	TLSHandshakeDuration time.Duration
+	// TLSSessionResumed is true if a cached TLS session was resumed
+	TLSSessionResumed bool
+	// CertificateFingerprint is the hex encoded SHA-256 digest of the leaf certificate
+	// presented by the backend. It is empty if the connection doesn't use TLS
+	CertificateFingerprint string
+	// BytesSent is the number of bytes sent over the connection so far, including
+	// the TLS and websocket framing
+	BytesSent uint64
+	// BytesReceived is the number of bytes received over the connection so far,
+	// including the TLS and websocket framing
+	BytesReceived uint64
+	// MessagesPerSecond is the average number of messages sent and received per
+	// second since the connection was established
+	MessagesPerSecond float64
+	// RemoteIP is the IP of the backend host the connection was established with
+	RemoteIP string
+	// AvailabilityZone is the availability zone of the backend host, as returned
+	// by the backend in the response to the websocket upgrade request. It is
+	// empty if the backend didn't return one
+	AvailabilityZone string
+}
+
+// tlsHandshakeStats holds the duration and outcome of the TLS handshake of a connection
+type tlsHandshakeStats struct {
+	startedAt time.Time
+	duration  time.Duration
+	resumed   bool
+}
+
+// traceContext returns a context recording the TLS handshake stats when dialing with it
+func (stats *tlsHandshakeStats) traceContext(ctx context.Context) context.Context {
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			stats.startedAt = time.Now()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err != nil {
+				return
+			}
+			stats.duration = time.Since(stats.startedAt)
+			stats.resumed = state.DidResume
+		},
+	})
+}
+
+// dialFunc is the signature of net.Dialer.Dial
+type dialFunc func(network, address string) (net.Conn, error)
+
+// ipVersionDialer dials connections using the configured IP version. When the
+// IP version is auto, it attempts IPv6 first and falls back to IPv4 if the IPv6
+// attempt fails or doesn't succeed within the fallback delay ("Happy Eyeballs")
+type ipVersionDialer struct {
+	dial          dialFunc
+	ipVersion     string
+	fallbackDelay time.Duration
+}
+
+// newIPVersionDialer returns a new ipVersionDialer object
+func newIPVersionDialer(dialer *net.Dialer, ipVersion string) *ipVersionDialer {
+	return &ipVersionDialer{
+		dial:          dialer.Dial,
+		ipVersion:     ipVersion,
+		fallbackDelay: happyEyeballsDelay,
+	}
+}
+
+// Dial connects to the address, which must be a tcp address
+func (d *ipVersionDialer) Dial(network, address string) (net.Conn, error) {
+	switch d.ipVersion {
+	case config.IPVersionIPv4:
+		return d.dial("tcp4", address)
+	case config.IPVersionIPv6:
+		return d.dial("tcp6", address)
+	case config.IPVersionAuto:
+		return d.dialDualStack(address)
+	default:
+		return d.dial(network, address)
+	}
+}
+
+type dialResult struct {
+	conn    net.Conn
+	err     error
+	primary bool
+}
+
+// dialDualStack attempts to connect over IPv6, starting a parallel IPv4 attempt
+// if the IPv6 attempt fails or takes longer than the fallback delay. The first
+// connection to be established is returned and the other one is closed
+func (d *ipVersionDialer) dialDualStack(address string) (net.Conn, error) {
+	results := make(chan dialResult, 2)
+	go func() {
+		conn, err := d.dial("tcp6", address)
+		results <- dialResult{conn: conn, err: err, primary: true}
+	}()
+	inFlight := 1
+
+	fallbackStarted := false
+	startFallback := func() {
+		if fallbackStarted {
+			return
+		}
+		fallbackStarted = true
+		inFlight++
+		go func() {
+			conn, err := d.dial("tcp4", address)
+			results <- dialResult{conn: conn, err: err}
+		}()
+	}
+
+	fallbackTimer := time.NewTimer(d.fallbackDelay)
+	defer fallbackTimer.Stop()
+
+	var primaryErr, fallbackErr error
+	for {
+		select {
+		case <-fallbackTimer.C:
+			if !fallbackStarted {
+				seelog.Debugf("IPv6 connection to %s not established within %s, attempting IPv4",
+					address, d.fallbackDelay.String())
+				startFallback()
+			}
+		case result := <-results:
+			inFlight--
+			if result.err == nil {
+				if inFlight > 0 {
+					go closeLateConnection(results)
+				}
+				return result.conn, nil
+			}
+			if result.primary {
+				primaryErr = result.err
+				seelog.Debugf("Unable to connect to %s over IPv6, attempting IPv4: %v", address, result.err)
+				startFallback()
+			} else {
+				fallbackErr = result.err
+			}
+			if inFlight == 0 {
+				// IPv6 is only attempted opportunistically, report the IPv4 error
+				if fallbackErr != nil {
+					return nil, fallbackErr
+				}
+				return nil, primaryErr
+			}
+		}
+	}
+}
+
+// closeLateConnection waits for the connection attempt that lost the race and
+// closes its connection, if it succeeded
+func closeLateConnection(results <-chan dialResult) {
+	result := <-results
+	if result.conn != nil {
+		result.conn.Close()
+	}
+}
+
+// connIPVersion returns the IP version used by the connection
+func connIPVersion(conn net.Conn) string {
+	if conn == nil {
+		return ""
+	}
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	if tcpAddr.IP.To4() != nil {
+		return config.IPVersionIPv4
+	}
+	return config.IPVersionIPv6
+}
+
+// connRemoteIP returns the IP of the peer of the connection
+func connRemoteIP(conn net.Conn) string {
+	if conn == nil {
+		return ""
+	}
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	return tcpAddr.IP.String()
+}
+
+// connCertificateFingerprint returns the hex encoded SHA-256 digest of the leaf
+// certificate presented by the peer of the connection
+func connCertificateFingerprint(conn net.Conn) string {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+	peerCertificates := tlsConn.ConnectionState().PeerCertificates
+	if len(peerCertificates) == 0 {
+		return ""
+	}
+	digest := sha256.Sum256(peerCertificates[0].Raw)
+	return hex.EncodeToString(digest[:])
+}
@@ -0,0 +1,182 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/amazon-ecs-agent/agent/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConn is a net.Conn that records whether it has been closed
+type fakeConn struct {
+	net.Conn
+	network string
+	lock    sync.Mutex
+	closed  bool
+}
+
+func (conn *fakeConn) Close() error {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	conn.closed = true
+	return nil
+}
+
+func (conn *fakeConn) isClosed() bool {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	return conn.closed
+}
+
+// fakeDialBehavior describes the outcome of a dial attempt for a network
+type fakeDialBehavior struct {
+	delay time.Duration
+	err   error
+}
+
+// newFakeDialer returns a dialer whose dial attempts behave as specified per
+// network, along with the connections it returned
+func newFakeDialer(ipVersion string, behaviors map[string]fakeDialBehavior) (*ipVersionDialer, func() []*fakeConn) {
+	var lock sync.Mutex
+	var conns []*fakeConn
+	dialer := &ipVersionDialer{
+		ipVersion:     ipVersion,
+		fallbackDelay: 20 * time.Millisecond,
+		dial: func(network, address string) (net.Conn, error) {
+			behavior := behaviors[network]
+			time.Sleep(behavior.delay)
+			if behavior.err != nil {
+				return nil, behavior.err
+			}
+			conn := &fakeConn{network: network}
+			lock.Lock()
+			conns = append(conns, conn)
+			lock.Unlock()
+			return conn, nil
+		},
+	}
+	return dialer, func() []*fakeConn {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]*fakeConn{}, conns...)
+	}
+}
+
+func TestIPVersionDialerExplicitVersion(t *testing.T) {
+	testCases := []struct {
+		ipVersion       string
+		expectedNetwork string
+	}{
+		{config.IPVersionIPv4, "tcp4"},
+		{config.IPVersionIPv6, "tcp6"},
+		{"", "tcp"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.ipVersion, func(t *testing.T) {
+			dialer, _ := newFakeDialer(tc.ipVersion, nil)
+			conn, err := dialer.Dial("tcp", "ecs.us-west-2.amazonaws.com:443")
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedNetwork, conn.(*fakeConn).network)
+		})
+	}
+}
+
+func TestIPVersionDialerAutoPrefersIPv6(t *testing.T) {
+	dialer, conns := newFakeDialer(config.IPVersionAuto, nil)
+	conn, err := dialer.Dial("tcp", "ecs.us-west-2.amazonaws.com:443")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp6", conn.(*fakeConn).network)
+	assert.Len(t, conns(), 1, "IPv4 should not be attempted when IPv6 succeeds right away")
+}
+
+func TestIPVersionDialerAutoFallsBackWhenIPv6Fails(t *testing.T) {
+	dialer, _ := newFakeDialer(config.IPVersionAuto, map[string]fakeDialBehavior{
+		"tcp6": {err: errors.New("network is unreachable")},
+	})
+	conn, err := dialer.Dial("tcp", "ecs.us-west-2.amazonaws.com:443")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp4", conn.(*fakeConn).network)
+}
+
+func TestIPVersionDialerAutoFallsBackWhenIPv6IsSlow(t *testing.T) {
+	dialer, conns := newFakeDialer(config.IPVersionAuto, map[string]fakeDialBehavior{
+		"tcp6": {delay: 200 * time.Millisecond},
+	})
+	conn, err := dialer.Dial("tcp", "ecs.us-west-2.amazonaws.com:443")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp4", conn.(*fakeConn).network)
+
+	// The IPv6 connection established after the IPv4 one should be closed
+	for i := 0; i < 100; i++ {
+		dialed := conns()
+		if len(dialed) == 2 && dialed[1].isClosed() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	dialed := conns()
+	require.Len(t, dialed, 2)
+	assert.Equal(t, "tcp6", dialed[1].network)
+	assert.True(t, dialed[1].isClosed(), "Late IPv6 connection should be closed")
+	assert.False(t, dialed[0].isClosed(), "Returned IPv4 connection should not be closed")
+}
+
+func TestIPVersionDialerAutoBothFail(t *testing.T) {
+	ipv4Err := errors.New("ipv4 connection refused")
+	dialer, _ := newFakeDialer(config.IPVersionAuto, map[string]fakeDialBehavior{
+		"tcp6": {err: errors.New("ipv6 network is unreachable")},
+		"tcp4": {err: ipv4Err},
+	})
+	_, err := dialer.Dial("tcp", "ecs.us-west-2.amazonaws.com:443")
+	assert.Equal(t, ipv4Err, err)
+}
+
+func TestConnIPVersion(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, err := net.Dial("tcp4", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, config.IPVersionIPv4, connIPVersion(conn))
+	assert.Equal(t, config.IPVersionIPv6, connIPVersion(&fakeAddrConn{addr: &net.TCPAddr{IP: net.IPv6loopback}}))
+	assert.Equal(t, "", connIPVersion(nil))
+}
+
+// fakeAddrConn is a net.Conn with a fixed remote address
+type fakeAddrConn struct {
+	net.Conn
+	addr net.Addr
+}
+
+func (conn *fakeAddrConn) RemoteAddr() net.Addr {
+	return conn.addr
+}
@@ -0,0 +1,127 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// metricsConn wraps a net.Conn, counting the bytes read from and written to it
+type metricsConn struct {
+	// The counters are accessed atomically, they're first in the struct so that
+	// they're 64-bit aligned on 32-bit platforms
+	bytesRead    uint64
+	bytesWritten uint64
+	net.Conn
+}
+
+// newMetricsConn returns a new metricsConn object wrapping the connection
+func newMetricsConn(conn net.Conn) *metricsConn {
+	return &metricsConn{Conn: conn}
+}
+
+// Read reads from the connection, counting the bytes read
+func (conn *metricsConn) Read(b []byte) (int, error) {
+	n, err := conn.Conn.Read(b)
+	atomic.AddUint64(&conn.bytesRead, uint64(n))
+	return n, err
+}
+
+// Write writes to the connection, counting the bytes written
+func (conn *metricsConn) Write(b []byte) (int, error) {
+	n, err := conn.Conn.Write(b)
+	atomic.AddUint64(&conn.bytesWritten, uint64(n))
+	return n, err
+}
+
+// totalBytesRead returns the number of bytes read from the connection so far
+func (conn *metricsConn) totalBytesRead() uint64 {
+	if conn == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&conn.bytesRead)
+}
+
+// totalBytesWritten returns the number of bytes written to the connection so far
+func (conn *metricsConn) totalBytesWritten() uint64 {
+	if conn == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&conn.bytesWritten)
+}
+
+// metricsDial returns a dialFunc wrapping the connections established with dial
+// into a metricsConn, which is passed to dialed
+func metricsDial(dial dialFunc, dialed func(*metricsConn)) dialFunc {
+	return func(network, address string) (net.Conn, error) {
+		conn, err := dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		wrapped := newMetricsConn(conn)
+		dialed(wrapped)
+		return wrapped, nil
+	}
+}
+
+// sessionUsage counts the data sent and received over a websocket connection
+type sessionUsage struct {
+	// The counters are accessed atomically, they're first in the struct so that
+	// they're 64-bit aligned on 32-bit platforms
+	messagesSent     uint64
+	messagesReceived uint64
+	// conn is the connection the websocket was established over, it is nil if
+	// the connection was not dialed by the client
+	conn        *metricsConn
+	connectedAt time.Time
+}
+
+// newSessionUsage returns a new sessionUsage object for the connection established at connectedAt
+func newSessionUsage(conn *metricsConn, connectedAt time.Time) *sessionUsage {
+	return &sessionUsage{
+		conn:        conn,
+		connectedAt: connectedAt,
+	}
+}
+
+// messageSent counts a message sent over the connection
+func (usage *sessionUsage) messageSent() {
+	if usage == nil {
+		return
+	}
+	atomic.AddUint64(&usage.messagesSent, 1)
+}
+
+// messageReceived counts a message received over the connection
+func (usage *sessionUsage) messageReceived() {
+	if usage == nil {
+		return
+	}
+	atomic.AddUint64(&usage.messagesReceived, 1)
+}
+
+// setStats sets the usage fields of the session stats as of now
+func (usage *sessionUsage) setStats(stats *SessionStats, now time.Time) {
+	if usage == nil {
+		return
+	}
+	stats.BytesSent = usage.conn.totalBytesWritten()
+	stats.BytesReceived = usage.conn.totalBytesRead()
+	if elapsed := now.Sub(usage.connectedAt).Seconds(); elapsed > 0 {
+		messages := atomic.LoadUint64(&usage.messagesSent) + atomic.LoadUint64(&usage.messagesReceived)
+		stats.MessagesPerSecond = float64(messages) / elapsed
+	}
+}
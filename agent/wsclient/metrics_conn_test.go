@@ -0,0 +1,134 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsConnCountsBytes(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := newMetricsConn(client)
+
+	go func() {
+		buf := make([]byte, 5)
+		server.Read(buf)
+		server.Write([]byte("pong!!!"))
+	}()
+
+	n, err := conn.Write([]byte("ping!"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	buf := make([]byte, 16)
+	n, err = conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, 7, n)
+
+	assert.Equal(t, uint64(5), conn.totalBytesWritten())
+	assert.Equal(t, uint64(7), conn.totalBytesRead())
+}
+
+func TestMetricsConnNil(t *testing.T) {
+	var conn *metricsConn
+	assert.Zero(t, conn.totalBytesRead())
+	assert.Zero(t, conn.totalBytesWritten())
+}
+
+func TestSessionUsageStats(t *testing.T) {
+	connectedAt := time.Now()
+	conn := newMetricsConn(nil)
+	conn.bytesWritten = 100
+	conn.bytesRead = 300
+	usage := newSessionUsage(conn, connectedAt)
+	for i := 0; i < 6; i++ {
+		usage.messageSent()
+	}
+	for i := 0; i < 4; i++ {
+		usage.messageReceived()
+	}
+
+	stats := SessionStats{LastRequestID: "request-id"}
+	usage.setStats(&stats, connectedAt.Add(5*time.Second))
+	assert.Equal(t, SessionStats{
+		LastRequestID:     "request-id",
+		BytesSent:         100,
+		BytesReceived:     300,
+		MessagesPerSecond: 2,
+	}, stats)
+}
+
+func TestSessionUsageNil(t *testing.T) {
+	var usage *sessionUsage
+	usage.messageSent()
+	usage.messageReceived()
+	stats := SessionStats{}
+	usage.setStats(&stats, time.Now())
+	assert.Equal(t, SessionStats{}, stats)
+}
+
+func TestConnectCountsSessionUsage(t *testing.T) {
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	received := make(chan []byte, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		_, message, err := ws.ReadMessage()
+		if err == nil {
+			received <- message
+		}
+	}))
+	defer server.Close()
+
+	cs := getClientServer(server.URL)
+	assert.Zero(t, cs.SessionStats().BytesSent)
+	require.NoError(t, cs.Connect())
+	defer cs.Close()
+
+	// The TLS handshake and the websocket upgrade are counted
+	connected := cs.SessionStats()
+	assert.NotZero(t, connected.BytesSent)
+	assert.NotZero(t, connected.BytesReceived)
+	assert.Zero(t, connected.MessagesPerSecond)
+
+	payload := strings.Repeat("a", 4096)
+	require.NoError(t, cs.WriteMessage([]byte(payload)))
+	select {
+	case message := <-received:
+		assert.Equal(t, payload, string(message))
+	case <-time.After(time.Second):
+		t.Fatal("Message not received by the server")
+	}
+
+	sent := cs.SessionStats()
+	assert.True(t, sent.BytesSent >= connected.BytesSent+uint64(len(payload)),
+		"Bytes sent should include the message, sent %d bytes before and %d after", connected.BytesSent, sent.BytesSent)
+	assert.True(t, sent.MessagesPerSecond > 0)
+}
@@ -0,0 +1,138 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+// MessagePriority is the priority with which a message received from the backend
+// is dispatched to its request handler. Messages with a higher priority are
+// dispatched first.
+type MessagePriority int
+
+// queuedMessage is a decoded message waiting to be dispatched
+type queuedMessage struct {
+	typeStr  string
+	message  interface{}
+	priority MessagePriority
+	// seq is used to dispatch messages of the same priority in the order they
+	// were received
+	seq uint64
+}
+
+// messageHeap implements heap.Interface for queued messages, ordered by
+// priority and then by arrival
+type messageHeap []*queuedMessage
+
+func (h messageHeap) Len() int { return len(h) }
+
+func (h messageHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h messageHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *messageHeap) Push(x interface{}) {
+	*h = append(*h, x.(*queuedMessage))
+}
+
+func (h *messageHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// MessagePriorityQueue is a bounded priority queue of messages received from the
+// backend that are waiting to be dispatched to their request handlers. It is safe
+// for concurrent use.
+type MessagePriorityQueue struct {
+	lock     sync.Mutex
+	messages messageHeap
+	seq      uint64
+	// ready is signalled whenever a message is pushed to the queue
+	ready chan struct{}
+	// slots holds a value for every message in the queue, pushes block while
+	// it's full
+	slots chan struct{}
+}
+
+// NewMessagePriorityQueue returns a new, empty MessagePriorityQueue holding up to
+// capacity messages
+func NewMessagePriorityQueue(capacity int) *MessagePriorityQueue {
+	return &MessagePriorityQueue{
+		ready: make(chan struct{}, 1),
+		slots: make(chan struct{}, capacity),
+	}
+}
+
+// Push adds a message to the queue. It blocks while the queue is full, until
+// another message is popped or the context is canceled, in which case the
+// context error is returned
+func (q *MessagePriorityQueue) Push(ctx context.Context, typeStr string, message interface{}, priority MessagePriority) error {
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	q.lock.Lock()
+	heap.Push(&q.messages, &queuedMessage{
+		typeStr:  typeStr,
+		message:  message,
+		priority: priority,
+		seq:      q.seq,
+	})
+	q.seq++
+	q.lock.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pop removes the message with the highest priority from the queue and returns
+// it. It returns false if the queue is empty.
+func (q *MessagePriorityQueue) Pop() (string, interface{}, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.messages.Len() == 0 {
+		return "", nil, false
+	}
+	next := heap.Pop(&q.messages).(*queuedMessage)
+	<-q.slots
+	return next.typeStr, next.message, true
+}
+
+// Len returns the number of messages in the queue
+func (q *MessagePriorityQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.messages.Len()
+}
+
+// Ready returns a channel that receives a value whenever messages are pushed to
+// the queue
+func (q *MessagePriorityQueue) Ready() <-chan struct{} {
+	return q.ready
+}
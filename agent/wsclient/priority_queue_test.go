@@ -0,0 +1,95 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessagePriorityQueueOrder(t *testing.T) {
+	queue := NewMessagePriorityQueue(10)
+	queue.Push(context.TODO(), "PayloadMessage", "payload1", 0)
+	queue.Push(context.TODO(), "AttachTaskNetworkInterfacesMessage", "eni1", 1)
+	queue.Push(context.TODO(), "PayloadMessage", "payload2", 0)
+	queue.Push(context.TODO(), "HeartbeatMessage", "heartbeat1", 3)
+	queue.Push(context.TODO(), "IAMRoleCredentialsMessage", "credentials1", 2)
+	queue.Push(context.TODO(), "HeartbeatMessage", "heartbeat2", 3)
+	assert.Equal(t, 6, queue.Len())
+
+	var popped []interface{}
+	for {
+		_, message, ok := queue.Pop()
+		if !ok {
+			break
+		}
+		popped = append(popped, message)
+	}
+	assert.Equal(t, []interface{}{"heartbeat1", "heartbeat2", "credentials1", "eni1", "payload1", "payload2"}, popped)
+	assert.Equal(t, 0, queue.Len())
+}
+
+func TestMessagePriorityQueueReadySignalled(t *testing.T) {
+	queue := NewMessagePriorityQueue(10)
+	select {
+	case <-queue.Ready():
+		t.Fatal("Empty queue should not be ready")
+	default:
+	}
+
+	queue.Push(context.TODO(), "PayloadMessage", "payload1", 0)
+	queue.Push(context.TODO(), "PayloadMessage", "payload2", 0)
+	select {
+	case <-queue.Ready():
+	default:
+		t.Fatal("Queue should be ready after a push")
+	}
+}
+
+func TestMessagePriorityQueuePushBlocksWhenFull(t *testing.T) {
+	queue := NewMessagePriorityQueue(1)
+	queue.Push(context.TODO(), "PayloadMessage", "payload1", 0)
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	assert.Equal(t, context.Canceled, queue.Push(ctx, "PayloadMessage", "payload2", 0),
+		"Push should return once the context is canceled")
+
+	pushed := make(chan struct{})
+	go func() {
+		queue.Push(context.TODO(), "PayloadMessage", "payload2", 0)
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("Push should block while the queue is full")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, message, ok := queue.Pop()
+	assert.True(t, ok)
+	assert.Equal(t, "payload1", message)
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Push should unblock once a message is popped")
+	}
+	assert.Equal(t, 1, queue.Len())
+}
@@ -0,0 +1,81 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+)
+
+// ipScopedSessionCache scopes the TLS sessions of a shared cache to the IP of
+// the endpoint the connection is established with, so that a session is only
+// resumed when reconnecting to the same endpoint IP. Each connection attempt
+// uses its own ipScopedSessionCache
+type ipScopedSessionCache struct {
+	cache tls.ClientSessionCache
+	lock  sync.RWMutex
+	// remoteIP is the IP of the endpoint, set once the connection is dialed
+	remoteIP string
+}
+
+// newIPScopedSessionCache returns a new ipScopedSessionCache object
+func newIPScopedSessionCache(cache tls.ClientSessionCache) *ipScopedSessionCache {
+	return &ipScopedSessionCache{cache: cache}
+}
+
+// wrapDial returns a dial function recording the IP of the dialed endpoint
+func (scoped *ipScopedSessionCache) wrapDial(dial dialFunc) dialFunc {
+	return func(network, address string) (net.Conn, error) {
+		conn, err := dial(network, address)
+		if err != nil {
+			return nil, err
+		}
+		if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+			scoped.lock.Lock()
+			scoped.remoteIP = tcpAddr.IP.String()
+			scoped.lock.Unlock()
+		}
+		return conn, nil
+	}
+}
+
+// key returns the key of the session in the shared cache, or false if the IP of
+// the endpoint is unknown, in which case sessions are neither stored nor resumed
+func (scoped *ipScopedSessionCache) key(sessionKey string) (string, bool) {
+	scoped.lock.RLock()
+	defer scoped.lock.RUnlock()
+	if scoped.remoteIP == "" {
+		return "", false
+	}
+	return scoped.remoteIP + "/" + sessionKey, true
+}
+
+// Get returns the session cached for the endpoint IP
+func (scoped *ipScopedSessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	key, ok := scoped.key(sessionKey)
+	if !ok {
+		return nil, false
+	}
+	return scoped.cache.Get(key)
+}
+
+// Put caches the session for the endpoint IP
+func (scoped *ipScopedSessionCache) Put(sessionKey string, session *tls.ClientSessionState) {
+	key, ok := scoped.key(sessionKey)
+	if !ok {
+		return
+	}
+	scoped.cache.Put(key, session)
+}
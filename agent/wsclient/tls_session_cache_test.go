@@ -0,0 +1,105 @@
+//go:build unit
+// +build unit
+
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package wsclient
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newUpgradingTLSServer() *httptest.Server {
+	upgrader := websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err == nil {
+			ws.Close()
+		}
+	}))
+}
+
+func TestConnectResumesCachedTLSSession(t *testing.T) {
+	server := newUpgradingTLSServer()
+	defer server.Close()
+	sessionCache := tls.NewLRUClientSessionCache(10)
+
+	cs := getClientServer(server.URL)
+	cs.TLSSessionCache = sessionCache
+	require.NoError(t, cs.Connect())
+	assert.False(t, cs.SessionStats().TLSSessionResumed)
+	assert.True(t, cs.SessionStats().TLSHandshakeDuration > 0)
+	cs.Close()
+
+	cs = getClientServer(server.URL)
+	cs.TLSSessionCache = sessionCache
+	require.NoError(t, cs.Connect())
+	defer cs.Close()
+	assert.True(t, cs.SessionStats().TLSSessionResumed, "the cached TLS session should be resumed")
+}
+
+func TestConnectWithoutTLSSessionCache(t *testing.T) {
+	server := newUpgradingTLSServer()
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		cs := getClientServer(server.URL)
+		require.NoError(t, cs.Connect())
+		assert.False(t, cs.SessionStats().TLSSessionResumed)
+		cs.Close()
+	}
+}
+
+func TestIPScopedSessionCacheDifferentIP(t *testing.T) {
+	sessionCache := tls.NewLRUClientSessionCache(10)
+	session := &tls.ClientSessionState{}
+
+	first := newIPScopedSessionCache(sessionCache)
+	first.remoteIP = "10.0.0.1"
+	first.Put("ecs.us-west-2.amazonaws.com", session)
+	cached, ok := first.Get("ecs.us-west-2.amazonaws.com")
+	assert.True(t, ok)
+	assert.Equal(t, session, cached)
+
+	// Reconnecting to another endpoint IP doesn't resume the session
+	second := newIPScopedSessionCache(sessionCache)
+	second.remoteIP = "10.0.0.2"
+	_, ok = second.Get("ecs.us-west-2.amazonaws.com")
+	assert.False(t, ok)
+}
+
+func TestIPScopedSessionCacheRecordsDialedIP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	scoped := newIPScopedSessionCache(tls.NewLRUClientSessionCache(10))
+	// Sessions are not cached until the endpoint IP is known
+	scoped.Put("server", &tls.ClientSessionState{})
+	_, ok := scoped.Get("server")
+	assert.False(t, ok)
+
+	conn, err := scoped.wrapDial(net.Dial)("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, "127.0.0.1", scoped.remoteIP)
+}